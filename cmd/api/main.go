@@ -5,10 +5,36 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"forgeai/pkg/api"
+	"forgeai/pkg/audit"
+	"forgeai/pkg/authz"
+	"forgeai/pkg/autoscale"
+	"forgeai/pkg/config"
+	"forgeai/pkg/container"
+	"forgeai/pkg/corpus"
+	"forgeai/pkg/envelope"
+	"forgeai/pkg/fixtures"
+	"forgeai/pkg/hardware"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/languages"
+	"forgeai/pkg/leader"
+	"forgeai/pkg/notify"
+	"forgeai/pkg/events"
+	"forgeai/pkg/httpclient"
+	"forgeai/pkg/offline"
+	"forgeai/pkg/quota"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/security"
+	"forgeai/pkg/sinks"
+	"forgeai/pkg/storage"
+	"forgeai/pkg/volumes"
+	"forgeai/pkg/watchdog"
+	"forgeai/pkg/workspace"
 )
 
 func main() {
@@ -26,13 +52,426 @@ func main() {
 		cancel()
 	}()
 
+	// Load the configuration file
+	file, err := config.LoadDefaultFile()
+	if err != nil {
+		fmt.Printf("Error loading config file: %v\n", err)
+		os.Exit(1)
+	}
+	
+	// Offline mode refuses the features below that need the network
+	if file.Offline || offline.FromEnv() {
+		offline.Enable(true)
+		fmt.Println("Offline mode: outbound network access is disabled")
+	}
+	
+	// Outbound requests go through the configured proxy and certificates
+	if err := httpclient.Configure(file.HTTP); err != nil {
+		fmt.Printf("Error in http configuration: %v\n", err)
+		os.Exit(1)
+	}
+	
+	// Encryption at rest is disabled unless keys are configured
+	var keyring *envelope.Keyring
+	if len(file.Encryption.Keys) > 0 {
+		keyring, err = envelope.LoadKeyring(file.Encryption)
+		if err != nil {
+			fmt.Printf("Error loading encryption keys: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	
+	// Artifacts stay in memory unless a storage backend is configured
+	var store storage.Backend
+	if file.Storage.Backend != "" {
+		store, err = storage.New(file.Storage)
+		if err != nil {
+			fmt.Printf("Error configuring storage: %v\n", err)
+			os.Exit(1)
+		}
+		if keyring != nil {
+			store = storage.WithEncryption(store, keyring)
+		}
+	}
+
+	// Job events are disabled unless sinks are configured
+	var emitter *events.Emitter
+	if len(file.Events.Sinks) > 0 {
+		emitter, err = events.New(file.Events)
+		if err != nil {
+			fmt.Printf("Error configuring job events: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	
+	// Notifications are disabled unless channels are configured
+	var notifier *notify.Notifier
+	var failureRate *notify.FailureRateMonitor
+	if len(file.Notifications.Channels) > 0 {
+		notifier, err = notify.New(file.Notifications)
+		if err != nil {
+			fmt.Printf("Error configuring notifications: %v\n", err)
+			os.Exit(1)
+		}
+		
+		rate := file.Notifications.FailureRate
+		failureRate = notify.NewFailureRateMonitor(notifier)
+		if rate.Threshold > 0 {
+			failureRate.Threshold = rate.Threshold
+		}
+		if rate.Window > 0 {
+			failureRate.Window = rate.Window
+		}
+		if rate.MinJobs > 0 {
+			failureRate.MinJobs = rate.MinJobs
+		}
+	}
+
+	// Prepare managed workspaces, removing those left by a crashed server
+	var workspaces *workspace.Manager
+	if cfg := file.Workspaces; cfg.Root != "" {
+		workspaces = workspace.NewManager(cfg.Root)
+		workspaces.Tmpfs = cfg.Tmpfs
+		workspaces.TmpfsSize = cfg.TmpfsSize
+		workspaces.Quota = cfg.Quota
+		
+		removed, err := workspaces.Open()
+		if err != nil {
+			fmt.Printf("Error preparing workspaces: %v\n", err)
+			os.Exit(1)
+		}
+		if removed > 0 {
+			fmt.Printf("Removed %d stale workspaces from %s\n", removed, cfg.Root)
+		}
+	}
+
+	// Configure the host watchdog
+	var dog *watchdog.Watchdog
+	if file.Watchdog.Enabled {
+		dog, err = newWatchdog(file.Watchdog)
+		if err != nil {
+			fmt.Printf("Error configuring watchdog: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Remove what crashed instances left behind, now and periodically
+	// Docker daemon, which may be a remote sandbox host
+	daemon := container.Daemon{
+		Host:      file.Docker.Host,
+		TLSVerify: file.Docker.TLSVerify,
+		CACert:    file.Docker.TLSCACert,
+		Cert:      file.Docker.TLSCert,
+		Key:       file.Docker.TLSKey,
+	}
+	if err := daemon.Validate(); err != nil {
+		fmt.Printf("Error configuring docker: %v\n", err)
+		os.Exit(1)
+	}
+
+	var reaper *container.Reaper
+	if file.Reaper.Enabled == nil || *file.Reaper.Enabled {
+		reaper = container.NewReaper(container.DefaultInstance())
+		reaper.Workspaces = workspaces
+		reaper.Daemon = daemon
+		if file.Reaper.Interval > 0 {
+			reaper.Interval = file.Reaper.Interval
+		}
+	}
+
+	// Configure the security self-test
+	var selfTest *security.SelfTester
+	if file.SelfTest.Enabled {
+		tests, err := security.SelectTests(security.DefaultTests(), file.SelfTest.Tests)
+		if err != nil {
+			fmt.Printf("Error configuring security self-test: %v\n", err)
+			os.Exit(1)
+		}
+		selfTest = security.NewSelfTester(tests)
+		if file.SelfTest.Interval > 0 {
+			selfTest.Interval = file.SelfTest.Interval
+		}
+	}
+
+	// Parse the listening port
+	port := 8080
+	if value := os.Getenv("FORGEAI_API_PORT"); value != "" {
+		port, err = strconv.Atoi(value)
+		if err != nil || port < 0 || port > 65535 {
+			fmt.Printf("Invalid FORGEAI_API_PORT: %q\n", value)
+			os.Exit(1)
+		}
+	}
+	
+	// Parse the deduplication window
+	var dedupWindow time.Duration
+	if window := os.Getenv("FORGEAI_DEDUP_WINDOW"); window != "" {
+		dedupWindow, err = time.ParseDuration(window)
+		if err != nil {
+			fmt.Printf("Invalid FORGEAI_DEDUP_WINDOW: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	
+	// Parse the Unix socket permissions
+	var socketMode os.FileMode
+	if mode := os.Getenv("FORGEAI_API_SOCKET_MODE"); mode != "" {
+		parsed, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			fmt.Printf("Invalid FORGEAI_API_SOCKET_MODE: %v\n", err)
+			os.Exit(1)
+		}
+		socketMode = os.FileMode(parsed)
+	}
+
+	// Elect the replica that performs singleton duties
+	replica := file.Leader.ID
+	if replica == "" {
+		replica = fmt.Sprintf("%s-%d", container.DefaultInstance(), os.Getpid())
+	}
+	var elector *leader.Elector
+	if cfg := file.Leader; cfg.LeaseFile != "" {
+		elector = leader.NewElector(leader.NewFileLock(cfg.LeaseFile), replica)
+		if cfg.TTL > 0 {
+			elector.TTL = cfg.TTL
+		}
+	}
+
+	// Report the hardware class of this replica with every job
+	var probe *hardware.Probe
+	if cfg := file.Hardware; !cfg.Disabled {
+		probe = &hardware.Probe{Worker: replica}
+		if cfg.Calibrate {
+			fmt.Printf("Hardware calibration score: %.2f\n", probe.Calibrate(cfg.Calibration))
+		}
+	}
+
+	// Recommend replicas for the load and scale them when a scaler is set
+	scaling, autoscaler, err := newAutoscaler(file.Autoscale)
+	if err != nil {
+		fmt.Printf("Error configuring autoscaling: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Redact the code corpus with the built-in and configured rules
+	redactor, err := corpus.NewRedactor(file.Corpus.Redact)
+	if err != nil {
+		fmt.Printf("Error configuring corpus: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Route languages to isolation classes
+	isolation := api.Isolation{
+		Default:     file.Isolation.Default,
+		Classes:     make(map[string]api.IsolationClass),
+		Languages:   make(map[string]string),
+		Concurrency: make(map[string]int),
+	}
+	for name, class := range file.Isolation.Classes {
+		isolation.Classes[name] = api.IsolationClass{
+			Backend: class.Backend,
+			Runtime: class.Runtime,
+			Nsjail: api.Nsjail{
+				Path:         class.Nsjail.Path,
+				Profile:      class.Nsjail.Profile,
+				Interpreters: class.Nsjail.Interpreters,
+				Mounts:       class.Nsjail.Mounts,
+				TmpSize:      class.Nsjail.TmpSize,
+				Home:         class.Nsjail.Home,
+			},
+		}
+	}
+	for language, cfg := range file.Isolation.Languages {
+		if cfg.Class != "" {
+			isolation.Languages[language] = cfg.Class
+		}
+		isolation.Concurrency[language] = cfg.Concurrency
+	}
+	
+	// Data classifications set how jobs are stored and where they run
+	classifications := make(map[string]jobs.ClassificationPolicy)
+	for name, cfg := range file.Classifications.Policies {
+		classifications[name] = jobs.ClassificationPolicy{
+			LogRetention:      cfg.LogRetention,
+			RequireEncryption: cfg.RequireEncryption,
+			HashCodeOnly:      cfg.HashCodeOnly,
+			Isolation:         cfg.Isolation,
+		}
+		if cfg.Isolation != "" {
+			if isolation.Classifications == nil {
+				isolation.Classifications = make(map[string]string)
+			}
+			isolation.Classifications[name] = cfg.Isolation
+		}
+	}
+	if err := jobs.ValidateClassifications(file.Classifications.Default, classifications); err != nil {
+		fmt.Printf("Error configuring data classifications: %v\n", err)
+		os.Exit(1)
+	}
+	if err := isolation.Validate(); err != nil {
+		fmt.Printf("Error configuring isolation: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Spill bursts of jobs to disk
+	var queue jobs.Queue
+	if cfg := file.Queue; cfg.SpillDir != "" {
+		spill := &jobs.SpillQueue{Dir: cfg.SpillDir, Threshold: cfg.SpillThreshold, Workers: cfg.Workers}
+		if keyring != nil {
+			spill.Keys = keyring
+		}
+		defer spill.Close()
+		queue = spill
+	}
+
+	// Load the fixtures that jobs can mount
+	var fixtureStore *fixtures.Store
+	if cfg := file.Fixtures; cfg.Dir != "" {
+		fixtureStore = fixtures.NewStore(cfg.Dir)
+		fixtureStore.MaxSize = cfg.MaxSize
+		if err := fixtureStore.Open(); err != nil {
+			fmt.Printf("Error opening fixtures: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Prepare the persistent volumes of tenants
+	var volumeManager *volumes.Manager
+	if cfg := file.Volumes; cfg.Root != "" {
+		volumeManager = volumes.NewManager(cfg.Root)
+		volumeManager.Quota = cfg.Quota
+		volumeManager.MaxPerTenant = cfg.MaxPerTenant
+		volumeManager.TenantLabel = cfg.TenantLabel
+		if err := volumeManager.Open(); err != nil {
+			fmt.Printf("Error preparing volumes: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Configure the buckets that jobs may push their results to
+	var sinkRegistry *sinks.Registry
+	if cfg := file.Sinks; len(cfg.S3) > 0 || len(cfg.GCS) > 0 {
+		sinkRegistry, err = sinks.FromConfig(cfg)
+		if err != nil {
+			fmt.Printf("Error configuring output sinks: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Record admin actions and export them to the configured sinks
+	var trail *audit.Trail
+	if cfg := file.Audit; cfg.File != "" || cfg.Syslog.Address != "" || cfg.Webhook.URL != "" {
+		trail, err = audit.FromConfig(cfg)
+		if err != nil {
+			fmt.Printf("Error configuring the audit trail: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Users and groups that the authz settings grant access to
+	var directory *authz.Directory
+	var scimToken string
+	if cfg := file.Authz; len(cfg.Groups) > 0 || cfg.Default != nil || cfg.SCIMTokenFile != "" {
+		directory, scimToken, err = openDirectory(cfg)
+		if err != nil {
+			fmt.Printf("Error configuring authorization: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Credentials of the admin API
+	var adminToken string
+	if file.Admin.TokenFile != "" {
+		adminToken, err = readToken(file.Admin.TokenFile)
+		if err != nil {
+			fmt.Printf("Error configuring the admin API: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Quotas of tenants and users
+	var quotas *quota.Manager
+	if cfg := file.Quotas; len(cfg.Limits) > 0 || cfg.Overrides != "" {
+		limits := make([]quota.Limit, 0, len(cfg.Limits))
+		for _, limit := range cfg.Limits {
+			limits = append(limits, quota.Limit{
+				Metric: limit.Metric,
+				Limit:  limit.Limit,
+				Window: limit.Window,
+				Burst:  limit.Burst,
+			})
+		}
+		quotas = quota.NewManager(limits)
+		quotas.Path = cfg.Overrides
+		if err := quotas.Open(); err != nil {
+			fmt.Printf("Error configuring quotas: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Settings that can be reloaded while the server runs
+	settings, err := loadSettings(file)
+	if err != nil {
+		fmt.Printf("Error loading settings: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Start the API server
 	server := api.NewServer(&api.Config{
-		Host: "0.0.0.0",
-		Port: 8080,
+		Host:           "0.0.0.0",
+		Port:           port,
+		PluginDir:      "./plugins",
+		SigningKeyPath: os.Getenv("FORGEAI_SIGNING_KEY"),
+		JobLogPath:     os.Getenv("FORGEAI_JOB_LOG"),
+		Storage:        store,
+		Settings:       settings,
+		Notifier:       notifier,
+		FailureRate:    failureRate,
+		Events:         emitter,
+		Workspaces:     workspaces,
+		Fixtures:       fixtureStore,
+		Volumes:        volumeManager,
+		Sinks:          sinkRegistry,
+		HashCodeOnly:   file.Encryption.HashCodeOnly,
+		Classifications: classifications,
+		DefaultClassification: file.Classifications.Default,
+		Audit:          trail,
+		ActorHeader:    file.Audit.ActorHeader,
+		Directory:      directory,
+		SCIMToken:      scimToken,
+		AdminToken:     adminToken,
+		Admins:         file.Admin.Admins,
+		Quotas:         quotas,
+		TokenMaxTTL:    file.Tokens.MaxTTL,
+		Watchdog:       dog,
+		Hardware:       probe,
+		Scaling:        scaling,
+		Autoscaler:     autoscaler,
+		SelfTest:       selfTest,
+		Reaper:         reaper,
+		Router:         os.Getenv("FORGEAI_API_ROUTER"),
+		Socket:         os.Getenv("FORGEAI_API_SOCKET"),
+		SocketMode:     socketMode,
+		PipeSecurity:   os.Getenv("FORGEAI_API_PIPE_SDDL"),
+		Permissive:     os.Getenv("FORGEAI_PERMISSIVE") == "true",
+		DedupWindow:    dedupWindow,
+		Docker:         daemon,
+		Leader:         elector,
+		Worker:         replica,
+		HeartbeatInterval: file.Recovery.HeartbeatInterval,
+		SessionTTL:     file.Recovery.SessionTTL,
+		Retry:          jobs.RetryPolicy{MaxAttempts: file.Recovery.MaxAttempts},
+		Isolation:      isolation,
+		Queue:          queue,
+		Corpus: corpus.Policy{
+			ConsentLabel: file.Corpus.ConsentLabel,
+			TenantLabel:  file.Corpus.TenantLabel,
+			Tenants:      file.Corpus.ConsentedTenants,
+			Redactor:     redactor,
+		},
 	})
 
-	fmt.Printf("Starting ForgeAI API server on %s:%d\n", server.Config().Host, server.Config().Port)
+	fmt.Printf("Starting ForgeAI API server on %s\n", server.Address())
 	
 	// Start the server in a goroutine
 	errChan := make(chan error, 1)
@@ -40,6 +479,23 @@ func main() {
 		errChan <- server.Start(ctx)
 	}()
 
+	// Reload the settings on SIGHUP and, if enabled, when the file changes
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+	if file.Reload.Watch {
+		go watchFile(ctx, config.DefaultFilePath(), file.Reload.Interval, reloadChan)
+	}
+	go func() {
+		for {
+			select {
+			case <-reloadChan:
+				reload(server)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	// Wait for either the server to exit or context to be cancelled
 	select {
 	case err := <-errChan:
@@ -59,4 +515,287 @@ func main() {
 		}
 		fmt.Println("Server shutdown complete")
 	}
-}
\ No newline at end of file
+}
+
+// loadSettings converts the reloadable parts of the configuration file,
+// applying their environment overrides
+func loadSettings(file *config.File) (api.Settings, error) {
+	settings := api.Settings{
+		InlineOutput: file.Logs.InlineLimit,
+		LogRetention: file.Logs.Retention,
+		Images:       file.Images.Languages,
+		ArchImages:   file.Images.Arch,
+		Platform:     file.Images.Platform,
+	}
+
+	// Parse the synchronous execution budget
+	if budget := os.Getenv("FORGEAI_SYNC_BUDGET"); budget != "" {
+		parsed, err := time.ParseDuration(budget)
+		if err != nil {
+			return settings, fmt.Errorf("invalid FORGEAI_SYNC_BUDGET: %w", err)
+		}
+		settings.SyncBudget = parsed
+	}
+
+	// Default resource limits of jobs
+	settings.Rlimits = sandbox.Rlimits{
+		OpenFiles: file.Rlimits.OpenFiles,
+		FileSize:  file.Rlimits.FileSize,
+		StackSize: file.Rlimits.StackSize,
+		CoreDumps: file.Rlimits.CoreDumps,
+	}
+	if err := settings.Rlimits.Validate(); err != nil {
+		return settings, fmt.Errorf("failed to configure resource limits: %w", err)
+	}
+	settings.Output = sandbox.OutputLimits{Head: file.Output.Head, Tail: file.Output.Tail}
+	if err := settings.Output.Validate(); err != nil {
+		return settings, fmt.Errorf("failed to configure output: %w", err)
+	}
+	settings.Locale = sandbox.Locale{Timezone: file.Locale.Timezone, Name: file.Locale.Locale}
+	if err := settings.Locale.Validate(); err != nil {
+		return settings, fmt.Errorf("failed to configure locale: %w", err)
+	}
+
+	// Images of language environments
+	if settings.Platform != "" {
+		if err := container.ValidatePlatform(settings.Platform); err != nil {
+			return settings, fmt.Errorf("failed to configure images: %w", err)
+		}
+	}
+
+	// Seccomp and AppArmor profiles of containers
+	profiles := container.SecurityProfiles{
+		Profiles: container.Profiles{
+			Seccomp:  file.Security.SeccompProfile,
+			AppArmor: file.Security.AppArmorProfile,
+		},
+		Languages: make(map[string]container.Profiles),
+	}
+	for language, p := range file.Security.Languages {
+		profiles.Languages[language] = container.Profiles{Seccomp: p.SeccompProfile, AppArmor: p.AppArmorProfile}
+	}
+	if seccomp := os.Getenv("FORGEAI_SECCOMP_PROFILE"); seccomp != "" {
+		profiles.Seccomp = seccomp
+	}
+	if apparmor := os.Getenv("FORGEAI_APPARMOR_PROFILE"); apparmor != "" {
+		profiles.AppArmor = apparmor
+	}
+	if err := profiles.Validate(); err != nil {
+		return settings, fmt.Errorf("failed to configure security profiles: %w", err)
+	}
+	settings.Security = profiles
+
+	capAdd, err := container.NormalizeCapabilities(file.Security.CapAdd)
+	if err != nil {
+		return settings, fmt.Errorf("failed to configure security.cap_add: %w", err)
+	}
+	settings.CapAdd = capAdd
+
+	// Aliases of languages, which grants may use
+	if err := languages.SetAliases(file.Languages.Aliases); err != nil {
+		return settings, fmt.Errorf("failed to configure languages.aliases: %w", err)
+	}
+
+	// Grants of groups
+	settings.Authz = authz.Policy{Groups: map[string]authz.Grant{}}
+	for name, grant := range file.Authz.Groups {
+		settings.Authz.Groups[name] = authzGrant(grant)
+	}
+	if file.Authz.Default != nil {
+		grant := authzGrant(*file.Authz.Default)
+		settings.Authz.Default = &grant
+	}
+
+	return settings, nil
+}
+
+// authzGrant converts the configuration of a grant
+func authzGrant(cfg config.AuthzGrantConfig) authz.Grant {
+	granted := make([]string, len(cfg.Languages))
+	for i, language := range cfg.Languages {
+		granted[i] = languages.Normalize(language)
+	}
+	return authz.Grant{
+		Languages:      granted,
+		NetworkAccess:  cfg.NetworkAccess,
+		MaxTimeout:     cfg.MaxTimeout,
+		MaxMemoryLimit: cfg.MaxMemoryLimit,
+	}
+}
+
+// openDirectory opens the directory of users and groups, imports its
+// export, if any, and reads the SCIM token
+func openDirectory(cfg config.AuthzConfig) (*authz.Directory, string, error) {
+	directory := authz.NewDirectory(cfg.Directory)
+	if err := directory.Open(); err != nil {
+		return nil, "", err
+	}
+	if cfg.Import != "" {
+		if err := directory.ImportFile(cfg.Import); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var token string
+	if cfg.SCIMTokenFile != "" {
+		var err error
+		token, err = readToken(cfg.SCIMTokenFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read SCIM token: %w", err)
+		}
+	}
+	return directory, token, nil
+}
+
+// readToken reads a bearer token from a file
+func readToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// reload loads the configuration file again and applies its settings to
+// new jobs. Invalid files are reported and leave the settings unchanged.
+func reload(server *api.Server) {
+	file, err := config.LoadDefaultFile()
+	if err != nil {
+		fmt.Printf("Error reloading config file: %v\n", err)
+		return
+	}
+	settings, err := loadSettings(file)
+	if err != nil {
+		fmt.Printf("Error reloading config file: %v\n", err)
+		return
+	}
+	generation, err := server.Reload(settings)
+	if err != nil {
+		fmt.Printf("Error reloading config file: %v\n", err)
+		return
+	}
+	if directory := server.Directory(); directory != nil && file.Authz.Import != "" {
+		if err := directory.ImportFile(file.Authz.Import); err != nil {
+			fmt.Printf("Error importing the directory: %v\n", err)
+		}
+	}
+	fmt.Printf("Reloaded configuration, generation %d\n", generation)
+}
+
+// watchFile signals changes to the modification time of path until ctx is
+// done
+func watchFile(ctx context.Context, path string, interval time.Duration, changed chan<- os.Signal) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	modTime := func() time.Time {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+
+	last := modTime()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if current := modTime(); !current.Equal(last) {
+				last = current
+				select {
+				case changed <- syscall.SIGHUP:
+				default:
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+// newAutoscaler returns the scaling policy of cfg and, when cfg names a
+// webhook, Kubernetes deployment, or EC2 auto scaling group, a controller
+// that applies it
+func newAutoscaler(cfg config.AutoscaleConfig) (autoscale.Policy, *autoscale.Controller, error) {
+	policy := autoscale.Policy{
+		TargetWait:        cfg.TargetWait,
+		TargetUtilization: cfg.TargetUtilization,
+		MinReplicas:       cfg.MinReplicas,
+		MaxReplicas:       cfg.MaxReplicas,
+		WorkersPerReplica: cfg.WorkersPerReplica,
+	}
+	if err := policy.Validate(); err != nil {
+		return policy, nil, err
+	}
+
+	var scalers []autoscale.Scaler
+	if cfg.Webhook != "" {
+		scalers = append(scalers, &autoscale.Webhook{URL: cfg.Webhook})
+	}
+	if cfg.Kubernetes.Deployment != "" {
+		scalers = append(scalers, autoscale.Kubernetes(cfg.Kubernetes.Deployment, cfg.Kubernetes.Namespace))
+	}
+	if cfg.EC2.AutoScalingGroup != "" {
+		scalers = append(scalers, autoscale.EC2(cfg.EC2.AutoScalingGroup, cfg.EC2.Region))
+	}
+	switch len(scalers) {
+	case 0:
+		return policy, nil, nil
+	case 1:
+	default:
+		return policy, nil, fmt.Errorf("configure at most one of webhook, kubernetes, and ec2")
+	}
+	if err := offline.Check("autoscaling"); err != nil {
+		return policy, nil, err
+	}
+
+	return policy, &autoscale.Controller{
+		Policy:         policy,
+		Scaler:         scalers[0],
+		Interval:       cfg.Interval,
+		ScaleDownDelay: cfg.ScaleDownDelay,
+	}, nil
+}
+
+// newWatchdog creates a watchdog, overriding its defaults with the set
+// configuration values
+func newWatchdog(cfg config.WatchdogConfig) (*watchdog.Watchdog, error) {
+	diskPath := cfg.DiskPath
+	if diskPath == "" {
+		diskPath = os.TempDir()
+	}
+	
+	dog := watchdog.New(diskPath)
+	if cfg.Interval > 0 {
+		dog.Interval = cfg.Interval
+	}
+	
+	switch cfg.Policy {
+	case "":
+	case watchdog.PolicyNewest, watchdog.PolicyOldest, watchdog.PolicyNone:
+		dog.Policy = cfg.Policy
+	default:
+		return nil, fmt.Errorf("unknown kill policy %q", cfg.Policy)
+	}
+	
+	override := func(t *watchdog.Thresholds, limits config.ResourceLimits) {
+		if limits.CPUPercent > 0 {
+			t.CPUPercent = limits.CPUPercent
+		}
+		if limits.MemoryPercent > 0 {
+			t.MemoryPercent = limits.MemoryPercent
+		}
+		if limits.DiskPercent > 0 {
+			t.DiskPercent = limits.DiskPercent
+		}
+	}
+	override(&dog.Pause, cfg.Pause)
+	override(&dog.Kill, cfg.Kill)
+	
+	return dog, nil
+}
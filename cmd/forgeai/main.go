@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+
+	"forgeai/pkg/cli"
+)
+
+func main() {
+	// Cobra has already printed the error
+	if err := cli.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
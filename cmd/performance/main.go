@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 
 	"forgeai/pkg/performance"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "chaos":
+			os.Exit(runChaos(os.Args[2:]))
+		case "soak":
+			os.Exit(runSoak(os.Args[2:]))
+		}
+	}
+	
 	fmt.Println("ForgeAI Performance Testing Framework")
 	fmt.Println("====================================")
 	
@@ -24,4 +36,77 @@ func main() {
 	
 	// Exit successfully
 	os.Exit(0)
-}
\ No newline at end of file
+}
+
+// runChaos runs the execution pipeline under injected faults and returns the
+// exit code
+func runChaos(args []string) int {
+	config := performance.DefaultChaosConfig()
+
+	flags := flag.NewFlagSet("chaos", flag.ExitOnError)
+	flags.IntVar(&config.Jobs, "jobs", config.Jobs, "number of jobs to run")
+	flags.IntVar(&config.Workers, "workers", config.Workers, "number of jobs to run at once")
+	flags.IntVar(&config.Retries, "retries", config.Retries, "resubmissions of jobs that failed from a fault")
+	flags.Int64Var(&config.Seed, "seed", config.Seed, "random seed, to replay a run")
+	flags.DurationVar(&config.PullDelay, "pull-delay", config.PullDelay, "duration of a slow image pull")
+	flags.DurationVar(&config.KillAfter, "kill-after", config.KillAfter, "how long killed programs run")
+	flags.DurationVar(&config.JobTimeout, "job-timeout", config.JobTimeout, "time after which a job counts as stuck")
+	probabilities := make(map[string]*float64)
+	for fault, p := range config.Faults {
+		probabilities[fault] = flags.Float64(fault, p, "probability of the "+fault+" fault per execution")
+	}
+	flags.Parse(args)
+	for fault, p := range probabilities {
+		config.Faults[fault] = *p
+	}
+
+	fmt.Println("ForgeAI Chaos Testing")
+	fmt.Println("=====================")
+
+	report, err := performance.RunChaos(context.Background(), config)
+	if err != nil {
+		fmt.Printf("Chaos test failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(performance.GenerateChaosReport(report))
+	if !report.Passed() {
+		return 1
+	}
+	return 0
+}
+
+// runSoak runs executions against a server for a long time, failing when its
+// resource use keeps growing, and returns the exit code
+func runSoak(args []string) int {
+	config := performance.DefaultSoakConfig()
+
+	flags := flag.NewFlagSet("soak", flag.ExitOnError)
+	flags.StringVar(&config.Server, "server", config.Server, "base URL of the API server under test")
+	flags.DurationVar(&config.Duration, "duration", config.Duration, "how long to run")
+	flags.DurationVar(&config.Interval, "interval", config.Interval, "how often to sample resource use")
+	flags.IntVar(&config.Concurrency, "concurrency", config.Concurrency, "number of executions to run at once")
+	flags.StringVar(&config.Language, "language", config.Language, "language of the executed code")
+	flags.StringVar(&config.Code, "code", config.Code, "code to execute")
+	flags.IntVar(&config.LeakBuckets, "leak-windows", config.LeakBuckets, "windows a resource must rise through to count as a leak")
+	flags.Parse(args)
+
+	fmt.Println("ForgeAI Soak Testing")
+	fmt.Println("====================")
+	fmt.Printf("Running executions against %s for %v...\n", config.Server, config.Duration)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	report, err := performance.RunSoak(ctx, config)
+	if err != nil {
+		fmt.Printf("Soak test failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(performance.GenerateSoakReport(report))
+	if len(report.Leaks()) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 
+	"forgeai/pkg/audit"
+	"forgeai/pkg/config"
+	"forgeai/pkg/httpclient"
+	"forgeai/pkg/offline"
+	"forgeai/pkg/output"
 	"forgeai/pkg/registry"
+	"forgeai/pkg/storage"
 )
 
 func main() {
@@ -13,6 +21,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Offline mode refuses registry calls, which otherwise go through the
+	// configured proxy and certificates
+	file, err := config.LoadDefaultFile()
+	if err != nil {
+		file = &config.File{}
+	}
+	if file.Offline || offline.FromEnv() {
+		offline.Enable(true)
+	}
+	if err := httpclient.Configure(file.HTTP); err != nil {
+		fmt.Printf("Error in http configuration: %v\n", err)
+		os.Exit(1)
+	}
+
 	command := os.Args[1]
 
 	switch command {
@@ -36,6 +58,12 @@ func main() {
 			os.Exit(1)
 		}
 		updatePlugin(os.Args[2])
+	case "rollback":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: forgeai-plugin rollback <plugin-name>")
+			os.Exit(1)
+		}
+		rollbackPlugin(os.Args[2])
 	case "help":
 		printHelp()
 	default:
@@ -53,6 +81,7 @@ func printHelp() {
 	fmt.Println("  forgeai-plugin install <name>    Install a plugin")
 	fmt.Println("  forgeai-plugin remove <name>     Remove a plugin")
 	fmt.Println("  forgeai-plugin update <name>     Update a plugin")
+	fmt.Println("  forgeai-plugin rollback <name>   Restore the previous version of a plugin")
 	fmt.Println("  forgeai-plugin help              Show this help")
 }
 
@@ -79,9 +108,17 @@ func installPlugin(name string) {
 	pluginDir := "./plugins"
 	
 	manager := registry.NewPluginManager(pluginDir, "http://localhost:8080")
+	configureRegistry(manager.Registry)
+	manager.Registry.Cache = pluginCache()
+	manager.Audit, manager.Actor = pluginAudit()
 	
 	fmt.Printf("Installing plugin: %s\n", name)
-	if err := manager.InstallPlugin(name, "latest"); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	finish := showProgress(manager.Registry, name)
+	err := manager.InstallPlugin(ctx, name, "latest")
+	finish()
+	if err != nil {
 		fmt.Printf("Error installing plugin: %v\n", err)
 		os.Exit(1)
 	}
@@ -93,6 +130,7 @@ func removePlugin(name string) {
 	pluginDir := "./plugins"
 	
 	manager := registry.NewPluginManager(pluginDir, "http://localhost:8080")
+	manager.Audit, manager.Actor = pluginAudit()
 	
 	fmt.Printf("Removing plugin: %s\n", name)
 	if err := manager.RemovePlugin(name); err != nil {
@@ -107,12 +145,101 @@ func updatePlugin(name string) {
 	pluginDir := "./plugins"
 	
 	manager := registry.NewPluginManager(pluginDir, "http://localhost:8080")
+	configureRegistry(manager.Registry)
+	manager.Registry.Cache = pluginCache()
+	manager.Audit, manager.Actor = pluginAudit()
 	
 	fmt.Printf("Updating plugin: %s\n", name)
-	if err := manager.UpdatePlugin(name); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	finish := showProgress(manager.Registry, name)
+	err := manager.UpdatePlugin(ctx, name)
+	finish()
+	if err != nil {
 		fmt.Printf("Error updating plugin: %v\n", err)
 		os.Exit(1)
 	}
 	
 	fmt.Println("Plugin updated successfully!")
-}
\ No newline at end of file
+}
+
+func rollbackPlugin(name string) {
+	pluginDir := "./plugins"
+	
+	manager := registry.NewPluginManager(pluginDir, "http://localhost:8080")
+	manager.Audit, manager.Actor = pluginAudit()
+	
+	fmt.Printf("Rolling back plugin: %s\n", name)
+	if err := manager.RollbackPlugin(name); err != nil {
+		fmt.Printf("Error rolling back plugin: %v\n", err)
+		os.Exit(1)
+	}
+	
+	fmt.Println("Plugin rolled back successfully!")
+}
+
+// showProgress renders the progress of the plugin downloads of rc and
+// returns a function that completes it
+func showProgress(rc *registry.RegistryClient, label string) func() {
+	bar := output.NewProgressBar(os.Stdout, label)
+	bar.Bytes = true
+	
+	started := false
+	var done, total int64
+	rc.Progress = func(d, t int64) {
+		started, done, total = true, d, t
+		bar.Update(d, t)
+	}
+	return func() {
+		if started {
+			bar.Done(done, total)
+		}
+	}
+}
+
+// configureRegistry applies the registry timeouts and retries of the config
+// file to rc and caches registry metadata in the user's cache directory
+func configureRegistry(rc *registry.RegistryClient) {
+	if file, err := config.LoadDefaultFile(); err == nil {
+		rc.Configure(file.Registry)
+	}
+	rc.MetadataCache = registry.DefaultMetadataCache()
+}
+
+// pluginCache returns the storage backend configured in the config file for
+// caching plugin binaries, or nil when none is configured
+func pluginCache() storage.Backend {
+	file, err := config.LoadDefaultFile()
+	if err != nil || file.Storage.Backend == "" {
+		return nil
+	}
+	
+	backend, err := storage.New(file.Storage)
+	if err != nil {
+		fmt.Printf("Warning: plugin cache disabled: %v\n", err)
+		return nil
+	}
+	return backend
+}
+
+// pluginAudit returns the audit trail configured in the config file for
+// recording plugin changes, or nil when none is configured, and the local
+// user as the actor
+func pluginAudit() (*audit.Trail, string) {
+	actor := os.Getenv("USER")
+	file, err := config.LoadDefaultFile()
+	if err != nil {
+		return nil, actor
+	}
+	cfg := file.Audit
+	if cfg.File == "" && cfg.Syslog.Address == "" && cfg.Webhook.URL == "" {
+		return nil, actor
+	}
+	
+	trail, err := audit.FromConfig(cfg)
+	if err != nil {
+		fmt.Printf("Warning: audit trail disabled: %v\n", err)
+		return nil, actor
+	}
+	return trail, actor
+}
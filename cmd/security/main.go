@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 
+	"forgeai/pkg/config"
+	"forgeai/pkg/notify"
 	"forgeai/pkg/security"
 )
 
@@ -25,16 +28,20 @@ func main() {
 	// Count passed and failed tests
 	passed := 0
 	failed := 0
+	var failedNames []string
 	for _, r := range reports {
 		if r.Passed {
 			passed++
 		} else {
 			failed++
+			failedNames = append(failedNames, r.TestCase.Name)
 		}
 	}
 	
 	// Exit with appropriate code
 	if failed > 0 {
+		notifyFailures(failedNames, len(reports))
+		
 		fmt.Printf("Security testing completed with %d failures.\n", failed)
 		os.Exit(1)
 	} else {
@@ -42,3 +49,23 @@ func main() {
 		os.Exit(0)
 	}
 }
+
+
+// notifyFailures alerts the configured notification channels about failed
+// security tests
+func notifyFailures(failed []string, total int) {
+	file, err := config.LoadDefaultFile()
+	if err != nil || len(file.Notifications.Channels) == 0 {
+		return
+	}
+	
+	notifier, err := notify.New(file.Notifications)
+	if err != nil {
+		fmt.Printf("Warning: notifications disabled: %v\n", err)
+		return
+	}
+	
+	if err := notifier.Notify(context.Background(), notify.SecurityTestsEvent(failed, total)); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
@@ -0,0 +1,259 @@
+// Package analytics aggregates job history into success rates, duration
+// trends, failure reasons, and tenant activity
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"forgeai/pkg/hardware"
+	"forgeai/pkg/joblog"
+)
+
+// DefaultTenantLabel is the job label that names the tenant of a job
+const DefaultTenantLabel = "tenant"
+
+// Record is one finished job of the history
+type Record struct {
+	Language  string
+	Status    string
+	Error     string
+	Labels    map[string]string
+	CreatedAt time.Time
+	Duration  time.Duration
+
+	// Hardware is the hardware class of the worker that ran the job, if
+	// known
+	Hardware *hardware.Class
+}
+
+// FromJobLog converts the records of a job log
+func FromJobLog(records []joblog.Record) []Record {
+	converted := make([]Record, 0, len(records))
+	for _, r := range records {
+		converted = append(converted, Record{
+			Language:  r.Language,
+			Status:    r.Status,
+			Error:     r.Error,
+			Labels:    r.Labels,
+			CreatedAt: r.CreatedAt,
+			Duration:  time.Duration(r.DurationMS) * time.Millisecond,
+			Hardware:  r.Hardware,
+		})
+	}
+	return converted
+}
+
+// Options select and group the records of a report
+type Options struct {
+	// Since and Until bound the creation time of jobs; zero values are
+	// unbounded
+	Since time.Time
+	Until time.Time
+
+	// Bucket is the width of trend buckets; a day when zero
+	Bucket time.Duration
+
+	// TenantLabel is the label that names tenants; DefaultTenantLabel when
+	// empty
+	TenantLabel string
+
+	// Top limits the failure reasons and tenants listed; 10 when zero
+	Top int
+
+	// Normalize converts durations to the reference hardware by the
+	// calibration score of the worker that ran each job, so that workers
+	// on different hardware can be compared
+	Normalize bool
+}
+
+// Report summarizes job history
+type Report struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	Jobs  int       `json:"jobs"`
+
+	// SuccessRate is the share of jobs that completed, from 0 to 1
+	SuccessRate float64 `json:"success_rate"`
+
+	Languages      []LanguageStats `json:"languages"`
+	Trend          []TrendBucket   `json:"trend"`
+	FailureReasons []Count         `json:"failure_reasons"`
+	TenantLabel    string          `json:"tenant_label"`
+	Tenants        []Count         `json:"tenants"`
+}
+
+// LanguageStats are the outcomes of the jobs of a language
+type LanguageStats struct {
+	Language    string        `json:"language"`
+	Jobs        int           `json:"jobs"`
+	Completed   int           `json:"completed"`
+	Failed      int           `json:"failed"`
+	SuccessRate float64       `json:"success_rate"`
+	P95         time.Duration `json:"p95_duration_ns"`
+}
+
+// TrendBucket holds the jobs created in [Start, Start+Bucket)
+type TrendBucket struct {
+	Start       time.Time     `json:"start"`
+	Jobs        int           `json:"jobs"`
+	SuccessRate float64       `json:"success_rate"`
+	P95         time.Duration `json:"p95_duration_ns"`
+}
+
+// Count is how often a value occurred
+type Count struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Summarize builds a report from the finished jobs among records
+func Summarize(records []Record, opts Options) Report {
+	if opts.Bucket <= 0 {
+		opts.Bucket = 24 * time.Hour
+	}
+	if opts.TenantLabel == "" {
+		opts.TenantLabel = DefaultTenantLabel
+	}
+	if opts.Top <= 0 {
+		opts.Top = 10
+	}
+
+	report := Report{Since: opts.Since, Until: opts.Until, TenantLabel: opts.TenantLabel}
+	languages := make(map[string]*accumulator)
+	buckets := make(map[time.Time]*accumulator)
+	failures := make(map[string]int)
+	tenants := make(map[string]int)
+	completed := 0
+
+	for _, r := range records {
+		if !finished(r.Status) {
+			continue
+		}
+		if !opts.Since.IsZero() && r.CreatedAt.Before(opts.Since) {
+			continue
+		}
+		if !opts.Until.IsZero() && !r.CreatedAt.Before(opts.Until) {
+			continue
+		}
+
+		if opts.Normalize && r.Hardware != nil {
+			r.Duration = r.Hardware.Normalize(r.Duration)
+		}
+
+		report.Jobs++
+		if r.Status == "completed" {
+			completed++
+		} else if r.Error != "" {
+			failures[r.Error]++
+		}
+		if tenant := r.Labels[opts.TenantLabel]; tenant != "" {
+			tenants[tenant]++
+		}
+
+		lang := languages[r.Language]
+		if lang == nil {
+			lang = &accumulator{}
+			languages[r.Language] = lang
+		}
+		lang.add(r)
+
+		start := r.CreatedAt.UTC().Truncate(opts.Bucket)
+		bucket := buckets[start]
+		if bucket == nil {
+			bucket = &accumulator{}
+			buckets[start] = bucket
+		}
+		bucket.add(r)
+	}
+	report.SuccessRate = rate(completed, report.Jobs)
+
+	report.Languages = []LanguageStats{}
+	for name, acc := range languages {
+		report.Languages = append(report.Languages, LanguageStats{
+			Language:    name,
+			Jobs:        acc.jobs,
+			Completed:   acc.completed,
+			Failed:      acc.jobs - acc.completed,
+			SuccessRate: rate(acc.completed, acc.jobs),
+			P95:         acc.p95(),
+		})
+	}
+	sort.Slice(report.Languages, func(i, j int) bool {
+		a, b := report.Languages[i], report.Languages[j]
+		return a.Jobs > b.Jobs || a.Jobs == b.Jobs && a.Language < b.Language
+	})
+
+	report.Trend = []TrendBucket{}
+	for start, acc := range buckets {
+		report.Trend = append(report.Trend, TrendBucket{
+			Start:       start,
+			Jobs:        acc.jobs,
+			SuccessRate: rate(acc.completed, acc.jobs),
+			P95:         acc.p95(),
+		})
+	}
+	sort.Slice(report.Trend, func(i, j int) bool { return report.Trend[i].Start.Before(report.Trend[j].Start) })
+
+	report.FailureReasons = top(failures, opts.Top)
+	report.Tenants = top(tenants, opts.Top)
+	return report
+}
+
+// accumulator counts the jobs of a language or trend bucket
+type accumulator struct {
+	jobs      int
+	completed int
+	durations []time.Duration
+}
+
+func (a *accumulator) add(r Record) {
+	a.jobs++
+	if r.Status == "completed" {
+		a.completed++
+	}
+	if r.Duration > 0 {
+		a.durations = append(a.durations, r.Duration)
+	}
+}
+
+// p95 returns the 95th percentile of the durations, or zero without any
+func (a *accumulator) p95() time.Duration {
+	if len(a.durations) == 0 {
+		return 0
+	}
+	sort.Slice(a.durations, func(i, j int) bool { return a.durations[i] < a.durations[j] })
+	return a.durations[(len(a.durations)-1)*95/100]
+}
+
+// finished reports whether a status is terminal
+func finished(status string) bool {
+	switch status {
+	case "completed", "failed", "setup_failed", "cancelled", "interrupted":
+		return true
+	}
+	return false
+}
+
+// rate returns n/total, or zero for no jobs
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// top returns the n most frequent values, most frequent first
+func top(counts map[string]int, n int) []Count {
+	list := make([]Count, 0, len(counts))
+	for value, count := range counts {
+		list = append(list, Count{Value: value, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Count > list[j].Count || list[i].Count == list[j].Count && list[i].Value < list[j].Value
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
@@ -0,0 +1,149 @@
+package analytics
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// Markdown renders the report as a Markdown document
+func (r Report) Markdown(title string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "%s\n\n", r.period())
+	fmt.Fprintf(&b, "**%d jobs**, %s succeeded.\n\n", r.Jobs, percent(r.SuccessRate))
+
+	b.WriteString("## Languages\n\n")
+	if len(r.Languages) == 0 {
+		b.WriteString("No jobs.\n\n")
+	} else {
+		b.WriteString("| Language | Jobs | Completed | Failed | Success rate | P95 duration |\n")
+		b.WriteString("|---|---:|---:|---:|---:|---:|\n")
+		for _, l := range r.Languages {
+			fmt.Fprintf(&b, "| %s | %d | %d | %d | %s | %s |\n",
+				escapeCell(l.Language), l.Jobs, l.Completed, l.Failed, percent(l.SuccessRate), round(l.P95))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## Trend\n\n")
+	if len(r.Trend) == 0 {
+		b.WriteString("No jobs.\n\n")
+	} else {
+		b.WriteString("| Period | Jobs | Success rate | P95 duration |\n")
+		b.WriteString("|---|---:|---:|---:|\n")
+		for _, t := range r.Trend {
+			fmt.Fprintf(&b, "| %s | %d | %s | %s |\n",
+				t.Start.Format("2006-01-02 15:04"), t.Jobs, percent(t.SuccessRate), round(t.P95))
+		}
+		b.WriteString("\n")
+	}
+
+	writeCounts(&b, "Top Failure Reasons", "Reason", r.FailureReasons)
+	writeCounts(&b, "Busiest Tenants", fmt.Sprintf("Tenant (`%s` label)", r.TenantLabel), r.Tenants)
+	return b.String()
+}
+
+// writeCounts writes a section listing counts
+func writeCounts(b *strings.Builder, heading, column string, counts []Count) {
+	fmt.Fprintf(b, "## %s\n\n", heading)
+	if len(counts) == 0 {
+		b.WriteString("None.\n\n")
+		return
+	}
+	fmt.Fprintf(b, "| %s | Jobs |\n|---|---:|\n", column)
+	for _, c := range counts {
+		fmt.Fprintf(b, "| %s | %d |\n", escapeCell(c.Value), c.Count)
+	}
+	b.WriteString("\n")
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": percent,
+	"round":   round,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+td.n { text-align: right; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Period}}</p>
+<p><strong>{{.Report.Jobs}} jobs</strong>, {{percent .Report.SuccessRate}} succeeded.</p>
+<h2>Languages</h2>
+{{if .Report.Languages}}<table>
+<tr><th>Language</th><th>Jobs</th><th>Completed</th><th>Failed</th><th>Success rate</th><th>P95 duration</th></tr>
+{{range .Report.Languages}}<tr><td>{{.Language}}</td><td class="n">{{.Jobs}}</td><td class="n">{{.Completed}}</td><td class="n">{{.Failed}}</td><td class="n">{{percent .SuccessRate}}</td><td class="n">{{round .P95}}</td></tr>
+{{end}}</table>{{else}}<p>No jobs.</p>{{end}}
+<h2>Trend</h2>
+{{if .Report.Trend}}<table>
+<tr><th>Period</th><th>Jobs</th><th>Success rate</th><th>P95 duration</th></tr>
+{{range .Report.Trend}}<tr><td>{{.Start.Format "2006-01-02 15:04"}}</td><td class="n">{{.Jobs}}</td><td class="n">{{percent .SuccessRate}}</td><td class="n">{{round .P95}}</td></tr>
+{{end}}</table>{{else}}<p>No jobs.</p>{{end}}
+<h2>Top Failure Reasons</h2>
+{{if .Report.FailureReasons}}<table>
+<tr><th>Reason</th><th>Jobs</th></tr>
+{{range .Report.FailureReasons}}<tr><td>{{.Value}}</td><td class="n">{{.Count}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+<h2>Busiest Tenants</h2>
+{{if .Report.Tenants}}<table>
+<tr><th>Tenant (<code>{{.Report.TenantLabel}}</code> label)</th><th>Jobs</th></tr>
+{{range .Report.Tenants}}<tr><td>{{.Value}}</td><td class="n">{{.Count}}</td></tr>
+{{end}}</table>{{else}}<p>None.</p>{{end}}
+</body>
+</html>
+`))
+
+// HTML renders the report as a standalone HTML page
+func (r Report) HTML(title string) (string, error) {
+	var buf bytes.Buffer
+	err := htmlReport.Execute(&buf, struct {
+		Title  string
+		Period string
+		Report Report
+	}{title, r.period(), r})
+	return buf.String(), err
+}
+
+// period describes the time range of the report
+func (r Report) period() string {
+	const layout = "2006-01-02 15:04 MST"
+	switch {
+	case r.Since.IsZero() && r.Until.IsZero():
+		return "All recorded jobs."
+	case r.Until.IsZero():
+		return fmt.Sprintf("Jobs created since %s.", r.Since.UTC().Format(layout))
+	case r.Since.IsZero():
+		return fmt.Sprintf("Jobs created before %s.", r.Until.UTC().Format(layout))
+	default:
+		return fmt.Sprintf("Jobs created from %s to %s.", r.Since.UTC().Format(layout), r.Until.UTC().Format(layout))
+	}
+}
+
+// percent formats a rate from 0 to 1 as a percentage
+func percent(rate float64) string {
+	return fmt.Sprintf("%.1f%%", rate*100)
+}
+
+// round shortens a duration for display
+func round(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// escapeCell keeps a value inside its Markdown table cell
+func escapeCell(value string) string {
+	value = strings.ReplaceAll(value, "|", `\|`)
+	return strings.ReplaceAll(value, "\n", " ")
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/storage"
+)
+
+// handleGetMaintenance reports the maintenance mode and the jobs left to
+// drain
+func (s *Server) handleGetMaintenance(c Context) {
+	s.audit(c, "maintenance.get", "", nil, nil, nil)
+	c.JSON(http.StatusOK, s.jobManager.Maintenance())
+}
+
+// handleEnterMaintenance stops accepting new jobs while running jobs drain
+func (s *Server) handleEnterMaintenance(c Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request().ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondInvalid(c, err)
+			return
+		}
+	}
+
+	before := s.jobManager.Maintenance()
+	after := s.jobManager.EnterMaintenance(req.Reason)
+	s.audit(c, "maintenance.enter", "", before, after, nil)
+	c.JSON(http.StatusOK, after)
+}
+
+// handleExitMaintenance accepts new jobs again
+func (s *Server) handleExitMaintenance(c Context) {
+	before := s.jobManager.Maintenance()
+	after := s.jobManager.ExitMaintenance()
+	s.audit(c, "maintenance.exit", "", before, after, nil)
+	c.JSON(http.StatusOK, after)
+}
+
+// handleRotateEncryption wraps the data keys of stored objects with the
+// active encryption key
+func (s *Server) handleRotateEncryption(c Context) {
+	encryption := storage.Encryption(s.config.Storage)
+	if encryption == nil {
+		c.JSON(http.StatusNotImplemented, H{"error": "encryption at rest is not enabled on this server"})
+		return
+	}
+	stats, err := encryption.Rotate(c.Request().Context(), "")
+	s.audit(c, "encryption.rotate", stats.ActiveKey, nil, stats, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, H{"error": err.Error(), "rotation": stats})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// handleBackfill imports the JSON lines log of a legacy runner, given as
+// the request body, as finished jobs labeled with the source query
+// parameter, legacy by default
+func (s *Server) handleBackfill(c Context) {
+	source := c.Query("source")
+	if source == "" {
+		source = "legacy"
+	}
+	if len(source) > jobs.MaxLabelValueLength {
+		respondInvalid(c, fieldError("source", "max",
+			fmt.Sprintf("source must be at most %d characters", jobs.MaxLabelValueLength), source, jobs.MaxLabelValueLength))
+		return
+	}
+
+	// Imported code is shared with /v1/execute requests of only the same
+	// language and code
+	report, err := s.jobManager.Backfill(c.Request().Body, jobs.BackfillOptions{
+		Source: source,
+		Fingerprint: func(language, code string) string {
+			return jobs.Fingerprint(executeCodeRequest{Language: language, Code: code})
+		},
+	})
+	s.audit(c, "jobs.backfill", source, nil, report, err)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error(), "backfill": report})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"forgeai/pkg/analytics"
+	"forgeai/pkg/jobs"
+)
+
+// handleGetAnalytics aggregates the history of jobs
+func (s *Server) handleGetAnalytics(c Context) {
+	opts, err := analyticsOptions(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, analytics.Summarize(s.jobHistory(), opts))
+}
+
+// handleGetAnalyticsReport renders the aggregated history of jobs as a
+// Markdown or HTML report
+func (s *Server) handleGetAnalyticsReport(c Context) {
+	opts, err := analyticsOptions(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	report := analytics.Summarize(s.jobHistory(), opts)
+	title := c.DefaultQuery("title", "ForgeAI Job Report")
+	switch format := c.DefaultQuery("format", "markdown"); format {
+	case "markdown":
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(report.Markdown(title)))
+	case "html":
+		page, err := report.HTML(title)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+	default:
+		c.JSON(http.StatusBadRequest, H{"error": fmt.Sprintf("unknown format %q, use markdown or html", format)})
+	}
+}
+
+// jobHistory returns the jobs of the manager as analytics records
+func (s *Server) jobHistory() []analytics.Record {
+	list := s.jobManager.ListJobs(jobs.Filter{})
+	records := make([]analytics.Record, 0, len(list))
+	for _, job := range list {
+		record := analytics.Record{
+			Language:  job.Language,
+			Status:    job.Status,
+			Error:     job.Error,
+			Labels:    job.Labels,
+			CreatedAt: job.CreatedAt,
+			Hardware:  job.Hardware,
+		}
+		if job.Result != nil {
+			record.Duration = job.Result.Duration
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// analyticsOptions parses the since, until, bucket, tenant_label, top, and
+// normalize query parameters. since and until are RFC 3339 times, or durations before
+// now such as 168h.
+func analyticsOptions(c Context, now time.Time) (analytics.Options, error) {
+	var opts analytics.Options
+	var err error
+	if opts.Since, err = parseTimeParam(c.Query("since"), now); err != nil {
+		return opts, fmt.Errorf("invalid since: %w", err)
+	}
+	if opts.Until, err = parseTimeParam(c.Query("until"), now); err != nil {
+		return opts, fmt.Errorf("invalid until: %w", err)
+	}
+	if param := c.Query("bucket"); param != "" {
+		if opts.Bucket, err = time.ParseDuration(param); err != nil || opts.Bucket <= 0 {
+			return opts, fmt.Errorf("bucket must be a duration such as 24h")
+		}
+	}
+	if param := c.Query("top"); param != "" {
+		if opts.Top, err = strconv.Atoi(param); err != nil || opts.Top <= 0 {
+			return opts, fmt.Errorf("top must be a positive number")
+		}
+	}
+	opts.TenantLabel = c.Query("tenant_label")
+	opts.Normalize = c.Query("normalize") == "true"
+	return opts, nil
+}
+
+// parseTimeParam parses an RFC 3339 time or a duration before now; empty
+// values are the zero time
+func parseTimeParam(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
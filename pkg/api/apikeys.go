@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"forgeai/pkg/apikeys"
+)
+
+// apiKeyResponse is an API key with its secret, which is only returned when
+// the key is created or rotated
+type apiKeyResponse struct {
+	apikeys.Key
+	Secret string `json:"key,omitempty"`
+}
+
+// handleListAPIKeys lists the API keys without their secrets
+func (s *Server) handleListAPIKeys(c Context) {
+	keys := s.apiKeys.List()
+
+	c.JSON(http.StatusOK, H{
+		"api_keys": keys,
+		"count":    len(keys),
+	})
+}
+
+// handleGetAPIKey describes an API key without its secret
+func (s *Server) handleGetAPIKey(c Context) {
+	key, ok := s.apiKeys.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": apikeys.ErrNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// handlePutAPIKey creates the API key with the ID of the path, responding
+// 201 Created with its secret, or updates its subject, description, and
+// expiry, keeping its secret
+func (s *Server) handlePutAPIKey(c Context) {
+	var spec apikeys.Spec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	id := c.Param("id")
+	var before interface{}
+	if existing, ok := s.apiKeys.Get(id); ok {
+		before = existing
+	}
+	key, secret, created, err := s.apiKeys.Put(id, spec)
+	s.audit(c, "apikey.put", id, before, key, err)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	if created {
+		c.JSON(http.StatusCreated, apiKeyResponse{Key: key, Secret: secret})
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// handleDeleteAPIKey deletes an API key, which stops it from authenticating
+func (s *Server) handleDeleteAPIKey(c Context) {
+	id := c.Param("id")
+	before, _ := s.apiKeys.Get(id)
+	if !s.apiKeys.Delete(id) {
+		c.JSON(http.StatusNotFound, H{"error": apikeys.ErrNotFound.Error()})
+		return
+	}
+	s.audit(c, "apikey.delete", id, before, nil, nil)
+
+	c.JSON(http.StatusOK, H{
+		"id":      id,
+		"message": "API key deleted",
+	})
+}
+
+// handleRotateAPIKey replaces the secret of an API key and returns the new
+// one; the old one stops authenticating at once
+func (s *Server) handleRotateAPIKey(c Context) {
+	id := c.Param("id")
+	key, secret, err := s.apiKeys.Rotate(id)
+	if errors.Is(err, apikeys.ErrNotFound) {
+		c.JSON(http.StatusNotFound, H{"error": err.Error()})
+		return
+	}
+	s.audit(c, "apikey.rotate", id, nil, key, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, apiKeyResponse{Key: key, Secret: secret})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"forgeai/pkg/audit"
+)
+
+// DefaultActorHeader is the request header that names the actor of audited
+// actions when no Actor hook is set
+const DefaultActorHeader = "X-Forgeai-Actor"
+
+// actor returns who made a request: the Actor hook's answer, the actor
+// header, or the remote address
+func (s *Server) actor(c Context) string {
+	if actor := s.subject(c); actor != "" {
+		return actor
+	}
+	if addr := c.Request().RemoteAddr; addr != "" && addr != "@" {
+		return addr
+	}
+	return "anonymous"
+}
+
+// audit records an admin action made by a request, with the values it
+// changed; err marks the action as failed
+func (s *Server) audit(c Context, action, resource string, before, after interface{}, err error) {
+	if s.config.Audit == nil {
+		return
+	}
+	req := c.Request()
+	entry := audit.Entry{
+		Actor:      s.actor(c),
+		Action:     action,
+		Resource:   resource,
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		RemoteAddr: req.RemoteAddr,
+		Before:     before,
+		After:      after,
+	}
+	if err != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Error = err.Error()
+	}
+	s.config.Audit.Record(req.Context(), entry)
+}
+
+// auditSystem records an action the server made on its own
+func (s *Server) auditSystem(action string, before, after interface{}, err error) {
+	if s.config.Audit == nil {
+		return
+	}
+	entry := audit.Entry{Actor: "system", Action: action, Before: before, After: after}
+	if err != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Error = err.Error()
+	}
+	s.config.Audit.Record(context.Background(), entry)
+}
+
+// handleListAudit lists recent entries of the audit trail
+func (s *Server) handleListAudit(c Context) {
+	if s.config.Audit == nil {
+		c.JSON(http.StatusNotImplemented, H{"error": "the audit trail is not enabled on this server"})
+		return
+	}
+
+	filter := audit.Filter{
+		Action: c.Query("action"),
+		Actor:  c.Query("actor"),
+	}
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, H{"error": "invalid since: use RFC 3339"})
+			return
+		}
+		filter.Since = t
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, H{"error": "invalid limit"})
+		return
+	}
+
+	// Reading the trail is an admin call too
+	s.audit(c, "audit.read", "", nil, nil, nil)
+	entries := s.config.Audit.List(filter, limit)
+	c.JSON(http.StatusOK, H{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"forgeai/pkg/apikeys"
+	"forgeai/pkg/authz"
+	"forgeai/pkg/tokens"
+)
+
+// fileLanguages maps the extensions of executed files to their languages,
+// for authorizing file executions
+var fileLanguages = map[string]string{
+	".py": "python",
+	".js": "javascript",
+	".go": "go",
+	".rs": "rust",
+}
+
+// subject returns the user a request authenticated as: its principal, or
+// else the actor header, which must be set by a trusted proxy that verified
+// the caller's credentials, such as a JWT. Requests with invalid execution
+// tokens or API keys have no subject.
+func (s *Server) subject(c Context) string {
+	if principal := s.principal(c); principal != "" || bearerCredential(c) {
+		return principal
+	}
+	header := s.config.ActorHeader
+	if header == "" {
+		header = DefaultActorHeader
+	}
+	return c.GetHeader(header)
+}
+
+// principal returns the user the credentials of a request authenticate:
+// the subject of its API key or execution token, or the Actor hook's
+// answer. Unlike subject, it never trusts the actor header, which any
+// caller can set.
+func (s *Server) principal(c Context) string {
+	if key := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); apikeys.IsKey(key) {
+		k, err := s.apiKeys.Authenticate(key)
+		if err != nil {
+			return ""
+		}
+		return k.Subject
+	}
+	if token, ok := executionToken(c); ok {
+		t, err := s.tokens.Lookup(token)
+		if err != nil {
+			return ""
+		}
+		return t.Subject
+	}
+	if hook := s.config.Hooks.Actor; hook != nil {
+		return hook(c.Request())
+	}
+	return ""
+}
+
+// errTenantMismatch refuses requests labeled with a tenant other than
+// their caller's
+var errTenantMismatch = errors.New("the tenant label does not match the caller's tenant")
+
+// tenant returns the tenant of the caller of a request: the one the Tenant
+// hook names, or else its principal. Callers set job labels, so a tenant
+// label never chooses the tenant; one naming another tenant is an error.
+func (s *Server) tenant(c Context, label string) (string, error) {
+	tenant := ""
+	if hook := s.config.Hooks.Tenant; hook != nil {
+		tenant = hook(c.Request())
+	}
+	if tenant == "" {
+		tenant = s.principal(c)
+	}
+	if label != "" && label != tenant {
+		return "", errTenantMismatch
+	}
+	return tenant, nil
+}
+
+// authorizeTenant checks that the caller of a request is the tenant or an
+// admin. It responds and returns false otherwise: 401 Unauthorized without
+// credentials and 403 Forbidden for other tenants.
+func (s *Server) authorizeTenant(c Context, tenant string) bool {
+	caller, _ := s.tenant(c, "")
+	if caller != "" && caller == tenant {
+		return true
+	}
+	if _, err := s.authorizeAdmin(c); err == nil {
+		return true
+	}
+	if caller == "" {
+		c.JSON(http.StatusUnauthorized, H{"error": authz.ErrUnauthenticated.Error()})
+		return false
+	}
+	c.JSON(http.StatusForbidden, H{"error": fmt.Sprintf("%s cannot access tenant %s", caller, tenant)})
+	return false
+}
+
+// bearerCredential reports whether a request carries an API key or an
+// execution token
+func bearerCredential(c Context) bool {
+	key := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return apikeys.IsKey(key) || tokens.IsToken(key)
+}
+
+// errAdminDisabled refuses admin requests on servers without admins
+var errAdminDisabled = errors.New("the admin API is not enabled on this server: configure an admin token or admins")
+
+// adminAuthMiddleware refuses admin requests that carry neither the admin
+// token nor the credentials of an admin: 401 Unauthorized without
+// credentials and 403 Forbidden for other principals. Execution tokens
+// never authorize admin requests, whoever they were issued to.
+func (s *Server) adminAuthMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := newContext(w, r, func(string) string { return "" })
+			if status, err := s.authorizeAdmin(c); err != nil {
+				c.JSON(status, H{"error": err.Error()})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorizeAdmin checks that a request comes from an admin and returns the
+// status to refuse it with otherwise
+func (s *Server) authorizeAdmin(c Context) (int, error) {
+	if s.config.AdminToken == "" && len(s.config.Admins) == 0 {
+		return http.StatusForbidden, errAdminDisabled
+	}
+	credential := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if s.config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(s.config.AdminToken)) == 1 {
+		return 0, nil
+	}
+	if _, ok := executionToken(c); ok {
+		return http.StatusForbidden, errors.New("execution tokens cannot make admin requests")
+	}
+	principal := s.principal(c)
+	if principal == "" {
+		return http.StatusUnauthorized, authz.ErrUnauthenticated
+	}
+	for _, admin := range s.config.Admins {
+		if admin == principal {
+			return 0, nil
+		}
+	}
+	return http.StatusForbidden, fmt.Errorf("%s is not an admin", principal)
+}
+
+// authorize checks a job request against the groups of its user when the
+// settings grant groups access. It responds and returns false when the
+// request is not authorized.
+func (s *Server) authorize(c Context, req *ExecuteRequest) bool {
+	policy := s.authzPolicy()
+	if !policy.Enabled() {
+		return true
+	}
+
+	language := req.Language
+	if req.FilePath != "" && language == "" {
+		language = fileLanguages[strings.ToLower(filepath.Ext(req.FilePath))]
+	}
+	err := policy.Authorize(s.config.Directory, s.subject(c), authz.Request{
+		Language:      language,
+		NetworkAccess: req.NetworkAccess,
+		Timeout:       req.Timeout,
+		MemoryLimit:   req.MemoryLimit,
+	})
+	if err == nil {
+		return true
+	}
+	status := http.StatusForbidden
+	if errors.Is(err, authz.ErrUnauthenticated) {
+		status = http.StatusUnauthorized
+	}
+	c.JSON(status, H{"error": err.Error()})
+	return false
+}
+
+// Directory returns the directory of users and groups, or nil
+func (s *Server) Directory() *authz.Directory {
+	return s.config.Directory
+}
+
+// handleGetAccess reports the groups of a user and what they may run
+func (s *Server) handleGetAccess(c Context) {
+	policy := s.authzPolicy()
+	if !policy.Enabled() {
+		c.JSON(http.StatusNotImplemented, H{"error": "group authorization is not enabled on this server"})
+		return
+	}
+	c.JSON(http.StatusOK, policy.Access(s.config.Directory, c.Param("user")))
+}
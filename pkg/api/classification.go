@@ -0,0 +1,17 @@
+package api
+
+import "net/http"
+
+// classify returns the data classification a job declares, or the default
+// one, or responds with an error and returns false when it is unknown
+func (s *Server) classify(c Context, name string) (string, bool) {
+	classification, err := s.jobManager.Classify(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{
+			"error":           err.Error(),
+			"classifications": s.jobManager.ClassificationNames(),
+		})
+		return "", false
+	}
+	return classification, true
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forgeai/pkg/storage"
+)
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+// Encodings such as zstd and br are not offered.
+func acceptsGzip(header string) bool {
+	accepted := false
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "x-gzip" && coding != "*" {
+			continue
+		}
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		// An explicit gzip entry overrides the wildcard
+		if coding != "*" {
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
+
+// compressWriter gzips a response once it has grown past
+// storage.MinCompressSize, unless it is already encoded, a partial
+// response, or of an incompressible type
+type compressWriter struct {
+	http.ResponseWriter
+	stats *storage.CompressionStats
+
+	status  int
+	buf     []byte
+	decided bool
+	zw      *gzip.Writer
+	counter *countingWriter
+	raw     int64
+}
+
+// countingWriter counts the bytes written to a response
+type countingWriter struct {
+	w http.ResponseWriter
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < storage.MinCompressSize {
+			return len(p), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return w.write(p)
+}
+
+// write sends data, compressed if the response is
+func (w *compressWriter) write(p []byte) (int, error) {
+	if w.zw == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	w.raw += int64(len(p))
+	return w.zw.Write(p)
+}
+
+// decide sends the headers, compressing the response if it is large enough
+// and eligible, followed by the buffered data
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	header := w.Header()
+	if large && w.eligible(header) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.counter = &countingWriter{w: w.ResponseWriter}
+		w.zw = gzip.NewWriter(w.counter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.write(buf)
+	return err
+}
+
+// eligible reports whether the response may be compressed
+func (w *compressWriter) eligible(header http.Header) bool {
+	switch {
+	case w.status < 200, w.status == http.StatusNoContent, w.status == http.StatusPartialContent,
+		w.status == http.StatusNotModified:
+		return false
+	case header.Get("Content-Encoding") != "", header.Get("Content-Range") != "":
+		return false
+	}
+	return storage.Compressible(header.Get("Content-Type"))
+}
+
+// Flush sends buffered data so that streamed responses are not held back
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.zw != nil {
+		w.zw.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack passes connection takeovers through to the server
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
+
+// finish sends what is left of the response
+func (w *compressWriter) finish() {
+	if !w.decided {
+		if w.status == 0 && len(w.buf) == 0 {
+			return
+		}
+		w.decide(false)
+	}
+	if w.zw != nil {
+		w.zw.Close()
+		w.stats.Add(w.raw, w.counter.n)
+	}
+}
+
+// compressionMiddleware gzips responses for clients that accept it and
+// counts the bytes saved in stats
+func compressionMiddleware(stats *storage.CompressionStats) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, stats: stats}
+			defer cw.finish()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"forgeai/pkg/corpus"
+	"forgeai/pkg/jobs"
+)
+
+// handleExportCorpus exports a sample of the finished jobs that consented,
+// redacted, as JSON lines
+func (s *Server) handleExportCorpus(c Context) {
+	opts, err := corpusOptions(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	list := s.jobManager.ListJobs(jobs.Filter{})
+	var buf bytes.Buffer
+	stats, err := corpus.Export(&buf, list, s.config.Corpus, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Corpus-Eligible", strconv.Itoa(stats.Eligible))
+	c.Header("Corpus-Exported", strconv.Itoa(stats.Exported))
+	c.Header("Corpus-Redactions", strconv.Itoa(stats.Redactions))
+	c.Data(http.StatusOK, "application/x-ndjson", buf.Bytes())
+}
+
+// corpusOptions parses the rate, seed, max, since, until, language, status,
+// output, and max_output query parameters
+func corpusOptions(c Context, now time.Time) (corpus.Options, error) {
+	opts := corpus.Options{
+		Languages: c.QueryArray("language"),
+		Statuses:  c.QueryArray("status"),
+		Output:    c.Query("output") == "true",
+	}
+	var err error
+	if param := c.Query("rate"); param != "" {
+		if opts.Rate, err = strconv.ParseFloat(param, 64); err != nil || opts.Rate <= 0 || opts.Rate > 1 {
+			return opts, fmt.Errorf("rate must be a number above 0 and at most 1")
+		}
+	}
+	if param := c.Query("seed"); param != "" {
+		if opts.Seed, err = strconv.ParseInt(param, 10, 64); err != nil {
+			return opts, fmt.Errorf("seed must be a whole number")
+		}
+	}
+	if param := c.Query("max"); param != "" {
+		if opts.Max, err = strconv.Atoi(param); err != nil || opts.Max <= 0 {
+			return opts, fmt.Errorf("max must be a positive number")
+		}
+	}
+	if param := c.Query("max_output"); param != "" {
+		if opts.MaxOutput, err = strconv.Atoi(param); err != nil || opts.MaxOutput <= 0 {
+			return opts, fmt.Errorf("max_output must be a positive number")
+		}
+	}
+	if opts.Since, err = parseTimeParam(c.Query("since"), now); err != nil {
+		return opts, fmt.Errorf("invalid since: %w", err)
+	}
+	if opts.Until, err = parseTimeParam(c.Query("until"), now); err != nil {
+		return opts, fmt.Errorf("invalid until: %w", err)
+	}
+	return opts, nil
+}
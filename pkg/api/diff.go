@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"forgeai/pkg/compare"
+	"forgeai/pkg/jobs"
+)
+
+// diffVersion is one version of the code in a diff request
+type diffVersion struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// handleExecuteDiff runs a base and a candidate version of code in
+// parallel with the same settings and responds with the difference in
+// their results
+func (s *Server) handleExecuteDiff(c Context) {
+	var req struct {
+		Language      string            `json:"language" binding:"required"`
+		Base          diffVersion       `json:"base" binding:"required"`
+		Candidate     diffVersion       `json:"candidate" binding:"required"`
+		Timeout       int               `json:"timeout"`
+		MemoryLimit   int               `json:"memory_limit"`
+		NetworkAccess *bool             `json:"network_access"`
+		ReadOnlyFS    bool              `json:"read_only_fs"`
+		Fixtures      []string          `json:"fixtures"`
+		Labels        map[string]string `json:"labels"`
+		Timezone      string            `json:"timezone"`
+		Locale        string            `json:"locale"`
+
+		Classification string `json:"classification"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	if !s.checkLanguage(c, "language", &req.Language) {
+		return
+	}
+
+	if err := jobs.ValidateLabels(req.Labels); err != nil {
+		respondInvalid(c, fieldError("labels", "format", err.Error(), nil, nil))
+		return
+	}
+
+	locale, ok := s.checkLocale(c, req.Timezone, req.Locale)
+	if !ok {
+		return
+	}
+
+	mounts, ok := s.resolveFixtures(c, req.Fixtures)
+	if !ok {
+		return
+	}
+
+	require := isolationRequirements(req.MemoryLimit, req.NetworkAccess, req.ReadOnlyFS)
+
+	if req.Timeout == 0 {
+		req.Timeout = 30
+	}
+	if req.MemoryLimit == 0 {
+		req.MemoryLimit = 128
+	}
+
+	// Both versions are waited for, like a synchronous execution
+	if req.Timeout > MaxSyncTimeout {
+		c.JSON(http.StatusBadRequest, H{
+			"error": fmt.Sprintf("diff execution is limited to a timeout of %d seconds", MaxSyncTimeout),
+		})
+		return
+	}
+
+	if !s.acceptingJobs(c) || !s.requireIsolation(c, req.Language, require) {
+		return
+	}
+
+	// Run the hooks on each version; both must keep the same settings so
+	// that only the code differs
+	hookReqs := make([]ExecuteRequest, 2)
+	for i, code := range []string{req.Base.Code, req.Candidate.Code} {
+		hookReqs[i] = ExecuteRequest{
+			Language:      req.Language,
+			Code:          code,
+			Timeout:       req.Timeout,
+			MemoryLimit:   req.MemoryLimit,
+			NetworkAccess: req.NetworkAccess != nil && *req.NetworkAccess,
+			Labels:        req.Labels,
+			Header:        c.Request().Header,
+
+			Classification: req.Classification,
+		}
+		if !s.beforeExecute(c, &hookReqs[i]) {
+			return
+		}
+		defer s.release(&hookReqs[i])
+	}
+	base, candidate := hookReqs[0], hookReqs[1]
+	if base.Language != candidate.Language || base.Timeout != candidate.Timeout ||
+		base.MemoryLimit != candidate.MemoryLimit || base.NetworkAccess != candidate.NetworkAccess ||
+		base.Classification != candidate.Classification {
+		c.JSON(http.StatusUnprocessableEntity, H{"error": "hooks changed the settings of one version only"})
+		return
+	}
+	classification, ok := s.classify(c, base.Classification)
+	if !ok {
+		return
+	}
+
+	for _, hookReq := range hookReqs {
+		if entry, ok := s.jobManager.IsQuarantined(hookReq.Language, hookReq.Code); ok {
+			c.JSON(http.StatusForbidden, H{
+				"error":     "code is quarantined",
+				"code_hash": entry.CodeHash,
+				"reason":    entry.Reason,
+			})
+			return
+		}
+	}
+
+	// Start both versions before waiting for either
+	var started []*jobs.Job
+	for i := range hookReqs {
+		hookReq := &hookReqs[i]
+		labels := map[string]string{}
+		for k, v := range hookReq.Labels {
+			labels[k] = v
+		}
+		labels["diff"] = []string{"base", "candidate"}[i]
+
+		job := s.jobManager.CreateJob(hookReq.Language, hookReq.Code)
+		job.Timeout = hookReq.Timeout
+		job.MemoryLimit = hookReq.MemoryLimit
+		job.NetworkAccess = hookReq.NetworkAccess
+		job.Fixtures = mounts
+		job.Locale = locale.WithDefaults(job.Locale)
+		job.Labels = labels
+		job.Classification = classification
+		if err := s.jobManager.Dispatch(context.Background(), job); err != nil {
+			for _, j := range started {
+				s.jobManager.CancelJob(j.ID)
+			}
+			c.JSON(http.StatusServiceUnavailable, H{"error": err.Error()})
+			return
+		}
+		s.afterExecute(hookReq, job)
+		started = append(started, job)
+	}
+
+	// Wait for both within one budget, stopping them if the client goes away
+	ctx := c.Request().Context()
+	deadline := time.Now().Add(time.Duration(req.Timeout)*time.Second + MaxWait)
+	finished := true
+	for i, job := range started {
+		started[i], _ = s.jobManager.WaitJob(ctx, job.ID, time.Until(deadline))
+		_, done := s.jobManager.Status(job.ID)
+		finished = finished && done
+	}
+	if !finished {
+		for _, job := range started {
+			s.jobManager.CancelJob(job.ID)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		c.JSON(http.StatusGatewayTimeout, H{
+			"error":        "versions did not finish in time",
+			"base_id":      started[0].ID,
+			"candidate_id": started[1].ID,
+		})
+		return
+	}
+
+	resp := H{
+		"base":      diffJob(started[0]),
+		"candidate": diffJob(started[1]),
+	}
+	if started[0].Result == nil || started[1].Result == nil {
+		resp["error"] = "a version produced no result to compare"
+		c.JSON(http.StatusUnprocessableEntity, resp)
+		return
+	}
+	resp["diff"] = compare.Results(started[0].Result, started[1].Result)
+	c.JSON(http.StatusOK, resp)
+}
+
+// diffJob summarizes one version's job in a diff response
+func diffJob(job *jobs.Job) H {
+	h := H{
+		"job_id": job.ID,
+		"status": job.Status,
+	}
+	if job.Error != "" {
+		h["error"] = job.Error
+	}
+	return h
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Supported API versions, oldest first
+var APIVersions = []string{"v1", "v2"}
+
+// Envelope is the response body of every /v2 JSON endpoint
+type Envelope struct {
+	Data  interface{}    `json:"data"`
+	Error *EnvelopeError `json:"error"`
+	Meta  EnvelopeMeta   `json:"meta"`
+}
+
+// EnvelopeError describes a failed /v2 request
+type EnvelopeError struct {
+	// Code is a stable, machine-readable error code
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// EnvelopeMeta carries response metadata
+type EnvelopeMeta struct {
+	APIVersion string `json:"api_version"`
+	Status     int    `json:"status"`
+}
+
+// Error codes returned in /v2 envelopes
+const (
+	ErrCodeInvalidRequest = "invalid_request"
+	ErrCodeUnauthorized   = "unauthorized"
+	ErrCodeForbidden      = "forbidden"
+	ErrCodeNotFound       = "not_found"
+	ErrCodeConflict       = "conflict"
+	ErrCodeUnprocessable  = "unprocessable"
+	ErrCodeRateLimited    = "rate_limited"
+	ErrCodeInternal       = "internal"
+	ErrCodeUnavailable    = "unavailable"
+)
+
+// errorCode maps an HTTP status to an envelope error code
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrCodeForbidden
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusUnprocessableEntity:
+		return ErrCodeUnprocessable
+	case http.StatusTooManyRequests:
+		return ErrCodeRateLimited
+	case http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return ErrCodeUnavailable
+	}
+	if status >= 500 {
+		return ErrCodeInternal
+	}
+	return ErrCodeInvalidRequest
+}
+
+// bufferedWriter holds a handler's response so it can be rewritten
+type bufferedWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (w *bufferedWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+// envelopeMiddleware maps the responses of the shared handlers to /v2
+// envelopes. Non-JSON responses such as artifact downloads pass through.
+func envelopeMiddleware(version string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			buffered := &bufferedWriter{header: w.Header(), status: http.StatusOK}
+			next.ServeHTTP(buffered, r)
+
+			status := buffered.status
+			body := buffered.body.Bytes()
+
+			var payload interface{}
+			if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") ||
+				json.Unmarshal(body, &payload) != nil {
+				w.WriteHeader(status)
+				w.Write(body)
+				return
+			}
+
+			envelope := Envelope{Meta: EnvelopeMeta{APIVersion: version, Status: status}}
+			if status >= 400 {
+				envelope.Error = &EnvelopeError{Code: errorCode(status), Message: http.StatusText(status)}
+				if fields, ok := payload.(map[string]interface{}); ok {
+					if msg, ok := fields["error"].(string); ok {
+						envelope.Error.Message = msg
+						delete(fields, "error")
+					}
+					if len(fields) > 0 {
+						envelope.Error.Details = fields
+					}
+				}
+			} else {
+				envelope.Data = payload
+			}
+
+			data, _ := json.Marshal(envelope)
+			w.Header().Del("Content-Length")
+			w.WriteHeader(status)
+			w.Write(data)
+		})
+	}
+}
+
+// deprecationMiddleware advertises the successor of a superseded API version
+func deprecationMiddleware(successor string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := strings.Replace(r.URL.Path, "/v1/", "/"+successor+"/", 1)
+			w.Header().Set("Link", "<"+path+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
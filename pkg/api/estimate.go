@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+
+	"forgeai/pkg/jobs"
+)
+
+// handleEstimate estimates the queue wait, run time, image pull, and
+// resource class of a job from the history of similar jobs
+func (s *Server) handleEstimate(c Context) {
+	var req struct {
+		Language    string `json:"language" binding:"required"`
+		Code        string `json:"code"`
+		CodeSize    int    `json:"code_size"`
+		Timeout     int    `json:"timeout"`
+		MemoryLimit int    `json:"memory_limit"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	if !s.checkLanguage(c, "language", &req.Language) {
+		return
+	}
+	if req.Code != "" {
+		req.CodeSize = len(req.Code)
+	}
+
+	estimate := s.jobManager.Estimate(jobs.EstimateRequest{
+		Language:    req.Language,
+		CodeSize:    req.CodeSize,
+		Timeout:     req.Timeout,
+		MemoryLimit: req.MemoryLimit,
+	})
+
+	resp := H{
+		"language":              req.Language,
+		"code_size":             req.CodeSize,
+		"samples":               estimate.Samples,
+		"similar":               estimate.Similar,
+		"queue_wait":            estimate.QueueWait.String(),
+		"expected_duration":     estimate.Duration.String(),
+		"p95_duration":          estimate.P95.String(),
+		"timeouts":              estimate.Timeouts,
+		"resource_class":        estimate.Class,
+		"fits_requested_limits": estimate.Fits,
+		"backend":               s.jobManager.LanguageExecutor(req.Language).Capabilities().Backend,
+	}
+	if estimate.PeakMemory > 0 {
+		resp["peak_memory_bytes"] = estimate.PeakMemory
+	}
+
+	// Containerized runs of the language pay for pulling a missing image
+	dockerExec := s.dockerExecutor()
+	if dockerExec.IsDockerAvailable() {
+		image := dockerExec.ImageForLanguage(req.Language)
+		cached := dockerExec.ImageCached(c.Request().Context(), image)
+		resp["image"] = H{
+			"name":          image,
+			"cached":        cached,
+			"pull_required": !cached,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
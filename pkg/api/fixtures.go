@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"forgeai/pkg/fixtures"
+	"forgeai/pkg/sandbox"
+)
+
+// errFixturesDisabled is the response when the server stores no fixtures
+var errFixturesDisabled = H{"error": "fixtures are not enabled on this server"}
+
+// handleListFixtures handles listing stored fixtures
+func (s *Server) handleListFixtures(c Context) {
+	if s.config.Fixtures == nil {
+		c.JSON(http.StatusNotImplemented, errFixturesDisabled)
+		return
+	}
+	list := s.config.Fixtures.List()
+
+	c.JSON(http.StatusOK, H{
+		"fixtures": list,
+		"count":    len(list),
+	})
+}
+
+// handlePutFixture handles uploading a fixture. The request body is the
+// raw contents of the fixture, streamed to disk.
+func (s *Server) handlePutFixture(c Context) {
+	if s.config.Fixtures == nil {
+		c.JSON(http.StatusNotImplemented, errFixturesDisabled)
+		return
+	}
+
+	name := c.Param("name")
+	var before interface{}
+	if existing, ok := s.config.Fixtures.Get(name); ok {
+		before = existing
+	}
+	fixture, err := s.config.Fixtures.Put(name, c.Request().Body)
+	if err != nil {
+		s.audit(c, "fixture.put", name, before, nil, err)
+	} else {
+		s.audit(c, "fixture.put", name, before, fixture, nil)
+	}
+	if errors.Is(err, fixtures.ErrTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, fixture)
+}
+
+// handleGetFixture handles describing a fixture
+func (s *Server) handleGetFixture(c Context) {
+	if s.config.Fixtures == nil {
+		c.JSON(http.StatusNotImplemented, errFixturesDisabled)
+		return
+	}
+	fixture, ok := s.config.Fixtures.Get(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "fixture not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, fixture)
+}
+
+// handleDeleteFixture handles deleting a fixture
+func (s *Server) handleDeleteFixture(c Context) {
+	if s.config.Fixtures == nil {
+		c.JSON(http.StatusNotImplemented, errFixturesDisabled)
+		return
+	}
+	name := c.Param("name")
+
+	before, _ := s.config.Fixtures.Get(name)
+	if !s.config.Fixtures.Delete(name) {
+		s.audit(c, "fixture.delete", name, nil, nil, errors.New("fixture not found"))
+		c.JSON(http.StatusNotFound, H{"error": "fixture not found"})
+		return
+	}
+	s.audit(c, "fixture.delete", name, before, nil, nil)
+
+	c.JSON(http.StatusOK, H{
+		"name":    name,
+		"message": "Fixture deleted",
+	})
+}
+
+// resolveFixtures returns the fixtures a job references, or responds with
+// an error and returns false when one does not exist
+func (s *Server) resolveFixtures(c Context, names []string) ([]sandbox.Fixture, bool) {
+	if len(names) == 0 {
+		return nil, true
+	}
+	if s.config.Fixtures == nil {
+		c.JSON(http.StatusBadRequest, errFixturesDisabled)
+		return nil, false
+	}
+	resolved, err := s.config.Fixtures.Resolve(names)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return nil, false
+	}
+	return resolved, true
+}
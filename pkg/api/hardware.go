@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"forgeai/pkg/hardware"
+)
+
+// MaxCalibration is the longest calibration benchmark a request may run
+const MaxCalibration = 30 * time.Second
+
+// errHardwareDisabled is the response when the server reports no hardware
+var errHardwareDisabled = H{"error": "hardware reporting is not enabled on this server"}
+
+// hardwareStatus describes the hardware class of this worker
+func hardwareStatus(probe *hardware.Probe) H {
+	status := H{"class": probe.Class()}
+	if at := probe.CalibratedAt(); !at.IsZero() {
+		status["calibrated_at"] = at.UTC()
+	}
+	return status
+}
+
+// handleGetHardware reports the hardware class of this worker
+func (s *Server) handleGetHardware(c Context) {
+	if s.config.Hardware == nil {
+		c.JSON(http.StatusNotImplemented, errHardwareDisabled)
+		return
+	}
+	c.JSON(http.StatusOK, hardwareStatus(s.config.Hardware))
+}
+
+// handleCalibrateHardware runs the calibration benchmark on this worker.
+// Jobs running at the same time slow it down, so it is best run in
+// maintenance mode.
+func (s *Server) handleCalibrateHardware(c Context) {
+	if s.config.Hardware == nil {
+		c.JSON(http.StatusNotImplemented, errHardwareDisabled)
+		return
+	}
+	var req struct {
+		Duration string `json:"duration"`
+	}
+	if c.Request().ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondInvalid(c, err)
+			return
+		}
+	}
+	d := hardware.DefaultCalibration
+	if req.Duration != "" {
+		parsed, err := time.ParseDuration(req.Duration)
+		if err != nil || parsed <= 0 || parsed > MaxCalibration {
+			respondInvalid(c, fieldError("duration", "max",
+				fmt.Sprintf("duration must be a positive duration of at most %s", MaxCalibration), req.Duration, MaxCalibration.String()))
+			return
+		}
+		d = parsed
+	}
+
+	before := s.config.Hardware.Class()
+	s.config.Hardware.Calibrate(d)
+	after := hardwareStatus(s.config.Hardware)
+	s.audit(c, "hardware.calibrate", s.config.Hardware.Worker, before, after, nil)
+	c.JSON(http.StatusOK, after)
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/languages"
+)
+
+// ExecuteRequest is a job request as Hooks see it. OnBeforeExecute may
+// change it to transform the job.
+type ExecuteRequest struct {
+	// Language and Code are set for /v1/execute requests, FilePath for
+	// /v1/execute/file requests
+	Language string
+	Code     string
+	FilePath string
+
+	Timeout       int
+	MemoryLimit   int
+	NetworkAccess bool
+	Labels        map[string]string
+	ParentID      string
+
+	// Classification is the data classification the request declares
+	Classification string
+
+	// Header holds the HTTP request headers, for example to identify the
+	// caller
+	Header http.Header
+
+	// quotaKey is the key the request's usage is counted against, and
+	// reserved whether an execution of it is held for the request until
+	// it creates a job. token is the execution token an execution is held
+	// on likewise.
+	quotaKey string
+	reserved bool
+	token    string
+}
+
+// Hooks let applications that embed the server authorize, limit, or
+// transform job requests without changing the API handlers
+type Hooks struct {
+	// OnBeforeExecute runs before a job is created from req. An error
+	// rejects the request, with the status of a *HookError or 403
+	// Forbidden.
+	OnBeforeExecute func(ctx context.Context, req *ExecuteRequest) error
+
+	// OnAfterExecute runs in its own goroutine when a job created from req
+	// finishes. Requests answered with an existing job, because of an
+	// idempotency key or deduplication, do not create a job.
+	OnAfterExecute func(ctx context.Context, req ExecuteRequest, job *jobs.Job)
+
+	// Actor names who made a request in the audit trail and the user it
+	// is authorized as, such as the subject of its credentials. Requests
+	// it names no actor for are identified by Config.ActorHeader or, in
+	// the audit trail, their remote address.
+	Actor func(r *http.Request) string
+
+	// Tenant names the tenant of the caller of a request, such as a claim
+	// of its credentials. Quotas count usage by tenant only for requests
+	// it names one for, and refuse those labeled with another tenant.
+	// Volumes and output sink prefixes belong to the tenant it names, or
+	// else to the caller's principal.
+	Tenant func(r *http.Request) string
+}
+
+// HookError rejects a request from OnBeforeExecute with an HTTP status
+type HookError struct {
+	Status  int
+	Message string
+}
+
+func (e *HookError) Error() string {
+	return e.Message
+}
+
+// beforeExecute runs the OnBeforeExecute hook and then authorizes the
+// request it may have changed, and reserves an execution of its quota and
+// of its execution token. It responds and returns false when the hook
+// rejects the request, it is not authorized, it is over quota, or its token
+// does not allow it. Callers that go on to refuse the request or answer it
+// with an existing job must call release.
+func (s *Server) beforeExecute(c Context, req *ExecuteRequest) bool {
+	hook := s.config.Hooks.OnBeforeExecute
+	if hook == nil {
+		return s.admit(c, req)
+	}
+
+	err := hook(c.Request().Context(), req)
+	if err == nil {
+		return s.admit(c, req)
+	}
+	status := http.StatusForbidden
+	var hookErr *HookError
+	if errors.As(err, &hookErr) && hookErr.Status != 0 {
+		status = hookErr.Status
+	}
+	c.JSON(status, H{"error": err.Error()})
+	return false
+}
+
+// admit authorizes a request, checks its quotas, and reserves an execution
+// of its execution token. Hooks may have named the language by an alias.
+func (s *Server) admit(c Context, req *ExecuteRequest) bool {
+	req.Language = languages.Normalize(req.Language)
+	if !s.authorize(c, req) || !s.checkQuota(c, req) {
+		return false
+	}
+	if !s.useToken(c, req) {
+		s.releaseQuota(req)
+		return false
+	}
+	return true
+}
+
+// release returns the executions reserved for a request that created no
+// job to its quota and execution token
+func (s *Server) release(req *ExecuteRequest) {
+	s.releaseQuota(req)
+	s.releaseToken(req)
+}
+
+// afterExecute counts a created job against its quotas and execution token
+// and runs the OnAfterExecute hook once it finishes
+func (s *Server) afterExecute(req *ExecuteRequest, job *jobs.Job) {
+	req.token = ""
+	s.useQuota(req, job)
+
+	hook := s.config.Hooks.OnAfterExecute
+	if hook == nil {
+		return
+	}
+
+	go func(req ExecuteRequest) {
+		ctx := context.Background()
+		job, err := s.jobManager.Wait(ctx, job.ID)
+		if err != nil {
+			return
+		}
+		hook(ctx, req, job)
+	}(*req)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"forgeai/pkg/inspect"
+)
+
+// handleInspect reports the imports, operations, and likely capabilities
+// of code without running it
+func (s *Server) handleInspect(c Context) {
+	var req struct {
+		Language string `json:"language" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	report, err := inspect.Inspect(req.Language, req.Code)
+	if errors.Is(err, inspect.ErrUnsupported) {
+		c.JSON(http.StatusBadRequest, H{
+			"error":     fmt.Sprintf("cannot inspect %s code", req.Language),
+			"languages": inspect.Languages(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/restricted"
+	"forgeai/pkg/runtime"
+	"forgeai/pkg/sandbox"
+)
+
+// Built-in isolation classes
+const (
+	// ClassProcess runs jobs as local processes
+	ClassProcess = "process"
+
+	// ClassContainer runs jobs in docker containers
+	ClassContainer = "container"
+
+	// ClassGVisor runs jobs in docker containers on the gVisor runtime
+	ClassGVisor = "gvisor"
+
+	// ClassNsjail runs jobs in nsjail sandboxes with generated profiles
+	ClassNsjail = "nsjail"
+
+	// ClassInterpreter runs python-restricted jobs in the interpreter of
+	// the server process
+	ClassInterpreter = "interpreter"
+)
+
+// Isolation routes the jobs of each language to an isolation class and
+// limits how many run at once. The zero value runs every job as a local
+// process.
+type Isolation struct {
+	// Default is the class of languages without one and of file jobs;
+	// ClassProcess when empty
+	Default string
+
+	// Classes defines isolation classes in addition to the built-in ones
+	Classes map[string]IsolationClass
+
+	// Languages maps languages to isolation classes
+	Languages map[string]string
+
+	// Classifications maps data classifications to isolation classes,
+	// which take precedence over the classes of languages
+	Classifications map[string]string
+
+	// Concurrency limits how many jobs of a language run at once
+	Concurrency map[string]int
+}
+
+// IsolationClass is a backend that runs jobs
+type IsolationClass struct {
+	// Backend is process, docker, nsjail, or in-process, which only runs
+	// python-restricted
+	Backend string
+
+	// Runtime is the OCI runtime of docker containers, such as runsc
+	Runtime string
+
+	// Nsjail configures the jails of the nsjail backend
+	Nsjail Nsjail
+}
+
+// Nsjail configures the jails of an nsjail isolation class. The time,
+// memory, network, and open file limits of its profiles come from each
+// job.
+type Nsjail struct {
+	// Path is the nsjail binary; nsjail on the PATH when empty
+	Path string
+
+	// Profile is an nsjail config file used instead of generated profiles
+	Profile string
+
+	// Interpreters, Mounts, TmpSize, and Home are those of
+	// runtime.NsjailExecutor
+	Interpreters map[string]string
+	Mounts       []string
+	TmpSize      int
+	Home         string
+}
+
+// builtinClasses are the isolation classes that need no definition
+var builtinClasses = map[string]IsolationClass{
+	ClassProcess:   {Backend: "process"},
+	ClassContainer: {Backend: "docker"},
+	ClassGVisor:    {Backend: "docker", Runtime: "runsc"},
+	ClassNsjail:    {Backend: "nsjail"},
+
+	ClassInterpreter: {Backend: "in-process"},
+}
+
+// classes returns the built-in and defined isolation classes
+func (i Isolation) classes() map[string]IsolationClass {
+	classes := make(map[string]IsolationClass, len(builtinClasses)+len(i.Classes))
+	for name, class := range builtinClasses {
+		classes[name] = class
+	}
+	for name, class := range i.Classes {
+		classes[name] = class
+	}
+	return classes
+}
+
+// Routed reports whether any jobs leave the default local executor
+func (i Isolation) Routed() bool {
+	return (i.Default != "" && i.Default != ClassProcess) || len(i.Languages) > 0 || len(i.Classifications) > 0
+}
+
+// Validate checks the isolation classes and the classes of languages
+func (i Isolation) Validate() error {
+	names := make([]string, 0, len(i.Classes))
+	for name := range i.Classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		class := i.Classes[name]
+		switch class.Backend {
+		case "process", "in-process", "nsjail":
+			if class.Runtime != "" {
+				return fmt.Errorf("isolation class %s: a runtime requires the docker backend", name)
+			}
+		case "docker":
+		default:
+			return fmt.Errorf("isolation class %s: unknown backend %q, use process, docker, nsjail, or in-process", name, class.Backend)
+		}
+		if class.Backend != "nsjail" && (class.Nsjail.Path != "" || class.Nsjail.Profile != "" || len(class.Nsjail.Interpreters) > 0 || len(class.Nsjail.Mounts) > 0 || class.Nsjail.TmpSize != 0 || class.Nsjail.Home != "") {
+			return fmt.Errorf("isolation class %s: nsjail settings require the nsjail backend", name)
+		}
+		if class.Nsjail.TmpSize < 0 {
+			return fmt.Errorf("isolation class %s: the nsjail tmp size must not be negative", name)
+		}
+	}
+	for language, n := range i.Concurrency {
+		if n < 0 {
+			return fmt.Errorf("concurrency of %s must not be negative", language)
+		}
+	}
+	_, err := i.router(func(IsolationClass) jobs.ExecutorFactory { return nil })
+	return err
+}
+
+// router creates a class router with the executor factories of newFactory.
+// python-restricted runs in the interpreter class unless it is routed
+// elsewhere.
+func (i Isolation) router(newFactory func(IsolationClass) jobs.ExecutorFactory) (*jobs.ClassRouter, error) {
+	router := &jobs.ClassRouter{
+		Classes:   make(map[string]jobs.ExecutorFactory),
+		Languages: map[string]string{restricted.Language: ClassInterpreter},
+		Default:   i.Default,
+
+		Classifications: i.Classifications,
+	}
+	for language, class := range i.Languages {
+		router.Languages[language] = class
+	}
+	if router.Default == "" {
+		router.Default = ClassProcess
+	}
+	for name, class := range i.classes() {
+		router.Classes[name] = newFactory(class)
+	}
+	return router, router.Validate()
+}
+
+// classRouter routes jobs to the local executor of the job manager, to the
+// restricted Python interpreter, to nsjail, and to docker executors
+// configured like the environments API's
+func (s *Server) classRouter(local jobs.ExecutorFactory) (*jobs.ClassRouter, error) {
+	return s.config.Isolation.router(func(class IsolationClass) jobs.ExecutorFactory {
+		switch class.Backend {
+		case "process":
+			return local
+		case "in-process":
+			return jobs.ExecutorFactoryFunc(s.jobManager.RestrictedExecutor)
+		case "nsjail":
+			return jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+				return s.jobNsjailExecutor(job, class.Nsjail)
+			})
+		}
+		return jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return s.jobDockerExecutor(job, class.Runtime)
+		})
+	})
+}
+
+// jobDockerExecutor creates a docker executor with the limits and options
+// of a job, or the default limits for a nil job
+func (s *Server) jobDockerExecutor(job *jobs.Job, runtime string) sandbox.Executor {
+	exec := s.dockerExecutor()
+	exec.Runtime = runtime
+	exec.Output = s.currentSettings().Output
+	if job == nil {
+		return exec
+	}
+	exec.Timeout = time.Duration(job.Timeout) * time.Second
+	exec.MemoryLimit = job.MemoryLimit
+	exec.NetworkAccess = job.NetworkAccess
+	exec.Rlimits = job.Rlimits
+	exec.MapTracebacks = job.MapTracebacks
+	exec.Fixtures = job.Fixtures
+	exec.Locale = job.Locale
+	if job.Volume != nil && s.jobManager.Volumes != nil {
+		exec.Volume = s.jobManager.Volumes.Path(*job.Volume)
+	}
+	exec.JobID = job.ID
+	return exec
+}
+
+// jobNsjailExecutor creates an nsjail executor with the limits and options
+// of a job, or the default limits for a nil job
+func (s *Server) jobNsjailExecutor(job *jobs.Job, config Nsjail) sandbox.Executor {
+	exec := runtime.NewNsjailExecutor()
+	if config.Path != "" {
+		exec.NsjailPath = config.Path
+	}
+	exec.ProfilePath = config.Profile
+	exec.Interpreters = config.Interpreters
+	exec.Mounts = config.Mounts
+	exec.TmpSize = config.TmpSize
+	exec.Home = config.Home
+	exec.Output = s.currentSettings().Output
+	if job == nil {
+		return exec
+	}
+	exec.Timeout = time.Duration(job.Timeout) * time.Second
+	exec.MemoryLimit = job.MemoryLimit
+	exec.NetworkAccess = job.NetworkAccess
+	if job.Rlimits.OpenFiles > 0 {
+		exec.MaxOpenFiles = int(job.Rlimits.OpenFiles)
+	}
+	exec.MapTracebacks = job.MapTracebacks
+	exec.Locale = job.Locale
+	return exec
+}
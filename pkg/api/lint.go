@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"forgeai/pkg/lint"
+)
+
+// lintTimeout bounds a lint or format run, which includes compiling the
+// checker program of compiled languages
+const lintTimeout = time.Minute
+
+// handleLint reports syntax errors, and go vet findings for Go, without
+// running the code
+func (s *Server) handleLint(c Context) {
+	s.runLint(c, lint.Check)
+}
+
+// handleFormat returns code in the canonical format of its language
+func (s *Server) handleFormat(c Context) {
+	s.runLint(c, lint.Format)
+}
+
+// runLint runs a checker program for op in the sandbox of the language.
+// Checks create no job.
+func (s *Server) runLint(c Context, op string) {
+	var req struct {
+		Language string `json:"language" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+	if !s.acceptingJobs(c) {
+		return
+	}
+
+	if !s.checkLanguage(c, "language", &req.Language) {
+		return
+	}
+	exec := s.jobManager.LanguageExecutor(req.Language)
+	if !lint.Supported(op, req.Language) {
+		c.JSON(http.StatusBadRequest, H{"error": fmt.Sprintf("%s is not supported for %s", op, req.Language)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), lintTimeout)
+	defer cancel()
+	start := time.Now()
+	result, err := lint.Run(ctx, exec, op, req.Language, req.Code)
+	if errors.Is(err, lint.ErrUnsupported) {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+		return
+	}
+	if result.Error != "" {
+		c.JSON(http.StatusNotImplemented, H{"error": result.Error})
+		return
+	}
+
+	resp := H{
+		"language":    req.Language,
+		"valid":       result.Valid(),
+		"diagnostics": result.Diagnostics,
+		"duration":    time.Since(start).String(),
+		"backend":     exec.Capabilities().Backend,
+	}
+	if op == lint.Format && result.Valid() {
+		resp["formatted"] = result.Formatted
+		resp["changed"] = result.Formatted != req.Code
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"forgeai/pkg/jobs"
+)
+
+// logPruneInterval is how often logs past their retention are removed
+const logPruneInterval = time.Hour
+
+// errUnsatisfiableRange is returned for ranges outside a log
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// handleGetJobLogs handles downloading the full stdout or stderr of a
+// finished job, optionally a byte range of it
+func (s *Server) handleGetJobLogs(c Context) {
+	stream := c.DefaultQuery("stream", jobs.StreamStdout)
+	if stream != jobs.StreamStdout && stream != jobs.StreamStderr {
+		c.JSON(http.StatusBadRequest, H{"error": "stream must be stdout or stderr"})
+		return
+	}
+
+	job, ok := s.jobManager.GetJob(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "job not found"})
+		return
+	}
+	if !job.Finished() {
+		c.JSON(http.StatusConflict, H{"error": "job has not finished"})
+		return
+	}
+
+	reader, log, err := s.jobManager.OpenLog(c.Request().Context(), job, stream)
+	switch {
+	case errors.Is(err, jobs.ErrLogNotFound):
+		c.JSON(http.StatusNotFound, H{"error": "job has no output"})
+		return
+	case errors.Is(err, jobs.ErrLogExpired):
+		c.JSON(http.StatusGone, H{"error": "log expired"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	headers := map[string]string{
+		"Accept-Ranges":       "bytes",
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s-%s.log"`, job.ID, stream),
+	}
+	contentType := log.ContentType()
+
+	start, end, ranged, err := parseRange(c.GetHeader("Range"), log.Size)
+	if err != nil {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", log.Size))
+		c.JSON(http.StatusRequestedRangeNotSatisfiable, H{"error": err.Error()})
+		return
+	}
+	if !ranged {
+		c.DataFromReader(http.StatusOK, log.Size, contentType, reader, headers)
+		return
+	}
+
+	if _, err := io.CopyN(io.Discard, reader, start); err != nil {
+		c.JSON(http.StatusInternalServerError, H{"error": fmt.Sprintf("failed to read log: %v", err)})
+		return
+	}
+	length := end - start + 1
+	headers["Content-Range"] = fmt.Sprintf("bytes %d-%d/%d", start, end, log.Size)
+	c.DataFromReader(http.StatusPartialContent, length, contentType, io.LimitReader(reader, length), headers)
+}
+
+// parseRange parses a Range header with a single byte range, such as
+// bytes=0-1023, bytes=1024-, or bytes=-512, into the first and last byte
+// of the range. Other headers, including multiple ranges, select the whole
+// content.
+func parseRange(header string, size int64) (start, end int64, ranged bool, err error) {
+	if !strings.HasPrefix(header, "bytes=") || strings.Contains(header, ",") {
+		return 0, 0, false, nil
+	}
+	spec := strings.TrimPrefix(header, "bytes=")
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false, nil
+	}
+
+	switch {
+	case first == "":
+		// The last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false, errUnsatisfiableRange
+		}
+		if n > size {
+			n = size
+		}
+		start, end = size-n, size-1
+	default:
+		start, err = strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return 0, 0, false, errUnsatisfiableRange
+		}
+		end = size - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || end < start {
+				return 0, 0, false, errUnsatisfiableRange
+			}
+			if end > size-1 {
+				end = size - 1
+			}
+		}
+	}
+	if start >= size {
+		return 0, 0, false, errUnsatisfiableRange
+	}
+	return start, end, true, nil
+}
+
+// pruneLogs removes logs past their retention until ctx is done
+func (s *Server) pruneLogs(ctx context.Context) {
+	ticker := time.NewTicker(logPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		s.jobManager.PruneLogs(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"forgeai/pkg/authz"
+	"forgeai/pkg/container"
+	"forgeai/pkg/languages"
+)
+
+// managed holds the group policies and language environments set through
+// the admin API. They take the place of the settings of the configuration
+// file for the groups and languages they name, and outlive reloads, so that
+// tools such as Terraform can manage them declaratively.
+type managed struct {
+	mu           sync.RWMutex
+	policies     map[string]authz.Grant
+	environments map[string]environmentSpec
+}
+
+// environmentSpec is the image of a language set through the admin API
+type environmentSpec struct {
+	Image string `json:"image"`
+
+	// ArchImages are the images of the language by architecture, such as
+	// arm64, used in place of Image on hosts of that architecture
+	ArchImages map[string]string `json:"arch_images,omitempty"`
+}
+
+// Validate checks that the environment names an image for every
+// architecture it covers
+func (e environmentSpec) Validate() error {
+	if strings.TrimSpace(e.Image) == "" || strings.ContainsAny(e.Image, " \t\n") {
+		return errors.New("image must be an image reference such as python:3.12-alpine")
+	}
+	for arch, image := range e.ArchImages {
+		if strings.Contains(arch, "/") || container.ValidatePlatform("linux/"+arch) != nil {
+			return fmt.Errorf("invalid architecture %q: expected an architecture such as arm64", arch)
+		}
+		if strings.TrimSpace(image) == "" || strings.ContainsAny(image, " \t\n") {
+			return fmt.Errorf("the %s image must be an image reference", arch)
+		}
+	}
+	return nil
+}
+
+// policy returns the managed grant of a group
+func (m *managed) policy(group string) (authz.Grant, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	grant, ok := m.policies[group]
+	return grant, ok
+}
+
+// setPolicy sets the grant of a group and reports whether it replaced one
+func (m *managed) setPolicy(group string, grant authz.Grant) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.policies == nil {
+		m.policies = map[string]authz.Grant{}
+	}
+	_, replaced := m.policies[group]
+	m.policies[group] = grant
+	return replaced
+}
+
+// deletePolicy removes the grant of a group and reports whether it existed
+func (m *managed) deletePolicy(group string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.policies[group]
+	delete(m.policies, group)
+	return ok
+}
+
+// allPolicies returns a copy of the managed grants by group
+func (m *managed) allPolicies() map[string]authz.Grant {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	policies := make(map[string]authz.Grant, len(m.policies))
+	for group, grant := range m.policies {
+		policies[group] = grant
+	}
+	return policies
+}
+
+// environment returns the managed environment of a language
+func (m *managed) environment(language string) (environmentSpec, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	env, ok := m.environments[language]
+	return env, ok
+}
+
+// setEnvironment sets the environment of a language and reports whether it
+// replaced one
+func (m *managed) setEnvironment(language string, env environmentSpec) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.environments == nil {
+		m.environments = map[string]environmentSpec{}
+	}
+	_, replaced := m.environments[language]
+	m.environments[language] = env
+	return replaced
+}
+
+// deleteEnvironment removes the environment of a language and reports
+// whether it existed
+func (m *managed) deleteEnvironment(language string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.environments[language]
+	delete(m.environments, language)
+	return ok
+}
+
+// allEnvironments returns a copy of the managed environments by language
+func (m *managed) allEnvironments() map[string]environmentSpec {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	environments := make(map[string]environmentSpec, len(m.environments))
+	for language, env := range m.environments {
+		environments[language] = env
+	}
+	return environments
+}
+
+// images returns the images and architecture images of languages with the
+// managed environments in place of the configured images of their
+// languages
+func (m *managed) images(images map[string]string, archImages map[string]map[string]string) (map[string]string, map[string]map[string]string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.environments) == 0 {
+		return images, archImages
+	}
+
+	merged := make(map[string]string, len(images)+len(m.environments))
+	for language, image := range images {
+		merged[language] = image
+	}
+	mergedArch := make(map[string]map[string]string, len(archImages))
+	for arch, byLanguage := range archImages {
+		mergedArch[arch] = make(map[string]string, len(byLanguage))
+		for language, image := range byLanguage {
+			if _, ok := m.environments[language]; !ok {
+				mergedArch[arch][language] = image
+			}
+		}
+	}
+	for language, env := range m.environments {
+		merged[language] = env.Image
+		for arch, image := range env.ArchImages {
+			if mergedArch[arch] == nil {
+				mergedArch[arch] = map[string]string{}
+			}
+			mergedArch[arch][language] = image
+		}
+	}
+	return merged, mergedArch
+}
+
+// authzPolicy returns the group authorization in effect: the settings'
+// policy with the managed grants in place of the grants of their groups
+func (s *Server) authzPolicy() authz.Policy {
+	policy := s.currentSettings().Authz
+	policies := s.managed.allPolicies()
+	if len(policies) == 0 {
+		return policy
+	}
+
+	groups := make(map[string]authz.Grant, len(policy.Groups)+len(policies))
+	for group, grant := range policy.Groups {
+		groups[group] = grant
+	}
+	for group, grant := range policies {
+		groups[group] = grant
+	}
+	policy.Groups = groups
+	return policy
+}
+
+// policyResource is the grant of a group as the admin API describes it.
+// Managed is false for grants of the configuration file.
+type policyResource struct {
+	Group string `json:"group"`
+	authz.Grant
+	Managed bool `json:"managed"`
+}
+
+// policyOf returns the grant in effect for a group
+func (s *Server) policyOf(group string) (policyResource, bool) {
+	if grant, ok := s.managed.policy(group); ok {
+		return policyResource{Group: group, Grant: grant, Managed: true}, true
+	}
+	if grant, ok := s.currentSettings().Authz.Groups[group]; ok {
+		return policyResource{Group: group, Grant: grant}, true
+	}
+	return policyResource{}, false
+}
+
+// requireDirectory responds and returns false when the server has no
+// directory of users and groups that policies could grant access to
+func (s *Server) requireDirectory(c Context) bool {
+	if s.config.Directory == nil {
+		c.JSON(http.StatusNotImplemented, H{"error": "group authorization is not configured on this server"})
+		return false
+	}
+	return true
+}
+
+// handleListPolicies lists the grants of groups, of the configuration file
+// and of the admin API
+func (s *Server) handleListPolicies(c Context) {
+	if !s.requireDirectory(c) {
+		return
+	}
+	policy := s.authzPolicy()
+	list := make([]policyResource, 0, len(policy.Groups))
+	for group := range policy.Groups {
+		p, _ := s.policyOf(group)
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Group < list[j].Group })
+
+	c.JSON(http.StatusOK, H{
+		"policies": list,
+		"count":    len(list),
+	})
+}
+
+// handleGetPolicy reports the grant of a group
+func (s *Server) handleGetPolicy(c Context) {
+	if !s.requireDirectory(c) {
+		return
+	}
+	p, ok := s.policyOf(c.Param("group"))
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "policy not found"})
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// handlePutPolicy sets the grant of a group, in place of any grant of the
+// configuration file. It responds 201 Created when the group had no managed
+// grant, and putting the same grant again changes nothing.
+func (s *Server) handlePutPolicy(c Context) {
+	if !s.requireDirectory(c) {
+		return
+	}
+	var grant authz.Grant
+	if err := c.ShouldBindJSON(&grant); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	group := c.Param("group")
+	var before interface{}
+	if p, ok := s.policyOf(group); ok {
+		before = p
+	}
+	for i, l := range grant.Languages {
+		if l != authz.AnyLanguage {
+			grant.Languages[i] = languages.Normalize(l)
+		}
+	}
+	sort.Strings(grant.Languages)
+	if err := grant.Validate(); err != nil {
+		s.audit(c, "policy.put", group, before, nil, err)
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusCreated
+	if s.managed.setPolicy(group, grant) {
+		status = http.StatusOK
+	}
+	after := policyResource{Group: group, Grant: grant, Managed: true}
+	s.audit(c, "policy.put", group, before, after, nil)
+	c.JSON(status, after)
+}
+
+// handleDeletePolicy removes the managed grant of a group, which returns
+// the group to its grant in the configuration file, if any
+func (s *Server) handleDeletePolicy(c Context) {
+	if !s.requireDirectory(c) {
+		return
+	}
+	group := c.Param("group")
+	before, _ := s.policyOf(group)
+	if !s.managed.deletePolicy(group) {
+		if before.Group != "" {
+			c.JSON(http.StatusConflict, H{"error": "policy is set in the configuration file"})
+			return
+		}
+		c.JSON(http.StatusNotFound, H{"error": "policy not found"})
+		return
+	}
+	s.audit(c, "policy.delete", group, before, nil, nil)
+
+	c.JSON(http.StatusOK, H{
+		"group":   group,
+		"message": "policy deleted",
+	})
+}
+
+// environmentResource is the image of a language as the admin API
+// describes it. Managed is false for images of the configuration file and
+// the defaults.
+type environmentResource struct {
+	Language string `json:"language"`
+	environmentSpec
+	Managed bool `json:"managed"`
+}
+
+// environmentOf returns the configured environment of a language, or false
+// when the language has no container environment
+func (s *Server) environmentOf(language string) (environmentResource, bool) {
+	if env, ok := s.managed.environment(language); ok {
+		return environmentResource{Language: language, environmentSpec: env, Managed: true}, true
+	}
+
+	supported := false
+	for _, lang := range container.NewDockerExecutor().SupportedLanguages() {
+		supported = supported || lang == language
+	}
+	if !supported {
+		return environmentResource{}, false
+	}
+	settings := s.currentSettings()
+	env := environmentSpec{Image: settings.Images[language]}
+	if env.Image == "" {
+		env.Image = container.DefaultImages[language]
+	}
+	for arch, byLanguage := range settings.ArchImages {
+		if image, ok := byLanguage[language]; ok {
+			if env.ArchImages == nil {
+				env.ArchImages = map[string]string{}
+			}
+			env.ArchImages[arch] = image
+		}
+	}
+	return environmentResource{Language: language, environmentSpec: env}, true
+}
+
+// handleGetEnvironment reports the configured images of a language
+func (s *Server) handleGetEnvironment(c Context) {
+	env, ok := s.environmentOf(languages.Normalize(c.Param("language")))
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "environment not found"})
+		return
+	}
+	c.JSON(http.StatusOK, env)
+}
+
+// handlePutEnvironment sets the images of a language, in place of its
+// images in the configuration file. It responds 201 Created when the
+// language had no managed environment, and putting the same environment
+// again changes nothing.
+func (s *Server) handlePutEnvironment(c Context) {
+	language := languages.Normalize(c.Param("language"))
+	before, ok := s.environmentOf(language)
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "environment not found"})
+		return
+	}
+	var env environmentSpec
+	if err := c.ShouldBindJSON(&env); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+	if err := env.Validate(); err != nil {
+		s.audit(c, "environment.put", language, before, nil, err)
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusCreated
+	if s.managed.setEnvironment(language, env) {
+		status = http.StatusOK
+	}
+	after := environmentResource{Language: language, environmentSpec: env, Managed: true}
+	s.audit(c, "environment.put", language, before, after, nil)
+	c.JSON(status, after)
+}
+
+// handleDeleteEnvironment removes the managed environment of a language,
+// which returns it to the images of the configuration file
+func (s *Server) handleDeleteEnvironment(c Context) {
+	language := languages.Normalize(c.Param("language"))
+	before, _ := s.environmentOf(language)
+	if !s.managed.deleteEnvironment(language) {
+		c.JSON(http.StatusNotFound, H{"error": "environment has no managed images"})
+		return
+	}
+	after, _ := s.environmentOf(language)
+	s.audit(c, "environment.delete", language, before, after, nil)
+
+	c.JSON(http.StatusOK, after)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+
+	"forgeai/pkg/storage"
+)
+
+// metricsContentType is the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metricsWriter writes metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+// gauge writes the help and type lines of a gauge
+func (w *metricsWriter) gauge(name, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// counter writes the help and type lines of a counter
+func (w *metricsWriter) counter(name, help string) {
+	fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+}
+
+// sample writes one sample; labels alternate names and values
+func (w *metricsWriter) sample(name string, value float64, labels ...string) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+		}
+		w.buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	fmt.Fprintf(&w.buf, " %g\n", value)
+}
+
+// handleMetrics exposes server metrics for Prometheus
+func (s *Server) handleMetrics(c Context) {
+	var w metricsWriter
+	s.writeProcessMetrics(&w)
+	s.writeSelfTestMetrics(&w)
+	s.writeCompressionMetrics(&w)
+	s.writeScalingMetrics(&w)
+	c.Data(http.StatusOK, metricsContentType, w.buf.Bytes())
+}
+
+// writeProcessMetrics writes gauges of the resources held by the server
+// process, to detect leaks
+func (s *Server) writeProcessMetrics(w *metricsWriter) {
+	w.gauge("go_goroutines", "Number of goroutines that currently exist.")
+	w.sample("go_goroutines", float64(runtime.NumGoroutine()))
+
+	// Only available on Linux
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		w.gauge("process_open_fds", "Number of open file descriptors.")
+		w.sample("process_open_fds", float64(len(fds)))
+	}
+
+	if entries, err := os.ReadDir(os.TempDir()); err == nil {
+		dirs := 0
+		for _, entry := range entries {
+			if entry.IsDir() && strings.HasPrefix(entry.Name(), "forgeai-") {
+				dirs++
+			}
+		}
+		w.gauge("forgeai_temp_dirs", "Number of ForgeAI directories in the temp directory.")
+		w.sample("forgeai_temp_dirs", float64(dirs))
+	}
+
+	if s.config.Workspaces != nil {
+		w.gauge("forgeai_workspaces_active", "Number of workspaces in use.")
+		w.sample("forgeai_workspaces_active", float64(s.config.Workspaces.Stats().Active))
+	}
+}
+
+// writeSelfTestMetrics writes the gauges of the last security self-test run
+func (s *Server) writeSelfTestMetrics(w *metricsWriter) {
+	if s.config.SelfTest == nil {
+		return
+	}
+	run, ok := s.config.SelfTest.Last()
+	if !ok {
+		return
+	}
+
+	w.gauge("forgeai_security_selftest_passed", "Whether a security self-test passed in the last run.")
+	for _, result := range run.Results {
+		passed := 0.0
+		if result.Passed {
+			passed = 1
+		}
+		w.sample("forgeai_security_selftest_passed", passed, "test", result.Name, "category", result.Category)
+	}
+
+	w.gauge("forgeai_security_selftest_failed", "Number of security self-tests that failed in the last run.")
+	w.sample("forgeai_security_selftest_failed", float64(run.Failed))
+
+	w.gauge("forgeai_security_selftest_regressions", "Number of security self-tests that started failing in the last run.")
+	w.sample("forgeai_security_selftest_regressions", float64(len(run.Regressions)))
+
+	w.gauge("forgeai_security_selftest_last_run_timestamp_seconds", "Start time of the last security self-test run.")
+	w.sample("forgeai_security_selftest_last_run_timestamp_seconds", float64(run.StartedAt.Unix()))
+
+	w.gauge("forgeai_security_selftest_duration_seconds", "Duration of the last security self-test run.")
+	w.sample("forgeai_security_selftest_duration_seconds", float64(run.DurationMs)/1000)
+}
+
+// writeCompressionMetrics writes the bytes of compressed data before and
+// after compression, by what was compressed
+func (s *Server) writeCompressionMetrics(w *metricsWriter) {
+	type target struct {
+		name  string
+		stats *storage.CompressionStats
+	}
+	targets := []target{
+		{"responses", &s.responses},
+		{"logs", &s.jobManager.LogCompression},
+	}
+	if compressed, ok := s.storage.(*storage.CompressedBackend); ok {
+		targets = append(targets, target{"storage", &compressed.Stats})
+	}
+
+	w.counter("forgeai_compression_raw_bytes_total", "Bytes of data before compression.")
+	for _, target := range targets {
+		raw, _ := target.stats.Totals()
+		w.sample("forgeai_compression_raw_bytes_total", float64(raw), "target", target.name)
+	}
+
+	w.counter("forgeai_compression_compressed_bytes_total", "Bytes of data after compression.")
+	for _, target := range targets {
+		_, compressed := target.stats.Totals()
+		w.sample("forgeai_compression_compressed_bytes_total", float64(compressed), "target", target.name)
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/notify"
+	"forgeai/pkg/security"
+)
+
+// watchJobs raises notifications for finished jobs until ctx is done
+func (s *Server) watchJobs(ctx context.Context) {
+	events, unsubscribe := s.jobManager.Subscribe(jobs.Filter{})
+	defer unsubscribe()
+
+	monitor := s.config.FailureRate
+	if monitor == nil {
+		monitor = notify.NewFailureRateMonitor(s.config.Notifier)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if event.Status != "completed" && event.Status != "failed" && event.Status != "setup_failed" && event.Status != "interrupted" {
+				continue
+			}
+
+			// Failing user code is expected; only setup failures and failed
+			// replicas point at the server
+			if err := monitor.Record(ctx, event.Status == "setup_failed" || event.Status == "interrupted"); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+
+			if findings := notify.EscapeFindings(event.Job.Threat); len(findings) > 0 {
+				if err := s.config.Notifier.Notify(ctx, notify.SandboxEscapeEvent(event.JobID, findings)); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// notifySelfTest alerts on security self-test regressions
+func (s *Server) notifySelfTest(ctx context.Context, run security.SelfTestRun) {
+	event := notify.SecurityTestsEvent(run.FailedTests(), len(run.Results))
+	event.Details["regressions"] = strings.Join(run.Regressions, ", ")
+	if err := s.config.Notifier.Notify(ctx, event); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
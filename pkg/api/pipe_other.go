@@ -0,0 +1,13 @@
+//go:build !windows
+
+package api
+
+import (
+	"errors"
+	"net"
+)
+
+// listenPipe fails: named pipes only exist on Windows
+func listenPipe(path, sddl string) (net.Listener, error) {
+	return nil, errors.New("named pipes are only supported on Windows, use a Unix socket path instead")
+}
@@ -0,0 +1,380 @@
+//go:build windows
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeBufferSize is the size of the input and output buffers of a pipe
+// instance
+const pipeBufferSize = 64 * 1024
+
+// listenPipe listens on a Windows named pipe such as \\.\pipe\forgeai.
+// Only local clients that the security descriptor sddl grants access can
+// connect; DefaultPipeSecurity when empty.
+func listenPipe(path, sddl string) (net.Listener, error) {
+	if sddl == "" {
+		sddl = DefaultPipeSecurity
+	}
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipe security descriptor: %w", err)
+	}
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &pipeListener{
+		path: path,
+		name: name,
+		sa: &windows.SecurityAttributes{
+			Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+			SecurityDescriptor: sd,
+		},
+	}
+	// The first instance claims the name, so that a second server fails
+	// here rather than serving half of the clients
+	if l.next, err = l.instance(true); err != nil {
+		return nil, fmt.Errorf("failed to create pipe %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// pipeListener accepts clients of a named pipe. Every client connects to
+// an instance of its own; the next instance waits for a client.
+type pipeListener struct {
+	path string
+	name *uint16
+	sa   *windows.SecurityAttributes
+
+	mu        sync.Mutex
+	next      windows.Handle
+	accepting bool
+	closed    bool
+}
+
+// instance creates a pipe instance for overlapped I/O
+func (l *pipeListener) instance(first bool) (windows.Handle, error) {
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	mode := uint32(windows.PIPE_TYPE_BYTE | windows.PIPE_READMODE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS)
+	return windows.CreateNamedPipe(l.name, flags, mode, windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, l.sa)
+}
+
+// Accept waits for a client to connect to the next instance
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	if l.next == 0 {
+		h, err := l.instance(false)
+		if err != nil {
+			l.mu.Unlock()
+			return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: pipeAddr(l.path), Err: err}
+		}
+		l.next = h
+	}
+	h := l.next
+	l.accepting = true
+	l.mu.Unlock()
+
+	ov, err := newOverlapped()
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(ov.HEvent)
+
+	err = windows.ConnectNamedPipe(h, ov)
+	if err == windows.ERROR_IO_PENDING {
+		var n uint32
+		err = windows.GetOverlappedResult(h, ov, &n, true)
+	}
+	if err == windows.ERROR_PIPE_CONNECTED {
+		// The client connected before ConnectNamedPipe was called
+		err = nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.accepting = false
+	if l.closed {
+		// Close left the instance to be closed here
+		windows.CloseHandle(h)
+		return nil, net.ErrClosed
+	}
+	l.next = 0
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: pipeAddr(l.path), Err: err}
+	}
+	return &pipeConn{h: h, addr: pipeAddr(l.path)}, nil
+}
+
+// Close stops accepting clients. Connected clients are not closed.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return net.ErrClosed
+	}
+	l.closed = true
+	if l.next != 0 {
+		// Cancelling ends the pending ConnectNamedPipe of Accept, which
+		// then closes the instance
+		windows.CancelIoEx(l.next, nil)
+		if !l.accepting {
+			windows.CloseHandle(l.next)
+		}
+		l.next = 0
+	}
+	return nil
+}
+
+// Addr returns the pipe path
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.path)
+}
+
+// pipeAddr is the path of a named pipe
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// pipeConn is a connected pipe instance. Reads and writes use overlapped
+// I/O, so that they can run at the same time and be cancelled when their
+// deadline passes or the connection closes.
+type pipeConn struct {
+	h    windows.Handle
+	addr pipeAddr
+
+	read, write pipeDeadline
+
+	mu      sync.Mutex
+	closed  bool
+	pending sync.WaitGroup
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := c.do(&c.read, func(done *uint32, ov *windows.Overlapped) error {
+		return windows.ReadFile(c.h, b, done, ov)
+	})
+	if err == windows.ERROR_BROKEN_PIPE || err == windows.ERROR_PIPE_NOT_CONNECTED {
+		return n, io.EOF
+	}
+	return n, c.opError("read", err)
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := c.do(&c.write, func(done *uint32, ov *windows.Overlapped) error {
+			return windows.WriteFile(c.h, b[written:], done, ov)
+		})
+		written += n
+		if err != nil {
+			if err == windows.ERROR_NO_DATA || err == windows.ERROR_BROKEN_PIPE {
+				err = io.ErrClosedPipe
+			}
+			return written, c.opError("write", err)
+		}
+	}
+	return written, nil
+}
+
+// do runs an overlapped read or write and waits for it. The operation is
+// cancelled when its deadline passes or the connection closes.
+func (c *pipeConn) do(d *pipeDeadline, op func(done *uint32, ov *windows.Overlapped) error) (int, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+	c.pending.Add(1)
+	c.mu.Unlock()
+	defer c.pending.Done()
+
+	ov, err := newOverlapped()
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(ov.HEvent)
+
+	if !d.start(c.h, ov) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	var n uint32
+	err = op(&n, ov)
+	if err == windows.ERROR_IO_PENDING {
+		// The deadline may have passed, or the connection closed, before
+		// the operation was issued
+		d.check(c.h)
+		c.mu.Lock()
+		if c.closed {
+			windows.CancelIoEx(c.h, ov)
+		}
+		c.mu.Unlock()
+		err = windows.GetOverlappedResult(c.h, ov, &n, true)
+	}
+	expired := d.finish()
+
+	if err == windows.ERROR_OPERATION_ABORTED {
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		switch {
+		case closed:
+			err = net.ErrClosed
+		case expired:
+			err = os.ErrDeadlineExceeded
+		}
+	}
+	return int(n), err
+}
+
+func (c *pipeConn) opError(op string, err error) error {
+	if err == nil || err == io.EOF || err == net.ErrClosed {
+		return err
+	}
+	return &net.OpError{Op: op, Net: "pipe", Source: c.addr, Addr: c.addr, Err: err}
+}
+
+// Close disconnects the client and ends pending reads and writes
+func (c *pipeConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.read.set(c.h, time.Time{})
+	c.write.set(c.h, time.Time{})
+	windows.CancelIoEx(c.h, nil)
+	c.pending.Wait()
+	return windows.CloseHandle(c.h)
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.read.set(c.h, t)
+	c.write.set(c.h, t)
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.read.set(c.h, t)
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.write.set(c.h, t)
+	return nil
+}
+
+// pipeDeadline is the deadline of the reads or the writes of a pipeConn.
+// It cancels the pending operation when it passes, as net/http expects when
+// it moves a read deadline into the past to stop a background read.
+type pipeDeadline struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	gen     int
+	expired bool
+	pending *windows.Overlapped
+}
+
+// set moves the deadline to t; a zero t means no deadline
+func (d *pipeDeadline) set(h windows.Handle, t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.gen++
+	d.expired = false
+	if t.IsZero() {
+		return
+	}
+
+	wait := time.Until(t)
+	if wait <= 0 {
+		d.expire(h)
+		return
+	}
+	gen := d.gen
+	d.timer = time.AfterFunc(wait, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.gen == gen {
+			d.expire(h)
+		}
+	})
+}
+
+// expire cancels the pending operation. The caller must hold d.mu.
+func (d *pipeDeadline) expire(h windows.Handle) {
+	d.expired = true
+	if d.pending != nil {
+		windows.CancelIoEx(h, d.pending)
+	}
+}
+
+// start records ov as the pending operation, unless the deadline passed
+func (d *pipeDeadline) start(h windows.Handle, ov *windows.Overlapped) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.expired {
+		return false
+	}
+	d.pending = ov
+	return true
+}
+
+// check cancels the pending operation if the deadline passed while it was
+// being issued
+func (d *pipeDeadline) check(h windows.Handle) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.expired && d.pending != nil {
+		windows.CancelIoEx(h, d.pending)
+	}
+}
+
+// finish clears the pending operation and reports whether the deadline
+// passed
+func (d *pipeDeadline) finish() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending = nil
+	return d.expired
+}
+
+// newOverlapped returns an overlapped structure with a manual reset event
+func newOverlapped() (*windows.Overlapped, error) {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &windows.Overlapped{HEvent: event}, nil
+}
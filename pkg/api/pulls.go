@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"forgeai/pkg/container"
+	"forgeai/pkg/offline"
+)
+
+// maxPullEvents is how many progress events an environment pull keeps
+const maxPullEvents = 200
+
+// Pull states of environments
+const (
+	pullPulling = "pulling"
+	pullDone    = "done"
+	pullFailed  = "failed"
+)
+
+// pullEvent is a progress event of an environment pull
+type pullEvent struct {
+	Seq     int       `json:"seq"`
+	At      time.Time `json:"at"`
+	Layers  int       `json:"layers"`
+	Done    int       `json:"done"`
+	Percent int       `json:"percent"`
+	Status  string    `json:"status"`
+}
+
+// environmentPull is the pull of the image of a language environment
+type environmentPull struct {
+	Language   string      `json:"language"`
+	Image      string      `json:"image"`
+	State      string      `json:"state"`
+	Layers     int         `json:"layers"`
+	Done       int         `json:"done"`
+	Percent    int         `json:"percent"`
+	Error      string      `json:"error,omitempty"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	Events     []pullEvent `json:"events"`
+
+	// seq numbers the events, also the ones no longer kept
+	seq int
+}
+
+// pullTracker tracks environment pulls, the latest one per language
+type pullTracker struct {
+	mu    sync.Mutex
+	pulls map[string]*environmentPull
+}
+
+// start starts pulling the image of language unless a pull of it is in
+// progress, and returns the pull and whether it started
+func (t *pullTracker) start(language, image string, d *container.DockerExecutor) (environmentPull, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p, ok := t.pulls[language]; ok && p.State == pullPulling {
+		return p.snapshot(0), false
+	}
+
+	p := &environmentPull{
+		Language:  language,
+		Image:     image,
+		State:     pullPulling,
+		StartedAt: time.Now(),
+	}
+	if t.pulls == nil {
+		t.pulls = make(map[string]*environmentPull)
+	}
+	t.pulls[language] = p
+
+	// The pull outlives the request that started it
+	go func() {
+		err := d.PullImage(context.Background(), image, func(progress container.PullProgress) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			p.record(progress)
+		})
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		now := time.Now()
+		p.FinishedAt = &now
+		if err != nil {
+			p.State, p.Error = pullFailed, err.Error()
+			return
+		}
+		p.State, p.Percent = pullDone, 100
+	}()
+	return p.snapshot(0), true
+}
+
+// get returns the latest pull of language with the events after seq
+func (t *pullTracker) get(language string, since int) (environmentPull, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.pulls[language]
+	if !ok {
+		return environmentPull{}, false
+	}
+	return p.snapshot(since), true
+}
+
+// record adds a progress event to the pull
+func (p *environmentPull) record(progress container.PullProgress) {
+	p.seq++
+	p.Layers, p.Done, p.Percent = progress.Layers, progress.Done, progress.Percent()
+	p.Events = append(p.Events, pullEvent{
+		Seq:     p.seq,
+		At:      time.Now(),
+		Layers:  progress.Layers,
+		Done:    progress.Done,
+		Percent: progress.Percent(),
+		Status:  progress.Status,
+	})
+	if len(p.Events) > maxPullEvents {
+		p.Events = p.Events[len(p.Events)-maxPullEvents:]
+	}
+}
+
+// snapshot copies the pull with the events after seq
+func (p *environmentPull) snapshot(since int) environmentPull {
+	c := *p
+	c.Events = []pullEvent{}
+	for _, e := range p.Events {
+		if e.Seq > since {
+			c.Events = append(c.Events, e)
+		}
+	}
+	return c
+}
+
+// handlePullEnvironment handles pulling the image of a language environment
+// in the background; its progress is polled with handlePullStatus
+func (s *Server) handlePullEnvironment(c Context) {
+	language := c.Param("language")
+	dockerExec := s.dockerExecutor()
+
+	if _, ok := container.DefaultImages[language]; !ok {
+		c.JSON(http.StatusNotFound, H{"error": "environment not found"})
+		return
+	}
+
+	image := dockerExec.ImageForLanguage(language)
+	if err := offline.Check("pulling image " + image); err != nil {
+		c.JSON(http.StatusNotImplemented, H{"error": err.Error()})
+		return
+	}
+	pull, started := s.pulls.start(language, image, dockerExec)
+	if started {
+		s.audit(c, "environment.pull", language, nil, H{"image": image}, nil)
+	}
+	c.JSON(http.StatusAccepted, pull)
+}
+
+// handlePullStatus handles reporting the progress of the latest pull of a
+// language environment. Clients polling it pass the seq of the last event
+// they saw as since to receive only newer events.
+func (s *Server) handlePullStatus(c Context) {
+	since := 0
+	if param := c.Query("since"); param != "" {
+		var err error
+		if since, err = strconv.Atoi(param); err != nil || since < 0 {
+			respondInvalid(c, fieldError("since", "min", "since must be a non-negative number", param, 0))
+			return
+		}
+	}
+
+	pull, ok := s.pulls.get(c.Param("language"), since)
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "no pull of this environment"})
+		return
+	}
+	c.JSON(http.StatusOK, pull)
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/quota"
+	"forgeai/pkg/volumes"
+)
+
+// quotaKey returns the key a request's usage is counted against: the
+// tenant of its caller, as the Tenant hook names it, or else its principal
+// or remote address. Tenant labels are set by callers, so they never choose
+// the key; a label naming another tenant than the caller's is an error.
+func (s *Server) quotaKey(c Context, req *ExecuteRequest) (string, error) {
+	if hook := s.config.Hooks.Tenant; hook != nil {
+		if tenant := hook(c.Request()); tenant != "" {
+			if label := req.Labels[volumes.DefaultTenantLabel]; label != "" && label != tenant {
+				return "", errTenantMismatch
+			}
+			return "tenant:" + tenant, nil
+		}
+	}
+	if principal := s.principal(c); principal != "" {
+		return "user:" + principal, nil
+	}
+	if addr := c.Request().RemoteAddr; addr != "" && addr != "@" {
+		// Every connection comes from another port of the same host
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+		return "user:" + addr, nil
+	}
+	return "user:anonymous", nil
+}
+
+// checkQuota checks that the key of a request has not used up its CPU time
+// or artifact storage and reserves an execution for it, which releaseQuota
+// returns unless the request creates a job. It responds and returns false
+// when the request is over quota: 429 Too Many Requests for windows shorter
+// than a day and 402 Payment Required for longer ones.
+func (s *Server) checkQuota(c Context, req *ExecuteRequest) bool {
+	quotas := s.config.Quotas
+	if quotas == nil {
+		return true
+	}
+
+	key, err := s.quotaKey(c, req)
+	if err != nil {
+		c.JSON(http.StatusForbidden, H{"error": err.Error()})
+		return false
+	}
+	req.quotaKey = key
+	for _, metric := range []string{quota.Executions, quota.CPUSeconds, quota.ArtifactBytes} {
+		var err error
+		if metric == quota.Executions {
+			err = quotas.Reserve(req.quotaKey, metric, 1)
+			req.reserved = err == nil
+		} else {
+			err = quotas.Check(req.quotaKey, metric, 0)
+		}
+		var exceeded *quota.ExceededError
+		if !errors.As(err, &exceeded) {
+			continue
+		}
+		s.releaseQuota(req)
+
+		status := http.StatusTooManyRequests
+		if exceeded.Usage.Limit.Window >= 24*time.Hour {
+			status = http.StatusPaymentRequired
+		}
+		retryAfter := int(time.Until(exceeded.RetryAt).Seconds() + 1)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.Header("X-Quota-Limit", strconv.FormatFloat(exceeded.Usage.Limit.Limit, 'f', -1, 64))
+		c.Header("X-Quota-Remaining", strconv.FormatFloat(exceeded.Usage.Remaining, 'f', -1, 64))
+		c.Header("X-Quota-Reset", strconv.FormatInt(exceeded.RetryAt.Unix(), 10))
+		c.JSON(status, H{
+			"error":    err.Error(),
+			"key":      exceeded.Key,
+			"quota":    exceeded.Usage,
+			"retry_at": exceeded.RetryAt,
+		})
+		return false
+	}
+	return true
+}
+
+// releaseQuota returns the execution reserved for a request that created
+// no job
+func (s *Server) releaseQuota(req *ExecuteRequest) {
+	if !req.reserved {
+		return
+	}
+	req.reserved = false
+	s.config.Quotas.Release(req.quotaKey, quota.Executions, 1)
+}
+
+// useQuota keeps the execution reserved for a request that created a job,
+// and counts the job's CPU time and artifacts against the quotas of its key
+// once it finishes. CPU time is the user and system time of profiled jobs
+// and the duration of others.
+func (s *Server) useQuota(req *ExecuteRequest, job *jobs.Job) {
+	req.reserved = false
+	quotas := s.config.Quotas
+	if quotas == nil || req.quotaKey == "" {
+		return
+	}
+	key := req.quotaKey
+
+	go func() {
+		job, err := s.jobManager.Wait(context.Background(), job.ID)
+		if err != nil || job.Result == nil {
+			return
+		}
+		cpu := job.Result.Duration.Seconds()
+		if p := job.Result.Profile; p != nil && p.UserTime+p.SystemTime > 0 {
+			cpu = p.UserTime + p.SystemTime
+		}
+		quotas.Use(key, quota.CPUSeconds, cpu)
+
+		var artifacts int64
+		for i := range job.Result.Artifacts {
+			artifacts += job.Result.Artifacts[i].Len()
+		}
+		quotas.Use(key, quota.ArtifactBytes, float64(artifacts))
+	}()
+}
+
+// requireQuotas responds and returns false when quotas are not enabled
+func (s *Server) requireQuotas(c Context) bool {
+	if s.config.Quotas == nil {
+		c.JSON(http.StatusNotImplemented, H{"error": "quotas are not enabled on this server"})
+		return false
+	}
+	return true
+}
+
+// handleListQuotas lists the default limits and the keys with usage or
+// overrides
+func (s *Server) handleListQuotas(c Context) {
+	if !s.requireQuotas(c) {
+		return
+	}
+	c.JSON(http.StatusOK, H{
+		"defaults":  s.config.Quotas.Limits,
+		"overrides": s.config.Quotas.Overrides(),
+		"keys":      s.config.Quotas.Keys(),
+	})
+}
+
+// handleGetQuota reports the limits and usage of a key
+func (s *Server) handleGetQuota(c Context) {
+	if !s.requireQuotas(c) {
+		return
+	}
+	key := c.Param("key")
+	limits, overridden := s.config.Quotas.LimitsOf(key)
+	c.JSON(http.StatusOK, H{
+		"key":        key,
+		"limits":     limits,
+		"overridden": overridden,
+		"usage":      s.config.Quotas.Usage(key),
+	})
+}
+
+// handlePutQuota overrides the limits of a key
+func (s *Server) handlePutQuota(c Context) {
+	if !s.requireQuotas(c) {
+		return
+	}
+	var req struct {
+		Limits []quota.Limit `json:"limits"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	key := c.Param("key")
+	before, overridden := s.config.Quotas.LimitsOf(key)
+	if !overridden {
+		before = nil
+	}
+	if err := s.config.Quotas.Override(key, req.Limits); err != nil {
+		s.audit(c, "quota.override", key, before, nil, err)
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+	s.audit(c, "quota.override", key, before, req.Limits, nil)
+
+	c.JSON(http.StatusOK, H{
+		"key":        key,
+		"limits":     req.Limits,
+		"overridden": true,
+		"usage":      s.config.Quotas.Usage(key),
+	})
+}
+
+// handleDeleteQuota returns a key to the default limits
+func (s *Server) handleDeleteQuota(c Context) {
+	if !s.requireQuotas(c) {
+		return
+	}
+	key := c.Param("key")
+	before, _ := s.config.Quotas.LimitsOf(key)
+	removed, err := s.config.Quotas.RemoveOverride(key)
+	if err != nil {
+		s.audit(c, "quota.remove_override", key, before, nil, err)
+		c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, H{"error": "key has no quota override"})
+		return
+	}
+	s.audit(c, "quota.remove_override", key, before, s.config.Quotas.Limits, nil)
+
+	c.JSON(http.StatusOK, H{
+		"key":     key,
+		"message": "quota override removed",
+	})
+}
+
+// handleResetQuota forgets the usage of a key
+func (s *Server) handleResetQuota(c Context) {
+	if !s.requireQuotas(c) {
+		return
+	}
+	key := c.Param("key")
+	before := s.config.Quotas.Usage(key)
+	s.config.Quotas.Reset(key)
+	s.audit(c, "quota.reset", key, before, nil, nil)
+
+	c.JSON(http.StatusOK, H{
+		"key":   key,
+		"usage": s.config.Quotas.Usage(key),
+	})
+}
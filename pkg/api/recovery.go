@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"forgeai/pkg/jobs"
+)
+
+// heartbeat records that the jobs of this replica are alive until ctx is
+// done
+func (s *Server) heartbeat(ctx context.Context) {
+	interval := s.config.HeartbeatInterval
+	if interval <= 0 {
+		interval = jobs.DefaultHeartbeatInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.jobManager.Heartbeat(now)
+		}
+	}
+}
+
+// recoverJobs recovers the jobs of replicas that stopped heartbeating until
+// ctx is done. Jobs queued again run on this replica and outlive ctx, which
+// ends when another replica takes over.
+func (s *Server) recoverJobs(ctx context.Context) {
+	interval := s.config.HeartbeatInterval
+	if interval <= 0 {
+		interval = jobs.DefaultHeartbeatInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, job := range s.jobManager.RecoverInterrupted(context.Background(), time.Now()) {
+			interruption := job.Interruptions[len(job.Interruptions)-1]
+			fmt.Printf("Recovered job %s from worker %s: %s\n", job.ID, interruption.Worker, interruption.Reason)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimSessionJobs runs the session jobs that other replicas handed to this
+// replica until ctx is done. Claimed jobs outlive ctx, like recovered ones.
+func (s *Server) claimSessionJobs(ctx context.Context) {
+	ticker := time.NewTicker(jobs.SessionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.jobManager.ClaimSessionJobs(context.Background())
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"forgeai/pkg/container"
+	"forgeai/pkg/jobs"
+)
+
+// Validate checks settings before they are applied
+func (s Settings) Validate() error {
+	if err := s.Rlimits.Validate(); err != nil {
+		return fmt.Errorf("invalid resource limits: %w", err)
+	}
+	if err := s.Output.Validate(); err != nil {
+		return fmt.Errorf("invalid output limits: %w", err)
+	}
+	if err := s.Locale.Validate(); err != nil {
+		return fmt.Errorf("invalid locale: %w", err)
+	}
+	if s.Platform != "" {
+		if err := container.ValidatePlatform(s.Platform); err != nil {
+			return fmt.Errorf("invalid image platform: %w", err)
+		}
+	}
+	if err := s.Security.Validate(); err != nil {
+		return fmt.Errorf("invalid security profiles: %w", err)
+	}
+	if _, err := container.NormalizeCapabilities(s.CapAdd); err != nil {
+		return fmt.Errorf("invalid capabilities: %w", err)
+	}
+	return nil
+}
+
+// Reload atomically replaces the settings of the server and of jobs created
+// from now on, and returns the new configuration generation. Jobs that
+// already exist keep the settings they were created with. Invalid settings
+// are refused and leave the current ones in place.
+func (s *Server) Reload(settings Settings) (int64, error) {
+	before := s.currentSettings()
+	if err := settings.Validate(); err != nil {
+		s.auditSystem("config.reload", before, settings, err)
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.settings = settings
+	s.reloadedAt = time.Now()
+	generation := s.jobManager.Reconfigure(jobs.Settings{
+		Rlimits:      settings.Rlimits,
+		Locale:       settings.Locale,
+		Output:       settings.Output,
+		InlineOutput: settings.InlineOutput,
+		LogRetention: settings.LogRetention,
+	})
+	s.mu.Unlock()
+
+	s.auditSystem("config.reload", before, settings, nil)
+	return generation, nil
+}
+
+// ReloadedAt returns when the settings were last reloaded, or the zero time
+func (s *Server) ReloadedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.reloadedAt
+}
+
+// currentSettings returns the settings in effect
+func (s *Server) currentSettings() Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// H is a shortcut for JSON objects
+type H map[string]interface{}
+
+// Context gives handlers access to the request and response independently
+// of the router in use
+type Context interface {
+	// Request returns the underlying HTTP request
+	Request() *http.Request
+
+	// Param returns a path parameter; *wildcard values keep their leading slash
+	Param(name string) string
+
+	Query(name string) string
+	DefaultQuery(name, def string) string
+	QueryArray(name string) []string
+	GetHeader(name string) string
+
+	// Header sets a response header
+	Header(name, value string)
+
+	// ShouldBindJSON decodes the body into v and checks binding:"required"
+	// fields
+	ShouldBindJSON(v interface{}) error
+
+	JSON(status int, v interface{})
+	Data(status int, contentType string, data []byte)
+	DataFromReader(status int, size int64, contentType string, r io.Reader, headers map[string]string)
+}
+
+// HandlerFunc handles an API request
+type HandlerFunc func(Context)
+
+// Middleware wraps an http.Handler. Middleware is written against net/http
+// so that it works with every router.
+type Middleware func(http.Handler) http.Handler
+
+// Router registers API routes. Paths use :name parameters and a trailing
+// *name wildcard.
+type Router interface {
+	http.Handler
+
+	// Handle registers a handler for a method and path
+	Handle(method, path string, h HandlerFunc)
+
+	// Group returns a router for routes below prefix that run through mw
+	Group(prefix string, mw ...Middleware) Router
+}
+
+// routerFactories holds the available router implementations by name
+var routerFactories = map[string]func() Router{
+	"std": newStdRouter,
+}
+
+// Routers returns the names of the available routers
+func Routers() []string {
+	names := make([]string, 0, len(routerFactories))
+	for name := range routerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newRouter creates the named router. An empty name selects gin when it is
+// compiled in and the standard library router otherwise.
+func newRouter(name string) (Router, error) {
+	if name == "" {
+		name = "std"
+		if _, ok := routerFactories["gin"]; ok {
+			name = "gin"
+		}
+	}
+
+	factory, ok := routerFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown router %q (available: %v)", name, Routers())
+	}
+	return factory(), nil
+}
+
+// chain applies middleware so that the first one runs outermost
+func chain(h http.Handler, mw []Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// httpContext implements Context on net/http
+type httpContext struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	params func(string) string
+	query  url.Values
+}
+
+func newContext(w http.ResponseWriter, r *http.Request, params func(string) string) *httpContext {
+	return &httpContext{w: w, r: r, params: params}
+}
+
+func (c *httpContext) Request() *http.Request {
+	return c.r
+}
+
+func (c *httpContext) Param(name string) string {
+	return c.params(name)
+}
+
+func (c *httpContext) values() url.Values {
+	if c.query == nil {
+		c.query = c.r.URL.Query()
+	}
+	return c.query
+}
+
+func (c *httpContext) Query(name string) string {
+	return c.values().Get(name)
+}
+
+func (c *httpContext) DefaultQuery(name, def string) string {
+	if values, ok := c.values()[name]; ok && len(values) > 0 {
+		return values[0]
+	}
+	return def
+}
+
+func (c *httpContext) QueryArray(name string) []string {
+	return c.values()[name]
+}
+
+func (c *httpContext) GetHeader(name string) string {
+	return c.r.Header.Get(name)
+}
+
+func (c *httpContext) Header(name, value string) {
+	c.w.Header().Set(name, value)
+}
+
+func (c *httpContext) ShouldBindJSON(v interface{}) error {
+	if c.r.Body == nil {
+		return fmt.Errorf("invalid request")
+	}
+	if err := json.NewDecoder(c.r.Body).Decode(v); err != nil {
+		return err
+	}
+	return validateRequired(v)
+}
+
+func (c *httpContext) JSON(status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(c.w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "application/json; charset=utf-8", data)
+}
+
+func (c *httpContext) Data(status int, contentType string, data []byte) {
+	c.w.Header().Set("Content-Type", contentType)
+	c.w.WriteHeader(status)
+	c.w.Write(data)
+}
+
+func (c *httpContext) DataFromReader(status int, size int64, contentType string, r io.Reader, headers map[string]string) {
+	for name, value := range headers {
+		c.w.Header().Set(name, value)
+	}
+	c.w.Header().Set("Content-Type", contentType)
+	if size >= 0 {
+		c.w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	c.w.WriteHeader(status)
+	io.Copy(c.w, r)
+}
+
+// validateRequired checks the binding:"required" fields of a struct and
+// returns a ValidationError naming every missing field by its JSON name
+func validateRequired(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	invalid := &ValidationError{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.Tag.Get("binding") != "required" || !rv.Field(i).IsZero() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		invalid.Fields = append(invalid.Fields, FieldError{
+			Field:      name,
+			Constraint: "required",
+			Message:    name + " is required",
+		})
+	}
+	if len(invalid.Fields) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// statusWriter records the status code written by a handler
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// loggerMiddleware logs each request
+func loggerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		log.Printf("%3d | %13v | %15s | %-7s %q", sw.status, time.Since(start), r.RemoteAddr, r.Method, r.URL.Path)
+	})
+}
+
+// recoveryMiddleware turns handler panics into 500 responses
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("panic serving %s: %v", r.URL.Path, err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
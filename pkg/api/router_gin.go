@@ -0,0 +1,63 @@
+//go:build !nogin
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	routerFactories["gin"] = newGinRouter
+}
+
+// ginRouter routes requests with gin. Handlers and middleware run on
+// net/http, so gin only matches routes.
+type ginRouter struct {
+	engine     *gin.Engine
+	group      *gin.RouterGroup
+	middleware []Middleware
+}
+
+func newGinRouter() Router {
+	// Set Gin to release mode in production
+	gin.SetMode(gin.ReleaseMode)
+
+	engine := gin.New()
+	engine.Use(gin.Logger())
+	engine.Use(gin.Recovery())
+
+	return &ginRouter{
+		engine: engine,
+		group:  &engine.RouterGroup,
+	}
+}
+
+// Handle registers a handler for a method and path
+func (r *ginRouter) Handle(method, path string, h HandlerFunc) {
+	r.group.Handle(method, path, func(gc *gin.Context) {
+		handler := chain(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			h(newContext(w, req, gc.Param))
+		}), r.middleware)
+		handler.ServeHTTP(gc.Writer, gc.Request)
+	})
+}
+
+// Group returns a router for routes below prefix
+func (r *ginRouter) Group(prefix string, mw ...Middleware) Router {
+	middleware := make([]Middleware, 0, len(r.middleware)+len(mw))
+	middleware = append(middleware, r.middleware...)
+	middleware = append(middleware, mw...)
+
+	return &ginRouter{
+		engine:     r.engine,
+		group:      r.group.Group(prefix),
+		middleware: middleware,
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (r *ginRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.engine.ServeHTTP(w, req)
+}
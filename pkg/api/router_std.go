@@ -0,0 +1,133 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// stdRoute is a route registered on the standard library router
+type stdRoute struct {
+	method   string
+	segments []string
+	handler  http.Handler
+}
+
+// stdRoutes is shared by a router and its groups
+type stdRoutes struct {
+	routes []*stdRoute
+}
+
+// stdRouter routes requests with the standard library only
+type stdRouter struct {
+	table      *stdRoutes
+	prefix     string
+	middleware []Middleware
+}
+
+func newStdRouter() Router {
+	return &stdRouter{
+		table:      &stdRoutes{},
+		middleware: []Middleware{loggerMiddleware, recoveryMiddleware},
+	}
+}
+
+// Handle registers a handler for a method and path
+func (r *stdRouter) Handle(method, path string, h HandlerFunc) {
+	route := &stdRoute{
+		method:   method,
+		segments: splitPath(r.prefix + path),
+	}
+
+	route.handler = chain(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		params := route.match(splitPath(req.URL.Path))
+		h(newContext(w, req, func(name string) string { return params[name] }))
+	}), r.middleware)
+
+	r.table.routes = append(r.table.routes, route)
+}
+
+// Group returns a router for routes below prefix
+func (r *stdRouter) Group(prefix string, mw ...Middleware) Router {
+	middleware := make([]Middleware, 0, len(r.middleware)+len(mw))
+	middleware = append(middleware, r.middleware...)
+	middleware = append(middleware, mw...)
+
+	return &stdRouter{
+		table:      r.table,
+		prefix:     r.prefix + prefix,
+		middleware: middleware,
+	}
+}
+
+// ServeHTTP dispatches to the most specific matching route. Static segments
+// take precedence over parameters, as with gin.
+func (r *stdRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	segments := splitPath(req.URL.Path)
+
+	var best *stdRoute
+	bestScore := -1
+	for _, route := range r.table.routes {
+		if route.method != req.Method || route.match(segments) == nil {
+			continue
+		}
+		if score := route.score(); score > bestScore {
+			best, bestScore = route, score
+		}
+	}
+
+	if best == nil {
+		chain(http.NotFoundHandler(), r.middleware).ServeHTTP(w, req)
+		return
+	}
+	best.handler.ServeHTTP(w, req)
+}
+
+// match returns the path parameters when the segments match the route, or
+// nil otherwise
+func (route *stdRoute) match(segments []string) map[string]string {
+	params := make(map[string]string)
+
+	for i, pattern := range route.segments {
+		if strings.HasPrefix(pattern, "*") {
+			params[pattern[1:]] = "/" + strings.Join(segments[i:], "/")
+			return params
+		}
+		if i >= len(segments) {
+			return nil
+		}
+		switch {
+		case strings.HasPrefix(pattern, ":"):
+			params[pattern[1:]] = segments[i]
+		case pattern != segments[i]:
+			return nil
+		}
+	}
+
+	if len(segments) != len(route.segments) {
+		return nil
+	}
+	return params
+}
+
+// score ranks routes by specificity
+func (route *stdRoute) score() int {
+	score := 0
+	for _, pattern := range route.segments {
+		switch {
+		case strings.HasPrefix(pattern, "*"):
+		case strings.HasPrefix(pattern, ":"):
+			score++
+		default:
+			score += 2
+		}
+	}
+	return score
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+
+	"forgeai/pkg/autoscale"
+)
+
+// scalingPolicy returns the policy that recommends replicas, the
+// autoscaler's when it has one
+func (s *Server) scalingPolicy() autoscale.Policy {
+	if s.config.Autoscaler != nil {
+		return s.config.Autoscaler.Policy
+	}
+	return s.config.Scaling
+}
+
+// handleGetScaling reports the load on the workers and the replicas it
+// needs, for external autoscalers
+func (s *Server) handleGetScaling(c Context) {
+	policy := s.scalingPolicy()
+	resp := H{
+		"recommendation": policy.Recommend(s.jobManager.Load()),
+		"policy":         policy.WithDefaults(),
+	}
+	if s.config.Autoscaler != nil {
+		resp["autoscaler"] = s.config.Autoscaler.Status()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// writeScalingMetrics writes the gauges that autoscalers scale the
+// replicas on
+func (s *Server) writeScalingMetrics(w *metricsWriter) {
+	rec := s.scalingPolicy().Recommend(s.jobManager.Load())
+
+	w.gauge("forgeai_jobs_pending", "Number of jobs waiting for a worker.")
+	w.sample("forgeai_jobs_pending", float64(rec.Load.Pending))
+
+	w.gauge("forgeai_jobs_running", "Number of jobs running.")
+	w.sample("forgeai_jobs_running", float64(rec.Load.Running))
+
+	w.gauge("forgeai_worker_capacity", "Number of jobs that can run at once.")
+	w.sample("forgeai_worker_capacity", float64(rec.Load.Capacity))
+
+	w.gauge("forgeai_worker_utilization", "Share of the worker capacity in use.")
+	w.sample("forgeai_worker_utilization", rec.Load.Utilization)
+
+	w.gauge("forgeai_job_typical_duration_seconds", "Median duration of recently finished jobs.")
+	w.sample("forgeai_job_typical_duration_seconds", rec.Load.TypicalDuration.Seconds())
+
+	w.gauge("forgeai_expected_wait_seconds", "Expected wait of a job submitted now.")
+	w.sample("forgeai_expected_wait_seconds", rec.Load.ExpectedWait.Seconds())
+
+	w.gauge("forgeai_desired_workers", "Number of workers the load needs.")
+	w.sample("forgeai_desired_workers", float64(rec.Workers))
+
+	w.gauge("forgeai_desired_replicas", "Number of replicas the load needs.")
+	w.sample("forgeai_desired_replicas", float64(rec.Replicas))
+}
@@ -2,51 +2,442 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/gin-gonic/gin"
+	"forgeai/pkg/apikeys"
+	"forgeai/pkg/attestation"
+	"forgeai/pkg/audit"
+	"forgeai/pkg/authz"
+	"forgeai/pkg/autoscale"
+	"forgeai/pkg/container"
+	"forgeai/pkg/corpus"
+	"forgeai/pkg/events"
+	"forgeai/pkg/fixtures"
+	"forgeai/pkg/hardware"
+	"forgeai/pkg/images"
+	"forgeai/pkg/joblog"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/languages"
+	"forgeai/pkg/leader"
+	"forgeai/pkg/notify"
+	"forgeai/pkg/plugin"
+	"forgeai/pkg/quota"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sbom"
+	"forgeai/pkg/security"
+	"forgeai/pkg/sinks"
+	"forgeai/pkg/storage"
+	"forgeai/pkg/templates"
+	"forgeai/pkg/tokens"
+	"forgeai/pkg/volumes"
+	"forgeai/pkg/watchdog"
+	"forgeai/pkg/workspace"
 )
 
+// Version is the API server version
+const Version = "1.0.0"
+
+// MaxWait bounds the wait parameter of job retrieval
+const MaxWait = 60 * time.Second
+
+// DefaultSocketMode lets the owner and group use the Unix socket
+const DefaultSocketMode os.FileMode = 0660
+
+// DefaultPipeSecurity lets the owner of the named pipe, administrators, and
+// the system use it
+const DefaultPipeSecurity = "D:P(A;;GA;;;OW)(A;;GA;;;BA)(A;;GA;;;SY)"
+
+// IsPipePath reports whether a socket path names a Windows named pipe
+func IsPipePath(path string) bool {
+	return strings.HasPrefix(path, `\\.\pipe\`)
+}
+
+// DefaultSyncBudget is how long /v1/execute/sync waits for a job by default
+const DefaultSyncBudget = 10 * time.Second
+
+// MaxSyncTimeout is the largest timeout, in seconds, accepted for synchronous
+// execution
+const MaxSyncTimeout = 60
+
 // Config holds the API server configuration
 type Config struct {
 	Host string
 	Port int
+
+	// Settings are the initial values of the settings that can be reloaded
+	Settings
+
+	// PluginDir is the directory of installed plugins
+	PluginDir string
+
+	// SigningKeyPath is the ed25519 key used to sign execution manifests.
+	// An ephemeral key is generated when empty.
+	SigningKeyPath string
+
+	// JobLogPath is the tamper-evident job log file; empty disables it
+	JobLogPath string
+
+	// Storage holds job artifacts and logs; they are kept in memory when nil
+	Storage storage.Backend
+
+	// Socket is a Unix socket path, or a Windows named pipe such as
+	// \\.\pipe\forgeai, to listen on instead of Host and Port
+	Socket string
+
+	// SocketMode sets the socket file permissions; DefaultSocketMode when
+	// zero
+	SocketMode os.FileMode
+
+	// PipeSecurity is the SDDL security descriptor of a named pipe, which
+	// has no file permissions; DefaultPipeSecurity when empty
+	PipeSecurity string
+
+	// Notifier receives alerts about job failure rates and sandbox escape
+	// indicators; nil disables notifications
+	Notifier *notify.Notifier
+
+	// FailureRate decides when the job failure rate is alerted on; the
+	// notify defaults are used when nil
+	FailureRate *notify.FailureRateMonitor
+
+	// Events emits job lifecycle events as CloudEvents; nil disables them
+	Events *events.Emitter
+
+	// Workspaces provides job working directories; temp directories are used
+	// when nil
+	Workspaces *workspace.Manager
+
+	// Fixtures stores the datasets that jobs mount read-only; nil disables
+	// the fixtures API
+	Fixtures *fixtures.Store
+
+	// Volumes holds the persistent volumes of tenants; nil disables them
+	Volumes *volumes.Manager
+
+	// Sinks holds the buckets that jobs may push their results to; nil
+	// disables output sinks
+	Sinks *sinks.Registry
+
+	// HashCodeOnly drops the code of finished jobs, keeping only its hash
+	HashCodeOnly bool
+
+	// Classifications are the policies of data classifications, and
+	// DefaultClassification the classification of jobs that declare none.
+	// The isolation classes of classifications are set in Isolation.
+	Classifications       map[string]jobs.ClassificationPolicy
+	DefaultClassification string
+
+	// Audit records admin actions, such as policy changes and admin calls;
+	// nil disables the audit trail. ActorHeader names the request header
+	// that identifies the actor when Hooks.Actor does not.
+	Audit       *audit.Trail
+	ActorHeader string
+
+	// Directory holds the users and groups that Settings.Authz grants
+	// access to, synced over SCIM with SCIMToken as the bearer token; SCIM
+	// is disabled without either
+	Directory *authz.Directory
+	SCIMToken string
+
+	// AdminToken is a bearer token that authorizes requests to the admin
+	// API, and Admins the principals, such as the subjects of API keys,
+	// that may make them with their own credentials. The admin API refuses
+	// every request without either.
+	AdminToken string
+	Admins     []string
+
+	// Quotas meters the executions, CPU time, and artifact storage of each
+	// tenant or user; nil disables quotas
+	Quotas *quota.Manager
+
+	// TokenMaxTTL is the longest lifetime of execution tokens;
+	// tokens.MaxTTL when zero
+	TokenMaxTTL time.Duration
+
+	// Watchdog sheds load when the host is overloaded; nil disables it
+	Watchdog *watchdog.Watchdog
+
+	// Hardware reports the hardware class of this worker with every job;
+	// nil disables it
+	Hardware *hardware.Probe
+
+	// Scaling recommends the replicas that the load needs, which
+	// /v1/scaling and /metrics report for external autoscalers
+	Scaling autoscale.Policy
+
+	// Autoscaler, when set, applies the recommendations of its policy
+	// itself. With several replicas only the leader scales.
+	Autoscaler *autoscale.Controller
+
+	// Reaper removes containers and workspaces left behind by crashed
+	// processes; nil disables it
+	Reaper *container.Reaper
+
+	// SelfTest periodically runs security tests against the job executor;
+	// nil disables it
+	SelfTest *security.SelfTester
+
+	// Permissive runs jobs even when the backend cannot enforce the memory
+	// limit, network isolation, or read-only file system they request. The
+	// server is strict by default.
+	Permissive bool
+
+	// DedupWindow, when positive, coalesces identical /v1/execute requests
+	// made within the window into one shared job
+	DedupWindow time.Duration
+
+	// Docker is the daemon that the reaper and image environments use
+	Docker container.Daemon
+
+	// Leader, when set, elects the replica that prunes job logs, so that
+	// replicas sharing a job store do not conflict. Its Run is started with
+	// the server.
+	Leader *leader.Elector
+
+	// Corpus decides which jobs /v1/corpus/export may export and how they
+	// are redacted
+	Corpus corpus.Policy
+
+	// Isolation routes the jobs of each language to an isolation class,
+	// such as gVisor containers for untrusted shells, and limits how many
+	// run at once
+	Isolation Isolation
+
+	// Hooks let embedding applications authorize, limit, or transform job
+	// requests
+	Hooks Hooks
+
+	// Router selects the HTTP router: gin or std. Gin is used when empty
+	// unless the server was built with the nogin tag.
+	Router string
+
+	// JobStore, Queue, Executors, and Clock replace the in-memory job
+	// store, goroutine dispatch, local executors, and wall clock of jobs
+	// when set, for alternative backends and tests
+	JobStore  jobs.Store
+	Queue     jobs.Queue
+	Executors jobs.ExecutorFactory
+	Clock     jobs.Clock
+
+	// SessionStore replaces the in-memory sessions of jobs; replicas that
+	// share a JobStore must share it too
+	SessionStore jobs.SessionStore
+
+	// Worker identifies this replica on the jobs it runs. Running jobs
+	// heartbeat every HeartbeatInterval; with a JobStore the replicas
+	// share, jobs of a replica that stops heartbeating are recovered,
+	// and run again under Retry. Sessions are forgotten SessionTTL after
+	// their last job.
+	Worker            string
+	HeartbeatInterval time.Duration
+	SessionTTL        time.Duration
+	Retry             jobs.RetryPolicy
+}
+
+// Settings are the parts of the configuration that can be reloaded while
+// the server runs, see Reload
+type Settings struct {
+	// InlineOutput is how many bytes of output job results include;
+	// jobs.DefaultInlineOutput when zero and unlimited when negative
+	InlineOutput int
+
+	// LogRetention is how long job logs are kept; forever when zero
+	LogRetention time.Duration
+
+	// SyncBudget is how long /v1/execute/sync waits before falling back to
+	// returning a job ID; DefaultSyncBudget when zero
+	SyncBudget time.Duration
+
+	// Rlimits are the default resource limits of jobs; zero limits use
+	// sandbox.DefaultRlimits
+	Rlimits sandbox.Rlimits
+
+	// Output bounds the output of jobs held in memory; zero limits use
+	// sandbox.DefaultOutputLimits
+	Output sandbox.OutputLimits
+
+	// Locale is the default time zone and locale of jobs; empty fields use
+	// sandbox.DefaultLocale
+	Locale sandbox.Locale
+
+	// Images, ArchImages, and Platform select the container images of
+	// language environments, as on container.DockerExecutor
+	Images     map[string]string
+	ArchImages map[string]map[string]string
+	Platform   string
+
+	// Security selects the seccomp and AppArmor profiles of containers,
+	// and CapAdd the capabilities they keep
+	Security container.SecurityProfiles
+	CapAdd   []string
+
+	// Authz grants the groups of Config.Directory access to languages,
+	// network access, and limits; requests are not authorized when it
+	// grants nothing
+	Authz authz.Policy
 }
 
 // Server represents the API server
 type Server struct {
 	config     *Config
-	router     *gin.Engine
+	router     Router
 	httpServer *http.Server
-	jobManager *JobManager
+	jobManager *jobs.Manager
+	images     *images.Service
+	sboms      *sbom.Store
+	storage    storage.Backend
+	templates  *templates.Store
+	tokens     *tokens.Store
+	apiKeys    *apikeys.Store
+	pulls      pullTracker
+
+	// managed holds the policies and environments of the admin API
+	managed managed
+
+	// responses counts the bytes of compressed responses
+	responses storage.CompressionStats
+
+	// mu guards settings and reloadedAt, which Reload replaces
+	mu         sync.RWMutex
+	settings   Settings
+	reloadedAt time.Time
 }
 
 // NewServer creates a new API server
 func NewServer(config *Config) *Server {
-	// Set Gin to release mode in production
-	gin.SetMode(gin.ReleaseMode)
-	
 	// Create the router
-	router := gin.New()
-	
-	// Add middleware
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
-	
+	router, err := newRouter(config.Router)
+	if err != nil {
+		fmt.Printf("Warning: %v, using the default router\n", err)
+		router, _ = newRouter("")
+	}
+
 	// Create the HTTP server
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf("%s:%d", config.Host, config.Port),
 		Handler: router,
 	}
-	
-	return &Server{
+
+	jobManager := jobs.NewManager()
+	jobManager.Version = Version
+	jobManager.Signer = newSigner(config.SigningKeyPath)
+	if config.JobLogPath != "" {
+		log, err := joblog.Open(config.JobLogPath)
+		if err != nil {
+			fmt.Printf("Warning: job log disabled: %v\n", err)
+		} else {
+			jobManager.Log = log
+		}
+	}
+	jobManager.Storage = config.Storage
+	jobManager.Workspaces = config.Workspaces
+	jobManager.Volumes = config.Volumes
+	jobManager.Sinks = config.Sinks
+	jobManager.HashCodeOnly = config.HashCodeOnly
+	jobManager.Classifications = config.Classifications
+	jobManager.DefaultClassification = config.DefaultClassification
+	jobManager.InlineOutput = config.InlineOutput
+	jobManager.LogRetention = config.LogRetention
+	jobManager.Strict = !config.Permissive
+	jobManager.DedupWindow = config.DedupWindow
+	jobManager.Hardware = config.Hardware
+	jobManager.Worker = config.Worker
+	jobManager.HeartbeatInterval = config.HeartbeatInterval
+	jobManager.SessionTTL = config.SessionTTL
+	jobManager.Retry = config.Retry
+	jobManager.Rlimits = config.Rlimits.WithDefaults(sandbox.DefaultRlimits())
+	jobManager.Locale = config.Locale.WithDefaults(sandbox.DefaultLocale())
+	jobManager.Output = config.Output
+	if config.JobStore != nil {
+		jobManager.Store = config.JobStore
+	}
+	if config.SessionStore != nil {
+		jobManager.Sessions = config.SessionStore
+	}
+	if config.Queue != nil {
+		jobManager.Queue = config.Queue
+	}
+	if config.Executors != nil {
+		jobManager.Executors = config.Executors
+	}
+	if config.Clock != nil {
+		jobManager.Clock = config.Clock
+	}
+	jobManager.LanguageWorkers = config.Isolation.Concurrency
+
+	s := &Server{
 		config:     config,
 		router:     router,
 		httpServer: httpServer,
-		jobManager: NewJobManager(),
+		jobManager: jobManager,
+		images:     newImageService(),
+		sboms:      sbom.NewStore(),
+		storage:    config.Storage,
+		templates:  templates.NewStore(),
+		tokens:     &tokens.Store{MaxTTL: config.TokenMaxTTL},
+		apiKeys:    &apikeys.Store{},
+		settings:   config.Settings,
+	}
+
+	// Run languages in their isolation classes
+	if config.Isolation.Routed() {
+		classes, err := s.classRouter(jobManager.Executors)
+		if err != nil {
+			fmt.Printf("Warning: %v, running every job as a local process\n", err)
+		} else {
+			jobManager.Executors = classes
+		}
+	}
+
+	// Resume the jobs spilled before a restart
+	if spill, ok := config.Queue.(*jobs.SpillQueue); ok {
+		n, err := spill.Recover(jobManager)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else if n > 0 {
+			fmt.Printf("Recovered %d spilled jobs\n", n)
+		}
+	}
+
+	return s
+}
+
+// newSigner loads the manifest signing key, falling back to an ephemeral key
+func newSigner(path string) *attestation.Signer {
+	if path != "" {
+		signer, err := attestation.LoadOrCreateSigner(path)
+		if err == nil {
+			return signer
+		}
+		fmt.Printf("Warning: failed to load signing key %s: %v\n", path, err)
+	}
+
+	signer, err := attestation.NewEphemeralSigner()
+	if err != nil {
+		fmt.Printf("Warning: execution manifests will not be signed: %v\n", err)
+		return nil
 	}
+	return signer
+}
+
+// newImageService creates the image scanning service used by the
+// environments API
+func newImageService() *images.Service {
+	scanner, _ := images.NewScanner("trivy")
+	return images.NewService(scanner, images.DefaultPolicy(), "")
 }
 
 // Config returns the server configuration
@@ -58,15 +449,122 @@ func (s *Server) Config() *Config {
 func (s *Server) Start(ctx context.Context) error {
 	// Register routes
 	s.registerRoutes()
-	
+
+	// Derive request contexts from ctx so handlers stop when it is cancelled
+	s.httpServer.BaseContext = func(net.Listener) context.Context {
+		return ctx
+	}
+
+	// Alert on finished jobs
+	if s.config.Notifier != nil {
+		go s.watchJobs(ctx)
+	}
+
+	// Emit job lifecycle events
+	if s.config.Events != nil {
+		go s.config.Events.Run(ctx, s.jobManager)
+	}
+
+	// Protect the host from aggregate job load
+	if s.config.Watchdog != nil {
+		go s.config.Watchdog.Run(ctx, s.jobManager)
+	}
+
+	// Remove job logs past their retention, which a reload may set, and
+	// recover the jobs of failed replicas. With several replicas only the
+	// leader prunes and recovers.
+	go s.heartbeat(ctx)
+	go s.claimSessionJobs(ctx)
+	if s.config.Leader != nil {
+		go s.config.Leader.Run(ctx)
+		go s.config.Leader.Lead(ctx, s.pruneLogs)
+		go s.config.Leader.Lead(ctx, s.recoverJobs)
+	} else {
+		go s.pruneLogs(ctx)
+		go s.recoverJobs(ctx)
+	}
+
+	// Scale the replicas to the load
+	if s.config.Autoscaler != nil {
+		scale := func(ctx context.Context) { s.config.Autoscaler.Run(ctx, s.jobManager) }
+		if s.config.Leader != nil {
+			go s.config.Leader.Lead(ctx, scale)
+		} else {
+			go scale(ctx)
+		}
+	}
+
+	// Clean up after crashed processes
+	if s.config.Reaper != nil {
+		go s.config.Reaper.Run(ctx)
+	}
+
+	// Check containment of the live backend
+	if s.config.SelfTest != nil {
+		if s.config.Notifier != nil && s.config.SelfTest.OnRegression == nil {
+			s.config.SelfTest.OnRegression = s.notifySelfTest
+		}
+		go s.config.SelfTest.Run(ctx, s.jobManager.Executor())
+	}
+
+	listener, err := s.listen()
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
 	// Start the server
-	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
-	
+
 	return nil
 }
 
+// listen opens the configured Unix socket or named pipe, or the TCP
+// address otherwise
+func (s *Server) listen() (net.Listener, error) {
+	path := s.config.Socket
+	if path == "" {
+		return net.Listen("tcp", s.httpServer.Addr)
+	}
+
+	if IsPipePath(path) {
+		return listenPipe(path, s.config.PipeSecurity)
+	}
+
+	// Remove a stale socket left behind by a previous run
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := s.config.SocketMode
+	if mode == 0 {
+		mode = DefaultSocketMode
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	return listener, nil
+}
+
+// Address describes where the server listens
+func (s *Server) Address() string {
+	if IsPipePath(s.config.Socket) {
+		return s.config.Socket
+	}
+	if s.config.Socket != "" {
+		return "unix:" + s.config.Socket
+	}
+	return s.httpServer.Addr
+}
+
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
 	return s.httpServer.Shutdown(ctx)
@@ -74,118 +572,352 @@ func (s *Server) Shutdown(ctx context.Context) error {
 
 // registerRoutes sets up the API routes
 func (s *Server) registerRoutes() {
+	// Compress responses for clients that accept it
+	root := s.router.Group("", compressionMiddleware(&s.responses))
+
 	// Root endpoint
-	s.router.GET("/", s.handleRoot)
-	
+	root.Handle(http.MethodGet, "/", s.handleRoot)
+
 	// Health check endpoints
-	s.router.GET("/healthz", s.handleHealthCheck)
-	s.router.GET("/readyz", s.handleReadinessCheck)
-	
-	// API v1 routes
-	v1 := s.router.Group("/v1")
-	{
-		v1.GET("/languages", s.handleListLanguages)
-		v1.POST("/execute", s.handleExecuteCode)
-		v1.POST("/execute/file", s.handleExecuteFile)
-		v1.GET("/jobs/:id", s.handleGetJob)
-		v1.DELETE("/jobs/:id", s.handleCancelJob)
-		v1.GET("/jobs", s.handleListJobs)
-		v1.GET("/status", s.handleGetStatus)
-	}
+	root.Handle(http.MethodGet, "/healthz", s.handleHealthCheck)
+	root.Handle(http.MethodGet, "/readyz", s.handleReadinessCheck)
+	root.Handle(http.MethodGet, "/metrics", s.handleMetrics)
+
+	// API v1 routes. v1 is superseded by v2 and points clients to it.
+	v1 := root.Group("/v1", deprecationMiddleware("v2"))
+	s.registerAPIRoutes(v1)
+
+	// API v2 routes share the v1 handlers, with responses mapped to envelopes
+	v2 := root.Group("/v2", envelopeMiddleware("v2"))
+	s.registerAPIRoutes(v2)
+
+	// SCIM routes through which identity providers sync users and groups
+	scim := root.Group("/scim/v2", s.scimAuthMiddleware())
+	s.registerSCIMRoutes(scim)
+}
+
+// registerAPIRoutes registers the versioned API routes on a group
+func (s *Server) registerAPIRoutes(g Router) {
+	g.Handle(http.MethodGet, "/languages", s.handleListLanguages)
+	g.Handle(http.MethodPost, "/execute", s.handleExecuteCode)
+	g.Handle(http.MethodPost, "/execute/sync", s.handleExecuteSync)
+	g.Handle(http.MethodPost, "/execute/file", s.handleExecuteFile)
+	g.Handle(http.MethodPost, "/execute/diff", s.handleExecuteDiff)
+	g.Handle(http.MethodPost, "/estimate", s.handleEstimate)
+	g.Handle(http.MethodPost, "/lint", s.handleLint)
+	g.Handle(http.MethodPost, "/format", s.handleFormat)
+	g.Handle(http.MethodPost, "/inspect", s.handleInspect)
+	g.Handle(http.MethodGet, "/jobs/:id", s.handleGetJob)
+	g.Handle(http.MethodDelete, "/jobs/:id", s.handleCancelJob)
+	g.Handle(http.MethodGet, "/jobs/:id/logs", s.handleGetJobLogs)
+	g.Handle(http.MethodGet, "/jobs/:id/artifacts/:name", s.handleGetArtifact)
+	g.Handle(http.MethodGet, "/jobs/:id/manifest", s.handleGetManifest)
+	g.Handle(http.MethodGet, "/jobs/:id/children", s.handleGetJobChildren)
+	g.Handle(http.MethodGet, "/manifest/key", s.handleGetManifestKey)
+	g.Handle(http.MethodGet, "/jobs", s.handleListJobs)
+	g.Handle(http.MethodGet, "/status", s.handleGetStatus)
+	g.Handle(http.MethodGet, "/scaling", s.handleGetScaling)
+	g.Handle(http.MethodGet, "/analytics", s.handleGetAnalytics)
+	g.Handle(http.MethodGet, "/analytics/report", s.handleGetAnalyticsReport)
+	g.Handle(http.MethodGet, "/corpus/export", s.handleExportCorpus)
+	g.Handle(http.MethodGet, "/capabilities", s.handleGetCapabilities)
+	g.Handle(http.MethodGet, "/security/posture", s.handleGetSecurityPosture)
+	g.Handle(http.MethodGet, "/security/selftest", s.handleGetSelfTest)
+	g.Handle(http.MethodGet, "/environments", s.handleListEnvironments)
+	g.Handle(http.MethodGet, "/environments/:language", s.handleGetEnvironment)
+	g.Handle(http.MethodPut, "/environments/:language", s.handlePutEnvironment)
+	g.Handle(http.MethodDelete, "/environments/:language", s.handleDeleteEnvironment)
+	g.Handle(http.MethodPost, "/environments/:language/scan", s.handleScanEnvironment)
+	g.Handle(http.MethodPost, "/environments/:language/pull", s.handlePullEnvironment)
+	g.Handle(http.MethodGet, "/environments/:language/pull", s.handlePullStatus)
+	g.Handle(http.MethodGet, "/sbom", s.handleListSBOMs)
+	g.Handle(http.MethodGet, "/sbom/components", s.handleSearchSBOMComponents)
+	g.Handle(http.MethodGet, "/sbom/:kind/*subject", s.handleGetSBOM)
+	g.Handle(http.MethodGet, "/quarantine", s.handleListQuarantine)
+	g.Handle(http.MethodPost, "/quarantine", s.handleAddQuarantine)
+	g.Handle(http.MethodDelete, "/quarantine/:hash", s.handleRemoveQuarantine)
+	g.Handle(http.MethodGet, "/fixtures", s.handleListFixtures)
+	g.Handle(http.MethodGet, "/fixtures/:name", s.handleGetFixture)
+	g.Handle(http.MethodPut, "/fixtures/:name", s.handlePutFixture)
+	g.Handle(http.MethodDelete, "/fixtures/:name", s.handleDeleteFixture)
+	g.Handle(http.MethodGet, "/tenants/:tenant/volumes", s.handleListVolumes)
+	g.Handle(http.MethodGet, "/tenants/:tenant/volumes/:name", s.handleGetVolume)
+	g.Handle(http.MethodDelete, "/tenants/:tenant/volumes/:name", s.handleDeleteVolume)
+	g.Handle(http.MethodGet, "/sessions/:id", s.handleGetSession)
+	g.Handle(http.MethodDelete, "/sessions/:id", s.handleEndSession)
+	g.Handle(http.MethodGet, "/templates", s.handleListTemplates)
+	g.Handle(http.MethodPost, "/templates", s.handleCreateTemplate)
+	g.Handle(http.MethodGet, "/templates/:name", s.handleGetTemplate)
+	g.Handle(http.MethodPut, "/templates/:name", s.handlePutTemplate)
+	g.Handle(http.MethodDelete, "/templates/:name", s.handleDeleteTemplate)
+	g.Handle(http.MethodPost, "/templates/:name/execute", s.handleExecuteTemplate)
+	g.Handle(http.MethodPost, "/tokens", s.handleCreateToken)
+	g.Handle(http.MethodGet, "/tokens/current", s.handleGetCurrentToken)
+	g.Handle(http.MethodDelete, "/tokens/:id", s.handleRevokeToken)
+
+	// Admin routes are only served to admins
+	admin := g.Group("/admin", s.adminAuthMiddleware())
+	admin.Handle(http.MethodGet, "/maintenance", s.handleGetMaintenance)
+	admin.Handle(http.MethodPost, "/maintenance", s.handleEnterMaintenance)
+	admin.Handle(http.MethodDelete, "/maintenance", s.handleExitMaintenance)
+	admin.Handle(http.MethodPost, "/encryption/rotate", s.handleRotateEncryption)
+	admin.Handle(http.MethodPost, "/backfill", s.handleBackfill)
+	admin.Handle(http.MethodGet, "/state", s.handleExportState)
+	admin.Handle(http.MethodPost, "/state", s.handleImportState)
+	admin.Handle(http.MethodGet, "/hardware", s.handleGetHardware)
+	admin.Handle(http.MethodPost, "/hardware/calibrate", s.handleCalibrateHardware)
+	admin.Handle(http.MethodGet, "/audit", s.handleListAudit)
+	admin.Handle(http.MethodGet, "/authz/users/:user", s.handleGetAccess)
+	admin.Handle(http.MethodGet, "/policies", s.handleListPolicies)
+	admin.Handle(http.MethodGet, "/policies/:group", s.handleGetPolicy)
+	admin.Handle(http.MethodPut, "/policies/:group", s.handlePutPolicy)
+	admin.Handle(http.MethodDelete, "/policies/:group", s.handleDeletePolicy)
+	admin.Handle(http.MethodGet, "/apikeys", s.handleListAPIKeys)
+	admin.Handle(http.MethodGet, "/apikeys/:id", s.handleGetAPIKey)
+	admin.Handle(http.MethodPut, "/apikeys/:id", s.handlePutAPIKey)
+	admin.Handle(http.MethodDelete, "/apikeys/:id", s.handleDeleteAPIKey)
+	admin.Handle(http.MethodPost, "/apikeys/:id/rotate", s.handleRotateAPIKey)
+	admin.Handle(http.MethodGet, "/quotas", s.handleListQuotas)
+	admin.Handle(http.MethodGet, "/quotas/:key", s.handleGetQuota)
+	admin.Handle(http.MethodPut, "/quotas/:key", s.handlePutQuota)
+	admin.Handle(http.MethodDelete, "/quotas/:key", s.handleDeleteQuota)
+	admin.Handle(http.MethodPost, "/quotas/:key/reset", s.handleResetQuota)
 }
 
 // handleRoot handles the root endpoint
-func (s *Server) handleRoot(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"message": "ForgeAI API Server",
-		"version": "1.0.0",
-		"docs":    "/v1/docs",
+func (s *Server) handleRoot(c Context) {
+	c.JSON(http.StatusOK, H{
+		"message":      "ForgeAI API Server",
+		"version":      Version,
+		"api_versions": APIVersions,
+		"docs":         "/v1/docs",
 	})
 }
 
 // handleHealthCheck handles the health check endpoint
-func (s *Server) handleHealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+func (s *Server) handleHealthCheck(c Context) {
+	c.JSON(http.StatusOK, H{
 		"status": "healthy",
 		"time":   time.Now().UTC(),
 	})
 }
 
 // handleReadinessCheck handles the readiness check endpoint
-func (s *Server) handleReadinessCheck(c *gin.Context) {
-	// In a real implementation, this would check if all dependencies are ready
-	c.JSON(http.StatusOK, gin.H{
+func (s *Server) handleReadinessCheck(c Context) {
+	// Not ready in maintenance mode, so load balancers stop sending jobs
+	if m := s.jobManager.Maintenance(); m.Enabled {
+		c.JSON(http.StatusServiceUnavailable, H{
+			"status":      "maintenance",
+			"reason":      m.Reason,
+			"maintenance": m,
+			"time":        time.Now().UTC(),
+		})
+		return
+	}
+
+	// Not ready while the watchdog has paused intake
+	if reason, paused := s.jobManager.Paused(); paused {
+		resp := H{
+			"status": "overloaded",
+			"reason": reason,
+			"time":   time.Now().UTC(),
+		}
+		if s.config.Watchdog != nil {
+			resp["watchdog"] = s.config.Watchdog.Status()
+		}
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, H{
 		"status": "ready",
 		"time":   time.Now().UTC(),
 	})
 }
 
+// acceptingJobs responds with 503 and returns false while job intake is
+// paused or the server is in maintenance mode
+func (s *Server) acceptingJobs(c Context) bool {
+	reason, paused := s.jobManager.Paused()
+	if !paused {
+		return true
+	}
+
+	c.Header("Retry-After", "30")
+	if s.jobManager.Maintenance().Enabled {
+		c.JSON(http.StatusServiceUnavailable, H{
+			"error":  "server is in maintenance mode",
+			"reason": reason,
+		})
+		return false
+	}
+	c.JSON(http.StatusServiceUnavailable, H{
+		"error":  "job intake is paused",
+		"reason": reason,
+	})
+	return false
+}
+
+// requireIsolation responds 422 Unprocessable Entity and returns false when
+// the server is strict and the backend of a language cannot enforce req
+func (s *Server) requireIsolation(c Context, language string, req sandbox.Requirements) bool {
+	err := s.jobManager.CheckRequirements(language, req)
+	if err == nil {
+		return true
+	}
+
+	var unenforceable *jobs.UnenforceableError
+	if !errors.As(err, &unenforceable) {
+		c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, H{
+		"error":   jobs.ErrUnenforceable.Error(),
+		"backend": unenforceable.Backend,
+		"unmet":   unenforceable.Unmet,
+	})
+	return false
+}
+
+// isolationRequirements returns the isolation guarantees a job request asks
+// for explicitly
+func isolationRequirements(memoryLimit int, networkAccess *bool, readOnlyFS bool) sandbox.Requirements {
+	return sandbox.Requirements{
+		MemoryLimit:        memoryLimit > 0,
+		NetworkIsolation:   networkAccess != nil && !*networkAccess,
+		ReadOnlyFilesystem: readOnlyFS,
+	}
+}
+
 // handleListLanguages handles listing supported languages
-func (s *Server) handleListLanguages(c *gin.Context) {
-	// In a real implementation, this would get languages from the executor
-	languages := []string{"python", "go", "javascript", "hello"} // Include plugin languages
-	
-	c.JSON(http.StatusOK, gin.H{
-		"languages":  languages,
-		"timestamp":  time.Now().UTC(),
+func (s *Server) handleListLanguages(c Context) {
+	c.JSON(http.StatusOK, H{
+		"languages": s.jobManager.Languages(),
+		"aliases":   languages.Aliases(),
+		"timestamp": time.Now().UTC(),
 	})
 }
 
-// handleExecuteCode handles code execution
-func (s *Server) handleExecuteCode(c *gin.Context) {
-	// Parse the request
-	var req struct {
-		Language      string `json:"language" binding:"required"`
-		Code          string `json:"code" binding:"required"`
-		Timeout       int    `json:"timeout"`
-		MemoryLimit   int    `json:"memory_limit"`
-		NetworkAccess bool   `json:"network_access"`
+// executeCodeRequest is the request of /v1/execute
+type executeCodeRequest struct {
+	Language       string            `json:"language" binding:"required"`
+	Code           string            `json:"code" binding:"required"`
+	Timeout        int               `json:"timeout"`
+	MemoryLimit    int               `json:"memory_limit"`
+	NetworkAccess  *bool             `json:"network_access"`
+	ReadOnlyFS     bool              `json:"read_only_fs"`
+	Trace          bool              `json:"trace"`
+	TrackWorkspace bool              `json:"track_workspace"`
+	InlineFiles    int64             `json:"inline_files"`
+	Profile        bool              `json:"profile"`
+	Flamegraph     bool              `json:"flamegraph"`
+	Coverage       bool              `json:"coverage"`
+	Rlimits        sandbox.Rlimits   `json:"rlimits"`
+	Timezone       string            `json:"timezone"`
+	Locale         string            `json:"locale"`
+	MapTracebacks  bool              `json:"map_tracebacks"`
+	Fixtures       []string          `json:"fixtures"`
+	Volume         string            `json:"volume"`
+	Session        string            `json:"session"`
+	OutputSink     string            `json:"output_sink"`
+	Classification string            `json:"classification"`
+	Labels         map[string]string `json:"labels"`
+	ParentID       string            `json:"parent_id"`
+
+	// FilePath is only bound to reject it, since files run through
+	// /execute/file
+	FilePath string `json:"file_path,omitempty"`
+}
+
+// handleExecuteCode handles code execution. With sync=true the request
+// blocks until the job finishes.
+func (s *Server) handleExecuteCode(c Context) {
+	var budget time.Duration
+	if c.Query("sync") == "true" {
+		budget = MaxWait
 	}
-	
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	s.executeCode(c, budget)
+}
+
+// handleExecuteSync handles code execution that returns the result directly
+// when the job finishes within the budget, and a job ID otherwise
+func (s *Server) handleExecuteSync(c Context) {
+	budget := s.currentSettings().SyncBudget
+	if budget <= 0 {
+		budget = DefaultSyncBudget
 	}
-	
-	// Set default values
-	if req.Timeout == 0 {
-		req.Timeout = 30
+	if param := c.Query("budget"); param != "" {
+		d, err := time.ParseDuration(param)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, H{"error": "budget must be a duration such as 5s"})
+			return
+		}
+		budget = d
 	}
-	if req.MemoryLimit == 0 {
-		req.MemoryLimit = 128
+	if budget > MaxWait {
+		budget = MaxWait
 	}
-	
-	// Create a job
-	job := s.jobManager.CreateJob(req.Language, req.Code)
-	job.Timeout = req.Timeout
-	job.MemoryLimit = req.MemoryLimit
-	job.NetworkAccess = req.NetworkAccess
-	
-	// Execute the job in a goroutine
-	go s.jobManager.ExecuteJob(job)
-	
-	// Return the job ID
-	c.JSON(http.StatusCreated, gin.H{
-		"job_id": job.ID,
-		"status": job.Status,
-	})
+
+	s.executeCode(c, budget)
 }
 
-// handleExecuteFile handles file execution
-func (s *Server) handleExecuteFile(c *gin.Context) {
+// executeCode creates and starts a code job. When budget is positive the
+// response waits up to budget for the job to finish.
+func (s *Server) executeCode(c Context, budget time.Duration) {
 	// Parse the request
-	var req struct {
-		FilePath      string `json:"file_path" binding:"required"`
-		Timeout       int    `json:"timeout"`
-		MemoryLimit   int    `json:"memory_limit"`
-		NetworkAccess bool   `json:"network_access"`
+	var req executeCodeRequest
+
+	err := c.ShouldBindJSON(&req)
+	if req.FilePath != "" {
+		err = withFieldError(err, fieldError("file_path", "excluded_with",
+			"code and file_path are mutually exclusive; run files with POST /execute/file", req.FilePath, nil))
 	}
-	
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	if !s.checkLanguage(c, "language", &req.Language) {
+		return
+	}
+
+	if err := jobs.ValidateLabels(req.Labels); err != nil {
+		respondInvalid(c, fieldError("labels", "format", err.Error(), nil, nil))
+		return
+	}
+
+	if req.Session != "" {
+		if err := jobs.ValidateSession(req.Session); err != nil {
+			respondInvalid(c, fieldError("session", "format", err.Error(), req.Session, nil))
+			return
+		}
+	}
+
+	if err := req.Rlimits.Validate(); err != nil {
+		respondInvalid(c, fieldError("rlimits", "max", err.Error(), req.Rlimits, sandbox.MaxRlimits))
+		return
+	}
+
+	locale, ok := s.checkLocale(c, req.Timezone, req.Locale)
+	if !ok {
+		return
+	}
+
+	mounts, ok := s.resolveFixtures(c, req.Fixtures)
+	if !ok {
 		return
 	}
-	
+
+	if req.ParentID != "" {
+		if _, ok := s.jobManager.GetJob(req.ParentID); !ok {
+			c.JSON(http.StatusBadRequest, H{"error": "parent job not found"})
+			return
+		}
+	}
+
+	// Check the requested isolation before defaults are applied
+	require := isolationRequirements(req.MemoryLimit, req.NetworkAccess, req.ReadOnlyFS)
+
 	// Set default values
 	if req.Timeout == 0 {
 		req.Timeout = 30
@@ -193,119 +925,1134 @@ func (s *Server) handleExecuteFile(c *gin.Context) {
 	if req.MemoryLimit == 0 {
 		req.MemoryLimit = 128
 	}
-	
-	// Create a job
-	job := s.jobManager.CreateFileJob(req.FilePath)
-	job.Timeout = req.Timeout
-	job.MemoryLimit = req.MemoryLimit
-	job.NetworkAccess = req.NetworkAccess
-	
-	// Execute the job in a goroutine
-	go s.jobManager.ExecuteJob(job)
-	
-	// Return the job ID
-	c.JSON(http.StatusCreated, gin.H{
-		"job_id": job.ID,
-		"status": job.Status,
-	})
-}
 
-// handleGetJob handles getting job status
-func (s *Server) handleGetJob(c *gin.Context) {
-	jobID := c.Param("id")
-	
-	job, ok := s.jobManager.GetJob(jobID)
+	if c.Query("sync") == "true" && req.Timeout > MaxSyncTimeout {
+		respondInvalid(c, fieldError("timeout", "max",
+			fmt.Sprintf("synchronous execution is limited to a timeout of %d seconds", MaxSyncTimeout), req.Timeout, MaxSyncTimeout))
+		return
+	}
+
+	hookReq := ExecuteRequest{
+		Language:       req.Language,
+		Code:           req.Code,
+		Timeout:        req.Timeout,
+		MemoryLimit:    req.MemoryLimit,
+		NetworkAccess:  req.NetworkAccess != nil && *req.NetworkAccess,
+		Labels:         req.Labels,
+		ParentID:       req.ParentID,
+		Classification: req.Classification,
+		Header:         c.Request().Header,
+	}
+	if !s.acceptingJobs(c) || !s.beforeExecute(c, &hookReq) {
+		return
+	}
+	defer s.release(&hookReq)
+	classification, ok := s.classify(c, hookReq.Classification)
 	if !ok {
-		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
 		return
 	}
-	
-	// Convert job to response format
-	resp := gin.H{
-		"job_id":      job.ID,
-		"status":      job.Status,
-		"language":    job.Language,
-		"timeout":     job.Timeout,
-		"memory_limit": job.MemoryLimit,
-		"network_access": job.NetworkAccess,
-		"created_at":  job.CreatedAt,
-		"started_at":  job.StartedAt,
-		"completed_at": job.CompletedAt,
+	req.Language, req.Code = hookReq.Language, hookReq.Code
+	req.Timeout, req.MemoryLimit = hookReq.Timeout, hookReq.MemoryLimit
+	req.NetworkAccess = &hookReq.NetworkAccess
+	req.Labels, req.ParentID = hookReq.Labels, hookReq.ParentID
+	req.Classification = classification
+
+	if !s.requireIsolation(c, req.Language, require) {
+		return
 	}
-	
-	// Add result if job is completed
-	if job.Status == "completed" && job.Result != nil {
-		resp["stdout"] = job.Result.Stdout
-		resp["stderr"] = job.Result.Stderr
-		resp["exit_code"] = job.Result.ExitCode
-		resp["duration"] = job.Result.Duration.String()
+
+	// Volumes, output sinks and sessions belong to the tenant the hooks
+	// settled on
+	volume, ok := s.resolveVolume(c, req.Volume, req.Labels)
+	if !ok {
+		return
 	}
-	
-	// Add error if job failed
-	if job.Status == "failed" && job.Error != "" {
-		resp["error"] = job.Error
+	sink, ok := s.resolveSink(c, req.OutputSink, req.Labels)
+	if !ok {
+		return
+	}
+	session, ok := s.resolveSession(c, req.Session)
+	if !ok {
+		return
 	}
-	
-	c.JSON(http.StatusOK, resp)
-}
 
-// handleCancelJob handles canceling a job
-func (s *Server) handleCancelJob(c *gin.Context) {
-	jobID := c.Param("id")
-	
-	if s.jobManager.CancelJob(jobID) {
-		c.JSON(http.StatusOK, gin.H{
-			"job_id":   jobID,
-			"status":   "cancelled",
-			"message":  "Job cancelled successfully",
-		})
-	} else {
-		c.JSON(http.StatusNotFound, gin.H{
-			"job_id":   jobID,
-			"status":   "error",
-			"message":  "Job not found or cannot be cancelled",
+	// Reject code that has been quarantined
+	if entry, ok := s.jobManager.IsQuarantined(req.Language, req.Code); ok {
+		c.JSON(http.StatusForbidden, H{
+			"error":     "code is quarantined",
+			"code_hash": entry.CodeHash,
+			"reason":    entry.Reason,
 		})
+		return
 	}
-}
 
-// handleListJobs handles listing jobs
-func (s *Server) handleListJobs(c *gin.Context) {
-	status := c.Query("status")
-	language := c.Query("language")
-	
-	jobs := s.jobManager.ListJobs(status, language)
-	
-	// Convert jobs to response format
-	jobList := make([]gin.H, len(jobs))
-	for i, job := range jobs {
-		jobList[i] = gin.H{
-			"job_id":      job.ID,
-			"status":      job.Status,
-			"language":    job.Language,
-			"created_at":  job.CreatedAt,
-			"started_at":  job.StartedAt,
-			"completed_at": job.CompletedAt,
-		}
-	}
-	
-	c.JSON(http.StatusOK, gin.H{
-		"jobs": jobList,
+	// Create a job, replaying the original one for a known idempotency key
+	var job *jobs.Job
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		body, _ := json.Marshal(req)
+		sum := sha256.Sum256(body)
+
+		var replayed bool
+		var err error
+		job, replayed, err = s.jobManager.CreateJobWithKey(key, hex.EncodeToString(sum[:]), req.Language, req.Code)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, H{"error": err.Error()})
+			return
+		}
+		if replayed {
+			c.Header("Idempotent-Replayed", "true")
+			if budget > 0 {
+				s.respondWithin(c, job, budget)
+				return
+			}
+			c.JSON(http.StatusOK, H{
+				"job_id": job.ID,
+				"status": s.jobStatus(job),
+			})
+			return
+		}
+	} else if volume != nil || req.Session != "" {
+		// Jobs on a volume or in a session depend on its state, so they
+		// are never shared
+		job = s.jobManager.CreateJob(req.Language, req.Code)
+	} else {
+		var coalesced bool
+		job, coalesced = s.jobManager.CreateJobDeduplicated(jobs.Fingerprint(req), req.Language, req.Code)
+		if coalesced {
+			c.Header("Coalesced", "true")
+			if budget > 0 {
+				s.respondWithin(c, job, budget)
+				return
+			}
+			c.JSON(http.StatusOK, H{
+				"job_id": job.ID,
+				"status": s.jobStatus(job),
+			})
+			return
+		}
+	}
+	job.Timeout = req.Timeout
+	job.MemoryLimit = req.MemoryLimit
+	job.NetworkAccess = req.NetworkAccess != nil && *req.NetworkAccess
+	job.Trace = req.Trace
+	job.TrackWorkspace = req.TrackWorkspace
+	job.InlineFiles = req.InlineFiles
+	job.Profile = req.Profile
+	job.Flamegraph = req.Flamegraph
+	job.Coverage = req.Coverage
+	job.Rlimits = req.Rlimits.WithDefaults(job.Rlimits)
+	job.Locale = locale.WithDefaults(job.Locale)
+	job.MapTracebacks = req.MapTracebacks
+	job.Fixtures = mounts
+	job.Volume = volume
+	job.Session = session
+	job.Sink = sink
+	job.Labels = req.Labels
+	job.Classification = classification
+	job.ParentID = req.ParentID
+
+	// Execute the job in the background, on the worker of its session
+	if err := s.jobManager.Dispatch(context.Background(), job); err != nil {
+		status := http.StatusServiceUnavailable
+		if errors.Is(err, jobs.ErrSessionLost) {
+			status = http.StatusGone
+		}
+		c.JSON(status, H{"error": err.Error()})
+		return
+	}
+	s.afterExecute(&hookReq, job)
+
+	// Small jobs return the result directly
+	if budget > 0 {
+		s.respondWithin(c, job, budget)
+		return
+	}
+
+	// Return the job ID
+	c.JSON(http.StatusCreated, H{
+		"job_id": job.ID,
+		"status": s.jobStatus(job),
+	})
+}
+
+// jobStatus returns the status of a dispatched job, which its worker may be
+// changing
+func (s *Server) jobStatus(job *jobs.Job) string {
+	status, _ := s.jobManager.Status(job.ID)
+	return status
+}
+
+// respondWithin waits up to budget for a job and responds with the full job
+// when it finished, or 202 Accepted with the job ID otherwise. The job is
+// cancelled if the client goes away or its X-Request-Timeout passes first,
+// unless other submissions share it.
+func (s *Server) respondWithin(c Context, job *jobs.Job, budget time.Duration) {
+	ctx := c.Request().Context()
+	cancel := func() {
+		if s.jobManager.Coalesced(job.ID) == 0 {
+			s.jobManager.CancelJob(job.ID)
+		}
+	}
+	maxOutput, err := parseMaxOutput(c)
+	if err != nil {
+		cancel()
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+	deadline := false
+	if header := c.GetHeader("X-Request-Timeout"); header != "" {
+		d, err := time.ParseDuration(header)
+		if err != nil || d <= 0 {
+			cancel()
+			c.JSON(http.StatusBadRequest, H{"error": "X-Request-Timeout must be a duration such as 5s"})
+			return
+		}
+		if d <= budget {
+			budget = d
+			deadline = true
+		}
+	}
+
+	job, _ = s.jobManager.WaitJob(ctx, job.ID, budget)
+	if _, finished := s.jobManager.Status(job.ID); finished {
+		c.JSON(finishedStatus(job), jobResponse(job, maxOutput))
+		return
+	}
+
+	// Stop work nobody is waiting for
+	if ctx.Err() != nil {
+		cancel()
+		return
+	}
+	if deadline {
+		cancel()
+		c.JSON(http.StatusGatewayTimeout, H{
+			"error":  "request deadline exceeded",
+			"job_id": job.ID,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, H{
+		"job_id": job.ID,
+		"status": s.jobStatus(job),
+		"url":    "/v1/jobs/" + job.ID,
+	})
+}
+
+// handleExecuteFile handles file execution
+func (s *Server) handleExecuteFile(c Context) {
+	// Parse the request
+	var req struct {
+		FilePath       string            `json:"file_path" binding:"required"`
+		Timeout        int               `json:"timeout"`
+		MemoryLimit    int               `json:"memory_limit"`
+		NetworkAccess  *bool             `json:"network_access"`
+		ReadOnlyFS     bool              `json:"read_only_fs"`
+		Trace          bool              `json:"trace"`
+		TrackWorkspace bool              `json:"track_workspace"`
+		InlineFiles    int64             `json:"inline_files"`
+		Profile        bool              `json:"profile"`
+		Flamegraph     bool              `json:"flamegraph"`
+		Coverage       bool              `json:"coverage"`
+		Rlimits        sandbox.Rlimits   `json:"rlimits"`
+		Timezone       string            `json:"timezone"`
+		Locale         string            `json:"locale"`
+		Fixtures       []string          `json:"fixtures"`
+		Volume         string            `json:"volume"`
+		OutputSink     string            `json:"output_sink"`
+		Classification string            `json:"classification"`
+		Labels         map[string]string `json:"labels"`
+		ParentID       string            `json:"parent_id"`
+
+		// Code is only bound to reject it, since code runs through /execute
+		Code string `json:"code,omitempty"`
+	}
+
+	err := c.ShouldBindJSON(&req)
+	if req.Code != "" {
+		err = withFieldError(err, fieldError("code", "excluded_with",
+			"code and file_path are mutually exclusive; run code with POST /execute", nil, nil))
+	}
+	if err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	if err := jobs.ValidateLabels(req.Labels); err != nil {
+		respondInvalid(c, fieldError("labels", "format", err.Error(), nil, nil))
+		return
+	}
+
+	if err := req.Rlimits.Validate(); err != nil {
+		respondInvalid(c, fieldError("rlimits", "max", err.Error(), req.Rlimits, sandbox.MaxRlimits))
+		return
+	}
+
+	locale, ok := s.checkLocale(c, req.Timezone, req.Locale)
+	if !ok {
+		return
+	}
+
+	mounts, ok := s.resolveFixtures(c, req.Fixtures)
+	if !ok {
+		return
+	}
+
+	if req.ParentID != "" {
+		if _, ok := s.jobManager.GetJob(req.ParentID); !ok {
+			c.JSON(http.StatusBadRequest, H{"error": "parent job not found"})
+			return
+		}
+	}
+
+	// Check the requested isolation before defaults are applied
+	require := isolationRequirements(req.MemoryLimit, req.NetworkAccess, req.ReadOnlyFS)
+
+	// Set default values
+	if req.Timeout == 0 {
+		req.Timeout = 30
+	}
+	if req.MemoryLimit == 0 {
+		req.MemoryLimit = 128
+	}
+
+	hookReq := ExecuteRequest{
+		FilePath:       req.FilePath,
+		Timeout:        req.Timeout,
+		MemoryLimit:    req.MemoryLimit,
+		NetworkAccess:  req.NetworkAccess != nil && *req.NetworkAccess,
+		Labels:         req.Labels,
+		ParentID:       req.ParentID,
+		Classification: req.Classification,
+		Header:         c.Request().Header,
+	}
+	if !s.acceptingJobs(c) || !s.beforeExecute(c, &hookReq) {
+		return
+	}
+	defer s.release(&hookReq)
+	if !s.requireIsolation(c, "", require) {
+		return
+	}
+	classification, ok := s.classify(c, hookReq.Classification)
+	if !ok {
+		return
+	}
+	volume, ok := s.resolveVolume(c, req.Volume, hookReq.Labels)
+	if !ok {
+		return
+	}
+	sink, ok := s.resolveSink(c, req.OutputSink, hookReq.Labels)
+	if !ok {
+		return
+	}
+
+	// Create a job
+	job := s.jobManager.CreateFileJob(hookReq.FilePath)
+	job.Timeout = hookReq.Timeout
+	job.MemoryLimit = hookReq.MemoryLimit
+	job.NetworkAccess = hookReq.NetworkAccess
+	job.Trace = req.Trace
+	job.TrackWorkspace = req.TrackWorkspace
+	job.InlineFiles = req.InlineFiles
+	job.Profile = req.Profile
+	job.Flamegraph = req.Flamegraph
+	job.Coverage = req.Coverage
+	job.Rlimits = req.Rlimits.WithDefaults(job.Rlimits)
+	job.Locale = locale.WithDefaults(job.Locale)
+	job.Fixtures = mounts
+	job.Volume = volume
+	job.Sink = sink
+	job.Labels = hookReq.Labels
+	job.Classification = classification
+	job.ParentID = hookReq.ParentID
+
+	// Execute the job in the background
+	if err := s.jobManager.Dispatch(context.Background(), job); err != nil {
+		c.JSON(http.StatusServiceUnavailable, H{"error": err.Error()})
+		return
+	}
+	s.afterExecute(&hookReq, job)
+
+	// Return the job ID
+	c.JSON(http.StatusCreated, H{
+		"job_id": job.ID,
+		"status": s.jobStatus(job),
+	})
+}
+
+// handleGetJob handles getting job status
+func (s *Server) handleGetJob(c Context) {
+	jobID := c.Param("id")
+
+	job, ok := s.jobManager.GetJob(jobID)
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "job not found"})
+		return
+	}
+
+	maxOutput, err := parseMaxOutput(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	// Long-poll until the job finishes when wait is given
+	if wait := c.Query("wait"); wait != "" {
+		d, err := time.ParseDuration(wait)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, H{"error": "wait must be a duration such as 30s"})
+			return
+		}
+		if d > MaxWait {
+			d = MaxWait
+		}
+		job, _ = s.jobManager.WaitJob(c.Request().Context(), jobID, d)
+	}
+
+	c.JSON(http.StatusOK, jobResponse(job, maxOutput))
+}
+
+// supportsLanguage reports whether exec runs code in language
+func supportsLanguage(exec sandbox.Executor, language string) bool {
+	for _, supported := range exec.SupportedLanguages() {
+		if supported == language {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMaxOutput returns the max_output query parameter, which cuts the
+// output in job responses to that many bytes, or -1 when it is not set
+func parseMaxOutput(c Context) (int, error) {
+	value := c.Query("max_output")
+	if value == "" {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("max_output must be a non-negative number of bytes")
+	}
+	return n, nil
+}
+
+// finishedStatus is the HTTP status of a synchronous response with a
+// finished job. Jobs whose code ran are 200 OK even when the code failed; a
+// job that could not run because of the server is 503 Service Unavailable.
+func finishedStatus(job *jobs.Job) int {
+	if job.Status == "setup_failed" {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// jobResponse converts a job to its detailed response format
+func jobResponse(job *jobs.Job, maxOutput int) H {
+	resp := H{
+		"job_id":         job.ID,
+		"status":         job.Status,
+		"language":       job.Language,
+		"timeout":        job.Timeout,
+		"memory_limit":   job.MemoryLimit,
+		"network_access": job.NetworkAccess,
+		"rlimits":        job.Rlimits,
+		"timezone":       job.Locale.Timezone,
+		"locale":         job.Locale.Name,
+		"classification": job.Classification,
+		"created_at":     job.CreatedAt,
+		"started_at":     job.StartedAt,
+		"completed_at":   job.CompletedAt,
+	}
+	if job.Coalesced > 0 {
+		resp["coalesced"] = job.Coalesced
+	}
+
+	// Add the result if the code ran, whether or not it succeeded. Output
+	// is cut to maxOutput bytes unless it is negative.
+	if job.Result != nil {
+		stdout, truncatedStdout := job.Output(jobs.StreamStdout, maxOutput)
+		stderr, truncatedStderr := job.Output(jobs.StreamStderr, maxOutput)
+		resp["stdout"] = stdout
+		resp["stderr"] = stderr
+		resp["truncated_stdout"] = truncatedStdout
+		resp["truncated_stderr"] = truncatedStderr
+		if job.Result.StdoutEncoding != "" {
+			resp["stdout_encoding"] = job.Result.StdoutEncoding
+		}
+		if job.Result.StderrEncoding != "" {
+			resp["stderr_encoding"] = job.Result.StderrEncoding
+		}
+		resp["exit_code"] = job.Result.ExitCode
+		resp["duration"] = job.Result.Duration.String()
+		if job.Hardware != nil && job.Hardware.Score > 0 {
+			resp["normalized_duration"] = job.Hardware.Normalize(job.Result.Duration).String()
+		}
+		if job.Result.OutputOmitted > 0 {
+			resp["output_omitted"] = job.Result.OutputOmitted
+		}
+
+		if len(job.Logs) > 0 {
+			logs := H{}
+			for _, log := range job.Logs {
+				logs[log.Stream] = H{
+					"size":    log.Size,
+					"expired": log.Expired(),
+					"url":     fmt.Sprintf("/v1/jobs/%s/logs?stream=%s", job.ID, log.Stream),
+				}
+			}
+			resp["logs"] = logs
+		}
+
+		if len(job.Result.Artifacts) > 0 {
+			artifacts := make([]H, len(job.Result.Artifacts))
+			for i, artifact := range job.Result.Artifacts {
+				artifacts[i] = H{
+					"name":         artifact.Name,
+					"content_type": artifact.ContentType,
+					"size":         artifact.Len(),
+					"url":          fmt.Sprintf("/v1/jobs/%s/artifacts/%s", job.ID, artifact.Name),
+				}
+			}
+			resp["artifacts"] = artifacts
+		}
+
+		if job.Result.Workspace != nil {
+			resp["workspace"] = job.Result.Workspace
+		}
+
+		if len(job.Result.Diagnostics) > 0 {
+			resp["diagnostics"] = job.Result.Diagnostics
+		}
+
+		if job.Result.Profile != nil {
+			resp["profile"] = job.Result.Profile
+		}
+
+		if job.Result.Coverage != nil {
+			resp["coverage"] = job.Result.Coverage
+		}
+	}
+
+	// Add error if job failed
+	if (job.Status == "failed" || job.Status == "setup_failed" || job.Status == "interrupted") && job.Error != "" {
+		resp["error"] = job.Error
+	}
+
+	if job.Template != "" {
+		resp["template"] = job.Template
+	}
+	if job.ParentID != "" {
+		resp["parent_id"] = job.ParentID
+	}
+	if len(job.Labels) > 0 {
+		resp["labels"] = job.Labels
+	}
+	if job.Volume != nil {
+		resp["volume"] = job.Volume
+	}
+	if job.Session != "" {
+		resp["session"] = jobs.SessionID(job.Session)
+	}
+	if job.SinkReceipt != nil {
+		resp["output_sink"] = job.SinkReceipt
+	} else if job.Sink != nil {
+		resp["output_sink"] = H{"url": job.Sink.URL}
+	}
+	if job.CodeHash != "" {
+		resp["code_hash"] = job.CodeHash
+	}
+	if job.Threat != nil {
+		resp["threat_score"] = job.Threat.Score
+		resp["threat_findings"] = job.Threat.Findings
+	}
+	if job.Hardware != nil {
+		resp["hardware"] = job.Hardware
+	}
+	if job.Worker != "" {
+		resp["worker"] = job.Worker
+	}
+	if job.Attempts > 0 {
+		resp["attempts"] = job.Attempts
+	}
+	if len(job.Interruptions) > 0 {
+		resp["interruptions"] = job.Interruptions
+	}
+
+	return resp
+}
+
+// handleGetArtifact handles downloading a job artifact
+func (s *Server) handleGetArtifact(c Context) {
+	jobID := c.Param("id")
+
+	job, ok := s.jobManager.GetJob(jobID)
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "job not found"})
+		return
+	}
+
+	if job.Result == nil {
+		c.JSON(http.StatusNotFound, H{"error": "artifact not found"})
+		return
+	}
+
+	artifact, ok := job.Result.Artifact(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "artifact not found"})
+		return
+	}
+
+	if artifact.Key == "" {
+		c.Data(http.StatusOK, artifact.ContentType, artifact.Data)
+		return
+	}
+
+	if s.storage == nil {
+		c.JSON(http.StatusInternalServerError, H{"error": "artifact storage not configured"})
+		return
+	}
+
+	reader, err := s.storage.Get(c.Request().Context(), artifact.Key)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == storage.ErrNotFound {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, H{"error": fmt.Sprintf("failed to read artifact: %v", err)})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, artifact.Size, artifact.ContentType, reader, nil)
+}
+
+// handleGetManifest handles retrieving the signed execution manifest of a job
+func (s *Server) handleGetManifest(c Context) {
+	job, ok := s.jobManager.GetJob(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "job not found"})
+		return
+	}
+
+	if job.Manifest == nil {
+		c.JSON(http.StatusNotFound, H{"error": "manifest not available"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job.Manifest)
+}
+
+// handleGetManifestKey handles retrieving the manifest verification key
+func (s *Server) handleGetManifestKey(c Context) {
+	if s.jobManager.Signer == nil {
+		c.JSON(http.StatusNotFound, H{"error": "manifest signing is disabled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, H{
+		"algorithm":  "ed25519",
+		"key_id":     s.jobManager.Signer.KeyID(),
+		"public_key": s.jobManager.Signer.PublicKey(),
+	})
+}
+
+// handleCancelJob handles canceling a job
+func (s *Server) handleCancelJob(c Context) {
+	jobID := c.Param("id")
+
+	if s.jobManager.CancelJob(jobID) {
+		c.JSON(http.StatusOK, H{
+			"job_id":  jobID,
+			"status":  "cancelled",
+			"message": "Job cancelled successfully",
+		})
+	} else {
+		c.JSON(http.StatusNotFound, H{
+			"job_id":  jobID,
+			"status":  "error",
+			"message": "Job not found or cannot be cancelled",
+		})
+	}
+}
+
+// handleListJobs handles listing jobs
+func (s *Server) handleListJobs(c Context) {
+	filter := jobs.Filter{
+		Status:         c.Query("status"),
+		Language:       c.Query("language"),
+		ParentID:       c.Query("parent_id"),
+		Classification: c.Query("classification"),
+	}
+
+	if minThreat := c.Query("min_threat"); minThreat != "" {
+		score, err := strconv.Atoi(minThreat)
+		if err != nil || score < 0 || score > 100 {
+			c.JSON(http.StatusBadRequest, H{"error": "min_threat must be an integer between 0 and 100"})
+			return
+		}
+		filter.MinThreat = score
+	}
+
+	// Labels are matched with label=key=value, or label=key for presence
+	for _, label := range c.QueryArray("label") {
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		key, value, _ := strings.Cut(label, "=")
+		filter.Labels[key] = value
+	}
+
+	list := s.jobManager.ListJobs(filter)
+
+	// Convert jobs to response format
+	jobList := make([]H, len(list))
+	for i, job := range list {
+		jobList[i] = jobSummary(job)
+	}
+
+	c.JSON(http.StatusOK, H{
+		"jobs":  jobList,
 		"count": len(jobList),
 	})
 }
 
+// jobSummary converts a job to its list response format
+func jobSummary(job *jobs.Job) H {
+	summary := H{
+		"job_id":       job.ID,
+		"status":       job.Status,
+		"language":     job.Language,
+		"created_at":   job.CreatedAt,
+		"started_at":   job.StartedAt,
+		"completed_at": job.CompletedAt,
+	}
+	if job.Threat != nil {
+		summary["threat_score"] = job.Threat.Score
+	}
+	if len(job.Labels) > 0 {
+		summary["labels"] = job.Labels
+	}
+	if job.ParentID != "" {
+		summary["parent_id"] = job.ParentID
+	}
+	return summary
+}
+
+// handleGetJobChildren handles listing the child jobs of a job. With
+// recursive=true the whole subtree is returned, nested under "children".
+func (s *Server) handleGetJobChildren(c Context) {
+	jobID := c.Param("id")
+
+	if _, ok := s.jobManager.GetJob(jobID); !ok {
+		c.JSON(http.StatusNotFound, H{"error": "job not found"})
+		return
+	}
+
+	recursive := c.Query("recursive") == "true"
+	children := s.jobTree(jobID, recursive, make(map[string]bool))
+
+	c.JSON(http.StatusOK, H{
+		"job_id":   jobID,
+		"children": children,
+		"count":    len(children),
+	})
+}
+
+// jobTree returns the summaries of a job's children, descending into
+// grandchildren when recursive. seen guards against parent cycles.
+func (s *Server) jobTree(id string, recursive bool, seen map[string]bool) []H {
+	seen[id] = true
+
+	children := s.jobManager.Children(id)
+	tree := make([]H, 0, len(children))
+	for _, child := range children {
+		summary := jobSummary(child)
+		if recursive && !seen[child.ID] {
+			summary["children"] = s.jobTree(child.ID, true, seen)
+		}
+		tree = append(tree, summary)
+	}
+	return tree
+}
+
 // handleGetStatus handles getting server status
-func (s *Server) handleGetStatus(c *gin.Context) {
+func (s *Server) handleGetStatus(c Context) {
 	// In a real implementation, this would return actual server metrics
-	
-	c.JSON(http.StatusOK, gin.H{
-		"version":        "1.0.0",
-		"uptime":         "2h30m",
-		"jobs_running":   5,
-		"jobs_queued":    2,
-		"cpu_usage":      45.2,
-		"memory_usage":   1024,
-		"disk_usage":     5120,
-		"timestamp":      time.Now().UTC(),
+
+	status := H{
+		"version":      Version,
+		"uptime":       "2h30m",
+		"jobs_running": 5,
+		"jobs_queued":  2,
+		"cpu_usage":    45.2,
+		"memory_usage": 1024,
+		"disk_usage":   5120,
+		"timestamp":    time.Now().UTC(),
+	}
+	if s.config.Workspaces != nil {
+		status["workspaces"] = s.config.Workspaces.Stats()
+	}
+	if s.config.Leader != nil {
+		status["leader"] = s.config.Leader.Status()
+	}
+	if s.config.Hardware != nil {
+		status["hardware"] = hardwareStatus(s.config.Hardware)
+	}
+	if spill, ok := s.config.Queue.(*jobs.SpillQueue); ok {
+		status["queue"] = spill.Stats()
+	}
+	status["config_generation"] = s.jobManager.Generation()
+	if reloadedAt := s.ReloadedAt(); !reloadedAt.IsZero() {
+		status["config_reloaded_at"] = reloadedAt.UTC()
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// handleGetCapabilities reports what the execution backend enforces, for
+// the jobs of the language parameter if given. The require parameter lists
+// guarantees to check, such as require=memory_limit,network_isolation.
+func (s *Server) handleGetCapabilities(c Context) {
+	language := c.Query("language")
+	caps := s.jobManager.LanguageExecutor(language).Capabilities()
+	resp := H{"capabilities": caps}
+	if classes, ok := s.jobManager.Executors.(*jobs.ClassRouter); ok {
+		resp["isolation_class"] = classes.Class(language)
+	}
+
+	if param := c.Query("require"); param != "" {
+		var req sandbox.Requirements
+		for _, name := range strings.Split(param, ",") {
+			switch strings.TrimSpace(name) {
+			case "memory_limit":
+				req.MemoryLimit = true
+			case "network_isolation":
+				req.NetworkIsolation = true
+			case "read_only_filesystem":
+				req.ReadOnlyFilesystem = true
+			case "stdin":
+				req.Stdin = true
+			case "streaming":
+				req.Streaming = true
+			case "artifacts":
+				req.Artifacts = true
+			case "trace":
+				req.Trace = true
+			case "workspace_tracking":
+				req.WorkspaceTracking = true
+			default:
+				c.JSON(http.StatusBadRequest, H{"error": fmt.Sprintf("unknown requirement: %s", name)})
+				return
+			}
+		}
+
+		warnings := caps.Unmet(req)
+		if warnings == nil {
+			warnings = []string{}
+		}
+		resp["satisfied"] = len(warnings) == 0
+		resp["warnings"] = warnings
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleListQuarantine handles listing quarantined code hashes
+func (s *Server) handleListQuarantine(c Context) {
+	entries := s.jobManager.Quarantine.List()
+
+	c.JSON(http.StatusOK, H{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// handleAddQuarantine handles quarantining a code hash manually
+func (s *Server) handleAddQuarantine(c Context) {
+	var req struct {
+		CodeHash string `json:"code_hash" binding:"required"`
+		Reason   string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	if req.Reason == "" {
+		req.Reason = "manually quarantined"
+	}
+
+	var before interface{}
+	if existing, ok := s.jobManager.Quarantine.Get(req.CodeHash); ok {
+		before = existing
+	}
+	s.jobManager.Quarantine.Add(security.QuarantineEntry{
+		CodeHash: req.CodeHash,
+		Reason:   req.Reason,
+	})
+
+	entry, _ := s.jobManager.Quarantine.Get(req.CodeHash)
+	s.audit(c, "quarantine.add", req.CodeHash, before, entry, nil)
+	c.JSON(http.StatusCreated, entry)
+}
+
+// handleRemoveQuarantine handles releasing a code hash from quarantine
+func (s *Server) handleRemoveQuarantine(c Context) {
+	hash := c.Param("hash")
+
+	before, _ := s.jobManager.Quarantine.Get(hash)
+	if !s.jobManager.Quarantine.Remove(hash) {
+		s.audit(c, "quarantine.remove", hash, nil, nil, errors.New("code hash not quarantined"))
+		c.JSON(http.StatusNotFound, H{"error": "code hash not quarantined"})
+		return
+	}
+	s.audit(c, "quarantine.remove", hash, before, nil, nil)
+
+	c.JSON(http.StatusOK, H{
+		"code_hash": hash,
+		"message":   "Code hash released from quarantine",
 	})
-}
\ No newline at end of file
+}
+
+// handleGetSecurityPosture reports the protections in effect for jobs, as
+// probed on the running host
+func (s *Server) handleGetSecurityPosture(c Context) {
+	var plugins []string
+	if s.config.PluginDir != "" {
+		names, err := plugin.NewManager().ListPlugins(s.config.PluginDir)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+			return
+		}
+		plugins = names
+	}
+
+	posture := security.ProbePosture(c.Request().Context(), s.jobManager.Capabilities(), plugins)
+	c.JSON(http.StatusOK, posture)
+}
+
+// handleGetSelfTest returns the result of the last security self-test run
+func (s *Server) handleGetSelfTest(c Context) {
+	if s.config.SelfTest == nil {
+		c.JSON(http.StatusNotFound, H{"error": "security self-tests are not enabled"})
+		return
+	}
+
+	run, ok := s.config.SelfTest.Last()
+	if !ok {
+		c.JSON(http.StatusOK, H{
+			"status":   "pending",
+			"interval": s.config.SelfTest.Interval.String(),
+		})
+		return
+	}
+
+	status := "passing"
+	if run.Failed > 0 {
+		status = "failing"
+	}
+	c.JSON(http.StatusOK, H{
+		"status":   status,
+		"interval": s.config.SelfTest.Interval.String(),
+		"last_run": run,
+	})
+}
+
+// dockerExecutor returns a docker executor with the configured images
+func (s *Server) dockerExecutor() *container.DockerExecutor {
+	dockerExec := container.NewDockerExecutor()
+	dockerExec.Daemon = s.config.Docker
+	settings := s.currentSettings()
+	dockerExec.Images, dockerExec.ArchImages = s.managed.images(settings.Images, settings.ArchImages)
+	dockerExec.Platform = settings.Platform
+	dockerExec.Security = settings.Security
+	dockerExec.CapAdd = settings.CapAdd
+	return dockerExec
+}
+
+// handleListEnvironments handles listing language images and their scan status
+func (s *Server) handleListEnvironments(c Context) {
+	dockerExec := s.dockerExecutor()
+
+	languages := dockerExec.SupportedLanguages()
+	sort.Strings(languages)
+
+	environments := make([]H, 0, len(languages))
+	for _, lang := range languages {
+		environments = append(environments, s.environmentInfo(lang, dockerExec.ImageForLanguage(lang)))
+	}
+
+	c.JSON(http.StatusOK, H{
+		"environments": environments,
+		"count":        len(environments),
+		"platform":     dockerExec.EffectivePlatform(),
+		"emulated":     dockerExec.Emulated(),
+	})
+}
+
+// handleScanEnvironment handles scanning the image of a language environment
+func (s *Server) handleScanEnvironment(c Context) {
+	language := c.Param("language")
+	dockerExec := s.dockerExecutor()
+
+	if _, ok := container.DefaultImages[language]; !ok {
+		c.JSON(http.StatusNotFound, H{"error": "environment not found"})
+		return
+	}
+
+	image := dockerExec.ImageForLanguage(language)
+	if _, err := s.images.Scan(c.Request().Context(), image, c.Query("refresh") == "true"); err != nil {
+		c.JSON(http.StatusBadGateway, H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.environmentInfo(language, image))
+}
+
+// environmentInfo describes a language image and its cached scan result
+func (s *Server) environmentInfo(language, image string) H {
+	info := H{
+		"language": language,
+		"image":    image,
+	}
+
+	if report, ok := s.images.Cached(image); ok {
+		decision := s.images.Policy.Evaluate(report)
+		info["scan"] = H{
+			"scanner":    report.Scanner,
+			"scanned_at": report.ScannedAt,
+			"counts":     report.Counts,
+			"allowed":    decision.Allowed,
+			"violations": decision.Violations,
+		}
+	}
+
+	return info
+}
+
+// handleListSBOMs handles listing the SBOMs of plugins and language images
+func (s *Server) handleListSBOMs(c Context) {
+	var errors []string
+	if c.Query("refresh") == "true" || len(s.sboms.List()) == 0 {
+		errors = s.indexSBOMs(c.Request().Context())
+	}
+
+	docs := s.sboms.List()
+	list := make([]H, len(docs))
+	for i, doc := range docs {
+		list[i] = H{
+			"kind":         doc.Kind,
+			"subject":      doc.Subject,
+			"source":       doc.Source,
+			"components":   len(doc.Components),
+			"generated_at": doc.GeneratedAt,
+			"url":          fmt.Sprintf("/v1/sbom/%s/%s", doc.Kind, doc.Subject),
+		}
+	}
+
+	resp := H{
+		"sboms": list,
+		"count": len(list),
+	}
+	if len(errors) > 0 {
+		resp["errors"] = errors
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handleSearchSBOMComponents handles finding components across all SBOMs
+func (s *Server) handleSearchSBOMComponents(c Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, H{"error": "name query parameter is required"})
+		return
+	}
+
+	if len(s.sboms.List()) == 0 {
+		s.indexSBOMs(c.Request().Context())
+	}
+
+	matches := s.sboms.FindComponent(name)
+	c.JSON(http.StatusOK, H{
+		"matches": matches,
+		"count":   len(matches),
+	})
+}
+
+// handleGetSBOM handles downloading an SBOM in CycloneDX or SPDX format
+func (s *Server) handleGetSBOM(c Context) {
+	kind := c.Param("kind")
+	subject := strings.TrimPrefix(c.Param("subject"), "/")
+
+	doc, ok := s.sboms.Get(kind, subject)
+	if !ok {
+		var err error
+		switch kind {
+		case sbom.KindPlugin:
+			doc, err = sbom.PluginSBOM(c.Request().Context(), filepath.Join(s.config.PluginDir, subject), subject)
+		case sbom.KindImage:
+			doc, err = sbom.ImageSBOM(c.Request().Context(), subject)
+		default:
+			c.JSON(http.StatusBadRequest, H{"error": "kind must be plugin or image"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, H{"error": err.Error()})
+			return
+		}
+		s.sboms.Put(doc)
+	}
+
+	var data []byte
+	var err error
+	switch c.DefaultQuery("format", sbom.FormatCycloneDX) {
+	case sbom.FormatCycloneDX:
+		data, err = doc.CycloneDX()
+	case sbom.FormatSPDX:
+		data, err = doc.SPDX()
+	default:
+		c.JSON(http.StatusBadRequest, H{"error": "format must be cyclonedx or spdx"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// indexSBOMs generates SBOMs for installed plugins and language images
+func (s *Server) indexSBOMs(ctx context.Context) []string {
+	var errors []string
+
+	if s.config.PluginDir != "" {
+		names, err := plugin.NewManager().ListPlugins(s.config.PluginDir)
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
+		for _, name := range names {
+			doc, err := sbom.PluginSBOM(ctx, filepath.Join(s.config.PluginDir, name), name)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("plugin %s: %v", name, err))
+				continue
+			}
+			s.sboms.Put(doc)
+		}
+	}
+
+	dockerExec := s.dockerExecutor()
+	for _, lang := range dockerExec.SupportedLanguages() {
+		image := dockerExec.ImageForLanguage(lang)
+		doc, err := sbom.ImageSBOM(ctx, image)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("image %s: %v", image, err))
+			continue
+		}
+		s.sboms.Put(doc)
+	}
+
+	return errors
+}
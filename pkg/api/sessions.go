@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"forgeai/pkg/authz"
+	"forgeai/pkg/jobs"
+)
+
+// resolveSession returns the key of the session a job asks for, below the
+// tenant of its caller, or responds with an error and returns false when
+// the caller has no tenant
+func (s *Server) resolveSession(c Context, id string) (string, bool) {
+	if id == "" {
+		return "", true
+	}
+	tenant, _ := s.tenant(c, "")
+	if tenant == "" {
+		c.JSON(http.StatusUnauthorized, H{"error": "sessions are only available to callers with a tenant"})
+		return "", false
+	}
+	return jobs.SessionKey(tenant, id), true
+}
+
+// sessionKey returns the key of the session a request names: the caller's
+// session with that ID, or for admins that of the tenant in the tenant
+// query parameter. It responds and returns false when the caller may not
+// access the session.
+func (s *Server) sessionKey(c Context) (string, bool) {
+	id := c.Param("id")
+	if tenant := c.Query("tenant"); tenant != "" {
+		if !s.authorizeTenant(c, tenant) {
+			return "", false
+		}
+		return jobs.SessionKey(tenant, id), true
+	}
+	tenant, _ := s.tenant(c, "")
+	if tenant == "" {
+		c.JSON(http.StatusUnauthorized, H{"error": authz.ErrUnauthenticated.Error()})
+		return "", false
+	}
+	return jobs.SessionKey(tenant, id), true
+}
+
+// handleGetSession handles describing a session and the worker it is bound to
+func (s *Server) handleGetSession(c Context) {
+	key, ok := s.sessionKey(c)
+	if !ok {
+		return
+	}
+	session, ok := s.jobManager.GetSession(key)
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": jobs.ErrSessionNotFound.Error()})
+		return
+	}
+	session.ID = jobs.SessionID(session.ID)
+
+	c.JSON(http.StatusOK, session)
+}
+
+// handleEndSession handles ending a session, so that its ID starts a new
+// session on the replica that runs its next job
+func (s *Server) handleEndSession(c Context) {
+	key, ok := s.sessionKey(c)
+	if !ok {
+		return
+	}
+	before, _ := s.jobManager.GetSession(key)
+	if err := s.jobManager.EndSession(key); err != nil {
+		s.audit(c, "session.end", key, nil, nil, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, jobs.ErrSessionNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, H{"error": err.Error()})
+		return
+	}
+	s.audit(c, "session.end", key, before, nil, nil)
+
+	c.JSON(http.StatusOK, H{
+		"id":      c.Param("id"),
+		"message": "Session ended",
+	})
+}
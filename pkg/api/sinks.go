@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	"forgeai/pkg/sinks"
+)
+
+// resolveSink returns the output sink a job asks for, or responds with an
+// error and returns false when the tenant of its caller may not push there
+func (s *Server) resolveSink(c Context, rawURL string, labels map[string]string) (*sinks.Target, bool) {
+	if rawURL == "" {
+		return nil, true
+	}
+	if s.config.Sinks == nil {
+		c.JSON(http.StatusBadRequest, H{"error": "output sinks are not enabled on this server"})
+		return nil, false
+	}
+	tenant, err := s.tenant(c, s.config.Sinks.Tenant(labels))
+	if err != nil {
+		c.JSON(http.StatusForbidden, H{"error": err.Error()})
+		return nil, false
+	}
+	target, err := s.config.Sinks.Resolve(rawURL, tenant)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return nil, false
+	}
+	return target, true
+}
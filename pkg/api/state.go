@@ -0,0 +1,351 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"forgeai/pkg/apikeys"
+	"forgeai/pkg/authz"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/quota"
+	"forgeai/pkg/security"
+	"forgeai/pkg/state"
+	"forgeai/pkg/templates"
+	"forgeai/pkg/tokens"
+)
+
+// Sections of a state archive
+const (
+	settingsSection     = "settings.json"
+	environmentsSection = "environments.json"
+	tokensSection       = "tokens.json"
+	apiKeysSection      = "apikeys.json"
+	policiesSection     = "policies.json"
+	managedEnvsSection  = "managed_environments.json"
+	directorySection    = "directory.json"
+	quotasSection       = "quotas.json"
+	quarantineSection   = "quarantine.json"
+	templatesSection    = "templates.json"
+	fixturesSection     = "fixtures/"
+	jobsSection         = "jobs.jsonl"
+)
+
+// directorySnapshot is the directory section of a state archive
+type directorySnapshot struct {
+	Users  []authz.User  `json:"users"`
+	Groups []authz.Group `json:"groups"`
+}
+
+// handleExportState streams an archive of the state of the server: its
+// settings, language environments, execution tokens and API keys by hash,
+// the policies and environments of the admin API, directory, quota
+// overrides, quarantine, templates, fixtures, and with ?jobs=true the
+// history of finished jobs
+func (s *Server) handleExportState(c Context) {
+	manifest := state.Manifest{Server: s.config.Worker, Jobs: c.Query("jobs") == "true"}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := s.exportState(pw, manifest)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	c.DataFromReader(http.StatusOK, -1, "application/gzip", pr, map[string]string{
+		"Content-Disposition": `attachment; filename="forgeai-state.tar.gz"`,
+	})
+	// A client that stops reading must not leave the export blocked
+	pr.Close()
+	s.audit(c, "state.export", "", nil, manifest, <-done)
+}
+
+// exportState writes the state archive to w
+func (s *Server) exportState(w io.Writer, manifest state.Manifest) error {
+	archive, err := state.NewWriter(w, manifest)
+	if err != nil {
+		return err
+	}
+
+	if err := archive.WriteJSON(settingsSection, s.currentSettings()); err != nil {
+		return err
+	}
+	dockerExec := s.dockerExecutor()
+	environments := map[string]string{}
+	for _, lang := range dockerExec.SupportedLanguages() {
+		environments[lang] = dockerExec.ImageForLanguage(lang)
+	}
+	if err := archive.WriteJSON(environmentsSection, environments); err != nil {
+		return err
+	}
+	if err := archive.WriteJSON(tokensSection, s.tokens.Export()); err != nil {
+		return err
+	}
+	if err := archive.WriteJSON(apiKeysSection, s.apiKeys.Export()); err != nil {
+		return err
+	}
+	if err := archive.WriteJSON(policiesSection, s.managed.allPolicies()); err != nil {
+		return err
+	}
+	if err := archive.WriteJSON(managedEnvsSection, s.managed.allEnvironments()); err != nil {
+		return err
+	}
+	if dir := s.config.Directory; dir != nil {
+		if err := archive.WriteJSON(directorySection, directorySnapshot{Users: dir.Users(), Groups: dir.Groups()}); err != nil {
+			return err
+		}
+	}
+	if s.config.Quotas != nil {
+		if err := archive.WriteJSON(quotasSection, s.config.Quotas.Overrides()); err != nil {
+			return err
+		}
+	}
+	if q := s.jobManager.Quarantine; q != nil {
+		if err := archive.WriteJSON(quarantineSection, q.List()); err != nil {
+			return err
+		}
+	}
+	if err := archive.WriteJSON(templatesSection, s.templates.List()); err != nil {
+		return err
+	}
+
+	if store := s.config.Fixtures; store != nil {
+		for _, fixture := range store.List() {
+			f, err := os.Open(store.Path(fixture.Name))
+			if err != nil {
+				return fmt.Errorf("failed to read fixture %s: %w", fixture.Name, err)
+			}
+			err = archive.WriteFile(fixturesSection+fixture.Name, fixture.Size, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if manifest.Jobs {
+		var buf bytes.Buffer
+		for _, rec := range s.jobManager.History() {
+			line, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			buf.Write(append(line, '\n'))
+		}
+		if err := archive.WriteFile(jobsSection, int64(buf.Len()), &buf); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// handleImportState applies a state archive of another server. Sections
+// are applied as they are read and replace entries with the same name, so
+// a failed import can be run again. The settings are applied only with
+// ?settings=true, and last until the configuration file is reloaded.
+func (s *Server) handleImportState(c Context) {
+	applySettings := c.Query("settings") == "true"
+	archive, err := state.NewReader(c.Request().Body)
+	if err != nil {
+		s.audit(c, "state.import", "", nil, nil, err)
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	report := state.Report{Manifest: archive.Manifest, Imported: map[string]int{}}
+	for {
+		name, r, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = s.importSection(name, r, applySettings, &report)
+		}
+		if err != nil {
+			s.audit(c, "state.import", archive.Manifest.Server, nil, report, err)
+			c.JSON(http.StatusBadRequest, H{"error": err.Error(), "import": report})
+			return
+		}
+	}
+	s.audit(c, "state.import", archive.Manifest.Server, nil, report, nil)
+	c.JSON(http.StatusOK, report)
+}
+
+// importSection applies one file of a state archive
+func (s *Server) importSection(name string, r io.Reader, applySettings bool, report *state.Report) error {
+	skip := func() error {
+		report.Skipped = append(report.Skipped, name)
+		return nil
+	}
+
+	switch {
+	case name == settingsSection:
+		if !applySettings {
+			return skip()
+		}
+		var settings Settings
+		if err := state.DecodeJSON(name, r, &settings); err != nil {
+			return err
+		}
+		if _, err := s.Reload(settings); err != nil {
+			return err
+		}
+		report.Imported["settings"] = 1
+
+	case name == environmentsSection:
+		var environments map[string]string
+		if err := state.DecodeJSON(name, r, &environments); err != nil {
+			return err
+		}
+		supported := map[string]bool{}
+		for _, lang := range s.dockerExecutor().SupportedLanguages() {
+			supported[lang] = true
+		}
+		for lang := range environments {
+			if !supported[lang] {
+				report.MissingEnvironments = append(report.MissingEnvironments, lang)
+			}
+		}
+		sort.Strings(report.MissingEnvironments)
+
+	case name == tokensSection:
+		var records []tokens.Record
+		if err := state.DecodeJSON(name, r, &records); err != nil {
+			return err
+		}
+		n, err := s.tokens.Restore(records)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		report.Imported["tokens"] = n
+
+	case name == apiKeysSection:
+		var records []apikeys.Record
+		if err := state.DecodeJSON(name, r, &records); err != nil {
+			return err
+		}
+		n, err := s.apiKeys.Restore(records)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		report.Imported["api_keys"] = n
+
+	case name == policiesSection:
+		var policies map[string]authz.Grant
+		if err := state.DecodeJSON(name, r, &policies); err != nil {
+			return err
+		}
+		for group, grant := range policies {
+			if err := grant.Validate(); err != nil {
+				return fmt.Errorf("invalid policy of %s: %w", group, err)
+			}
+			s.managed.setPolicy(group, grant)
+		}
+		report.Imported["policies"] = len(policies)
+
+	case name == managedEnvsSection:
+		var environments map[string]environmentSpec
+		if err := state.DecodeJSON(name, r, &environments); err != nil {
+			return err
+		}
+		for language, env := range environments {
+			if err := env.Validate(); err != nil {
+				return fmt.Errorf("invalid environment of %s: %w", language, err)
+			}
+			s.managed.setEnvironment(language, env)
+		}
+		report.Imported["environments"] = len(environments)
+
+	case name == directorySection:
+		dir := s.config.Directory
+		if dir == nil {
+			return skip()
+		}
+		var snapshot directorySnapshot
+		if err := state.DecodeJSON(name, r, &snapshot); err != nil {
+			return err
+		}
+		if err := dir.Restore(snapshot.Users, snapshot.Groups); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		report.Imported["users"] = len(snapshot.Users)
+		report.Imported["groups"] = len(snapshot.Groups)
+
+	case name == quotasSection:
+		if s.config.Quotas == nil {
+			return skip()
+		}
+		var overrides map[string][]quota.Limit
+		if err := state.DecodeJSON(name, r, &overrides); err != nil {
+			return err
+		}
+		for key, limits := range overrides {
+			if err := s.config.Quotas.Override(key, limits); err != nil {
+				return fmt.Errorf("invalid quota of %s: %w", key, err)
+			}
+		}
+		report.Imported["quotas"] = len(overrides)
+
+	case name == quarantineSection:
+		q := s.jobManager.Quarantine
+		if q == nil {
+			return skip()
+		}
+		var entries []security.QuarantineEntry
+		if err := state.DecodeJSON(name, r, &entries); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			q.Add(entry)
+		}
+		report.Imported["quarantine"] = len(entries)
+
+	case name == templatesSection:
+		var list []*templates.Template
+		if err := state.DecodeJSON(name, r, &list); err != nil {
+			return err
+		}
+		for _, t := range list {
+			if err := s.templates.Put(t); err != nil {
+				return fmt.Errorf("invalid template %s: %w", t.Name, err)
+			}
+		}
+		report.Imported["templates"] = len(list)
+
+	case strings.HasPrefix(name, fixturesSection):
+		if s.config.Fixtures == nil {
+			return skip()
+		}
+		fixture := strings.TrimPrefix(name, fixturesSection)
+		if _, err := s.config.Fixtures.Put(fixture, r); err != nil {
+			return fmt.Errorf("failed to import fixture %s: %w", fixture, err)
+		}
+		report.Imported["fixtures"]++
+
+	case name == jobsSection:
+		// Jobs keep their IDs; deduplication matches /v1/execute requests
+		// as for backfills
+		jobsReport, err := s.jobManager.Backfill(r, jobs.BackfillOptions{
+			Source:  "import",
+			KeepIDs: true,
+			Fingerprint: func(language, code string) string {
+				return jobs.Fingerprint(executeCodeRequest{Language: language, Code: code})
+			},
+		})
+		report.Jobs = &jobsReport
+		if err != nil {
+			return err
+		}
+		report.Imported["jobs"] = jobsReport.Imported
+
+	default:
+		return skip()
+	}
+	return nil
+}
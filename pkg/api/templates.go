@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/languages"
+	"forgeai/pkg/templates"
+)
+
+// handleListTemplates handles listing execution templates
+func (s *Server) handleListTemplates(c Context) {
+	list := s.templates.List()
+
+	c.JSON(http.StatusOK, H{
+		"templates": list,
+		"count":     len(list),
+	})
+}
+
+// handleCreateTemplate handles creating or replacing an execution template
+func (s *Server) handleCreateTemplate(c Context) {
+	var tmpl templates.Template
+	if err := c.ShouldBindJSON(&tmpl); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	tmpl.Language = languages.Normalize(tmpl.Language)
+
+	var before interface{}
+	if existing, ok := s.templates.Get(tmpl.Name); ok {
+		before = existing
+	}
+	if err := s.templates.Put(&tmpl); err != nil {
+		s.audit(c, "template.create", tmpl.Name, before, nil, err)
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+	s.audit(c, "template.create", tmpl.Name, before, tmpl, nil)
+
+	c.JSON(http.StatusCreated, tmpl)
+}
+
+// handlePutTemplate creates or replaces the template named by the path. It
+// responds 201 Created for a new template, and a replaced template keeps
+// its created_at, so that putting the same template again changes nothing.
+func (s *Server) handlePutTemplate(c Context) {
+	var tmpl templates.Template
+	if err := c.ShouldBindJSON(&tmpl); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	name := c.Param("name")
+	if tmpl.Name != "" && tmpl.Name != name {
+		c.JSON(http.StatusBadRequest, H{"error": "the name of the template does not match the path"})
+		return
+	}
+	tmpl.Name = name
+	tmpl.Language = languages.Normalize(tmpl.Language)
+	tmpl.CreatedAt = time.Time{}
+
+	status := http.StatusCreated
+	var before interface{}
+	if existing, ok := s.templates.Get(name); ok {
+		before = existing
+		tmpl.CreatedAt = existing.CreatedAt
+		status = http.StatusOK
+	}
+	if err := s.templates.Put(&tmpl); err != nil {
+		s.audit(c, "template.put", name, before, nil, err)
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+	s.audit(c, "template.put", name, before, tmpl, nil)
+
+	c.JSON(status, tmpl)
+}
+
+// handleGetTemplate handles retrieving an execution template
+func (s *Server) handleGetTemplate(c Context) {
+	tmpl, ok := s.templates.Get(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// handleDeleteTemplate handles deleting an execution template
+func (s *Server) handleDeleteTemplate(c Context) {
+	name := c.Param("name")
+
+	before, _ := s.templates.Get(name)
+	if !s.templates.Delete(name) {
+		s.audit(c, "template.delete", name, nil, nil, errors.New("template not found"))
+		c.JSON(http.StatusNotFound, H{"error": "template not found"})
+		return
+	}
+	s.audit(c, "template.delete", name, before, nil, nil)
+
+	c.JSON(http.StatusOK, H{
+		"name":    name,
+		"message": "Template deleted",
+	})
+}
+
+// handleExecuteTemplate handles executing a template with parameters
+func (s *Server) handleExecuteTemplate(c Context) {
+	tmpl, ok := s.templates.Get(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, H{"error": "template not found"})
+		return
+	}
+
+	var req struct {
+		Params      map[string]interface{} `json:"params"`
+		Timeout     int                    `json:"timeout"`
+		MemoryLimit int                    `json:"memory_limit"`
+		ReadOnlyFS  bool                   `json:"read_only_fs"`
+		Labels      map[string]string      `json:"labels"`
+		ParentID    string                 `json:"parent_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+
+	if err := jobs.ValidateLabels(req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+
+	if req.ParentID != "" {
+		if _, ok := s.jobManager.GetJob(req.ParentID); !ok {
+			c.JSON(http.StatusBadRequest, H{"error": "parent job not found"})
+			return
+		}
+	}
+
+	code, err := tmpl.Render(req.Params)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, H{"error": err.Error()})
+		return
+	}
+
+	// Callers may lower the template limits but never raise them
+	timeout := capLimit(req.Timeout, tmpl.Timeout, 30)
+	memoryLimit := capLimit(req.MemoryLimit, tmpl.MemoryLimit, 128)
+
+	require := isolationRequirements(req.MemoryLimit, nil, req.ReadOnlyFS)
+	if !s.acceptingJobs(c) || !s.requireIsolation(c, tmpl.Language, require) {
+		return
+	}
+
+	if entry, ok := s.jobManager.IsQuarantined(tmpl.Language, code); ok {
+		c.JSON(http.StatusForbidden, H{
+			"error":     "code is quarantined",
+			"code_hash": entry.CodeHash,
+			"reason":    entry.Reason,
+		})
+		return
+	}
+
+	job := s.jobManager.CreateJob(tmpl.Language, code)
+	job.Timeout = timeout
+	job.MemoryLimit = memoryLimit
+	job.Template = tmpl.Name
+	job.Labels = req.Labels
+	job.ParentID = req.ParentID
+
+	if err := s.jobManager.Dispatch(context.Background(), job); err != nil {
+		c.JSON(http.StatusServiceUnavailable, H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, H{
+		"job_id":   job.ID,
+		"status":   s.jobStatus(job),
+		"template": tmpl.Name,
+	})
+}
+
+// capLimit returns the requested limit bounded by the template limit,
+// falling back to the template limit or def when unset
+func capLimit(requested, limit, def int) int {
+	if limit == 0 {
+		limit = def
+	}
+	if requested <= 0 || requested > limit {
+		return limit
+	}
+	return requested
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"forgeai/pkg/authz"
+	"forgeai/pkg/tokens"
+)
+
+// executionToken returns the execution token a request carries as its
+// bearer credential, if any
+func executionToken(c Context) (string, bool) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return token, tokens.IsToken(token)
+}
+
+// useToken counts a job request against the execution token it carries,
+// if any, until releaseToken returns the execution of a request that
+// created no job. It responds and returns false when the token is invalid,
+// used up, or does not allow the request.
+func (s *Server) useToken(c Context, req *ExecuteRequest) bool {
+	token, ok := executionToken(c)
+	if !ok {
+		return true
+	}
+
+	_, err := s.tokens.Use(token, tokens.Request{
+		Language:      req.Language,
+		NetworkAccess: req.NetworkAccess,
+		Timeout:       req.Timeout,
+		MemoryLimit:   req.MemoryLimit,
+	})
+	switch {
+	case err == nil:
+		req.token = token
+		return true
+	case errors.Is(err, tokens.ErrInvalid), errors.Is(err, tokens.ErrExpired):
+		c.JSON(http.StatusUnauthorized, H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusForbidden, H{"error": err.Error()})
+	}
+	return false
+}
+
+// releaseToken returns the execution useToken counted for a request that
+// created no job
+func (s *Server) releaseToken(req *ExecuteRequest) {
+	if req.token == "" {
+		return
+	}
+	s.tokens.Release(req.token)
+	req.token = ""
+}
+
+// handleCreateToken exchanges the caller's credentials for a short-lived
+// execution token with a narrow scope. Tokens are only issued to the
+// principal of an API key or the Actor hook, never to the actor header.
+func (s *Server) handleCreateToken(c Context) {
+	if _, ok := executionToken(c); ok {
+		c.JSON(http.StatusForbidden, H{"error": "execution tokens cannot be exchanged for other tokens"})
+		return
+	}
+	subject := s.principal(c)
+	if subject == "" {
+		c.JSON(http.StatusUnauthorized, H{"error": authz.ErrUnauthenticated.Error()})
+		return
+	}
+
+	var req struct {
+		tokens.Scope
+		TTL string `json:"ttl"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, H{"error": "ttl must be a duration such as 10m"})
+			return
+		}
+		ttl = parsed
+	}
+	if !s.checkLanguage(c, "language", &req.Language) {
+		return
+	}
+
+	// A token cannot allow more than the caller's groups do
+	if policy := s.authzPolicy(); policy.Enabled() {
+		err := policy.Authorize(s.config.Directory, subject, authz.Request{
+			Language:      req.Language,
+			NetworkAccess: req.NetworkAccess,
+			Timeout:       req.MaxTimeout,
+			MemoryLimit:   req.MaxMemoryLimit,
+		})
+		if err != nil {
+			c.JSON(http.StatusForbidden, H{"error": err.Error()})
+			return
+		}
+	}
+
+	token, issued, err := s.tokens.Issue(subject, req.Scope, ttl)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return
+	}
+	s.audit(c, "token.create", issued.ID, nil, issued, nil)
+
+	c.JSON(http.StatusCreated, H{
+		"token":      token,
+		"id":         issued.ID,
+		"subject":    issued.Subject,
+		"scope":      issued.Scope,
+		"issued_at":  issued.IssuedAt,
+		"expires_at": issued.ExpiresAt,
+	})
+}
+
+// handleGetCurrentToken describes the execution token a request carries,
+// so that its holder can see what it allows and how much of it is left
+func (s *Server) handleGetCurrentToken(c Context) {
+	token, ok := executionToken(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, H{"error": "no execution token"})
+		return
+	}
+	t, err := s.tokens.Lookup(token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, H{
+		"id":         t.ID,
+		"subject":    t.Subject,
+		"scope":      t.Scope,
+		"issued_at":  t.IssuedAt,
+		"expires_at": t.ExpiresAt,
+		"used":       t.Used,
+		"remaining":  t.Remaining(),
+	})
+}
+
+// handleRevokeToken revokes one of the caller's execution tokens, or the
+// token the request carries
+func (s *Server) handleRevokeToken(c Context) {
+	id := c.Param("id")
+	subject := s.principal(c)
+	if subject == "" {
+		c.JSON(http.StatusUnauthorized, H{"error": authz.ErrUnauthenticated.Error()})
+		return
+	}
+	if err := s.tokens.Revoke(id, subject); err != nil {
+		c.JSON(http.StatusNotFound, H{"error": "token not found"})
+		return
+	}
+	s.audit(c, "token.revoke", id, nil, nil, nil)
+
+	c.JSON(http.StatusOK, H{
+		"id":      id,
+		"message": "token revoked",
+	})
+}
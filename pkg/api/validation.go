@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"forgeai/pkg/languages"
+	"forgeai/pkg/sandbox"
+)
+
+// FieldError describes why one field of a request is invalid
+type FieldError struct {
+	// Field is the JSON path of the field, or empty for the whole body
+	Field string `json:"field"`
+
+	// Constraint names the rule the field broke, such as required, type,
+	// supported, max, or excluded_with
+	Constraint string `json:"constraint"`
+
+	Message  string      `json:"message"`
+	Got      interface{} `json:"got,omitempty"`
+	Expected interface{} `json:"expected,omitempty"`
+}
+
+// ValidationError is returned for requests with invalid fields
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// fieldError returns a ValidationError of one field
+func fieldError(field, constraint, message string, got, expected interface{}) *ValidationError {
+	return &ValidationError{Fields: []FieldError{{
+		Field:      field,
+		Constraint: constraint,
+		Message:    message,
+		Got:        got,
+		Expected:   expected,
+	}}}
+}
+
+// withFieldError adds the errors of a field to err, which may be nil
+func withFieldError(err error, field *ValidationError) error {
+	if err == nil {
+		return field
+	}
+	invalid := toValidationError(err)
+	invalid.Fields = append(invalid.Fields, field.Fields...)
+	return invalid
+}
+
+// toValidationError describes an error from binding a request body by
+// field. Decoding errors say where the body is malformed or which field has
+// the wrong type.
+func toValidationError(err error) *ValidationError {
+	var invalid *ValidationError
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &invalid):
+		return invalid
+	case errors.As(err, &syntax):
+		return fieldError("", "json", fmt.Sprintf("request body is not valid JSON at offset %d: %v", syntax.Offset, err), nil, nil)
+	case errors.As(err, &typ):
+		expected := jsonType(typ.Type)
+		return fieldError(typ.Field, "type", fmt.Sprintf("%s must be %s, got %s", typ.Field, article(expected), typ.Value), typ.Value, expected)
+	case errors.Is(err, io.EOF):
+		return fieldError("", "required", "request body is empty", nil, "a JSON object")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return fieldError("", "json", "request body is truncated JSON", nil, nil)
+	}
+	return fieldError("", "json", err.Error(), nil, nil)
+}
+
+// jsonType names the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return "object"
+}
+
+// article prefixes a JSON type with a or an
+func article(typ string) string {
+	if strings.IndexByte("aeiou", typ[0]) >= 0 {
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+// respondInvalid responds 400 Bad Request with the fields of a request that
+// are invalid
+func respondInvalid(c Context, err error) {
+	invalid := toValidationError(err)
+	c.JSON(http.StatusBadRequest, H{
+		"error":  invalid.Error(),
+		"fields": invalid.Fields,
+	})
+}
+
+// checkLanguage normalizes a language alias in place and checks the
+// language against the languages the executors currently support. It
+// responds and returns false when the language is not supported.
+func (s *Server) checkLanguage(c Context, field string, language *string) bool {
+	got := *language
+	*language = languages.Normalize(got)
+	if supportsLanguage(s.jobManager.LanguageExecutor(*language), *language) {
+		return true
+	}
+	respondInvalid(c, fieldError(field, "supported", "unsupported language: "+got, got, s.jobManager.Languages()))
+	return false
+}
+
+// checkLocale checks the time zone and locale of a request, which are empty
+// to use the server's. It responds and returns false when either is invalid.
+func (s *Server) checkLocale(c Context, timezone, locale string) (sandbox.Locale, bool) {
+	var err error
+	if timezone != "" {
+		if invalid := sandbox.ValidateTimezone(timezone); invalid != nil {
+			err = withFieldError(err, fieldError("timezone", "supported", invalid.Error(), timezone, "an IANA time zone such as Europe/Berlin"))
+		}
+	}
+	if locale != "" {
+		if invalid := sandbox.ValidateLocale(locale); invalid != nil {
+			err = withFieldError(err, fieldError("locale", "format", invalid.Error(), locale, "language[_territory][.codeset][@modifier]"))
+		}
+	}
+	if err != nil {
+		respondInvalid(c, err)
+		return sandbox.Locale{}, false
+	}
+	return sandbox.Locale{Timezone: timezone, Name: locale}, true
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"forgeai/pkg/volumes"
+)
+
+// errVolumesDisabled is the response when the server keeps no volumes
+var errVolumesDisabled = H{"error": "persistent volumes are not enabled on this server"}
+
+// handleListVolumes handles listing the persistent volumes of a tenant
+func (s *Server) handleListVolumes(c Context) {
+	if s.config.Volumes == nil {
+		c.JSON(http.StatusNotImplemented, errVolumesDisabled)
+		return
+	}
+	if !s.authorizeTenant(c, c.Param("tenant")) {
+		return
+	}
+	list := s.config.Volumes.List(c.Param("tenant"))
+
+	c.JSON(http.StatusOK, H{
+		"volumes": list,
+		"count":   len(list),
+	})
+}
+
+// handleGetVolume handles describing a persistent volume
+func (s *Server) handleGetVolume(c Context) {
+	if s.config.Volumes == nil {
+		c.JSON(http.StatusNotImplemented, errVolumesDisabled)
+		return
+	}
+	if !s.authorizeTenant(c, c.Param("tenant")) {
+		return
+	}
+	volume, err := s.config.Volumes.Get(volumes.Ref{Tenant: c.Param("tenant"), Name: c.Param("name")})
+	if err != nil {
+		c.JSON(volumeErrorStatus(err), H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, volume)
+}
+
+// handleDeleteVolume handles wiping a persistent volume
+func (s *Server) handleDeleteVolume(c Context) {
+	if s.config.Volumes == nil {
+		c.JSON(http.StatusNotImplemented, errVolumesDisabled)
+		return
+	}
+	if !s.authorizeTenant(c, c.Param("tenant")) {
+		return
+	}
+	ref := volumes.Ref{Tenant: c.Param("tenant"), Name: c.Param("name")}
+	resource := ref.Tenant + "/" + ref.Name
+	before, _ := s.config.Volumes.Get(ref)
+	if err := s.config.Volumes.Delete(ref); err != nil {
+		s.audit(c, "volume.delete", resource, nil, nil, err)
+		c.JSON(volumeErrorStatus(err), H{"error": err.Error()})
+		return
+	}
+	s.audit(c, "volume.delete", resource, before, nil, nil)
+
+	c.JSON(http.StatusOK, H{
+		"tenant":  ref.Tenant,
+		"name":    ref.Name,
+		"message": "Volume deleted",
+	})
+}
+
+// volumeErrorStatus returns the response status of a volume error
+func volumeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, volumes.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, volumes.ErrInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// resolveVolume returns the volume a job asks for, of the tenant of its
+// caller, or responds with an error and returns false when it cannot have
+// one
+func (s *Server) resolveVolume(c Context, name string, labels map[string]string) (*volumes.Ref, bool) {
+	if name == "" {
+		return nil, true
+	}
+	if s.config.Volumes == nil {
+		c.JSON(http.StatusBadRequest, errVolumesDisabled)
+		return nil, false
+	}
+	tenant, err := s.tenant(c, s.config.Volumes.Tenant(labels))
+	if err != nil {
+		c.JSON(http.StatusForbidden, H{"error": err.Error()})
+		return nil, false
+	}
+	if tenant == "" {
+		c.JSON(http.StatusUnauthorized, H{"error": "volumes are only available to callers with a tenant"})
+		return nil, false
+	}
+	ref := volumes.Ref{Tenant: tenant, Name: name}
+	if err := ref.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, H{"error": err.Error()})
+		return nil, false
+	}
+	return &ref, true
+}
@@ -0,0 +1,286 @@
+// Package apikeys stores long-lived API keys that authenticate requests as a
+// user. Keys have stable IDs chosen by whoever creates them and are written
+// with idempotent puts, so that infrastructure tools such as Terraform can
+// manage them declaratively. Only the hashes of their secrets are kept.
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix starts every API key, so that keys can be told apart from other
+// credentials
+const Prefix = "fxk_"
+
+var (
+	// ErrInvalid is returned for keys that do not exist or were rotated
+	ErrInvalid = errors.New("invalid API key")
+
+	// ErrExpired is returned for keys past their expiry
+	ErrExpired = errors.New("API key has expired")
+
+	// ErrNotFound is returned for IDs of no key
+	ErrNotFound = errors.New("API key not found")
+)
+
+var idRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// Spec is the part of a key that its owner declares
+type Spec struct {
+	// Subject is the user that requests with the key authenticate as
+	Subject string `json:"subject"`
+
+	Description string `json:"description,omitempty"`
+
+	// ExpiresAt, when set, is when the key stops authenticating
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Validate checks that a spec can be stored
+func (s Spec) Validate() error {
+	if s.Subject == "" {
+		return errors.New("API keys must have a subject")
+	}
+	return nil
+}
+
+// Key describes an API key. The key itself is only returned when it is
+// created or rotated; the store keeps its hash.
+type Key struct {
+	ID string `json:"id"`
+	Spec
+
+	// Hint is the start of the key, to recognize it by
+	Hint string `json:"hint"`
+
+	CreatedAt time.Time `json:"created_at"`
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// expired reports whether the key has expired at now
+func (k Key) expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Store keeps API keys in memory. The zero value is ready to use.
+type Store struct {
+	// Now returns the current time; time.Now when nil
+	Now func() time.Time
+
+	mu     sync.Mutex
+	byID   map[string]*Key
+	hashes map[string]string // ID by hash
+}
+
+func (s *Store) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// hash returns the key a secret is stored under
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsKey reports whether a credential looks like an API key
+func IsKey(credential string) bool {
+	return strings.HasPrefix(credential, Prefix)
+}
+
+// ValidID checks that an ID can name a key: lowercase letters, digits, and
+// . _ -, at most 64 characters
+func ValidID(id string) error {
+	if !idRe.MatchString(id) {
+		return fmt.Errorf("invalid API key ID %q: use lowercase letters, digits, '.', '_', and '-'", id)
+	}
+	return nil
+}
+
+// newSecret generates a key
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return Prefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// init allocates the maps. The caller holds s.mu.
+func (s *Store) init() {
+	if s.byID == nil {
+		s.byID = map[string]*Key{}
+		s.hashes = map[string]string{}
+	}
+}
+
+// Put creates the key with an ID or updates its spec. Only a created key
+// is returned with its secret; updating a key keeps its secret, so putting
+// the same spec again changes nothing.
+func (s *Store) Put(id string, spec Spec) (key Key, secret string, created bool, err error) {
+	if err := ValidID(id); err != nil {
+		return Key{}, "", false, err
+	}
+	if err := spec.Validate(); err != nil {
+		return Key{}, "", false, err
+	}
+	if spec.ExpiresAt != nil {
+		expires := spec.ExpiresAt.UTC()
+		spec.ExpiresAt = &expires
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	if k, ok := s.byID[id]; ok {
+		k.Spec = spec
+		return *k, "", false, nil
+	}
+
+	secret, err = newSecret()
+	if err != nil {
+		return Key{}, "", false, err
+	}
+	now := s.now().UTC()
+	k := &Key{ID: id, Spec: spec, Hint: secret[:len(Prefix)+4], CreatedAt: now, RotatedAt: now}
+	s.byID[id] = k
+	s.hashes[hash(secret)] = id
+	return *k, secret, true, nil
+}
+
+// Rotate replaces the secret of a key, which stops the old secret from
+// authenticating, and returns the new one
+func (s *Store) Rotate(id string) (Key, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.byID[id]
+	if !ok {
+		return Key{}, "", ErrNotFound
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return Key{}, "", err
+	}
+	s.dropHash(id)
+	k.Hint = secret[:len(Prefix)+4]
+	k.RotatedAt = s.now().UTC()
+	s.hashes[hash(secret)] = id
+	return *k, secret, nil
+}
+
+// dropHash forgets the hash of a key. The caller holds s.mu.
+func (s *Store) dropHash(id string) {
+	for h, keyID := range s.hashes {
+		if keyID == id {
+			delete(s.hashes, h)
+		}
+	}
+}
+
+// Get returns a key by ID
+func (s *Store) Get(id string) (Key, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.byID[id]
+	if !ok {
+		return Key{}, false
+	}
+	return *k, true
+}
+
+// Delete removes a key, and reports whether it existed
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[id]; !ok {
+		return false
+	}
+	delete(s.byID, id)
+	s.dropHash(id)
+	return true
+}
+
+// List returns the keys sorted by ID
+func (s *Store) List() []Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]Key, 0, len(s.byID))
+	for _, k := range s.byID {
+		keys = append(keys, *k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// Authenticate returns the key a secret stands for, if it is valid
+func (s *Store) Authenticate(secret string) (Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.hashes[hash(secret)]
+	if !ok {
+		return Key{}, ErrInvalid
+	}
+	k := s.byID[id]
+	if k.expired(s.now()) {
+		return Key{}, ErrExpired
+	}
+	return *k, nil
+}
+
+// Record is a key as the store keeps it: under the SHA-256 hash of its
+// secret, which is never kept itself
+type Record struct {
+	Hash string `json:"hash"`
+	Key  Key    `json:"key"`
+}
+
+// Export returns the keys, so that they can be restored in another store
+func (s *Store) Export() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]Record, 0, len(s.hashes))
+	for h, id := range s.hashes {
+		records = append(records, Record{Hash: h, Key: *s.byID[id]})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Key.ID < records[j].Key.ID })
+	return records
+}
+
+// Restore adds exported keys, replacing keys with the same ID, and returns
+// how many it added. Records that are not a hash of a key are refused.
+func (s *Store) Restore(records []Record) (int, error) {
+	for _, r := range records {
+		if b, err := hex.DecodeString(r.Hash); err != nil || len(b) != sha256.Size {
+			return 0, fmt.Errorf("API key %s: invalid hash", r.Key.ID)
+		}
+		if err := ValidID(r.Key.ID); err != nil {
+			return 0, err
+		}
+		if err := r.Key.Validate(); err != nil {
+			return 0, fmt.Errorf("API key %s: %w", r.Key.ID, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	for _, r := range records {
+		k := r.Key
+		s.dropHash(k.ID)
+		s.byID[k.ID] = &k
+		s.hashes[r.Hash] = k.ID
+	}
+	return len(records), nil
+}
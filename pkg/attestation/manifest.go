@@ -0,0 +1,200 @@
+// Package attestation produces signed execution manifests that let
+// downstream systems verify a result came from an untampered sandbox run.
+package attestation
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestVersion identifies the manifest schema
+const ManifestVersion = "forgeai.execution/v1"
+
+// Limits are the resource limits a job ran with
+type Limits struct {
+	TimeoutSeconds int  `json:"timeout_seconds"`
+	MemoryMB       int  `json:"memory_mb"`
+	NetworkAccess  bool `json:"network_access"`
+}
+
+// Manifest describes a single execution. Fields are encoded in declaration
+// order so the same run always produces the same bytes.
+type Manifest struct {
+	Version         string    `json:"version"`
+	JobID           string    `json:"job_id"`
+	Language        string    `json:"language"`
+	CodeHash        string    `json:"code_hash"`
+	Image           string    `json:"image,omitempty"`
+	ImageDigest     string    `json:"image_digest,omitempty"`
+	Executor        string    `json:"executor"`
+	ExecutorVersion string    `json:"executor_version"`
+	Limits          Limits    `json:"limits"`
+	ExitCode        int       `json:"exit_code"`
+	ResultHash      string    `json:"result_hash"`
+	StartedAt       time.Time `json:"started_at"`
+	CompletedAt     time.Time `json:"completed_at"`
+}
+
+// SignedManifest is a manifest with a detached signature over its bytes
+type SignedManifest struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Algorithm string          `json:"algorithm"`
+	KeyID     string          `json:"key_id"`
+	Signature string          `json:"signature"`
+}
+
+// ResultHash hashes the observable outcome of an execution
+func ResultHash(stdout, stderr string, exitCode int) string {
+	data, _ := json.Marshal(struct {
+		Stdout   string `json:"stdout"`
+		Stderr   string `json:"stderr"`
+		ExitCode int    `json:"exit_code"`
+	}{stdout, stderr, exitCode})
+
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Signer signs manifests with an ed25519 server key
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewSigner creates a signer from a private key
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key}
+}
+
+// NewEphemeralSigner creates a signer with a freshly generated key
+func NewEphemeralSigner() (*Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return NewSigner(key), nil
+}
+
+// LoadOrCreateSigner loads a PEM encoded key from path, generating and
+// saving a new key if the file does not exist
+func LoadOrCreateSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		signer, err := NewEphemeralSigner()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create key directory: %w", err)
+		}
+		block := &pem.Block{Type: "FORGEAI SIGNING KEY", Bytes: signer.key.Seed()}
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write signing key: %w", err)
+		}
+		return signer, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || len(block.Bytes) != ed25519.SeedSize {
+		return nil, errors.New("invalid signing key file")
+	}
+	return NewSigner(ed25519.NewKeyFromSeed(block.Bytes)), nil
+}
+
+// PublicKey returns the base64 encoded public key
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// KeyID returns a short identifier derived from the public key
+func (s *Signer) KeyID() string {
+	return keyID(s.key.Public().(ed25519.PublicKey))
+}
+
+// Sign encodes and signs a manifest
+func (s *Signer) Sign(manifest *Manifest) (*SignedManifest, error) {
+	if manifest.Version == "" {
+		manifest.Version = ManifestVersion
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	return &SignedManifest{
+		Manifest:  data,
+		Algorithm: "ed25519",
+		KeyID:     s.KeyID(),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, data)),
+	}, nil
+}
+
+// SignData returns the base64 encoded signature of arbitrary data, such as
+// the description of a plugin release
+func (s *Signer) SignData(data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, data))
+}
+
+// VerifyData checks a signature of SignData against a base64 encoded public
+// key
+func VerifyData(data []byte, signature, publicKey string) error {
+	pub, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errors.New("invalid public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+// Verify checks a signed manifest against a base64 encoded public key and
+// returns the decoded manifest
+func Verify(signed *SignedManifest, publicKey string) (*Manifest, error) {
+	pub, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key")
+	}
+	if signed.Algorithm != "ed25519" {
+		return nil, fmt.Errorf("unsupported signature algorithm: %s", signed.Algorithm)
+	}
+	if signed.KeyID != keyID(pub) {
+		return nil, errors.New("manifest was signed with a different key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, errors.New("invalid signature encoding")
+	}
+	if !ed25519.Verify(pub, signed.Manifest, sig) {
+		return nil, errors.New("signature verification failed")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(signed.Manifest, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+func keyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,190 @@
+// Package audit keeps a trail of administrative actions, such as policy
+// changes and admin API calls, separate from the log of executed jobs. Each
+// entry records who did what and when, with the values before and after the
+// change, and is delivered to sinks such as a file, syslog, or a webhook
+// for export to a SIEM.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/offline"
+)
+
+// DefaultCapacity is how many recent entries a trail keeps in memory
+const DefaultCapacity = 1000
+
+// DefaultTimeout bounds the delivery of an entry to each sink
+const DefaultTimeout = 5 * time.Second
+
+// Outcomes of audited actions
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Entry is an audited action
+type Entry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+
+	// Actor identifies who acted, such as a user, a service, or "system"
+	// for changes the server made on its own, like reloading its
+	// configuration
+	Actor string `json:"actor"`
+
+	// Action names what was done, such as quarantine.add
+	Action   string `json:"action"`
+	Resource string `json:"resource,omitempty"`
+
+	// Method, Path, and RemoteAddr describe the API call, if any
+	Method     string `json:"method,omitempty"`
+	Path       string `json:"path,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+
+	// Before and After are the values the action changed
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Sink receives the entries of a trail
+type Sink interface {
+	// Name identifies the sink in logs
+	Name() string
+
+	Write(ctx context.Context, entry Entry) error
+}
+
+// Filter selects entries when listing
+type Filter struct {
+	Action string
+	Actor  string
+	Since  time.Time
+}
+
+// Matches reports whether an entry satisfies the filter
+func (f Filter) Matches(entry Entry) bool {
+	if f.Action != "" && entry.Action != f.Action {
+		return false
+	}
+	if f.Actor != "" && entry.Actor != f.Actor {
+		return false
+	}
+	return f.Since.IsZero() || !entry.Time.Before(f.Since)
+}
+
+// Trail records audited actions, keeps the most recent ones, and delivers
+// every entry to its sinks in order
+type Trail struct {
+	// Sinks receive every entry
+	Sinks []Sink
+
+	// Capacity is how many recent entries are kept for List;
+	// DefaultCapacity when zero
+	Capacity int
+
+	// Timeout bounds the delivery of an entry to each sink; DefaultTimeout
+	// when zero
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	seq    uint64
+	recent []Entry
+}
+
+// NewTrail creates a trail that delivers to sinks
+func NewTrail(sinks ...Sink) *Trail {
+	return &Trail{Sinks: sinks}
+}
+
+// FromConfig creates a trail with the sinks of the configuration
+func FromConfig(cfg config.AuditConfig) (*Trail, error) {
+	t := NewTrail()
+	if cfg.File != "" {
+		sink, err := NewFileSink(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+		t.Sinks = append(t.Sinks, sink)
+	}
+	if cfg.Syslog.Address != "" {
+		sink, err := NewSyslogSink(cfg.Syslog)
+		if err != nil {
+			return nil, err
+		}
+		t.Sinks = append(t.Sinks, sink)
+	}
+	if cfg.Webhook.URL != "" {
+		if err := offline.Check("audit webhook"); err != nil {
+			return nil, err
+		}
+		t.Sinks = append(t.Sinks, NewWebhookSink(cfg.Webhook))
+	}
+	t.Capacity = cfg.Capacity
+	return t, nil
+}
+
+// Record numbers and timestamps an entry and delivers it to the sinks.
+// Entries without an outcome succeeded. Delivery failures are reported but
+// do not fail the action.
+func (t *Trail) Record(ctx context.Context, entry Entry) Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.seq++
+	entry.Seq = t.seq
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.Outcome == "" {
+		entry.Outcome = OutcomeSuccess
+	}
+
+	capacity := t.Capacity
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	t.recent = append(t.recent, entry)
+	if len(t.recent) > capacity {
+		t.recent = append([]Entry(nil), t.recent[len(t.recent)-capacity:]...)
+	}
+
+	// Sinks are written under the lock so that they see entries in order
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	for _, sink := range t.Sinks {
+		sinkCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := sink.Write(sinkCtx, entry); err != nil {
+			fmt.Printf("Warning: failed to write audit entry %d to %s: %v\n", entry.Seq, sink.Name(), err)
+		}
+		cancel()
+	}
+	return entry
+}
+
+// List returns the recent entries that match a filter, oldest first, at
+// most limit of the newest when limit is positive
+func (t *Trail) List(filter Filter, limit int) []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := []Entry{}
+	for _, entry := range t.recent {
+		if filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
@@ -0,0 +1,213 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/offline"
+)
+
+// FileSink appends entries to a file as JSON lines
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens a file to append entries to
+func NewFileSink(path string) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &FileSink{path: path, file: file}, nil
+}
+
+// Name identifies the sink
+func (f *FileSink) Name() string {
+	return "file " + f.path
+}
+
+// Write appends an entry and syncs it to disk
+func (f *FileSink) Write(ctx context.Context, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// Syslog facility and severities of audit entries
+const (
+	syslogFacilityAuthpriv = 10
+	syslogSeverityWarning  = 4
+	syslogSeverityNotice   = 5
+)
+
+// SyslogSink sends entries to a syslog server as RFC 5424 messages whose
+// message is the JSON entry. TCP messages are framed by octet counting.
+type SyslogSink struct {
+	network  string
+	address  string
+	tag      string
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink creates a sink for the syslog server of the configuration
+func NewSyslogSink(cfg config.AuditSyslogConfig) (*SyslogSink, error) {
+	network := cfg.Network
+	switch network {
+	case "":
+		network = "udp"
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network: %s (use udp or tcp)", network)
+	}
+	if err := offline.CheckHost("audit syslog", cfg.Address); err != nil {
+		return nil, err
+	}
+	tag := cfg.Tag
+	if tag == "" {
+		tag = "forgeai"
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &SyslogSink{network: network, address: cfg.Address, tag: tag, hostname: hostname}, nil
+}
+
+// Name identifies the sink
+func (s *SyslogSink) Name() string {
+	return "syslog " + s.network + "://" + s.address
+}
+
+// Write sends an entry, reconnecting once if the connection was lost
+func (s *SyslogSink) Write(ctx context.Context, entry Entry) error {
+	msg, err := s.format(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, s.network, s.address)
+			if err != nil {
+				return fmt.Errorf("failed to connect to syslog: %w", err)
+			}
+			s.conn = conn
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			s.conn.SetWriteDeadline(deadline)
+		}
+		_, err := s.conn.Write(msg)
+		if err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+		if attempt > 0 {
+			return fmt.Errorf("failed to send to syslog: %w", err)
+		}
+	}
+}
+
+// format renders an entry as a syslog message
+func (s *SyslogSink) format(entry Entry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	severity := syslogSeverityNotice
+	if entry.Outcome == OutcomeFailure {
+		severity = syslogSeverityWarning
+	}
+	msgID := strings.ReplaceAll(entry.Action, " ", "_")
+	if msgID == "" {
+		msgID = "-"
+	}
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		syslogFacilityAuthpriv*8+severity,
+		entry.Time.UTC().Format(time.RFC3339Nano),
+		s.hostname, s.tag, os.Getpid(), msgID, data)
+	if s.network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	return []byte(msg), nil
+}
+
+// WebhookSink posts each entry as JSON to a URL
+type WebhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhookSink creates a sink for the webhook of the configuration
+func NewWebhookSink(cfg config.AuditWebhookConfig) *WebhookSink {
+	return &WebhookSink{url: cfg.URL, headers: cfg.Headers, client: &http.Client{}}
+}
+
+// Name identifies the sink
+func (w *WebhookSink) Name() string {
+	return "webhook " + w.url
+}
+
+// Write posts an entry and fails on non-2xx responses
+func (w *WebhookSink) Write(ctx context.Context, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range w.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post audit entry: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("audit entry rejected with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+// Package authz authorizes job requests by the groups of their user. Groups
+// are granted languages, network access, and limits in the configuration,
+// and users are made members of groups by a directory that is synced from
+// an identity provider over SCIM or imported from an LDAP export, so that
+// access follows team membership without configuring each user.
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AnyLanguage grants every language
+const AnyLanguage = "*"
+
+var (
+	// ErrUnauthenticated is returned for requests that name no user
+	ErrUnauthenticated = errors.New("request names no user")
+
+	// ErrDenied is returned for requests the user's groups do not grant
+	ErrDenied = errors.New("not authorized")
+)
+
+// Grant is what the members of a group may run
+type Grant struct {
+	// Languages are the languages the group may run; AnyLanguage grants
+	// every language
+	Languages []string `json:"languages"`
+
+	// NetworkAccess allows jobs with network access
+	NetworkAccess bool `json:"network_access"`
+
+	// MaxTimeout and MaxMemoryLimit cap the timeout in seconds and the
+	// memory limit in MB of jobs; unlimited when zero
+	MaxTimeout     int `json:"max_timeout,omitempty"`
+	MaxMemoryLimit int `json:"max_memory_limit,omitempty"`
+}
+
+// Validate checks that a grant allows some language and that its limits
+// are not negative
+func (g Grant) Validate() error {
+	if len(g.Languages) == 0 {
+		return errors.New("a grant must allow at least one language")
+	}
+	for _, l := range g.Languages {
+		if l == "" {
+			return errors.New("languages must not be empty")
+		}
+	}
+	if g.MaxTimeout < 0 || g.MaxMemoryLimit < 0 {
+		return errors.New("limits must not be negative")
+	}
+	return nil
+}
+
+// allowsLanguage reports whether the grant includes a language
+func (g Grant) allowsLanguage(language string) bool {
+	for _, l := range g.Languages {
+		if l == AnyLanguage || strings.EqualFold(l, language) {
+			return true
+		}
+	}
+	return false
+}
+
+// merge returns the union of two grants: the languages of both, network
+// access if either has it, and the higher of their limits
+func (g Grant) merge(other Grant) Grant {
+	merged := Grant{NetworkAccess: g.NetworkAccess || other.NetworkAccess}
+	seen := map[string]bool{}
+	for _, l := range append(append([]string{}, g.Languages...), other.Languages...) {
+		if !seen[l] {
+			seen[l] = true
+			merged.Languages = append(merged.Languages, l)
+		}
+	}
+	sort.Strings(merged.Languages)
+	merged.MaxTimeout = maxLimit(g.MaxTimeout, other.MaxTimeout)
+	merged.MaxMemoryLimit = maxLimit(g.MaxMemoryLimit, other.MaxMemoryLimit)
+	return merged
+}
+
+// maxLimit returns the higher of two limits, where zero is unlimited
+func maxLimit(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Policy maps groups to what their members may run
+type Policy struct {
+	// Groups are the grants of groups by display name
+	Groups map[string]Grant
+
+	// Default is the grant of users who are in no granted group, including
+	// users the directory does not know; nil denies them
+	Default *Grant
+}
+
+// Enabled reports whether the policy grants anything, and so whether
+// requests are authorized
+func (p Policy) Enabled() bool {
+	return len(p.Groups) > 0 || p.Default != nil
+}
+
+// Request is what a job request asks for
+type Request struct {
+	// Language is empty when it is not known up front
+	Language      string
+	NetworkAccess bool
+	Timeout       int
+	MemoryLimit   int
+}
+
+// Access is the effective grant of a user
+type Access struct {
+	User   string   `json:"user"`
+	Groups []string `json:"groups"`
+
+	// Granted is false when neither the user's groups nor the default
+	// grant anything
+	Granted bool  `json:"granted"`
+	Grant   Grant `json:"grant"`
+}
+
+// Access returns what a user may run: the union of the grants of their
+// groups in dir, or the default grant when none of them is granted
+func (p Policy) Access(dir *Directory, user string) Access {
+	access := Access{User: user, Groups: []string{}}
+	if dir != nil {
+		access.Groups = dir.GroupsOf(user)
+	}
+	for _, group := range access.Groups {
+		grant, ok := p.Groups[group]
+		switch {
+		case !ok:
+		case access.Granted:
+			access.Grant = access.Grant.merge(grant)
+		default:
+			access.Grant = grant.merge(grant)
+			access.Granted = true
+		}
+	}
+	if !access.Granted && p.Default != nil {
+		access.Grant = *p.Default
+		access.Granted = true
+	}
+	return access
+}
+
+// Authorize checks that a user may run a request. Errors wrap
+// ErrUnauthenticated or ErrDenied and explain what is not granted.
+func (p Policy) Authorize(dir *Directory, user string, req Request) error {
+	if user == "" {
+		return ErrUnauthenticated
+	}
+	access := p.Access(dir, user)
+	if !access.Granted {
+		return fmt.Errorf("%w: %s is in no group that may run jobs", ErrDenied, user)
+	}
+
+	// Requests whose language is not known up front, such as file
+	// executions, need a grant of every language
+	grant := access.Grant
+	if req.Language == "" && !grant.allowsLanguage(AnyLanguage) {
+		return fmt.Errorf("%w: %s may only run jobs in %s", ErrDenied, user, strings.Join(grant.Languages, ", "))
+	}
+	if req.Language != "" && !grant.allowsLanguage(req.Language) {
+		return fmt.Errorf("%w: %s may not run %s (allowed: %s)", ErrDenied, user, req.Language, strings.Join(grant.Languages, ", "))
+	}
+	if req.NetworkAccess && !grant.NetworkAccess {
+		return fmt.Errorf("%w: %s may not run jobs with network access", ErrDenied, user)
+	}
+	if grant.MaxTimeout > 0 && req.Timeout > grant.MaxTimeout {
+		return fmt.Errorf("%w: %s may not run jobs with a timeout above %d seconds", ErrDenied, user, grant.MaxTimeout)
+	}
+	if grant.MaxMemoryLimit > 0 && req.MemoryLimit > grant.MaxMemoryLimit {
+		return fmt.Errorf("%w: %s may not run jobs with a memory limit above %d MB", ErrDenied, user, grant.MaxMemoryLimit)
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+package authz
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrNotFound is returned for users and groups that do not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned when a user name or group name is taken
+	ErrConflict = errors.New("already exists")
+)
+
+// User is a user of the directory
+type User struct {
+	ID         string    `json:"id"`
+	ExternalID string    `json:"external_id,omitempty"`
+	UserName   string    `json:"user_name"`
+	Active     bool      `json:"active"`
+	Modified   time.Time `json:"modified"`
+}
+
+// Group is a group of the directory. Members are user IDs.
+type Group struct {
+	ID          string    `json:"id"`
+	ExternalID  string    `json:"external_id,omitempty"`
+	DisplayName string    `json:"display_name"`
+	Members     []string  `json:"members"`
+	Modified    time.Time `json:"modified"`
+}
+
+// Directory holds the users and groups synced from an identity provider.
+// With a Path it is kept in that file, so that it survives restarts
+// between syncs.
+type Directory struct {
+	// Path is the JSON file the directory is kept in; in memory only when
+	// empty
+	Path string
+
+	mu     sync.RWMutex
+	users  map[string]User
+	groups map[string]Group
+}
+
+// NewDirectory creates a directory kept in path. Call Open before using
+// it.
+func NewDirectory(path string) *Directory {
+	return &Directory{Path: path, users: map[string]User{}, groups: map[string]Group{}}
+}
+
+// directoryFile is how a directory is kept on disk
+type directoryFile struct {
+	Users  []User  `json:"users"`
+	Groups []Group `json:"groups"`
+}
+
+// Open loads the directory from its file, if it exists
+func (d *Directory) Open() error {
+	if d.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(d.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	var file directoryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid directory %s: %w", d.Path, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.users, d.groups = map[string]User{}, map[string]Group{}
+	for _, u := range file.Users {
+		d.users[u.ID] = u
+	}
+	for _, g := range file.Groups {
+		d.groups[g.ID] = g
+	}
+	return nil
+}
+
+// save writes the directory to its file. The caller holds d.mu.
+func (d *Directory) save() error {
+	if d.Path == "" {
+		return nil
+	}
+	file := directoryFile{Users: d.sortedUsers(), Groups: d.sortedGroups()}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(d.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp := d.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write directory: %w", err)
+	}
+	if err := os.Rename(tmp, d.Path); err != nil {
+		return fmt.Errorf("failed to write directory: %w", err)
+	}
+	return nil
+}
+
+// newID returns a random ID for a user or group
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Users returns the users sorted by user name
+func (d *Directory) Users() []User {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.sortedUsers()
+}
+
+func (d *Directory) sortedUsers() []User {
+	users := make([]User, 0, len(d.users))
+	for _, u := range d.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserName < users[j].UserName })
+	return users
+}
+
+// User returns a user by ID
+func (d *Directory) User(id string) (User, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	u, ok := d.users[id]
+	return u, ok
+}
+
+// PutUser creates a user, when its ID is empty, or replaces one. User
+// names are unique regardless of case.
+func (d *Directory) PutUser(u User) (User, error) {
+	if strings.TrimSpace(u.UserName) == "" {
+		return u, errors.New("user name is required")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if u.ID == "" {
+		u.ID = newID()
+	} else if _, ok := d.users[u.ID]; !ok {
+		return u, ErrNotFound
+	}
+	for id, other := range d.users {
+		if id != u.ID && strings.EqualFold(other.UserName, u.UserName) {
+			return u, fmt.Errorf("user %s %w", u.UserName, ErrConflict)
+		}
+	}
+	u.Modified = time.Now().UTC()
+	d.users[u.ID] = u
+	return u, d.save()
+}
+
+// DeleteUser removes a user and its group memberships
+func (d *Directory) DeleteUser(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(d.users, id)
+	for gid, g := range d.groups {
+		if members := removeMember(g.Members, id); len(members) != len(g.Members) {
+			g.Members = members
+			d.groups[gid] = g
+		}
+	}
+	return d.save()
+}
+
+// Groups returns the groups sorted by display name
+func (d *Directory) Groups() []Group {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.sortedGroups()
+}
+
+func (d *Directory) sortedGroups() []Group {
+	groups := make([]Group, 0, len(d.groups))
+	for _, g := range d.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].DisplayName < groups[j].DisplayName })
+	return groups
+}
+
+// Group returns a group by ID
+func (d *Directory) Group(id string) (Group, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	g, ok := d.groups[id]
+	return g, ok
+}
+
+// PutGroup creates a group, when its ID is empty, or replaces one. Display
+// names are unique, and members must be users of the directory.
+func (d *Directory) PutGroup(g Group) (Group, error) {
+	if strings.TrimSpace(g.DisplayName) == "" {
+		return g, errors.New("display name is required")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if g.ID == "" {
+		g.ID = newID()
+	} else if _, ok := d.groups[g.ID]; !ok {
+		return g, ErrNotFound
+	}
+	for id, other := range d.groups {
+		if id != g.ID && other.DisplayName == g.DisplayName {
+			return g, fmt.Errorf("group %s %w", g.DisplayName, ErrConflict)
+		}
+	}
+	members := []string{}
+	for _, id := range g.Members {
+		if _, ok := d.users[id]; !ok {
+			return g, fmt.Errorf("member %s: user %w", id, ErrNotFound)
+		}
+		if len(removeMember(members, id)) == len(members) {
+			members = append(members, id)
+		}
+	}
+	g.Members = members
+	g.Modified = time.Now().UTC()
+	d.groups[g.ID] = g
+	return g, d.save()
+}
+
+// DeleteGroup removes a group
+func (d *Directory) DeleteGroup(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.groups[id]; !ok {
+		return ErrNotFound
+	}
+	delete(d.groups, id)
+	return d.save()
+}
+
+// removeMember returns members without id
+func removeMember(members []string, id string) []string {
+	kept := make([]string, 0, len(members))
+	for _, m := range members {
+		if m != id {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// GroupsOf returns the display names of the groups of the active user with
+// a user name, sorted
+func (d *Directory) GroupsOf(userName string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	groups := []string{}
+	var id string
+	for _, u := range d.users {
+		if u.Active && strings.EqualFold(u.UserName, userName) {
+			id = u.ID
+			break
+		}
+	}
+	if id == "" {
+		return groups
+	}
+	for _, g := range d.groups {
+		for _, member := range g.Members {
+			if member == id {
+				groups = append(groups, g.DisplayName)
+				break
+			}
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Import replaces the directory with the groups of an export, such as one
+// produced from LDAP, which maps each group name to the user names of its
+// members in YAML or JSON:
+//
+//	team-data-science: [alice, bob]
+//	team-frontend: [carol]
+//
+// Imported users and groups are identified by their names.
+func (d *Directory) Import(data []byte) error {
+	var export map[string][]string
+	if err := yaml.Unmarshal(data, &export); err != nil {
+		return fmt.Errorf("invalid directory export: %w", err)
+	}
+
+	now := time.Now().UTC()
+	users, groups := map[string]User{}, map[string]Group{}
+	for name, members := range export {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("invalid directory export: empty group name")
+		}
+		g := Group{ID: name, DisplayName: name, Members: []string{}, Modified: now}
+		for _, member := range members {
+			id := strings.ToLower(member)
+			if _, ok := users[id]; !ok {
+				users[id] = User{ID: id, UserName: member, Active: true, Modified: now}
+			}
+			g.Members = append(g.Members, id)
+		}
+		groups[name] = g
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.users, d.groups = users, groups
+	return d.save()
+}
+
+// Restore replaces the directory with users and groups as Users and Groups
+// return them, such as those of another server
+func (d *Directory) Restore(users []User, groups []Group) error {
+	byID := make(map[string]User, len(users))
+	for _, u := range users {
+		if u.ID == "" || strings.TrimSpace(u.UserName) == "" {
+			return errors.New("users must have an ID and a user name")
+		}
+		byID[u.ID] = u
+	}
+	groupsByID := make(map[string]Group, len(groups))
+	for _, g := range groups {
+		if g.ID == "" {
+			return errors.New("groups must have an ID")
+		}
+		for _, member := range g.Members {
+			if _, ok := byID[member]; !ok {
+				return fmt.Errorf("group %s: member %s %w", g.ID, member, ErrNotFound)
+			}
+		}
+		groupsByID[g.ID] = g
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.users, d.groups = byID, groupsByID
+	return d.save()
+}
+
+// ImportFile replaces the directory with the export in a file
+func (d *Directory) ImportFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read directory export: %w", err)
+	}
+	return d.Import(data)
+}
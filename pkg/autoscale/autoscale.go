@@ -0,0 +1,127 @@
+// Package autoscale recommends how many API replicas should run jobs, from
+// the queue depth and expected wait of the job manager, and applies the
+// recommendation through a webhook, kubectl, or the AWS CLI. External
+// autoscalers can read the same recommendation from the API instead.
+package autoscale
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"forgeai/pkg/jobs"
+)
+
+// Policy defaults
+const (
+	DefaultTargetWait        = 30 * time.Second
+	DefaultTargetUtilization = 0.8
+	DefaultMaxReplicas       = 10
+)
+
+// Policy decides how much worker capacity a load needs
+type Policy struct {
+	// TargetWait is how long pending jobs may wait for a worker;
+	// DefaultTargetWait when zero
+	TargetWait time.Duration `json:"target_wait_ns"`
+
+	// TargetUtilization is the share of workers that should be busy;
+	// DefaultTargetUtilization when zero
+	TargetUtilization float64 `json:"target_utilization"`
+
+	// MinReplicas and MaxReplicas bound the recommendation; 1 and
+	// DefaultMaxReplicas when zero
+	MinReplicas int `json:"min_replicas"`
+	MaxReplicas int `json:"max_replicas"`
+
+	// WorkersPerReplica is the capacity of one replica; the capacity of
+	// the load when zero
+	WorkersPerReplica int `json:"workers_per_replica"`
+}
+
+// WithDefaults fills the zero fields of p
+func (p Policy) WithDefaults() Policy {
+	if p.TargetWait <= 0 {
+		p.TargetWait = DefaultTargetWait
+	}
+	if p.TargetUtilization <= 0 {
+		p.TargetUtilization = DefaultTargetUtilization
+	}
+	if p.MinReplicas <= 0 {
+		p.MinReplicas = 1
+	}
+	if p.MaxReplicas <= 0 {
+		p.MaxReplicas = DefaultMaxReplicas
+	}
+	return p
+}
+
+// Validate checks the bounds of p
+func (p Policy) Validate() error {
+	if p.TargetWait < 0 || p.MinReplicas < 0 || p.MaxReplicas < 0 || p.WorkersPerReplica < 0 {
+		return fmt.Errorf("autoscale targets and bounds must not be negative")
+	}
+	if p.TargetUtilization < 0 || p.TargetUtilization > 1 {
+		return fmt.Errorf("target utilization must be between 0 and 1")
+	}
+	if p.MaxReplicas > 0 && p.MinReplicas > p.MaxReplicas {
+		return fmt.Errorf("min replicas %d exceed max replicas %d", p.MinReplicas, p.MaxReplicas)
+	}
+	return nil
+}
+
+// Recommendation is the worker capacity a load needs
+type Recommendation struct {
+	Load jobs.Load `json:"load"`
+
+	// Workers is the capacity needed to keep running jobs at the target
+	// utilization and drain pending jobs within the target wait
+	Workers int `json:"workers"`
+
+	// Replicas is Workers in replicas, within the bounds of the policy
+	Replicas int `json:"replicas"`
+
+	// Reason explains the recommendation
+	Reason string `json:"reason"`
+}
+
+// Recommend returns the capacity a load needs under p. Every running job
+// needs a worker, and pending jobs need enough workers to start within
+// TargetWait given the typical duration of jobs; the sum is kept at
+// TargetUtilization.
+func (p Policy) Recommend(load jobs.Load) Recommendation {
+	p = p.WithDefaults()
+	perReplica := p.WorkersPerReplica
+	if perReplica <= 0 {
+		perReplica = load.Capacity
+	}
+	if perReplica <= 0 {
+		perReplica = 1
+	}
+
+	// A worker runs TargetWait/TypicalDuration pending jobs within the
+	// target wait; without a typical duration every pending job needs one
+	backlog := load.Pending
+	if load.TypicalDuration > 0 && load.Pending > 0 {
+		perWorker := float64(p.TargetWait) / float64(load.TypicalDuration)
+		if perWorker > 1 {
+			backlog = int(math.Ceil(float64(load.Pending) / perWorker))
+		}
+	}
+	demand := load.Running + backlog
+	workers := int(math.Ceil(float64(demand) / p.TargetUtilization))
+
+	rec := Recommendation{Load: load, Workers: workers}
+	rec.Replicas = (workers + perReplica - 1) / perReplica
+	switch {
+	case rec.Replicas < p.MinReplicas:
+		rec.Replicas = p.MinReplicas
+		rec.Reason = fmt.Sprintf("%d running and %d pending jobs fit the minimum of %d replicas", load.Running, load.Pending, p.MinReplicas)
+	case rec.Replicas > p.MaxReplicas:
+		rec.Replicas = p.MaxReplicas
+		rec.Reason = fmt.Sprintf("%d workers are needed for %d running and %d pending jobs, capped at %d replicas", workers, load.Running, load.Pending, p.MaxReplicas)
+	default:
+		rec.Reason = fmt.Sprintf("%d workers are needed for %d running and %d pending jobs", workers, load.Running, load.Pending)
+	}
+	return rec
+}
@@ -0,0 +1,115 @@
+package autoscale
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"forgeai/pkg/jobs"
+)
+
+// Controller defaults
+const (
+	DefaultInterval       = 30 * time.Second
+	DefaultScaleDownDelay = 5 * time.Minute
+)
+
+// Status reports the last check of a controller
+type Status struct {
+	Recommendation *Recommendation `json:"recommendation,omitempty"`
+
+	// Replicas is the count last applied, zero before the first
+	Replicas  int       `json:"replicas"`
+	ScaledAt  time.Time `json:"scaled_at,omitempty"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+
+	// Error is why the last scale failed
+	Error string `json:"error,omitempty"`
+}
+
+// Controller applies the recommendations of a policy through a scaler. It
+// scales up as soon as more replicas are recommended, and down only when
+// fewer have been recommended for ScaleDownDelay, so that short lulls do not
+// remove replicas that are needed again moments later.
+type Controller struct {
+	Policy Policy
+	Scaler Scaler
+
+	// Interval is how often the load is checked; DefaultInterval when zero
+	Interval time.Duration
+
+	// ScaleDownDelay is how long fewer replicas must be recommended before
+	// they are applied; DefaultScaleDownDelay when zero
+	ScaleDownDelay time.Duration
+
+	mu     sync.Mutex
+	status Status
+
+	// lowSince is when the recommendations fell below the applied count
+	lowSince time.Time
+}
+
+// Run checks the load of manager every Interval until ctx is done
+func (c *Controller) Run(ctx context.Context, manager *jobs.Manager) {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.Check(ctx, manager.Load())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check recommends replicas for load and applies them when due
+func (c *Controller) Check(ctx context.Context, load jobs.Load) Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	rec := c.Policy.Recommend(load)
+	c.status.Recommendation = &rec
+	c.status.CheckedAt = now
+
+	delay := c.ScaleDownDelay
+	if delay <= 0 {
+		delay = DefaultScaleDownDelay
+	}
+	switch {
+	case rec.Replicas == c.status.Replicas && c.status.Error == "":
+		c.lowSince = time.Time{}
+		return c.status
+	case rec.Replicas < c.status.Replicas:
+		if c.lowSince.IsZero() {
+			c.lowSince = now
+		}
+		if now.Sub(c.lowSince) < delay {
+			return c.status
+		}
+	}
+
+	if err := c.Scaler.Scale(ctx, rec); err != nil {
+		c.status.Error = err.Error()
+		return c.status
+	}
+	c.status.Replicas = rec.Replicas
+	c.status.ScaledAt = now
+	c.status.Error = ""
+	c.lowSince = time.Time{}
+	return c.status
+}
+
+// Status returns the last check
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
@@ -0,0 +1,111 @@
+package autoscale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"forgeai/pkg/offline"
+)
+
+// Scaler sets the number of replicas that run jobs
+type Scaler interface {
+	Scale(ctx context.Context, rec Recommendation) error
+}
+
+// Webhook posts each recommendation as JSON to URL, for autoscalers that
+// the controller cannot drive directly
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Scale posts rec and fails on non-2xx responses
+func (w *Webhook) Scale(ctx context.Context, rec Recommendation) error {
+	if err := offline.Check("autoscaling webhook"); err != nil {
+		return err
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode recommendation: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post recommendation: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("recommendation rejected with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// ReplicasPlaceholder is replaced by the recommended replicas in the
+// arguments of a Command
+const ReplicasPlaceholder = "{replicas}"
+
+// Command runs a program to scale, such as kubectl or the AWS CLI
+type Command struct {
+	// Args is the program and its arguments; ReplicasPlaceholder in an
+	// argument is replaced by the recommended replicas
+	Args []string
+}
+
+// Kubernetes scales a deployment with kubectl
+func Kubernetes(deployment, namespace string) *Command {
+	args := []string{"kubectl", "scale", "deployment/" + deployment, "--replicas=" + ReplicasPlaceholder}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	return &Command{Args: args}
+}
+
+// EC2 sets the desired capacity of an auto scaling group with the AWS CLI
+func EC2(group, region string) *Command {
+	args := []string{"aws", "autoscaling", "set-desired-capacity",
+		"--auto-scaling-group-name", group, "--desired-capacity", ReplicasPlaceholder}
+	if region != "" {
+		args = append(args, "--region", region)
+	}
+	return &Command{Args: args}
+}
+
+// Scale runs the command with the recommended replicas
+func (c *Command) Scale(ctx context.Context, rec Recommendation) error {
+	if len(c.Args) == 0 {
+		return fmt.Errorf("no scale command configured")
+	}
+	if err := offline.Check("autoscaling with " + c.Args[0]); err != nil {
+		return err
+	}
+	replicas := strconv.Itoa(rec.Replicas)
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = strings.ReplaceAll(arg, ReplicasPlaceholder, replicas)
+	}
+
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"forgeai/pkg/hardware"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/state"
+)
+
+var (
+	adminServer      string
+	adminToken       string
+	drainReason      string
+	drainWait        bool
+	drainWaitTimeout time.Duration
+	calibration      time.Duration
+	backfillSource   string
+	exportOutput     string
+	exportJobs       bool
+	importSettings   bool
+)
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administer a running API server",
+}
+
+var adminDrainCmd = &cobra.Command{
+	Use:   "drain",
+	Short: "Put an API server in maintenance mode and drain its jobs",
+	Long: `Put an API server in maintenance mode: new jobs are refused with 503 and a
+Retry-After header, and /readyz reports the server as not ready, while jobs
+that already exist keep running. With --wait, block until they have finished.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body, err := json.Marshal(map[string]string{"reason": drainReason})
+		if err != nil {
+			return err
+		}
+		m, err := maintenanceRequest(cmd.Context(), http.MethodPost, body)
+		if err != nil {
+			return err
+		}
+
+		if drainWait {
+			ctx, cancel := context.WithTimeout(cmd.Context(), drainWaitTimeout)
+			defer cancel()
+			for !m.Drained {
+				if !jsonOutput {
+					fmt.Printf("Draining: %d running, %d pending\n", m.Running, m.Pending)
+				}
+				select {
+				case <-ctx.Done():
+					return fmt.Errorf("jobs did not drain within %s", drainWaitTimeout)
+				case <-time.After(time.Second):
+				}
+				if m, err = maintenanceRequest(ctx, http.MethodGet, nil); err != nil {
+					return err
+				}
+			}
+		}
+		return printMaintenance(m)
+	},
+}
+
+var adminResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Take an API server out of maintenance mode",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := maintenanceRequest(cmd.Context(), http.MethodDelete, nil)
+		if err != nil {
+			return err
+		}
+		return printMaintenance(m)
+	},
+}
+
+var adminStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the maintenance mode of an API server",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := maintenanceRequest(cmd.Context(), http.MethodGet, nil)
+		if err != nil {
+			return err
+		}
+		return printMaintenance(m)
+	},
+}
+
+var adminCalibrateCmd = &cobra.Command{
+	Use:   "calibrate",
+	Short: "Run the hardware calibration benchmark on an API server",
+	Long: `Run the calibration benchmark on an API server, which scores its hardware
+against the reference hardware. Job durations are normalized by the score, so
+that workers on different hardware can be compared. Jobs running at the same
+time slow the benchmark down; drain the server first for a stable score.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body, err := json.Marshal(map[string]string{"duration": calibration.String()})
+		if err != nil {
+			return err
+		}
+		var status struct {
+			Class        hardware.Class `json:"class"`
+			CalibratedAt time.Time      `json:"calibrated_at"`
+		}
+		if err := adminRequest(cmd.Context(), http.MethodPost, "/v1/admin/hardware/calibrate", body, &status); err != nil {
+			return err
+		}
+		if jsonOutput {
+			return json.NewEncoder(os.Stdout).Encode(status)
+		}
+		class := status.Class
+		fmt.Printf("Worker %s: %s, %g of %d CPUs, load %.2f\n", class.Worker, class.CPUModel, class.Cores(), class.CPUs, class.Load1)
+		fmt.Printf("Score: %.2f\n", class.Score)
+		return nil
+	},
+}
+
+var adminBackfillCmd = &cobra.Command{
+	Use:   "backfill [file]",
+	Short: "Import the job log of a legacy runner into an API server",
+	Long: `Import a JSON lines file of executions from a legacy runner into an API
+server as finished jobs, so that analytics, the job log, quarantine, and
+deduplication start with its history. Each line holds the id, language,
+code, stdout, stderr, exit_code, error, status, duration_ms, created_at,
+finished_at, and labels of one execution. Imported jobs are labeled
+backfill=<source>. Records imported before are skipped, so a failed
+backfill can be run again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read legacy log: %w", err)
+		}
+		path := "/v1/admin/backfill?source=" + url.QueryEscape(backfillSource)
+		var report jobs.BackfillReport
+		if err := adminRequest(cmd.Context(), http.MethodPost, path, body, &report); err != nil {
+			return err
+		}
+		if jsonOutput {
+			return json.NewEncoder(os.Stdout).Encode(report)
+		}
+		fmt.Printf("Imported %d jobs, skipped %d imported before, %d failed\n", report.Imported, report.Skipped, report.Failed)
+		for _, msg := range report.Errors {
+			fmt.Printf("  %s\n", msg)
+		}
+		if report.Failed > 0 {
+			return fmt.Errorf("%d records could not be imported", report.Failed)
+		}
+		return nil
+	},
+}
+
+// maintenanceRequest calls the maintenance endpoint of the API server
+func maintenanceRequest(ctx context.Context, method string, body []byte) (jobs.Maintenance, error) {
+	var m jobs.Maintenance
+	err := adminRequest(ctx, method, "/v1/admin/maintenance", body, &m)
+	return m, err
+}
+
+// adminRequest calls an admin endpoint of the API server and decodes its
+// response into v
+var adminExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the state of an API server to an archive",
+	Long: `Export the state of an API server to a versioned archive, to migrate it to
+another host or storage backend: its settings and language environments,
+execution tokens (by hash, never the tokens themselves), directory users and
+groups, quota overrides, quarantine, templates, and fixtures. With --jobs
+the archive includes the history of finished jobs.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := "/v1/admin/state"
+		if exportJobs {
+			path += "?jobs=true"
+		}
+		f, err := os.Create(exportOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create archive: %w", err)
+		}
+		defer f.Close()
+		if err := adminDownload(cmd.Context(), path, f); err != nil {
+			os.Remove(exportOutput)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported the state of %s to %s\n", adminServer, exportOutput)
+		return nil
+	},
+}
+
+var adminImportCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import an archive of forgeai admin export into an API server",
+	Long: `Import an archive of forgeai admin export into an API server. Entries
+replace those with the same name, so a failed import can be run again.
+The settings of the archive are applied only with --settings, and last
+until the server reloads its configuration file; copy the file as well.
+Languages of the exporting server that this one does not support are
+reported.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		path := "/v1/admin/state"
+		if importSettings {
+			path += "?settings=true"
+		}
+		var report state.Report
+		if err := adminRequest(cmd.Context(), http.MethodPost, path, body, &report); err != nil {
+			return err
+		}
+		if jsonOutput {
+			return json.NewEncoder(os.Stdout).Encode(report)
+		}
+
+		fmt.Printf("Imported the state of %s exported at %s\n", report.Manifest.Server, report.Manifest.ExportedAt.Format(time.RFC3339))
+		sections := make([]string, 0, len(report.Imported))
+		for section := range report.Imported {
+			sections = append(sections, section)
+		}
+		sort.Strings(sections)
+		for _, section := range sections {
+			fmt.Printf("  %-12s %d\n", section, report.Imported[section])
+		}
+		if len(report.Skipped) > 0 {
+			fmt.Printf("Skipped: %s\n", strings.Join(report.Skipped, ", "))
+		}
+		if len(report.MissingEnvironments) > 0 {
+			fmt.Printf("Languages not supported here: %s\n", strings.Join(report.MissingEnvironments, ", "))
+		}
+		if report.Jobs != nil && report.Jobs.Failed > 0 {
+			for _, msg := range report.Jobs.Errors {
+				fmt.Printf("  %s\n", msg)
+			}
+			return fmt.Errorf("%d jobs could not be imported", report.Jobs.Failed)
+		}
+		return nil
+	},
+}
+
+func adminRequest(ctx context.Context, method, path string, body []byte, v interface{}) error {
+	url := strings.TrimSuffix(adminServer, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	setAdminCredentials(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach API server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("API server returned %s: %s", resp.Status, apiErr.Error)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// adminDownload copies the response of an admin GET request to w
+func adminDownload(ctx context.Context, path string, w io.Writer) error {
+	url := strings.TrimSuffix(adminServer, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	setAdminCredentials(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach API server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("API server returned %s: %s", resp.Status, apiErr.Error)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to download: %w", err)
+	}
+	return nil
+}
+
+// setAdminCredentials authorizes an admin request with the admin token or
+// API key of --token
+func setAdminCredentials(req *http.Request) {
+	if adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+	}
+}
+
+// printMaintenance prints the maintenance mode of a server
+func printMaintenance(m jobs.Maintenance) error {
+	if jsonOutput {
+		return json.NewEncoder(os.Stdout).Encode(m)
+	}
+
+	if !m.Enabled {
+		fmt.Printf("Accepting jobs: %d running, %d pending\n", m.Running, m.Pending)
+		return nil
+	}
+	fmt.Printf("Maintenance mode since %s: %s\n", m.Since.Format(time.RFC3339), m.Reason)
+	if m.Drained {
+		fmt.Println("Drained: no jobs left")
+	} else {
+		fmt.Printf("Draining: %d running, %d pending\n", m.Running, m.Pending)
+	}
+	return nil
+}
+
+// defaultAdminServer returns the API server URL from FORGEAI_API_URL, or
+// the local default
+func defaultAdminServer() string {
+	if url := os.Getenv("FORGEAI_API_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8080"
+}
+
+func init() {
+	adminCmd.PersistentFlags().StringVar(&adminServer, "server", defaultAdminServer(), "URL of the API server")
+	adminCmd.PersistentFlags().StringVar(&adminToken, "token", os.Getenv("FORGEAI_ADMIN_TOKEN"), "Admin token or API key of an admin (default $FORGEAI_ADMIN_TOKEN)")
+	adminDrainCmd.Flags().StringVar(&drainReason, "reason", "", "Reason reported to refused clients")
+	adminDrainCmd.Flags().BoolVar(&drainWait, "wait", false, "Wait until running and pending jobs have finished")
+	adminDrainCmd.Flags().DurationVar(&drainWaitTimeout, "wait-timeout", 10*time.Minute, "How long --wait waits for jobs to finish")
+	adminCalibrateCmd.Flags().DurationVar(&calibration, "duration", hardware.DefaultCalibration, "How long the benchmark runs")
+	adminBackfillCmd.Flags().StringVar(&backfillSource, "source", "legacy", "Value of the backfill label of imported jobs")
+	adminExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "forgeai-state.tar.gz", "File to write the archive to")
+	adminExportCmd.Flags().BoolVar(&exportJobs, "jobs", false, "Include the history of finished jobs")
+	adminImportCmd.Flags().BoolVar(&importSettings, "settings", false, "Apply the settings of the archive")
+
+	adminCmd.AddCommand(adminDrainCmd)
+	adminCmd.AddCommand(adminResumeCmd)
+	adminCmd.AddCommand(adminStatusCmd)
+	adminCmd.AddCommand(adminCalibrateCmd)
+	adminCmd.AddCommand(adminBackfillCmd)
+	adminCmd.AddCommand(adminExportCmd)
+	adminCmd.AddCommand(adminImportCmd)
+	rootCmd.AddCommand(adminCmd)
+}
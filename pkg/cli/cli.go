@@ -6,13 +6,23 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"forgeai/pkg/client"
+	"forgeai/pkg/compare"
+	"forgeai/pkg/config"
 	"forgeai/pkg/container"
 	"forgeai/pkg/executor"
+	"forgeai/pkg/images"
+	"forgeai/pkg/languages"
+	"forgeai/pkg/httpclient"
+	"forgeai/pkg/offline"
 	"forgeai/pkg/plugin"
+	"forgeai/pkg/runtime"
 	"forgeai/pkg/sandbox"
 )
 
@@ -22,6 +32,29 @@ var (
 	pluginDir    string
 	timeout      time.Duration
 	memoryLimit  int
+	useNsjail    bool
+	nsjailProfile string
+	nsjailInterpreters map[string]string
+	nsjailMounts []string
+	nsjailTmpSize int
+	nsjailHome   string
+	traceMode    bool
+	trackWorkspace bool
+	inlineFiles  int64
+	profileMode  bool
+	flamegraphFile string
+	coverageMode bool
+	scanImages   bool
+	dryRun       bool
+	dnsMode      string
+	dnsAllow     []string
+	mapTracebacks bool
+	timezone     string
+	locale       string
+	platform     string
+	apiServer    string
+	offlineFallback bool
+	offlineMode  bool
 )
 
 var rootCmd = &cobra.Command{
@@ -29,6 +62,9 @@ var rootCmd = &cobra.Command{
 	Short: "ForgeAI is a secure sandboxed code executor",
 	Long: `ForgeAI is a CLI tool that executes AI-generated code in a secure sandboxed environment.
 It supports multiple languages and provides isolation to prevent host compromise.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return configureNetwork()
+	},
 }
 
 var runCmd = &cobra.Command{
@@ -37,7 +73,7 @@ var runCmd = &cobra.Command{
 	Long:  `Execute the provided code in the specified language within a secure sandbox.`,
 	Args:  cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		language := args[0]
+		language := normalizeLanguage(args[0])
 		code := args[1]
 
 		// Get the appropriate executor
@@ -46,6 +82,10 @@ var runCmd = &cobra.Command{
 			return fmt.Errorf("failed to get executor: %w", err)
 		}
 
+		if dryRun {
+			return printDryRun(exec)
+		}
+
 		// Execute code
 		result, err := exec.Execute(context.Background(), language, code)
 		if err != nil {
@@ -70,6 +110,10 @@ var execCmd = &cobra.Command{
 			return fmt.Errorf("failed to get executor: %w", err)
 		}
 
+		if dryRun {
+			return printDryRun(exec)
+		}
+
 		// Execute file
 		result, err := exec.ExecuteFile(context.Background(), file)
 		if err != nil {
@@ -80,6 +124,63 @@ var execCmd = &cobra.Command{
 	},
 }
 
+var diffCmd = &cobra.Command{
+	Use:   "diff [base-file] [candidate-file]",
+	Short: "Compare the behavior of two versions of a file",
+	Long: `Execute two versions of a file in parallel sandboxes with the same settings and
+report the differences in their output, exit codes, durations, and artifacts.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Get the appropriate executor
+		exec, err := getExecutor()
+		if err != nil {
+			return fmt.Errorf("failed to get executor: %w", err)
+		}
+
+		// Execute both versions at once
+		results := make([]*sandbox.ExecutionResult, len(args))
+		errs := make([]error, len(args))
+		var wg sync.WaitGroup
+		for i, file := range args {
+			wg.Add(1)
+			go func(i int, file string) {
+				defer wg.Done()
+				results[i], errs[i] = exec.ExecuteFile(context.Background(), file)
+			}(i, file)
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				return fmt.Errorf("failed to execute %s: %w", args[i], err)
+			}
+		}
+
+		diff := compare.Results(results[0], results[1])
+		if jsonOutput {
+			return json.NewEncoder(os.Stdout).Encode(diff)
+		}
+
+		fmt.Println(diff.Summary())
+		fmt.Printf("Duration: %s -> %s (%s)\n", diff.Duration.Base, diff.Duration.Candidate, diff.Duration.Change)
+		for _, stream := range []struct {
+			name string
+			diff compare.TextDiff
+		}{{"stdout", diff.Stdout}, {"stderr", diff.Stderr}} {
+			if !stream.diff.Changed {
+				continue
+			}
+			fmt.Printf("--- %s\n", stream.name)
+			for _, line := range stream.diff.Lines {
+				fmt.Printf("%s%d: %s\n", line.Op, line.Line, line.Text)
+			}
+			if stream.diff.Truncated {
+				fmt.Println("... more lines changed")
+			}
+		}
+		return nil
+	},
+}
+
 var langCmd = &cobra.Command{
 	Use:   "lang",
 	Short: "Manage language support",
@@ -96,14 +197,19 @@ var langListCmd = &cobra.Command{
 			return fmt.Errorf("failed to get executor: %w", err)
 		}
 
-		languages := exec.SupportedLanguages()
+		supported := exec.SupportedLanguages()
 
 		if jsonOutput {
-			return json.NewEncoder(os.Stdout).Encode(languages)
+			return json.NewEncoder(os.Stdout).Encode(supported)
 		}
 
+		loadLanguageAliases()
 		fmt.Println("Supported languages:")
-		for _, lang := range languages {
+		for _, lang := range supported {
+			if aliases := languages.AliasesOf(lang); len(aliases) > 0 {
+				fmt.Printf("  - %s (%s)\n", lang, strings.Join(aliases, ", "))
+				continue
+			}
 			fmt.Printf("  - %s\n", lang)
 		}
 		return nil
@@ -126,9 +232,33 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&pluginDir, "plugin-dir", "", "Directory to load plugins from")
 	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 30*time.Second, "Execution timeout")
 	rootCmd.PersistentFlags().IntVar(&memoryLimit, "memory-limit", 128, "Memory limit in MB")
+	rootCmd.PersistentFlags().BoolVar(&traceMode, "trace", false, "Record syscalls and network activity (local execution only)")
+	rootCmd.PersistentFlags().BoolVar(&trackWorkspace, "track-workspace", false, "Report files created, modified, or deleted by the program (local execution only)")
+	rootCmd.PersistentFlags().Int64Var(&inlineFiles, "inline-files", 0, "Include created files up to this many bytes in the result (local execution only)")
+	rootCmd.PersistentFlags().BoolVar(&profileMode, "profile", false, "Report peak memory and CPU use of the program (local execution only)")
+	rootCmd.PersistentFlags().StringVar(&flamegraphFile, "flamegraph", "", "Write a flamegraph of the program to this SVG file; requires py-spy and Python (local execution only)")
+	rootCmd.PersistentFlags().BoolVar(&coverageMode, "coverage", false, "Report how much of the program ran, with coverage.py, go -cover, or nyc (local execution only)")
+	rootCmd.PersistentFlags().BoolVar(&scanImages, "scan-images", false, "Block container images with critical vulnerabilities")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Report the guarantees of the selected executor and warn about unsupported options without executing")
+	rootCmd.PersistentFlags().BoolVar(&useNsjail, "nsjail", false, "Use nsjail execution")
+	rootCmd.PersistentFlags().StringVar(&dnsMode, "dns", "", "DNS mode of networked containers: log, allowlist, none, or docker (container execution only)")
+	rootCmd.PersistentFlags().StringVar(&platform, "platform", "", "Pin containers to a platform such as linux/amd64, emulating other architectures (container execution only)")
+	rootCmd.PersistentFlags().StringSliceVar(&dnsAllow, "dns-allow", nil, "Domains answered in allowlist DNS mode (container execution only)")
+	rootCmd.PersistentFlags().BoolVar(&mapTracebacks, "map-tracebacks", false, "Report the file of executed code as <submitted code> in tracebacks and compiler errors")
+	rootCmd.PersistentFlags().StringVar(&timezone, "timezone", "", "Time zone of the program, such as Europe/Berlin (default UTC)")
+	rootCmd.PersistentFlags().StringVar(&locale, "locale", "", "Locale of the program, such as en_US.UTF-8 (default C.UTF-8)")
+	rootCmd.PersistentFlags().StringVar(&apiServer, "server", "", "Run code on this ForgeAI API server instead of locally")
+	rootCmd.PersistentFlags().BoolVar(&offlineFallback, "offline-fallback", false, "Run code with the selected local executor when --server is unreachable, with weaker guarantees")
+	rootCmd.PersistentFlags().BoolVar(&offlineMode, "offline", false, "Make no outbound network requests: no registry calls, image pulls, or remote servers (also offline: true in the config file or FORGEAI_OFFLINE=true)")
+	rootCmd.PersistentFlags().StringVar(&nsjailProfile, "nsjail-profile", "", "nsjail config file to use instead of a generated profile")
+	rootCmd.PersistentFlags().StringToStringVar(&nsjailInterpreters, "nsjail-interpreter", nil, "Program that runs a language inside the jail, such as go=/opt/go/bin/go")
+	rootCmd.PersistentFlags().StringSliceVar(&nsjailMounts, "nsjail-mount", nil, "Directories mounted read-only in generated nsjail profiles, such as /opt/go")
+	rootCmd.PersistentFlags().IntVar(&nsjailTmpSize, "nsjail-tmp-size", runtime.DefaultTmpSize, "Size of /tmp in generated nsjail profiles in MB")
+	rootCmd.PersistentFlags().StringVar(&nsjailHome, "nsjail-home", "/tmp", "HOME inside the jail of generated nsjail profiles")
 
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(diffCmd)
 
 	langCmd.AddCommand(langListCmd)
 	rootCmd.AddCommand(langCmd)
@@ -140,8 +270,95 @@ func Execute() error {
 	return rootCmd.Execute()
 }
 
+// loadLanguageAliases applies the language aliases of the config file
+func loadLanguageAliases() {
+	file, err := config.LoadDefaultFile()
+	if err != nil {
+		return
+	}
+	if err := languages.SetAliases(file.Languages.Aliases); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring languages.aliases: %v\n", err)
+	}
+}
+
+// configureNetwork turns on offline mode for --offline, the offline switch
+// of the config file, or FORGEAI_OFFLINE, and applies the proxy and
+// certificates of the http section of the config file
+func configureNetwork() error {
+	file, err := config.LoadDefaultFile()
+	if err != nil {
+		file = &config.File{}
+	}
+	if offlineMode || offline.FromEnv() || file.Offline {
+		offline.Enable(true)
+	}
+	if err := httpclient.Configure(file.HTTP); err != nil {
+		return fmt.Errorf("invalid http configuration: %w", err)
+	}
+	return nil
+}
+
+// normalizeLanguage resolves a language alias, such as py for python
+func normalizeLanguage(name string) string {
+	loadLanguageAliases()
+	return languages.Normalize(name)
+}
+
 // getExecutor returns the appropriate executor based on the flags
 func getExecutor() (sandbox.Executor, error) {
+	if apiServer == "" {
+		return localExecutor()
+	}
+	
+	remote := &client.Client{
+		Server:      apiServer,
+		Timeout:     int(timeout.Seconds()),
+		MemoryLimit: memoryLimit,
+		Locale:      sandbox.Locale{Timezone: timezone, Name: locale},
+	}
+	if err := remote.Locale.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid locale: %w", err)
+	}
+	if offlineFallback {
+		local, err := localExecutor()
+		if err != nil {
+			return nil, err
+		}
+		remote.Fallback.Enabled = true
+		remote.Local = local
+	}
+	return remote, nil
+}
+
+// localExecutor returns the executor that runs code on this host
+func localExecutor() (sandbox.Executor, error) {
+	file, err := config.LoadDefaultFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+	rlimits := sandbox.Rlimits{
+		OpenFiles: file.Rlimits.OpenFiles,
+		FileSize:  file.Rlimits.FileSize,
+		StackSize: file.Rlimits.StackSize,
+		CoreDumps: file.Rlimits.CoreDumps,
+	}
+	if err := rlimits.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid resource limits: %w", err)
+	}
+	output := sandbox.OutputLimits{Head: file.Output.Head, Tail: file.Output.Tail}
+	if err := output.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid output limits: %w", err)
+	}
+
+	// The flags override the time zone and locale of the config file
+	loc := sandbox.Locale{Timezone: timezone, Name: locale}.WithDefaults(sandbox.Locale{
+		Timezone: file.Locale.Timezone,
+		Name:     file.Locale.Locale,
+	})
+	if err := loc.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid locale: %w", err)
+	}
+	
 	if pluginDir != "" {
 		// Use plugin manager
 		manager := plugin.NewManager()
@@ -155,28 +372,165 @@ func getExecutor() (sandbox.Executor, error) {
 			fmt.Println("Warning: Both --plugin-dir and --container flags are set. Using plugins.")
 		}
 		
+		dockerExec := container.NewDockerExecutor()
+		dockerExec.Output = output
+		dockerExec.Locale = loc
+		if err := configureDocker(dockerExec, file); err != nil {
+			return nil, err
+		}
+		localExec := executor.NewLocalExecutor()
+		localExec.Output = output
+		localExec.Locale = loc
+		
 		// Return a composite executor that can handle both plugins and default executors
 		return &CompositeExecutor{
 			PluginManager: manager,
-			LocalExecutor: executor.NewLocalExecutor(),
-			DockerExecutor: container.NewDockerExecutor(),
+			LocalExecutor: localExec,
+			DockerExecutor: dockerExec,
 			UseContainer: containerized,
 		}, nil
+	} else if useNsjail {
+		// Use nsjail executor
+		nsjailExec := runtime.NewNsjailExecutor()
+		nsjailExec.Timeout = timeout
+		nsjailExec.MemoryLimit = memoryLimit
+		nsjailExec.ProfilePath = nsjailProfile
+		nsjailExec.MapTracebacks = mapTracebacks
+		nsjailExec.Output = output
+		nsjailExec.Locale = loc
+		nsjailExec.Interpreters = nsjailInterpreters
+		nsjailExec.Mounts = nsjailMounts
+		nsjailExec.TmpSize = nsjailTmpSize
+		nsjailExec.Home = nsjailHome
+		return nsjailExec, nil
 	} else if containerized {
 		// Use containerized executor
 		dockerExec := container.NewDockerExecutor()
 		dockerExec.Timeout = timeout
 		dockerExec.MemoryLimit = memoryLimit
+		dockerExec.Rlimits = rlimits
+		dockerExec.Output = output
+		dockerExec.MapTracebacks = mapTracebacks
+		dockerExec.Locale = loc
+		if err := configureDocker(dockerExec, file); err != nil {
+			return nil, err
+		}
+		
+		// Networked containers get the network configured in the file
+		dockerExec.NetworkAccess = file.NetworkAccess
+		dockerExec.Network = container.NetworkOptions{
+			Mode:              file.Network.Mode,
+			Tenant:            file.Network.Tenant,
+			Internal:          file.Network.Internal,
+			ExtraHosts:        file.Network.ExtraHosts,
+			AllowHostServices: file.Network.AllowHostServices,
+			Allow:             file.Network.Allow,
+			DNS: container.DNSOptions{
+				Mode:     file.Network.DNS.Mode,
+				Allow:    file.Network.DNS.Allow,
+				Upstream: file.Network.DNS.Upstream,
+			},
+		}
+		if dnsMode != "" {
+			dockerExec.Network.DNS.Mode = dnsMode
+		}
+		if len(dnsAllow) > 0 {
+			dockerExec.Network.DNS.Allow = dnsAllow
+		}
+		if err := dockerExec.Network.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid network configuration: %w", err)
+		}
+		if scanImages {
+			scanner, _ := images.NewScanner("trivy")
+			dockerExec.ImagePolicy = images.NewService(scanner, images.DefaultPolicy(), defaultImageCacheDir())
+		}
 		return dockerExec, nil
 	} else {
 		// Use local executor
 		localExec := executor.NewLocalExecutor()
 		localExec.Timeout = timeout
 		localExec.MemoryLimit = memoryLimit
+		localExec.Trace = traceMode
+		localExec.TrackWorkspace = trackWorkspace
+		localExec.InlineFiles = inlineFiles
+		localExec.Profile = profileMode
+		localExec.Flamegraph = flamegraphFile != ""
+		localExec.Coverage = coverageMode
+		localExec.Rlimits = rlimits
+		localExec.Output = output
+		localExec.MapTracebacks = mapTracebacks
+		localExec.Locale = loc
 		return localExec, nil
 	}
 }
 
+// configureDocker applies the daemon, images, and platform of the config
+// file to a docker executor; the --platform flag overrides the configured
+// platform
+func configureDocker(d *container.DockerExecutor, file *config.File) error {
+	d.Daemon = container.Daemon{
+		Host:      file.Docker.Host,
+		TLSVerify: file.Docker.TLSVerify,
+		CACert:    file.Docker.TLSCACert,
+		Cert:      file.Docker.TLSCert,
+		Key:       file.Docker.TLSKey,
+	}
+	if err := d.Daemon.Validate(); err != nil {
+		return fmt.Errorf("invalid docker configuration: %w", err)
+	}
+	if file.Docker.StopGrace < 0 {
+		return fmt.Errorf("invalid docker configuration: stop_grace must not be negative")
+	}
+	d.StopGrace = file.Docker.StopGrace
+	
+	d.Security = securityProfiles(file)
+	if err := d.Security.Validate(); err != nil {
+		return fmt.Errorf("invalid security profiles: %w", err)
+	}
+	capAdd, err := container.NormalizeCapabilities(file.Security.CapAdd)
+	if err != nil {
+		return fmt.Errorf("invalid security.cap_add: %w", err)
+	}
+	d.CapAdd = capAdd
+	
+	d.Images = file.Images.Languages
+	d.ArchImages = file.Images.Arch
+	d.Platform = file.Images.Platform
+	if platform != "" {
+		d.Platform = platform
+	}
+	if d.Platform != "" {
+		if err := container.ValidatePlatform(d.Platform); err != nil {
+			return err
+		}
+	}
+	d.OnPull = pullProgress()
+	return nil
+}
+
+// securityProfiles returns the seccomp and AppArmor profiles of the config
+// file; FORGEAI_SECCOMP_PROFILE and FORGEAI_APPARMOR_PROFILE override the
+// profiles of all languages
+func securityProfiles(file *config.File) container.SecurityProfiles {
+	profiles := container.SecurityProfiles{
+		Profiles: container.Profiles{
+			Seccomp:  file.Security.SeccompProfile,
+			AppArmor: file.Security.AppArmorProfile,
+		},
+		Languages: make(map[string]container.Profiles),
+	}
+	for language, p := range file.Security.Languages {
+		profiles.Languages[language] = container.Profiles{Seccomp: p.SeccompProfile, AppArmor: p.AppArmorProfile}
+	}
+	if seccomp := os.Getenv("FORGEAI_SECCOMP_PROFILE"); seccomp != "" {
+		profiles.Seccomp = seccomp
+	}
+	if apparmor := os.Getenv("FORGEAI_APPARMOR_PROFILE"); apparmor != "" {
+		profiles.AppArmor = apparmor
+	}
+	return profiles
+}
+
 // CompositeExecutor combines plugin, local, and container executors
 type CompositeExecutor struct {
 	PluginManager  *plugin.Manager
@@ -240,6 +594,21 @@ func (c *CompositeExecutor) SupportedLanguages() []string {
 	return languages
 }
 
+// Capabilities reports the capabilities of the default executor. Languages
+// handled by plugins may provide different guarantees.
+func (c *CompositeExecutor) Capabilities() sandbox.Capabilities {
+	var caps sandbox.Capabilities
+	if c.UseContainer {
+		caps = c.DockerExecutor.Capabilities()
+	} else {
+		caps = c.LocalExecutor.Capabilities()
+	}
+	if langs := c.PluginManager.SupportedLanguages(); len(langs) > 0 {
+		caps.Notes = append(caps.Notes, fmt.Sprintf("plugin languages %v may provide different guarantees", langs))
+	}
+	return caps
+}
+
 // getLanguageFromFile determines the language from the file extension
 func getLanguageFromFile(filePath string) string {
 	switch {
@@ -256,20 +625,155 @@ func getLanguageFromFile(filePath string) string {
 	}
 }
 
+// printDryRun reports the executor capabilities and warns about requested
+// guarantees the executor does not provide
+func printDryRun(exec sandbox.Executor) error {
+	caps := exec.Capabilities()
+	warnings := caps.Unmet(sandbox.Requirements{
+		MemoryLimit:       memoryLimit > 0,
+		NetworkIsolation:  true,
+		Trace:             traceMode,
+		WorkspaceTracking: trackWorkspace || inlineFiles > 0,
+		Profiling:         profileMode || flamegraphFile != "",
+		Coverage:          coverageMode,
+	})
+
+	if jsonOutput {
+		return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"capabilities": caps,
+			"warnings":     warnings,
+		})
+	}
+
+	fmt.Printf("Backend: %s (available: %t)\n", caps.Backend, caps.Available)
+	if caps.Platform != "" {
+		fmt.Printf("Platform: %s\n", caps.Platform)
+	}
+	if caps.SeccompProfile != "" {
+		fmt.Printf("Seccomp profile: %s\n", caps.SeccompProfile)
+	}
+	if caps.AppArmorProfile != "" {
+		fmt.Printf("AppArmor profile: %s\n", caps.AppArmorProfile)
+	}
+	features := []struct {
+		name      string
+		supported bool
+	}{
+		{"timeout", caps.Timeout},
+		{"memory limit", caps.MemoryLimit},
+		{"cpu limit", caps.CPULimit},
+		{"process limit", caps.ProcessLimit},
+		{"network isolation", caps.NetworkIsolation},
+		{"filesystem isolation", caps.FilesystemIsolation},
+		{"read-only filesystem", caps.ReadOnlyFilesystem},
+		{"syscall filtering", caps.SyscallFiltering},
+		{"stdin", caps.Stdin},
+		{"streaming", caps.Streaming},
+		{"artifacts", caps.Artifacts},
+		{"trace", caps.Trace},
+		{"workspace tracking", caps.WorkspaceTracking},
+		{"profiling", caps.Profiling},
+		{"coverage", caps.Coverage},
+	}
+	for _, f := range features {
+		mark := "no"
+		if f.supported {
+			mark = "yes"
+		}
+		fmt.Printf("  %-22s %s\n", f.name, mark)
+	}
+	for _, note := range caps.Notes {
+		fmt.Printf("Note: %s\n", note)
+	}
+	for _, warning := range warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+	return nil
+}
+
+// printOutput prints a stream of output, or its size when it is not text
+func printOutput(name, output string) {
+	switch {
+	case output == "":
+	case !sandbox.IsText(output):
+		fmt.Printf("%s: %d bytes of binary output (use --json for base64)\n", name, len(output))
+	default:
+		fmt.Printf("%s:\n%s\n", name, output)
+	}
+}
+
 func printResult(result *sandbox.ExecutionResult) error {
+	if artifact, ok := result.Artifact("flamegraph.svg"); ok && flamegraphFile != "" {
+		if err := os.WriteFile(flamegraphFile, artifact.Data, 0644); err != nil {
+			return fmt.Errorf("failed to write flamegraph: %w", err)
+		}
+	}
+
 	if jsonOutput {
+		result.EncodeOutput()
 		return json.NewEncoder(os.Stdout).Encode(result)
 	}
 
 	fmt.Printf("Execution completed in %v\n", result.Duration)
 	fmt.Printf("Exit code: %d\n", result.ExitCode)
 
-	if result.Stdout != "" {
-		fmt.Printf("Stdout:\n%s\n", result.Stdout)
+	printOutput("Stdout", result.Stdout)
+	printOutput("Stderr", result.Stderr)
+
+	if artifact, ok := result.Artifact("trace.json"); ok {
+		fmt.Printf("Trace:\n%s\n", artifact.Data)
+	}
+
+	if p := result.Profile; p != nil {
+		fmt.Printf("Profile: peak RSS %.1f MB, CPU %.0f%% (user %.2fs, system %.2fs)\n",
+			float64(p.PeakRSS)/(1024*1024), p.CPUPercent, p.UserTime, p.SystemTime)
+	}
+
+	if c := result.Coverage; c != nil {
+		if c.Error != "" {
+			fmt.Printf("Coverage: unavailable (%s)\n", c.Error)
+		} else {
+			fmt.Printf("Coverage: %.1f%% (%s)\n", c.Percent, c.Tool)
+		}
+		// Text reports are printed; Go's coverage profile is left to --json
+		if artifact, ok := result.Artifact("coverage.txt"); ok {
+			fmt.Printf("%s\n", artifact.Data)
+		}
+	}
+
+	if _, ok := result.Artifact("flamegraph.svg"); ok && flamegraphFile != "" {
+		fmt.Printf("Flamegraph written to %s\n", flamegraphFile)
+	}
+
+	if len(result.Diagnostics) > 0 {
+		fmt.Println("Diagnostics:")
+		for _, d := range result.Diagnostics {
+			fmt.Printf("  %s:%d:%d: %s: %s\n", d.File, d.Line, d.Column, d.Severity, d.Message)
+		}
+	}
+
+	if network := result.Network; network != nil {
+		fmt.Printf("Network: %s (DNS: %s)\n", network.Mode, network.DNS)
+		for _, q := range network.Queries {
+			status := "allowed"
+			if !q.Allowed {
+				status = "blocked"
+			}
+			fmt.Printf("  %s %s %s\n", q.Name, q.Type, status)
+		}
 	}
 
-	if result.Stderr != "" {
-		fmt.Printf("Stderr:\n%s\n", result.Stderr)
+	if ws := result.Workspace; ws != nil {
+		fmt.Println("Workspace changes:")
+		for _, f := range ws.Created {
+			fmt.Printf("  + %s (%d bytes)\n", f.Path, f.Size)
+		}
+		for _, f := range ws.Modified {
+			fmt.Printf("  ~ %s (%d bytes)\n", f.Path, f.Size)
+		}
+		for _, f := range ws.Deleted {
+			fmt.Printf("  - %s\n", f.Path)
+		}
 	}
 
 	return nil
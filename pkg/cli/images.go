@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/container"
+	"forgeai/pkg/images"
+	"forgeai/pkg/output"
+)
+
+var (
+	imageScanner  string
+	imageBlock    string
+	imageCacheDir string
+	imageRefresh  bool
+)
+
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Manage language container images",
+	Long:  `Inspect and scan the container images used for containerized execution.`,
+}
+
+var imagesScanCmd = &cobra.Command{
+	Use:   "scan [image...]",
+	Short: "Scan images for known vulnerabilities",
+	Long: `Scan container images with a vulnerability scanner (trivy or grype) and
+check them against the blocking policy. Without arguments, all configured
+language images are scanned.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		service, err := newImageService()
+		if err != nil {
+			return err
+		}
+
+		targets := args
+		if len(targets) == 0 {
+			targets = defaultLanguageImages()
+		}
+
+		type scanResult struct {
+			Report   *images.ScanReport `json:"report"`
+			Decision images.Decision    `json:"decision"`
+		}
+
+		var results []scanResult
+		blocked := 0
+		for _, image := range targets {
+			report, err := service.Scan(context.Background(), image, imageRefresh)
+			if err != nil {
+				return fmt.Errorf("failed to scan %s: %w", image, err)
+			}
+			decision := service.Policy.Evaluate(report)
+			if !decision.Allowed {
+				blocked++
+			}
+			results = append(results, scanResult{Report: report, Decision: decision})
+		}
+
+		if jsonOutput {
+			if err := json.NewEncoder(os.Stdout).Encode(results); err != nil {
+				return err
+			}
+		} else {
+			for _, r := range results {
+				status := "allowed"
+				if !r.Decision.Allowed {
+					status = "BLOCKED: " + strings.Join(r.Decision.Violations, ", ")
+				}
+				fmt.Printf("%s (%s)\n", r.Report.Image, r.Report.Scanner)
+				fmt.Printf("  Critical: %d  High: %d  Medium: %d  Low: %d\n",
+					r.Report.Counts[images.SeverityCritical], r.Report.Counts[images.SeverityHigh],
+					r.Report.Counts[images.SeverityMedium], r.Report.Counts[images.SeverityLow])
+				fmt.Printf("  Policy: %s\n", status)
+			}
+		}
+
+		if blocked > 0 {
+			return fmt.Errorf("%d image(s) blocked by vulnerability policy", blocked)
+		}
+		return nil
+	},
+}
+
+var imagesPullCmd = &cobra.Command{
+	Use:   "pull [image...]",
+	Short: "Pull language images ahead of use",
+	Long: `Pull container images with their progress, so that the first containerized
+run of a language does not wait for its image. Without arguments, all
+configured language images are pulled.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dockerExec := container.NewDockerExecutor()
+		if file, err := config.LoadDefaultFile(); err == nil {
+			if err := configureDocker(dockerExec, file); err != nil {
+				return err
+			}
+		}
+
+		targets := args
+		if len(targets) == 0 {
+			targets = defaultLanguageImages()
+		}
+
+		var results []container.PullProgress
+		for _, image := range targets {
+			var last container.PullProgress
+			progress := func(p container.PullProgress) { last = p }
+			if !jsonOutput {
+				show := newPullBar(os.Stdout)
+				progress = func(p container.PullProgress) {
+					last = p
+					show(p)
+				}
+			}
+			if err := dockerExec.PullImage(context.Background(), image, progress); err != nil {
+				return err
+			}
+			results = append(results, last)
+		}
+
+		if jsonOutput {
+			return json.NewEncoder(os.Stdout).Encode(results)
+		}
+		return nil
+	},
+}
+
+func init() {
+	imagesScanCmd.Flags().StringVar(&imageScanner, "scanner", "trivy", "Vulnerability scanner to use (trivy, grype)")
+	imagesScanCmd.Flags().StringVar(&imageBlock, "block", images.SeverityCritical, "Comma-separated severities that block an image")
+	imagesScanCmd.Flags().StringVar(&imageCacheDir, "cache-dir", defaultImageCacheDir(), "Directory for cached scan results")
+	imagesScanCmd.Flags().BoolVar(&imageRefresh, "refresh", false, "Ignore cached results and rescan")
+
+	imagesCmd.AddCommand(imagesScanCmd)
+	imagesCmd.AddCommand(imagesPullCmd)
+	rootCmd.AddCommand(imagesCmd)
+}
+
+// newImageService builds the scanning service from the command flags
+func newImageService() (*images.Service, error) {
+	scanner, err := images.NewScanner(imageScanner)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := images.Policy{}
+	for _, severity := range strings.Split(imageBlock, ",") {
+		if severity = strings.TrimSpace(severity); severity != "" {
+			policy.BlockSeverities = append(policy.BlockSeverities, severity)
+		}
+	}
+
+	return images.NewService(scanner, policy, imageCacheDir), nil
+}
+
+// defaultLanguageImages returns the configured image for every language
+func defaultLanguageImages() []string {
+	dockerExec := container.NewDockerExecutor()
+	if file, err := config.LoadDefaultFile(); err == nil {
+		configureDocker(dockerExec, file)
+	}
+
+	languages := dockerExec.SupportedLanguages()
+	sort.Strings(languages)
+
+	targets := make([]string, 0, len(languages))
+	for _, lang := range languages {
+		targets = append(targets, dockerExec.ImageForLanguage(lang))
+	}
+	return targets
+}
+
+// defaultImageCacheDir returns the default location for scan results
+func defaultImageCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "forgeai", "image-scans")
+}
+
+// pullProgress renders the image pulls of containerized runs on stderr when
+// it is a terminal, so that a first run does not look stuck; nil otherwise
+func pullProgress() func(container.PullProgress) {
+	if jsonOutput || !output.IsTerminal(os.Stderr) {
+		return nil
+	}
+	return newPullBar(os.Stderr)
+}
+
+// newPullBar returns a progress function that renders image pulls on w,
+// one progress bar per image, counting layers
+func newPullBar(w *os.File) func(container.PullProgress) {
+	var (
+		bar   *output.ProgressBar
+		image string
+	)
+	return func(p container.PullProgress) {
+		if bar == nil || p.Image != image {
+			bar, image = output.NewProgressBar(w, "Pulling "+p.Image), p.Image
+		}
+		// Docker ends a pull with a Status: line, also for images that are
+		// up to date and have no layers to pull
+		if strings.HasPrefix(p.Status, "Status: ") || (p.Layers > 0 && p.Done == p.Layers) {
+			bar.Done(int64(p.Done), int64(p.Layers))
+			return
+		}
+		bar.Update(int64(p.Done), int64(p.Layers))
+	}
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"forgeai/pkg/attestation"
+)
+
+var manifestPublicKey string
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Work with signed execution manifests",
+}
+
+var manifestVerifyCmd = &cobra.Command{
+	Use:   "verify [file]",
+	Short: "Verify a signed execution manifest",
+	Long: `Verify that an execution manifest downloaded from /v1/jobs/{id}/manifest was
+signed by the server key published at /v1/manifest/key.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read manifest: %w", err)
+		}
+
+		var signed attestation.SignedManifest
+		if err := json.Unmarshal(data, &signed); err != nil {
+			return fmt.Errorf("failed to parse manifest: %w", err)
+		}
+
+		manifest, err := attestation.Verify(&signed, manifestPublicKey)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput {
+			return json.NewEncoder(os.Stdout).Encode(manifest)
+		}
+
+		fmt.Println("Signature valid")
+		fmt.Printf("  Job:         %s\n", manifest.JobID)
+		fmt.Printf("  Code hash:   %s\n", manifest.CodeHash)
+		fmt.Printf("  Executor:    %s %s\n", manifest.Executor, manifest.ExecutorVersion)
+		fmt.Printf("  Exit code:   %d\n", manifest.ExitCode)
+		fmt.Printf("  Result hash: %s\n", manifest.ResultHash)
+		return nil
+	},
+}
+
+func init() {
+	manifestVerifyCmd.Flags().StringVar(&manifestPublicKey, "public-key", "", "Base64 encoded ed25519 public key of the server")
+	manifestVerifyCmd.MarkFlagRequired("public-key")
+
+	manifestCmd.AddCommand(manifestVerifyCmd)
+	rootCmd.AddCommand(manifestCmd)
+}
@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"forgeai/pkg/attestation"
+	"forgeai/pkg/config"
+	"forgeai/pkg/plugin"
+	"forgeai/pkg/registry"
+)
+
+var (
+	pluginLanguage string
+	pluginModule   string
+	pluginOutput   string
+
+	publishVersion  string
+	publishRegistry string
+	publishKey      string
+	publishToken    string
+	publishDryRun   bool
+	publishInfo     registry.PluginInfo
+
+	listRemote   bool
+	listRefresh  bool
+	listRegistry string
+)
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Develop and manage language plugins",
+}
+
+var pluginInitCmd = &cobra.Command{
+	Use:   "init [name]",
+	Short: "Generate the skeleton of a language plugin",
+	Long: `Generate a working language plugin in a new directory named after it: a
+manifest, a main.go implementing the executor protocol, tests, a Makefile,
+and a GoReleaser configuration. Rust, C, C++, Ruby, Lua, Perl, and PHP
+plugins run their toolchain as generated; plugins of other languages run
+<language> <file>, which main.go lets you adjust.`,
+	Example: "  forgeai plugin init --lang rust mylang-plugin",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		dir := pluginOutput
+		if dir == "" {
+			dir = name
+		}
+		files, err := plugin.Scaffold(dir, plugin.ScaffoldOptions{
+			Name:     name,
+			Language: pluginLanguage,
+			Module:   pluginModule,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created plugin %s in %s:\n", name, dir)
+		for _, file := range files {
+			rel, _ := filepath.Rel(dir, file)
+			fmt.Printf("  %s\n", rel)
+		}
+		fmt.Printf("\nBuild and try it with:\n  cd %s\n  make test install PLUGIN_DIR=<plugin dir>\n  forgeai --plugin-dir <plugin dir> exec <file>\n", dir)
+		return nil
+	},
+}
+
+var pluginPublishCmd = &cobra.Command{
+	Use:   "publish [dir]",
+	Short: "Sign a built plugin and publish it to a registry",
+	Long: `Publish the built plugin in a directory (default the current one), with its
+manifest.json and binary, to a plugin registry. The SHA-256 hash of the
+binary is signed with your ed25519 key together with the name and version,
+and the version must be higher than the latest one in the registry. A key
+is generated at --key when it does not exist; share its public key, which
+is printed, with the users of the plugin. With --dry-run everything but
+the upload is done.`,
+	Example: "  forgeai plugin publish --version 1.2.0 ./mylang-plugin",
+	Args:    cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		signer, err := attestation.LoadOrCreateSigner(publishKey)
+		if err != nil {
+			return err
+		}
+
+		token := publishToken
+		if token == "" {
+			token = os.Getenv("FORGEAI_REGISTRY_TOKEN")
+		}
+		client := registry.NewRegistryClient(publishRegistry)
+		if file, err := config.LoadDefaultFile(); err == nil {
+			client.Configure(file.Registry)
+		}
+		info, err := client.Publish(cmd.Context(), registry.PublishOptions{
+			Dir:     dir,
+			Version: publishVersion,
+			Info:    publishInfo,
+			Signer:  signer,
+			Token:   token,
+			DryRun:  publishDryRun,
+		})
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			return json.NewEncoder(os.Stdout).Encode(info)
+		}
+
+		if publishDryRun {
+			fmt.Printf("Would publish %s %s to %s\n", info.Name, info.Version, publishRegistry)
+		} else {
+			fmt.Printf("Published %s %s to %s\n", info.Name, info.Version, publishRegistry)
+		}
+		fmt.Printf("  languages:  %v\n", info.Languages)
+		fmt.Printf("  file hash:  %s\n", info.FileHash)
+		fmt.Printf("  signed by:  %s (public key %s)\n", signer.KeyID(), signer.PublicKey())
+		return nil
+	},
+}
+
+var pluginListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List installed plugins, or the plugins of a registry",
+	Long: `List the plugins installed in --plugin-dir, the plugin_dir of the config
+file, or ./plugins. With --remote, list the plugins of a registry instead.
+Registry listings are cached in the user's cache directory: a listing
+younger than registry.cache_ttl (5m) is shown without a request, an older
+one is revalidated with its ETag, and one younger than registry.max_stale
+(24h) is shown when the registry cannot be reached. --refresh revalidates
+the cached listing right away.`,
+	Example: "  forgeai plugin list --remote --refresh",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !listRemote {
+			names, err := plugin.NewManager().ListPlugins(installedPluginDir())
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				return json.NewEncoder(os.Stdout).Encode(names)
+			}
+			fmt.Println("Installed plugins:")
+			for _, name := range names {
+				fmt.Printf("  - %s\n", name)
+			}
+			return nil
+		}
+
+		client := registry.NewRegistryClient(listRegistry)
+		if file, err := config.LoadDefaultFile(); err == nil {
+			client.Configure(file.Registry)
+		}
+		client.MetadataCache = registry.DefaultMetadataCache()
+		client.Refresh = listRefresh
+		client.Stale = func(err error, age time.Duration) {
+			fmt.Fprintf(os.Stderr, "Warning: %v; showing the listing cached %s ago\n", err, age.Round(time.Second))
+		}
+		plugins, err := client.ListPlugins(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			return json.NewEncoder(os.Stdout).Encode(plugins)
+		}
+
+		fmt.Printf("Plugins in %s:\n", listRegistry)
+		for _, p := range plugins {
+			fmt.Printf("  - %s %s (%s)", p.Name, p.Version, strings.Join(p.Languages, ", "))
+			if p.Description != "" {
+				fmt.Printf(": %s", p.Description)
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+var pluginRollbackCmd = &cobra.Command{
+	Use:   "rollback [name]",
+	Short: "Restore the previous version of an installed plugin",
+	Long: `Swap an installed plugin with the version it replaced. Installs and updates
+keep the replaced version, so a rollback can be undone by rolling back
+again. Plugins are looked up in --plugin-dir, the plugin_dir of the config
+file, or ./plugins.`,
+	Example: "  forgeai plugin rollback rust-plugin",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		dir := installedPluginDir()
+		from, _ := registry.InstalledRelease(dir, name, false)
+		if err := registry.RollbackPlugin(dir, name); err != nil {
+			return err
+		}
+		to, _ := registry.InstalledRelease(dir, name, false)
+		if jsonOutput {
+			return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+				"name": name,
+				"from": from,
+				"to":   to,
+			})
+		}
+
+		version := func(info *registry.PluginInfo) string {
+			if info == nil || info.Version == "" {
+				return "unknown version"
+			}
+			return info.Version
+		}
+		fmt.Printf("Rolled back %s from %s to %s\n", name, version(from), version(to))
+		return nil
+	},
+}
+
+// installedPluginDir returns the directory plugins are installed in
+func installedPluginDir() string {
+	if pluginDir != "" {
+		return pluginDir
+	}
+	if file, err := config.LoadDefaultFile(); err == nil && file.PluginDir != "" {
+		return file.PluginDir
+	}
+	return "./plugins"
+}
+
+// defaultPublishKey returns the path of the plugin signing key in the home
+// directory
+func defaultPublishKey() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "plugin-signing.pem"
+	}
+	return filepath.Join(home, ".forgeai", "plugin-signing.pem")
+}
+
+func init() {
+	pluginInitCmd.Flags().StringVar(&pluginLanguage, "lang", "", "Language the plugin runs")
+	pluginInitCmd.Flags().StringVar(&pluginModule, "module", "", "Go module path of the plugin (default the name)")
+	pluginInitCmd.Flags().StringVarP(&pluginOutput, "output", "o", "", "Directory to create the plugin in (default the name)")
+	pluginInitCmd.MarkFlagRequired("lang")
+
+	flags := pluginPublishCmd.Flags()
+	flags.StringVar(&publishVersion, "version", "", "Semantic version of the release, higher than the latest published")
+	flags.StringVar(&publishRegistry, "registry", "http://localhost:8080", "URL of the plugin registry")
+	flags.StringVar(&publishKey, "key", defaultPublishKey(), "ed25519 signing key, generated when missing")
+	flags.StringVar(&publishToken, "token", "", "Publish token of the registry (default $FORGEAI_REGISTRY_TOKEN)")
+	flags.BoolVar(&publishDryRun, "dry-run", false, "Validate, hash, and sign the release without uploading it")
+	flags.StringVar(&publishInfo.Description, "description", "", "Description of the plugin")
+	flags.StringVar(&publishInfo.Author, "author", "", "Author of the plugin")
+	flags.StringVar(&publishInfo.License, "license", "", "License of the plugin")
+	flags.StringVar(&publishInfo.Homepage, "homepage", "", "Homepage of the plugin")
+	flags.StringVar(&publishInfo.Repository, "repository", "", "Source repository of the plugin")
+	pluginPublishCmd.MarkFlagRequired("version")
+
+	pluginListCmd.Flags().BoolVar(&listRemote, "remote", false, "List the plugins of the registry")
+	pluginListCmd.Flags().BoolVar(&listRefresh, "refresh", false, "Revalidate the cached registry listing")
+	pluginListCmd.Flags().StringVar(&listRegistry, "registry", "http://localhost:8080", "URL of the plugin registry")
+
+	pluginCmd.AddCommand(pluginInitCmd)
+	pluginCmd.AddCommand(pluginListCmd)
+	pluginCmd.AddCommand(pluginPublishCmd)
+	pluginCmd.AddCommand(pluginRollbackCmd)
+	rootCmd.AddCommand(pluginCmd)
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"forgeai/pkg/analytics"
+	"forgeai/pkg/joblog"
+)
+
+var (
+	reportJobLog      string
+	reportServer      string
+	reportFormat      string
+	reportOutput      string
+	reportTenantLabel string
+	reportNormalize   bool
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarize job history",
+}
+
+var reportWeeklyCmd = &cobra.Command{
+	Use:   "weekly",
+	Short: "Summarize the jobs of the last seven days",
+	Long: `Summarize the jobs created in the last seven days: success rate per language,
+daily P95 durations, top failure reasons, and the busiest tenants. Jobs are
+read from the job log given with --job-log or FORGEAI_JOB_LOG, or otherwise
+from the API server given with --server.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		until := time.Now().UTC()
+		opts := analytics.Options{
+			Since:       until.Add(-7 * 24 * time.Hour),
+			Until:       until,
+			TenantLabel: reportTenantLabel,
+			Normalize:   reportNormalize,
+		}
+
+		var report analytics.Report
+		if reportJobLog != "" {
+			records, err := joblog.ReadRecords(reportJobLog)
+			if err != nil {
+				return fmt.Errorf("failed to read job log: %w", err)
+			}
+			report = analytics.Summarize(analytics.FromJobLog(records), opts)
+		} else {
+			var err error
+			if report, err = fetchReport(cmd.Context(), opts); err != nil {
+				return err
+			}
+		}
+
+		if jsonOutput {
+			return json.NewEncoder(os.Stdout).Encode(report)
+		}
+
+		title := "ForgeAI Weekly Report"
+		var out string
+		switch reportFormat {
+		case "markdown":
+			out = report.Markdown(title)
+		case "html":
+			var err error
+			if out, err = report.HTML(title); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown format %q, use markdown or html", reportFormat)
+		}
+
+		if reportOutput == "" {
+			fmt.Print(out)
+			return nil
+		}
+		if err := os.WriteFile(reportOutput, []byte(out), 0644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		fmt.Printf("Report written to %s\n", reportOutput)
+		return nil
+	},
+}
+
+// fetchReport asks the API server to aggregate its jobs
+func fetchReport(ctx context.Context, opts analytics.Options) (analytics.Report, error) {
+	var report analytics.Report
+	query := url.Values{}
+	query.Set("since", opts.Since.Format(time.RFC3339Nano))
+	query.Set("until", opts.Until.Format(time.RFC3339Nano))
+	if opts.TenantLabel != "" {
+		query.Set("tenant_label", opts.TenantLabel)
+	}
+	if opts.Normalize {
+		query.Set("normalize", "true")
+	}
+	endpoint := strings.TrimSuffix(reportServer, "/") + "/v1/analytics?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return report, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return report, fmt.Errorf("failed to reach API server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return report, fmt.Errorf("API server returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return report, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return report, nil
+}
+
+func init() {
+	reportWeeklyCmd.Flags().StringVar(&reportJobLog, "job-log", os.Getenv("FORGEAI_JOB_LOG"), "Job log to read jobs from")
+	reportWeeklyCmd.Flags().StringVar(&reportServer, "server", defaultAdminServer(), "URL of the API server to read jobs from without a job log")
+	reportWeeklyCmd.Flags().StringVar(&reportFormat, "format", "markdown", "Report format: markdown or html")
+	reportWeeklyCmd.Flags().StringVarP(&reportOutput, "output", "o", "", "File to write the report to instead of stdout")
+	reportWeeklyCmd.Flags().StringVar(&reportTenantLabel, "tenant-label", analytics.DefaultTenantLabel, "Job label that names tenants")
+	reportWeeklyCmd.Flags().BoolVar(&reportNormalize, "normalize", false, "Normalize durations to the reference hardware by the calibration score of each worker")
+
+	reportCmd.AddCommand(reportWeeklyCmd)
+	rootCmd.AddCommand(reportCmd)
+}
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"forgeai/pkg/container"
+)
+
+var securityCmd = &cobra.Command{
+	Use:   "security",
+	Short: "Inspect sandbox security settings",
+}
+
+var securitySeccompCmd = &cobra.Command{
+	Use:   "seccomp-profile",
+	Short: "Print the hardened seccomp profile containers run with by default",
+	Long: `Print the hardened seccomp profile shipped with ForgeAI, as a starting
+point for a custom profile set with security.seccomp_profile.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := os.Stdout.Write(container.HardenedSeccompProfile())
+		return err
+	},
+}
+
+func init() {
+	securityCmd.AddCommand(securitySeccompCmd)
+	rootCmd.AddCommand(securityCmd)
+}
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	"forgeai/pkg/apikeys"
+	"forgeai/pkg/authz"
+	"forgeai/pkg/templates"
+)
+
+// The declarative admin API: templates, group policies, language
+// environments, and API keys have stable IDs, their names, and puts are
+// idempotent, so that tools such as Terraform providers can manage them.
+// Deleted or missing resources return errors for which IsNotFound is true.
+
+// Policy is the grant of a group
+type Policy struct {
+	Group string `json:"group"`
+	authz.Grant
+
+	// Managed is false for policies of the server's configuration file,
+	// which a put overrides but a delete cannot remove
+	Managed bool `json:"managed"`
+}
+
+// Environment is the container images of a language
+type Environment struct {
+	Language string `json:"language"`
+	Image    string `json:"image"`
+
+	// ArchImages are the images by architecture, such as arm64
+	ArchImages map[string]string `json:"arch_images,omitempty"`
+
+	// Managed is false for the images of the server's configuration file
+	// and its defaults
+	Managed bool `json:"managed"`
+}
+
+// APIKey is an API key. Secret is only set when the key is created or
+// rotated.
+type APIKey struct {
+	apikeys.Key
+	Secret string `json:"key,omitempty"`
+}
+
+// send sends a request with a JSON body, if in is not nil, and decodes its
+// JSON response into out
+func (c *Client) send(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	if out == nil {
+		out = &map[string]interface{}{}
+	}
+	_, err := c.do(ctx, method, path, body, out)
+	return err
+}
+
+// ListTemplates returns the templates of the server
+func (c *Client) ListTemplates(ctx context.Context) ([]templates.Template, error) {
+	var resp struct {
+		Templates []templates.Template `json:"templates"`
+	}
+	err := c.send(ctx, http.MethodGet, "/v1/templates", nil, &resp)
+	return resp.Templates, err
+}
+
+// GetTemplate returns a template by name
+func (c *Client) GetTemplate(ctx context.Context, name string) (*templates.Template, error) {
+	var t templates.Template
+	if err := c.send(ctx, http.MethodGet, "/v1/templates/"+url.PathEscape(name), nil, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// PutTemplate creates or replaces the template named t.Name
+func (c *Client) PutTemplate(ctx context.Context, t templates.Template) (*templates.Template, error) {
+	var put templates.Template
+	if err := c.send(ctx, http.MethodPut, "/v1/templates/"+url.PathEscape(t.Name), t, &put); err != nil {
+		return nil, err
+	}
+	return &put, nil
+}
+
+// DeleteTemplate deletes a template
+func (c *Client) DeleteTemplate(ctx context.Context, name string) error {
+	return c.send(ctx, http.MethodDelete, "/v1/templates/"+url.PathEscape(name), nil, nil)
+}
+
+// ListPolicies returns the grants of groups
+func (c *Client) ListPolicies(ctx context.Context) ([]Policy, error) {
+	var resp struct {
+		Policies []Policy `json:"policies"`
+	}
+	err := c.send(ctx, http.MethodGet, "/v1/admin/policies", nil, &resp)
+	return resp.Policies, err
+}
+
+// GetPolicy returns the grant of a group
+func (c *Client) GetPolicy(ctx context.Context, group string) (*Policy, error) {
+	var p Policy
+	if err := c.send(ctx, http.MethodGet, "/v1/admin/policies/"+url.PathEscape(group), nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PutPolicy sets the grant of a group
+func (c *Client) PutPolicy(ctx context.Context, group string, grant authz.Grant) (*Policy, error) {
+	var p Policy
+	if err := c.send(ctx, http.MethodPut, "/v1/admin/policies/"+url.PathEscape(group), grant, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// DeletePolicy removes the managed grant of a group
+func (c *Client) DeletePolicy(ctx context.Context, group string) error {
+	return c.send(ctx, http.MethodDelete, "/v1/admin/policies/"+url.PathEscape(group), nil, nil)
+}
+
+// GetEnvironment returns the images of a language
+func (c *Client) GetEnvironment(ctx context.Context, language string) (*Environment, error) {
+	var env Environment
+	if err := c.send(ctx, http.MethodGet, "/v1/environments/"+url.PathEscape(language), nil, &env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// PutEnvironment sets the images of env.Language
+func (c *Client) PutEnvironment(ctx context.Context, env Environment) (*Environment, error) {
+	spec := map[string]interface{}{"image": env.Image, "arch_images": env.ArchImages}
+	var put Environment
+	if err := c.send(ctx, http.MethodPut, "/v1/environments/"+url.PathEscape(env.Language), spec, &put); err != nil {
+		return nil, err
+	}
+	return &put, nil
+}
+
+// DeleteEnvironment returns a language to the images of the server's
+// configuration file, which it returns
+func (c *Client) DeleteEnvironment(ctx context.Context, language string) (*Environment, error) {
+	var env Environment
+	if err := c.send(ctx, http.MethodDelete, "/v1/environments/"+url.PathEscape(language), nil, &env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// ListAPIKeys returns the API keys without their secrets
+func (c *Client) ListAPIKeys(ctx context.Context) ([]apikeys.Key, error) {
+	var resp struct {
+		Keys []apikeys.Key `json:"api_keys"`
+	}
+	err := c.send(ctx, http.MethodGet, "/v1/admin/apikeys", nil, &resp)
+	return resp.Keys, err
+}
+
+// GetAPIKey returns an API key without its secret
+func (c *Client) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	var key APIKey
+	if err := c.send(ctx, http.MethodGet, "/v1/admin/apikeys/"+url.PathEscape(id), nil, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// PutAPIKey creates the API key with an ID, returning its secret, or
+// updates its spec, keeping its secret
+func (c *Client) PutAPIKey(ctx context.Context, id string, spec apikeys.Spec) (*APIKey, error) {
+	var key APIKey
+	if err := c.send(ctx, http.MethodPut, "/v1/admin/apikeys/"+url.PathEscape(id), spec, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RotateAPIKey replaces the secret of an API key and returns the new one
+func (c *Client) RotateAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	var key APIKey
+	if err := c.send(ctx, http.MethodPost, "/v1/admin/apikeys/"+url.PathEscape(id)+"/rotate", nil, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// DeleteAPIKey deletes an API key
+func (c *Client) DeleteAPIKey(ctx context.Context, id string) error {
+	return c.send(ctx, http.MethodDelete, "/v1/admin/apikeys/"+url.PathEscape(id), nil, nil)
+}
@@ -0,0 +1,375 @@
+// Package client runs code on a ForgeAI API server and, when the server
+// cannot be reached and the fallback policy allows it, on a local executor
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"forgeai/pkg/executor"
+	"forgeai/pkg/languages"
+	"forgeai/pkg/sandbox"
+)
+
+// ErrUnreachable is wrapped by the errors of requests that never reached
+// the server
+var ErrUnreachable = errors.New("server is unreachable")
+
+// StatusError is the error of an error response of the server
+type StatusError struct {
+	StatusCode int
+	Status     string
+
+	// Message is the error the server gave, if any
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("server returned %s: %s", e.Status, e.Message)
+	}
+	return "server returned " + e.Status
+}
+
+// IsNotFound reports whether err is a 404 Not Found response, such as for
+// a resource that does not exist
+func IsNotFound(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && status.StatusCode == http.StatusNotFound
+}
+
+// Client is a sandbox.Executor that runs code on a ForgeAI API server.
+// Only failures to reach the server trigger the fallback; errors the server
+// returns, such as unsupported languages, never do.
+type Client struct {
+	// Server is the URL of the API server, such as http://localhost:8080
+	Server string
+
+	// HTTPClient sends the requests; http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	// Header is added to every request, for example for authentication
+	Header http.Header
+
+	// Timeout and MemoryLimit, in seconds and MB, are sent with every
+	// job; the server's defaults when zero
+	Timeout     int
+	MemoryLimit int
+
+	// Locale is the time zone and locale sent with every job; the
+	// server's defaults for empty fields
+	Locale sandbox.Locale
+
+	// Fallback decides whether code runs locally when the server is
+	// unreachable
+	Fallback Fallback
+
+	// Local runs code when falling back; a new executor.LocalExecutor
+	// when nil
+	Local sandbox.Executor
+
+	// Logf reports fallbacks; log.Printf when nil
+	Logf func(format string, args ...interface{})
+}
+
+// Fallback is the policy for running code locally when the server is
+// unreachable
+type Fallback struct {
+	// Enabled allows local execution. Local execution usually lacks the
+	// isolation of the server's sandbox, so it is off by default.
+	Enabled bool
+
+	// Require lists guarantees the local executor must provide; code is
+	// not run locally when it lacks any of them
+	Require sandbox.Requirements
+
+	// OnFallback is called before code runs locally
+	OnFallback func(d Downgrade)
+}
+
+// Downgrade describes a local run in place of the server
+type Downgrade struct {
+	// Server is the URL of the unreachable server and Err why it was
+	// unreachable
+	Server string
+	Err    error
+
+	// Backend names the local executor
+	Backend string
+
+	// Lost lists the isolation guarantees the local executor lacks
+	Lost []string
+}
+
+// isolation are the guarantees a server sandbox is expected to provide
+var isolation = sandbox.Requirements{MemoryLimit: true, NetworkIsolation: true, ReadOnlyFilesystem: true}
+
+// jobResponse is the part of a job the client reads
+type jobResponse struct {
+	JobID         string `json:"job_id"`
+	Status        string `json:"status"`
+	Stdout        string `json:"stdout"`
+	Stderr        string `json:"stderr"`
+	ExitCode      int    `json:"exit_code"`
+	Duration      string `json:"duration"`
+	OutputOmitted int64  `json:"output_omitted"`
+	Error         string `json:"error"`
+
+	StdoutEncoding string `json:"stdout_encoding"`
+	StderrEncoding string `json:"stderr_encoding"`
+}
+
+// New creates a client of a server that does not fall back
+func New(server string) *Client {
+	return &Client{Server: server}
+}
+
+// Execute runs code on the server, or locally when the server is
+// unreachable and the fallback policy allows it. Language aliases such as py
+// are resolved first.
+func (c *Client) Execute(ctx context.Context, language, code string) (*sandbox.ExecutionResult, error) {
+	language = languages.Normalize(language)
+	result, err := c.executeRemote(ctx, language, code)
+	if !c.shouldFallBack(ctx, err) {
+		return result, err
+	}
+	local, err := c.fallBack(err)
+	if err != nil {
+		return nil, err
+	}
+	return local.Execute(ctx, language, code)
+}
+
+// ExecuteFile sends the contents of a local file to the server, with the
+// language implied by its extension
+func (c *Client) ExecuteFile(ctx context.Context, filePath string) (*sandbox.ExecutionResult, error) {
+	language := languageFromFile(filePath)
+	if language == "" {
+		return nil, fmt.Errorf("unknown language of %s", filePath)
+	}
+	code, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	result, err := c.executeRemote(ctx, language, string(code))
+	if !c.shouldFallBack(ctx, err) {
+		return result, err
+	}
+	local, err := c.fallBack(err)
+	if err != nil {
+		return nil, err
+	}
+	return local.ExecuteFile(ctx, filePath)
+}
+
+// SupportedLanguages returns the server's languages, or the local
+// executor's when the server is unreachable and fallback is enabled
+func (c *Client) SupportedLanguages() []string {
+	var resp struct {
+		Languages []string `json:"languages"`
+	}
+	err := c.get(context.Background(), "/v1/languages", &resp)
+	if err == nil {
+		return resp.Languages
+	}
+	if errors.Is(err, ErrUnreachable) && c.Fallback.Enabled {
+		return c.local().SupportedLanguages()
+	}
+	return nil
+}
+
+// Capabilities returns the server's capabilities, or the local executor's
+// when the server is unreachable and fallback is enabled
+func (c *Client) Capabilities() sandbox.Capabilities {
+	var resp struct {
+		Capabilities sandbox.Capabilities `json:"capabilities"`
+	}
+	err := c.get(context.Background(), "/v1/capabilities", &resp)
+	if err == nil {
+		return resp.Capabilities
+	}
+	if errors.Is(err, ErrUnreachable) && c.Fallback.Enabled {
+		caps := c.local().Capabilities()
+		caps.Notes = append(caps.Notes, fmt.Sprintf("the server at %s is unreachable, code runs locally", c.Server))
+		return caps
+	}
+	return sandbox.Capabilities{Backend: "remote", Notes: []string{err.Error()}}
+}
+
+// shouldFallBack reports whether err means the server was unreachable
+// while the caller still waits
+func (c *Client) shouldFallBack(ctx context.Context, err error) bool {
+	return err != nil && errors.Is(err, ErrUnreachable) && ctx.Err() == nil
+}
+
+// fallBack checks the fallback policy, reports the downgrade, and returns
+// the local executor
+func (c *Client) fallBack(cause error) (sandbox.Executor, error) {
+	if !c.Fallback.Enabled {
+		return nil, cause
+	}
+	local := c.local()
+	caps := local.Capabilities()
+	if unmet := caps.Unmet(c.Fallback.Require); len(unmet) > 0 {
+		return nil, fmt.Errorf("%w and local execution does not meet the required guarantees: %s", cause, strings.Join(unmet, "; "))
+	}
+
+	d := Downgrade{Server: c.Server, Err: cause, Backend: caps.Backend, Lost: caps.Unmet(isolation)}
+	logf := c.Logf
+	if logf == nil {
+		logf = log.Printf
+	}
+	lost := "none"
+	if len(d.Lost) > 0 {
+		lost = strings.Join(d.Lost, "; ")
+	}
+	logf("Warning: %v; falling back to the %s backend, guarantees lost: %s", cause, d.Backend, lost)
+	if c.Fallback.OnFallback != nil {
+		c.Fallback.OnFallback(d)
+	}
+	return local, nil
+}
+
+// local returns the executor of fallbacks
+func (c *Client) local() sandbox.Executor {
+	if c.Local == nil {
+		c.Local = executor.NewLocalExecutor()
+	}
+	return c.Local
+}
+
+// executeRemote runs code on the server, polling the job when it outlasts
+// the synchronous budget
+func (c *Client) executeRemote(ctx context.Context, language, code string) (*sandbox.ExecutionResult, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"language":     language,
+		"code":         code,
+		"timeout":      c.Timeout,
+		"memory_limit": c.MemoryLimit,
+		"timezone":     c.Locale.Timezone,
+		"locale":       c.Locale.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var job jobResponse
+	status, err := c.do(ctx, http.MethodPost, "/v1/execute/sync", bytes.NewReader(body), &job)
+	if err != nil {
+		return nil, err
+	}
+	for status == http.StatusAccepted {
+		path := "/v1/jobs/" + url.PathEscape(job.JobID) + "?wait=60s"
+		if status, err = c.do(ctx, http.MethodGet, path, nil, &job); err != nil {
+			return nil, err
+		}
+		if job.Status == "pending" || job.Status == "running" {
+			status = http.StatusAccepted
+		}
+	}
+	return job.result()
+}
+
+// get reads a JSON resource of the server
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	_, err := c.do(ctx, http.MethodGet, path, nil, v)
+	return err
+}
+
+// do sends a request and decodes its JSON response into v. Error responses
+// other than 503 for jobs that failed to set up are returned as errors.
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, v interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.Server, "/")+path, body)
+	if err != nil {
+		return 0, err
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var failure jobResponse
+		if job, ok := v.(*jobResponse); ok && json.Unmarshal(data, &failure) == nil && failure.Status == "setup_failed" {
+			*job = failure
+			return resp.StatusCode, nil
+		}
+		json.Unmarshal(data, &failure)
+		return resp.StatusCode, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Message: failure.Error}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// result converts a finished job to the result of an execution
+func (j jobResponse) result() (*sandbox.ExecutionResult, error) {
+	switch j.Status {
+	case "completed", "failed":
+	case "cancelled":
+		return nil, fmt.Errorf("job %s was cancelled", j.JobID)
+	default:
+		if j.Error != "" {
+			return nil, fmt.Errorf("job %s %s: %s", j.JobID, j.Status, j.Error)
+		}
+		return nil, fmt.Errorf("job %s %s", j.JobID, j.Status)
+	}
+	if j.Duration == "" {
+		return nil, fmt.Errorf("job %s failed: %s", j.JobID, j.Error)
+	}
+
+	duration, _ := time.ParseDuration(j.Duration)
+	return &sandbox.ExecutionResult{
+		Stdout:        j.Stdout,
+		Stderr:        j.Stderr,
+		ExitCode:      j.ExitCode,
+		Duration:      duration,
+		OutputOmitted: j.OutputOmitted,
+
+		StdoutEncoding: j.StdoutEncoding,
+		StderrEncoding: j.StderrEncoding,
+	}, nil
+}
+
+// languageFromFile returns the language of a file's extension, as the
+// local executor infers it
+func languageFromFile(filePath string) string {
+	switch filepath.Ext(filePath) {
+	case ".py":
+		return "python"
+	case ".go":
+		return "go"
+	case ".js":
+		return "javascript"
+	}
+	return ""
+}
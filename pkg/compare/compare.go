@@ -0,0 +1,284 @@
+// Package compare diffs the results of running two versions of code, so
+// that callers can check that a change altered behavior as intended
+package compare
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"forgeai/pkg/sandbox"
+)
+
+// maxCells bounds the work of a line diff. Outputs whose differing middle
+// parts exceed it are reported as replaced wholesale.
+const maxCells = 1 << 20
+
+// MaxLines is the most changed lines reported per stream
+const MaxLines = 500
+
+// Diff is the difference between the results of a base and a candidate
+type Diff struct {
+	// Identical is true when the exit codes, output, and artifacts match;
+	// durations are not compared
+	Identical bool `json:"identical"`
+
+	ExitCode  ExitCodeDiff   `json:"exit_code"`
+	Stdout    TextDiff       `json:"stdout"`
+	Stderr    TextDiff       `json:"stderr"`
+	Duration  DurationDiff   `json:"duration"`
+	Artifacts []ArtifactDiff `json:"artifacts"`
+}
+
+// ExitCodeDiff compares exit codes
+type ExitCodeDiff struct {
+	Base      int  `json:"base"`
+	Candidate int  `json:"candidate"`
+	Changed   bool `json:"changed"`
+}
+
+// TextDiff lists the lines removed from and added to an output stream
+type TextDiff struct {
+	Changed bool   `json:"changed"`
+	Lines   []Line `json:"lines,omitempty"`
+
+	// Truncated is true when more than MaxLines lines changed
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Line is a removed (-) or added (+) line with its 1-based line number in
+// the base or candidate output
+type Line struct {
+	Op   string `json:"op"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// DurationDiff compares run times
+type DurationDiff struct {
+	Base      string `json:"base"`
+	Candidate string `json:"candidate"`
+	Change    string `json:"change"`
+
+	// Ratio is the candidate duration over the base duration; zero when
+	// the base took no measurable time
+	Ratio float64 `json:"ratio"`
+}
+
+// ArtifactDiff compares an artifact of either result. Status is added,
+// removed, changed, or unchanged.
+type ArtifactDiff struct {
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+	BaseSize      int64  `json:"base_size,omitempty"`
+	CandidateSize int64  `json:"candidate_size,omitempty"`
+}
+
+// Results diffs the results of a base and a candidate execution
+func Results(base, candidate *sandbox.ExecutionResult) Diff {
+	d := Diff{
+		ExitCode: ExitCodeDiff{
+			Base:      base.ExitCode,
+			Candidate: candidate.ExitCode,
+			Changed:   base.ExitCode != candidate.ExitCode,
+		},
+		Stdout:    Text(base.Stdout, candidate.Stdout),
+		Stderr:    Text(base.Stderr, candidate.Stderr),
+		Duration:  durations(base.Duration, candidate.Duration),
+		Artifacts: artifacts(base.Artifacts, candidate.Artifacts),
+	}
+
+	d.Identical = !d.ExitCode.Changed && !d.Stdout.Changed && !d.Stderr.Changed
+	for _, a := range d.Artifacts {
+		if a.Status != "unchanged" {
+			d.Identical = false
+		}
+	}
+	return d
+}
+
+// Text diffs two outputs line by line
+func Text(base, candidate string) TextDiff {
+	if base == candidate {
+		return TextDiff{}
+	}
+	a, b := splitLines(base), splitLines(candidate)
+
+	// Only the middle between the common prefix and suffix differs
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	d := TextDiff{Changed: true}
+	add := func(op string, line int, text string) {
+		if len(d.Lines) == MaxLines {
+			d.Truncated = true
+			return
+		}
+		d.Lines = append(d.Lines, Line{Op: op, Line: line, Text: text})
+	}
+	for _, edit := range lineEdits(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		if edit.op == "-" {
+			add("-", prefix+edit.index+1, a[prefix+edit.index])
+		} else {
+			add("+", prefix+edit.index+1, b[prefix+edit.index])
+		}
+	}
+	return d
+}
+
+// edit removes line index of the base or adds line index of the candidate
+type edit struct {
+	op    string
+	index int
+}
+
+// lineEdits returns the edits turning a into b along a longest common
+// subsequence, or replacing a with b when they are too long to compare
+func lineEdits(a, b []string) []edit {
+	var edits []edit
+	if len(a)*len(b) > maxCells {
+		for i := range a {
+			edits = append(edits, edit{"-", i})
+		}
+		for j := range b {
+			edits = append(edits, edit{"+", j})
+		}
+		return edits
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{"-", i})
+			i++
+		default:
+			edits = append(edits, edit{"+", j})
+			j++
+		}
+	}
+	return edits
+}
+
+// splitLines splits output into lines without their line endings
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// durations compares two run times
+func durations(base, candidate time.Duration) DurationDiff {
+	d := DurationDiff{
+		Base:      base.String(),
+		Candidate: candidate.String(),
+		Change:    (candidate - base).String(),
+	}
+	if candidate >= base {
+		d.Change = "+" + d.Change
+	}
+	if base > 0 {
+		d.Ratio = float64(candidate) / float64(base)
+	}
+	return d
+}
+
+// artifacts compares the artifacts of two results by name. Artifacts moved
+// to object storage are compared by size.
+func artifacts(base, candidate []sandbox.Artifact) []ArtifactDiff {
+	byName := make(map[string]*ArtifactDiff)
+	var names []string
+	entry := func(name string) *ArtifactDiff {
+		if d, ok := byName[name]; ok {
+			return d
+		}
+		byName[name] = &ArtifactDiff{Name: name}
+		names = append(names, name)
+		return byName[name]
+	}
+
+	baseData := make(map[string]sandbox.Artifact)
+	for _, a := range base {
+		entry(a.Name).BaseSize = a.Len()
+		baseData[a.Name] = a
+	}
+	for _, a := range candidate {
+		d := entry(a.Name)
+		d.CandidateSize = a.Len()
+		previous, ok := baseData[a.Name]
+		switch {
+		case !ok:
+			d.Status = "added"
+		case previous.Key == "" && a.Key == "" && bytes.Equal(previous.Data, a.Data):
+			d.Status = "unchanged"
+		case (previous.Key != "" || a.Key != "") && previous.Len() == a.Len():
+			d.Status = "unchanged"
+		default:
+			d.Status = "changed"
+		}
+	}
+
+	sort.Strings(names)
+	diffs := make([]ArtifactDiff, 0, len(names))
+	for _, name := range names {
+		d := byName[name]
+		if d.Status == "" {
+			d.Status = "removed"
+		}
+		diffs = append(diffs, *d)
+	}
+	return diffs
+}
+
+// Summary describes a diff in one line
+func (d Diff) Summary() string {
+	if d.Identical {
+		return "identical behavior"
+	}
+	var changes []string
+	if d.ExitCode.Changed {
+		changes = append(changes, fmt.Sprintf("exit code %d -> %d", d.ExitCode.Base, d.ExitCode.Candidate))
+	}
+	if d.Stdout.Changed {
+		changes = append(changes, "stdout changed")
+	}
+	if d.Stderr.Changed {
+		changes = append(changes, "stderr changed")
+	}
+	for _, a := range d.Artifacts {
+		if a.Status != "unchanged" {
+			changes = append(changes, fmt.Sprintf("artifact %s %s", a.Name, a.Status))
+		}
+	}
+	return strings.Join(changes, ", ")
+}
@@ -0,0 +1,50 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+)
+
+// capabilityNames are the Linux capabilities docker can add back to a
+// container
+var capabilityNames = map[string]bool{
+	"AUDIT_CONTROL": true, "AUDIT_READ": true, "AUDIT_WRITE": true,
+	"BLOCK_SUSPEND": true, "BPF": true, "CHECKPOINT_RESTORE": true,
+	"CHOWN": true, "DAC_OVERRIDE": true, "DAC_READ_SEARCH": true,
+	"FOWNER": true, "FSETID": true, "IPC_LOCK": true, "IPC_OWNER": true,
+	"KILL": true, "LEASE": true, "LINUX_IMMUTABLE": true,
+	"MAC_ADMIN": true, "MAC_OVERRIDE": true, "MKNOD": true,
+	"NET_ADMIN": true, "NET_BIND_SERVICE": true, "NET_BROADCAST": true,
+	"NET_RAW": true, "PERFMON": true, "SETFCAP": true, "SETGID": true,
+	"SETPCAP": true, "SETUID": true, "SYS_ADMIN": true, "SYS_BOOT": true,
+	"SYS_CHROOT": true, "SYS_MODULE": true, "SYS_NICE": true,
+	"SYS_PACCT": true, "SYS_PTRACE": true, "SYS_RAWIO": true,
+	"SYS_RESOURCE": true, "SYS_TIME": true, "SYS_TTY_CONFIG": true,
+	"SYSLOG": true, "WAKE_ALARM": true,
+}
+
+// NormalizeCapabilities returns capability names such as cap_net_bind_service
+// in the NET_BIND_SERVICE form docker expects, and rejects unknown names and
+// ALL
+func NormalizeCapabilities(names []string) ([]string, error) {
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		capability := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "CAP_")
+		if !capabilityNames[capability] {
+			return nil, fmt.Errorf("unknown capability %q", name)
+		}
+		normalized = append(normalized, capability)
+	}
+	return normalized, nil
+}
+
+// PrivilegeArgs returns docker run arguments that drop every capability but
+// add, and keep processes from gaining privileges through setuid binaries
+// or file capabilities
+func PrivilegeArgs(add []string) []string {
+	args := []string{"--cap-drop", "ALL", "--security-opt", "no-new-privileges"}
+	for _, capability := range add {
+		args = append(args, "--cap-add", capability)
+	}
+	return args
+}
@@ -101,6 +101,15 @@ func (c *ContainerExecutor) ExecuteFile(ctx context.Context, filePath string) (*
 	return result, nil
 }
 
+// Capabilities reports no guarantees: the container executor is a
+// placeholder that does not run code yet
+func (c *ContainerExecutor) Capabilities() sandbox.Capabilities {
+	return sandbox.Capabilities{
+		Backend: "container/" + c.Engine,
+		Notes:   []string{"placeholder executor; code is not executed"},
+	}
+}
+
 // SupportedLanguages returns a list of supported languages
 func (c *ContainerExecutor) SupportedLanguages() []string {
 	// For now, return the same languages as the local executor
@@ -0,0 +1,220 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"forgeai/pkg/offline"
+)
+
+// daemonArchs caches the architecture of remote daemons by address
+var daemonArchs = struct {
+	sync.Mutex
+	archs map[string]string
+}{archs: make(map[string]string)}
+
+// Daemon locates the docker daemon that runs containers, which may be a
+// dedicated sandbox host instead of the local daemon
+type Daemon struct {
+	// Host is the daemon address, such as tcp://sandbox-1:2376 or
+	// ssh://forgeai@sandbox-1. DOCKER_HOST, or the local daemon, is used
+	// when it is empty.
+	Host string
+
+	// TLSVerify requires TLS and verifies the daemon's certificate against
+	// CACert
+	TLSVerify bool
+
+	// CACert, Cert, and Key are PEM files of the certificate authority and
+	// of the client certificate and its key. Setting Cert enables TLS.
+	CACert string
+	Cert   string
+	Key    string
+}
+
+// Validate checks the daemon address and TLS files
+func (d Daemon) Validate() error {
+	scheme := d.scheme()
+	switch scheme {
+	case "unix", "npipe", "tcp", "ssh":
+	default:
+		return fmt.Errorf("unsupported docker host %q: expected a unix, npipe, tcp, or ssh address", d.Host)
+	}
+	if d.Remote() {
+		address := d.host()[len(scheme)+3:]
+		if i := strings.LastIndex(address, "@"); i >= 0 {
+			address = address[i+1:]
+		}
+		if err := offline.CheckHost("docker host "+d.host(), address); err != nil {
+			return err
+		}
+	}
+
+	if !d.TLSVerify && d.Cert == "" && d.CACert == "" {
+		return nil
+	}
+	if scheme != "tcp" {
+		return fmt.Errorf("TLS requires a tcp docker host")
+	}
+	if d.TLSVerify && d.CACert == "" {
+		return fmt.Errorf("verifying the docker host requires a CA certificate")
+	}
+	if (d.Cert == "") != (d.Key == "") {
+		return fmt.Errorf("a docker client certificate requires both a certificate and a key")
+	}
+	for _, file := range []string{d.CACert, d.Cert, d.Key} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("docker TLS file: %w", err)
+		}
+	}
+	return nil
+}
+
+// host returns the configured address, or DOCKER_HOST
+func (d Daemon) host() string {
+	if d.Host != "" {
+		return d.Host
+	}
+	return os.Getenv("DOCKER_HOST")
+}
+
+// scheme returns the scheme of the daemon address; unix for the local
+// daemon
+func (d Daemon) scheme() string {
+	host := d.host()
+	if host == "" {
+		return "unix"
+	}
+	i := strings.Index(host, "://")
+	if i < 0 {
+		return ""
+	}
+	return host[:i]
+}
+
+// Remote reports whether containers run on another host, so that local
+// directories, firewall rules, and resolvers do not reach them
+func (d Daemon) Remote() bool {
+	scheme := d.scheme()
+	return scheme == "tcp" || scheme == "ssh"
+}
+
+// Arch returns the architecture of the daemon's host, such as arm64, or an
+// empty string when a remote daemon cannot be reached
+func (d Daemon) Arch(ctx context.Context) string {
+	if !d.Remote() {
+		return runtime.GOARCH
+	}
+
+	daemonArchs.Lock()
+	defer daemonArchs.Unlock()
+	if arch, ok := daemonArchs.archs[d.host()]; ok {
+		return arch
+	}
+	out, err := d.Command(ctx, "version", "--format", "{{.Server.Arch}}").Output()
+	if err != nil {
+		return ""
+	}
+	arch := strings.TrimSpace(string(out))
+	daemonArchs.archs[d.host()] = arch
+	return arch
+}
+
+// Command returns a docker command that talks to the daemon
+func (d Daemon) Command(ctx context.Context, args ...string) *exec.Cmd {
+	var global []string
+	if d.Host != "" {
+		global = append(global, "--host", d.Host)
+	}
+	switch {
+	case d.TLSVerify:
+		global = append(global, "--tlsverify")
+	case d.Cert != "" || d.CACert != "":
+		global = append(global, "--tls")
+	}
+	if d.CACert != "" {
+		global = append(global, "--tlscacert", d.CACert)
+	}
+	if d.Cert != "" {
+		global = append(global, "--tlscert", d.Cert, "--tlskey", d.Key)
+	}
+	return exec.CommandContext(ctx, "docker", append(global, args...)...)
+}
+
+// remoteWorkspaceSize is the size of the tmpfs holding the workspace of
+// containers on a remote daemon
+const remoteWorkspaceSize = "64m"
+
+// remoteWorkspaceArgs returns docker run arguments that give a container an
+// empty /workspace, to be filled from the archive sent on its stdin
+func remoteWorkspaceArgs() []string {
+	return []string{"-i", "--tmpfs", "/workspace:rw,exec,nosuid,nodev,size=" + remoteWorkspaceSize}
+}
+
+// receiveWorkspace prefixes a container command with the extraction of the
+// workspace archive from stdin
+func receiveWorkspace(command []string) []string {
+	return append([]string{"sh", "-c", `tar -x -C /workspace && exec "$@"`, "sh"}, command...)
+}
+
+// archiveDir returns a tar archive of the regular files and directories
+// below dir
+func archiveDir(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+
+		// Containers extract the archive as root without CAP_CHOWN, so the
+		// files must not be handed to the users owning them here
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive workspace: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to archive workspace: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,247 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"forgeai/pkg/offline"
+	"forgeai/pkg/sandbox"
+)
+
+// DNS modes of per-job networks
+const (
+	// DNSLog forwards every query to the upstream resolver and logs it
+	DNSLog = "log"
+
+	// DNSAllowlist answers only for allowlisted domains and logs every query
+	DNSAllowlist = "allowlist"
+
+	// DNSNone disables name resolution
+	DNSNone = "none"
+
+	// DNSDocker leaves resolution to docker, without logging
+	DNSDocker = "docker"
+)
+
+// DNSOptions configure name resolution in per-job networks
+type DNSOptions struct {
+	// Mode is DNSLog, DNSAllowlist, DNSNone, or DNSDocker; DNSLog when
+	// empty
+	Mode string
+
+	// Allow lists the domains answered in DNSAllowlist mode, including
+	// their subdomains
+	Allow []string
+
+	// Upstream is the resolver queries are forwarded to, as host or
+	// host:port; the first nameserver of /etc/resolv.conf by default
+	Upstream string
+}
+
+// Validate checks the DNS mode
+func (o DNSOptions) Validate() error {
+	switch o.Mode {
+	case "", DNSLog, DNSNone, DNSDocker:
+	case DNSAllowlist:
+		if len(o.Allow) == 0 {
+			return fmt.Errorf("allowlist DNS mode requires allowed domains")
+		}
+	default:
+		return fmt.Errorf("unknown DNS mode %q", o.Mode)
+	}
+	return nil
+}
+
+// resolver is a DNS forwarder for one job that logs every question and
+// refuses names outside its allowlist
+type resolver struct {
+	conn     *net.UDPConn
+	upstream string
+
+	// allow is nil when every name is answered
+	allow []string
+
+	mu      sync.Mutex
+	queries []sandbox.DNSQuery
+	done    chan struct{}
+}
+
+// startResolver serves DNS over UDP on addr
+func startResolver(addr, upstream string, allow []string) (*resolver, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start DNS resolver: %w", err)
+	}
+
+	r := &resolver{conn: conn, upstream: upstream, allow: allow, done: make(chan struct{})}
+	go r.serve()
+	return r, nil
+}
+
+// Addr returns the address the resolver listens on
+func (r *resolver) Addr() string {
+	return r.conn.LocalAddr().String()
+}
+
+// Close stops the resolver and returns the logged queries
+func (r *resolver) Close() []sandbox.DNSQuery {
+	r.conn.Close()
+	<-r.done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.queries
+}
+
+func (r *resolver) serve() {
+	defer close(r.done)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		packet := append([]byte(nil), buf[:n]...)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if reply := r.handle(packet); reply != nil {
+				r.conn.WriteToUDP(reply, from)
+			}
+		}()
+	}
+}
+
+// handle answers one query, returning nil to drop it
+func (r *resolver) handle(packet []byte) []byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(packet)
+	if err != nil {
+		return nil
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil
+	}
+
+	name := strings.TrimSuffix(strings.ToLower(question.Name.String()), ".")
+	allowed := r.allowed(name)
+
+	r.mu.Lock()
+	r.queries = append(r.queries, sandbox.DNSQuery{
+		Time:    time.Now().UTC(),
+		Name:    name,
+		Type:    strings.TrimPrefix(question.Type.String(), "Type"),
+		Allowed: allowed,
+	})
+	r.mu.Unlock()
+
+	if !allowed {
+		return refuse(header, question)
+	}
+	reply, err := r.forward(packet)
+	if err != nil {
+		header.RCode = dnsmessage.RCodeServerFailure
+		return refuse(header, question)
+	}
+	return reply
+}
+
+// allowed reports whether a name or one of its parents is allowlisted
+func (r *resolver) allowed(name string) bool {
+	if r.allow == nil {
+		return true
+	}
+	for _, domain := range r.allow {
+		domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// forward relays a query to the upstream resolver, which offline mode
+// allows only on the local machine
+func (r *resolver) forward(packet []byte) ([]byte, error) {
+	if err := offline.CheckHost("forwarding DNS queries", r.upstream); err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("udp", r.upstream, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(packet); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// refuse builds an answerless reply, NXDOMAIN unless header carries another
+// response code
+func refuse(header dnsmessage.Header, question dnsmessage.Question) []byte {
+	if header.RCode == dnsmessage.RCodeSuccess {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+	header.Response = true
+	header.RecursionAvailable = true
+
+	builder := dnsmessage.NewBuilder(nil, header)
+	builder.StartQuestions()
+	builder.Question(question)
+	reply, err := builder.Finish()
+	if err != nil {
+		return nil
+	}
+	return reply
+}
+
+// defaultUpstream returns the first nameserver of the host
+func defaultUpstream() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "8.8.8.8:53"
+}
+
+// upstreamAddr adds the default port to a configured upstream
+func upstreamAddr(upstream string) string {
+	if upstream == "" {
+		return defaultUpstream()
+	}
+	if _, _, err := net.SplitHostPort(upstream); err != nil {
+		return net.JoinHostPort(upstream, "53")
+	}
+	return upstream
+}
@@ -1,13 +1,16 @@
 package container
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"forgeai/pkg/diagnostics"
 	"forgeai/pkg/sandbox"
 )
 
@@ -25,8 +28,93 @@ type DockerExecutor struct {
 	// NetworkAccess controls network access
 	NetworkAccess bool
 	
+	// Network configures the network of containers when NetworkAccess is
+	// set
+	Network NetworkOptions
+	
 	// ReadOnlyRoot makes the root filesystem read-only
 	ReadOnlyRoot bool
+	
+	// Rlimits are applied with --ulimit; zero limits use the defaults
+	Rlimits sandbox.Rlimits
+	
+	// Output bounds the output held in memory; zero limits use
+	// sandbox.DefaultOutputLimits
+	Output sandbox.OutputLimits
+	
+	// MapTracebacks rewrites references to the file of submitted code in
+	// the output as "<submitted code>"
+	MapTracebacks bool
+	
+	// Fixtures are bind-mounted read-only below sandbox.FixturesDir. A
+	// remote daemon cannot mount them.
+	Fixtures []sandbox.Fixture
+	
+	// Volume is the host directory of the job's persistent volume, mounted
+	// read-write at sandbox.VolumeDir; none when empty
+	Volume string
+
+	// Locale sets TZ, LANG, and LC_ALL in the container; empty fields use
+	// sandbox.DefaultLocale. Images without tzdata only know UTC.
+	Locale sandbox.Locale
+	
+	// Images overrides the default image for a language
+	Images map[string]string
+	
+	// ArchImages overrides the image for a language on one architecture,
+	// such as arm64, and takes precedence over Images
+	ArchImages map[string]map[string]string
+	
+	// Platform pins containers to a platform such as linux/amd64, which
+	// runs them under emulation on hosts of another architecture. Images
+	// must match the host's architecture when it is empty.
+	Platform string
+	
+	// StopGrace is how long programs get to exit after SIGTERM when they
+	// are cancelled or time out, before they are killed; DefaultStopGrace
+	// when zero
+	StopGrace time.Duration
+	
+	// CapAdd lists the Linux capabilities, such as NET_BIND_SERVICE, that
+	// containers keep; all others are dropped
+	CapAdd []string
+	
+	// Security selects the seccomp and AppArmor profiles of containers;
+	// the zero value applies the hardened seccomp profile and the daemon's
+	// AppArmor profile
+	Security SecurityProfiles
+	
+	// Runtime is the OCI runtime of containers, such as runsc to run them
+	// under gVisor; the daemon's default runtime when empty
+	Runtime string
+	
+	// ImagePolicy, when set, must approve an image before it runs code
+	ImagePolicy ImageVerifier
+	
+	// OnPull reports the progress of images pulled before containers run;
+	// pulls are silent when nil
+	OnPull func(PullProgress)
+	
+	// Daemon is the docker daemon containers run on; the local daemon, or
+	// DOCKER_HOST, by default
+	Daemon Daemon
+	
+	// Instance and JobID are recorded in container labels; Instance defaults
+	// to DefaultInstance
+	Instance string
+	JobID    string
+}
+
+// ImageVerifier approves container images before they are used
+type ImageVerifier interface {
+	Verify(ctx context.Context, image string) error
+}
+
+// DefaultImages maps languages to the images used when no override is set
+var DefaultImages = map[string]string{
+	"python":     "python:3.9-alpine",
+	"go":         "golang:1.19-alpine",
+	"javascript": "node:16-alpine",
 }
 
 // NewDockerExecutor creates a new DockerExecutor with default settings
@@ -55,8 +143,22 @@ func (d *DockerExecutor) Execute(ctx context.Context, language, code string) (*s
 		return nil, fmt.Errorf("failed to write code to file: %w", err)
 	}
 
+	// Let the container user, which images run as root without the
+	// capabilities to bypass permissions, use the mounted directory
+	if !d.Daemon.Remote() {
+		if mapping, err := d.Daemon.UserMapping(ctx); err == nil {
+			if err := PrepareWorkspace(tempDir, mapping, 0, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// Execute the file in a container
-	return d.ExecuteFile(ctx, filePath)
+	result, err := d.ExecuteFile(ctx, filePath)
+	if err == nil && d.MapTracebacks {
+		diagnostics.MapTracebacks(result, filePath)
+	}
+	return result, err
 }
 
 // ExecuteFile runs the provided file in a Docker container
@@ -87,6 +189,10 @@ func (d *DockerExecutor) ExecuteFile(ctx context.Context, filePath string) (*san
 		CPUShares:     d.CPUShares,
 		NetworkAccess: d.NetworkAccess,
 		ReadOnlyRoot:  d.ReadOnlyRoot,
+		Rlimits:       d.Rlimits,
+		Fixtures:      d.Fixtures,
+		Volume:        d.Volume,
+		Locale:        d.Locale,
 		FilePath:      filePath,
 		Language:      language,
 	}
@@ -100,6 +206,51 @@ func (d *DockerExecutor) ExecuteFile(ctx context.Context, filePath string) (*san
 	return result, nil
 }
 
+// Capabilities reports what Docker enforces with the current settings
+func (d *DockerExecutor) Capabilities() sandbox.Capabilities {
+	caps := sandbox.Capabilities{
+		Backend:             "docker",
+		Available:           d.IsDockerAvailable(),
+		Timeout:             true,
+		MemoryLimit:         d.MemoryLimit > 0,
+		CPULimit:            d.CPUShares > 0,
+		NetworkIsolation:    !d.NetworkAccess,
+		FilesystemIsolation: true,
+		ReadOnlyFilesystem:  d.ReadOnlyRoot,
+		SyscallFiltering:    d.Security.Seccomp != ProfileUnconfined,
+		Platform:            d.EffectivePlatform(),
+		SeccompProfile:      d.Security.SeccompName(),
+		AppArmorProfile:     d.Security.AppArmorName(),
+	}
+	if d.Runtime != "" {
+		caps.Notes = append(caps.Notes, "containers run on the "+d.Runtime+" runtime")
+	}
+	if len(d.CapAdd) > 0 {
+		caps.Notes = append(caps.Notes, "containers keep the capabilities "+strings.Join(d.CapAdd, ", "))
+	}
+	for _, language := range d.Security.languages() {
+		profiles := d.Security.ForLanguage(language)
+		caps.Notes = append(caps.Notes, fmt.Sprintf("%s containers run with the %s seccomp and %s AppArmor profiles", language, profiles.SeccompName(), profiles.AppArmorName()))
+	}
+	if d.Emulated() {
+		caps.Notes = append(caps.Notes, fmt.Sprintf("containers run %s under emulation on a %s host, which is slow", d.EffectivePlatform(), d.nativePlatform()))
+	}
+	if d.NetworkAccess {
+		switch d.Network.Mode {
+		case NetworkBridge:
+			caps.Notes = append(caps.Notes, "network access is enabled on the shared default bridge")
+		case NetworkTenant:
+			caps.Notes = append(caps.Notes, "network access is enabled on a network shared by the tenant's jobs")
+		default:
+			caps.Notes = append(caps.Notes, "network access is enabled on a separate network per job")
+		}
+		if !d.Network.AllowHostServices {
+			caps.Notes = append(caps.Notes, "cloud metadata endpoints and host services are blocked")
+		}
+	}
+	return caps
+}
+
 // SupportedLanguages returns a list of supported languages
 func (d *DockerExecutor) SupportedLanguages() []string {
 	return []string{"python", "go", "javascript"}
@@ -155,16 +306,22 @@ func (d *DockerExecutor) isLanguageSupported(language string) bool {
 }
 
 func (d *DockerExecutor) getImageForLanguage(language string) string {
-	switch language {
-	case "python":
-		return "python:3.9-alpine"
-	case "go":
-		return "golang:1.19-alpine"
-	case "javascript":
-		return "node:16-alpine"
-	default:
-		return "alpine:latest"
+	return d.ImageForLanguage(language)
+}
+
+// ImageForLanguage returns the image used to run the given language on the
+// architecture containers run on
+func (d *DockerExecutor) ImageForLanguage(language string) string {
+	if image, ok := d.ArchImages[platformArch(d.EffectivePlatform())][language]; ok && image != "" {
+		return image
+	}
+	if image, ok := d.Images[language]; ok && image != "" {
+		return image
+	}
+	if image, ok := DefaultImages[language]; ok {
+		return image
 	}
+	return "alpine:latest"
 }
 
 func (d *DockerExecutor) runContainer(ctx context.Context, config *DockerConfig) (*sandbox.ExecutionResult, error) {
@@ -175,19 +332,78 @@ func (d *DockerExecutor) runContainer(ctx context.Context, config *DockerConfig)
 	
 	// Pull the image if it doesn't exist
 	if err := d.pullImage(ctx, config.Image); err != nil {
-		return nil, fmt.Errorf("failed to pull image %s: %w", config.Image, err)
+		return nil, err
+	}
+	
+	// Resolve the tag once: the container runs the image of this ID, which
+	// execution manifests record, even if the tag moves meanwhile
+	digest, err := d.imageDigest(ctx, config.Image)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Refuse images that would run under emulation by accident
+	if err := d.checkImageArchitecture(ctx, digest); err != nil {
+		return nil, err
+	}
+	
+	// Enforce the image vulnerability policy
+	if d.ImagePolicy != nil {
+		if err := d.ImagePolicy.Verify(ctx, config.Image); err != nil {
+			return nil, err
+		}
 	}
 	
 	// Get the directory and filename
 	dir := filepath.Dir(config.FilePath)
 	filename := filepath.Base(config.FilePath)
 	
-	// Build the docker command
-	cmdArgs := []string{
-		"docker", "run", "--rm",
-		"-v", fmt.Sprintf("%s:/workspace", dir),
-		"-w", "/workspace",
+	// Build the docker command. A remote daemon cannot mount the local
+	// directory, so its files are sent to the container on stdin.
+	cmdArgs := []string{"run", "--rm", "-w", "/workspace"}
+	var workspace []byte
+	if d.Daemon.Remote() {
+		archive, err := archiveDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		workspace = archive
+		cmdArgs = append(cmdArgs, remoteWorkspaceArgs()...)
+	} else {
+		cmdArgs = append(cmdArgs, "-v", fmt.Sprintf("%s:/workspace", dir))
+	}
+	if len(config.Fixtures) > 0 {
+		if d.Daemon.Remote() {
+			return nil, fmt.Errorf("fixtures cannot be mounted on a remote docker daemon")
+		}
+		for _, f := range config.Fixtures {
+			cmdArgs = append(cmdArgs, "-v", fmt.Sprintf("%s:%s/%s:ro", f.Source, sandbox.FixturesDir, f.Name))
+		}
+		cmdArgs = append(cmdArgs, "-e", "FORGEAI_FIXTURES="+sandbox.FixturesDir)
+	}
+	if config.Volume != "" {
+		if d.Daemon.Remote() {
+			return nil, fmt.Errorf("volumes cannot be mounted on a remote docker daemon")
+		}
+		cmdArgs = append(cmdArgs, "-v", fmt.Sprintf("%s:%s", config.Volume, sandbox.VolumeDir), "-e", "FORGEAI_VOLUME="+sandbox.VolumeDir)
+	}
+	for _, env := range config.Locale.Env() {
+		cmdArgs = append(cmdArgs, "-e", env)
+	}
+	if d.Platform != "" {
+		cmdArgs = append(cmdArgs, "--platform", d.Platform)
 	}
+	if d.Runtime != "" {
+		cmdArgs = append(cmdArgs, "--runtime", d.Runtime)
+	}
+	
+	// Label the container so that the reaper can remove it if it outlives us
+	name, managedArgs, done := ManagedContainer(d.Instance, d.JobID)
+	defer done()
+	cmdArgs = append(cmdArgs, managedArgs...)
+	
+	// Run an init process that forwards signals and reaps zombies
+	cmdArgs = append(cmdArgs, "--init")
 	
 	// Add resource limits
 	if config.MemoryLimit > 0 {
@@ -198,47 +414,87 @@ func (d *DockerExecutor) runContainer(ctx context.Context, config *DockerConfig)
 		cmdArgs = append(cmdArgs, "--cpu-shares", fmt.Sprintf("%d", config.CPUShares))
 	}
 	
+	// Add per-process resource limits
+	limits := config.Rlimits.WithDefaults(sandbox.DefaultRlimits())
+	cmdArgs = append(cmdArgs,
+		"--ulimit", fmt.Sprintf("nofile=%d:%d", limits.OpenFiles, limits.OpenFiles),
+		"--ulimit", fmt.Sprintf("fsize=%d:%d", limits.FileSize, limits.FileSize),
+		"--ulimit", fmt.Sprintf("stack=%d:%d", limits.StackSize, limits.StackSize),
+		"--ulimit", fmt.Sprintf("core=%d:%d", limits.CoreSize(), limits.CoreSize()),
+	)
+	
 	// Add read-only root filesystem if requested
 	if config.ReadOnlyRoot {
 		cmdArgs = append(cmdArgs, "--read-only")
 	}
 	
-	// Disable network if requested
-	if !config.NetworkAccess {
-		cmdArgs = append(cmdArgs, "--network", "none")
+	// Drop capabilities and forbid gaining privileges
+	cmdArgs = append(cmdArgs, PrivilegeArgs(d.CapAdd)...)
+	
+	// Apply the seccomp and AppArmor profiles of the language
+	profileArgs, removeProfiles, err := d.Security.ForLanguage(config.Language).Args()
+	if err != nil {
+		return nil, err
+	}
+	defer removeProfiles()
+	cmdArgs = append(cmdArgs, profileArgs...)
+	
+	// Disable the network, or give the container an isolated one
+	networkArgs, networkReport, teardown, err := d.networkArgs(ctx, config.NetworkAccess)
+	if err != nil {
+		return nil, err
 	}
+	defer teardown()
+	cmdArgs = append(cmdArgs, networkArgs...)
 	
 	// Add the image and command
-	cmdArgs = append(cmdArgs, config.Image)
+	cmdArgs = append(cmdArgs, digest)
 	
 	// Add the execution command based on language
+	var command []string
 	switch config.Language {
 	case "python":
-		cmdArgs = append(cmdArgs, "python", filename)
+		command = []string{"python", filename}
 	case "go":
-		cmdArgs = append(cmdArgs, "go", "run", filename)
+		command = []string{"go", "run", filename}
 	case "javascript":
-		cmdArgs = append(cmdArgs, "node", filename)
+		command = []string{"node", filename}
 	default:
 		return nil, fmt.Errorf("unsupported language: %s", config.Language)
 	}
+	if workspace != nil {
+		command = receiveWorkspace(command)
+	}
+	cmdArgs = append(cmdArgs, command...)
 	
-	// Create the command
-	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	// Create the command. It is not tied to ctx: cancellation stops the
+	// container gracefully instead of killing the client.
+	cmd := d.Daemon.Command(context.Background(), cmdArgs...)
+	if workspace != nil {
+		cmd.Stdin = bytes.NewReader(workspace)
+	}
+	output := d.Output.NewBuffer()
+	cmd.Stdout = output
+	cmd.Stderr = output
 	
-	// Capture output
+	// Capture output. The network report is completed by the deferred
+	// teardown, before the result is returned.
 	result := &sandbox.ExecutionResult{
-		Stdout: "",
-		Stderr: "",
+		Stdout:      "",
+		Stderr:      "",
+		Network:     networkReport,
+		Image:       config.Image,
+		ImageDigest: digest,
 	}
 	
 	start := time.Now()
 	
 	// Run the command
-	output, err := cmd.CombinedOutput()
+	err = d.Daemon.RunAttached(ctx, cmd, name, d.StopGrace)
 	
 	result.Duration = time.Since(start)
-	result.Stdout = string(output)
+	result.Stdout = output.String()
+	result.OutputOmitted = output.Omitted()
 	
 	// Check if the context was cancelled (timeout)
 	if ctx.Err() == context.DeadlineExceeded {
@@ -247,40 +503,51 @@ func (d *DockerExecutor) runContainer(ctx context.Context, config *DockerConfig)
 		return result, nil
 	}
 	
-	// Get exit code
+	// Get exit code. Docker exits with 125 when it could not run the
+	// container at all.
 	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitError.ExitCode()
-		} else {
-			result.ExitCode = -1
-			result.Stderr = err.Error()
+		exitError, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf("failed to run docker: %w", err)
 		}
+		if exitError.ExitCode() == 125 {
+			return nil, fmt.Errorf("failed to start container: %s", strings.TrimSpace(output.String()))
+		}
+		result.ExitCode = exitError.ExitCode()
 	} else {
 		result.ExitCode = 0
 	}
+
+	// Report compiler errors of programs that did not build
+	if result.ExitCode != 0 {
+		result.Diagnostics = diagnostics.Parse(config.Language, result.Stdout)
+	}
 	
 	return result, nil
 }
 
 // IsDockerAvailable checks if Docker is available
 func (d *DockerExecutor) IsDockerAvailable() bool {
-	cmd := exec.Command("docker", "--version")
+	cmd := d.Daemon.Command(context.Background(), "--version")
 	err := cmd.Run()
 	return err == nil
 }
 
+// ImageCached reports whether an image exists locally, for the pinned
+// platform if there is one, so running it needs no pull
+func (d *DockerExecutor) ImageCached(ctx context.Context, image string) bool {
+	arch, err := d.imageArchitecture(ctx, image)
+	return err == nil && (d.Platform == "" || arch == platformArch(d.Platform))
+}
+
 func (d *DockerExecutor) pullImage(ctx context.Context, image string) error {
-	// Check if image exists locally
-	cmd := exec.CommandContext(ctx, "docker", "image", "inspect", image)
-	err := cmd.Run()
-	if err == nil {
-		// Image exists, no need to pull
+	// Image exists, no need to pull
+	if d.ImageCached(ctx, image) {
 		return nil
 	}
 	
 	// Image doesn't exist, pull it
-	cmd = exec.CommandContext(ctx, "docker", "pull", image)
-	return cmd.Run()
+	return d.PullImage(ctx, image, d.OnPull)
 }
 
 // DockerConfig holds configuration for Docker execution
@@ -291,6 +558,10 @@ type DockerConfig struct {
 	CPUShares     int
 	NetworkAccess bool
 	ReadOnlyRoot  bool
+	Rlimits       sandbox.Rlimits
+	Fixtures      []sandbox.Fixture
+	Volume        string
+	Locale        sandbox.Locale
 	FilePath      string
 	Language      string
 }
\ No newline at end of file
@@ -0,0 +1,108 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// MetadataAddresses are the cloud instance metadata endpoints that containers
+// may not reach unless explicitly allowed
+var MetadataAddresses = []string{
+	"169.254.169.254", // AWS, GCP, Azure, and most other clouds
+	"169.254.170.2",   // AWS ECS task metadata
+	"100.100.100.200", // Alibaba Cloud
+}
+
+// defaultBridge is the interface of docker's default bridge network
+const defaultBridge = "docker0"
+
+// firewall is a set of iptables rules for one bridge
+type firewall [][]string
+
+// hostServiceRules drop traffic from a bridge interface to the metadata
+// endpoints and to the host itself, which covers services listening on the
+// host such as a TCP docker socket. Destinations in allow are accepted.
+// Rules are inserted at the top of their chain, so later rules take
+// precedence.
+func hostServiceRules(bridge string, allow []string) firewall {
+	var rules firewall
+
+	// Forwarded traffic passes DOCKER-USER before docker's own rules
+	for _, addr := range MetadataAddresses {
+		rules = append(rules, []string{"DOCKER-USER", "-i", bridge, "-d", addr, "-j", "DROP"})
+	}
+	// Traffic to any address of the host, including the bridge gateway
+	rules = append(rules, []string{"INPUT", "-i", bridge, "-j", "DROP"})
+
+	for _, entry := range allow {
+		dest, port := splitDestination(entry)
+		match := []string{"-i", bridge, "-d", dest}
+		if port != "" {
+			match = append(match, "-p", "tcp", "--dport", port)
+		}
+		for _, chain := range []string{"DOCKER-USER", "INPUT"} {
+			rules = append(rules, append(append([]string{chain}, match...), "-j", "ACCEPT"))
+		}
+	}
+	return rules
+}
+
+// dnsRules drop DNS traffic leaving a bridge, so that names can only be
+// resolved through resolver when it is set
+func dnsRules(bridge, resolver string) firewall {
+	rules := firewall{
+		{"DOCKER-USER", "-i", bridge, "-p", "udp", "--dport", "53", "-j", "DROP"},
+		{"DOCKER-USER", "-i", bridge, "-p", "tcp", "--dport", "53", "-j", "DROP"},
+	}
+	if resolver != "" {
+		rules = append(rules, []string{"INPUT", "-i", bridge, "-d", resolver, "-p", "udp", "--dport", "53", "-j", "ACCEPT"})
+	}
+	return rules
+}
+
+// install inserts the rules that are not present yet
+func (f firewall) install(ctx context.Context) error {
+	for _, rule := range f {
+		if exec.CommandContext(ctx, "iptables", append([]string{"-C"}, rule...)...).Run() == nil {
+			continue
+		}
+		if output, err := exec.CommandContext(ctx, "iptables", append([]string{"-I"}, rule...)...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to add iptables rule %q: %w: %s", strings.Join(rule, " "), err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// remove deletes the rules, ignoring those that are already gone
+func (f firewall) remove(ctx context.Context) {
+	for _, rule := range f {
+		exec.CommandContext(ctx, "iptables", append([]string{"-D"}, rule...)...).Run()
+	}
+}
+
+// validateDestination checks an allowed destination: an IPv4 address or
+// CIDR, optionally followed by :port
+func validateDestination(entry string) error {
+	dest, port := splitDestination(entry)
+	if ip := net.ParseIP(dest); ip == nil || ip.To4() == nil {
+		if ip, _, err := net.ParseCIDR(dest); err != nil || ip.To4() == nil {
+			return fmt.Errorf("allowed destination %q must be an IPv4 address or CIDR", entry)
+		}
+	}
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("allowed destination %q has an invalid port", entry)
+		}
+	}
+	return nil
+}
+
+// splitDestination splits an allowed destination into address and port
+func splitDestination(entry string) (dest, port string) {
+	dest, port, _ = strings.Cut(entry, ":")
+	return dest, port
+}
@@ -0,0 +1,102 @@
+package container
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Labels mark the containers and networks ForgeAI creates, so that those
+// left behind by a crashed process can be found and removed
+const (
+	LabelManaged  = "io.forgeai.managed"
+	LabelInstance = "io.forgeai.instance"
+	LabelPID      = "io.forgeai.pid"
+	LabelJob      = "io.forgeai.job"
+	LabelCreated  = "io.forgeai.created"
+)
+
+// running tracks the containers and per-job networks this process is using
+var running = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: make(map[string]bool)}
+
+// DefaultInstance identifies this ForgeAI instance by FORGEAI_INSTANCE_ID,
+// or by the host name when it is not set
+func DefaultInstance() string {
+	if id := os.Getenv("FORGEAI_INSTANCE_ID"); id != "" {
+		return id
+	}
+	if host, err := os.Hostname(); err == nil {
+		return host
+	}
+	return "forgeai"
+}
+
+// ManagedArgs returns docker run arguments that name and label a container
+// as owned by this process. Call done once the container has exited.
+func ManagedArgs(instance, jobID string) (args []string, done func()) {
+	_, args, done = ManagedContainer(instance, jobID)
+	return args, done
+}
+
+// ManagedContainer is like ManagedArgs, and also returns the name of the
+// container
+func ManagedContainer(instance, jobID string) (name string, args []string, done func()) {
+	name = randomName("forgeai-")
+	args = append([]string{"--name", name}, labelArgs(instance, jobID)...)
+	return name, args, track(name)
+}
+
+// track marks a container or network as in use by this process until the
+// returned function is called
+func track(name string) func() {
+	running.Lock()
+	running.names[name] = true
+	running.Unlock()
+
+	return func() {
+		running.Lock()
+		delete(running.names, name)
+		running.Unlock()
+	}
+}
+
+// labelArgs returns docker arguments that label a container or network as
+// owned by this process
+func labelArgs(instance, jobID string) []string {
+	if instance == "" {
+		instance = DefaultInstance()
+	}
+
+	args := []string{
+		"--label", LabelManaged + "=true",
+		"--label", LabelInstance + "=" + instance,
+		"--label", fmt.Sprintf("%s=%d", LabelPID, os.Getpid()),
+		"--label", LabelCreated + "=" + strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	if jobID != "" {
+		args = append(args, "--label", LabelJob+"="+jobID)
+	}
+	return args
+}
+
+// randomName returns prefix followed by random hex digits
+func randomName(prefix string) string {
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	return prefix + hex.EncodeToString(suffix)
+}
+
+// isRunning reports whether this process is using the named container or
+// network
+func isRunning(name string) bool {
+	running.Lock()
+	defer running.Unlock()
+	return running.names[name]
+}
@@ -0,0 +1,293 @@
+package container
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"forgeai/pkg/sandbox"
+)
+
+// Network modes for containers with network access
+const (
+	// NetworkPerJob gives every job its own network, removed after the job
+	NetworkPerJob = "job"
+
+	// NetworkTenant shares one network between the jobs of a tenant
+	NetworkTenant = "tenant"
+
+	// NetworkBridge uses the default bridge shared by all containers
+	NetworkBridge = "bridge"
+)
+
+// jobNetworkPrefix names per-job networks
+const jobNetworkPrefix = "forgeai-job-"
+
+// NetworkOptions configure the network of containers with network access
+type NetworkOptions struct {
+	// Mode is NetworkPerJob, NetworkTenant, or NetworkBridge; per-job when
+	// empty
+	Mode string
+
+	// Tenant names the network shared in NetworkTenant mode
+	Tenant string
+
+	// Internal networks have no route out of the network
+	Internal bool
+
+	// ExtraHosts are host:ip entries added to the container's /etc/hosts
+	ExtraHosts []string
+
+	// AllowHostServices disables the firewall rules that keep containers
+	// away from cloud metadata endpoints and services on the host
+	AllowHostServices bool
+
+	// Allow lists destinations that stay reachable despite those rules,
+	// as an IPv4 address or CIDR with an optional :port
+	Allow []string
+
+	// DNS controls name resolution; it applies to per-job networks only
+	DNS DNSOptions
+}
+
+// Validate checks the modes, extra hosts, and allowed destinations
+func (o NetworkOptions) Validate() error {
+	switch o.Mode {
+	case "", NetworkPerJob, NetworkBridge:
+	case NetworkTenant:
+		if o.Tenant == "" {
+			return fmt.Errorf("tenant network mode requires a tenant")
+		}
+	default:
+		return fmt.Errorf("unknown network mode %q", o.Mode)
+	}
+
+	for _, entry := range o.ExtraHosts {
+		host, ip, ok := strings.Cut(entry, ":")
+		if !ok || host == "" || net.ParseIP(ip) == nil {
+			return fmt.Errorf("extra host %q must be host:ip", entry)
+		}
+	}
+	for _, entry := range o.Allow {
+		if err := validateDestination(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := o.DNS.Validate(); err != nil {
+		return err
+	}
+	if o.Mode != "" && o.Mode != NetworkPerJob && o.DNS.Mode != "" && o.DNS.Mode != DNSDocker {
+		return fmt.Errorf("DNS mode %q requires per-job networks", o.DNS.Mode)
+	}
+	return nil
+}
+
+// ValidateRemote checks that the options can be applied to containers of a
+// remote daemon. The host service blocklist and the DNS resolver run on
+// this host, where they do not reach those containers.
+func (o NetworkOptions) ValidateRemote() error {
+	if !o.AllowHostServices {
+		return fmt.Errorf("host services cannot be blocked on a remote docker host; block them on the sandbox host and allow host services")
+	}
+	if (o.Mode == "" || o.Mode == NetworkPerJob) && o.DNS.Mode != DNSDocker {
+		return fmt.Errorf("the DNS resolver does not support remote docker hosts; use the docker DNS mode")
+	}
+	return nil
+}
+
+// networkArgs prepares the network of one container and returns its docker
+// run arguments and a report that is complete once teardown has been called
+// after the container exited. The report is nil without network access.
+func (d *DockerExecutor) networkArgs(ctx context.Context, networkAccess bool) (args []string, report *sandbox.NetworkReport, teardown func(), err error) {
+	teardown = func() {}
+	if !networkAccess {
+		return []string{"--network", "none"}, nil, teardown, nil
+	}
+
+	opts := d.Network
+	if err := opts.Validate(); err != nil {
+		return nil, nil, teardown, err
+	}
+	if d.Daemon.Remote() {
+		if err := opts.ValidateRemote(); err != nil {
+			return nil, nil, teardown, err
+		}
+	}
+	for _, entry := range opts.ExtraHosts {
+		args = append(args, "--add-host", entry)
+	}
+
+	switch opts.Mode {
+	case NetworkBridge:
+		report = &sandbox.NetworkReport{Mode: NetworkBridge, DNS: DNSDocker}
+		if err := d.blockHostServices(ctx, defaultBridge); err != nil {
+			return nil, nil, teardown, err
+		}
+		return args, report, teardown, nil
+	case NetworkTenant:
+		report = &sandbox.NetworkReport{Mode: NetworkTenant, DNS: DNSDocker}
+		name := "forgeai-tenant-" + sanitizeName(opts.Tenant)
+		if err := d.Daemon.Command(ctx, "network", "inspect", name).Run(); err != nil {
+			if err := d.createNetwork(ctx, name, bridgeName("ft", opts.Tenant), opts.Internal); err != nil {
+				return nil, nil, teardown, err
+			}
+		}
+		if err := d.blockHostServices(ctx, bridgeName("ft", opts.Tenant)); err != nil {
+			return nil, nil, teardown, err
+		}
+		return append(args, "--network", name), report, teardown, nil
+	default:
+		jobArgs, report, teardown, err := d.jobNetwork(ctx)
+		if err != nil {
+			return nil, nil, teardown, err
+		}
+		return append(args, jobArgs...), report, teardown, nil
+	}
+}
+
+// jobNetwork creates a network for one job with its firewall rules and
+// resolver, and returns the docker run arguments that attach to it
+func (d *DockerExecutor) jobNetwork(ctx context.Context) (args []string, report *sandbox.NetworkReport, teardown func(), err error) {
+	opts := d.Network
+	report = &sandbox.NetworkReport{Mode: NetworkPerJob, DNS: opts.DNS.Mode}
+	if report.DNS == "" {
+		report.DNS = DNSLog
+	}
+
+	// Undo the setup in reverse order, with a fresh context because the
+	// job's may already be cancelled
+	var cleanups []func(ctx context.Context)
+	teardown = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i](ctx)
+		}
+	}
+	fail := func(err error) ([]string, *sandbox.NetworkReport, func(), error) {
+		teardown()
+		return nil, nil, func() {}, err
+	}
+
+	name := randomName(jobNetworkPrefix)
+	bridge := bridgeName("fj", name)
+	done := track(name)
+	cleanups = append(cleanups, func(context.Context) { done() })
+	if err := d.createNetwork(ctx, name, bridge, opts.Internal); err != nil {
+		return fail(err)
+	}
+	cleanups = append(cleanups, func(ctx context.Context) {
+		if output, err := d.Daemon.Command(ctx, "network", "rm", name).CombinedOutput(); err != nil {
+			fmt.Printf("Warning: failed to remove network %s: %v: %s\n", name, err, strings.TrimSpace(string(output)))
+		}
+	})
+	args = []string{"--network", name}
+
+	if !opts.AllowHostServices {
+		rules := hostServiceRules(bridge, opts.Allow)
+		cleanups = append(cleanups, rules.remove)
+		if err := d.blockHostServices(ctx, bridge); err != nil {
+			return fail(err)
+		}
+	}
+
+	switch report.DNS {
+	case DNSDocker:
+		return args, report, teardown, nil
+	case DNSNone:
+		// The embedded docker resolver forwards to the container's own
+		// loopback, where nothing answers
+		rules := dnsRules(bridge, "")
+		cleanups = append(cleanups, rules.remove)
+		if err := rules.install(ctx); err != nil {
+			return fail(fmt.Errorf("failed to disable DNS: %w", err))
+		}
+		return append(args, "--dns", "127.0.0.1"), report, teardown, nil
+	}
+
+	// Serve DNS on the bridge gateway, the only DNS server the job can reach
+	gateway, err := d.networkGateway(ctx, name)
+	if err != nil {
+		return fail(err)
+	}
+	var allow []string
+	if report.DNS == DNSAllowlist {
+		allow = opts.DNS.Allow
+	}
+	res, err := startResolver(net.JoinHostPort(gateway, "53"), upstreamAddr(opts.DNS.Upstream), allow)
+	if err != nil {
+		return fail(err)
+	}
+	cleanups = append(cleanups, func(context.Context) { report.Queries = res.Close() })
+
+	rules := dnsRules(bridge, gateway)
+	cleanups = append(cleanups, rules.remove)
+	if err := rules.install(ctx); err != nil {
+		return fail(fmt.Errorf("failed to route DNS to the resolver: %w", err))
+	}
+	return append(args, "--dns", gateway), report, teardown, nil
+}
+
+// networkGateway returns the gateway address of a network
+func (d *DockerExecutor) networkGateway(ctx context.Context, name string) (string, error) {
+	output, err := d.Daemon.Command(ctx, "network", "inspect", "--format", "{{range .IPAM.Config}}{{.Gateway}} {{end}}", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect network %s: %w", name, err)
+	}
+	for _, field := range strings.Fields(string(output)) {
+		if ip := net.ParseIP(field); ip != nil && ip.To4() != nil {
+			return field, nil
+		}
+	}
+	return "", fmt.Errorf("network %s has no IPv4 gateway", name)
+}
+
+// blockHostServices installs the host firewall on a bridge unless host
+// services are allowed. Without the firewall the job fails rather than run
+// with access to the host.
+func (d *DockerExecutor) blockHostServices(ctx context.Context, bridge string) error {
+	if d.Network.AllowHostServices {
+		return nil
+	}
+	if err := hostServiceRules(bridge, d.Network.Allow).install(ctx); err != nil {
+		return fmt.Errorf("failed to block host services: %w (allow host services to run without the blocklist)", err)
+	}
+	return nil
+}
+
+// createNetwork creates a labelled bridge network on the named interface
+func (d *DockerExecutor) createNetwork(ctx context.Context, name, bridge string, internal bool) error {
+	args := []string{"network", "create", "--driver", "bridge", "-o", "com.docker.network.bridge.name=" + bridge}
+	if internal {
+		args = append(args, "--internal")
+	}
+	args = append(args, labelArgs(d.Instance, d.JobID)...)
+	args = append(args, name)
+
+	if output, err := d.Daemon.Command(ctx, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create network %s: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// sanitizeName makes a value safe to use in a docker object name
+func sanitizeName(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+// bridgeName derives the interface name of a network's bridge, which must
+// fit in 15 characters
+func bridgeName(prefix, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return prefix + hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,97 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// HostPlatform returns the platform of containers that run natively on this
+// host. Containers are Linux containers on every host, including macOS
+// hosts where Docker runs them in a virtual machine.
+func HostPlatform() string {
+	return "linux/" + runtime.GOARCH
+}
+
+// ValidatePlatform checks that a platform has the os/arch[/variant] form
+// docker expects
+func ValidatePlatform(platform string) error {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("invalid platform %q: expected os/arch, such as linux/amd64", platform)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return fmt.Errorf("invalid platform %q: expected os/arch, such as linux/amd64", platform)
+		}
+	}
+	return nil
+}
+
+// platformArch returns the architecture of a platform such as linux/arm64/v8
+func platformArch(platform string) string {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// EffectivePlatform returns the platform containers run on: the pinned
+// platform, or the native platform of the daemon's host
+func (d *DockerExecutor) EffectivePlatform() string {
+	if d.Platform != "" {
+		return d.Platform
+	}
+	return d.nativePlatform()
+}
+
+// nativePlatform returns the platform of containers that run natively on
+// the daemon's host, which is a remote host's if the daemon is remote
+func (d *DockerExecutor) nativePlatform() string {
+	if arch := d.Daemon.Arch(context.Background()); arch != "" {
+		return "linux/" + arch
+	}
+	return HostPlatform()
+}
+
+// Emulated reports whether containers run under emulation because the
+// pinned platform has another architecture than the daemon's host
+func (d *DockerExecutor) Emulated() bool {
+	return platformArch(d.EffectivePlatform()) != platformArch(d.nativePlatform())
+}
+
+// imageArchitecture returns the architecture of a local image
+func (d *DockerExecutor) imageArchitecture(ctx context.Context, image string) (string, error) {
+	out, err := d.Daemon.Command(ctx, "image", "inspect", "--format", "{{.Architecture}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// imageDigest returns the ID of a local image, the digest of its content
+// that names exactly what a container of the image runs
+func (d *DockerExecutor) imageDigest(ctx context.Context, image string) (string, error) {
+	out, err := d.Daemon.Command(ctx, "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// checkImageArchitecture fails when an image was built for another
+// architecture than containers run on. Without a pinned platform docker
+// would run such an image under slow emulation, or fail with an exec format
+// error when emulation is not set up.
+func (d *DockerExecutor) checkImageArchitecture(ctx context.Context, image string) error {
+	arch, err := d.imageArchitecture(ctx, image)
+	if err != nil {
+		return err
+	}
+	if want := platformArch(d.EffectivePlatform()); arch != "" && arch != want {
+		return fmt.Errorf("image %s is built for %s, not %s; configure an image for %s or pin the platform to run it under emulation", image, arch, want, want)
+	}
+	return nil
+}
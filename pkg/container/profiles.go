@@ -0,0 +1,168 @@
+package container
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Seccomp and AppArmor profile names with a special meaning
+const (
+	// ProfileDefault selects ForgeAI's hardened seccomp profile, or the
+	// daemon's default AppArmor profile
+	ProfileDefault = "default"
+
+	// ProfileDocker selects the daemon's own default seccomp profile
+	ProfileDocker = "docker"
+
+	// ProfileUnconfined runs containers without the profile
+	ProfileUnconfined = "unconfined"
+)
+
+// hardenedSeccomp is the seccomp profile shipped with ForgeAI. It allows
+// what docker's default profile allows, except for the kernel interfaces
+// that untrusted code has no use for: io_uring, userfaultfd, ptrace,
+// namespaces, keyrings, and kernel modules among them.
+//
+//go:embed profiles/seccomp.json
+var hardenedSeccomp []byte
+
+// HardenedSeccompProfile returns the seccomp profile shipped with ForgeAI
+func HardenedSeccompProfile() []byte {
+	return append([]byte(nil), hardenedSeccomp...)
+}
+
+// Profiles are the seccomp and AppArmor profiles containers run with
+type Profiles struct {
+	// Seccomp is a seccomp profile file, or default, docker, or
+	// unconfined. The hardened default profile is used when it is empty.
+	Seccomp string
+
+	// AppArmor is the name of an AppArmor profile loaded on the daemon's
+	// host, or unconfined. The daemon's default profile is used when it is
+	// empty.
+	AppArmor string
+}
+
+// SecurityProfiles selects the profiles of containers, optionally per
+// language
+type SecurityProfiles struct {
+	Profiles
+
+	// Languages override the profiles for a language
+	Languages map[string]Profiles
+}
+
+// ForLanguage returns the profiles of containers running language
+func (s SecurityProfiles) ForLanguage(language string) Profiles {
+	profiles := s.Profiles
+	if override, ok := s.Languages[language]; ok {
+		if override.Seccomp != "" {
+			profiles.Seccomp = override.Seccomp
+		}
+		if override.AppArmor != "" {
+			profiles.AppArmor = override.AppArmor
+		}
+	}
+	return profiles
+}
+
+// languages returns the languages with overridden profiles in order
+func (s SecurityProfiles) languages() []string {
+	languages := make([]string, 0, len(s.Languages))
+	for language := range s.Languages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Validate checks that seccomp profile files exist and hold JSON
+func (s SecurityProfiles) Validate() error {
+	if err := s.Profiles.validate(); err != nil {
+		return err
+	}
+	for language, profiles := range s.Languages {
+		if err := profiles.validate(); err != nil {
+			return fmt.Errorf("%s: %w", language, err)
+		}
+	}
+	return nil
+}
+
+func (p Profiles) validate() error {
+	switch p.Seccomp {
+	case "", ProfileDefault, ProfileDocker, ProfileUnconfined:
+		return nil
+	}
+	data, err := os.ReadFile(p.Seccomp)
+	if err != nil {
+		return fmt.Errorf("failed to read seccomp profile: %w", err)
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("seccomp profile %s is not valid JSON", p.Seccomp)
+	}
+	return nil
+}
+
+// SeccompName describes the seccomp profile for reports
+func (p Profiles) SeccompName() string {
+	switch p.Seccomp {
+	case "", ProfileDefault:
+		return "forgeai-hardened"
+	case ProfileDocker:
+		return "docker-default"
+	}
+	return p.Seccomp
+}
+
+// AppArmorName describes the AppArmor profile for reports
+func (p Profiles) AppArmorName() string {
+	if p.AppArmor == "" || p.AppArmor == ProfileDefault {
+		return "docker-default"
+	}
+	return p.AppArmor
+}
+
+// Args returns the docker run arguments that apply the profiles, and a
+// function that removes the files they refer to after the run
+func (p Profiles) Args() ([]string, func(), error) {
+	var args []string
+	cleanup := func() {}
+	switch p.Seccomp {
+	case ProfileDocker:
+	case "", ProfileDefault:
+		path, err := writeHardenedSeccomp()
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "--security-opt", "seccomp="+path)
+		cleanup = func() { os.Remove(path) }
+	default:
+		args = append(args, "--security-opt", "seccomp="+p.Seccomp)
+	}
+	if p.AppArmor != "" && p.AppArmor != ProfileDefault {
+		args = append(args, "--security-opt", "apparmor="+p.AppArmor)
+	}
+	return args, cleanup, nil
+}
+
+// writeHardenedSeccomp writes the shipped profile to a private temporary
+// file, since docker reads profiles from files
+func writeHardenedSeccomp() (string, error) {
+	f, err := os.CreateTemp("", "forgeai-seccomp-*.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to write seccomp profile: %w", err)
+	}
+	_, err = f.Write(hardenedSeccomp)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write seccomp profile: %w", err)
+	}
+	return f.Name(), nil
+}
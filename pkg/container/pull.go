@@ -0,0 +1,98 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"forgeai/pkg/offline"
+)
+
+// layerRe matches the per-layer status lines of docker pull
+var layerRe = regexp.MustCompile(`^([0-9a-f]{12}): (.+)$`)
+
+// PullProgress is the progress of an image pull. Without a terminal docker
+// reports no byte counts, so progress is counted in layers.
+type PullProgress struct {
+	Image string `json:"image"`
+
+	// Layers is how many layers the image has, as far as docker has
+	// reported them, and Done how many of them are in place
+	Layers int `json:"layers"`
+	Done   int `json:"done"`
+
+	// Status is the last status docker reported
+	Status string `json:"status"`
+}
+
+// Percent returns how much of the pull is done, from 0 to 100
+func (p PullProgress) Percent() int {
+	if p.Layers == 0 {
+		return 0
+	}
+	return p.Done * 100 / p.Layers
+}
+
+// PullImage pulls an image, for the pinned platform if there is one, and
+// calls progress, which may be nil, whenever docker reports a change
+func (d *DockerExecutor) PullImage(ctx context.Context, image string, progress func(PullProgress)) error {
+	if err := offline.Check("pulling image " + image + " (load it with docker load)"); err != nil {
+		return err
+	}
+	args := []string{"pull"}
+	if d.Platform != "" {
+		args = append(args, "--platform", d.Platform)
+	}
+	cmd := d.Daemon.Command(ctx, append(args, image)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+
+	p := PullProgress{Image: image}
+	layers := map[string]bool{}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		p.Status = line
+		if m := layerRe.FindStringSubmatch(line); m != nil {
+			done, seen := layers[m[1]]
+			if !seen {
+				p.Layers++
+			}
+			if !done && (m[2] == "Pull complete" || m[2] == "Already exists") {
+				layers[m[1]] = true
+				p.Done++
+			} else if !seen {
+				layers[m[1]] = false
+			}
+		}
+		if progress != nil {
+			progress(p)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("failed to pull image %s: %s", image, msg)
+		}
+		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	if progress != nil && p.Done < p.Layers {
+		// Docker reports success once every layer is in place
+		p.Done = p.Layers
+		progress(p)
+	}
+	return nil
+}
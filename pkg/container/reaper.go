@@ -0,0 +1,160 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"forgeai/pkg/workspace"
+)
+
+// ReapResult counts the resources a reaper removed
+type ReapResult struct {
+	Containers int `json:"containers"`
+	Networks   int `json:"networks"`
+	Workspaces int `json:"workspaces"`
+}
+
+// Reaper removes containers, networks, and workspaces of this instance whose
+// owning process is gone
+type Reaper struct {
+	// Instance selects the resources to reap by their instance label
+	Instance string
+
+	// Interval is how often Run reaps
+	Interval time.Duration
+
+	// MinAge protects containers of this process that are still starting
+	MinAge time.Duration
+
+	// Workspaces, when set, has its stale workspaces collected too
+	Workspaces *workspace.Manager
+
+	// Daemon is the docker daemon whose containers and networks are reaped
+	Daemon Daemon
+}
+
+// NewReaper creates a reaper for instance that reaps every five minutes
+func NewReaper(instance string) *Reaper {
+	return &Reaper{
+		Instance: instance,
+		Interval: 5 * time.Minute,
+		MinAge:   time.Minute,
+	}
+}
+
+// Run reaps immediately and then every Interval until ctx is done
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := r.Reap(ctx)
+		if err != nil {
+			fmt.Printf("Warning: reaper: %v\n", err)
+		}
+		if result.Containers+result.Networks+result.Workspaces > 0 {
+			fmt.Printf("Reaped %d containers, %d networks, and %d workspaces left behind\n",
+				result.Containers, result.Networks, result.Workspaces)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reap removes orphaned resources once. Containers and networks are skipped
+// when docker is not installed.
+func (r *Reaper) Reap(ctx context.Context) (ReapResult, error) {
+	var result ReapResult
+	var errs []string
+
+	if r.Workspaces != nil {
+		n, err := r.Workspaces.Collect()
+		result.Workspaces = n
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if _, err := exec.LookPath("docker"); err == nil {
+		// Networks can only be removed once their containers are gone
+		n, err := r.reap(ctx, "container", "ps", "-a")
+		result.Containers = n
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+
+		n, err = r.reap(ctx, "network", "network", "ls")
+		result.Networks = n
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+// reap lists resources of one kind labelled with this instance and removes
+// the orphaned ones
+func (r *Reaper) reap(ctx context.Context, kind string, list ...string) (int, error) {
+	format := fmt.Sprintf(`{{.ID}}\t{{.Name}}\t{{.Label %q}}\t{{.Label %q}}`, LabelPID, LabelCreated)
+	if kind == "container" {
+		format = strings.Replace(format, "{{.Name}}", "{{.Names}}", 1)
+	}
+
+	args := append(list, "--filter", "label="+LabelInstance+"="+r.Instance, "--format", format)
+	output, err := r.Daemon.Command(ctx, args...).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %ss: %w", kind, err)
+	}
+
+	var orphans []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[2])
+		created, _ := strconv.ParseInt(fields[3], 10, 64)
+		if r.orphaned(kind, fields[1], pid, time.Unix(created, 0)) {
+			orphans = append(orphans, fields[0])
+		}
+	}
+	if len(orphans) == 0 {
+		return 0, nil
+	}
+
+	remove := []string{"rm", "-f"}
+	if kind == "network" {
+		remove = []string{"network", "rm"}
+	}
+	if output, err := r.Daemon.Command(ctx, append(remove, orphans...)...).CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("failed to remove %ss: %w: %s", kind, err, strings.TrimSpace(string(output)))
+	}
+	return len(orphans), nil
+}
+
+// orphaned reports whether a resource's owner is gone. Resources of another
+// live process are kept; containers and per-job networks of this process are
+// orphaned once they are no longer in use by it, such as after the docker
+// client was killed. Tenant networks are kept while this process lives.
+func (r *Reaper) orphaned(kind, name string, pid int, created time.Time) bool {
+	if pid != os.Getpid() {
+		return !workspace.ProcessAlive(pid)
+	}
+	if kind == "network" && !strings.HasPrefix(name, jobNetworkPrefix) {
+		return false
+	}
+	return !isRunning(name) && time.Since(created) > r.MinAge
+}
@@ -0,0 +1,55 @@
+package container
+
+import (
+	"context"
+	"math"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// DefaultStopGrace is how long programs get to exit after SIGTERM before
+// they are killed
+const DefaultStopGrace = 2 * time.Second
+
+// clientExitWait bounds the wait for the docker client to exit once its
+// container has stopped
+const clientExitWait = 5 * time.Second
+
+// RunAttached runs cmd, an attached docker run of the container called
+// name, and stops the container when ctx is done. Containers run with
+// --init, whose init process forwards the SIGTERM of docker stop to the
+// program; docker kills it when it has not exited after grace.
+func (d Daemon) RunAttached(ctx context.Context, cmd *exec.Cmd, name string, grace time.Duration) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	if grace <= 0 {
+		grace = DefaultStopGrace
+	}
+	seconds := strconv.Itoa(int(math.Ceil(grace.Seconds())))
+	stopCtx, cancel := context.WithTimeout(context.Background(), grace+clientExitWait)
+	defer cancel()
+	d.Command(stopCtx, "stop", "-t", seconds, name).Run()
+
+	// The client exits with the container, unless the daemon could not be
+	// reached
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(clientExitWait):
+	}
+	cmd.Process.Kill()
+	return <-done
+}
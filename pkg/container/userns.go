@@ -0,0 +1,227 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Daemon user modes, which decide the host user that container users run as
+const (
+	// ModeRootful daemons run containers with the host's user ids
+	ModeRootful = "rootful"
+
+	// ModeRootless daemons run as an unprivileged user; container root is
+	// that user and other container users map into its subordinate ids
+	ModeRootless = "rootless"
+
+	// ModeUsernsRemap daemons map container users into the subordinate ids
+	// of a remap user, dockremap by default
+	ModeUsernsRemap = "userns-remap"
+)
+
+// NobodyUID is the unprivileged user that sandboxed programs run as
+const NobodyUID = 65534
+
+// remapUser is the user docker creates for --userns-remap=default
+const remapUser = "dockremap"
+
+// daemonMappings caches the user mapping of daemons by address
+var daemonMappings = struct {
+	sync.Mutex
+	mappings map[string]UserMapping
+}{mappings: make(map[string]UserMapping)}
+
+// UserMapping maps container user ids to the host user ids that own their
+// files on the host
+type UserMapping struct {
+	Mode string
+
+	// Owner is the host user running a rootless daemon, which container
+	// root maps to
+	Owner int
+
+	// Base is the first host id of the subordinate range that container
+	// ids map into: from container id 0 for userns-remap, and from id 1 for
+	// rootless daemons. It is -1 when the range is unknown.
+	Base int
+}
+
+// HostUID returns the host user id that a container user id runs as, or -1
+// when it is unknown
+func (m UserMapping) HostUID(uid int) int {
+	switch m.Mode {
+	case ModeRootless:
+		if uid == 0 {
+			return m.Owner
+		}
+		if m.Base < 0 {
+			return -1
+		}
+		return m.Base + uid - 1
+	case ModeUsernsRemap:
+		if m.Base < 0 {
+			return -1
+		}
+		return m.Base + uid
+	}
+	return uid
+}
+
+// ParseDaemonMode returns the user mode of a daemon from the
+// SecurityOptions that docker info reports
+func ParseDaemonMode(securityOptions string) string {
+	switch {
+	case strings.Contains(securityOptions, "name=rootless"):
+		return ModeRootless
+	case strings.Contains(securityOptions, "name=userns"):
+		return ModeUsernsRemap
+	}
+	return ModeRootful
+}
+
+// ParseSubordinateIDs returns the first id of the subordinate range of a
+// user in the contents of /etc/subuid, where the user is given by name or
+// by id
+func ParseSubordinateIDs(data []byte, name string, uid int) (int, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] != name && fields[0] != strconv.Itoa(uid) {
+			continue
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		return start, true
+	}
+	return 0, false
+}
+
+// UserMapping detects how the daemon maps container users. Remote daemons
+// are reported as rootful because their files are not shared with this
+// host.
+func (d Daemon) UserMapping(ctx context.Context) (UserMapping, error) {
+	if d.Remote() {
+		return UserMapping{Mode: ModeRootful, Base: -1}, nil
+	}
+
+	daemonMappings.Lock()
+	defer daemonMappings.Unlock()
+	if mapping, ok := daemonMappings.mappings[d.host()]; ok {
+		return mapping, nil
+	}
+	out, err := d.Command(ctx, "info", "--format", "{{json .SecurityOptions}}").Output()
+	if err != nil {
+		return UserMapping{}, fmt.Errorf("failed to query the docker daemon: %w", err)
+	}
+	mapping := UserMapping{Mode: ParseDaemonMode(string(out)), Owner: os.Getuid(), Base: -1}
+
+	// Rootless daemons run as the user that runs us; remapping daemons use
+	// the subordinate ids of the remap user
+	name, uid := remapUser, -1
+	if mapping.Mode == ModeRootless {
+		uid = os.Getuid()
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			name = u.Username
+		}
+	}
+	if mapping.Mode != ModeRootful {
+		if data, err := os.ReadFile("/etc/subuid"); err == nil {
+			if base, ok := ParseSubordinateIDs(data, name, uid); ok {
+				mapping.Base = base
+			}
+		}
+	}
+
+	daemonMappings.mappings[d.host()] = mapping
+	return mapping, nil
+}
+
+// SandboxUID returns the container user that sandboxed programs run as.
+// Container root of a rootless daemon is already the unprivileged user
+// running it, and owns that user's files; elsewhere programs run as nobody.
+func (m UserMapping) SandboxUID() int {
+	if m.Mode == ModeRootless {
+		return 0
+	}
+	return NobodyUID
+}
+
+// PrepareWorkspace gives container user uid access to the files below dir,
+// which are owned by the user running us. Root hands them to the host user
+// that uid maps to; other users, which cannot change ownership, open up
+// their permissions instead. Writable workspaces can also be written to.
+func PrepareWorkspace(dir string, mapping UserMapping, uid int, writable bool) error {
+	// Containers drop the capabilities that let root bypass permissions,
+	// so even root must own the files
+	hostUID := mapping.HostUID(uid)
+	if hostUID == os.Getuid() {
+		return nil
+	}
+	if hostUID > 0 && os.Geteuid() == 0 {
+		if err := chownTree(dir, hostUID); err != nil {
+			return fmt.Errorf("failed to change workspace ownership: %w", err)
+		}
+		return nil
+	}
+	if err := openTree(dir, writable); err != nil {
+		return fmt.Errorf("failed to change workspace permissions: %w", err)
+	}
+	return nil
+}
+
+// chownTree hands dir and the files below it to uid, using the same id as
+// their group
+func chownTree(dir string, uid int) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, uid)
+	})
+}
+
+// openTree makes dir and the files below it readable, and optionally
+// writable, by every user
+func openTree(dir string, writable bool) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		switch {
+		case mode&os.ModeSymlink != 0:
+			return nil
+		case mode.IsDir():
+			mode |= 0o555
+			if writable {
+				mode |= 0o333
+			}
+		default:
+			mode |= 0o444
+			if mode&0o100 != 0 {
+				mode |= 0o111
+			}
+			if writable {
+				mode |= 0o222
+			}
+		}
+		return os.Chmod(path, mode.Perm())
+	})
+}
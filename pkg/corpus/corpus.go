@@ -0,0 +1,212 @@
+// Package corpus exports a sample of executed code and its outcomes as a
+// JSON lines dataset, for teams analyzing what generated code fails. Only
+// jobs with consent are exported, and sensitive text is redacted.
+package corpus
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"forgeai/pkg/jobs"
+)
+
+// DefaultConsentLabel is the job label that opts a job in when "true"
+const DefaultConsentLabel = "corpus_consent"
+
+// DefaultTenantLabel is the job label that names the tenant of a job
+const DefaultTenantLabel = "tenant"
+
+// Policy decides which jobs may be exported and how they are redacted
+type Policy struct {
+	// ConsentLabel opts a single job in when set to "true"; a job with the
+	// label set to anything else is never exported
+	ConsentLabel string
+
+	// Tenants lists the tenants, named by the TenantLabel label of their
+	// jobs, that consent to exporting all of their jobs
+	TenantLabel string
+	Tenants     []string
+
+	// Redactor is applied to code, output, and errors; DefaultRules are
+	// used when nil
+	Redactor *Redactor
+}
+
+// Consents reports whether a job may be exported
+func (p Policy) Consents(job *jobs.Job) bool {
+	consentLabel := p.ConsentLabel
+	if consentLabel == "" {
+		consentLabel = DefaultConsentLabel
+	}
+	if consent, ok := job.Labels[consentLabel]; ok {
+		return consent == "true"
+	}
+
+	tenantLabel := p.TenantLabel
+	if tenantLabel == "" {
+		tenantLabel = DefaultTenantLabel
+	}
+	tenant := job.Labels[tenantLabel]
+	for _, t := range p.Tenants {
+		if tenant != "" && tenant == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Options select the jobs to sample
+type Options struct {
+	// Rate is the fraction of eligible jobs to sample, from 0 to 1; all
+	// of them when zero
+	Rate float64
+
+	// Seed makes the sample reproducible: the same seed picks the same jobs
+	Seed int64
+
+	// Max caps the number of samples; unlimited when zero
+	Max int
+
+	// Since and Until bound the creation time of jobs; zero values are
+	// unbounded
+	Since time.Time
+	Until time.Time
+
+	// Languages and Statuses restrict the jobs when not empty
+	Languages []string
+	Statuses  []string
+
+	// Output includes stdout and stderr, each cut to MaxOutput bytes when
+	// MaxOutput is positive
+	Output    bool
+	MaxOutput int
+}
+
+// Sample is one line of the dataset
+type Sample struct {
+	JobID      string    `json:"job_id"`
+	Language   string    `json:"language"`
+	CodeHash   string    `json:"code_hash"`
+	Code       string    `json:"code"`
+	Status     string    `json:"status"`
+	ExitCode   *int      `json:"exit_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Stdout     *string   `json:"stdout,omitempty"`
+	Stderr     *string   `json:"stderr,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Redactions counts the redacted matches in the sample
+	Redactions int `json:"redactions"`
+}
+
+// Stats summarizes an export
+type Stats struct {
+	// Eligible jobs matched the options and consented; Exported of them
+	// were sampled
+	Eligible   int `json:"eligible"`
+	Exported   int `json:"exported"`
+	Redactions int `json:"redactions"`
+}
+
+// Export writes a sample of the finished code jobs in list to w, one JSON
+// object per line, in the order of list
+func Export(w io.Writer, list []*jobs.Job, policy Policy, opts Options) (Stats, error) {
+	redactor := policy.Redactor
+	if redactor == nil {
+		redactor = &Redactor{Rules: DefaultRules}
+	}
+
+	var stats Stats
+	enc := json.NewEncoder(w)
+	for _, job := range list {
+		if !job.Finished() || job.Code == "" || !selected(job, opts) || !policy.Consents(job) {
+			continue
+		}
+		stats.Eligible++
+		if !sampled(job.ID, opts) || opts.Max > 0 && stats.Exported >= opts.Max {
+			continue
+		}
+
+		sample := newSample(job, redactor, opts)
+		if err := enc.Encode(sample); err != nil {
+			return stats, err
+		}
+		stats.Exported++
+		stats.Redactions += sample.Redactions
+	}
+	return stats, nil
+}
+
+// newSample converts and redacts a job
+func newSample(job *jobs.Job, redactor *Redactor, opts Options) Sample {
+	sample := Sample{
+		JobID:     job.ID,
+		Language:  job.Language,
+		CodeHash:  job.CodeHash,
+		Status:    job.Status,
+		CreatedAt: job.CreatedAt.UTC(),
+	}
+	redact := func(text string) string {
+		text, n := redactor.Redact(text)
+		sample.Redactions += n
+		return text
+	}
+
+	sample.Code = redact(job.Code)
+	sample.Error = redact(job.Error)
+	if job.Result != nil {
+		exitCode := job.Result.ExitCode
+		sample.ExitCode = &exitCode
+		sample.DurationMS = job.Result.Duration.Milliseconds()
+		if opts.Output {
+			max := opts.MaxOutput
+			if max <= 0 {
+				max = -1
+			}
+			stdout, _ := job.Output(jobs.StreamStdout, max)
+			stderr, _ := job.Output(jobs.StreamStderr, max)
+			stdout, stderr = redact(stdout), redact(stderr)
+			sample.Stdout, sample.Stderr = &stdout, &stderr
+		}
+	}
+	return sample
+}
+
+// selected reports whether a job matches the filters of opts
+func selected(job *jobs.Job, opts Options) bool {
+	if !opts.Since.IsZero() && job.CreatedAt.Before(opts.Since) {
+		return false
+	}
+	if !opts.Until.IsZero() && !job.CreatedAt.Before(opts.Until) {
+		return false
+	}
+	return matches(opts.Languages, job.Language) && matches(opts.Statuses, job.Status)
+}
+
+// matches reports whether value is in list, or list is empty
+func matches(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sampled decides from a hash of the seed and job ID whether a job is in
+// the sample, so that a seed always picks the same jobs
+func sampled(id string, opts Options) bool {
+	if opts.Rate <= 0 || opts.Rate >= 1 {
+		return true
+	}
+	sum := sha256.Sum256([]byte(strconv.FormatInt(opts.Seed, 10) + ":" + id))
+	return float64(binary.BigEndian.Uint64(sum[:8]))/(1<<64) < opts.Rate
+}
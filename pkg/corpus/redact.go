@@ -0,0 +1,53 @@
+package corpus
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Rule replaces matches of a pattern with [REDACTED:Name]
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultRules redact common credentials and personal data
+var DefaultRules = []Rule{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github_token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"bearer_token", regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]{16,}=*`)},
+	{"secret", regexp.MustCompile(`(?i)\b[a-z0-9_]*(?:password|passwd|secret|token|api_?key)[a-z0-9_]*\s*[:=]\s*["'][^"'\n]{4,}["']`)},
+	{"email", regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}\b`)},
+}
+
+// Redactor removes sensitive text from exported code and output
+type Redactor struct {
+	Rules []Rule
+}
+
+// NewRedactor creates a redactor with DefaultRules and extra patterns,
+// which are redacted as "custom"
+func NewRedactor(extra []string) (*Redactor, error) {
+	rules := append([]Rule(nil), DefaultRules...)
+	for _, pattern := range extra {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		rules = append(rules, Rule{Name: "custom", Pattern: re})
+	}
+	return &Redactor{Rules: rules}, nil
+}
+
+// Redact returns text with every match replaced and how many were
+func (r *Redactor) Redact(text string) (string, int) {
+	count := 0
+	for _, rule := range r.Rules {
+		text = rule.Pattern.ReplaceAllStringFunc(text, func(string) string {
+			count++
+			return "[REDACTED:" + rule.Name + "]"
+		})
+	}
+	return text, count
+}
@@ -0,0 +1,228 @@
+// Package coverage measures how much of executed code is exercised when it
+// runs, typically by its own tests, with coverage.py for Python, go run
+// -cover for Go, and istanbul's nyc for JavaScript.
+package coverage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"forgeai/pkg/sandbox"
+)
+
+// goCoverRe matches the total of go tool covdata percent
+var goCoverRe = regexp.MustCompile(`coverage: ([\d.]+)% of statements`)
+
+// Tool names the coverage tool used for a language
+func Tool(language string) string {
+	switch language {
+	case "python":
+		return "coverage.py"
+	case "go":
+		return "go -cover"
+	case "javascript":
+		return "nyc"
+	}
+	return ""
+}
+
+// Available reports whether the coverage tool of language is installed
+func Available(language string) bool {
+	switch language {
+	case "python":
+		return exec.Command("python", "-c", "import coverage").Run() == nil
+	case "go":
+		// Programs can be built with -cover since Go 1.20
+		out, err := exec.Command("go", "env", "GOVERSION").Output()
+		if err != nil {
+			return false
+		}
+		return goVersionAtLeast(strings.TrimSpace(string(out)), 20)
+	case "javascript":
+		_, err := exec.LookPath("nyc")
+		return err == nil
+	}
+	return false
+}
+
+// goVersionAtLeast reports whether a version such as go1.21.3 has at least
+// the given minor version
+func goVersionAtLeast(version string, minor int) bool {
+	parts := strings.SplitN(strings.TrimPrefix(version, "go"), ".", 3)
+	if len(parts) < 2 || parts[0] != "1" {
+		return false
+	}
+	n, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	return err == nil && n >= minor
+}
+
+// Collector gathers the coverage of one execution
+type Collector struct {
+	language string
+	source   string
+
+	// dir holds the coverage data and reports
+	dir string
+}
+
+// New creates a Collector for the program in filePath, keeping its data in
+// a new temporary directory
+func New(language, filePath string) (*Collector, error) {
+	if Tool(language) == "" {
+		return nil, fmt.Errorf("coverage is not supported for %s", language)
+	}
+	dir, err := os.MkdirTemp("", "forgeai-coverage-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create coverage directory: %w", err)
+	}
+	return &Collector{language: language, source: filePath, dir: dir}, nil
+}
+
+// Tool names the coverage tool of the collector
+func (c *Collector) Tool() string {
+	return Tool(c.language)
+}
+
+// Close removes the coverage data
+func (c *Collector) Close() {
+	os.RemoveAll(c.dir)
+}
+
+// Wrap returns the command and extra environment that run cmdArgs, the
+// interpreter command of the program, with coverage enabled
+func (c *Collector) Wrap(cmdArgs []string) ([]string, []string) {
+	switch c.language {
+	case "python":
+		args := []string{cmdArgs[0], "-m", "coverage", "run", "--include=" + c.source}
+		return append(args, cmdArgs[1:]...), []string{"COVERAGE_FILE=" + c.dataFile()}
+	case "go":
+		// go run -cover writes its counters to GOCOVERDIR
+		args := []string{cmdArgs[0], cmdArgs[1], "-cover"}
+		return append(args, cmdArgs[2:]...), []string{"GOCOVERDIR=" + c.dir}
+	case "javascript":
+		args := []string{"nyc", "--silent", "--cwd=" + filepath.Dir(c.source), "--temp-dir=" + c.dataFile()}
+		return append(args, cmdArgs...), nil
+	}
+	return cmdArgs, nil
+}
+
+// dataFile is where Python and JavaScript coverage data is written
+func (c *Collector) dataFile() string {
+	return filepath.Join(c.dir, "data")
+}
+
+// Collect reads the coverage data once the program has exited and returns
+// the total and a report as an artifact
+func (c *Collector) Collect(ctx context.Context) (*sandbox.Coverage, *sandbox.Artifact, error) {
+	switch c.language {
+	case "python":
+		return c.collectPython(ctx)
+	case "go":
+		return c.collectGo(ctx)
+	case "javascript":
+		return c.collectJavaScript(ctx)
+	}
+	return nil, nil, fmt.Errorf("coverage is not supported for %s", c.language)
+}
+
+func (c *Collector) collectPython(ctx context.Context) (*sandbox.Coverage, *sandbox.Artifact, error) {
+	env := append(os.Environ(), "COVERAGE_FILE="+c.dataFile())
+	jsonFile := filepath.Join(c.dir, "coverage.json")
+
+	cmd := exec.CommandContext(ctx, "python", "-m", "coverage", "json", "-q", "-o", jsonFile)
+	cmd.Env = env
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read coverage data: %s", strings.TrimSpace(string(out)))
+	}
+	var summary struct {
+		Totals struct {
+			PercentCovered float64 `json:"percent_covered"`
+		} `json:"totals"`
+	}
+	if err := readJSON(jsonFile, &summary); err != nil {
+		return nil, nil, err
+	}
+
+	cmd = exec.CommandContext(ctx, "python", "-m", "coverage", "report", "-m")
+	cmd.Env = env
+	report, err := cmd.Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to write coverage report: %w", err)
+	}
+	return c.result(summary.Totals.PercentCovered, "coverage.txt", report)
+}
+
+func (c *Collector) collectGo(ctx context.Context) (*sandbox.Coverage, *sandbox.Artifact, error) {
+	// The counters are written at exit, so programs that crash or are
+	// killed leave only the meta-data written at startup
+	if counters, _ := filepath.Glob(filepath.Join(c.dir, "covcounters.*")); len(counters) == 0 {
+		return nil, nil, fmt.Errorf("no coverage data was written; the program did not exit normally")
+	}
+
+	out, err := exec.CommandContext(ctx, "go", "tool", "covdata", "percent", "-i="+c.dir).CombinedOutput()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read coverage data: %s", strings.TrimSpace(string(out)))
+	}
+	m := goCoverRe.FindSubmatch(out)
+	if m == nil {
+		return nil, nil, fmt.Errorf("unexpected coverage output: %s", strings.TrimSpace(string(out)))
+	}
+	percent, _ := strconv.ParseFloat(string(m[1]), 64)
+
+	profile := filepath.Join(c.dir, "coverage.out")
+	if out, err := exec.CommandContext(ctx, "go", "tool", "covdata", "textfmt", "-i="+c.dir, "-o="+profile).CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("failed to write coverage profile: %s", strings.TrimSpace(string(out)))
+	}
+	report, err := os.ReadFile(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.result(percent, "coverage.out", report)
+}
+
+func (c *Collector) collectJavaScript(ctx context.Context) (*sandbox.Coverage, *sandbox.Artifact, error) {
+	cmd := exec.CommandContext(ctx, "nyc", "report",
+		"--cwd="+filepath.Dir(c.source),
+		"--temp-dir="+c.dataFile(),
+		"--report-dir="+c.dir,
+		"--reporter=json-summary", "--reporter=text")
+	report, err := cmd.Output()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to write coverage report: %w", err)
+	}
+	var summary struct {
+		Total struct {
+			Statements struct {
+				Pct float64 `json:"pct"`
+			} `json:"statements"`
+		} `json:"total"`
+	}
+	if err := readJSON(filepath.Join(c.dir, "coverage-summary.json"), &summary); err != nil {
+		return nil, nil, err
+	}
+	return c.result(summary.Total.Statements.Pct, "coverage.txt", report)
+}
+
+func (c *Collector) result(percent float64, name string, report []byte) (*sandbox.Coverage, *sandbox.Artifact, error) {
+	coverage := &sandbox.Coverage{Percent: percent, Tool: Tool(c.language), Report: name}
+	artifact := &sandbox.Artifact{Name: name, ContentType: "text/plain", Data: report}
+	return coverage, artifact, nil
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read coverage summary: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse coverage summary: %w", err)
+	}
+	return nil
+}
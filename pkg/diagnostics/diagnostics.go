@@ -0,0 +1,144 @@
+// Package diagnostics parses compiler output into structured diagnostics so
+// that callers can fix code without matching free-text output.
+package diagnostics
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"forgeai/pkg/sandbox"
+)
+
+var (
+	// ./main.go:5:2: undefined: foo
+	goRe = regexp.MustCompile(`^(\S+\.go):(\d+)(?::(\d+))?: (.+)$`)
+
+	// error[E0425]: cannot find value `x` in this scope
+	//  --> main.rs:2:5
+	rustHeaderRe   = regexp.MustCompile(`^(error|warning)(?:\[(\w+)\])?: (.+)$`)
+	rustLocationRe = regexp.MustCompile(`^\s*--> (\S+?):(\d+):(\d+)$`)
+
+	// main.c:3:5: error: expected ';' before '}' token
+	gccRe = regexp.MustCompile(`^(\S+?):(\d+):(\d+): (fatal error|error|warning|note): (.+)$`)
+
+	// Main.java:3: error: ';' expected
+	javaRe = regexp.MustCompile(`^(\S+\.java):(\d+): (error|warning): (.+)$`)
+)
+
+// Parse extracts the diagnostics of a compiled language from compiler
+// output. File names are reduced to their base name because programs are
+// compiled in temporary directories. Other languages return nil.
+func Parse(language, output string) []sandbox.Diagnostic {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	switch language {
+	case "go":
+		return parseGo(lines)
+	case "rust":
+		return parseRust(lines)
+	case "c", "cpp":
+		return parseGCC(lines)
+	case "java":
+		return parseJava(lines)
+	}
+	return nil
+}
+
+// parseGo parses go build and go vet output, which follows a "# package"
+// header so that output of the program itself is not mistaken for it.
+// Indented lines continue the message of the diagnostic before them.
+func parseGo(lines []string) []sandbox.Diagnostic {
+	var diags []sandbox.Diagnostic
+	compiling, previous := false, false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "# ") {
+			compiling = true
+			continue
+		}
+		if !compiling {
+			continue
+		}
+		if m := goRe.FindStringSubmatch(line); m != nil {
+			diags = append(diags, sandbox.Diagnostic{
+				File:     filepath.Base(m[1]),
+				Line:     atoi(m[2]),
+				Column:   atoi(m[3]),
+				Message:  m[4],
+				Severity: "error",
+			})
+			previous = true
+			continue
+		}
+		if previous && strings.HasPrefix(line, "\t") {
+			last := &diags[len(diags)-1]
+			last.Message += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		previous = false
+	}
+	return diags
+}
+
+// parseRust parses rustc and cargo output, where the location follows the
+// message on a --> line. Summaries without a location are skipped.
+func parseRust(lines []string) []sandbox.Diagnostic {
+	var diags []sandbox.Diagnostic
+	var pending *sandbox.Diagnostic
+	for _, line := range lines {
+		if m := rustHeaderRe.FindStringSubmatch(line); m != nil {
+			pending = &sandbox.Diagnostic{Severity: m[1], Code: m[2], Message: m[3]}
+			continue
+		}
+		if m := rustLocationRe.FindStringSubmatch(line); m != nil && pending != nil {
+			pending.File = filepath.Base(m[1])
+			pending.Line = atoi(m[2])
+			pending.Column = atoi(m[3])
+			diags = append(diags, *pending)
+			pending = nil
+		}
+	}
+	return diags
+}
+
+// parseGCC parses the format shared by gcc and clang
+func parseGCC(lines []string) []sandbox.Diagnostic {
+	var diags []sandbox.Diagnostic
+	for _, line := range lines {
+		if m := gccRe.FindStringSubmatch(line); m != nil {
+			severity := m[4]
+			if severity == "fatal error" {
+				severity = "error"
+			}
+			diags = append(diags, sandbox.Diagnostic{
+				File:     filepath.Base(m[1]),
+				Line:     atoi(m[2]),
+				Column:   atoi(m[3]),
+				Message:  m[5],
+				Severity: severity,
+			})
+		}
+	}
+	return diags
+}
+
+// parseJava parses javac output, which has no columns
+func parseJava(lines []string) []sandbox.Diagnostic {
+	var diags []sandbox.Diagnostic
+	for _, line := range lines {
+		if m := javaRe.FindStringSubmatch(line); m != nil {
+			diags = append(diags, sandbox.Diagnostic{
+				File:     filepath.Base(m[1]),
+				Line:     atoi(m[2]),
+				Message:  m[4],
+				Severity: m[3],
+			})
+		}
+	}
+	return diags
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
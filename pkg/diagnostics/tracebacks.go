@@ -0,0 +1,51 @@
+package diagnostics
+
+import (
+	"path/filepath"
+	"regexp"
+
+	"forgeai/pkg/sandbox"
+)
+
+// SubmittedCode replaces the name of the temporary file that submitted code
+// is written to
+const SubmittedCode = "<submitted code>"
+
+// MapTracebacks rewrites references to the file that submitted code was
+// written to, in the output and diagnostics of result, as SubmittedCode.
+// The code is written unchanged, so line and column numbers already refer
+// to the submitted code and are kept.
+//
+// A reference is the base name of filePath, with any directory or file://
+// prefix, so that paths inside containers are mapped as well:
+//
+//	File "/tmp/forgeai-123/main.py", line 3, in <module>
+//	File "<submitted code>", line 3, in <module>
+func MapTracebacks(result *sandbox.ExecutionResult, filePath string) {
+	if result == nil {
+		return
+	}
+	name := filepath.Base(filePath)
+	re := regexp.MustCompile(`(?m)(^|[\s"'(\[])(?:file://)?(?:[^\s"'()\[\]:]*/)?` + regexp.QuoteMeta(name) + `($|[\s"'():,\]])`)
+
+	result.Stdout = mapFile(re, result.Stdout)
+	result.Stderr = mapFile(re, result.Stderr)
+	for i := range result.Diagnostics {
+		if result.Diagnostics[i].File == name {
+			result.Diagnostics[i].File = SubmittedCode
+		}
+	}
+}
+
+// mapFile replaces the matches of re in s, keeping the delimiters around
+// the file name. Adjacent references share a delimiter, so s is scanned
+// until nothing is left to replace.
+func mapFile(re *regexp.Regexp, s string) string {
+	for {
+		mapped := re.ReplaceAllString(s, "${1}"+SubmittedCode+"${2}")
+		if mapped == s {
+			return s
+		}
+		s = mapped
+	}
+}
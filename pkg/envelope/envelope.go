@@ -0,0 +1,172 @@
+// Package envelope encrypts data at rest with envelope encryption: each
+// piece of data is encrypted with its own random data key, and the data key
+// is wrapped by a master key held by a KeyProvider such as a KMS. Rotating
+// the master key only rewraps data keys, without re-encrypting the data.
+package envelope
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeySize is the size of data keys and of Keyring master keys
+const KeySize = 32
+
+// magic starts every sealed envelope
+var magic = []byte("FORGEAI-ENV1")
+
+// ErrUnknownKey is returned for data keys wrapped by a key the provider does
+// not hold
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyProvider wraps and unwraps data keys with master keys it holds.
+// Implement it to keep master keys in a KMS.
+type KeyProvider interface {
+	// ActiveKeyID returns the ID of the key that wraps new data keys
+	ActiveKeyID() string
+
+	// WrapKey wraps a data key with the active key
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+
+	// UnwrapKey unwraps a data key wrapped by the key keyID
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// header precedes the ciphertext of an envelope
+type header struct {
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"key"`
+	Nonce      []byte `json:"nonce"`
+}
+
+// Seal encrypts plaintext with a new data key wrapped by the active key
+func Seal(ctx context.Context, keys KeyProvider, plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	keyID, wrapped, err := keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	h := header{KeyID: keyID, WrappedKey: wrapped, Nonce: nonce}
+	return encode(h, gcm.Seal(nil, nonce, plaintext, magic))
+}
+
+// Open decrypts an envelope made by Seal
+func Open(ctx context.Context, keys KeyProvider, sealed []byte) ([]byte, error) {
+	h, ciphertext, err := decode(sealed)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := keys.UnwrapKey(ctx, h.KeyID, h.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, h.Nonce, ciphertext, magic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Rewrap wraps the data key of an envelope with the active key, leaving the
+// ciphertext as it is. It reports false when the envelope already uses the
+// active key.
+func Rewrap(ctx context.Context, keys KeyProvider, sealed []byte) ([]byte, bool, error) {
+	h, ciphertext, err := decode(sealed)
+	if err != nil {
+		return nil, false, err
+	}
+	if h.KeyID == keys.ActiveKeyID() {
+		return sealed, false, nil
+	}
+	dataKey, err := keys.UnwrapKey(ctx, h.KeyID, h.WrappedKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	h.KeyID, h.WrappedKey, err = keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	data, err := encode(h, ciphertext)
+	return data, err == nil, err
+}
+
+// IsSealed reports whether data is an envelope
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// KeyID returns the ID of the key that wrapped the data key of an envelope
+func KeyID(sealed []byte) (string, error) {
+	h, _, err := decode(sealed)
+	return h.KeyID, err
+}
+
+// encode writes the magic, the length of the header, the header, and the
+// ciphertext
+func encode(h header, ciphertext []byte) ([]byte, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(magic) + 4 + len(data) + len(ciphertext))
+	buf.Write(magic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+	buf.Write(ciphertext)
+	return buf.Bytes(), nil
+}
+
+// decode splits an envelope into its header and ciphertext
+func decode(sealed []byte) (header, []byte, error) {
+	var h header
+	if !IsSealed(sealed) {
+		return h, nil, errors.New("data is not encrypted")
+	}
+	rest := sealed[len(magic):]
+	if len(rest) < 4 {
+		return h, nil, io.ErrUnexpectedEOF
+	}
+	n := binary.BigEndian.Uint32(rest)
+	rest = rest[4:]
+	if uint64(n) > uint64(len(rest)) {
+		return h, nil, io.ErrUnexpectedEOF
+	}
+	if err := json.Unmarshal(rest[:n], &h); err != nil {
+		return h, nil, fmt.Errorf("invalid envelope header: %w", err)
+	}
+	return h, rest[n:], nil
+}
+
+// newGCM creates an AES-256-GCM cipher
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,121 @@
+package envelope
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"forgeai/pkg/config"
+)
+
+// Keyring is a KeyProvider that holds master keys in memory. Keys are
+// rotated by adding a new key and making it active; the old keys keep
+// unwrapping the data keys they wrapped.
+type Keyring struct {
+	mu     sync.RWMutex
+	keys   map[string][]byte
+	active string
+}
+
+// NewKeyring creates an empty keyring
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string][]byte)}
+}
+
+// LoadKeyring creates a keyring with the keys of the configuration
+func LoadKeyring(cfg config.EncryptionConfig) (*Keyring, error) {
+	k := NewKeyring()
+	for _, key := range cfg.Keys {
+		data, err := os.ReadFile(key.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key %s: %w", key.ID, err)
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s is not base64: %w", key.ID, err)
+		}
+		if err := k.Add(key.ID, raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := k.SetActive(cfg.ActiveKey); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Add adds a master key of KeySize bytes
+func (k *Keyring) Add(id string, key []byte) error {
+	if id == "" {
+		return fmt.Errorf("encryption keys need an ID")
+	}
+	if len(key) != KeySize {
+		return fmt.Errorf("encryption key %s must be %d bytes, got %d", id, KeySize, len(key))
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = append([]byte(nil), key...)
+	return nil
+}
+
+// SetActive selects the key that wraps new data keys
+func (k *Keyring) SetActive(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("active encryption key %q: %w", id, ErrUnknownKey)
+	}
+	k.active = id
+	return nil
+}
+
+// ActiveKeyID returns the ID of the key that wraps new data keys
+func (k *Keyring) ActiveKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// WrapKey wraps a data key with the active key
+func (k *Keyring) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	k.mu.RLock()
+	id, key := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+	if key == nil {
+		return "", nil, fmt.Errorf("no active encryption key: %w", ErrUnknownKey)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return id, gcm.Seal(nonce, nonce, dataKey, []byte(id)), nil
+}
+
+// UnwrapKey unwraps a data key wrapped by the key id
+func (k *Keyring) UnwrapKey(ctx context.Context, id string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	key := k.keys[id]
+	k.mu.RUnlock()
+	if key == nil {
+		return nil, fmt.Errorf("key %q: %w", id, ErrUnknownKey)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped key is too short")
+	}
+	nonce, ciphertext := wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, []byte(id))
+}
@@ -0,0 +1,317 @@
+// Package events emits job lifecycle events as CloudEvents 1.0 to sinks such
+// as HTTP endpoints, NATS, and Kafka, so that event-driven infrastructure and
+// analytics pipelines consume them without custom adapters
+package events
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/jobs"
+)
+
+// SpecVersion is the CloudEvents version of the events
+const SpecVersion = "1.0"
+
+// TypePrefix prefixes the types of job events
+const TypePrefix = "dev.forgeai.job."
+
+// Job events, the short names of the event types
+const (
+	EventCreated     = "created"
+	EventStarted     = "started"
+	EventCompleted   = "completed"
+	EventFailed      = "failed"
+	EventSetupFailed = "setup_failed"
+	EventCancelled   = "cancelled"
+	EventInterrupted = "interrupted"
+)
+
+// Events lists every job event
+var Events = []string{EventCreated, EventStarted, EventCompleted, EventFailed, EventSetupFailed, EventCancelled, EventInterrupted}
+
+// DataContentType is the content type of the data of job events
+const DataContentType = "application/json"
+
+// CloudEvent is a job event in the structured JSON format of CloudEvents
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            JobData   `json:"data"`
+}
+
+// Event returns the short name of the event's type, such as completed
+func (e CloudEvent) Event() string {
+	return strings.TrimPrefix(e.Type, TypePrefix)
+}
+
+// JobData is the data of job events. It describes the job without its code
+// or output, which may be sensitive.
+type JobData struct {
+	JobID          string            `json:"job_id"`
+	Status         string            `json:"status"`
+	Language       string            `json:"language"`
+	Classification string            `json:"classification,omitempty"`
+	ParentID       string            `json:"parent_id,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	CodeHash       string            `json:"code_hash,omitempty"`
+	Attempts       int               `json:"attempts"`
+	Worker         string            `json:"worker,omitempty"`
+
+	// ExitCode and DurationMs are set for jobs that ran to the end
+	ExitCode   *int  `json:"exit_code,omitempty"`
+	DurationMs int64 `json:"duration_ms,omitempty"`
+
+	Error       string     `json:"error,omitempty"`
+	ThreatScore int        `json:"threat_score,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// EventOf returns the event of a job status, or "" for none
+func EventOf(status string) string {
+	switch status {
+	case "pending":
+		return EventCreated
+	case "running":
+		return EventStarted
+	case EventCompleted, EventFailed, EventSetupFailed, EventCancelled, EventInterrupted:
+		return status
+	}
+	return ""
+}
+
+// NewJobEvent returns the CloudEvent of a job status change from source.
+// Its ID is stable for the status change, so that consumers can
+// deduplicate redeliveries.
+func NewJobEvent(source string, e jobs.Event) (CloudEvent, bool) {
+	name := EventOf(e.Status)
+	if name == "" || e.Job == nil {
+		return CloudEvent{}, false
+	}
+	job := e.Job
+
+	data := JobData{
+		JobID:          e.JobID,
+		Status:         e.Status,
+		Language:       job.Language,
+		Classification: job.Classification,
+		ParentID:       job.ParentID,
+		Labels:         job.Labels,
+		CodeHash:       job.CodeHash,
+		Attempts:       job.Attempts,
+		Worker:         job.Worker,
+		Error:          job.Error,
+		CreatedAt:      job.CreatedAt,
+	}
+	if !job.StartedAt.IsZero() && name != EventCreated {
+		started := job.StartedAt
+		data.StartedAt = &started
+	}
+	if name != EventCreated && name != EventStarted {
+		if !job.CompletedAt.IsZero() {
+			completed := job.CompletedAt
+			data.CompletedAt = &completed
+		}
+		if job.Result != nil {
+			exitCode := job.Result.ExitCode
+			data.ExitCode = &exitCode
+			data.DurationMs = job.Result.Duration.Milliseconds()
+		}
+		if job.Threat != nil {
+			data.ThreatScore = job.Threat.Score
+		}
+	}
+
+	return CloudEvent{
+		SpecVersion:     SpecVersion,
+		ID:              fmt.Sprintf("%s-%s-%d", e.JobID, name, job.Attempts),
+		Source:          source,
+		Type:            TypePrefix + name,
+		Subject:         e.JobID,
+		Time:            e.Time.UTC(),
+		DataContentType: DataContentType,
+		Data:            data,
+	}, true
+}
+
+// Sink delivers events to a destination
+type Sink interface {
+	// Name identifies the sink in logs
+	Name() string
+
+	Send(ctx context.Context, event CloudEvent) error
+}
+
+// SinkFactory creates a sink from its configuration
+type SinkFactory func(cfg config.EventSinkConfig) (Sink, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]SinkFactory{}
+)
+
+// Register makes a sink type available to New. It is typically called from
+// an init function.
+func Register(kind string, factory SinkFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[kind] = factory
+}
+
+// SinkTypes returns the registered sink types
+func SinkTypes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	kinds := make([]string, 0, len(factories))
+	for kind := range factories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// route sends some events to a sink
+type route struct {
+	sink   Sink
+	events map[string]bool
+}
+
+func (r route) accepts(event string) bool {
+	return len(r.events) == 0 || r.events[event]
+}
+
+// Emitter emits the lifecycle events of jobs to the sinks subscribed to
+// them
+type Emitter struct {
+	// Source is the CloudEvents source of the events
+	Source string
+
+	// Timeout bounds each delivery
+	Timeout time.Duration
+
+	routes []route
+}
+
+// NewEmitter creates an emitter without sinks with the default source
+func NewEmitter() *Emitter {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	return &Emitter{
+		Source:  "/forgeai/" + hostname,
+		Timeout: 10 * time.Second,
+	}
+}
+
+// New creates an emitter from configuration
+func New(cfg config.EventsConfig) (*Emitter, error) {
+	e := NewEmitter()
+	if cfg.Source != "" {
+		e.Source = cfg.Source
+	}
+
+	for i, sinkCfg := range cfg.Sinks {
+		factoriesMu.RLock()
+		factory, ok := factories[sinkCfg.Type]
+		factoriesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("event sink %d: unknown type %q (available: %v)", i, sinkCfg.Type, SinkTypes())
+		}
+
+		for _, event := range sinkCfg.Events {
+			if !knownEvent(event) {
+				return nil, fmt.Errorf("event sink %d: unknown event %q (available: %v)", i, event, Events)
+			}
+		}
+
+		sink, err := factory(sinkCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure %s event sink: %w", sinkCfg.Type, err)
+		}
+		e.Add(sink, sinkCfg.Events...)
+	}
+
+	return e, nil
+}
+
+func knownEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Add subscribes a sink to events; no events subscribes it to all
+func (e *Emitter) Add(sink Sink, events ...string) {
+	r := route{sink: sink, events: make(map[string]bool)}
+	for _, event := range events {
+		r.events[event] = true
+	}
+	e.routes = append(e.routes, r)
+}
+
+// Emit sends an event to every subscribed sink. Delivery errors are
+// combined.
+func (e *Emitter) Emit(ctx context.Context, event CloudEvent) error {
+	if e == nil {
+		return nil
+	}
+
+	var failures []string
+	for _, r := range e.routes {
+		if !r.accepts(event.Event()) {
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, e.Timeout)
+		err := r.sink.Send(sendCtx, event)
+		cancel()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", r.sink.Name(), err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to deliver event %s: %s", event.ID, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Run emits the lifecycle events of the jobs of jm until ctx is done.
+// Events are dropped rather than delaying jobs when sinks fall behind.
+func (e *Emitter) Run(ctx context.Context, jm *jobs.Manager) {
+	updates, unsubscribe := jm.Subscribe(jobs.Filter{})
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case update := <-updates:
+			event, ok := NewJobEvent(e.Source, update)
+			if !ok {
+				continue
+			}
+			if err := e.Emit(ctx, event); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/kafka"
+	"forgeai/pkg/offline"
+)
+
+func init() {
+	Register("kafka", newKafkaSink)
+}
+
+// DefaultKafkaTopic is the topic that Kafka sinks publish records to
+const DefaultKafkaTopic = "forgeai.executions"
+
+// Record formats of Kafka sinks
+const (
+	FormatJSON = "json"
+	FormatAvro = "avro"
+)
+
+// AvroContentType is the content type of Avro records
+const AvroContentType = "application/avro"
+
+// KafkaSink publishes the data of events, the execution records of jobs, to
+// a Kafka topic keyed by job ID, so that records of a job stay in order on
+// one partition. Records carry the other attributes of the event as ce_
+// headers, the binary mode of the CloudEvents Kafka binding.
+type KafkaSink struct {
+	Topic string
+
+	// Format is FormatJSON or FormatAvro
+	Format string
+
+	// SchemaRegistry is the URL of a schema registry. When set, records
+	// start with the schema registry wire format: a zero byte and the
+	// 4-byte ID of their schema, registered under <topic>-value.
+	SchemaRegistry string
+
+	Producer *kafka.Producer
+	Client   *http.Client
+
+	mu       sync.Mutex
+	schemaID int32
+}
+
+func newKafkaSink(cfg config.EventSinkConfig) (Sink, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("brokers are required, such as kafka:9092")
+	}
+	for _, broker := range cfg.Brokers {
+		if err := offline.CheckHost("event sink "+broker, broker); err != nil {
+			return nil, err
+		}
+	}
+
+	sink := &KafkaSink{Topic: cfg.Topic, Format: cfg.Format, SchemaRegistry: strings.TrimSuffix(cfg.SchemaRegistry, "/"), Client: http.DefaultClient}
+	if sink.Topic == "" {
+		sink.Topic = DefaultKafkaTopic
+	}
+	switch sink.Format {
+	case "":
+		sink.Format = FormatJSON
+	case FormatJSON, FormatAvro:
+	default:
+		return nil, fmt.Errorf("unsupported format %q (use json or avro)", sink.Format)
+	}
+	if sink.SchemaRegistry != "" {
+		u, err := url.Parse(sink.SchemaRegistry)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("schema_registry must be an http or https URL")
+		}
+		if err := offline.CheckHost("schema registry "+u.Host, u.Host); err != nil {
+			return nil, err
+		}
+	} else if sink.Format == FormatAvro {
+		return nil, fmt.Errorf("the avro format requires a schema_registry")
+	}
+
+	producerCfg := kafka.Config{Brokers: cfg.Brokers, Username: cfg.Username, Password: cfg.Password}
+	if cfg.TLS {
+		producerCfg.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	producer, err := kafka.NewProducer(producerCfg)
+	if err != nil {
+		return nil, err
+	}
+	sink.Producer = producer
+	return sink, nil
+}
+
+// Name implements Sink
+func (k *KafkaSink) Name() string {
+	return "kafka " + k.Topic
+}
+
+// Send implements Sink
+func (k *KafkaSink) Send(ctx context.Context, event CloudEvent) error {
+	value, contentType, err := k.encode(ctx, event.Data)
+	if err != nil {
+		return err
+	}
+
+	return k.Producer.Produce(ctx, k.Topic, kafka.Message{
+		Key:   []byte(event.Subject),
+		Value: value,
+		Time:  event.Time,
+		Headers: []kafka.Header{
+			{Key: "ce_specversion", Value: []byte(event.SpecVersion)},
+			{Key: "ce_id", Value: []byte(event.ID)},
+			{Key: "ce_source", Value: []byte(event.Source)},
+			{Key: "ce_type", Value: []byte(event.Type)},
+			{Key: "ce_subject", Value: []byte(event.Subject)},
+			{Key: "ce_time", Value: []byte(event.Time.Format(time.RFC3339Nano))},
+			{Key: "content-type", Value: []byte(contentType)},
+		},
+	})
+}
+
+// encode returns a record in the format of the sink and its content type
+func (k *KafkaSink) encode(ctx context.Context, data JobData) ([]byte, string, error) {
+	var payload []byte
+	contentType := DataContentType
+	if k.Format == FormatAvro {
+		payload, contentType = EncodeAvro(data), AvroContentType
+	} else {
+		var err error
+		if payload, err = json.Marshal(data); err != nil {
+			return nil, "", err
+		}
+	}
+	if k.SchemaRegistry == "" {
+		return payload, contentType, nil
+	}
+
+	id, err := k.registerSchema(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	record := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(record[1:], uint32(id))
+	return append(record, payload...), contentType, nil
+}
+
+// registerSchema registers the schema of records with the schema registry
+// under the topic's subject, once, and returns its ID. Registering a schema
+// again returns the ID it already has.
+func (k *KafkaSink) registerSchema(ctx context.Context) (int32, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.schemaID != 0 {
+		return k.schemaID, nil
+	}
+
+	schema := map[string]string{"schema": AvroSchema}
+	if k.Format == FormatJSON {
+		schema = map[string]string{"schemaType": "JSON", "schema": JSONSchema}
+	}
+	body, _ := json.Marshal(schema)
+	u := k.SchemaRegistry + "/subjects/" + url.PathEscape(k.Topic+"-value") + "/versions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+
+	resp, err := k.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to register schema: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to register schema: unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	var registered struct {
+		ID int32 `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &registered); err != nil || registered.ID == 0 {
+		return 0, fmt.Errorf("failed to register schema: invalid response %s", respBody)
+	}
+	k.schemaID = registered.ID
+	return k.schemaID, nil
+}
+
+// AvroSchema is the Avro schema of execution records, the JobData of events
+const AvroSchema = `{
+  "type": "record",
+  "name": "ExecutionRecord",
+  "namespace": "dev.forgeai",
+  "fields": [
+    {"name": "job_id", "type": "string"},
+    {"name": "status", "type": "string"},
+    {"name": "language", "type": "string"},
+    {"name": "classification", "type": ["null", "string"], "default": null},
+    {"name": "parent_id", "type": ["null", "string"], "default": null},
+    {"name": "labels", "type": {"type": "map", "values": "string"}, "default": {}},
+    {"name": "code_hash", "type": ["null", "string"], "default": null},
+    {"name": "attempts", "type": "int"},
+    {"name": "worker", "type": ["null", "string"], "default": null},
+    {"name": "exit_code", "type": ["null", "int"], "default": null},
+    {"name": "duration_ms", "type": "long", "default": 0},
+    {"name": "error", "type": ["null", "string"], "default": null},
+    {"name": "threat_score", "type": "int", "default": 0},
+    {"name": "created_at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "started_at", "type": ["null", {"type": "long", "logicalType": "timestamp-millis"}], "default": null},
+    {"name": "completed_at", "type": ["null", {"type": "long", "logicalType": "timestamp-millis"}], "default": null}
+  ]
+}`
+
+// JSONSchema is the JSON Schema of execution records, the JobData of events
+const JSONSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "ExecutionRecord",
+  "type": "object",
+  "properties": {
+    "job_id": {"type": "string"},
+    "status": {"type": "string"},
+    "language": {"type": "string"},
+    "classification": {"type": "string"},
+    "parent_id": {"type": "string"},
+    "labels": {"type": "object", "additionalProperties": {"type": "string"}},
+    "code_hash": {"type": "string"},
+    "attempts": {"type": "integer"},
+    "worker": {"type": "string"},
+    "exit_code": {"type": "integer"},
+    "duration_ms": {"type": "integer"},
+    "error": {"type": "string"},
+    "threat_score": {"type": "integer"},
+    "created_at": {"type": "string", "format": "date-time"},
+    "started_at": {"type": "string", "format": "date-time"},
+    "completed_at": {"type": "string", "format": "date-time"}
+  },
+  "required": ["job_id", "status", "language", "attempts", "created_at"]
+}`
+
+// EncodeAvro encodes execution records in the Avro binary encoding of
+// AvroSchema
+func EncodeAvro(data JobData) []byte {
+	var w avroWriter
+	w.string(data.JobID)
+	w.string(data.Status)
+	w.string(data.Language)
+	w.optionalString(data.Classification)
+	w.optionalString(data.ParentID)
+
+	// A map is a block of its entries followed by an empty block
+	keys := make([]string, 0, len(data.Labels))
+	for key := range data.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		w.long(int64(len(keys)))
+		for _, key := range keys {
+			w.string(key)
+			w.string(data.Labels[key])
+		}
+	}
+	w.long(0)
+
+	w.optionalString(data.CodeHash)
+	w.long(int64(data.Attempts))
+	w.optionalString(data.Worker)
+	if data.ExitCode == nil {
+		w.long(0)
+	} else {
+		w.long(1)
+		w.long(int64(*data.ExitCode))
+	}
+	w.long(data.DurationMs)
+	w.optionalString(data.Error)
+	w.long(int64(data.ThreatScore))
+	w.long(data.CreatedAt.UnixMilli())
+	w.optionalTime(data.StartedAt)
+	w.optionalTime(data.CompletedAt)
+	return w.buf
+}
+
+// avroWriter writes the Avro binary encoding. Unions of null and a type
+// are the index of the branch followed by the value of the type.
+type avroWriter struct {
+	buf []byte
+}
+
+// long writes ints and longs, zigzag encoded variable length integers
+func (w *avroWriter) long(v int64) {
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *avroWriter) string(s string) {
+	w.long(int64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// optionalString writes empty strings as null
+func (w *avroWriter) optionalString(s string) {
+	if s == "" {
+		w.long(0)
+		return
+	}
+	w.long(1)
+	w.string(s)
+}
+
+func (w *avroWriter) optionalTime(t *time.Time) {
+	if t == nil {
+		w.long(0)
+		return
+	}
+	w.long(1)
+	w.long(t.UnixMilli())
+}
@@ -0,0 +1,311 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/offline"
+)
+
+func init() {
+	Register("http", newHTTPSink)
+	Register("nats", newNATSSink)
+}
+
+// HTTP content modes of CloudEvents
+const (
+	ModeStructured = "structured"
+	ModeBinary     = "binary"
+)
+
+// StructuredContentType is the content type of structured CloudEvents
+const StructuredContentType = "application/cloudevents+json"
+
+// HTTPSink posts events to an HTTP endpoint in the CloudEvents HTTP binding
+type HTTPSink struct {
+	URL string
+
+	// Mode is ModeStructured or ModeBinary
+	Mode    string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+func newHTTPSink(cfg config.EventSinkConfig) (Sink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an http or https URL")
+	}
+	mode := cfg.Mode
+	switch mode {
+	case "":
+		mode = ModeStructured
+	case ModeStructured, ModeBinary:
+	default:
+		return nil, fmt.Errorf("unsupported mode %q (use structured or binary)", mode)
+	}
+	if err := offline.CheckHost("event sink "+u.Host, u.Host); err != nil {
+		return nil, err
+	}
+	return &HTTPSink{URL: cfg.URL, Mode: mode, Headers: cfg.Headers, Client: http.DefaultClient}, nil
+}
+
+// Name implements Sink
+func (h *HTTPSink) Name() string {
+	return "http " + h.URL
+}
+
+// Send implements Sink. Structured events are the whole event as JSON;
+// binary events are its data, with the other attributes as ce- headers.
+func (h *HTTPSink) Send(ctx context.Context, event CloudEvent) error {
+	var body []byte
+	var err error
+	if h.Mode == ModeBinary {
+		body, err = json.Marshal(event.Data)
+	} else {
+		body, err = json.Marshal(event)
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if h.Mode == ModeBinary {
+		req.Header.Set("Content-Type", event.DataContentType)
+		req.Header.Set("ce-specversion", event.SpecVersion)
+		req.Header.Set("ce-id", event.ID)
+		req.Header.Set("ce-source", event.Source)
+		req.Header.Set("ce-type", event.Type)
+		req.Header.Set("ce-subject", event.Subject)
+		req.Header.Set("ce-time", event.Time.Format(time.RFC3339Nano))
+	} else {
+		req.Header.Set("Content-Type", StructuredContentType)
+	}
+	for key, value := range h.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// DefaultNATSSubject is the subject that NATS sinks publish events below
+const DefaultNATSSubject = "forgeai.jobs"
+
+// NATSSink publishes structured events to a NATS server, each to the
+// subject of its event below Subject, such as forgeai.jobs.completed. It
+// speaks the core NATS protocol and waits for the server to acknowledge
+// each event with a PONG, so that delivery errors are reported.
+type NATSSink struct {
+	// Address is the host:port of the server
+	Address string
+	Subject string
+
+	// TLS is set for servers that require TLS
+	TLS bool
+
+	// User and Password, or Token, authenticate to the server
+	User     string
+	Password string
+	Token    string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newNATSSink(cfg config.EventSinkConfig) (Sink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("url must be a nats URL such as nats://nats:4222")
+	}
+	sink := &NATSSink{Address: u.Host, Subject: cfg.Subject}
+	switch u.Scheme {
+	case "nats":
+	case "tls":
+		sink.TLS = true
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q (use nats or tls)", u.Scheme)
+	}
+	if u.Port() == "" {
+		sink.Address = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if sink.Subject == "" {
+		sink.Subject = DefaultNATSSubject
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			sink.User, sink.Password = u.User.Username(), password
+		} else {
+			sink.Token = u.User.Username()
+		}
+	}
+	if err := offline.CheckHost("event sink "+sink.Address, sink.Address); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// Name implements Sink
+func (n *NATSSink) Name() string {
+	return "nats " + n.Address
+}
+
+// Send implements Sink, reconnecting once if the connection was lost
+func (n *NATSSink) Send(ctx context.Context, event CloudEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	subject := n.Subject + "." + event.Event()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		err := n.publish(ctx, subject, payload)
+		if err == nil {
+			return nil
+		}
+		if n.conn != nil {
+			n.conn.Close()
+			n.conn = nil
+		}
+		var protoErr natsError
+		if attempt > 0 || errors.As(err, &protoErr) {
+			return err
+		}
+	}
+}
+
+// publish sends a message and waits for the server to acknowledge it
+func (n *NATSSink) publish(ctx context.Context, subject string, payload []byte) error {
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		n.conn.SetDeadline(deadline)
+	} else {
+		n.conn.SetDeadline(time.Time{})
+	}
+
+	msg := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+	if _, err := io.WriteString(n.conn, msg); err != nil {
+		return fmt.Errorf("failed to publish to nats: %w", err)
+	}
+	return n.awaitPong()
+}
+
+// connect connects and authenticates to the server
+func (n *NATSSink) connect(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// The server introduces itself with INFO, after which clients that
+	// use TLS upgrade the connection
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("failed to connect to nats: unexpected greeting %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+	if n.TLS || info.TLSRequired {
+		host, _, _ := net.SplitHostPort(n.Address)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to connect to nats: %w", err)
+		}
+		conn, reader = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "forgeai",
+		"lang":     "go",
+		"version":  "1.0.0",
+		"protocol": 1,
+	}
+	if n.User != "" {
+		options["user"], options["pass"] = n.User, n.Password
+	}
+	if n.Token != "" {
+		options["auth_token"] = n.Token
+	}
+	connect, _ := json.Marshal(options)
+	n.conn, n.reader = conn, reader
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		n.conn = nil
+		conn.Close()
+		return fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	if err := n.awaitPong(); err != nil {
+		n.conn = nil
+		conn.Close()
+		return err
+	}
+	return nil
+}
+
+// natsError is an -ERR sent by the server
+type natsError string
+
+func (e natsError) Error() string {
+	return "nats: " + string(e)
+}
+
+// awaitPong reads until the PONG to a PING, answering the server's PINGs
+func (n *NATSSink) awaitPong() error {
+	for {
+		line, err := n.reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read from nats: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			io.WriteString(n.conn, "PONG\r\n")
+		case strings.HasPrefix(line, "-ERR"):
+			return natsError(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+	}
+}
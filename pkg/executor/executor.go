@@ -8,7 +8,14 @@ import (
 	"path/filepath"
 	"time"
 
+	"forgeai/pkg/coverage"
+	"forgeai/pkg/diagnostics"
+	"forgeai/pkg/fixtures"
+	"forgeai/pkg/profile"
+	"forgeai/pkg/restricted"
 	"forgeai/pkg/sandbox"
+	"forgeai/pkg/trace"
+	"forgeai/pkg/workspace"
 )
 
 // LocalExecutor is a basic implementation of the Executor interface
@@ -19,6 +26,62 @@ type LocalExecutor struct {
 
 	// MemoryLimit in MB
 	MemoryLimit int
+
+	// Trace records syscalls and network activity and attaches the trace
+	// to the result as artifacts
+	Trace bool
+
+	// TrackWorkspace runs the program in the directory of its source file
+	// and reports the files it created, modified, or deleted there
+	TrackWorkspace bool
+
+	// InlineFiles is the maximum size in bytes of created or modified
+	// workspace files whose contents are returned in the result. Zero
+	// disables inlining; a positive value implies TrackWorkspace.
+	InlineFiles int64
+
+	// Workspaces provides the working directories of code executions, with
+	// quotas and crash cleanup; a temp directory is used when nil
+	Workspaces *workspace.Manager
+
+	// JobID is recorded as the owner of the workspace
+	JobID string
+
+	// Rlimits are applied to the program with setrlimit; zero limits use
+	// the defaults
+	Rlimits sandbox.Rlimits
+
+	// Output bounds the output held in memory; zero limits use
+	// sandbox.DefaultOutputLimits
+	Output sandbox.OutputLimits
+
+	// Profile reports the peak memory and CPU use of the program
+	Profile bool
+
+	// Flamegraph attaches a flamegraph of the program to the result as an
+	// artifact and implies Profile. It requires py-spy and Python code.
+	Flamegraph bool
+
+	// Coverage runs the program under the coverage tool of its language
+	// and reports how much of it ran
+	Coverage bool
+
+	// MapTracebacks rewrites references to the temporary file of submitted
+	// code in the output as "<submitted code>"
+	MapTracebacks bool
+
+	// Fixtures are linked into a directory named by FORGEAI_FIXTURES. The
+	// files are read-only, but without a mount namespace a program running
+	// as their owner could change their mode.
+	Fixtures []sandbox.Fixture
+
+	// Volume is the directory of the job's persistent volume, named to the
+	// program by FORGEAI_VOLUME; none when empty
+	Volume string
+
+	// Locale sets TZ, LANG, and LC_ALL for the program; empty fields use
+	// sandbox.DefaultLocale
+	Locale sandbox.Locale
 }
 
 // NewLocalExecutor creates a new LocalExecutor with default settings
@@ -36,6 +99,16 @@ func (e *LocalExecutor) Execute(ctx context.Context, language, code string) (*sa
 		return nil, fmt.Errorf("unsupported language: %s", language)
 	}
 
+	// Restricted Python runs in the interpreter of this process
+	if language == restricted.Language {
+		return e.restricted().Execute(ctx, language, code)
+	}
+
+	// Use a managed workspace, which runs the program in its directory
+	if e.Workspaces != nil {
+		return e.executeInWorkspace(ctx, language, code)
+	}
+
 	// Create a temporary directory for execution
 	tempDir, err := os.MkdirTemp("", "forgeai-*")
 	if err != nil {
@@ -50,7 +123,39 @@ func (e *LocalExecutor) Execute(ctx context.Context, language, code string) (*sa
 	}
 
 	// Execute the file
-	return e.ExecuteFile(ctx, filePath)
+	result, err := e.ExecuteFile(ctx, filePath)
+	if err == nil && e.MapTracebacks {
+		diagnostics.MapTracebacks(result, filePath)
+	}
+	return result, err
+}
+
+// executeInWorkspace runs code in a workspace from e.Workspaces, stopping it
+// when the workspace exceeds its quota
+func (e *LocalExecutor) executeInWorkspace(ctx context.Context, language, code string) (*sandbox.ExecutionResult, error) {
+	ws, err := e.Workspaces.Create(e.JobID)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Release()
+
+	filePath, err := e.writeCodeToFile(ws.Path, language, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write code to file: %w", err)
+	}
+
+	ctx, stop := ws.Enforce(ctx)
+	defer stop()
+
+	result, err := e.executeFile(ctx, filePath, ws.Path)
+	if err == nil && ws.QuotaExceeded() {
+		result.Stderr = "Workspace quota exceeded"
+		result.ExitCode = -1
+	}
+	if err == nil && e.MapTracebacks {
+		diagnostics.MapTracebacks(result, filePath)
+	}
+	return result, err
 }
 
 // isLanguageSupported checks if the language is supported
@@ -66,6 +171,12 @@ func (e *LocalExecutor) isLanguageSupported(language string) bool {
 
 // ExecuteFile runs the provided file in a sandboxed environment
 func (e *LocalExecutor) ExecuteFile(ctx context.Context, filePath string) (*sandbox.ExecutionResult, error) {
+	return e.executeFile(ctx, filePath, "")
+}
+
+// executeFile runs a file in dir, or in the current directory when dir is
+// empty and the workspace is not tracked
+func (e *LocalExecutor) executeFile(ctx context.Context, filePath, dir string) (*sandbox.ExecutionResult, error) {
 	// Get the language from the file extension
 	language := e.getLanguageFromFile(filePath)
 
@@ -75,10 +186,93 @@ func (e *LocalExecutor) ExecuteFile(ctx context.Context, filePath string) (*sand
 		return nil, fmt.Errorf("unsupported language: %s", language)
 	}
 
+	// A missing interpreter is a problem of the host, not of the program
+	if _, err := exec.LookPath(cmdArgs[0]); err != nil {
+		return nil, fmt.Errorf("interpreter for %s is not installed: %w", language, err)
+	}
+
+	// Run the program under its coverage tool in coverage mode
+	var cov *coverage.Collector
+	var coverageEnv []string
+	if e.Coverage {
+		if !coverage.Available(language) {
+			return nil, fmt.Errorf("coverage for %s requires %s", language, coverage.Tool(language))
+		}
+		cov, err = coverage.New(language, filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer cov.Close()
+		cmdArgs, coverageEnv = cov.Wrap(cmdArgs)
+	}
+
 	// Apply resource limits
 	// Note: Full sandboxing would require more sophisticated techniques
 	// like containers or system call filtering which are OS-specific
 
+	// Wrap the command with strace in trace mode
+	var traceFile string
+	if e.Trace {
+		if !trace.Available() {
+			return nil, fmt.Errorf("trace mode requires strace to be installed")
+		}
+		f, err := os.CreateTemp("", "forgeai-trace-*.log")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trace file: %w", err)
+		}
+		traceFile = f.Name()
+		f.Close()
+		defer os.Remove(traceFile)
+		cmdArgs = trace.Wrap(cmdArgs, traceFile)
+	}
+
+	// Measure the program with GNU time in profile mode, or with the
+	// kernel's accounting of the child process when it is not installed
+	profiling := e.Profile || e.Flamegraph
+	var timeFile, flameFile string
+	if profiling {
+		if !profile.Supported() {
+			return nil, fmt.Errorf("profiling is not supported on this platform")
+		}
+		if e.Flamegraph && !profile.FlamegraphAvailable(language) {
+			return nil, fmt.Errorf("flamegraphs require py-spy to be installed and are only recorded for python")
+		}
+		if profile.Available() {
+			if timeFile, err = createTempFile("forgeai-time-*.log"); err != nil {
+				return nil, err
+			}
+			defer os.Remove(timeFile)
+			cmdArgs = profile.Wrap(cmdArgs, timeFile)
+		}
+		if e.Flamegraph {
+			if flameFile, err = createTempFile("forgeai-flamegraph-*.svg"); err != nil {
+				return nil, err
+			}
+			defer os.Remove(flameFile)
+			cmdArgs = profile.WrapFlamegraph(cmdArgs, flameFile)
+		}
+	}
+
+	// Apply the resource limits through the helper process
+	cmdArgs, limitEnv, err := wrapRlimits(cmdArgs, e.Rlimits.WithDefaults(sandbox.DefaultRlimits()))
+	if err != nil {
+		return nil, err
+	}
+
+	// Make the fixtures available to the program
+	if len(e.Fixtures) > 0 {
+		dir, cleanup, err := fixtures.Link(e.Fixtures)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		limitEnv = append(limitEnv, "FORGEAI_FIXTURES="+dir)
+	}
+	if e.Volume != "" {
+		limitEnv = append(limitEnv, "FORGEAI_VOLUME="+e.Volume)
+	}
+	limitEnv = append(limitEnv, e.Locale.Env()...)
+
 	// Set up context with timeout
 	if e.Timeout > 0 {
 		var cancel context.CancelFunc
@@ -87,6 +281,22 @@ func (e *LocalExecutor) ExecuteFile(ctx context.Context, filePath string) (*sand
 	}
 
 	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	cmd.Dir = dir
+	if env := append(limitEnv, coverageEnv...); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	// Snapshot the workspace so changes can be reported afterwards
+	var before workspace.Snapshot
+	if e.TrackWorkspace || e.InlineFiles > 0 {
+		if cmd.Dir == "" {
+			cmd.Dir = filepath.Dir(filePath)
+		}
+		before, err = workspace.Take(cmd.Dir)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Capture output
 	result := &sandbox.ExecutionResult{
@@ -97,10 +307,31 @@ func (e *LocalExecutor) ExecuteFile(ctx context.Context, filePath string) (*sand
 	start := time.Now()
 
 	// Run the command
-	output, err := cmd.CombinedOutput()
+	output := e.Output.NewBuffer()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err = cmd.Run()
 
 	result.Duration = time.Since(start)
-	result.Stdout = string(output)
+	result.Stdout = output.String()
+	result.OutputOmitted = output.Omitted()
+
+	if traceFile != "" {
+		attachTrace(result, traceFile)
+	}
+
+	if profiling {
+		attachProfile(result, cmd.ProcessState, timeFile, flameFile)
+	}
+
+	if before != nil {
+		if after, err := workspace.Take(cmd.Dir); err == nil {
+			result.Workspace = workspace.Diff(before, after)
+			if e.InlineFiles > 0 {
+				workspace.Inline(cmd.Dir, result.Workspace, e.InlineFiles)
+			}
+		}
+	}
 
 	// Check if the context was cancelled (timeout)
 	if ctx.Err() == context.DeadlineExceeded {
@@ -111,22 +342,140 @@ func (e *LocalExecutor) ExecuteFile(ctx context.Context, filePath string) (*sand
 
 	// Get exit code
 	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitError.ExitCode()
-		} else {
-			result.ExitCode = -1
-			result.Stderr = err.Error()
+		exitError, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf("failed to run program: %w", err)
 		}
+		result.ExitCode = exitError.ExitCode()
 	} else {
 		result.ExitCode = 0
 	}
 
+	// Report compiler errors of programs that did not build
+	if result.ExitCode != 0 {
+		result.Diagnostics = diagnostics.Parse(language, result.Stdout)
+	}
+
+	// Report coverage whether or not the program's tests passed
+	if cov != nil {
+		attachCoverage(ctx, result, cov)
+	}
+
 	return result, nil
 }
 
+// attachTrace adds the raw strace log and the parsed report as artifacts
+func attachTrace(result *sandbox.ExecutionResult, traceFile string) {
+	data, err := os.ReadFile(traceFile)
+	if err != nil {
+		return
+	}
+
+	result.Artifacts = append(result.Artifacts,
+		sandbox.Artifact{Name: "trace.json", ContentType: "application/json", Data: trace.Parse(data).JSON()},
+		sandbox.Artifact{Name: "strace.log", ContentType: "text/plain", Data: data},
+	)
+}
+
+// attachProfile adds the resource usage of the program to the result, from
+// the report of GNU time when there is one, and the flamegraph as an artifact
+func attachProfile(result *sandbox.ExecutionResult, state *os.ProcessState, timeFile, flameFile string) {
+	if data, err := os.ReadFile(timeFile); err == nil && len(data) > 0 {
+		result.Profile = profile.Parse(data)
+	} else {
+		result.Profile = profile.FromProcessState(state, result.Duration)
+	}
+
+	if flameFile == "" {
+		return
+	}
+	if data, err := os.ReadFile(flameFile); err == nil && len(data) > 0 {
+		result.Artifacts = append(result.Artifacts,
+			sandbox.Artifact{Name: "flamegraph.svg", ContentType: "image/svg+xml", Data: data})
+	}
+}
+
+// attachCoverage adds the coverage of the program to the result, and the
+// detailed report as an artifact
+func attachCoverage(ctx context.Context, result *sandbox.ExecutionResult, cov *coverage.Collector) {
+	summary, report, err := cov.Collect(ctx)
+	if err != nil {
+		result.Coverage = &sandbox.Coverage{Tool: cov.Tool(), Error: err.Error()}
+		return
+	}
+	result.Coverage = summary
+	result.Artifacts = append(result.Artifacts, *report)
+}
+
+// createTempFile creates an empty temporary file for a tool to write to and
+// returns its path
+func createTempFile(pattern string) (string, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// Capabilities reports what the local executor enforces. Programs run as
+// ordinary host processes, so only the timeout is enforced.
+func (e *LocalExecutor) Capabilities() sandbox.Capabilities {
+	caps := sandbox.Capabilities{
+		Backend:           "local",
+		Available:         true,
+		Timeout:           true,
+		WorkspaceTracking: true,
+		Trace:             trace.Available(),
+		Profiling:         profile.Supported(),
+		Notes:             []string{"memory limits are not enforced; programs run as host processes"},
+	}
+	// Traces and flamegraphs are returned as artifacts
+	caps.Artifacts = caps.Trace || profile.FlamegraphAvailable("python")
+	if !caps.Trace {
+		caps.Notes = append(caps.Notes, "tracing requires strace")
+	}
+	if caps.Profiling && !profile.Available() {
+		caps.Notes = append(caps.Notes, "profiles are taken from the kernel's accounting of the program; GNU time is not installed")
+	}
+	if !profile.FlamegraphAvailable("python") {
+		caps.Notes = append(caps.Notes, "flamegraphs require py-spy")
+	}
+	for _, language := range e.SupportedLanguages() {
+		if language == restricted.Language {
+			continue
+		}
+		if coverage.Available(language) {
+			caps.Coverage = true
+		} else {
+			caps.Notes = append(caps.Notes, fmt.Sprintf("coverage for %s requires %s", language, coverage.Tool(language)))
+		}
+	}
+	caps.Artifacts = caps.Artifacts || caps.Coverage
+	if e.Workspaces != nil && e.Workspaces.Quota > 0 {
+		caps.Notes = append(caps.Notes, "workspace size quotas are enforced")
+	}
+	if rlimitsSupported {
+		caps.Notes = append(caps.Notes, "open files, file size, stack size, and core dumps are limited with setrlimit")
+	} else {
+		caps.Notes = append(caps.Notes, "resource limits are not supported on this platform")
+	}
+	return caps
+}
+
 // SupportedLanguages returns a list of supported languages
 func (e *LocalExecutor) SupportedLanguages() []string {
-	return []string{"python", "go", "javascript"}
+	return []string{"python", "go", "javascript", restricted.Language}
+}
+
+// restricted creates the executor of restricted Python with the limits of
+// e. The options that need a process, such as tracing, do not apply.
+func (e *LocalExecutor) restricted() *restricted.Executor {
+	return &restricted.Executor{
+		Timeout:     e.Timeout,
+		MemoryLimit: e.MemoryLimit,
+		Output:      e.Output,
+	}
 }
 
 // writeCodeToFile writes the provided code to a temporary file
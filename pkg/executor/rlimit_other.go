@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package executor
+
+import "forgeai/pkg/sandbox"
+
+// rlimitsSupported reports whether limits can be applied on this platform
+const rlimitsSupported = false
+
+// wrapRlimits leaves args unchanged because resource limits are not
+// supported on this platform
+func wrapRlimits(args []string, limits sandbox.Rlimits) ([]string, []string, error) {
+	return args, nil, nil
+}
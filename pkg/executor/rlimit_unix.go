@@ -0,0 +1,82 @@
+//go:build linux || darwin
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"forgeai/pkg/sandbox"
+)
+
+// rlimitEnv passes the limits to the helper process that applies them
+const rlimitEnv = "FORGEAI_RLIMITS"
+
+// A process started with rlimitEnv is the helper: it applies the limits to
+// itself and replaces itself with the program in its arguments, so that the
+// limits hold from the program's first instruction
+func init() {
+	if limits, ok := os.LookupEnv(rlimitEnv); ok {
+		os.Unsetenv(rlimitEnv)
+		if err := execWithRlimits(limits, os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "forgeai: %v\n", err)
+			os.Exit(127)
+		}
+	}
+}
+
+// rlimitsSupported reports whether limits can be applied on this platform
+const rlimitsSupported = true
+
+// wrapRlimits returns the command and extra environment that run args under
+// limits, through this executable as the helper
+func wrapRlimits(args []string, limits sandbox.Rlimits) ([]string, []string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply resource limits: %w", err)
+	}
+	env := fmt.Sprintf("%s=%d,%d,%d,%d", rlimitEnv, limits.OpenFiles, limits.FileSize, limits.StackSize, limits.CoreSize())
+	return append([]string{self}, args...), []string{env}, nil
+}
+
+// execWithRlimits applies the encoded limits and executes args
+func execWithRlimits(encoded string, args []string) error {
+	fields := strings.Split(encoded, ",")
+	resources := []int{syscall.RLIMIT_NOFILE, syscall.RLIMIT_FSIZE, syscall.RLIMIT_STACK, syscall.RLIMIT_CORE}
+	if len(fields) != len(resources) || len(args) == 0 {
+		return fmt.Errorf("invalid resource limit helper invocation")
+	}
+
+	for i, resource := range resources {
+		value, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid resource limit %q", fields[i])
+		}
+		if err := setRlimit(resource, value); err != nil {
+			return fmt.Errorf("failed to set resource limit: %w", err)
+		}
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, args, os.Environ())
+}
+
+// setRlimit sets the soft and hard limit of a resource. Without privileges
+// the hard limit cannot be raised, so larger values are capped to it.
+func setRlimit(resource int, value uint64) error {
+	var current syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &current); err != nil {
+		return err
+	}
+	if value > current.Max && os.Geteuid() != 0 {
+		value = current.Max
+	}
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value})
+}
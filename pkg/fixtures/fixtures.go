@@ -0,0 +1,257 @@
+// Package fixtures stores named datasets and files that are uploaded once
+// and then mounted read-only into the jobs that reference them, so that
+// large inputs are not sent with every execution
+package fixtures
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/sandbox"
+)
+
+// nameRe matches fixture names, which are also their file names in the
+// sandbox
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+var (
+	// ErrNotFound is returned for fixtures that do not exist
+	ErrNotFound = errors.New("fixture not found")
+
+	// ErrTooLarge is returned for uploads larger than the store's MaxSize
+	ErrTooLarge = errors.New("fixture is too large")
+)
+
+// Fixture describes a stored fixture
+type Fixture struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps fixtures in a directory: their contents in data/, read-only,
+// and their descriptions in meta/
+type Store struct {
+	// Dir is the directory of the store
+	Dir string
+
+	// MaxSize is the maximum size in bytes of one fixture; unlimited when
+	// zero
+	MaxSize int64
+
+	mu       sync.RWMutex
+	fixtures map[string]Fixture
+}
+
+// NewStore creates a store in dir. Call Open before using it.
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+// Open creates the store's directories, loads the stored fixtures, and
+// removes uploads interrupted by a crash
+func (s *Store) Open() error {
+	for _, dir := range []string{s.dataDir(), s.metaDir(), s.tmpDir()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create fixture directory: %w", err)
+		}
+	}
+	if entries, err := os.ReadDir(s.tmpDir()); err == nil {
+		for _, entry := range entries {
+			os.Remove(filepath.Join(s.tmpDir(), entry.Name()))
+		}
+	}
+
+	entries, err := os.ReadDir(s.metaDir())
+	if err != nil {
+		return fmt.Errorf("failed to read fixtures: %w", err)
+	}
+	fixtures := make(map[string]Fixture)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(s.metaDir(), entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read fixture: %w", err)
+		}
+		var f Fixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			fmt.Printf("Warning: skipping corrupt fixture %s: %v\n", entry.Name(), err)
+			continue
+		}
+		if _, err := os.Stat(s.Path(f.Name)); err != nil {
+			fmt.Printf("Warning: skipping fixture %s without data: %v\n", f.Name, err)
+			continue
+		}
+		fixtures[f.Name] = f
+	}
+
+	s.mu.Lock()
+	s.fixtures = fixtures
+	s.mu.Unlock()
+	return nil
+}
+
+// Put stores the contents of r as a fixture, replacing any fixture of the
+// same name. Jobs already running keep the contents they started with
+// when the backend mounts fixtures.
+func (s *Store) Put(name string, r io.Reader) (Fixture, error) {
+	if !nameRe.MatchString(name) {
+		return Fixture{}, fmt.Errorf("invalid fixture name: %q", name)
+	}
+
+	tmp, err := os.CreateTemp(s.tmpDir(), "upload-*")
+	if err != nil {
+		return Fixture{}, fmt.Errorf("failed to create fixture: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	src := r
+	if s.MaxSize > 0 {
+		src = io.LimitReader(r, s.MaxSize+1)
+	}
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return Fixture{}, fmt.Errorf("failed to write fixture: %w", err)
+	}
+	if s.MaxSize > 0 && size > s.MaxSize {
+		return Fixture{}, fmt.Errorf("%w: the limit is %d bytes", ErrTooLarge, s.MaxSize)
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return Fixture{}, fmt.Errorf("failed to write fixture: %w", err)
+	}
+
+	f := Fixture{
+		Name:      name,
+		Size:      size,
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		CreatedAt: time.Now().UTC(),
+	}
+	meta, err := json.Marshal(f)
+	if err != nil {
+		return Fixture{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Rename(tmp.Name(), s.Path(name)); err != nil {
+		return Fixture{}, fmt.Errorf("failed to store fixture: %w", err)
+	}
+	if err := os.WriteFile(s.metaPath(name), meta, 0644); err != nil {
+		return Fixture{}, fmt.Errorf("failed to store fixture: %w", err)
+	}
+	if s.fixtures == nil {
+		s.fixtures = make(map[string]Fixture)
+	}
+	s.fixtures[name] = f
+	return f, nil
+}
+
+// Get returns a fixture by name
+func (s *Store) Get(name string) (Fixture, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, ok := s.fixtures[name]
+	return f, ok
+}
+
+// List returns the fixtures sorted by name
+func (s *Store) List() []Fixture {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Fixture, 0, len(s.fixtures))
+	for _, f := range s.fixtures {
+		list = append(list, f)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Delete removes a fixture and reports whether it existed. Jobs already
+// running keep their open copy.
+func (s *Store) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.fixtures[name]; !ok {
+		return false
+	}
+	delete(s.fixtures, name)
+	os.Remove(s.metaPath(name))
+	os.Remove(s.Path(name))
+	return true
+}
+
+// Path returns the file holding the contents of a fixture
+func (s *Store) Path(name string) string {
+	return filepath.Join(s.dataDir(), name)
+}
+
+// Resolve returns the fixtures of a job by name
+func (s *Store) Resolve(names []string) ([]sandbox.Fixture, error) {
+	resolved := make([]sandbox.Fixture, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if _, ok := s.Get(name); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		resolved = append(resolved, sandbox.Fixture{Name: name, Source: s.Path(name)})
+	}
+	return resolved, nil
+}
+
+// Link creates a directory of symbolic links to fixtures for backends that
+// cannot mount files, and returns it with a function that removes it
+func Link(fixtures []sandbox.Fixture) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "forgeai-fixtures-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	for _, f := range fixtures {
+		if strings.ContainsAny(f.Name, `/\`) {
+			cleanup()
+			return "", nil, fmt.Errorf("invalid fixture name: %q", f.Name)
+		}
+		if err := os.Symlink(f.Source, filepath.Join(dir, f.Name)); err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("failed to link fixture %s: %w", f.Name, err)
+		}
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to link fixtures: %w", err)
+	}
+	return dir, func() {
+		os.Chmod(dir, 0755)
+		os.RemoveAll(dir)
+	}, nil
+}
+
+func (s *Store) dataDir() string { return filepath.Join(s.Dir, "data") }
+func (s *Store) metaDir() string { return filepath.Join(s.Dir, "meta") }
+func (s *Store) tmpDir() string  { return filepath.Join(s.Dir, "tmp") }
+
+// metaPath returns the file describing a fixture
+func (s *Store) metaPath(name string) string {
+	return filepath.Join(s.metaDir(), name+".json")
+}
@@ -0,0 +1,141 @@
+// Package hardware reports the hardware class of the worker that runs a
+// job: its CPU model, the CPU its cgroup may use, and its load. Replicas of
+// the API server can run on different hardware, and a calibration benchmark
+// scores each one so that job durations can be normalized before they are
+// compared.
+package hardware
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Class describes the hardware of a worker when it ran a job
+type Class struct {
+	// Worker identifies the replica that ran the job
+	Worker string `json:"worker,omitempty"`
+
+	Arch     string `json:"arch"`
+	CPUModel string `json:"cpu_model,omitempty"`
+	CPUs     int    `json:"cpus"`
+
+	// CPUQuota is how many CPUs the cgroup cpu.max of the worker allows;
+	// zero when unlimited or unknown
+	CPUQuota float64 `json:"cpu_quota,omitempty"`
+
+	// Load1 is the one-minute load average of the host
+	Load1 float64 `json:"load1"`
+
+	// Score is how fast the worker ran the calibration benchmark relative
+	// to the reference hardware, where 2 is twice as fast; zero when the
+	// worker was not calibrated
+	Score float64 `json:"score,omitempty"`
+}
+
+// Cores returns how many CPUs the worker may use
+func (c Class) Cores() float64 {
+	if c.CPUQuota > 0 && c.CPUQuota < float64(c.CPUs) {
+		return c.CPUQuota
+	}
+	return float64(c.CPUs)
+}
+
+// Normalize converts a duration measured on the worker to the duration
+// expected on the reference hardware. Durations of uncalibrated workers are
+// returned as they are.
+func (c Class) Normalize(d time.Duration) time.Duration {
+	if c.Score <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * c.Score)
+}
+
+// Probe reports the hardware class of the host it runs on. The CPU model
+// is read once; the quota and load are read on every call to Class.
+type Probe struct {
+	// Worker identifies the replica in the classes it reports
+	Worker string
+
+	once     sync.Once
+	cpuModel string
+
+	mu           sync.RWMutex
+	score        float64
+	calibratedAt time.Time
+}
+
+// Class returns the current hardware class of the host
+func (p *Probe) Class() Class {
+	p.once.Do(func() { p.cpuModel = cpuModel() })
+	p.mu.RLock()
+	score := p.score
+	p.mu.RUnlock()
+	return Class{
+		Worker:   p.Worker,
+		Arch:     runtime.GOARCH,
+		CPUModel: p.cpuModel,
+		CPUs:     runtime.NumCPU(),
+		CPUQuota: cpuQuota(),
+		Load1:    load1(),
+		Score:    score,
+	}
+}
+
+// Calibrate runs the calibration benchmark for about d and records the
+// score of the host in the classes it reports
+func (p *Probe) Calibrate(d time.Duration) float64 {
+	score := Benchmark(d)
+	p.mu.Lock()
+	p.score = score
+	p.calibratedAt = time.Now()
+	p.mu.Unlock()
+	return score
+}
+
+// CalibratedAt returns when the host was last calibrated, or the zero time
+func (p *Probe) CalibratedAt() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.calibratedAt
+}
+
+// ReferenceRate is the rate in rounds per second at which the reference
+// hardware, one core of a recent x86-64 server, runs the benchmark
+const ReferenceRate = 40000
+
+// DefaultCalibration is how long the calibration benchmark runs by default
+const DefaultCalibration = 2 * time.Second
+
+// benchmarkSize is the working set of a benchmark round, which fits in the
+// L2 cache of common CPUs so that the score reflects the core
+const benchmarkSize = 64 << 10
+
+// Benchmark runs a single-threaded micro-benchmark of integer arithmetic and
+// memory access, the mix of interpreted code, for about d and returns the
+// speed of the host relative to ReferenceRate
+func Benchmark(d time.Duration) float64 {
+	if d <= 0 {
+		d = DefaultCalibration
+	}
+	buf := make([]uint64, benchmarkSize/8)
+	x := uint64(88172645463325252)
+	rounds := 0
+	start := time.Now()
+	for time.Since(start) < d {
+		for i := range buf {
+			x ^= x << 13
+			x ^= x >> 7
+			x ^= x << 17
+			j := x % uint64(len(buf))
+			buf[i], buf[j] = buf[j]+x, buf[i]^x
+		}
+		rounds++
+	}
+	sink = buf[0]
+	rate := float64(rounds) / time.Since(start).Seconds()
+	return rate / ReferenceRate
+}
+
+// sink keeps the benchmark from being optimized away
+var sink uint64
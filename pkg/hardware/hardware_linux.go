@@ -0,0 +1,66 @@
+package hardware
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cpuModel reads the model of the first CPU from /proc/cpuinfo, which names
+// it "model name" on x86 and "Model" or "CPU part" on ARM
+func cpuModel() string {
+	data, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	var part string
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "model name", "Model":
+			return value
+		case "CPU part":
+			if part == "" {
+				part = "CPU part " + value
+			}
+		}
+	}
+	return part
+}
+
+// cpuQuota reads the CPUs allowed by the cgroup v2 cpu.max of the process,
+// "max 100000" when unlimited or "200000 100000" for two CPUs
+func cpuQuota() float64 {
+	data, err := os.ReadFile("/sys/fs/cgroup/cpu.max")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+	quota, err1 := strconv.ParseFloat(fields[0], 64)
+	period, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil || period <= 0 {
+		return 0
+	}
+	return quota / period
+}
+
+// load1 reads the one-minute load average from /proc/loadavg
+func load1() float64 {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	load, _ := strconv.ParseFloat(fields[0], 64)
+	return load
+}
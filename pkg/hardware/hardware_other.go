@@ -0,0 +1,12 @@
+//go:build !linux
+
+package hardware
+
+// cpuModel, cpuQuota, and load1 are only implemented on Linux; other
+// platforms report the architecture and CPU count alone
+
+func cpuModel() string { return "" }
+
+func cpuQuota() float64 { return 0 }
+
+func load1() float64 { return 0 }
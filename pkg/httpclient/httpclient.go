@@ -0,0 +1,172 @@
+// Package httpclient builds the transport of the outbound HTTP requests of
+// ForgeAI itself from the http section of the configuration: a proxy,
+// certificate authorities trusted in addition to the system ones, and
+// pinned certificates. Enterprise networks often reach the internet only
+// through a TLS-intercepting proxy whose CA the system does not trust.
+package httpclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/offline"
+)
+
+// pinPrefix prefixes the pins of public keys
+const pinPrefix = "sha256/"
+
+// defaultTransport is the transport of the http package before Configure
+// replaces it
+var defaultTransport = http.DefaultTransport
+
+// Configure installs the transport of cfg as http.DefaultTransport, behind
+// the guard of offline mode. The plugin registry client, webhook senders,
+// notification channels, and storage backends send their requests with it.
+// An empty configuration leaves the default transport alone.
+func Configure(cfg config.HTTPConfig) error {
+	if reflect.DeepEqual(cfg, config.HTTPConfig{}) {
+		return nil
+	}
+	t, err := Transport(cfg)
+	if err != nil {
+		return err
+	}
+	http.DefaultTransport = &offline.Transport{Base: t}
+	return nil
+}
+
+// Transport returns a transport for cfg. Without a proxy in cfg it honors
+// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY, to which cfg may add hosts.
+func Transport(cfg config.HTTPConfig) (*http.Transport, error) {
+	t := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if base, ok := defaultTransport.(*http.Transport); ok {
+		t = base.Clone()
+	}
+
+	proxy, err := proxyConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if proxy != nil {
+		proxyURL := proxy.ProxyFunc()
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyURL(req.URL)
+		}
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if t.TLSClientConfig != nil {
+		tlsConfig = t.TLSClientConfig.Clone()
+	}
+	if cfg.CABundle != "" {
+		pool, err := caPool(cfg.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(cfg.PinnedCerts) > 0 {
+		verify, err := verifyPins(cfg.PinnedCerts)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.VerifyConnection = verify
+	}
+	t.TLSClientConfig = tlsConfig
+	return t, nil
+}
+
+// proxyConfig returns the proxy configuration of cfg, or nil to use the
+// environment unchanged
+func proxyConfig(cfg config.HTTPConfig) (*httpproxy.Config, error) {
+	noProxy := strings.Join(cfg.NoProxy, ",")
+	if cfg.Proxy == "" {
+		if noProxy == "" {
+			return nil, nil
+		}
+		env := httpproxy.FromEnvironment()
+		if env.NoProxy != "" {
+			noProxy = env.NoProxy + "," + noProxy
+		}
+		env.NoProxy = noProxy
+		return env, nil
+	}
+
+	u, err := url.Parse(cfg.Proxy)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: use a URL such as http://proxy:3128", cfg.Proxy)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q: use http, https, or socks5", u.Scheme)
+	}
+	return &httpproxy.Config{HTTPProxy: cfg.Proxy, HTTPSProxy: cfg.Proxy, NoProxy: noProxy}, nil
+}
+
+// caPool returns the system certificate authorities and those of a PEM
+// bundle
+func caPool(bundle string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in CA bundle %s", bundle)
+	}
+	return pool, nil
+}
+
+// verifyPins returns a check that the verified certificate chain of each
+// pinned host contains one of its pinned public keys
+func verifyPins(pinned map[string][]string) (func(tls.ConnectionState) error, error) {
+	pins := make(map[string]map[string]bool, len(pinned))
+	for host, hostPins := range pinned {
+		host = strings.ToLower(host)
+		pins[host] = make(map[string]bool, len(hostPins))
+		for _, pin := range hostPins {
+			hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, pinPrefix))
+			if !strings.HasPrefix(pin, pinPrefix) || err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid pin %q for %s: use sha256/<base64 of the SHA-256 of the public key>", pin, host)
+			}
+			pins[host][pin] = true
+		}
+	}
+
+	return func(cs tls.ConnectionState) error {
+		want, ok := pins[strings.ToLower(cs.ServerName)]
+		if !ok {
+			return nil
+		}
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				if want[Pin(cert)] {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("certificate of %s matches none of its pinned public keys", cs.ServerName)
+	}, nil
+}
+
+// Pin returns the pin of the public key of a certificate, as
+// sha256/<base64>
+func Pin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
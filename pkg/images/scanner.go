@@ -0,0 +1,228 @@
+// Package images scans language container images for known vulnerabilities
+// and enforces a policy before the images are allowed to run code.
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"forgeai/pkg/offline"
+)
+
+// Severity levels reported by scanners, normalized to upper case
+const (
+	SeverityCritical = "CRITICAL"
+	SeverityHigh     = "HIGH"
+	SeverityMedium   = "MEDIUM"
+	SeverityLow      = "LOW"
+	SeverityUnknown  = "UNKNOWN"
+)
+
+// Vulnerability is a single finding reported for an image
+type Vulnerability struct {
+	ID               string `json:"id"`
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installed_version"`
+	FixedVersion     string `json:"fixed_version,omitempty"`
+	Severity         string `json:"severity"`
+	Title            string `json:"title,omitempty"`
+}
+
+// ScanReport is the result of scanning an image
+type ScanReport struct {
+	Image           string          `json:"image"`
+	Scanner         string          `json:"scanner"`
+	ScannedAt       time.Time       `json:"scanned_at"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+	Counts          map[string]int  `json:"counts"`
+}
+
+// Scanner is implemented by vulnerability scanners
+type Scanner interface {
+	// Name returns the scanner name
+	Name() string
+
+	// Scan scans the image and returns its vulnerabilities
+	Scan(ctx context.Context, image string) (*ScanReport, error)
+}
+
+// NewScanner returns the scanner with the given name
+func NewScanner(name string) (Scanner, error) {
+	switch name {
+	case "", "trivy":
+		return &TrivyScanner{Binary: "trivy"}, nil
+	case "grype":
+		return &GrypeScanner{Binary: "grype"}, nil
+	default:
+		return nil, fmt.Errorf("unknown image scanner: %s", name)
+	}
+}
+
+// TrivyScanner scans images with Aqua Trivy
+type TrivyScanner struct {
+	Binary string
+}
+
+// Name returns the scanner name
+func (t *TrivyScanner) Name() string {
+	return "trivy"
+}
+
+// Scan runs trivy against the image
+func (t *TrivyScanner) Scan(ctx context.Context, image string) (*ScanReport, error) {
+	output, err := runScanner(ctx, t.Binary, "image", "--quiet", "--format", "json", image)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID  string `json:"VulnerabilityID"`
+				PkgName          string `json:"PkgName"`
+				InstalledVersion string `json:"InstalledVersion"`
+				FixedVersion     string `json:"FixedVersion"`
+				Severity         string `json:"Severity"`
+				Title            string `json:"Title"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse trivy output: %w", err)
+	}
+
+	report := newReport(image, t.Name())
+	for _, result := range parsed.Results {
+		for _, v := range result.Vulnerabilities {
+			report.add(Vulnerability{
+				ID:               v.VulnerabilityID,
+				Package:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Severity:         v.Severity,
+				Title:            v.Title,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// GrypeScanner scans images with Anchore Grype
+type GrypeScanner struct {
+	Binary string
+}
+
+// Name returns the scanner name
+func (g *GrypeScanner) Name() string {
+	return "grype"
+}
+
+// Scan runs grype against the image
+func (g *GrypeScanner) Scan(ctx context.Context, image string) (*ScanReport, error) {
+	output, err := runScanner(ctx, g.Binary, image, "-o", "json", "-q")
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID          string `json:"id"`
+				Severity    string `json:"severity"`
+				Description string `json:"description"`
+				Fix         struct {
+					Versions []string `json:"versions"`
+				} `json:"fix"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse grype output: %w", err)
+	}
+
+	report := newReport(image, g.Name())
+	for _, m := range parsed.Matches {
+		report.add(Vulnerability{
+			ID:               m.Vulnerability.ID,
+			Package:          m.Artifact.Name,
+			InstalledVersion: m.Artifact.Version,
+			FixedVersion:     strings.Join(m.Vulnerability.Fix.Versions, ", "),
+			Severity:         m.Vulnerability.Severity,
+			Title:            m.Vulnerability.Description,
+		})
+	}
+
+	return report, nil
+}
+
+// offlineScannerEnv keeps trivy and grype from updating their vulnerability
+// databases, checking for new versions, and pulling images
+var offlineScannerEnv = []string{
+	"TRIVY_SKIP_DB_UPDATE=true",
+	"TRIVY_SKIP_JAVA_DB_UPDATE=true",
+	"TRIVY_OFFLINE_SCAN=true",
+	"TRIVY_IMAGE_SRC=docker",
+	"GRYPE_DB_AUTO_UPDATE=false",
+	"GRYPE_CHECK_FOR_APP_UPDATE=false",
+	"GRYPE_DEFAULT_IMAGE_PULL_SOURCE=docker",
+}
+
+// runScanner runs a scanner binary and returns its stdout
+func runScanner(ctx context.Context, binary string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(binary); err != nil {
+		return nil, fmt.Errorf("scanner %s is not installed", binary)
+	}
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	if offline.Enabled() {
+		// Scan with the vulnerability database on disk and the local image
+		cmd.Env = append(os.Environ(), offlineScannerEnv...)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("%s failed: %s", binary, strings.TrimSpace(string(exitError.Stderr)))
+		}
+		return nil, fmt.Errorf("failed to run %s: %w", binary, err)
+	}
+
+	return output, nil
+}
+
+func newReport(image, scanner string) *ScanReport {
+	return &ScanReport{
+		Image:           image,
+		Scanner:         scanner,
+		ScannedAt:       time.Now().UTC(),
+		Vulnerabilities: []Vulnerability{},
+		Counts:          make(map[string]int),
+	}
+}
+
+// add appends a vulnerability and updates the severity counts
+func (r *ScanReport) add(v Vulnerability) {
+	v.Severity = normalizeSeverity(v.Severity)
+	r.Vulnerabilities = append(r.Vulnerabilities, v)
+	r.Counts[v.Severity]++
+}
+
+func normalizeSeverity(severity string) string {
+	switch s := strings.ToUpper(strings.TrimSpace(severity)); s {
+	case SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow:
+		return s
+	case "NEGLIGIBLE":
+		return SeverityLow
+	default:
+		return SeverityUnknown
+	}
+}
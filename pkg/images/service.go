@@ -0,0 +1,156 @@
+package images
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy decides whether a scanned image may be used
+type Policy struct {
+	// BlockSeverities lists severities that block an image when present
+	BlockSeverities []string
+}
+
+// DefaultPolicy blocks images with critical vulnerabilities
+func DefaultPolicy() Policy {
+	return Policy{
+		BlockSeverities: []string{SeverityCritical},
+	}
+}
+
+// Decision is the outcome of evaluating a report against a policy
+type Decision struct {
+	Allowed    bool     `json:"allowed"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+// Evaluate checks a scan report against the policy
+func (p Policy) Evaluate(report *ScanReport) Decision {
+	decision := Decision{Allowed: true}
+
+	for _, severity := range p.BlockSeverities {
+		severity = normalizeSeverity(severity)
+		if count := report.Counts[severity]; count > 0 {
+			decision.Allowed = false
+			decision.Violations = append(decision.Violations,
+				fmt.Sprintf("%d %s vulnerabilities", count, strings.ToLower(severity)))
+		}
+	}
+
+	return decision
+}
+
+// Service scans images, caches the reports, and enforces the policy
+type Service struct {
+	Scanner Scanner
+	Policy  Policy
+
+	// CacheDir persists reports across restarts; empty keeps them in memory
+	CacheDir string
+
+	// CacheTTL controls how long a report is reused before rescanning
+	CacheTTL time.Duration
+
+	cache map[string]*ScanReport
+	mu    sync.RWMutex
+}
+
+// NewService creates a new image scanning service
+func NewService(scanner Scanner, policy Policy, cacheDir string) *Service {
+	return &Service{
+		Scanner:  scanner,
+		Policy:   policy,
+		CacheDir: cacheDir,
+		CacheTTL: 24 * time.Hour,
+		cache:    make(map[string]*ScanReport),
+	}
+}
+
+// Scan returns a scan report for the image, using the cache when fresh
+func (s *Service) Scan(ctx context.Context, image string, refresh bool) (*ScanReport, error) {
+	if !refresh {
+		if report, ok := s.Cached(image); ok {
+			return report, nil
+		}
+	}
+
+	report, err := s.Scanner.Scan(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+
+	s.store(report)
+	return report, nil
+}
+
+// Cached returns a fresh cached report for the image
+func (s *Service) Cached(image string) (*ScanReport, bool) {
+	s.mu.RLock()
+	report, ok := s.cache[image]
+	s.mu.RUnlock()
+
+	if !ok && s.CacheDir != "" {
+		data, err := os.ReadFile(s.cachePath(image))
+		if err == nil {
+			var loaded ScanReport
+			if json.Unmarshal(data, &loaded) == nil {
+				report, ok = &loaded, true
+				s.mu.Lock()
+				s.cache[image] = report
+				s.mu.Unlock()
+			}
+		}
+	}
+
+	if !ok || (s.CacheTTL > 0 && time.Since(report.ScannedAt) > s.CacheTTL) {
+		return nil, false
+	}
+	return report, true
+}
+
+// Verify scans the image if needed and returns an error if the policy
+// blocks it. It satisfies the container.ImageVerifier interface.
+func (s *Service) Verify(ctx context.Context, image string) error {
+	report, err := s.Scan(ctx, image, false)
+	if err != nil {
+		return fmt.Errorf("failed to scan image %s: %w", image, err)
+	}
+
+	decision := s.Policy.Evaluate(report)
+	if !decision.Allowed {
+		return fmt.Errorf("image %s blocked by vulnerability policy: %s", image, strings.Join(decision.Violations, ", "))
+	}
+
+	return nil
+}
+
+// store saves a report in memory and, if configured, on disk
+func (s *Service) store(report *ScanReport) {
+	s.mu.Lock()
+	s.cache[report.Image] = report
+	s.mu.Unlock()
+
+	if s.CacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(s.CacheDir, 0755); err != nil {
+		return
+	}
+	if data, err := json.MarshalIndent(report, "", "  "); err == nil {
+		os.WriteFile(s.cachePath(report.Image), data, 0644)
+	}
+}
+
+// cachePath returns the on-disk location of an image's report
+func (s *Service) cachePath(image string) string {
+	sum := sha256.Sum256([]byte(image))
+	return filepath.Join(s.CacheDir, hex.EncodeToString(sum[:8])+".json")
+}
@@ -0,0 +1,129 @@
+package inspect
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// goRules are keyed by import path, and import path and function for
+// packages with unrelated functions
+var goRules = rules{
+	"os/exec":          Process,
+	"os.StartProcess":  Process,
+	"syscall.Exec":     Process,
+	"syscall.ForkExec": Process,
+
+	"net":        Network,
+	"net/http":   Network,
+	"net/rpc":    Network,
+	"net/smtp":   Network,
+	"crypto/tls": Network,
+
+	"os.Open":               Filesystem,
+	"os.OpenFile":           Filesystem,
+	"os.Create":             Filesystem,
+	"os.ReadFile":           Filesystem,
+	"os.WriteFile":          Filesystem,
+	"os.ReadDir":            Filesystem,
+	"os.Remove":             Filesystem,
+	"os.RemoveAll":          Filesystem,
+	"os.Rename":             Filesystem,
+	"os.Mkdir":              Filesystem,
+	"os.MkdirAll":           Filesystem,
+	"os.MkdirTemp":          Filesystem,
+	"os.CreateTemp":         Filesystem,
+	"os.Chmod":              Filesystem,
+	"os.Chown":              Filesystem,
+	"os.Symlink":            Filesystem,
+	"os.DirFS":              Filesystem,
+	"io/ioutil":             Filesystem,
+	"path/filepath.Walk":    Filesystem,
+	"path/filepath.WalkDir": Filesystem,
+	"path/filepath.Glob":    Filesystem,
+
+	"os.Getenv":    Environment,
+	"os.LookupEnv": Environment,
+	"os.Setenv":    Environment,
+	"os.Unsetenv":  Environment,
+	"os.Environ":   Environment,
+
+	"syscall":               NativeCode,
+	"unsafe":                NativeCode,
+	"plugin":                NativeCode,
+	"C":                     NativeCode,
+	"golang.org/x/sys/unix": NativeCode,
+}
+
+// inspectGo parses Go code and resolves package selectors through its
+// imports
+func inspectGo(code string) (Report, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", code, parser.SkipObjectResolution)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to parse code: %w", err)
+	}
+
+	report := Report{Parser: "go/parser"}
+	names := make(map[string]string)
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		line := fset.Position(spec.Pos()).Line
+		report.Imports = append(report.Imports, Import{Module: importPath, Line: line})
+
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		if name != "_" && name != "." {
+			names[name] = importPath
+		}
+		if capability, ok := goPackage(importPath); ok {
+			report.Operations = append(report.Operations, Operation{Capability: capability, Name: importPath, Line: line})
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		importPath, ok := names[pkg.Name]
+		if !ok {
+			return true
+		}
+		name := importPath + "." + sel.Sel.Name
+		capability, ok := goRules[name]
+		if !ok {
+			capability, ok = goPackage(importPath)
+		}
+		if ok {
+			report.Operations = append(report.Operations, Operation{Capability: capability, Name: name, Line: fset.Position(sel.Pos()).Line})
+		}
+		return true
+	})
+	return report, nil
+}
+
+// goPackage returns the capability of a package or the nearest package
+// above it, such as net/http for net/http/pprof
+func goPackage(importPath string) (string, bool) {
+	for {
+		if capability, ok := goRules[importPath]; ok {
+			return capability, true
+		}
+		i := strings.LastIndexByte(importPath, '/')
+		if i < 0 {
+			return "", false
+		}
+		importPath = importPath[:i]
+	}
+}
@@ -0,0 +1,125 @@
+// Package inspect parses submitted code and reports the modules it imports,
+// the process, network, file, and environment operations it references,
+// and the capabilities it is therefore likely to need. Go code is parsed
+// with go/parser; Python and JavaScript are tokenized, so the report is an
+// estimate that dynamic code can evade.
+package inspect
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Capabilities code can need
+const (
+	Process     = "process"
+	Network     = "network"
+	Filesystem  = "filesystem"
+	Environment = "environment"
+	NativeCode  = "native_code"
+	DynamicCode = "dynamic_code"
+)
+
+// ErrUnsupported is returned for languages that cannot be inspected
+var ErrUnsupported = errors.New("language cannot be inspected")
+
+// Import is a module the code imports
+type Import struct {
+	Module string `json:"module"`
+	Line   int    `json:"line"`
+}
+
+// Operation is a reference to an API that needs a capability
+type Operation struct {
+	Capability string `json:"capability"`
+	Name       string `json:"name"`
+	Line       int    `json:"line"`
+}
+
+// Report describes what code references
+type Report struct {
+	Language   string      `json:"language"`
+	Parser     string      `json:"parser"`
+	Imports    []Import    `json:"imports"`
+	Operations []Operation `json:"operations"`
+
+	// Capabilities are the sorted capabilities of the imported modules and
+	// referenced operations
+	Capabilities []string `json:"capabilities"`
+}
+
+// Has reports whether the code is likely to need a capability
+func (r Report) Has(capability string) bool {
+	for _, c := range r.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Languages are the languages that can be inspected
+func Languages() []string {
+	return []string{"go", "javascript", "python"}
+}
+
+// Inspect parses code and reports what it references
+func Inspect(language, code string) (Report, error) {
+	var report Report
+	var err error
+	switch language {
+	case "go":
+		report, err = inspectGo(code)
+	case "python":
+		report = inspectPython(code)
+	case "javascript":
+		report = inspectJavaScript(code)
+	default:
+		return Report{}, ErrUnsupported
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	report.Language = language
+	report.finish()
+	return report, nil
+}
+
+// finish derives the capabilities and replaces nil lists with empty ones
+func (r *Report) finish() {
+	if r.Imports == nil {
+		r.Imports = []Import{}
+	}
+	if r.Operations == nil {
+		r.Operations = []Operation{}
+	}
+	seen := make(map[string]bool)
+	for _, op := range r.Operations {
+		seen[op.Capability] = true
+	}
+	r.Capabilities = make([]string, 0, len(seen))
+	for capability := range seen {
+		r.Capabilities = append(r.Capabilities, capability)
+	}
+	sort.Strings(r.Capabilities)
+}
+
+// rules maps module and function names to the capabilities they need. A
+// rule matches its name and every name below it, such as subprocess.run
+// for subprocess.
+type rules map[string]string
+
+// match returns the capability of the longest rule matching a dotted name
+func (r rules) match(name string) (string, bool) {
+	for {
+		if capability, ok := r[name]; ok {
+			return capability, true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return "", false
+		}
+		name = name[:i]
+	}
+}
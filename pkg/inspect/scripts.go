@@ -0,0 +1,672 @@
+package inspect
+
+import "strings"
+
+// Token kinds of script languages
+const (
+	tokIdent = iota
+	tokString
+	tokNumber
+	tokPunct
+
+	// tokEnd ends a Python statement
+	tokEnd
+)
+
+// lexeme is a token of a script language. Strings hold their contents
+// without quotes or escape processing.
+type lexeme struct {
+	kind int
+	text string
+	line int
+}
+
+// is reports whether a token is the punctuation or identifier text
+func (t lexeme) is(kind int, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+var pythonModules = rules{
+	"subprocess":                      Process,
+	"multiprocessing":                 Process,
+	"pty":                             Process,
+	"os.system":                       Process,
+	"os.popen":                        Process,
+	"os.fork":                         Process,
+	"os.forkpty":                      Process,
+	"os.execl":                        Process,
+	"os.execle":                       Process,
+	"os.execlp":                       Process,
+	"os.execv":                        Process,
+	"os.execve":                       Process,
+	"os.execvp":                       Process,
+	"os.spawnl":                       Process,
+	"os.spawnv":                       Process,
+	"os.spawnlp":                      Process,
+	"os.spawnvp":                      Process,
+	"os.posix_spawn":                  Process,
+	"os.kill":                         Process,
+	"asyncio.create_subprocess_exec":  Process,
+	"asyncio.create_subprocess_shell": Process,
+
+	"socket":                  Network,
+	"ssl":                     Network,
+	"urllib.request":          Network,
+	"urllib3":                 Network,
+	"requests":                Network,
+	"http.client":             Network,
+	"http.server":             Network,
+	"httpx":                   Network,
+	"aiohttp":                 Network,
+	"ftplib":                  Network,
+	"smtplib":                 Network,
+	"telnetlib":               Network,
+	"xmlrpc.client":           Network,
+	"websocket":               Network,
+	"websockets":              Network,
+	"paramiko":                Network,
+	"asyncio.open_connection": Network,
+	"asyncio.start_server":    Network,
+
+	"io.open":       Filesystem,
+	"os.open":       Filesystem,
+	"os.remove":     Filesystem,
+	"os.unlink":     Filesystem,
+	"os.rename":     Filesystem,
+	"os.replace":    Filesystem,
+	"os.mkdir":      Filesystem,
+	"os.makedirs":   Filesystem,
+	"os.rmdir":      Filesystem,
+	"os.removedirs": Filesystem,
+	"os.listdir":    Filesystem,
+	"os.scandir":    Filesystem,
+	"os.walk":       Filesystem,
+	"os.chmod":      Filesystem,
+	"os.chown":      Filesystem,
+	"os.symlink":    Filesystem,
+	"shutil":        Filesystem,
+	"pathlib":       Filesystem,
+	"tempfile":      Filesystem,
+	"glob":          Filesystem,
+
+	"os.environ":  Environment,
+	"os.getenv":   Environment,
+	"os.putenv":   Environment,
+	"os.unsetenv": Environment,
+
+	"ctypes": NativeCode,
+	"cffi":   NativeCode,
+
+	"importlib": DynamicCode,
+}
+
+var pythonGlobals = rules{
+	"open":       Filesystem,
+	"eval":       DynamicCode,
+	"exec":       DynamicCode,
+	"compile":    DynamicCode,
+	"__import__": DynamicCode,
+}
+
+var javascriptModules = rules{
+	"child_process": Process,
+	"cluster":       Process,
+
+	"net":        Network,
+	"http":       Network,
+	"https":      Network,
+	"http2":      Network,
+	"dgram":      Network,
+	"tls":        Network,
+	"dns":        Network,
+	"axios":      Network,
+	"node-fetch": Network,
+	"undici":     Network,
+	"ws":         Network,
+
+	"fs":          Filesystem,
+	"fs/promises": Filesystem,
+
+	"ffi-napi": NativeCode,
+
+	"vm": DynamicCode,
+}
+
+var javascriptGlobals = rules{
+	"fetch":          Network,
+	"XMLHttpRequest": Network,
+	"WebSocket":      Network,
+
+	"process.env": Environment,
+
+	"process.binding": NativeCode,
+	"process.dlopen":  NativeCode,
+
+	"eval":     DynamicCode,
+	"Function": DynamicCode,
+}
+
+// script collects the report of a script language
+type script struct {
+	report  Report
+	modules rules
+	globals rules
+
+	// aliases maps names bound by imports to the dotted names they stand
+	// for
+	aliases map[string]string
+	seen    map[Operation]bool
+}
+
+func newScript(modules, globals rules) *script {
+	return &script{
+		report:  Report{Parser: "tokenizer"},
+		modules: modules,
+		globals: globals,
+		aliases: make(map[string]string),
+		seen:    make(map[Operation]bool),
+	}
+}
+
+// addImport records an imported module
+func (s *script) addImport(module string, line int) {
+	s.report.Imports = append(s.report.Imports, Import{Module: module, Line: line})
+	if capability, ok := s.modules.match(module); ok {
+		s.addOperation(Operation{Capability: capability, Name: module, Line: line})
+	}
+}
+
+func (s *script) addOperation(op Operation) {
+	if !s.seen[op] {
+		s.seen[op] = true
+		s.report.Operations = append(s.report.Operations, op)
+	}
+}
+
+// reference records the dotted name starting at toks[i], if it needs a
+// capability, and returns the index after it. Names bound by imports are
+// resolved to the modules they come from; builtins without a dot count only
+// when called.
+func (s *script) reference(toks []lexeme, i int) int {
+	if toks[i].kind != tokIdent || (i > 0 && toks[i-1].is(tokPunct, ".")) {
+		return i + 1
+	}
+	name, j := dotted(toks, i)
+	called := j < len(toks) && toks[j].is(tokPunct, "(")
+
+	first := name
+	if dot := strings.IndexByte(name, '.'); dot >= 0 {
+		first = name[:dot]
+	}
+	if target, ok := s.aliases[first]; ok {
+		full := target + name[len(first):]
+		if capability, ok := s.modules.match(full); ok {
+			s.addOperation(Operation{Capability: capability, Name: full, Line: toks[i].line})
+		}
+		return j
+	}
+	if capability, ok := s.globals.match(name); ok && (called || strings.Contains(name, ".")) {
+		s.addOperation(Operation{Capability: capability, Name: name, Line: toks[i].line})
+	}
+	return j
+}
+
+// dotted returns the dotted name starting at toks[i] and the index after it
+func dotted(toks []lexeme, i int) (string, int) {
+	if i >= len(toks) || toks[i].kind != tokIdent {
+		return "", i
+	}
+	name := toks[i].text
+	i++
+	for i+1 < len(toks) && toks[i].is(tokPunct, ".") && toks[i+1].kind == tokIdent {
+		name += "." + toks[i+1].text
+		i += 2
+	}
+	return name, i
+}
+
+// inspectPython tokenizes Python code and follows its import statements
+func inspectPython(code string) Report {
+	s := newScript(pythonModules, pythonGlobals)
+	toks := lexPython(code)
+	for i := 0; i < len(toks); {
+		t := toks[i]
+		start := i == 0 || toks[i-1].kind == tokEnd || toks[i-1].is(tokPunct, ":")
+		if start && (t.is(tokIdent, "import") || t.is(tokIdent, "from")) {
+			i = s.pythonImport(toks, i)
+			continue
+		}
+		if i > 0 && (toks[i-1].is(tokIdent, "def") || toks[i-1].is(tokIdent, "class")) {
+			i++
+			continue
+		}
+		i = s.reference(toks, i)
+	}
+	return s.report
+}
+
+// pythonImport follows an import or from statement at toks[i] and returns
+// the index of its end
+func (s *script) pythonImport(toks []lexeme, i int) int {
+	line := toks[i].line
+	if toks[i].text == "import" {
+		// import a.b, c as d
+		j := i + 1
+		for {
+			name, next := dotted(toks, j)
+			if name == "" {
+				break
+			}
+			j = next
+			s.addImport(name, line)
+			if j+1 < len(toks) && toks[j].is(tokIdent, "as") && toks[j+1].kind == tokIdent {
+				s.aliases[toks[j+1].text] = name
+				j += 2
+			} else {
+				first := strings.SplitN(name, ".", 2)[0]
+				s.aliases[first] = first
+			}
+			if j >= len(toks) || !toks[j].is(tokPunct, ",") {
+				break
+			}
+			j++
+		}
+		return skipStatement(toks, j)
+	}
+
+	// from .a.b import c as d, e
+	j := i + 1
+	module := ""
+	for j < len(toks) && toks[j].is(tokPunct, ".") {
+		module += "."
+		j++
+	}
+	name, j := dotted(toks, j)
+	module += name
+	if j >= len(toks) || !toks[j].is(tokIdent, "import") {
+		return skipStatement(toks, j)
+	}
+	s.addImport(module, line)
+	for j++; j < len(toks) && toks[j].kind != tokEnd; j++ {
+		if toks[j].kind != tokIdent || strings.HasPrefix(module, ".") {
+			continue
+		}
+		bound := toks[j].text
+		if j+2 < len(toks) && toks[j+1].is(tokIdent, "as") && toks[j+2].kind == tokIdent {
+			s.aliases[toks[j+2].text] = module + "." + bound
+			j += 2
+			continue
+		}
+		s.aliases[bound] = module + "." + bound
+	}
+	return j
+}
+
+// skipStatement returns the index of the end of the statement at toks[i]
+func skipStatement(toks []lexeme, i int) int {
+	for i < len(toks) && toks[i].kind != tokEnd {
+		i++
+	}
+	return i
+}
+
+// inspectJavaScript tokenizes JavaScript code and follows its require
+// calls and import statements
+func inspectJavaScript(code string) Report {
+	s := newScript(javascriptModules, javascriptGlobals)
+	toks := lexJavaScript(code)
+	for i := 0; i < len(toks); {
+		t := toks[i]
+		member := i > 0 && toks[i-1].is(tokPunct, ".")
+		switch {
+		case member:
+		case t.is(tokIdent, "require") && i+3 < len(toks) && toks[i+1].is(tokPunct, "(") && toks[i+2].kind == tokString && toks[i+3].is(tokPunct, ")"):
+			module := strings.TrimPrefix(toks[i+2].text, "node:")
+			s.addImport(module, t.line)
+			s.bindRequire(toks, i, module)
+			i += 4
+			continue
+		case t.is(tokIdent, "import"):
+			i = s.javascriptImport(toks, i)
+			continue
+		case t.is(tokIdent, "from") && i+1 < len(toks) && toks[i+1].kind == tokString:
+			// export ... from 'module'
+			s.addImport(strings.TrimPrefix(toks[i+1].text, "node:"), t.line)
+			i += 2
+			continue
+		case i > 0 && toks[i-1].is(tokIdent, "function"):
+			i++
+			continue
+		}
+		i = s.reference(toks, i)
+	}
+	return s.report
+}
+
+// bindRequire binds the names a require call at toks[i] is assigned to, as
+// in const cp = require('x') or const { a, b: c } = require('x')
+func (s *script) bindRequire(toks []lexeme, i int, module string) {
+	if i < 2 || !toks[i-1].is(tokPunct, "=") {
+		return
+	}
+	if toks[i-2].kind == tokIdent {
+		s.aliases[toks[i-2].text] = module
+		return
+	}
+	if !toks[i-2].is(tokPunct, "}") {
+		return
+	}
+	open := i - 2
+	for open > 0 && !toks[open].is(tokPunct, "{") {
+		open--
+	}
+	s.bindNamed(toks[open+1:i-2], module, ":")
+}
+
+// bindNamed binds destructured or named imports, such as a, b: c or
+// a, b as c, to the members of module
+func (s *script) bindNamed(toks []lexeme, module, rename string) {
+	for j := 0; j < len(toks); j++ {
+		if toks[j].kind != tokIdent {
+			continue
+		}
+		member := toks[j].text
+		if j+2 < len(toks) && toks[j+1].text == rename && toks[j+2].kind == tokIdent {
+			s.aliases[toks[j+2].text] = module + "." + member
+			j += 2
+			continue
+		}
+		s.aliases[member] = module + "." + member
+	}
+}
+
+// javascriptImport follows an import statement or dynamic import at
+// toks[i] and returns the index after it
+func (s *script) javascriptImport(toks []lexeme, i int) int {
+	line := toks[i].line
+	j := i + 1
+
+	// import('x') and import 'x'
+	if j+1 < len(toks) && toks[j].is(tokPunct, "(") && toks[j+1].kind == tokString {
+		s.addImport(strings.TrimPrefix(toks[j+1].text, "node:"), line)
+		return j + 2
+	}
+	if j < len(toks) && toks[j].kind == tokString {
+		s.addImport(strings.TrimPrefix(toks[j].text, "node:"), line)
+		return j + 1
+	}
+
+	// import a, * as b, { c as d } from 'x'
+	from := j
+	for from < len(toks) && !(toks[from].is(tokIdent, "from") && from+1 < len(toks) && toks[from+1].kind == tokString) {
+		if toks[from].is(tokPunct, ";") {
+			return from
+		}
+		from++
+	}
+	if from >= len(toks) {
+		return j
+	}
+	module := strings.TrimPrefix(toks[from+1].text, "node:")
+	s.addImport(module, line)
+
+	clause := toks[j:from]
+	for k := 0; k < len(clause); k++ {
+		switch {
+		case clause[k].is(tokPunct, "{"):
+			end := k
+			for end < len(clause) && !clause[end].is(tokPunct, "}") {
+				end++
+			}
+			s.bindNamed(clause[k+1:end], module, "as")
+			k = end
+		case clause[k].is(tokPunct, "*") && k+2 < len(clause) && clause[k+1].is(tokIdent, "as"):
+			s.aliases[clause[k+2].text] = module
+			k += 2
+		case clause[k].kind == tokIdent && clause[k].text != "type":
+			s.aliases[clause[k].text] = module
+		}
+	}
+	return from + 2
+}
+
+// lexPython splits Python code into tokens, with a tokEnd at the end of
+// every logical line
+func lexPython(src string) []lexeme {
+	var toks []lexeme
+	line, depth := 1, 0
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			if depth == 0 {
+				toks = append(toks, lexeme{tokEnd, "", line})
+			}
+			line++
+			i++
+		case c == '\\' && i+1 < len(src) && src[i+1] == '\n':
+			line++
+			i += 2
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+		case c == '\'' || c == '"':
+			text, n := scanPythonString(src[i:])
+			toks = append(toks, lexeme{tokString, text, line})
+			line += strings.Count(src[i:i+n], "\n")
+			i += n
+		case isIdentStart(c):
+			j := i
+			for j < len(src) && isIdentPart(src[j]) {
+				j++
+			}
+			if j < len(src) && (src[j] == '\'' || src[j] == '"') && isStringPrefix(src[i:j]) {
+				text, n := scanPythonString(src[j:])
+				toks = append(toks, lexeme{tokString, text, line})
+				line += strings.Count(src[j:j+n], "\n")
+				i = j + n
+				continue
+			}
+			toks = append(toks, lexeme{tokIdent, src[i:j], line})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (isIdentPart(src[j]) || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, lexeme{tokNumber, src[i:j], line})
+			i = j
+		default:
+			switch c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				if depth > 0 {
+					depth--
+				}
+			case ';':
+				if depth == 0 {
+					toks = append(toks, lexeme{tokEnd, "", line})
+					i++
+					continue
+				}
+			}
+			toks = append(toks, lexeme{tokPunct, string(c), line})
+			i++
+		}
+	}
+	return append(toks, lexeme{tokEnd, "", line})
+}
+
+// scanPythonString scans the string literal at the start of s and returns
+// its contents and length
+func scanPythonString(s string) (string, int) {
+	quote := s[:1]
+	if strings.HasPrefix(s, strings.Repeat(quote, 3)) {
+		delim := s[:3]
+		for end := 3; end < len(s); end++ {
+			if s[end] == '\\' {
+				end++
+				continue
+			}
+			if strings.HasPrefix(s[end:], delim) {
+				return s[3:end], end + 3
+			}
+		}
+		return s[3:], len(s)
+	}
+	for end := 1; end < len(s); end++ {
+		switch s[end] {
+		case '\\':
+			end++
+		case '\n':
+			return s[1:end], end
+		case quote[0]:
+			return s[1:end], end + 1
+		}
+	}
+	return s[1:], len(s)
+}
+
+// isStringPrefix reports whether an identifier is a Python string prefix
+func isStringPrefix(word string) bool {
+	switch strings.ToLower(word) {
+	case "r", "u", "b", "f", "br", "rb", "fr", "rf":
+		return true
+	}
+	return false
+}
+
+// lexJavaScript splits JavaScript code into tokens. A slash starts a
+// regular expression unless it follows a value.
+func lexJavaScript(src string) []lexeme {
+	var toks []lexeme
+	line := 1
+	afterValue := func() bool {
+		if len(toks) == 0 {
+			return false
+		}
+		last := toks[len(toks)-1]
+		switch last.kind {
+		case tokIdent:
+			switch last.text {
+			case "return", "typeof", "case", "do", "else", "in", "of", "new", "delete", "void", "throw", "yield", "await":
+				return false
+			}
+			return true
+		case tokString, tokNumber:
+			return true
+		}
+		return last.text == ")" || last.text == "]" || last.text == "}"
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 4
+			}
+			line += strings.Count(src[i:i+end+4], "\n")
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			text, n := scanJavaScriptString(src[i:])
+			toks = append(toks, lexeme{tokString, text, line})
+			line += strings.Count(src[i:i+n], "\n")
+			i += n
+		case c == '/' && !afterValue():
+			n := scanRegexp(src[i:])
+			toks = append(toks, lexeme{tokString, src[i : i+n], line})
+			i += n
+		case isIdentStart(c) || c == '$':
+			j := i
+			for j < len(src) && (isIdentPart(src[j]) || src[j] == '$') {
+				j++
+			}
+			toks = append(toks, lexeme{tokIdent, src[i:j], line})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (isIdentPart(src[j]) || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, lexeme{tokNumber, src[i:j], line})
+			i = j
+		default:
+			toks = append(toks, lexeme{tokPunct, string(c), line})
+			i++
+		}
+	}
+	return toks
+}
+
+// scanJavaScriptString scans the string or template literal at the start
+// of s and returns its contents and length. Substitutions in templates are
+// skipped.
+func scanJavaScriptString(s string) (string, int) {
+	quote := s[0]
+	depth := 0
+	for end := 1; end < len(s); end++ {
+		switch {
+		case s[end] == '\\':
+			end++
+		case quote == '`' && strings.HasPrefix(s[end:], "${"):
+			depth++
+			end++
+		case depth > 0 && s[end] == '}':
+			depth--
+		case depth == 0 && s[end] == quote:
+			return s[1:end], end + 1
+		case quote != '`' && s[end] == '\n':
+			return s[1:end], end
+		}
+	}
+	return s[1:], len(s)
+}
+
+// scanRegexp returns the length of the regular expression literal at the
+// start of s
+func scanRegexp(s string) int {
+	class := false
+	for end := 1; end < len(s); end++ {
+		switch s[end] {
+		case '\\':
+			end++
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '\n':
+			return end
+		case '/':
+			if !class {
+				end++
+				for end < len(s) && isIdentPart(s[end]) {
+					end++
+				}
+				return end
+			}
+		}
+	}
+	return len(s)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,314 @@
+// Package joblog implements an append-only, hash-chained log of job records.
+// Every entry includes the hash of the previous entry, so editing, removing,
+// or reordering records breaks the chain and is detected by Verify. The
+// chain cannot show that entries were cut off its end, so the log also
+// keeps its head, the count and hash of its last entry, in an anchor file
+// beside it, which Verify checks the log against.
+package joblog
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"forgeai/pkg/hardware"
+)
+
+// GenesisHash is the previous hash of the first entry
+const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Record is the job information written to the log
+type Record struct {
+	JobID      string    `json:"job_id"`
+	Status     string    `json:"status"`
+	Language   string    `json:"language"`
+	CodeHash   string    `json:"code_hash,omitempty"`
+	ResultHash string    `json:"result_hash,omitempty"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	// DurationMS is how long the program ran in milliseconds
+	DurationMS int64 `json:"duration_ms,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Classification is the data classification of the job
+	Classification string `json:"classification,omitempty"`
+
+	// Hardware is the hardware class of the worker that ran the job
+	Hardware *hardware.Class `json:"hardware,omitempty"`
+}
+
+// Entry is a chained log entry
+type Entry struct {
+	Seq      uint64    `json:"seq"`
+	LoggedAt time.Time `json:"logged_at"`
+	Record   Record    `json:"record"`
+	PrevHash string    `json:"prev_hash"`
+	Hash     string    `json:"hash"`
+}
+
+// computeHash hashes every field of the entry except Hash itself
+func (e *Entry) computeHash() string {
+	data, _ := json.Marshal(struct {
+		Seq      uint64    `json:"seq"`
+		LoggedAt time.Time `json:"logged_at"`
+		Record   Record    `json:"record"`
+		PrevHash string    `json:"prev_hash"`
+	}{e.Seq, e.LoggedAt, e.Record, e.PrevHash})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Anchor is the head of a log: the number of entries it had and the hash
+// of the last one. Logs shorter than their anchor were truncated.
+type Anchor struct {
+	Entries  uint64 `json:"entries"`
+	LastHash string `json:"last_hash"`
+}
+
+// AnchorPath returns the path of the anchor file of the log at path
+func AnchorPath(path string) string {
+	return path + ".head"
+}
+
+// ReadAnchor reads an anchor file
+func ReadAnchor(path string) (*Anchor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var anchor Anchor
+	if err := json.Unmarshal(data, &anchor); err != nil {
+		return nil, fmt.Errorf("failed to parse job log anchor %s: %w", path, err)
+	}
+	return &anchor, nil
+}
+
+// writeAnchor replaces an anchor file, so that it is never seen half
+// written
+func writeAnchor(path string, anchor Anchor) error {
+	data, err := json.Marshal(anchor)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".head-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Log is an append-only job log backed by a JSON lines file
+type Log struct {
+	path     string
+	seq      uint64
+	lastHash string
+	mu       sync.Mutex
+}
+
+// Open opens the log at path, verifying the existing chain against its
+// anchor so new entries are never appended to a tampered or truncated log
+func Open(path string) (*Log, error) {
+	l := &Log{
+		path:     path,
+		lastHash: GenesisHash,
+	}
+
+	report, err := Verify(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if anchor, err := ReadAnchor(AnchorPath(path)); err == nil && anchor.Entries > 0 {
+			return nil, fmt.Errorf("job log %s is missing, but its anchor records %d entries", path, anchor.Entries)
+		}
+		return l, nil
+	}
+	if !report.Valid {
+		return nil, fmt.Errorf("job log %s failed verification at entry %d: %s", path, report.BrokenAt, report.Reason)
+	}
+
+	// Logs written before anchors existed get one now
+	l.seq = report.Entries
+	l.lastHash = report.LastHash
+	if err := writeAnchor(AnchorPath(path), Anchor{Entries: l.seq, LastHash: l.lastHash}); err != nil {
+		return nil, fmt.Errorf("failed to write job log anchor: %w", err)
+	}
+	return l, nil
+}
+
+// Append adds a record to the log
+func (l *Log) Append(record Record) (*Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := &Entry{
+		Seq:      l.seq + 1,
+		LoggedAt: time.Now().UTC(),
+		Record:   record,
+		PrevHash: l.lastHash,
+	}
+	entry.Hash = entry.computeHash()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode log entry: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to write job log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync job log: %w", err)
+	}
+
+	l.seq = entry.Seq
+	l.lastHash = entry.Hash
+	if err := writeAnchor(AnchorPath(l.path), Anchor{Entries: l.seq, LastHash: l.lastHash}); err != nil {
+		return entry, fmt.Errorf("failed to write job log anchor: %w", err)
+	}
+	return entry, nil
+}
+
+// ReadRecords returns the records of the log at path in order, without
+// verifying the chain
+func ReadRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse job log entry %d: %w", len(records)+1, err)
+		}
+		records = append(records, entry.Record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job log: %w", err)
+	}
+	return records, nil
+}
+
+// Head returns the sequence number and hash of the last entry
+func (l *Log) Head() (uint64, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq, l.lastHash
+}
+
+// VerifyReport is the outcome of verifying a log
+type VerifyReport struct {
+	Valid    bool   `json:"valid"`
+	Entries  uint64 `json:"entries"`
+	LastHash string `json:"last_hash"`
+	BrokenAt uint64 `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Verify checks the integrity of the whole chain, and that it reaches the
+// head in the log's anchor file when there is one
+func Verify(path string) (*VerifyReport, error) {
+	anchor, err := ReadAnchor(AnchorPath(path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return VerifyAnchor(path, anchor)
+}
+
+// VerifyAnchor checks the integrity of the whole chain, and that it
+// reaches anchor unless anchor is nil. The log may have grown past its
+// anchor, for example when the process stopped between writing an entry
+// and its anchor, or when the anchor is a copy kept elsewhere.
+func VerifyAnchor(path string, anchor *Anchor) (*VerifyReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	report := &VerifyReport{Valid: true, LastHash: GenesisHash}
+	fail := func(seq uint64, reason string) (*VerifyReport, error) {
+		report.Valid = false
+		report.BrokenAt = seq
+		report.Reason = reason
+		return report, nil
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		expected := report.Entries + 1
+
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fail(expected, "entry is not valid JSON")
+		}
+		if entry.Seq != expected {
+			return fail(expected, fmt.Sprintf("sequence number %d out of order", entry.Seq))
+		}
+		if entry.PrevHash != report.LastHash {
+			return fail(expected, "previous hash does not match")
+		}
+		if entry.computeHash() != entry.Hash {
+			return fail(expected, "entry hash does not match its contents")
+		}
+
+		if anchor != nil && entry.Seq == anchor.Entries && entry.Hash != anchor.LastHash {
+			return fail(expected, "entry hash does not match the anchor")
+		}
+
+		report.Entries = entry.Seq
+		report.LastHash = entry.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job log: %w", err)
+	}
+
+	if anchor != nil && report.Entries < anchor.Entries {
+		return fail(report.Entries+1, fmt.Sprintf("log ends at entry %d, but its anchor records %d entries", report.Entries, anchor.Entries))
+	}
+	return report, nil
+}
@@ -0,0 +1,230 @@
+package jobs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"forgeai/pkg/languages"
+	"forgeai/pkg/sandbox"
+)
+
+// BackfillLabel marks the jobs imported by Backfill, with the source of the
+// records as its value
+const BackfillLabel = "backfill"
+
+// maxBackfillErrors is how many record errors a BackfillReport lists
+const maxBackfillErrors = 20
+
+// LegacyRecord is one execution in the JSON lines log of the runner that
+// preceded ForgeAI
+type LegacyRecord struct {
+	ID       string `json:"id"`
+	Language string `json:"language"`
+	Code     string `json:"code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error"`
+
+	// Status is completed or failed by the exit code when empty
+	Status string `json:"status"`
+
+	DurationMS int64             `json:"duration_ms"`
+	CreatedAt  time.Time         `json:"created_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// BackfillOptions configure a backfill
+type BackfillOptions struct {
+	// Source is the value of BackfillLabel on the imported jobs
+	Source string
+
+	// Fingerprint returns the deduplication fingerprint of a request to run
+	// code, such as an API request; the fingerprint of a Spec with only the
+	// language and code when nil
+	Fingerprint func(language, code string) string
+
+	// KeepIDs imports records under their own IDs rather than prefixed
+	// with legacy-, for the records of History
+	KeepIDs bool
+}
+
+// BackfillReport counts the records of a backfill
+type BackfillReport struct {
+	Imported int `json:"imported"`
+
+	// Skipped records were imported before
+	Skipped int `json:"skipped"`
+
+	// Failed records could not be parsed or lack a language, code, or time;
+	// Errors describes the first of them
+	Failed int      `json:"failed"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// job converts a record to a finished job
+func (rec LegacyRecord) job(source string, keepID bool) (*Job, error) {
+	if rec.Language == "" || rec.Code == "" {
+		return nil, fmt.Errorf("language and code are required")
+	}
+	if rec.CreatedAt.IsZero() {
+		return nil, fmt.Errorf("created_at is required")
+	}
+	status := rec.Status
+	switch status {
+	case "":
+		status = "completed"
+		if rec.ExitCode != 0 {
+			status = "failed"
+		}
+	case "completed", "failed", "setup_failed", "cancelled", "interrupted":
+	default:
+		return nil, fmt.Errorf("unknown status %q", rec.Status)
+	}
+
+	job := newCodeJob(languages.Normalize(rec.Language), rec.Code, rec.CreatedAt)
+	job.ID = "legacy-" + rec.ID
+	if keepID && rec.ID != "" {
+		job.ID = rec.ID
+	} else if rec.ID == "" {
+		// Without an ID the same record imports the same job
+		job.ID = "legacy-" + Fingerprint(rec)[:16]
+	}
+	job.Status = status
+	job.Error = rec.Error
+	job.Labels = map[string]string{BackfillLabel: source}
+	for key, value := range rec.Labels {
+		job.Labels[key] = value
+	}
+	if err := ValidateLabels(job.Labels); err != nil {
+		return nil, err
+	}
+
+	duration := time.Duration(rec.DurationMS) * time.Millisecond
+	job.CompletedAt = rec.FinishedAt
+	if job.CompletedAt.IsZero() {
+		job.CompletedAt = rec.CreatedAt.Add(duration)
+	}
+	job.StartedAt = job.CompletedAt.Add(-duration)
+	if status == "completed" || status == "failed" {
+		job.Result = &sandbox.ExecutionResult{
+			Stdout:   rec.Stdout,
+			Stderr:   rec.Stderr,
+			ExitCode: rec.ExitCode,
+			Duration: duration,
+		}
+	}
+	return job, nil
+}
+
+// Backfill imports the JSON lines log of a legacy runner as finished jobs
+// labeled with BackfillLabel, so that analytics include them. The jobs are
+// appended to the job log, their code is assessed and quarantined like that
+// of new jobs, and code of jobs within DedupWindow enters the deduplication
+// cache under the fingerprint of opts. Records imported before are skipped,
+// so an interrupted backfill can be run again. It fails only when r cannot
+// be read.
+func (jm *Manager) Backfill(r io.Reader, opts BackfillOptions) (BackfillReport, error) {
+	fingerprint := opts.Fingerprint
+	if fingerprint == nil {
+		fingerprint = func(language, code string) string {
+			return Fingerprint(Spec{Language: language, Code: code})
+		}
+	}
+
+	var report BackfillReport
+	fail := func(line int, err error) {
+		report.Failed++
+		if len(report.Errors) < maxBackfillErrors {
+			report.Errors = append(report.Errors, fmt.Sprintf("line %d: %v", line, err))
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec LegacyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			fail(line, err)
+			continue
+		}
+		job, err := rec.job(opts.Source, opts.KeepIDs)
+		if err != nil {
+			fail(line, err)
+			continue
+		}
+
+		jm.mu.Lock()
+		if _, ok := jm.Store.Get(job.ID); ok {
+			jm.mu.Unlock()
+			report.Skipped++
+			continue
+		}
+		jm.capture(job)
+		jm.assessThreat(job)
+		jm.logJob(job)
+		jm.remember(fingerprint(job.Language, job.Code), job)
+
+		// Saved without an event: subscribers such as the failure rate
+		// alert watch jobs as they finish, not history
+		if (jm.HashCodeOnly || jm.policy(job).HashCodeOnly) && job.CodeHash != "" {
+			job.Code = ""
+		}
+		if err := jm.Store.Put(job); err != nil {
+			jm.mu.Unlock()
+			fail(line, err)
+			continue
+		}
+		close(job.done)
+		jm.mu.Unlock()
+		report.Imported++
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("failed to read legacy log: %w", err)
+	}
+	return report, nil
+}
+
+// History returns the finished jobs as records for Backfill, oldest first,
+// so that job history can move to another server. Jobs whose code is kept
+// only as a hash have no code in their record and cannot be imported.
+func (jm *Manager) History() []LegacyRecord {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+
+	var records []LegacyRecord
+	for _, job := range jm.Store.List() {
+		if !job.Finished() {
+			continue
+		}
+		rec := LegacyRecord{
+			ID:         job.ID,
+			Language:   job.Language,
+			Code:       job.Code,
+			Error:      job.Error,
+			Status:     job.Status,
+			CreatedAt:  job.CreatedAt,
+			FinishedAt: job.CompletedAt,
+			Labels:     job.Labels,
+		}
+		if job.Result != nil {
+			rec.Stdout = job.Result.Stdout
+			rec.Stderr = job.Result.Stderr
+			rec.ExitCode = job.Result.ExitCode
+			rec.DurationMS = job.Result.Duration.Milliseconds()
+		} else if !job.StartedAt.IsZero() {
+			rec.DurationMS = job.CompletedAt.Sub(job.StartedAt).Milliseconds()
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+	return records
+}
@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"forgeai/pkg/storage"
+)
+
+// Built-in data classifications of jobs
+const (
+	ClassificationPublic     = "public"
+	ClassificationInternal   = "internal"
+	ClassificationRestricted = "restricted"
+)
+
+// DefaultClassification is the classification of jobs that do not declare
+// one, unless Manager.DefaultClassification is set
+const DefaultClassification = ClassificationInternal
+
+// ErrUnknownClassification is returned for classifications the manager has
+// no policy or built-in for
+var ErrUnknownClassification = errors.New("unknown data classification")
+
+// ClassificationPolicy is how the jobs of a data classification are stored
+// and run
+type ClassificationPolicy struct {
+	// LogRetention, when positive, replaces Manager.LogRetention for the
+	// logs of the class's jobs
+	LogRetention time.Duration
+
+	// RequireEncryption keeps the logs, artifacts, and spilled code of the
+	// class's jobs in memory rather than writing them unencrypted
+	RequireEncryption bool
+
+	// HashCodeOnly drops the code of the class's jobs once they finish,
+	// keeping only its hash
+	HashCodeOnly bool
+
+	// Isolation names the isolation class that runs the class's jobs,
+	// whatever their language; see ClassRouter
+	Isolation string
+}
+
+// ClassificationNames returns the built-in classifications and those with a
+// policy, sorted
+func (jm *Manager) ClassificationNames() []string {
+	names := []string{ClassificationInternal, ClassificationPublic, ClassificationRestricted}
+	for name := range jm.Classifications {
+		switch name {
+		case ClassificationPublic, ClassificationInternal, ClassificationRestricted:
+		default:
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateClassifications checks the names of classification policies and
+// that the default classification is known
+func ValidateClassifications(defaultName string, policies map[string]ClassificationPolicy) error {
+	for name := range policies {
+		if len(name) > MaxLabelValueLength || !labelKeyRe.MatchString(name) {
+			return fmt.Errorf("invalid data classification: %q", name)
+		}
+	}
+	jm := &Manager{Classifications: policies, DefaultClassification: defaultName}
+	if _, err := jm.Classify(jm.defaultClassification()); err != nil {
+		return fmt.Errorf("default classification: %w", err)
+	}
+	return nil
+}
+
+// Classify returns the classification of a job that declares name, the
+// default classification when name is empty
+func (jm *Manager) Classify(name string) (string, error) {
+	if name == "" {
+		return jm.defaultClassification(), nil
+	}
+	for _, known := range jm.ClassificationNames() {
+		if name == known {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownClassification, name)
+}
+
+// defaultClassification returns the classification of jobs that declare
+// none
+func (jm *Manager) defaultClassification() string {
+	if jm.DefaultClassification != "" {
+		return jm.DefaultClassification
+	}
+	return DefaultClassification
+}
+
+// policy returns the policy of the classification of a job
+func (jm *Manager) policy(job *Job) ClassificationPolicy {
+	return jm.Classifications[job.Classification]
+}
+
+// mayStore reports whether the logs and artifacts of a job may be written
+// to the storage backend
+func (jm *Manager) mayStore(job *Job) bool {
+	if jm.Storage == nil {
+		return false
+	}
+	return !jm.policy(job).RequireEncryption || storage.Encryption(jm.Storage) != nil
+}
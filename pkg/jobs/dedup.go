@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// dedupEntry remembers the job that identical submissions share until
+// expiresAt
+type dedupEntry struct {
+	jobID     string
+	expiresAt time.Time
+}
+
+// Fingerprint hashes a request, such as a Spec or an API request body, for
+// deduplication. Requests with the same fingerprint run the same job.
+func Fingerprint(request interface{}) string {
+	data, _ := json.Marshal(request)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateJobDeduplicated creates a new code job unless an identical request,
+// by fingerprint, created one within DedupWindow that has not been cancelled
+// or failed to start. In that case the job is shared: it is returned and
+// coalesced is true. Without a DedupWindow it is CreateJob.
+func (jm *Manager) CreateJobDeduplicated(fingerprint, language, code string) (job *Job, coalesced bool) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	if job, ok := jm.coalesce(fingerprint); ok {
+		return job, true
+	}
+	job = newCodeJob(language, code, jm.Clock.Now())
+	jm.update(job)
+	jm.remember(fingerprint, job)
+	return job, false
+}
+
+// Coalesced returns how many later submissions share a job
+func (jm *Manager) Coalesced(id string) int {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	if job, ok := jm.Store.Get(id); ok {
+		return job.Coalesced
+	}
+	return 0
+}
+
+// coalesce returns the job to share with a submission, counting the
+// submission on it. The caller must hold jm.mu.
+func (jm *Manager) coalesce(fingerprint string) (*Job, bool) {
+	if jm.DedupWindow <= 0 || fingerprint == "" {
+		return nil, false
+	}
+
+	now := jm.Clock.Now()
+	for k, entry := range jm.dedup {
+		if !now.Before(entry.expiresAt) {
+			delete(jm.dedup, k)
+		}
+	}
+
+	entry, ok := jm.dedup[fingerprint]
+	if !ok {
+		return nil, false
+	}
+	job, ok := jm.Store.Get(entry.jobID)
+	if !ok || job.Status == "cancelled" || job.Status == "setup_failed" {
+		delete(jm.dedup, fingerprint)
+		return nil, false
+	}
+	job.Coalesced++
+	return job, true
+}
+
+// remember lets identical submissions share job for DedupWindow. The caller
+// must hold jm.mu.
+func (jm *Manager) remember(fingerprint string, job *Job) {
+	if jm.DedupWindow <= 0 || fingerprint == "" {
+		return
+	}
+	jm.dedup[fingerprint] = dedupEntry{
+		jobID:     job.ID,
+		expiresAt: job.CreatedAt.Add(jm.DedupWindow),
+	}
+}
@@ -0,0 +1,164 @@
+package jobs
+
+import (
+	"sort"
+	"time"
+)
+
+// ResourceClass is a preset of limits that orchestrators can submit jobs
+// with
+type ResourceClass struct {
+	Name        string `json:"name"`
+	Timeout     int    `json:"timeout"`
+	MemoryLimit int    `json:"memory_limit"`
+}
+
+// ResourceClasses are the presets Estimate recommends from, smallest first
+var ResourceClasses = []ResourceClass{
+	{Name: "small", Timeout: 10, MemoryLimit: 64},
+	{Name: "medium", Timeout: 30, MemoryLimit: 128},
+	{Name: "large", Timeout: 120, MemoryLimit: 512},
+	{Name: "xlarge", Timeout: 300, MemoryLimit: 1024},
+}
+
+// EstimateRequest describes a job to estimate. Timeout is in seconds and
+// MemoryLimit in MB; zero uses the defaults.
+type EstimateRequest struct {
+	Language    string
+	CodeSize    int
+	Timeout     int
+	MemoryLimit int
+}
+
+// Estimate predicts how a job would fare from finished jobs like it
+type Estimate struct {
+	// Samples is how many finished jobs the estimate is based on; Similar
+	// is false when none had a similar code size and all jobs of the
+	// language were used
+	Samples int
+	Similar bool
+
+	// QueueWait is how long the job would wait for a worker
+	QueueWait time.Duration
+
+	// Duration is the median and P95 the 95th percentile run time of the
+	// samples
+	Duration time.Duration
+	P95      time.Duration
+
+	// PeakMemory is the largest resident set size of profiled samples in
+	// bytes; zero when none were profiled
+	PeakMemory int64
+
+	// Timeouts is how many samples ran out of time
+	Timeouts int
+
+	// Class is the smallest resource class that fits the samples, and
+	// Fits whether the requested limits do
+	Class ResourceClass
+	Fits  bool
+}
+
+// Estimate predicts the queue wait, run time, and resource class of a job
+// from the finished jobs of the same language, preferring those whose code
+// size is within a factor of two
+func (jm *Manager) Estimate(req EstimateRequest) Estimate {
+	if req.Timeout <= 0 {
+		req.Timeout = 30
+	}
+	if req.MemoryLimit <= 0 {
+		req.MemoryLimit = 128
+	}
+
+	jm.mu.RLock()
+	var same, similar []*Job
+	var all []time.Duration
+	pending, running := 0, 0
+	for _, job := range jm.Store.List() {
+		switch job.Status {
+		case "pending":
+			pending++
+			continue
+		case "running":
+			running++
+			continue
+		}
+		if job.Result == nil || job.Code == "" {
+			continue
+		}
+		all = append(all, job.Result.Duration)
+		if job.Language != req.Language {
+			continue
+		}
+		same = append(same, job)
+		if size := len(job.Code); size*2 >= req.CodeSize && size <= req.CodeSize*2 {
+			similar = append(similar, job)
+		}
+	}
+	jm.mu.RUnlock()
+
+	e := Estimate{Similar: len(similar) > 0}
+	samples := same
+	if e.Similar {
+		samples = similar
+	}
+	e.Samples = len(samples)
+
+	var durations []time.Duration
+	for _, job := range samples {
+		durations = append(durations, job.Result.Duration)
+		if job.Result.ExitCode == -1 && job.Result.Stderr == "Execution timed out" {
+			e.Timeouts++
+		}
+		if p := job.Result.Profile; p != nil && p.PeakRSS > e.PeakMemory {
+			e.PeakMemory = p.PeakRSS
+		}
+	}
+	e.Duration = percentile(durations, 50)
+	e.P95 = percentile(durations, 95)
+	e.QueueWait = jm.queueWait(pending, running, percentile(all, 50))
+
+	// Leave twice the P95 run time and half again the peak memory. Without
+	// samples, or profiles for memory, the requested limits are all there
+	// is to go by.
+	need := ResourceClass{Timeout: req.Timeout, MemoryLimit: req.MemoryLimit}
+	if e.Samples > 0 {
+		need.Timeout = int((e.P95 * 2).Seconds()) + 1
+	}
+	if e.PeakMemory > 0 {
+		need.MemoryLimit = int(e.PeakMemory*3/2/(1024*1024)) + 1
+	}
+	e.Class = ResourceClasses[len(ResourceClasses)-1]
+	for _, class := range ResourceClasses {
+		if class.Timeout >= need.Timeout && class.MemoryLimit >= need.MemoryLimit {
+			e.Class = class
+			break
+		}
+	}
+	e.Fits = req.Timeout >= need.Timeout && req.MemoryLimit >= need.MemoryLimit
+	return e
+}
+
+// queueWait estimates how long a new job waits for a worker when each job
+// takes about typical
+func (jm *Manager) queueWait(pending, running int, typical time.Duration) time.Duration {
+	if jm.Workers <= 0 {
+		return 0
+	}
+	ahead := pending + running - jm.Workers + 1
+	if ahead <= 0 {
+		return 0
+	}
+	rounds := (ahead + jm.Workers - 1) / jm.Workers
+	return time.Duration(rounds) * typical
+}
+
+// percentile returns the p-th percentile of durations, or zero when empty
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)-1)*p/100]
+}
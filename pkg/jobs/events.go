@@ -0,0 +1,77 @@
+package jobs
+
+import "time"
+
+// Event reports a job status change
+type Event struct {
+	JobID  string
+	Status string
+	Time   time.Time
+
+	// Job is a copy of the job as of the change, which subscribers may
+	// read while the job goes on
+	Job *Job
+}
+
+// subscriber receives events matching its filter
+type subscriber struct {
+	filter Filter
+	ch     chan Event
+}
+
+// DefaultSubscriptionBuffer is the event buffer of a subscription
+const DefaultSubscriptionBuffer = 64
+
+// Subscribe returns a channel of status changes for jobs matching filter,
+// and a function that ends the subscription and closes the channel. Events
+// are dropped rather than blocking jobs when the subscriber falls behind.
+func (jm *Manager) Subscribe(filter Filter) (<-chan Event, func()) {
+	sub := &subscriber{
+		filter: filter,
+		ch:     make(chan Event, DefaultSubscriptionBuffer),
+	}
+
+	jm.mu.Lock()
+	if jm.subscribers == nil {
+		jm.subscribers = make(map[int]*subscriber)
+	}
+	id := jm.nextSub
+	jm.nextSub++
+	jm.subscribers[id] = sub
+	jm.mu.Unlock()
+
+	unsubscribe := func() {
+		jm.mu.Lock()
+		defer jm.mu.Unlock()
+		if _, ok := jm.subscribers[id]; ok {
+			delete(jm.subscribers, id)
+			close(sub.ch)
+		}
+	}
+	return sub.ch, unsubscribe
+}
+
+// publish sends the current status of a job to subscribers. The caller must
+// hold jm.mu.
+func (jm *Manager) publish(job *Job) {
+	if len(jm.subscribers) == 0 {
+		return
+	}
+
+	snapshot := *job
+	event := Event{
+		JobID:  job.ID,
+		Status: job.Status,
+		Time:   jm.Clock.Now(),
+		Job:    &snapshot,
+	}
+	for _, sub := range jm.subscribers {
+		if !sub.filter.Matches(job) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+}
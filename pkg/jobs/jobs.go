@@ -0,0 +1,1018 @@
+// Package jobs manages asynchronous sandbox execution jobs. It is used by the
+// API server and can be embedded in other Go programs without HTTP.
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"forgeai/pkg/attestation"
+	"forgeai/pkg/hardware"
+	"forgeai/pkg/joblog"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/security"
+	"forgeai/pkg/sinks"
+	"forgeai/pkg/storage"
+	"forgeai/pkg/volumes"
+	"forgeai/pkg/workspace"
+)
+
+// Job represents a code execution job
+type Job struct {
+	ID          string
+	Status      string // pending, running, completed, failed, setup_failed, cancelled, interrupted
+	Language    string
+	Code        string
+	FilePath    string
+	Template    string
+	ParentID    string
+	Labels      map[string]string
+	Classification string
+	Timeout     int
+	MemoryLimit int
+	NetworkAccess bool
+	Trace       bool
+	TrackWorkspace bool
+	InlineFiles int64
+	Profile     bool
+	Flamegraph  bool
+	Coverage    bool
+	Rlimits     sandbox.Rlimits
+	MapTracebacks bool
+	Fixtures    []sandbox.Fixture
+	Volume      *volumes.Ref
+	Locale      sandbox.Locale
+	Sink        *sinks.Target
+	SinkReceipt *sinks.Receipt
+	Result      *sandbox.ExecutionResult
+	Logs        []OutputLog
+	Error       string
+	CodeHash    string
+	Threat      *security.ThreatAssessment
+	Hardware    *hardware.Class
+	Manifest    *attestation.SignedManifest
+	CreatedAt   time.Time
+	StartedAt   time.Time
+	CompletedAt time.Time
+	
+	// Worker is the manager that runs the job, which records HeartbeatAt
+	// while it does. Attempts counts how often the job started, and
+	// Interruptions the failed workers that made it start again.
+	Worker        string
+	HeartbeatAt   time.Time
+	Attempts      int
+	Interruptions []Interruption
+	
+	// Session names the session of the job, which runs on the worker that
+	// owns the session. Affinity is that worker while the job waits for
+	// it to claim the job.
+	Session  string
+	Affinity string
+	
+	// ConfigGeneration is the configuration generation the job was created
+	// with; settings holds that configuration
+	ConfigGeneration int64
+	settings         Settings
+	
+	// Coalesced counts later identical submissions that share the job, see
+	// DedupWindow
+	Coalesced int
+	
+	// done is closed when the job reaches a terminal state
+	done chan struct{}
+	
+	// cancel stops a running job
+	cancel context.CancelFunc
+	
+	// requireEncryption keeps the job's code out of unencrypted spill files
+	requireEncryption bool
+}
+
+// Finished reports whether the job reached a terminal state
+func (j *Job) Finished() bool {
+	switch j.Status {
+	case "completed", "failed", "setup_failed", "cancelled", "interrupted":
+		return true
+	}
+	return false
+}
+
+// Filter selects jobs when listing
+type Filter struct {
+	Status    string
+	Language  string
+	MinThreat int
+	ParentID  string
+	Classification string
+	
+	// Labels must all be present on the job; an empty value matches any value
+	Labels map[string]string
+}
+
+// Label limits
+const (
+	MaxLabels           = 32
+	MaxLabelKeyLength   = 63
+	MaxLabelValueLength = 256
+)
+
+var labelKeyRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ValidateLabels checks label count, key syntax, and value lengths
+func ValidateLabels(labels map[string]string) error {
+	if len(labels) > MaxLabels {
+		return fmt.Errorf("at most %d labels are allowed", MaxLabels)
+	}
+	for key, value := range labels {
+		if len(key) > MaxLabelKeyLength || !labelKeyRe.MatchString(key) {
+			return fmt.Errorf("invalid label key: %q", key)
+		}
+		if len(value) > MaxLabelValueLength {
+			return fmt.Errorf("label %s is longer than %d characters", key, MaxLabelValueLength)
+		}
+	}
+	return nil
+}
+
+// DefaultIdempotencyTTL is how long idempotency keys are remembered
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// ErrIdempotencyMismatch is returned when an idempotency key is reused with a
+// different request
+var ErrIdempotencyMismatch = errors.New("idempotency key was used with a different request")
+
+// idempotencyEntry remembers the job created for an idempotency key
+type idempotencyEntry struct {
+	jobID       string
+	fingerprint string
+	expiresAt   time.Time
+}
+
+// Manager manages execution jobs
+type Manager struct {
+	mu sync.RWMutex
+	
+	idempotency map[string]idempotencyEntry
+	
+	// IdempotencyTTL is how long an idempotency key returns the original job
+	IdempotencyTTL time.Duration
+	
+	dedup map[string]dedupEntry
+	
+	// DedupWindow, when positive, coalesces identical submissions made
+	// within the window after the first into one shared job
+	DedupWindow time.Duration
+
+	// Quarantine holds code hashes that are rejected on resubmission
+	Quarantine *security.Quarantine
+
+	// QuarantineThreshold is the threat score at which code is quarantined
+	// automatically; zero disables automatic quarantine
+	QuarantineThreshold int
+	
+	// Signer signs the execution manifest of every completed job
+	Signer *attestation.Signer
+	
+	// Log records finished jobs in a tamper-evident chain
+	Log *joblog.Log
+	
+	// Storage receives job artifacts once a job finishes; artifacts stay in
+	// memory when nil
+	Storage storage.Backend
+	
+	// InlineOutput is how many bytes of stdout and stderr job results keep,
+	// DefaultInlineOutput when zero and unlimited when negative. The full
+	// output is kept as logs.
+	InlineOutput int
+	
+	// Output bounds the output of running jobs held in memory; zero limits
+	// use sandbox.DefaultOutputLimits
+	Output sandbox.OutputLimits
+	
+	// LogRetention is how long the logs of finished jobs are kept; zero
+	// keeps them
+	LogRetention time.Duration
+	
+	// LogCompression counts the bytes of logs compressed in memory
+	LogCompression storage.CompressionStats
+	
+	// Workspaces provides the working directories of code jobs; temp
+	// directories are used when nil
+	Workspaces *workspace.Manager
+	
+	// Volumes holds the persistent volumes that jobs may mount; jobs that
+	// ask for a volume fail when nil
+	Volumes *volumes.Manager
+	
+	// Sinks holds the buckets that jobs may push their results to
+	Sinks *sinks.Registry
+	
+	// HashCodeOnly drops the code of jobs once they finish, keeping only
+	// its hash
+	HashCodeOnly bool
+	
+	// Classifications are the policies of data classifications; jobs of
+	// classifications without one follow the manager's settings
+	Classifications map[string]ClassificationPolicy
+	
+	// DefaultClassification is the classification of jobs that declare
+	// none; DefaultClassification when empty
+	DefaultClassification string
+	
+	// Version is recorded as the executor version in signed manifests
+	Version string
+	
+	// Workers limits how many jobs run at once; zero means no limit. It must
+	// be set before the first job runs.
+	Workers int
+	
+	// LanguageWorkers limits how many jobs of a language run at once, in
+	// addition to Workers. It must be set before the first job runs.
+	LanguageWorkers map[string]int
+	
+	// Store holds the jobs, Queue hands them to workers, Executors creates
+	// the executor of each job, and Clock tells the time recorded on jobs.
+	// NewManager sets them to an in-memory store, a goroutine per job,
+	// local executors, and the wall clock; replace them before the first
+	// job to use other backends.
+	Store     Store
+	Queue     Queue
+	Executors ExecutorFactory
+	Clock     Clock
+	
+	// WrapExecutor, when set, wraps the executor of every job, for example to
+	// inject faults in chaos tests
+	WrapExecutor func(job *Job, exec sandbox.Executor) sandbox.Executor
+	
+	// Rlimits are the resource limits of jobs that do not set their own.
+	// Like Output, InlineOutput, and LogRetention, it must be changed with
+	// Reconfigure once jobs run.
+	Rlimits sandbox.Rlimits
+	
+	// Locale is the time zone and locale of jobs that do not set their
+	// own. Like Rlimits, it must be changed with Reconfigure once jobs run.
+	Locale sandbox.Locale
+	
+	// Hardware, when set, records the hardware class of the worker on
+	// every job when it starts
+	Hardware *hardware.Probe
+	
+	// Worker identifies the manager on the jobs it runs, such as the
+	// replica of the API server
+	Worker string
+	
+	// HeartbeatInterval is how often Heartbeat should be called;
+	// DefaultHeartbeatInterval when zero. Running jobs without a heartbeat
+	// for three intervals are recovered by RecoverInterrupted.
+	HeartbeatInterval time.Duration
+	
+	// Retry decides whether recovered jobs run again
+	Retry RetryPolicy
+	
+	// Sessions binds the jobs of each session to the worker that ran its
+	// first job. Replicas that share Store must share Sessions.
+	Sessions SessionStore
+	
+	// SessionTTL is how long sessions are kept after their last job;
+	// DefaultSessionTTL when zero. Heartbeat forgets older sessions.
+	SessionTTL time.Duration
+	
+	// Strict refuses jobs that require isolation guarantees the executor
+	// cannot enforce
+	Strict bool
+	
+	slots         chan struct{}
+	languageSlots map[string]chan struct{}
+	slotsOnce     sync.Once
+	
+	// sessionMu orders this manager's changes to sessions, which are made
+	// without holding mu
+	sessionMu sync.Mutex
+	
+	subscribers map[int]*subscriber
+	nextSub     int
+	
+	// pauseReason is set while intake is paused
+	pauseReason string
+	
+	// maintenanceReason is set while in maintenance mode, which started at
+	// maintenanceSince
+	maintenanceReason string
+	maintenanceSince  time.Time
+	
+	// reconfigured counts the calls to Reconfigure
+	reconfigured int64
+}
+
+// NewManager creates a new job manager
+func NewManager() *Manager {
+	jm := &Manager{
+		idempotency:         make(map[string]idempotencyEntry),
+		dedup:               make(map[string]dedupEntry),
+		IdempotencyTTL:      DefaultIdempotencyTTL,
+		Quarantine:          security.NewQuarantine(),
+		QuarantineThreshold: security.DefaultQuarantineThreshold,
+		Rlimits:             sandbox.DefaultRlimits(),
+		Locale:              sandbox.DefaultLocale(),
+		Store:               NewMemoryStore(),
+		Sessions:            NewMemorySessionStore(),
+		Queue:               GoQueue{},
+		Clock:               SystemClock{},
+	}
+	jm.Executors = ExecutorFactoryFunc(jm.LocalExecutor)
+	return jm
+}
+
+// CreateJob creates a new job
+func (jm *Manager) CreateJob(language, code string) *Job {
+	job := newCodeJob(language, code, jm.Clock.Now())
+	
+	jm.mu.Lock()
+	jm.update(job)
+	jm.mu.Unlock()
+	
+	return job
+}
+
+// CreateJobWithKey creates a new job unless the idempotency key was already
+// used within IdempotencyTTL, in which case the original job is returned and
+// replayed is true. fingerprint identifies the request; reusing a key with a
+// different fingerprint returns ErrIdempotencyMismatch.
+func (jm *Manager) CreateJobWithKey(key, fingerprint, language, code string) (job *Job, replayed bool, err error) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	
+	now := jm.Clock.Now()
+	for k, entry := range jm.idempotency {
+		if now.After(entry.expiresAt) {
+			delete(jm.idempotency, k)
+		}
+	}
+	
+	if entry, ok := jm.idempotency[key]; ok {
+		if entry.fingerprint != fingerprint {
+			return nil, false, ErrIdempotencyMismatch
+		}
+		if job, ok := jm.Store.Get(entry.jobID); ok {
+			return job, true, nil
+		}
+	}
+	
+	job = newCodeJob(language, code, now)
+	jm.update(job)
+	jm.idempotency[key] = idempotencyEntry{
+		jobID:       job.ID,
+		fingerprint: fingerprint,
+		expiresAt:   now.Add(jm.IdempotencyTTL),
+	}
+	
+	return job, false, nil
+}
+
+// newCodeJob creates a pending code job with default limits
+func newCodeJob(language, code string, now time.Time) *Job {
+	return &Job{
+		ID:        generateJobID(),
+		Status:    "pending",
+		Language:  language,
+		Code:      code,
+		CodeHash:  security.CodeHash(language, code),
+		Timeout:   30,
+		MemoryLimit: 128,
+		CreatedAt: now,
+		done:      make(chan struct{}),
+	}
+}
+
+// CreateFileJob creates a new file execution job
+func (jm *Manager) CreateFileJob(filePath string) *Job {
+	job := newFileJob(filePath, jm.Clock.Now())
+	
+	jm.mu.Lock()
+	jm.update(job)
+	jm.mu.Unlock()
+	
+	return job
+}
+
+// newFileJob creates a pending file job with default limits
+func newFileJob(filePath string, now time.Time) *Job {
+	return &Job{
+		ID:        generateJobID(),
+		Status:    "pending",
+		FilePath:  filePath,
+		Timeout:   30,
+		MemoryLimit: 128,
+		CreatedAt: now,
+		done:      make(chan struct{}),
+	}
+}
+
+// GetJob retrieves a job by ID
+func (jm *Manager) GetJob(id string) (*Job, bool) {
+	jm.mu.RLock()
+	job, ok := jm.Store.Get(id)
+	jm.mu.RUnlock()
+	return job, ok
+}
+
+// Status returns the status of a job and whether it finished. Jobs change
+// while they run, so callers holding a job that was dispatched read its
+// status here rather than from the job.
+func (jm *Manager) Status(id string) (status string, finished bool) {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	job, ok := jm.Store.Get(id)
+	if !ok {
+		return "", false
+	}
+	return job.Status, job.Finished()
+}
+
+// ListJobs lists all jobs matching the filter
+func (jm *Manager) ListJobs(filter Filter) []*Job {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	
+	var jobs []*Job
+	for _, job := range jm.Store.List() {
+		if filter.Matches(job) {
+			jobs = append(jobs, job)
+		}
+	}
+	
+	return jobs
+}
+
+// Children returns the direct children of a job, oldest first
+func (jm *Manager) Children(id string) []*Job {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	
+	var children []*Job
+	for _, job := range jm.Store.List() {
+		if job.ParentID == id {
+			children = append(children, job)
+		}
+	}
+	
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].CreatedAt.Before(children[j].CreatedAt)
+	})
+	return children
+}
+
+// Matches reports whether a job satisfies the filter
+func (f Filter) Matches(job *Job) bool {
+	if f.Status != "" && job.Status != f.Status {
+		return false
+	}
+	if f.Language != "" && job.Language != f.Language {
+		return false
+	}
+	if f.ParentID != "" && job.ParentID != f.ParentID {
+		return false
+	}
+	if f.Classification != "" && job.Classification != f.Classification {
+		return false
+	}
+	if f.MinThreat > 0 && (job.Threat == nil || job.Threat.Score < f.MinThreat) {
+		return false
+	}
+	for key, value := range f.Labels {
+		actual, ok := job.Labels[key]
+		if !ok || (value != "" && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsQuarantined returns the quarantine entry for code, if any
+func (jm *Manager) IsQuarantined(language, code string) (security.QuarantineEntry, bool) {
+	return jm.Quarantine.Get(security.CodeHash(language, code))
+}
+
+// CancelJob cancels a job
+func (jm *Manager) CancelJob(id string) bool {
+	return jm.AbortJob(id, "")
+}
+
+// AbortJob cancels a job and records reason as its error
+func (jm *Manager) AbortJob(id, reason string) bool {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	
+	job, ok := jm.Store.Get(id)
+	if !ok {
+		return false
+	}
+	
+	// Only cancel jobs that are pending or running
+	if job.Status == "pending" || job.Status == "running" {
+		if job.cancel != nil {
+			job.cancel()
+		}
+		job.Status = "cancelled"
+		job.Error = reason
+		job.CompletedAt = jm.Clock.Now()
+		jm.logJob(job)
+		jm.markDone(job)
+		return true
+	}
+	
+	return false
+}
+
+// Pause stops intake of new jobs submitted with Submit. Jobs that already
+// exist keep running.
+func (jm *Manager) Pause(reason string) {
+	if reason == "" {
+		reason = "paused"
+	}
+	jm.mu.Lock()
+	jm.pauseReason = reason
+	jm.mu.Unlock()
+}
+
+// Resume accepts new jobs again
+func (jm *Manager) Resume() {
+	jm.mu.Lock()
+	jm.pauseReason = ""
+	jm.mu.Unlock()
+}
+
+// Paused reports whether intake is paused or in maintenance mode, and why
+func (jm *Manager) Paused() (string, bool) {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	if jm.maintenanceReason != "" {
+		return jm.maintenanceReason, true
+	}
+	return jm.pauseReason, jm.pauseReason != ""
+}
+
+// ExecuteJob executes a job
+func (jm *Manager) ExecuteJob(job *Job) {
+	jm.ExecuteJobContext(context.Background(), job)
+}
+
+// ExecuteJobContext executes a job, stopping it when ctx is done or the job
+// is cancelled
+func (jm *Manager) ExecuteJobContext(ctx context.Context, job *Job) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	
+	release, ok := jm.acquire(ctx, job)
+	if !ok {
+		return
+	}
+	defer release()
+	
+	// Record the hardware the job runs on, so that its duration can be
+	// compared with jobs of other workers
+	var class *hardware.Class
+	if jm.Hardware != nil {
+		current := jm.Hardware.Class()
+		class = &current
+	}
+	
+	jm.mu.Lock()
+	// The job may have been cancelled before it started
+	if job.Status == "cancelled" {
+		jm.mu.Unlock()
+		return
+	}
+	job.Status = "running"
+	job.StartedAt = jm.Clock.Now()
+	job.HeartbeatAt = job.StartedAt
+	job.Worker = jm.Worker
+	job.Attempts++
+	job.Hardware = class
+	job.cancel = cancel
+	jm.update(job)
+	jm.mu.Unlock()
+	
+	// Create executor
+	exec := jm.Executors.NewExecutor(job)
+	run := exec
+	if jm.WrapExecutor != nil {
+		run = jm.WrapExecutor(job, exec)
+	}
+	result, err := jm.runWithVolume(ctx, run, job)
+	
+	// Push the results to the job's output sink before the job finishes, so
+	// that clients that see it finished can rely on the pushed objects
+	var receipt *sinks.Receipt
+	if job.Sink != nil && err == nil && ctx.Err() == nil {
+		receipt = jm.pushResults(ctx, job, result)
+	}
+	
+	// Upload the artifacts before taking the lock, which guards every job;
+	// a slow storage backend must not stall the others
+	var artifactKeys map[int]string
+	if err == nil && ctx.Err() == nil {
+		artifactKeys = jm.storeArtifacts(ctx, job, result)
+	}
+	
+	// Manifests name the backend that ran the job. Asking the executor may
+	// take a while, so it is asked before taking the lock.
+	var backend string
+	if jm.Signer != nil {
+		backend = exec.Capabilities().Backend
+	}
+	
+	// Artifacts of jobs cancelled while they were uploaded are deleted
+	// again once the lock is released
+	var discarded map[int]string
+	defer func() {
+		jm.deleteArtifacts(job.ID, discarded)
+	}()
+	
+	// Update job with results
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	
+	job.cancel = nil
+	
+	// CancelJob already finished the job
+	if job.Status == "cancelled" {
+		discarded = artifactKeys
+		return
+	}
+	
+	job.CompletedAt = jm.Clock.Now()
+	
+	if ctx.Err() == context.Canceled {
+		discarded = artifactKeys
+		job.Status = "cancelled"
+		job.Error = "execution cancelled"
+		jm.logJob(job)
+		jm.markDone(job)
+		return
+	}
+	
+	switch {
+	case err != nil:
+		// The executor or its environment failed, not the submitted code
+		job.Status = "setup_failed"
+		job.Error = err.Error()
+	case result.ExitCode != 0:
+		job.Status = "failed"
+		job.Error = failureReason(result)
+		job.Result = result
+		job.SinkReceipt = receipt
+		jm.signManifest(job, backend)
+	default:
+		job.Status = "completed"
+		job.Result = result
+		job.SinkReceipt = receipt
+		jm.signManifest(job, backend)
+	}
+	
+	jm.assessThreat(job)
+	jm.logJob(job)
+	jm.recordArtifacts(job, artifactKeys)
+	jm.recordLogs(job)
+	jm.markDone(job)
+}
+
+// failureReason describes why a program that ran did not succeed
+func failureReason(result *sandbox.ExecutionResult) string {
+	if result.ExitCode == -1 && result.Stderr != "" {
+		// Timeouts and quota violations are reported in place of stderr
+		return result.Stderr
+	}
+	return fmt.Sprintf("program exited with code %d", result.ExitCode)
+}
+
+// pushResults pushes the logs and artifacts of a job to its output sink
+func (jm *Manager) pushResults(ctx context.Context, job *Job, result *sandbox.ExecutionResult) *sinks.Receipt {
+	if jm.Sinks == nil {
+		return &sinks.Receipt{URL: job.Sink.URL, Objects: []string{}, Error: "output sinks are not enabled"}
+	}
+	receipt := jm.Sinks.Push(ctx, *job.Sink, job.ID, result)
+	if receipt.Error != "" {
+		fmt.Printf("Warning: job %s: %s\n", job.ID, receipt.Error)
+	}
+	return &receipt
+}
+
+// runWithVolume runs a job with its persistent volume mounted, if it asks
+// for one, and stops it when the volume grows past its quota. Jobs that
+// share a volume run one at a time.
+func (jm *Manager) runWithVolume(ctx context.Context, exec sandbox.Executor, job *Job) (*sandbox.ExecutionResult, error) {
+	if job.Volume == nil {
+		return runJob(ctx, exec, job)
+	}
+	if jm.Volumes == nil {
+		return nil, fmt.Errorf("persistent volumes are not enabled")
+	}
+	
+	lease, err := jm.Volumes.Acquire(ctx, *job.Volume)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mount volume: %w", err)
+	}
+	defer lease.Release()
+	
+	runCtx, stop := lease.Enforce(ctx)
+	defer stop()
+	result, err := runJob(runCtx, exec, job)
+	if ctx.Err() == nil && lease.QuotaExceeded() {
+		if result == nil {
+			result = &sandbox.ExecutionResult{}
+		}
+		result.Stderr = "Volume quota exceeded"
+		result.ExitCode = -1
+		return result, nil
+	}
+	return result, err
+}
+
+// runJob executes a job with exec, turning a crash of the executor into an
+// error so that the job still finishes
+func runJob(ctx context.Context, exec sandbox.Executor, job *Job) (result *sandbox.ExecutionResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("worker crashed: %v", r)
+		}
+	}()
+	
+	// Execute based on job type
+	if job.Code != "" {
+		return exec.Execute(ctx, job.Language, job.Code)
+	}
+	if job.FilePath != "" {
+		return exec.ExecuteFile(ctx, job.FilePath)
+	}
+	return nil, fmt.Errorf("invalid job: no code or file path")
+}
+
+// acquire waits for a worker slot and a slot of the job's language. It
+// fails when ctx is done or the job finishes before the slots free up.
+func (jm *Manager) acquire(ctx context.Context, job *Job) (release func(), ok bool) {
+	jm.slotsOnce.Do(func() {
+		if jm.Workers > 0 {
+			jm.slots = make(chan struct{}, jm.Workers)
+		}
+		jm.languageSlots = make(map[string]chan struct{})
+		for language, n := range jm.LanguageWorkers {
+			if n > 0 {
+				jm.languageSlots[language] = make(chan struct{}, n)
+			}
+		}
+	})
+	
+	// Jobs waiting for their language must not hold a shared slot
+	releaseLanguage, ok := jm.acquireSlot(ctx, job, jm.languageSlots[job.Language])
+	if !ok {
+		return nil, false
+	}
+	releaseShared, ok := jm.acquireSlot(ctx, job, jm.slots)
+	if !ok {
+		releaseLanguage()
+		return nil, false
+	}
+	return func() {
+		releaseShared()
+		releaseLanguage()
+	}, true
+}
+
+// acquireSlot waits for a slot of slots, which are unlimited when nil
+func (jm *Manager) acquireSlot(ctx context.Context, job *Job, slots chan struct{}) (release func(), ok bool) {
+	if slots == nil {
+		return func() {}, true
+	}
+	
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	case <-ctx.Done():
+		jm.mu.Lock()
+		if !job.Finished() {
+			job.Status = "cancelled"
+			job.Error = "execution cancelled"
+			job.CompletedAt = jm.Clock.Now()
+			jm.logJob(job)
+			jm.markDone(job)
+		}
+		jm.mu.Unlock()
+		return nil, false
+	case <-job.done:
+		return nil, false
+	}
+}
+
+// Executor returns an executor configured like the one that runs jobs,
+// with the default limits
+func (jm *Manager) Executor() sandbox.Executor {
+	return jm.Executors.NewExecutor(nil)
+}
+
+// Capabilities reports the guarantees of the executor that runs jobs
+func (jm *Manager) Capabilities() sandbox.Capabilities {
+	return jm.Executor().Capabilities()
+}
+
+// CheckRequirements returns ErrUnenforceable when the executor of a
+// language cannot meet the isolation guarantees in req and the manager is
+// strict. File jobs check the executor of the empty language.
+func (jm *Manager) CheckRequirements(language string, req sandbox.Requirements) error {
+	if !jm.Strict || !req.Security() {
+		return nil
+	}
+	
+	caps := jm.LanguageExecutor(language).Capabilities()
+	if unmet := caps.Unmet(req); len(unmet) > 0 {
+		return &UnenforceableError{Backend: caps.Backend, Unmet: unmet}
+	}
+	return nil
+}
+
+// markDone saves a finished job, without its code under HashCodeOnly or a
+// classification policy that asks for it, and wakes up its waiters. The
+// caller must hold jm.mu.
+func (jm *Manager) markDone(job *Job) {
+	if (jm.HashCodeOnly || jm.policy(job).HashCodeOnly) && job.CodeHash != "" {
+		job.Code = ""
+	}
+	jm.update(job)
+	if job.done == nil {
+		return
+	}
+	select {
+	case <-job.done:
+	default:
+		close(job.done)
+	}
+}
+
+// WaitJob waits up to timeout for a job to reach a terminal state and
+// returns the job. It returns early when ctx is cancelled.
+func (jm *Manager) WaitJob(ctx context.Context, id string, timeout time.Duration) (*Job, bool) {
+	job, ok := jm.GetJob(id)
+	if !ok || job.done == nil {
+		return job, ok
+	}
+	
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	
+	select {
+	case <-job.done:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return job, true
+}
+
+// storeArtifacts uploads the artifacts of a finished job to object storage,
+// unless its classification keeps them out of it, and returns the keys they
+// were stored under by their index in result. It uploads with ctx, the
+// context of the job, and must be called without jm.mu held.
+func (jm *Manager) storeArtifacts(ctx context.Context, job *Job, result *sandbox.ExecutionResult) map[int]string {
+	if !jm.mayStore(job) || result == nil {
+		return nil
+	}
+	
+	keys := make(map[int]string)
+	for i, artifact := range result.Artifacts {
+		if artifact.Key != "" {
+			continue
+		}
+		
+		key := storage.JoinKey("jobs", job.ID, "artifacts", artifact.Name)
+		if err := jm.Storage.Put(ctx, key, bytes.NewReader(artifact.Data), int64(len(artifact.Data)), artifact.ContentType); err != nil {
+			fmt.Printf("Warning: failed to store artifact %s of job %s: %v\n", artifact.Name, job.ID, err)
+			continue
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+// deleteArtifacts deletes the artifacts storeArtifacts uploaded for a job
+// that was cancelled meanwhile. It must be called without jm.mu held.
+func (jm *Manager) deleteArtifacts(id string, keys map[int]string) {
+	for _, key := range keys {
+		if err := jm.Storage.Delete(context.Background(), key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			fmt.Printf("Warning: failed to delete artifact %s of cancelled job %s: %v\n", key, id, err)
+		}
+	}
+}
+
+// recordArtifacts replaces the data of the stored artifacts of a job with
+// the keys storeArtifacts returned. The caller must hold jm.mu.
+func (jm *Manager) recordArtifacts(job *Job, keys map[int]string) {
+	if job.Result == nil {
+		return
+	}
+	for i, key := range keys {
+		artifact := &job.Result.Artifacts[i]
+		artifact.Key = key
+		artifact.Size = int64(len(artifact.Data))
+		artifact.Data = nil
+	}
+}
+
+// logJob appends a finished job to the job log. The caller must hold jm.mu.
+func (jm *Manager) logJob(job *Job) {
+	if jm.Log == nil {
+		return
+	}
+	
+	record := joblog.Record{
+		JobID:      job.ID,
+		Status:     job.Status,
+		Language:   job.Language,
+		CodeHash:   job.CodeHash,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt.UTC(),
+		FinishedAt: job.CompletedAt.UTC(),
+		Labels:     job.Labels,
+		Classification: job.Classification,
+	}
+	if job.Result != nil {
+		record.ExitCode = job.Result.ExitCode
+		record.DurationMS = job.Result.Duration.Milliseconds()
+		record.ResultHash = attestation.ResultHash(job.Result.Stdout, job.Result.Stderr, job.Result.ExitCode)
+	}
+	record.Hardware = job.Hardware
+	
+	if _, err := jm.Log.Append(record); err != nil {
+		fmt.Printf("Warning: failed to append job %s to job log: %v\n", job.ID, err)
+	}
+}
+
+// signManifest attaches a signed execution manifest to a completed job,
+// naming the backend that ran it and the image it ran in. The caller must
+// hold jm.mu.
+func (jm *Manager) signManifest(job *Job, backend string) {
+	if jm.Signer == nil || job.Result == nil {
+		return
+	}
+	
+	codeHash := job.CodeHash
+	if codeHash == "" {
+		if data, err := os.ReadFile(job.FilePath); err == nil {
+			codeHash = security.CodeHash(job.Language, string(data))
+		}
+	}
+	
+	signed, err := jm.Signer.Sign(&attestation.Manifest{
+		JobID:           job.ID,
+		Language:        job.Language,
+		CodeHash:        codeHash,
+		Image:           job.Result.Image,
+		ImageDigest:     job.Result.ImageDigest,
+		Executor:        backend,
+		ExecutorVersion: jm.Version,
+		Limits: attestation.Limits{
+			TimeoutSeconds: job.Timeout,
+			MemoryMB:       job.MemoryLimit,
+			NetworkAccess:  job.NetworkAccess,
+		},
+		ExitCode:    job.Result.ExitCode,
+		ResultHash:  attestation.ResultHash(job.Result.Stdout, job.Result.Stderr, job.Result.ExitCode),
+		StartedAt:   job.StartedAt.UTC(),
+		CompletedAt: job.CompletedAt.UTC(),
+	})
+	if err == nil {
+		job.Manifest = signed
+	}
+}
+
+// assessThreat scores the job and quarantines its code above the threshold.
+// The caller must hold jm.mu.
+func (jm *Manager) assessThreat(job *Job) {
+	var findings []security.ThreatFinding
+	if job.Code != "" {
+		findings = append(findings, security.AnalyzeCode(job.Language, job.Code)...)
+	}
+	findings = append(findings, security.AnalyzeResult(job.Result)...)
+	
+	assessment := security.ScoreThreat(findings)
+	job.Threat = &assessment
+	
+	if jm.QuarantineThreshold > 0 && job.CodeHash != "" && assessment.Score >= jm.QuarantineThreshold {
+		jm.Quarantine.Add(security.QuarantineEntry{
+			CodeHash: job.CodeHash,
+			Reason:   "threat score above quarantine threshold",
+			JobID:    job.ID,
+			Score:    assessment.Score,
+		})
+	}
+}
+
+// generateJobID generates a unique job ID
+func generateJobID() string {
+	return fmt.Sprintf("job-%d", time.Now().UnixNano())
+}
\ No newline at end of file
@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"runtime"
+	"sort"
+	"time"
+)
+
+// loadWindow is how many of the most recently finished jobs the typical
+// duration of Load is taken from
+const loadWindow = 200
+
+// Load describes the demand on the workers of the manager, for autoscalers
+type Load struct {
+	// Pending jobs wait for a worker and Running jobs have one
+	Pending int `json:"pending"`
+	Running int `json:"running"`
+
+	// Workers is the limit on jobs that run at once, zero when unlimited;
+	// Capacity is Workers, or the number of CPUs when unlimited
+	Workers  int `json:"workers"`
+	Capacity int `json:"capacity"`
+
+	// Utilization is Running over Capacity
+	Utilization float64 `json:"utilization"`
+
+	// TypicalDuration is the median run time of recently finished jobs
+	TypicalDuration time.Duration `json:"typical_duration_ns"`
+
+	// ExpectedWait is how long a job submitted now would wait for a worker
+	ExpectedWait time.Duration `json:"expected_wait_ns"`
+}
+
+// Load returns the current demand on the workers
+func (jm *Manager) Load() Load {
+	jm.mu.RLock()
+	var load Load
+	var finished []*Job
+	for _, job := range jm.Store.List() {
+		switch job.Status {
+		case "pending":
+			load.Pending++
+		case "running":
+			load.Running++
+		default:
+			if job.Result != nil && !job.CompletedAt.IsZero() {
+				finished = append(finished, job)
+			}
+		}
+	}
+	jm.mu.RUnlock()
+
+	// Recent jobs tell the current duration best
+	if len(finished) > loadWindow {
+		sort.Slice(finished, func(i, j int) bool {
+			return finished[i].CompletedAt.Before(finished[j].CompletedAt)
+		})
+		finished = finished[len(finished)-loadWindow:]
+	}
+	durations := make([]time.Duration, len(finished))
+	for i, job := range finished {
+		durations[i] = job.Result.Duration
+	}
+
+	load.Workers = jm.Workers
+	load.Capacity = jm.Workers
+	if load.Capacity <= 0 {
+		load.Capacity = runtime.NumCPU()
+	}
+	load.Utilization = float64(load.Running) / float64(load.Capacity)
+	load.TypicalDuration = percentile(durations, 50)
+	load.ExpectedWait = jm.queueWait(load.Pending, load.Running, load.TypicalDuration)
+	return load
+}
@@ -0,0 +1,291 @@
+package jobs
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/storage"
+)
+
+// DefaultInlineOutput is how many bytes of stdout and stderr the results of
+// finished jobs keep; the full output is available as logs
+const DefaultInlineOutput = 64 << 10
+
+// Output streams kept as logs
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// ErrLogNotFound is returned for jobs without output, such as jobs that did
+// not run
+var ErrLogNotFound = errors.New("log not found")
+
+// ErrLogExpired is returned for logs removed by the retention policy
+var ErrLogExpired = errors.New("log expired")
+
+// OutputLog is the full output of one stream of a finished job
+type OutputLog struct {
+	Stream string
+	Size   int64
+
+	// Truncated is set when the job result holds only the start of the
+	// output
+	Truncated bool
+
+	// Binary is set for output that is not text, which the job result
+	// holds base64 encoded
+	Binary bool
+
+	// Key is the storage key of the log, which is kept in memory when it is
+	// empty
+	Key string
+
+	// data holds logs kept in memory, gzipped when that made them smaller
+	data    string
+	gzipped bool
+	expired bool
+}
+
+// Expired reports whether the retention policy removed the log
+func (l OutputLog) Expired() bool {
+	return l.expired
+}
+
+// Log returns the log of a stream of a finished job
+func (j *Job) Log(stream string) (OutputLog, bool) {
+	for _, log := range j.Logs {
+		if log.Stream == stream {
+			return log, true
+		}
+	}
+	return OutputLog{}, false
+}
+
+// recordLogs keeps the full output of a finished job as logs, in storage
+// when there is one that its classification allows, and cuts the output in
+// its result to the inline limit. Output that is not text is kept as it is
+// in the logs and base64 encoded in the result. The caller must hold jm.mu.
+func (jm *Manager) recordLogs(job *Job) {
+	if job.Result == nil {
+		return
+	}
+	limit := job.settings.InlineOutput
+	if limit == 0 {
+		limit = DefaultInlineOutput
+	}
+
+	streams := []struct {
+		name     string
+		text     *string
+		encoding *string
+	}{
+		{StreamStdout, &job.Result.Stdout, &job.Result.StdoutEncoding},
+		{StreamStderr, &job.Result.Stderr, &job.Result.StderrEncoding},
+	}
+	job.Logs = nil
+	for _, stream := range streams {
+		text := *stream.text
+		log := OutputLog{Stream: stream.name, Size: int64(len(text)), data: text}
+		log.Binary = !sandbox.IsText(text)
+
+		if jm.mayStore(job) && text != "" {
+			key := storage.JoinKey("jobs", job.ID, "logs", stream.name+".log")
+			err := jm.Storage.Put(context.Background(), key, strings.NewReader(text), log.Size, log.ContentType())
+			if err != nil {
+				fmt.Printf("Warning: failed to store %s log of job %s: %v\n", stream.name, job.ID, err)
+			} else {
+				log.Key = key
+				log.data = ""
+			}
+		}
+		if log.Key == "" && len(text) >= storage.MinCompressSize {
+			if compressed := storage.Gzip([]byte(text)); compressed != nil {
+				log.data = string(compressed)
+				log.gzipped = true
+				jm.LogCompression.Add(log.Size, int64(len(compressed)))
+			}
+		}
+
+		switch {
+		case log.Binary:
+			encoded, cut := sandbox.EncodeBinary(text, limit)
+			log.Truncated = cut > 0
+			*stream.text, *stream.encoding = encoded, sandbox.EncodingBase64
+		case limit > 0 && len(text) > limit:
+			log.Truncated = true
+			*stream.text = TruncateOutput(text, limit)
+		}
+		job.Logs = append(job.Logs, log)
+	}
+}
+
+// ContentType returns the media type of the log
+func (l OutputLog) ContentType() string {
+	if l.Binary {
+		return "application/octet-stream"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// TruncateOutput cuts s to at most n bytes without splitting a character;
+// negative n keeps all of s
+func TruncateOutput(s string, n int) string {
+	if n < 0 || len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Output returns the output of a stream in the job result, cut to max bytes
+// unless max is negative, and how many bytes of the full output it lacks.
+// Base64 encoded output is cut to max bytes of its encoding, at the end of a
+// whole quantum, and what it lacks is counted in decoded bytes.
+func (j *Job) Output(stream string, max int) (text string, truncated int64) {
+	if j.Result == nil {
+		return "", 0
+	}
+	full, encoding := j.Result.Stdout, j.Result.StdoutEncoding
+	if stream == StreamStderr {
+		full, encoding = j.Result.Stderr, j.Result.StderrEncoding
+	}
+
+	size := int64(len(full))
+	var kept int64
+	if encoding == sandbox.EncodingBase64 {
+		text = full
+		if max >= 0 && len(text) > max {
+			text = text[:max/4*4]
+		}
+		size = decodedLen(full)
+		kept = decodedLen(text)
+	} else {
+		text = TruncateOutput(full, max)
+		kept = int64(len(text))
+	}
+
+	// The result holds only the start of output kept as a longer log
+	if log, ok := j.Log(stream); ok {
+		size = log.Size
+	}
+	return text, size - kept
+}
+
+// OpenLog opens the full log of a stream of a finished job
+func (jm *Manager) OpenLog(ctx context.Context, job *Job, stream string) (io.ReadCloser, OutputLog, error) {
+	jm.mu.RLock()
+	log, ok := job.Log(stream)
+	jm.mu.RUnlock()
+
+	switch {
+	case !ok:
+		return nil, log, ErrLogNotFound
+	case log.expired:
+		return nil, log, ErrLogExpired
+	case log.Key == "" && log.gzipped:
+		reader, err := storage.Gunzip(io.NopCloser(strings.NewReader(log.data)))
+		return reader, log, err
+	case log.Key == "":
+		return io.NopCloser(strings.NewReader(log.data)), log, nil
+	}
+
+	if jm.Storage == nil {
+		return nil, log, fmt.Errorf("log storage not configured")
+	}
+	reader, err := jm.Storage.Get(ctx, log.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, log, ErrLogExpired
+	}
+	if err != nil {
+		return nil, log, fmt.Errorf("failed to read log: %w", err)
+	}
+	return reader, log, nil
+}
+
+// PruneLogs removes the logs of jobs that finished more than LogRetention
+// ago, or the log retention of their classification, including stored logs
+// of jobs from earlier runs, and returns how many logs were removed
+func (jm *Manager) PruneLogs(ctx context.Context, now time.Time) int {
+	jm.mu.Lock()
+	removed := 0
+
+	// Stored logs of jobs whose classification sets their retention are
+	// removed here rather than by age below
+	var expired []string
+	own := make(map[string]bool)
+	for _, job := range jm.Store.List() {
+		retention := jm.LogRetention
+		if policy := jm.policy(job); policy.LogRetention > 0 {
+			retention = policy.LogRetention
+			own[job.ID] = true
+		}
+		if retention <= 0 || !job.Finished() || job.CompletedAt.After(now.Add(-retention)) {
+			continue
+		}
+		for i := range job.Logs {
+			log := &job.Logs[i]
+			if log.expired {
+				continue
+			}
+			log.data = ""
+			log.expired = true
+			if log.Key == "" {
+				removed++
+			} else if own[job.ID] {
+				expired = append(expired, log.Key)
+			}
+		}
+	}
+	retention := jm.LogRetention
+	jm.mu.Unlock()
+
+	if jm.Storage == nil {
+		return removed
+	}
+	for _, key := range expired {
+		if err := jm.Storage.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			fmt.Printf("Warning: failed to remove log %s: %v\n", key, err)
+			continue
+		}
+		removed++
+	}
+	if retention <= 0 {
+		return removed
+	}
+	cutoff := now.Add(-retention)
+	objects, err := jm.Storage.List(ctx, "jobs/")
+	if err != nil {
+		fmt.Printf("Warning: failed to list job logs: %v\n", err)
+		return removed
+	}
+	for _, object := range objects {
+		if !strings.Contains(object.Key, "/logs/") || object.LastModified.After(cutoff) {
+			continue
+		}
+		if parts := strings.SplitN(object.Key, "/", 3); len(parts) == 3 && own[parts[1]] {
+			continue
+		}
+		if err := jm.Storage.Delete(ctx, object.Key); err != nil {
+			fmt.Printf("Warning: failed to remove log %s: %v\n", object.Key, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+// decodedLen returns how many bytes base64 encoded text decodes to
+func decodedLen(encoded string) int64 {
+	padding := len(encoded) - len(strings.TrimRight(encoded, "="))
+	return int64(base64.StdEncoding.DecodedLen(len(encoded)) - padding)
+}
@@ -0,0 +1,65 @@
+package jobs
+
+import "time"
+
+// Maintenance describes the maintenance mode of a manager
+type Maintenance struct {
+	Enabled bool      `json:"enabled"`
+	Reason  string    `json:"reason,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+
+	// Pending and Running count the jobs still to drain
+	Pending int `json:"pending"`
+	Running int `json:"running"`
+
+	// Drained is set once maintenance is enabled and no jobs are left
+	Drained bool `json:"drained"`
+}
+
+// EnterMaintenance stops intake of new jobs until ExitMaintenance, for
+// draining a host before it is taken down. Unlike Pause, it is not undone by
+// Resume, so the watchdog cannot end it. Jobs that already exist keep
+// running.
+func (jm *Manager) EnterMaintenance(reason string) Maintenance {
+	if reason == "" {
+		reason = "maintenance"
+	}
+	jm.mu.Lock()
+	if jm.maintenanceReason == "" {
+		jm.maintenanceSince = jm.Clock.Now()
+	}
+	jm.maintenanceReason = reason
+	jm.mu.Unlock()
+	return jm.Maintenance()
+}
+
+// ExitMaintenance accepts new jobs again, unless intake is also paused
+func (jm *Manager) ExitMaintenance() Maintenance {
+	jm.mu.Lock()
+	jm.maintenanceReason = ""
+	jm.maintenanceSince = time.Time{}
+	jm.mu.Unlock()
+	return jm.Maintenance()
+}
+
+// Maintenance reports the maintenance mode and the jobs left to drain
+func (jm *Manager) Maintenance() Maintenance {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+
+	m := Maintenance{
+		Enabled: jm.maintenanceReason != "",
+		Reason:  jm.maintenanceReason,
+		Since:   jm.maintenanceSince,
+	}
+	for _, job := range jm.Store.List() {
+		switch job.Status {
+		case "pending":
+			m.Pending++
+		case "running":
+			m.Running++
+		}
+	}
+	m.Drained = m.Enabled && m.Pending == 0 && m.Running == 0
+	return m
+}
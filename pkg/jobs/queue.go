@@ -0,0 +1,117 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"forgeai/pkg/executor"
+	"forgeai/pkg/restricted"
+	"forgeai/pkg/sandbox"
+)
+
+// Queue hands created jobs to workers. Dispatch must arrange for run to be
+// called once, in the background, and return without waiting for the job;
+// the context passed to run bounds the execution. Queues that cannot
+// accept a job return an error.
+type Queue interface {
+	Dispatch(ctx context.Context, job *Job, run func(ctx context.Context)) error
+}
+
+// GoQueue runs every job in its own goroutine as soon as it is
+// dispatched. Manager.Workers limits how many of them execute at once.
+type GoQueue struct{}
+
+// Dispatch starts the job
+func (GoQueue) Dispatch(ctx context.Context, job *Job, run func(ctx context.Context)) error {
+	go run(ctx)
+	return nil
+}
+
+// Dispatch queues a created job to run in the background, bounded by ctx.
+// Jobs the queue refuses are cancelled with its error. Jobs of a session
+// another worker owns are left for that worker to claim, and jobs of a lost
+// session are cancelled with ErrSessionLost.
+func (jm *Manager) Dispatch(ctx context.Context, job *Job) error {
+	if job.Session != "" {
+		local, err := jm.routeSession(job)
+		if err != nil {
+			jm.AbortJob(job.ID, err.Error())
+			return err
+		}
+		if !local {
+			return nil
+		}
+	}
+	return jm.dispatch(ctx, job)
+}
+
+// dispatch hands a job to the queue
+func (jm *Manager) dispatch(ctx context.Context, job *Job) error {
+	job.requireEncryption = jm.policy(job).RequireEncryption
+	err := jm.Queue.Dispatch(ctx, job, func(ctx context.Context) {
+		jm.ExecuteJobContext(ctx, job)
+	})
+	if err != nil {
+		jm.AbortJob(job.ID, fmt.Sprintf("failed to queue job: %v", err))
+		return fmt.Errorf("failed to queue job: %w", err)
+	}
+	return nil
+}
+
+// ExecutorFactory creates the executor of each job. NewExecutor is called
+// with a nil job for the executor that reports the manager's capabilities
+// and runs security self-tests, which should have the default limits.
+type ExecutorFactory interface {
+	NewExecutor(job *Job) sandbox.Executor
+}
+
+// ExecutorFactoryFunc adapts a function to an ExecutorFactory
+type ExecutorFactoryFunc func(job *Job) sandbox.Executor
+
+// NewExecutor calls f
+func (f ExecutorFactoryFunc) NewExecutor(job *Job) sandbox.Executor {
+	return f(job)
+}
+
+// LocalExecutor creates a local executor with the limits, options, and
+// output limits of a job and the manager's workspaces. It is the default
+// executor factory.
+func (jm *Manager) LocalExecutor(job *Job) sandbox.Executor {
+	exec := executor.NewLocalExecutor()
+	exec.Workspaces = jm.Workspaces
+	if job == nil {
+		return exec
+	}
+	exec.Timeout = time.Duration(job.Timeout) * time.Second
+	exec.MemoryLimit = job.MemoryLimit
+	exec.Trace = job.Trace
+	exec.TrackWorkspace = job.TrackWorkspace
+	exec.InlineFiles = job.InlineFiles
+	exec.Profile = job.Profile
+	exec.Flamegraph = job.Flamegraph
+	exec.Coverage = job.Coverage
+	exec.JobID = job.ID
+	exec.Rlimits = job.Rlimits.WithDefaults(job.settings.Rlimits)
+	exec.Output = job.settings.Output
+	exec.MapTracebacks = job.MapTracebacks
+	exec.Fixtures = job.Fixtures
+	exec.Locale = job.Locale
+	if job.Volume != nil && jm.Volumes != nil {
+		exec.Volume = jm.Volumes.Path(*job.Volume)
+	}
+	return exec
+}
+
+// RestrictedExecutor creates an executor of restricted Python with the
+// limits and output limits of a job
+func (jm *Manager) RestrictedExecutor(job *Job) sandbox.Executor {
+	exec := restricted.NewExecutor()
+	if job == nil {
+		return exec
+	}
+	exec.Timeout = time.Duration(job.Timeout) * time.Second
+	exec.MemoryLimit = job.MemoryLimit
+	exec.Output = job.settings.Output
+	return exec
+}
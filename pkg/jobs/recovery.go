@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultHeartbeatInterval is how often running jobs heartbeat by default
+const DefaultHeartbeatInterval = 10 * time.Second
+
+// missedHeartbeats is how many heartbeats a running job may miss before its
+// worker is considered dead
+const missedHeartbeats = 3
+
+// RetryPolicy decides whether jobs interrupted by the failure of their
+// worker run again
+type RetryPolicy struct {
+	// MaxAttempts is how many times a job may start. Interrupted jobs that
+	// started fewer times are queued again; the others finish as
+	// interrupted. Zero and one never retry.
+	MaxAttempts int `json:"max_attempts"`
+}
+
+// Interruption records a failure of the worker that ran a job
+type Interruption struct {
+	Worker  string    `json:"worker,omitempty"`
+	Attempt int       `json:"attempt"`
+	At      time.Time `json:"at"`
+	Reason  string    `json:"reason"`
+}
+
+// heartbeatInterval returns HeartbeatInterval or its default
+func (jm *Manager) heartbeatInterval() time.Duration {
+	if jm.HeartbeatInterval > 0 {
+		return jm.HeartbeatInterval
+	}
+	return DefaultHeartbeatInterval
+}
+
+// Heartbeat records that the jobs running in this process and the sessions
+// of this worker are alive, so that managers sharing the store can tell
+// them from those of a worker that died. Call it every HeartbeatInterval.
+func (jm *Manager) Heartbeat(now time.Time) {
+	jm.heartbeatSessions(now)
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	for _, job := range jm.Store.List() {
+		if job.Status != "running" || job.cancel == nil {
+			continue
+		}
+		job.HeartbeatAt = now
+		if err := jm.Store.Put(job); err != nil {
+			fmt.Printf("Warning: failed to save heartbeat of job %s: %v\n", job.ID, err)
+		}
+	}
+}
+
+// RecoverInterrupted finds running jobs whose worker stopped heartbeating,
+// queues them again when Retry allows another attempt and finishes them as
+// interrupted otherwise; ctx bounds the jobs queued again, like the context
+// of Dispatch. It returns the jobs it recovered. Jobs running in this
+// process are never recovered, so with several replicas only one should
+// call it.
+//
+// The sessions of workers that stopped heartbeating are lost. Their jobs,
+// running or waiting for the worker, finish as interrupted, since running
+// them elsewhere would run them without the session's state.
+func (jm *Manager) RecoverInterrupted(ctx context.Context, now time.Time) []*Job {
+	deadline := now.Add(-missedHeartbeats * jm.heartbeatInterval())
+
+	jm.mu.Lock()
+	var recovered, requeued []*Job
+	for _, job := range jm.recoverSessions(now) {
+		job.Status = "interrupted"
+		job.CompletedAt = now
+		job.Error = jm.sessionLostError(job.Session)
+		jm.logJob(job)
+		jm.markDone(job)
+	}
+	for _, job := range jm.Store.List() {
+		if job.Status != "running" || job.cancel != nil {
+			continue
+		}
+		last := job.HeartbeatAt
+		if last.IsZero() {
+			last = job.StartedAt
+		}
+		if last.After(deadline) {
+			continue
+		}
+
+		job.Interruptions = append(job.Interruptions, Interruption{
+			Worker:  job.Worker,
+			Attempt: job.Attempts,
+			At:      now,
+			Reason:  fmt.Sprintf("no heartbeat since %s", last.UTC().Format(time.RFC3339)),
+		})
+		recovered = append(recovered, job)
+
+		if job.Session != "" {
+			if session, ok := jm.Sessions.GetSession(job.Session); ok && session.Status == SessionActive && session.Worker == job.Worker {
+				jm.loseSession(session, fmt.Sprintf("worker %s stopped responding", job.Worker))
+			}
+			job.Status = "interrupted"
+			job.CompletedAt = now
+			job.Error = jm.sessionLostError(job.Session)
+			jm.logJob(job)
+			jm.markDone(job)
+			continue
+		}
+
+		if job.Attempts < jm.Retry.MaxAttempts {
+			job.Status = "pending"
+			job.Worker = ""
+			job.StartedAt = time.Time{}
+			job.HeartbeatAt = time.Time{}
+			job.Hardware = nil
+			if job.done == nil {
+				// Jobs loaded from a shared store have no waiters yet
+				job.done = make(chan struct{})
+			}
+			jm.update(job)
+			requeued = append(requeued, job)
+			continue
+		}
+
+		job.Status = "interrupted"
+		job.CompletedAt = now
+		job.Error = "worker stopped responding"
+		if job.Worker != "" {
+			job.Error = fmt.Sprintf("worker %s stopped responding", job.Worker)
+		}
+		jm.logJob(job)
+		jm.markDone(job)
+	}
+	jm.mu.Unlock()
+
+	// Dispatch aborts jobs that the queue refuses
+	for _, job := range requeued {
+		jm.Dispatch(ctx, job)
+	}
+	return recovered
+}
@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"fmt"
+	"sort"
+
+	"forgeai/pkg/sandbox"
+)
+
+// ClassRouter is an ExecutorFactory that runs the jobs of each language in
+// an isolation class, so that languages with different risk profiles use
+// different backends
+type ClassRouter struct {
+	// Classes maps the names of isolation classes to the factories of
+	// their executors
+	Classes map[string]ExecutorFactory
+
+	// Languages maps languages to isolation classes. Other languages, and
+	// file jobs, whose language is not known up front, use Default.
+	Languages map[string]string
+	Default   string
+
+	// Classifications maps data classifications to isolation classes,
+	// which run the jobs of a classification whatever their language
+	Classifications map[string]string
+}
+
+// Validate checks that every class the router refers to exists
+func (r *ClassRouter) Validate() error {
+	if _, ok := r.Classes[r.Default]; !ok {
+		return fmt.Errorf("unknown default isolation class %q", r.Default)
+	}
+	languages := make([]string, 0, len(r.Languages))
+	for language := range r.Languages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	for _, language := range languages {
+		if _, ok := r.Classes[r.Languages[language]]; !ok {
+			return fmt.Errorf("unknown isolation class %q for %s", r.Languages[language], language)
+		}
+	}
+	classifications := make([]string, 0, len(r.Classifications))
+	for classification := range r.Classifications {
+		classifications = append(classifications, classification)
+	}
+	sort.Strings(classifications)
+	for _, classification := range classifications {
+		if _, ok := r.Classes[r.Classifications[classification]]; !ok {
+			return fmt.Errorf("unknown isolation class %q for %s data", r.Classifications[classification], classification)
+		}
+	}
+	return nil
+}
+
+// Class returns the isolation class of a language
+func (r *ClassRouter) Class(language string) string {
+	if class, ok := r.Languages[language]; ok {
+		return class
+	}
+	return r.Default
+}
+
+// ForLanguage returns the executor factory of the class of a language
+func (r *ClassRouter) ForLanguage(language string) ExecutorFactory {
+	return r.Classes[r.Class(language)]
+}
+
+// NewExecutor creates an executor in the isolation class of the job's
+// classification or language, or of the default class for a nil job
+func (r *ClassRouter) NewExecutor(job *Job) sandbox.Executor {
+	if job == nil {
+		return r.ForLanguage("").NewExecutor(job)
+	}
+	if class, ok := r.Classifications[job.Classification]; ok {
+		return r.Classes[class].NewExecutor(job)
+	}
+	return r.ForLanguage(job.Language).NewExecutor(job)
+}
+
+// Languages returns the languages the executors of the manager currently
+// support, sorted. With a ClassRouter a language counts when the executor of
+// its class supports it.
+func (jm *Manager) Languages() []string {
+	router, ok := jm.Executors.(*ClassRouter)
+	if !ok {
+		languages := append([]string(nil), jm.Executor().SupportedLanguages()...)
+		sort.Strings(languages)
+		return languages
+	}
+
+	seen := map[string]bool{}
+	var languages []string
+	add := func(exec sandbox.Executor) {
+		for _, language := range exec.SupportedLanguages() {
+			if !seen[language] && router.Class(language) == router.Class("") {
+				seen[language] = true
+				languages = append(languages, language)
+			}
+		}
+	}
+	add(router.ForLanguage("").NewExecutor(nil))
+	for language, class := range router.Languages {
+		exec := router.Classes[class].NewExecutor(nil)
+		if !seen[language] && supports(exec, language) {
+			seen[language] = true
+			languages = append(languages, language)
+		}
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// supports reports whether an executor supports a language
+func supports(exec sandbox.Executor, language string) bool {
+	for _, supported := range exec.SupportedLanguages() {
+		if supported == language {
+			return true
+		}
+	}
+	return false
+}
+
+// LanguageExecutor returns an executor configured like the one that runs
+// jobs of a language, with the default limits. Languages differ only with a
+// ClassRouter.
+func (jm *Manager) LanguageExecutor(language string) sandbox.Executor {
+	if router, ok := jm.Executors.(*ClassRouter); ok {
+		return router.ForLanguage(language).NewExecutor(nil)
+	}
+	return jm.Executor()
+}
@@ -0,0 +1,349 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSessionLost is returned for jobs of a session whose worker stopped
+// responding, taking the session's state with it
+var ErrSessionLost = errors.New("session was lost")
+
+// ErrSessionNotFound is returned for unknown session IDs
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session statuses
+const (
+	SessionActive = "active"
+	SessionLost   = "lost"
+)
+
+// DefaultSessionTTL is how long sessions are kept after their last job
+const DefaultSessionTTL = 24 * time.Hour
+
+// Session is a series of jobs that keep state on the worker that ran the
+// first of them, such as files in a volume on that worker's disk. Later
+// jobs of the session run on the same worker. A session whose worker stops
+// heartbeating is lost; its jobs fail rather than run without the state.
+// Sessions are forgotten SessionTTL after their last job.
+type Session struct {
+	ID          string    `json:"id"`
+	Worker      string    `json:"worker"`
+	Status      string    `json:"status"`
+	Jobs        int       `json:"jobs"`
+	CreatedAt   time.Time `json:"created_at"`
+	UsedAt      time.Time `json:"used_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	Reason      string    `json:"reason,omitempty"`
+}
+
+// SessionStore holds sessions. Replicas that share a job store must share
+// the session store too.
+type SessionStore interface {
+	// CreateSession adds a session unless one with its ID exists and
+	// returns the session stored under the ID
+	CreateSession(session *Session) (*Session, error)
+
+	// PutSession updates a session
+	PutSession(session *Session) error
+
+	// GetSession returns a session by ID
+	GetSession(id string) (*Session, bool)
+
+	// ListSessions returns all sessions, in no particular order
+	ListSessions() []*Session
+
+	// DeleteSession removes a session
+	DeleteSession(id string) error
+}
+
+// MemorySessionStore keeps sessions in memory for the life of the process.
+// It stores and returns copies, like a store shared by replicas would.
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewMemorySessionStore creates an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]*Session)}
+}
+
+// CreateSession adds a session unless one with its ID exists
+func (s *MemorySessionStore) CreateSession(session *Session) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.sessions[session.ID]; ok {
+		stored := *existing
+		return &stored, nil
+	}
+	stored := *session
+	s.sessions[session.ID] = &stored
+	return session, nil
+}
+
+// PutSession updates a session
+func (s *MemorySessionStore) PutSession(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *session
+	s.sessions[session.ID] = &stored
+	return nil
+}
+
+// GetSession returns a session by ID
+func (s *MemorySessionStore) GetSession(id string) (*Session, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	stored := *session
+	return &stored, true
+}
+
+// ListSessions returns all sessions
+func (s *MemorySessionStore) ListSessions() []*Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sessions := make([]*Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		stored := *session
+		sessions = append(sessions, &stored)
+	}
+	return sessions
+}
+
+// DeleteSession removes a session
+func (s *MemorySessionStore) DeleteSession(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// SessionPollInterval is how often workers claim the session jobs that
+// other replicas handed to them
+const SessionPollInterval = time.Second
+
+var sessionIDRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// ValidateSession checks the syntax of a session ID
+func ValidateSession(id string) error {
+	if !sessionIDRe.MatchString(id) {
+		return fmt.Errorf("invalid session: %q", id)
+	}
+	return nil
+}
+
+// SessionKey scopes the ID of a session to its tenant, so that tenants
+// choosing the same ID get sessions of their own. Jobs name their session,
+// and sessions are stored, by key.
+func SessionKey(tenant, id string) string {
+	if tenant == "" {
+		return id
+	}
+	return tenant + "/" + id
+}
+
+// SessionID returns the ID of the session of a key, without its tenant
+func SessionID(key string) string {
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
+// sessionTTL returns SessionTTL or its default
+func (jm *Manager) sessionTTL() time.Duration {
+	if jm.SessionTTL > 0 {
+		return jm.SessionTTL
+	}
+	return DefaultSessionTTL
+}
+
+// routeSession binds a new session to this worker and reports whether a job
+// of the session runs here. Jobs of sessions that another live worker owns
+// are handed to it with Affinity; jobs of lost sessions fail with
+// ErrSessionLost.
+func (jm *Manager) routeSession(job *Job) (local bool, err error) {
+	now := jm.Clock.Now()
+	jm.sessionMu.Lock()
+	session, err := jm.Sessions.CreateSession(&Session{
+		ID:          job.Session,
+		Worker:      jm.Worker,
+		Status:      SessionActive,
+		CreatedAt:   now,
+		HeartbeatAt: now,
+	})
+	if err != nil {
+		jm.sessionMu.Unlock()
+		return false, fmt.Errorf("failed to save session %s: %w", job.Session, err)
+	}
+	if session.Status == SessionActive && session.Worker != jm.Worker && jm.sessionStale(session, now) {
+		jm.loseSession(session, fmt.Sprintf("worker %s stopped responding", session.Worker))
+	}
+	if session.Status == SessionLost {
+		jm.sessionMu.Unlock()
+		return false, fmt.Errorf("%w: %s", ErrSessionLost, session.Reason)
+	}
+	session.Jobs++
+	session.UsedAt = now
+	err = jm.Sessions.PutSession(session)
+	jm.sessionMu.Unlock()
+	if err != nil {
+		return false, fmt.Errorf("failed to save session %s: %w", job.Session, err)
+	}
+
+	if session.Worker == jm.Worker {
+		return true, nil
+	}
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	job.Affinity = session.Worker
+	jm.update(job)
+	return false, nil
+}
+
+// sessionStale reports whether the worker of a session missed its
+// heartbeats
+func (jm *Manager) sessionStale(session *Session, now time.Time) bool {
+	return session.HeartbeatAt.Before(now.Add(-missedHeartbeats * jm.heartbeatInterval()))
+}
+
+// loseSession marks a session lost. The caller must hold jm.sessionMu.
+func (jm *Manager) loseSession(session *Session, reason string) {
+	session.Status = SessionLost
+	session.Reason = reason
+	if err := jm.Sessions.PutSession(session); err != nil {
+		fmt.Printf("Warning: failed to save session %s: %v\n", session.ID, err)
+	}
+}
+
+// sessionLostError describes the failure of a job of a lost session
+func (jm *Manager) sessionLostError(id string) string {
+	reason := "its worker stopped responding"
+	if session, ok := jm.Sessions.GetSession(id); ok && session.Reason != "" {
+		reason = session.Reason
+	}
+	return fmt.Sprintf("session %s was lost: %s", SessionID(id), reason)
+}
+
+// GetSession returns a session by ID
+func (jm *Manager) GetSession(id string) (*Session, bool) {
+	return jm.Sessions.GetSession(id)
+}
+
+// EndSession forgets a session, so that its ID starts a new session on the
+// worker that runs its next job
+func (jm *Manager) EndSession(id string) error {
+	jm.sessionMu.Lock()
+	defer jm.sessionMu.Unlock()
+	if _, ok := jm.Sessions.GetSession(id); !ok {
+		return ErrSessionNotFound
+	}
+	return jm.Sessions.DeleteSession(id)
+}
+
+// ClaimSessionJobs dispatches the pending jobs that other replicas handed to
+// this worker because it owns their session, and returns them. Call it
+// every SessionPollInterval; ctx bounds the claimed jobs, like the context
+// of Dispatch.
+func (jm *Manager) ClaimSessionJobs(ctx context.Context) []*Job {
+	jm.mu.Lock()
+	var claimed []*Job
+	for _, job := range jm.Store.List() {
+		if job.Status != "pending" || job.Affinity == "" || job.Affinity != jm.Worker {
+			continue
+		}
+		job.Affinity = ""
+		if job.done == nil {
+			// Jobs loaded from a shared store have no waiters yet
+			job.done = make(chan struct{})
+		}
+		jm.update(job)
+		claimed = append(claimed, job)
+	}
+	jm.mu.Unlock()
+
+	// Oldest first, so that a session's jobs run in the order submitted
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].CreatedAt.Before(claimed[j].CreatedAt) })
+	for _, job := range claimed {
+		jm.dispatch(ctx, job)
+	}
+	return claimed
+}
+
+// heartbeatSessions records that the sessions of this worker are alive and
+// forgets the sessions of any worker that ran no job for SessionTTL. It
+// does not need jm.mu, so jobs are not held up by a slow session store.
+func (jm *Manager) heartbeatSessions(now time.Time) {
+	jm.sessionMu.Lock()
+	defer jm.sessionMu.Unlock()
+	expired := now.Add(-jm.sessionTTL())
+	for _, session := range jm.Sessions.ListSessions() {
+		usedAt := session.UsedAt
+		if usedAt.IsZero() {
+			usedAt = session.CreatedAt
+		}
+		if usedAt.Before(expired) {
+			if err := jm.Sessions.DeleteSession(session.ID); err != nil {
+				fmt.Printf("Warning: failed to delete expired session %s: %v\n", session.ID, err)
+			}
+			continue
+		}
+		if session.Worker != jm.Worker || session.Status != SessionActive {
+			continue
+		}
+		session.HeartbeatAt = now
+		if err := jm.Sessions.PutSession(session); err != nil {
+			fmt.Printf("Warning: failed to save heartbeat of session %s: %v\n", session.ID, err)
+		}
+	}
+}
+
+// interruptSessionJob marks the session of a job lost, since the worker
+// that held its state restarted, and finishes the job as interrupted
+func (jm *Manager) interruptSessionJob(job *Job) {
+	jm.sessionMu.Lock()
+	if session, ok := jm.Sessions.GetSession(job.Session); ok && session.Status == SessionActive {
+		jm.loseSession(session, fmt.Sprintf("worker %s restarted", session.Worker))
+	}
+	jm.sessionMu.Unlock()
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	job.Status = "interrupted"
+	job.CompletedAt = jm.Clock.Now()
+	job.Error = jm.sessionLostError(job.Session)
+	jm.logJob(job)
+	jm.markDone(job)
+}
+
+// recoverSessions marks the sessions of workers that stopped heartbeating
+// lost and returns the pending jobs handed to those workers, which must
+// not run elsewhere. The caller must hold jm.mu.
+func (jm *Manager) recoverSessions(now time.Time) []*Job {
+	jm.sessionMu.Lock()
+	for _, session := range jm.Sessions.ListSessions() {
+		if session.Status == SessionActive && session.Worker != jm.Worker && jm.sessionStale(session, now) {
+			jm.loseSession(session, fmt.Sprintf("worker %s stopped responding", session.Worker))
+		}
+	}
+	jm.sessionMu.Unlock()
+
+	var orphaned []*Job
+	for _, job := range jm.Store.List() {
+		if job.Status != "pending" || job.Affinity == "" {
+			continue
+		}
+		if session, ok := jm.Sessions.GetSession(job.Session); !ok || session.Status == SessionLost {
+			orphaned = append(orphaned, job)
+		}
+	}
+	return orphaned
+}
@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"time"
+
+	"forgeai/pkg/sandbox"
+)
+
+// Settings are the defaults of new jobs that can change while jobs run, see
+// Reconfigure. They mirror the manager fields of the same names.
+type Settings struct {
+	Rlimits      sandbox.Rlimits
+	Locale       sandbox.Locale
+	Output       sandbox.OutputLimits
+	InlineOutput int
+	LogRetention time.Duration
+}
+
+// Settings returns the settings of new jobs
+func (jm *Manager) Settings() Settings {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	return jm.settings()
+}
+
+// settings returns the settings of new jobs. The caller must hold jm.mu.
+func (jm *Manager) settings() Settings {
+	return Settings{
+		Rlimits:      jm.Rlimits,
+		Locale:       jm.Locale,
+		Output:       jm.Output,
+		InlineOutput: jm.InlineOutput,
+		LogRetention: jm.LogRetention,
+	}
+}
+
+// Reconfigure atomically replaces the settings of jobs created from now on
+// and returns the new configuration generation. Existing jobs, running or
+// not, keep the settings they were created with.
+func (jm *Manager) Reconfigure(settings Settings) int64 {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.Rlimits = settings.Rlimits.WithDefaults(sandbox.DefaultRlimits())
+	jm.Locale = settings.Locale.WithDefaults(sandbox.DefaultLocale())
+	jm.Output = settings.Output
+	jm.InlineOutput = settings.InlineOutput
+	jm.LogRetention = settings.LogRetention
+	jm.reconfigured++
+	return jm.reconfigured + 1
+}
+
+// Generation returns the configuration generation of new jobs. It starts
+// at 1 and grows with every Reconfigure.
+func (jm *Manager) Generation() int64 {
+	jm.mu.RLock()
+	defer jm.mu.RUnlock()
+	return jm.reconfigured + 1
+}
+
+// capture records the current settings on a new job. The caller must hold
+// jm.mu.
+func (jm *Manager) capture(job *Job) {
+	if job.ConfigGeneration != 0 {
+		return
+	}
+	job.ConfigGeneration = jm.reconfigured + 1
+	if job.Classification == "" {
+		job.Classification = jm.defaultClassification()
+	}
+	job.settings = jm.settings()
+	job.Rlimits = job.Rlimits.WithDefaults(jm.Rlimits)
+	job.Locale = job.Locale.WithDefaults(jm.Locale)
+}
@@ -0,0 +1,475 @@
+package jobs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"forgeai/pkg/envelope"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sinks"
+	"forgeai/pkg/volumes"
+)
+
+// DefaultSpillThreshold is how many waiting jobs a SpillQueue holds in
+// memory when Threshold is zero
+const DefaultSpillThreshold = 1000
+
+// ErrQueueClosed is returned by a closed SpillQueue
+var ErrQueueClosed = errors.New("queue is closed")
+
+// SpillQueue is a Queue that runs jobs in submission order on a fixed
+// number of workers. Up to Threshold waiting jobs are held in memory; later
+// ones are written to a spill file in Dir and their code is dropped from
+// memory until a worker picks them up, which bounds memory during bursts
+// of submissions. Spilled jobs that have not started survive restarts, see
+// Recover.
+type SpillQueue struct {
+	// Dir holds the spill file and its read position
+	Dir string
+
+	// Threshold is how many waiting jobs are held in memory;
+	// DefaultSpillThreshold when zero
+	Threshold int
+
+	// Workers is how many jobs are handed out at once; the number of CPUs
+	// when zero. Manager.Workers still limits how many execute.
+	Workers int
+
+	// Keys, when set, encrypt the code of spilled jobs. Keys that wrapped
+	// the code of jobs still in the file must stay available.
+	Keys envelope.KeyProvider
+
+	mu      sync.Mutex
+	ready   *sync.Cond
+	started bool
+	closed  bool
+
+	// waiting holds the jobs in submission order; spilled ones keep only
+	// the offset of their record
+	waiting  []*queued
+	inMemory int
+
+	// file is the spill file; records before pos have been read back
+	file *os.File
+	size int64
+	pos  int64
+}
+
+// queued is a waiting job
+type queued struct {
+	ctx     context.Context
+	job     *Job
+	run     func(ctx context.Context)
+	spilled bool
+	offset  int64
+	length  int64
+}
+
+// spillRecord is a spilled job in the spill file
+type spillRecord struct {
+	ID             string            `json:"id"`
+	Language       string            `json:"language,omitempty"`
+	Code           string            `json:"code,omitempty"`
+	SealedCode     []byte            `json:"sealed_code,omitempty"`
+	FilePath       string            `json:"file_path,omitempty"`
+	Template       string            `json:"template,omitempty"`
+	ParentID       string            `json:"parent_id,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Classification string            `json:"classification,omitempty"`
+	Timeout        int               `json:"timeout"`
+	MemoryLimit    int               `json:"memory_limit"`
+	NetworkAccess  bool              `json:"network_access,omitempty"`
+	Trace          bool              `json:"trace,omitempty"`
+	TrackWorkspace bool              `json:"track_workspace,omitempty"`
+	InlineFiles    int64             `json:"inline_files,omitempty"`
+	Profile        bool              `json:"profile,omitempty"`
+	Flamegraph     bool              `json:"flamegraph,omitempty"`
+	Coverage       bool              `json:"coverage,omitempty"`
+	Rlimits        sandbox.Rlimits   `json:"rlimits"`
+	MapTracebacks  bool              `json:"map_tracebacks,omitempty"`
+	Fixtures       []sandbox.Fixture `json:"fixtures,omitempty"`
+	Volume         *volumes.Ref      `json:"volume,omitempty"`
+	Session        string            `json:"session,omitempty"`
+	Locale         sandbox.Locale    `json:"locale"`
+	Sink           *sinks.Target     `json:"sink,omitempty"`
+	Attempts       int               `json:"attempts,omitempty"`
+	Interruptions  []Interruption    `json:"interruptions,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// SpillStats describe the jobs waiting in a SpillQueue
+type SpillStats struct {
+	InMemory  int   `json:"in_memory"`
+	Spilled   int   `json:"spilled"`
+	SpillSize int64 `json:"spill_bytes"`
+}
+
+const (
+	spillFile     = "spill.jsonl"
+	spillPosition = "spill.pos"
+)
+
+// Dispatch queues a job
+func (q *SpillQueue) Dispatch(ctx context.Context, job *Job, run func(ctx context.Context)) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.start(); err != nil {
+		return err
+	}
+
+	entry := &queued{ctx: ctx, job: job, run: run}
+	threshold := q.Threshold
+	if threshold <= 0 {
+		threshold = DefaultSpillThreshold
+	}
+	if q.inMemory >= threshold && (q.Keys != nil || !job.requireEncryption) {
+		if err := q.spill(entry); err != nil {
+			return err
+		}
+	} else {
+		q.inMemory++
+	}
+	q.waiting = append(q.waiting, entry)
+	q.ready.Signal()
+	return nil
+}
+
+// Stats returns the numbers of waiting jobs
+func (q *SpillQueue) Stats() SpillStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return SpillStats{
+		InMemory:  q.inMemory,
+		Spilled:   len(q.waiting) - q.inMemory,
+		SpillSize: q.size - q.pos,
+	}
+}
+
+// Close stops handing out jobs and closes the spill file. Spilled jobs
+// stay in the file for Recover.
+func (q *SpillQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	if q.ready != nil {
+		q.ready.Broadcast()
+	}
+	if q.file == nil {
+		return nil
+	}
+	return q.file.Close()
+}
+
+// Recover dispatches the spilled jobs that had not started when the queue
+// was last used, in their original order, and returns how many there were.
+// Call it before dispatching new jobs. Jobs that were held in memory are
+// lost with the process. Jobs of sessions are interrupted and their
+// sessions lost, since the state they would build on went with the process.
+func (q *SpillQueue) Recover(jm *Manager) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.start(); err != nil {
+		return 0, err
+	}
+	entries, err := q.unread()
+	if err != nil {
+		return 0, fmt.Errorf("failed to recover spilled jobs: %w", err)
+	}
+
+	// The records stay in the spill file until workers read them back
+	for _, entry := range entries {
+		job := entry.job
+		entry.ctx = context.Background()
+		if job.Session != "" {
+			// The record is still read back, to advance past it
+			jm.interruptSessionJob(job)
+			entry.run = func(context.Context) {}
+			q.waiting = append(q.waiting, entry)
+			continue
+		}
+		jm.mu.Lock()
+		jm.update(job)
+		jm.mu.Unlock()
+		entry.run = func(ctx context.Context) {
+			jm.ExecuteJobContext(ctx, job)
+		}
+		q.waiting = append(q.waiting, entry)
+	}
+	q.ready.Broadcast()
+	return len(entries), nil
+}
+
+// start opens the spill file and starts the workers. The caller must hold
+// q.mu.
+func (q *SpillQueue) start() error {
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.started {
+		return nil
+	}
+
+	if err := os.MkdirAll(q.Dir, 0700); err != nil {
+		return fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(q.Dir, spillFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	q.file = file
+	q.size = info.Size()
+	if data, err := os.ReadFile(filepath.Join(q.Dir, spillPosition)); err == nil {
+		q.pos, _ = strconv.ParseInt(string(bytes.TrimSpace(data)), 10, 64)
+	}
+	if q.pos > q.size {
+		q.pos = q.size
+	}
+
+	q.ready = sync.NewCond(&q.mu)
+	workers := q.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	q.started = true
+	return nil
+}
+
+// work runs waiting jobs until the queue is closed
+func (q *SpillQueue) work() {
+	for {
+		q.mu.Lock()
+		for len(q.waiting) == 0 && !q.closed {
+			q.ready.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		entry := q.waiting[0]
+		q.waiting[0] = nil
+		q.waiting = q.waiting[1:]
+		var err error
+		if entry.spilled {
+			err = q.restore(entry)
+		} else {
+			q.inMemory--
+		}
+		q.mu.Unlock()
+
+		// Without its code the job fails to run rather than staying pending
+		if err != nil {
+			fmt.Printf("Warning: failed to read spilled job %s: %v\n", entry.job.ID, err)
+		}
+		entry.run(entry.ctx)
+	}
+}
+
+// spill writes a job to the spill file and drops its code from memory.
+// The caller must hold q.mu.
+func (q *SpillQueue) spill(entry *queued) error {
+	rec := newSpillRecord(entry.job)
+	if q.Keys != nil {
+		sealed, err := envelope.Seal(context.Background(), q.Keys, []byte(rec.Code))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt spilled job: %w", err)
+		}
+		rec.Code, rec.SealedCode = "", sealed
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := q.file.WriteAt(data, q.size); err != nil {
+		return fmt.Errorf("failed to spill job: %w", err)
+	}
+
+	entry.spilled = true
+	entry.offset = q.size
+	entry.length = int64(len(data))
+	q.size += entry.length
+
+	// Pending jobs' code is only read once they run
+	entry.job.Code = ""
+	return nil
+}
+
+// restore reads the code of a spilled job back and advances the read
+// position. The caller must hold q.mu.
+func (q *SpillQueue) restore(entry *queued) error {
+	data := make([]byte, entry.length)
+	if _, err := q.file.ReadAt(data, entry.offset); err != nil {
+		return err
+	}
+	var rec spillRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+	code, err := q.code(rec)
+	if err != nil {
+		return err
+	}
+	entry.job.Code = code
+
+	q.pos = entry.offset + entry.length
+	if q.pos == q.size {
+		return q.reset()
+	}
+	return q.savePosition()
+}
+
+// code returns the code of a record, decrypting it if it was sealed
+func (q *SpillQueue) code(rec spillRecord) (string, error) {
+	if rec.SealedCode == nil {
+		return rec.Code, nil
+	}
+	if q.Keys == nil {
+		return "", fmt.Errorf("spilled code is encrypted but no encryption keys are configured")
+	}
+	code, err := envelope.Open(context.Background(), q.Keys, rec.SealedCode)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt spilled code: %w", err)
+	}
+	return string(code), nil
+}
+
+// unread recreates the jobs of the records after the read position, with
+// their code left in the file. A record cut short by a crash is dropped.
+// The caller must hold q.mu.
+func (q *SpillQueue) unread() ([]*queued, error) {
+	var entries []*queued
+	reader := bufio.NewReader(io.NewSectionReader(q.file, q.pos, q.size-q.pos))
+	offset := q.pos
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rec spillRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("invalid record at offset %d: %w", offset, err)
+		}
+		job := rec.job()
+		job.Code = ""
+		entries = append(entries, &queued{job: job, spilled: true, offset: offset, length: int64(len(line))})
+		offset += int64(len(line))
+	}
+
+	// Drop a partial last record
+	if offset < q.size {
+		if err := q.file.Truncate(offset); err != nil {
+			return nil, err
+		}
+		q.size = offset
+	}
+	return entries, nil
+}
+
+// reset empties the spill file once every record was read back. The
+// caller must hold q.mu.
+func (q *SpillQueue) reset() error {
+	if err := q.file.Truncate(0); err != nil {
+		return err
+	}
+	q.size, q.pos = 0, 0
+	return q.savePosition()
+}
+
+// savePosition records the read position. The caller must hold q.mu.
+func (q *SpillQueue) savePosition() error {
+	path := filepath.Join(q.Dir, spillPosition)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(q.pos, 10)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// newSpillRecord describes a job for the spill file
+func newSpillRecord(job *Job) spillRecord {
+	return spillRecord{
+		ID:             job.ID,
+		Language:       job.Language,
+		Code:           job.Code,
+		FilePath:       job.FilePath,
+		Template:       job.Template,
+		ParentID:       job.ParentID,
+		Labels:         job.Labels,
+		Classification: job.Classification,
+		Timeout:        job.Timeout,
+		MemoryLimit:    job.MemoryLimit,
+		NetworkAccess:  job.NetworkAccess,
+		Trace:          job.Trace,
+		TrackWorkspace: job.TrackWorkspace,
+		InlineFiles:    job.InlineFiles,
+		Profile:        job.Profile,
+		Flamegraph:     job.Flamegraph,
+		Coverage:       job.Coverage,
+		Rlimits:        job.Rlimits,
+		MapTracebacks:  job.MapTracebacks,
+		Fixtures:       job.Fixtures,
+		Volume:         job.Volume,
+		Session:        job.Session,
+		Locale:         job.Locale,
+		Sink:           job.Sink,
+		Attempts:       job.Attempts,
+		Interruptions:  job.Interruptions,
+		CreatedAt:      job.CreatedAt,
+	}
+}
+
+// job recreates a pending job from its record
+func (rec spillRecord) job() *Job {
+	var job *Job
+	if rec.FilePath != "" {
+		job = newFileJob(rec.FilePath, rec.CreatedAt)
+	} else {
+		job = newCodeJob(rec.Language, rec.Code, rec.CreatedAt)
+	}
+	job.ID = rec.ID
+	job.Template = rec.Template
+	job.ParentID = rec.ParentID
+	job.Labels = rec.Labels
+	job.Classification = rec.Classification
+	job.Timeout = rec.Timeout
+	job.MemoryLimit = rec.MemoryLimit
+	job.NetworkAccess = rec.NetworkAccess
+	job.Trace = rec.Trace
+	job.TrackWorkspace = rec.TrackWorkspace
+	job.InlineFiles = rec.InlineFiles
+	job.Profile = rec.Profile
+	job.Flamegraph = rec.Flamegraph
+	job.Coverage = rec.Coverage
+	job.Rlimits = rec.Rlimits
+	job.MapTracebacks = rec.MapTracebacks
+	job.Fixtures = rec.Fixtures
+	job.Volume = rec.Volume
+	job.Session = rec.Session
+	job.Locale = rec.Locale
+	job.Sink = rec.Sink
+	job.Attempts = rec.Attempts
+	job.Interruptions = rec.Interruptions
+	return job
+}
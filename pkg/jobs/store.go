@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Store holds the jobs of a manager. Jobs are shared with the manager,
+// which changes them in place and calls Put again whenever their status
+// changes, so persistent stores can write them through.
+type Store interface {
+	// Put adds or updates a job
+	Put(job *Job) error
+
+	// Get returns a job by ID
+	Get(id string) (*Job, bool)
+
+	// List returns all jobs, in no particular order
+	List() []*Job
+}
+
+// MemoryStore keeps jobs in memory for the life of the process
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]*Job)}
+}
+
+// Put adds or updates a job
+func (s *MemoryStore) Put(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+// Get returns a job by ID
+func (s *MemoryStore) Get(id string) (*Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+// List returns all jobs
+func (s *MemoryStore) List() []*Job {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// Clock tells the time recorded on jobs and events
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+// Now returns the current time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// update saves a job whose status changed and tells subscribers about it.
+// New jobs get the current settings. The caller must hold jm.mu.
+func (jm *Manager) update(job *Job) {
+	jm.capture(job)
+	if err := jm.Store.Put(job); err != nil {
+		fmt.Printf("Warning: failed to save job %s: %v\n", job.ID, err)
+	}
+	jm.publish(job)
+}
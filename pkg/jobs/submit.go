@@ -0,0 +1,215 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sinks"
+	"forgeai/pkg/volumes"
+)
+
+// ErrNotFound is returned for unknown job IDs
+var ErrNotFound = errors.New("job not found")
+
+// ErrPaused is returned when intake is paused
+var ErrPaused = errors.New("job intake is paused")
+
+// ErrQuarantined is returned when submitted code is quarantined
+var ErrQuarantined = errors.New("code is quarantined")
+
+// ErrUnenforceable is returned in strict mode when a job requires isolation
+// the executor cannot enforce
+var ErrUnenforceable = errors.New("requested isolation cannot be enforced")
+
+// UnenforceableError lists the isolation guarantees a backend cannot meet
+type UnenforceableError struct {
+	Backend string
+	Unmet   []string
+}
+
+func (e *UnenforceableError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrUnenforceable, strings.Join(e.Unmet, "; "))
+}
+
+// Unwrap makes the error match ErrUnenforceable
+func (e *UnenforceableError) Unwrap() error {
+	return ErrUnenforceable
+}
+
+// Spec describes a job to submit
+type Spec struct {
+	// Language and Code select a code job; FilePath selects a file job
+	Language string
+	Code     string
+	FilePath string
+
+	// Timeout is in seconds and MemoryLimit in MB; zero uses the defaults
+	Timeout       int
+	MemoryLimit   int
+	NetworkAccess bool
+
+	Trace          bool
+	TrackWorkspace bool
+	InlineFiles    int64
+
+	// Profile reports peak memory and CPU use; Flamegraph also records a
+	// flamegraph artifact
+	Profile    bool
+	Flamegraph bool
+
+	// Coverage reports how much of the program ran
+	Coverage bool
+
+	// Rlimits override the manager's resource limits where set
+	Rlimits sandbox.Rlimits
+
+	// MapTracebacks reports the file of submitted code as
+	// "<submitted code>" in the output of code jobs
+	MapTracebacks bool
+
+	// Fixtures are mounted read-only into the sandbox
+	Fixtures []sandbox.Fixture
+
+	// Volume is the persistent volume mounted into the sandbox
+	Volume *volumes.Ref
+
+	// Session runs the job on the worker that ran the first job of the
+	// session
+	Session string
+
+	// Locale overrides the manager's time zone and locale where set
+	Locale sandbox.Locale
+
+	// Sink receives the logs and artifacts of the finished job
+	Sink *sinks.Target
+
+	Template string
+	ParentID string
+	Labels   map[string]string
+
+	// Classification is the data classification of the job, which selects
+	// its policy; the default classification when empty
+	Classification string
+
+	// Require lists isolation guarantees that must be enforced when the
+	// manager is strict
+	Require sandbox.Requirements
+}
+
+// Submit creates a job from spec and runs it in the background. ctx bounds
+// the execution of the job, not just the call. Within DedupWindow, an
+// identical code spec returns the job of the first one instead.
+func (jm *Manager) Submit(ctx context.Context, spec Spec) (*Job, error) {
+	if reason, paused := jm.Paused(); paused {
+		return nil, fmt.Errorf("%w: %s", ErrPaused, reason)
+	}
+	if err := ValidateLabels(spec.Labels); err != nil {
+		return nil, err
+	}
+	if err := spec.Rlimits.Validate(); err != nil {
+		return nil, err
+	}
+	if err := spec.Locale.Validate(); err != nil {
+		return nil, err
+	}
+	if spec.Session != "" {
+		if err := ValidateSession(spec.Session); err != nil {
+			return nil, err
+		}
+	}
+	classification, err := jm.Classify(spec.Classification)
+	if err != nil {
+		return nil, err
+	}
+	if err := jm.CheckRequirements(spec.Language, spec.Require); err != nil {
+		return nil, err
+	}
+	if spec.ParentID != "" {
+		if _, ok := jm.GetJob(spec.ParentID); !ok {
+			return nil, fmt.Errorf("parent job %s: %w", spec.ParentID, ErrNotFound)
+		}
+	}
+
+	var job *Job
+	var fingerprint string
+	switch {
+	case spec.Code != "" && spec.FilePath != "":
+		return nil, fmt.Errorf("code and file path are mutually exclusive")
+	case spec.Code != "":
+		if spec.Language == "" {
+			return nil, fmt.Errorf("language is required")
+		}
+		if entry, ok := jm.IsQuarantined(spec.Language, spec.Code); ok {
+			return nil, fmt.Errorf("%w: %s", ErrQuarantined, entry.Reason)
+		}
+		job = newCodeJob(spec.Language, spec.Code, jm.Clock.Now())
+		// Jobs of a session depend on its state, so they are never shared
+		if spec.Session == "" {
+			fingerprint = Fingerprint(spec)
+		}
+	case spec.FilePath != "":
+		job = newFileJob(spec.FilePath, jm.Clock.Now())
+	default:
+		return nil, fmt.Errorf("code or file path is required")
+	}
+
+	if spec.Timeout > 0 {
+		job.Timeout = spec.Timeout
+	}
+	if spec.MemoryLimit > 0 {
+		job.MemoryLimit = spec.MemoryLimit
+	}
+	job.NetworkAccess = spec.NetworkAccess
+	job.Trace = spec.Trace
+	job.TrackWorkspace = spec.TrackWorkspace
+	job.InlineFiles = spec.InlineFiles
+	job.Profile = spec.Profile
+	job.Flamegraph = spec.Flamegraph
+	job.Coverage = spec.Coverage
+	job.Rlimits = spec.Rlimits
+	job.MapTracebacks = spec.MapTracebacks
+	job.Fixtures = spec.Fixtures
+	job.Volume = spec.Volume
+	job.Session = spec.Session
+	job.Locale = spec.Locale
+	job.Sink = spec.Sink
+	job.Template = spec.Template
+	job.ParentID = spec.ParentID
+	job.Labels = spec.Labels
+	job.Classification = classification
+
+	jm.mu.Lock()
+	if shared, ok := jm.coalesce(fingerprint); ok {
+		jm.mu.Unlock()
+		return shared, nil
+	}
+	jm.update(job)
+	jm.remember(fingerprint, job)
+	jm.mu.Unlock()
+
+	if err := jm.Dispatch(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Wait blocks until a job reaches a terminal state or ctx is done
+func (jm *Manager) Wait(ctx context.Context, id string) (*Job, error) {
+	job, ok := jm.GetJob(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if job.done == nil {
+		return job, nil
+	}
+
+	select {
+	case <-job.done:
+		return job, nil
+	case <-ctx.Done():
+		return job, ctx.Err()
+	}
+}
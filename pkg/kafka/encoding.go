@@ -0,0 +1,121 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errShortResponse is returned for responses that end early
+var errShortResponse = errors.New("kafka: short response")
+
+// writer encodes the primitive types of the Kafka protocol
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) int8(v int8) {
+	w.buf = append(w.buf, byte(v))
+}
+
+func (w *writer) int16(v int16) {
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(v))
+}
+
+func (w *writer) int32(v int32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(v))
+}
+
+func (w *writer) int64(v int64) {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(v))
+}
+
+func (w *writer) bool(v bool) {
+	if v {
+		w.int8(1)
+	} else {
+		w.int8(0)
+	}
+}
+
+// varint writes a zigzag encoded variable length integer
+func (w *writer) varint(v int64) {
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *writer) string(s string) {
+	w.int16(int16(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *writer) bytes(b []byte) {
+	w.int32(int32(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// reader decodes the primitive types of the Kafka protocol. Reading past
+// the end sets err and returns zero values.
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil || n < 0 || len(r.buf) < n {
+		r.err = errShortResponse
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) int16() int16 {
+	b := r.take(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (r *reader) int32() int32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (r *reader) int64() int64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (r *reader) bool() bool {
+	b := r.take(1)
+	return b != nil && b[0] != 0
+}
+
+func (r *reader) string() string {
+	n := r.int16()
+	return string(r.take(int(n)))
+}
+
+func (r *reader) nullableString() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.take(int(n)))
+}
+
+func (r *reader) int32Array() []int32 {
+	n := r.int32()
+	var values []int32
+	for i := int32(0); i < n && r.err == nil; i++ {
+		values = append(values, r.int32())
+	}
+	return values
+}
@@ -0,0 +1,568 @@
+// Package kafka is a minimal Kafka producer. It publishes records to the
+// partition leaders of topics with the Kafka protocol (brokers 1.0 or
+// later), optionally over TLS and with SASL/PLAIN authentication, and
+// without consumer groups, transactions, or compression.
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// API keys and the versions of them the producer speaks
+const (
+	apiProduce          = 0
+	apiMetadata         = 3
+	apiSaslHandshake    = 17
+	apiSaslAuthenticate = 36
+
+	produceVersion          = 3
+	metadataVersion         = 4
+	saslHandshakeVersion    = 1
+	saslAuthenticateVersion = 0
+)
+
+// Acknowledgements of produced records
+const (
+	// AcksAll waits for all in-sync replicas to have the record
+	AcksAll = -1
+
+	// AcksLeader waits for the partition leader only
+	AcksLeader = 1
+)
+
+// maxResponseSize bounds the responses the producer reads
+const maxResponseSize = 64 << 20
+
+// Error codes that a metadata refresh may resolve
+const (
+	errUnknownTopicOrPartition = 3
+	errLeaderNotAvailable      = 5
+	errNotLeaderForPartition   = 6
+)
+
+// Error is an error code returned by a broker
+type Error struct {
+	Code int16
+}
+
+func (e Error) Error() string {
+	switch e.Code {
+	case errUnknownTopicOrPartition:
+		return "kafka: unknown topic or partition"
+	case errLeaderNotAvailable:
+		return "kafka: leader not available"
+	case errNotLeaderForPartition:
+		return "kafka: not the leader for the partition"
+	case 10:
+		return "kafka: message too large"
+	case 29:
+		return "kafka: topic authorization failed"
+	case 58:
+		return "kafka: SASL authentication failed"
+	}
+	return "kafka: error code " + strconv.Itoa(int(e.Code))
+}
+
+// retriable reports whether a metadata refresh may resolve the error
+func (e Error) retriable() bool {
+	return e.Code == errUnknownTopicOrPartition || e.Code == errLeaderNotAvailable || e.Code == errNotLeaderForPartition
+}
+
+// Config configures a producer
+type Config struct {
+	// Brokers are the host:port addresses that bootstrap the producer
+	Brokers []string
+
+	// ClientID identifies the producer to the brokers; forgeai when empty
+	ClientID string
+
+	// TLS encrypts the connections when set
+	TLS *tls.Config
+
+	// Username and Password authenticate with SASL/PLAIN when set
+	Username string
+	Password string
+
+	// Acks is AcksAll, the default, or AcksLeader
+	Acks int16
+
+	// Timeout bounds how long brokers wait for acknowledgements; 10s when
+	// zero. Connecting to a broker is bounded by it, and a request without a
+	// context deadline by twice it.
+	Timeout time.Duration
+}
+
+// Header is a record header
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Message is a record to produce. Records with the same key go to the same
+// partition, chosen like the default partitioner of the Java client.
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers []Header
+	Time    time.Time
+}
+
+// Producer produces records. It is safe for concurrent use; records are
+// produced one at a time.
+type Producer struct {
+	cfg Config
+
+	mu          sync.Mutex
+	brokers     map[int32]string
+	conns       map[int32]*conn
+	leaders     map[string][]int32
+	correlation int32
+}
+
+// NewProducer creates a producer. It connects to the brokers when it first
+// produces a record.
+func NewProducer(cfg Config) (*Producer, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("kafka: no brokers")
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "forgeai"
+	}
+	if cfg.Acks == 0 {
+		cfg.Acks = AcksAll
+	}
+	if cfg.Acks != AcksAll && cfg.Acks != AcksLeader {
+		return nil, fmt.Errorf("kafka: unsupported acks %d (use -1 or 1)", cfg.Acks)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Producer{
+		cfg:     cfg,
+		brokers: make(map[int32]string),
+		conns:   make(map[int32]*conn),
+		leaders: make(map[string][]int32),
+	}, nil
+}
+
+// Produce publishes a record to topic and waits for its acknowledgement.
+// A failed attempt refreshes the metadata of the topic and is retried once.
+func (p *Producer) Produce(ctx context.Context, topic string, msg Message) error {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	request := p.produceRequest(topic, msg)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		err := p.produce(ctx, topic, msg.Key, request)
+		if err == nil {
+			return nil
+		}
+		var kerr Error
+		if attempt > 0 || ctx.Err() != nil || (errors.As(err, &kerr) && !kerr.retriable()) {
+			return err
+		}
+		delete(p.leaders, topic)
+	}
+}
+
+// Close closes the connections of the producer
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, c := range p.conns {
+		c.Close()
+		delete(p.conns, id)
+	}
+	return nil
+}
+
+// produce sends a produce request to the leader of the record's partition
+func (p *Producer) produce(ctx context.Context, topic string, key []byte, request func(partition int32) []byte) error {
+	leaders, ok := p.leaders[topic]
+	if !ok {
+		var err error
+		if leaders, err = p.refreshMetadata(ctx, topic); err != nil {
+			return err
+		}
+	}
+	partition := partitionOf(key, len(leaders))
+	if leaders[partition] < 0 {
+		return Error{Code: errLeaderNotAvailable}
+	}
+
+	c, err := p.connect(ctx, leaders[partition])
+	if err != nil {
+		return err
+	}
+	resp, err := p.roundTrip(ctx, c, apiProduce, produceVersion, request(partition))
+	if err != nil {
+		p.drop(leaders[partition])
+		return err
+	}
+
+	// Only the one topic and partition of the request are answered
+	r := &reader{buf: resp}
+	for topics := r.int32(); topics > 0; topics-- {
+		r.string()
+		for partitions := r.int32(); partitions > 0; partitions-- {
+			r.int32()
+			code := r.int16()
+			r.int64()
+			r.int64()
+			if code != 0 {
+				return Error{Code: code}
+			}
+		}
+	}
+	return r.err
+}
+
+// produceRequest returns the body of a produce request of a message for a
+// partition
+func (p *Producer) produceRequest(topic string, msg Message) func(partition int32) []byte {
+	batch := recordBatch(msg)
+	return func(partition int32) []byte {
+		var w writer
+		w.int16(-1) // no transactional ID
+		w.int16(p.cfg.Acks)
+		w.int32(int32(p.cfg.Timeout / time.Millisecond))
+		w.int32(1)
+		w.string(topic)
+		w.int32(1)
+		w.int32(partition)
+		w.bytes(batch)
+		return w.buf
+	}
+}
+
+// refreshMetadata fetches the brokers and the partition leaders of topic
+func (p *Producer) refreshMetadata(ctx context.Context, topic string) ([]int32, error) {
+	var w writer
+	w.int32(1)
+	w.string(topic)
+	w.bool(false) // do not create topics
+
+	var lastErr error
+	for _, c := range p.metadataConns(ctx, &lastErr) {
+		resp, err := p.roundTrip(ctx, c, apiMetadata, metadataVersion, w.buf)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		leaders, err := p.parseMetadata(resp, topic)
+		if err != nil {
+			return nil, err
+		}
+		p.leaders[topic] = leaders
+		return leaders, nil
+	}
+	return nil, fmt.Errorf("kafka: no broker reachable: %w", lastErr)
+}
+
+// metadataConns returns the connections to ask for metadata, connecting to
+// the bootstrap brokers when there are none
+func (p *Producer) metadataConns(ctx context.Context, lastErr *error) []*conn {
+	conns := make([]*conn, 0, len(p.conns))
+	for _, c := range p.conns {
+		conns = append(conns, c)
+	}
+	if len(conns) > 0 {
+		return conns
+	}
+	for i, addr := range p.cfg.Brokers {
+		// Bootstrap connections get negative IDs until metadata names
+		// the brokers
+		id := int32(-1 - i)
+		p.brokers[id] = addr
+		c, err := p.connect(ctx, id)
+		if err != nil {
+			*lastErr = err
+			continue
+		}
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// parseMetadata records the brokers of a metadata response and returns the
+// leaders of the partitions of topic
+func (p *Producer) parseMetadata(resp []byte, topic string) ([]int32, error) {
+	r := &reader{buf: resp}
+	r.int32() // throttle time
+	for brokers := r.int32(); brokers > 0; brokers-- {
+		id := r.int32()
+		host := r.string()
+		port := r.int32()
+		r.nullableString() // rack
+		p.brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	r.nullableString() // cluster ID
+	r.int32()          // controller ID
+
+	var leaders []int32
+	var topicErr int16
+	found := false
+	for topics := r.int32(); topics > 0 && r.err == nil; topics-- {
+		code := r.int16()
+		name := r.string()
+		r.bool() // internal
+		var partitions []int32
+		for n := r.int32(); n > 0 && r.err == nil; n-- {
+			r.int16()
+			index := r.int32()
+			leader := r.int32()
+			r.int32Array() // replicas
+			r.int32Array() // in-sync replicas
+			for int(index) >= len(partitions) {
+				partitions = append(partitions, -1)
+			}
+			partitions[index] = leader
+		}
+		if name == topic {
+			found, topicErr, leaders = true, code, partitions
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if !found || topicErr == errUnknownTopicOrPartition {
+		return nil, fmt.Errorf("kafka: topic %s does not exist", topic)
+	}
+	if topicErr != 0 {
+		return nil, Error{Code: topicErr}
+	}
+	if len(leaders) == 0 {
+		return nil, Error{Code: errLeaderNotAvailable}
+	}
+	return leaders, nil
+}
+
+// conn is a connection to a broker
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// connect returns the connection to a broker, dialing and authenticating
+// it when there is none
+func (p *Producer) connect(ctx context.Context, id int32) (*conn, error) {
+	if c, ok := p.conns[id]; ok {
+		return c, nil
+	}
+	addr, ok := p.brokers[id]
+	if !ok {
+		return nil, fmt.Errorf("kafka: unknown broker %d", id)
+	}
+
+	d := net.Dialer{Timeout: p.cfg.Timeout}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: failed to connect to %s: %w", addr, err)
+	}
+	if p.cfg.TLS != nil {
+		cfg := p.cfg.TLS.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		tlsConn := tls.Client(nc, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("kafka: failed to connect to %s: %w", addr, err)
+		}
+		nc = tlsConn
+	}
+
+	c := &conn{Conn: nc, r: bufio.NewReader(nc)}
+	if p.cfg.Username != "" {
+		if err := p.authenticate(ctx, c); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	p.conns[id] = c
+	return c, nil
+}
+
+// authenticate authenticates a connection with SASL/PLAIN
+func (p *Producer) authenticate(ctx context.Context, c *conn) error {
+	var w writer
+	w.string("PLAIN")
+	resp, err := p.roundTrip(ctx, c, apiSaslHandshake, saslHandshakeVersion, w.buf)
+	if err != nil {
+		return err
+	}
+	r := &reader{buf: resp}
+	if code := r.int16(); code != 0 {
+		return fmt.Errorf("kafka: the brokers do not support SASL/PLAIN: %w", Error{Code: code})
+	}
+
+	w = writer{}
+	w.bytes([]byte("\x00" + p.cfg.Username + "\x00" + p.cfg.Password))
+	resp, err = p.roundTrip(ctx, c, apiSaslAuthenticate, saslAuthenticateVersion, w.buf)
+	if err != nil {
+		return err
+	}
+	r = &reader{buf: resp}
+	if code := r.int16(); code != 0 {
+		if msg := r.nullableString(); msg != "" {
+			return fmt.Errorf("kafka: SASL authentication failed: %s", msg)
+		}
+		return Error{Code: code}
+	}
+	return r.err
+}
+
+// drop closes the connection to a broker after a failure
+func (p *Producer) drop(id int32) {
+	if c, ok := p.conns[id]; ok {
+		c.Close()
+		delete(p.conns, id)
+	}
+}
+
+// roundTrip sends a request and returns the body of its response
+func (p *Producer) roundTrip(ctx context.Context, c *conn, apiKey, version int16, body []byte) ([]byte, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		// Brokers answer within the acknowledgement timeout; a broker that
+		// stalls well past it must not hold the producer forever
+		deadline = time.Now().Add(2 * p.cfg.Timeout)
+	}
+	c.SetDeadline(deadline)
+
+	p.correlation++
+	correlation := p.correlation
+	var w writer
+	w.int32(0) // size, set below
+	w.int16(apiKey)
+	w.int16(version)
+	w.int32(correlation)
+	w.string(p.cfg.ClientID)
+	w.buf = append(w.buf, body...)
+	binary.BigEndian.PutUint32(w.buf, uint32(len(w.buf)-4))
+	if _, err := c.Write(w.buf); err != nil {
+		return nil, fmt.Errorf("kafka: failed to send request: %w", err)
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return nil, fmt.Errorf("kafka: failed to read response: %w", err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > maxResponseSize {
+		return nil, fmt.Errorf("kafka: invalid response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, fmt.Errorf("kafka: failed to read response: %w", err)
+	}
+	if got := int32(binary.BigEndian.Uint32(resp)); got != correlation {
+		return nil, fmt.Errorf("kafka: response %d does not answer request %d", got, correlation)
+	}
+	return resp[4:], nil
+}
+
+// recordBatch encodes a message as a record batch of the v2 message format
+func recordBatch(msg Message) []byte {
+	var rec writer
+	rec.int8(0)   // attributes
+	rec.varint(0) // timestamp delta
+	rec.varint(0) // offset delta
+	if msg.Key == nil {
+		rec.varint(-1)
+	} else {
+		rec.varint(int64(len(msg.Key)))
+		rec.buf = append(rec.buf, msg.Key...)
+	}
+	rec.varint(int64(len(msg.Value)))
+	rec.buf = append(rec.buf, msg.Value...)
+	rec.varint(int64(len(msg.Headers)))
+	for _, h := range msg.Headers {
+		rec.varint(int64(len(h.Key)))
+		rec.buf = append(rec.buf, h.Key...)
+		rec.varint(int64(len(h.Value)))
+		rec.buf = append(rec.buf, h.Value...)
+	}
+
+	// The CRC covers the batch from its attributes to its end
+	ts := msg.Time.UnixMilli()
+	var body writer
+	body.int16(0) // attributes: no compression
+	body.int32(0) // last offset delta
+	body.int64(ts)
+	body.int64(ts)
+	body.int64(-1) // producer ID
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(1)  // records
+	body.varint(int64(len(rec.buf)))
+	body.buf = append(body.buf, rec.buf...)
+
+	var batch writer
+	batch.int64(0) // base offset
+	batch.int32(int32(4 + 1 + 4 + len(body.buf)))
+	batch.int32(-1) // partition leader epoch
+	batch.int8(2)   // magic
+	batch.int32(int32(crc32.Checksum(body.buf, crc32.MakeTable(crc32.Castagnoli))))
+	batch.buf = append(batch.buf, body.buf...)
+	return batch.buf
+}
+
+// partitionOf returns the partition of a key among n like the default
+// partitioner of the Java client, murmur2 of the key; records without a
+// key go to partition 0
+func partitionOf(key []byte, n int) int32 {
+	if key == nil || n <= 0 {
+		return 0
+	}
+	return int32(int(murmur2(key)&0x7fffffff) % n)
+}
+
+// murmur2 is the hash of the Java client's default partitioner
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
@@ -0,0 +1,116 @@
+// Package languages normalizes the names callers use for languages, such as
+// py, node, or golang, to the canonical IDs executors know them by. Code
+// generated by language models names languages inconsistently, and every
+// entry point normalizes through this package so that aliases work the same
+// in the CLI, the API, and plugins.
+package languages
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultAliases maps common aliases to canonical language IDs
+var DefaultAliases = map[string]string{
+	"py":         "python",
+	"py3":        "python",
+	"python3":    "python",
+	"js":         "javascript",
+	"node":       "javascript",
+	"nodejs":     "javascript",
+	"golang":     "go",
+	"ts":         "typescript",
+	"rb":         "ruby",
+	"rs":         "rust",
+	"sh":         "bash",
+	"shell":      "bash",
+	"c++":        "cpp",
+	"cxx":        "cpp",
+	"cs":         "csharp",
+	"c#":         "csharp",
+	"kt":         "kotlin",
+	"ecmascript": "javascript",
+}
+
+var (
+	mu      sync.RWMutex
+	aliases = map[string]string{}
+)
+
+// key returns the form of a name that aliases are matched on
+func key(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Normalize returns the canonical ID of a language name: configured aliases
+// first, then DefaultAliases, matched regardless of case and surrounding
+// space. Names that are not aliases are returned lowercased.
+func Normalize(name string) string {
+	k := key(name)
+	mu.RLock()
+	canonical, ok := aliases[k]
+	mu.RUnlock()
+	if ok {
+		return canonical
+	}
+	if canonical, ok := DefaultAliases[k]; ok {
+		return canonical
+	}
+	return k
+}
+
+// SetAliases replaces the configured aliases, which extend and override
+// DefaultAliases. Aliases must name a canonical ID rather than another
+// alias.
+func SetAliases(extra map[string]string) error {
+	configured := make(map[string]string, len(extra))
+	for alias, canonical := range extra {
+		alias, canonical = key(alias), key(canonical)
+		if alias == "" || canonical == "" {
+			return fmt.Errorf("language aliases and their languages must not be empty")
+		}
+		if alias == canonical {
+			continue
+		}
+		configured[alias] = canonical
+	}
+	for alias, canonical := range configured {
+		if _, ok := configured[canonical]; ok {
+			return fmt.Errorf("language alias %s names another alias, %s", alias, canonical)
+		}
+	}
+
+	mu.Lock()
+	aliases = configured
+	mu.Unlock()
+	return nil
+}
+
+// Aliases returns every alias and its canonical ID, configured aliases
+// included
+func Aliases() map[string]string {
+	all := make(map[string]string, len(DefaultAliases))
+	for alias, canonical := range DefaultAliases {
+		all[alias] = canonical
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for alias, canonical := range aliases {
+		all[alias] = canonical
+	}
+	return all
+}
+
+// AliasesOf returns the aliases of a canonical ID, sorted
+func AliasesOf(language string) []string {
+	var of []string
+	for alias, canonical := range Aliases() {
+		if canonical == language {
+			of = append(of, alias)
+		}
+	}
+	sort.Strings(of)
+	return of
+}
@@ -0,0 +1,188 @@
+// Package leader elects one of several API replicas to perform singleton
+// duties, such as pruning the logs of a shared job store, so that replicas
+// do not conflict
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNotHeld is returned when releasing a lease held by someone else
+var ErrNotHeld = errors.New("lease is not held")
+
+// Lease records which replica leads and until when
+type Lease struct {
+	Holder   string    `json:"holder"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Lock grants a time-limited lease to one holder at a time. Replicas must
+// share a Lock for the election to hold.
+type Lock interface {
+	// Acquire takes the lease for holder until ttl from now when it is
+	// free, expired, or already held by holder, and returns the lease in
+	// effect either way
+	Acquire(ctx context.Context, holder string, ttl time.Duration) (Lease, error)
+
+	// Release gives up the lease if holder holds it
+	Release(ctx context.Context, holder string) error
+}
+
+// Status reports the view of an elector
+type Status struct {
+	ID      string    `json:"id"`
+	Leader  string    `json:"leader,omitempty"`
+	Leading bool      `json:"leading"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// Elector campaigns for a lease on behalf of one replica and runs duties
+// while the replica leads
+type Elector struct {
+	// Lock is shared by the replicas
+	Lock Lock
+
+	// ID identifies this replica; it must be unique among the replicas
+	ID string
+
+	// TTL is how long a lease lasts without renewal. A failed leader's
+	// duties move to another replica after at most TTL.
+	TTL time.Duration
+
+	// RenewInterval is how often the lease is renewed or campaigned for;
+	// a third of TTL when zero
+	RenewInterval time.Duration
+
+	mu      sync.RWMutex
+	lease   Lease
+	leading bool
+
+	// changed is closed and replaced whenever leading changes
+	changed chan struct{}
+}
+
+// NewElector creates an elector for replica id with a 15 second lease
+func NewElector(lock Lock, id string) *Elector {
+	return &Elector{
+		Lock:    lock,
+		ID:      id,
+		TTL:     15 * time.Second,
+		changed: make(chan struct{}),
+	}
+}
+
+// Run campaigns for and renews the lease until ctx is done, then releases
+// it
+func (e *Elector) Run(ctx context.Context) {
+	interval := e.RenewInterval
+	if interval <= 0 {
+		interval = e.TTL / 3
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		e.campaign(ctx)
+		select {
+		case <-ctx.Done():
+			e.setLease(Lease{}, false)
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := e.Lock.Release(releaseCtx, e.ID); err != nil && !errors.Is(err, ErrNotHeld) {
+				fmt.Printf("Warning: failed to release leader lease: %v\n", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign acquires or renews the lease once. A leader that cannot renew
+// steps down rather than risk two leaders.
+func (e *Elector) campaign(ctx context.Context) {
+	lease, err := e.Lock.Acquire(ctx, e.ID, e.TTL)
+	if err != nil {
+		if ctx.Err() == nil {
+			fmt.Printf("Warning: failed to acquire leader lease: %v\n", err)
+		}
+		e.setLease(Lease{}, false)
+		return
+	}
+	e.setLease(lease, lease.Holder == e.ID)
+}
+
+// setLease records the lease in effect and wakes duties when leadership
+// changes
+func (e *Elector) setLease(lease Lease, leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lease = lease
+	if leading != e.leading {
+		e.leading = leading
+		close(e.changed)
+		e.changed = make(chan struct{})
+		if leading {
+			fmt.Printf("Replica %s is now the leader\n", e.ID)
+		} else {
+			fmt.Printf("Replica %s is no longer the leader\n", e.ID)
+		}
+	}
+}
+
+// IsLeader reports whether this replica holds the lease
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leading
+}
+
+// Status reports the replica, the leader it last saw, and whether it leads
+func (e *Elector) Status() Status {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return Status{
+		ID:      e.ID,
+		Leader:  e.lease.Holder,
+		Leading: e.leading,
+		Expires: e.lease.Expires,
+	}
+}
+
+// Lead runs duty whenever this replica leads, cancelling its context when
+// leadership is lost, until ctx is done. It needs Run to be running.
+func (e *Elector) Lead(ctx context.Context, duty func(ctx context.Context)) {
+	for {
+		e.mu.RLock()
+		leading, changed := e.leading, e.changed
+		e.mu.RUnlock()
+
+		if leading {
+			dutyCtx, cancel := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				duty(dutyCtx)
+			}()
+			select {
+			case <-changed:
+			case <-ctx.Done():
+			}
+			cancel()
+			<-done
+		} else {
+			select {
+			case <-changed:
+			case <-ctx.Done():
+			}
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
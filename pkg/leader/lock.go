@@ -0,0 +1,131 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// acquire decides the lease after holder asks for it at now
+func acquire(current Lease, holder string, ttl time.Duration, now time.Time) Lease {
+	switch {
+	case current.Holder == holder:
+		current.Expires = now.Add(ttl)
+		return current
+	case current.Holder == "" || !now.Before(current.Expires):
+		return Lease{Holder: holder, Acquired: now, Expires: now.Add(ttl)}
+	default:
+		return current
+	}
+}
+
+// MemoryLock grants leases within one process, for tests and single
+// replicas
+type MemoryLock struct {
+	mu    sync.Mutex
+	lease Lease
+}
+
+// NewMemoryLock creates a free lock
+func NewMemoryLock() *MemoryLock {
+	return &MemoryLock{}
+}
+
+// Acquire takes or renews the lease for holder if it can
+func (l *MemoryLock) Acquire(ctx context.Context, holder string, ttl time.Duration) (Lease, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lease = acquire(l.lease, holder, ttl, time.Now())
+	return l.lease, nil
+}
+
+// Release gives up the lease if holder holds it
+func (l *MemoryLock) Release(ctx context.Context, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lease.Holder != holder {
+		return ErrNotHeld
+	}
+	l.lease = Lease{}
+	return nil
+}
+
+// FileLock keeps the lease in a JSON file that the replicas share, such as
+// one on the volume of a shared job store. Changes to the file are
+// serialized with an advisory lock on Path + ".lock". Expiry is judged by
+// each replica's clock, so the clocks must roughly agree.
+type FileLock struct {
+	Path string
+}
+
+// NewFileLock creates a lock that keeps its lease at path
+func NewFileLock(path string) *FileLock {
+	return &FileLock{Path: path}
+}
+
+// Acquire takes or renews the lease for holder if it can
+func (l *FileLock) Acquire(ctx context.Context, holder string, ttl time.Duration) (Lease, error) {
+	var lease Lease
+	err := l.update(ctx, func(current Lease) (Lease, error) {
+		lease = acquire(current, holder, ttl, time.Now())
+		return lease, nil
+	})
+	return lease, err
+}
+
+// Release gives up the lease if holder holds it
+func (l *FileLock) Release(ctx context.Context, holder string) error {
+	return l.update(ctx, func(current Lease) (Lease, error) {
+		if current.Holder != holder {
+			return current, ErrNotHeld
+		}
+		return Lease{}, nil
+	})
+}
+
+// update replaces the lease with the result of change while holding the
+// advisory lock
+func (l *FileLock) update(ctx context.Context, change func(Lease) (Lease, error)) error {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create lease directory: %w", err)
+	}
+	unlock, err := lockFile(ctx, l.Path+".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock lease: %w", err)
+	}
+	defer unlock()
+
+	var current Lease
+	data, err := os.ReadFile(l.Path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return fmt.Errorf("failed to read lease: %w", err)
+	default:
+		if err := json.Unmarshal(data, &current); err != nil {
+			return fmt.Errorf("failed to parse lease: %w", err)
+		}
+	}
+
+	next, err := change(current)
+	if err != nil || next == current {
+		return err
+	}
+
+	data, err = json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	tmp := l.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write lease: %w", err)
+	}
+	if err := os.Rename(tmp, l.Path); err != nil {
+		return fmt.Errorf("failed to write lease: %w", err)
+	}
+	return nil
+}
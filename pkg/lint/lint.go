@@ -0,0 +1,269 @@
+// Package lint checks and formats code in the sandbox without running it.
+// The submitted code is embedded in a small checker program of its own
+// language, which parses or formats it and reports the outcome as JSON.
+package lint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"forgeai/pkg/sandbox"
+)
+
+// vetRe matches go vet findings, which type errors prefix with "vet: "
+var vetRe = regexp.MustCompile(`^(?:vet: )?(\S+\.go):(\d+)(?::(\d+))?: (.+)$`)
+
+// Operations
+const (
+	// Check reports syntax errors, and go vet findings for Go
+	Check = "lint"
+
+	// Format returns the code in its language's canonical format
+	Format = "format"
+)
+
+// ErrUnsupported is returned for operations a language has no tool for
+var ErrUnsupported = errors.New("operation is not supported for this language")
+
+// Result is the outcome of checking or formatting code
+type Result struct {
+	Diagnostics []sandbox.Diagnostic `json:"diagnostics"`
+
+	// Formatted is the formatted code; empty when formatting failed
+	Formatted string `json:"formatted,omitempty"`
+
+	// Error explains why the checker could not run, such as a missing
+	// formatter
+	Error string `json:"error,omitempty"`
+
+	// VetOutput is the output of go vet, parsed into Diagnostics
+	VetOutput string `json:"vet_output,omitempty"`
+}
+
+// Valid reports whether no diagnostic is an error
+func (r Result) Valid() bool {
+	for _, diag := range r.Diagnostics {
+		if diag.Severity == "error" {
+			return false
+		}
+	}
+	return true
+}
+
+// Supported reports whether an operation is supported for a language
+func Supported(op, language string) bool {
+	_, ok := programs[op][language]
+	return ok
+}
+
+// Run checks or formats code with a checker program run by exec
+func Run(ctx context.Context, exec sandbox.Executor, op, language, code string) (Result, error) {
+	program, err := Program(op, language, code)
+	if err != nil {
+		return Result{}, err
+	}
+	out, err := exec.Execute(ctx, language, program)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to run checker: %w", err)
+	}
+
+	var result Result
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out.Stdout)), &result); err != nil {
+		return Result{}, fmt.Errorf("checker failed with exit code %d: %s", out.ExitCode, strings.TrimSpace(out.Stderr))
+	}
+	if result.VetOutput != "" {
+		result.Diagnostics = append(result.Diagnostics, parseVet(result.VetOutput)...)
+		result.VetOutput = ""
+	}
+	if result.Diagnostics == nil {
+		result.Diagnostics = []sandbox.Diagnostic{}
+	}
+	return result, nil
+}
+
+// parseVet parses the output of go vet. Type errors are errors and other
+// findings warnings.
+func parseVet(output string) []sandbox.Diagnostic {
+	var diags []sandbox.Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		m := vetRe.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		severity := "warning"
+		if strings.HasPrefix(line, "vet: ") {
+			severity = "error"
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		column, _ := strconv.Atoi(m[3])
+		diags = append(diags, sandbox.Diagnostic{
+			File:     filepath.Base(m[1]),
+			Line:     lineNo,
+			Column:   column,
+			Message:  m[4],
+			Severity: severity,
+		})
+	}
+	return diags
+}
+
+// Program returns the checker program for an operation on code
+func Program(op, language, code string) (string, error) {
+	program, ok := programs[op][language]
+	if !ok {
+		return "", fmt.Errorf("%s %s: %w", op, language, ErrUnsupported)
+	}
+	var literal string
+	if language == "go" {
+		literal = strconv.Quote(code)
+	} else {
+		// JSON strings are valid Python and JavaScript string literals
+		data, err := json.Marshal(code)
+		if err != nil {
+			return "", err
+		}
+		literal = string(data)
+	}
+	return strings.Replace(program, "__SOURCE__", literal, 1), nil
+}
+
+// programs are the checker programs by operation and language. __SOURCE__
+// is replaced with the code as a string literal.
+var programs = map[string]map[string]string{
+	Check: {
+		"python":     pythonCheck,
+		"javascript": javascriptCheck,
+		"go":         goProgram(false),
+	},
+	Format: {
+		"python": pythonFormat,
+		"go":     goProgram(true),
+	},
+}
+
+// pythonCheck compiles the code like python -m py_compile
+const pythonCheck = `import json, warnings
+src = __SOURCE__
+diags = []
+with warnings.catch_warnings(record=True) as caught:
+    warnings.simplefilter("always")
+    try:
+        compile(src, "main.py", "exec", dont_inherit=True)
+    except SyntaxError as e:
+        diags.append({"file": "main.py", "line": e.lineno or 0, "column": e.offset or 0, "message": e.msg, "severity": "error"})
+    except ValueError as e:
+        diags.append({"file": "main.py", "line": 0, "message": str(e), "severity": "error"})
+for w in caught:
+    diags.append({"file": "main.py", "line": w.lineno, "message": str(w.message), "severity": "warning"})
+print(json.dumps({"diagnostics": diags}))
+`
+
+// pythonFormat formats the code with black when it is installed
+const pythonFormat = `import json
+src = __SOURCE__
+try:
+    import black
+except ImportError:
+    print(json.dumps({"error": "black is not installed"}))
+    raise SystemExit(0)
+try:
+    print(json.dumps({"formatted": black.format_str(src, mode=black.Mode())}))
+except Exception as e:
+    print(json.dumps({"diagnostics": [{"file": "main.py", "line": 0, "message": str(e), "severity": "error"}]}))
+`
+
+// javascriptCheck compiles the code like node --check
+const javascriptCheck = `const vm = require("vm");
+const src = __SOURCE__;
+const diags = [];
+try {
+  new vm.Script(src, { filename: "main.js" });
+} catch (e) {
+  const m = /^main\.js:(\d+)/.exec(String(e.stack));
+  diags.push({ file: "main.js", line: m ? Number(m[1]) : 0, message: String(e.message), severity: "error" });
+}
+console.log(JSON.stringify({ diagnostics: diags }));
+`
+
+// goProgram returns the Go checker, which parses the code with go/parser
+// and then formats it with go/format or runs go vet on it
+func goProgram(format bool) string {
+	return `package main
+
+import (
+	"encoding/json"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const src = __SOURCE__
+
+const formatting = ` + strconv.FormatBool(format) + `
+
+type diagnostic struct {
+	File     string ` + "`json:\"file\"`" + `
+	Line     int    ` + "`json:\"line\"`" + `
+	Column   int    ` + "`json:\"column,omitempty\"`" + `
+	Message  string ` + "`json:\"message\"`" + `
+	Severity string ` + "`json:\"severity\"`" + `
+}
+
+func main() {
+	out := map[string]interface{}{}
+	defer func() { json.NewEncoder(os.Stdout).Encode(out) }()
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "main.go", src, parser.AllErrors); err != nil {
+		var diags []diagnostic
+		if list, ok := err.(scanner.ErrorList); ok {
+			for _, e := range list {
+				diags = append(diags, diagnostic{File: "main.go", Line: e.Pos.Line, Column: e.Pos.Column, Message: e.Msg, Severity: "error"})
+			}
+		} else {
+			diags = append(diags, diagnostic{File: "main.go", Message: err.Error(), Severity: "error"})
+		}
+		out["diagnostics"] = diags
+		return
+	}
+
+	if formatting {
+		formatted, err := format.Source([]byte(src))
+		if err != nil {
+			out["diagnostics"] = []diagnostic{{File: "main.go", Message: err.Error(), Severity: "error"}}
+			return
+		}
+		out["formatted"] = string(formatted)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "vet")
+	if err != nil {
+		out["error"] = err.Error()
+		return
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0600); err != nil {
+		out["error"] = err.Error()
+		return
+	}
+	cmd := exec.Command("go", "vet", "main.go")
+	cmd.Dir = dir
+	vet, err := cmd.CombinedOutput()
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		out["error"] = "go vet failed: " + err.Error()
+		return
+	}
+	out["vet_output"] = string(vet)
+}
+`
+}
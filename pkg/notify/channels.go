@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+
+	"forgeai/pkg/config"
+)
+
+func init() {
+	Register("slack", newSlackChannel)
+	Register("email", newEmailChannel)
+	Register("pagerduty", newPagerDutyChannel)
+}
+
+// SlackChannel posts events to a Slack incoming webhook
+type SlackChannel struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+func newSlackChannel(cfg config.NotificationChannelConfig) (Channel, error) {
+	if cfg.WebhookURL == "" {
+		return nil, fmt.Errorf("webhook_url is required")
+	}
+	return &SlackChannel{WebhookURL: cfg.WebhookURL, Client: http.DefaultClient}, nil
+}
+
+// Name implements Channel
+func (s *SlackChannel) Name() string {
+	return "slack"
+}
+
+// Send implements Channel
+func (s *SlackChannel) Send(ctx context.Context, event Event) error {
+	text := fmt.Sprintf("*[%s] %s*\n%s", strings.ToUpper(event.Severity), event.Title, event.Message)
+	for _, key := range sortedKeys(event.Details) {
+		text += fmt.Sprintf("\n• %s: %s", key, event.Details[key])
+	}
+
+	return postJSON(ctx, s.Client, s.WebhookURL, map[string]string{"text": text})
+}
+
+// EmailChannel sends events by SMTP
+type EmailChannel struct {
+	// Addr is the SMTP server host:port
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+func newEmailChannel(cfg config.NotificationChannelConfig) (Channel, error) {
+	if cfg.SMTPAddr == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("smtp_addr, from, and to are required")
+	}
+	return &EmailChannel{
+		Addr:     cfg.SMTPAddr,
+		From:     cfg.From,
+		To:       cfg.To,
+		Username: cfg.Username,
+		Password: cfg.Password,
+	}, nil
+}
+
+// Name implements Channel
+func (e *EmailChannel) Name() string {
+	return "email"
+}
+
+// Send implements Channel. net/smtp does not take a context, so ctx is only
+// checked before connecting.
+func (e *EmailChannel) Send(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", e.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&body, "Subject: [ForgeAI %s] %s\r\n", event.Severity, event.Title)
+	fmt.Fprintf(&body, "Date: %s\r\n", event.Time.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(event.Message + "\r\n")
+	for _, key := range sortedKeys(event.Details) {
+		fmt.Fprintf(&body, "\r\n%s: %s", key, event.Details[key])
+	}
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, err := net.SplitHostPort(e.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address: %w", err)
+		}
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+
+	if err := smtp.SendMail(e.Addr, auth, e.From, e.To, []byte(body.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// DefaultPagerDutyURL is the PagerDuty Events API v2 endpoint
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyChannel triggers PagerDuty incidents through the Events API v2
+type PagerDutyChannel struct {
+	RoutingKey string
+	URL        string
+	Client     *http.Client
+}
+
+func newPagerDutyChannel(cfg config.NotificationChannelConfig) (Channel, error) {
+	if cfg.RoutingKey == "" {
+		return nil, fmt.Errorf("routing_key is required")
+	}
+	url := cfg.URL
+	if url == "" {
+		url = DefaultPagerDutyURL
+	}
+	return &PagerDutyChannel{RoutingKey: cfg.RoutingKey, URL: url, Client: http.DefaultClient}, nil
+}
+
+// Name implements Channel
+func (p *PagerDutyChannel) Name() string {
+	return "pagerduty"
+}
+
+// Send implements Channel. Events with the same trigger and key are grouped
+// into one incident.
+func (p *PagerDutyChannel) Send(ctx context.Context, event Event) error {
+	severity := event.Severity
+	if severity != SeverityCritical && severity != SeverityWarning && severity != SeverityInfo {
+		severity = "error"
+	}
+
+	details := make(map[string]string, len(event.Details)+1)
+	for key, value := range event.Details {
+		details[key] = value
+	}
+	details["message"] = event.Message
+
+	return postJSON(ctx, p.Client, p.URL, map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    "forgeai/" + event.Trigger + "/" + event.Key,
+		"payload": map[string]interface{}{
+			"summary":        event.Title,
+			"source":         "forgeai",
+			"severity":       severity,
+			"component":      event.Trigger,
+			"timestamp":      event.Time.UTC().Format("2006-01-02T15:04:05Z"),
+			"custom_details": details,
+		},
+	})
+}
+
+// postJSON posts a JSON body and fails on non-2xx responses
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notification rejected with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
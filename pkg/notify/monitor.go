@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"forgeai/pkg/security"
+)
+
+// Failure rate defaults
+const (
+	DefaultFailureRateThreshold = 0.5
+	DefaultFailureRateWindow    = 50
+	DefaultFailureRateMinJobs   = 10
+)
+
+// EscapeRules are the threat rules treated as sandbox escape indicators
+var EscapeRules = []string{"metadata-access", "sensitive-file-access"}
+
+// FailureRateMonitor tracks the outcomes of recent jobs and notifies when
+// the share of failures crosses a threshold
+type FailureRateMonitor struct {
+	notifier *Notifier
+
+	// Threshold is the failure rate, from 0 to 1, that triggers a notification
+	Threshold float64
+
+	// Window is the number of recent jobs considered
+	Window int
+
+	// MinJobs is the number of jobs required before notifying
+	MinJobs int
+
+	mu       sync.Mutex
+	outcomes []bool
+	next     int
+	failures int
+}
+
+// NewFailureRateMonitor creates a monitor with the default thresholds
+func NewFailureRateMonitor(notifier *Notifier) *FailureRateMonitor {
+	return &FailureRateMonitor{
+		notifier:  notifier,
+		Threshold: DefaultFailureRateThreshold,
+		Window:    DefaultFailureRateWindow,
+		MinJobs:   DefaultFailureRateMinJobs,
+	}
+}
+
+// Record adds a job outcome and notifies when the failure rate is at or
+// above the threshold
+func (m *FailureRateMonitor) Record(ctx context.Context, failed bool) error {
+	window := m.Window
+	if window <= 0 {
+		window = DefaultFailureRateWindow
+	}
+
+	m.mu.Lock()
+	if len(m.outcomes) < window {
+		m.outcomes = append(m.outcomes, failed)
+	} else {
+		if m.outcomes[m.next] {
+			m.failures--
+		}
+		m.outcomes[m.next] = failed
+		m.next = (m.next + 1) % window
+	}
+	if failed {
+		m.failures++
+	}
+
+	total := len(m.outcomes)
+	rate := float64(m.failures) / float64(total)
+	failures := m.failures
+	m.mu.Unlock()
+
+	if total < m.MinJobs || rate < m.Threshold {
+		return nil
+	}
+
+	return m.notifier.Notify(ctx, Event{
+		Trigger:  TriggerFailureRate,
+		Severity: SeverityWarning,
+		Title:    fmt.Sprintf("Job failure rate at %.0f%%", rate*100),
+		Message:  fmt.Sprintf("%d of the last %d jobs failed (threshold %.0f%%)", failures, total, m.Threshold*100),
+		Details: map[string]string{
+			"failures": fmt.Sprint(failures),
+			"jobs":     fmt.Sprint(total),
+		},
+	})
+}
+
+// EscapeFindings returns the findings of an assessment that indicate a
+// sandbox escape attempt
+func EscapeFindings(assessment *security.ThreatAssessment) []security.ThreatFinding {
+	if assessment == nil {
+		return nil
+	}
+
+	var findings []security.ThreatFinding
+	for _, finding := range assessment.Findings {
+		for _, rule := range EscapeRules {
+			if finding.Rule == rule {
+				findings = append(findings, finding)
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// SandboxEscapeEvent describes escape indicators observed in a job
+func SandboxEscapeEvent(jobID string, findings []security.ThreatFinding) Event {
+	descriptions := make([]string, len(findings))
+	for i, finding := range findings {
+		descriptions[i] = finding.Description
+	}
+
+	return Event{
+		Trigger:  TriggerSandboxEscape,
+		Severity: SeverityCritical,
+		Title:    "Sandbox escape indicators in job " + jobID,
+		Message:  "Job " + strings.Join(descriptions, "; "),
+		Key:      jobID,
+		Details:  map[string]string{"job_id": jobID},
+	}
+}
+
+// SecurityTestsEvent describes a security test run with failures
+func SecurityTestsEvent(failed []string, total int) Event {
+	return Event{
+		Trigger:  TriggerSecurityTests,
+		Severity: SeverityCritical,
+		Title:    fmt.Sprintf("%d of %d security tests failed", len(failed), total),
+		Message:  "Failed tests: " + strings.Join(failed, ", "),
+		Details: map[string]string{
+			"failed": fmt.Sprint(len(failed)),
+			"total":  fmt.Sprint(total),
+		},
+	}
+}
+
+// WorkerLostEvent describes a worker node that stopped responding
+func WorkerLostEvent(worker, reason string) Event {
+	return Event{
+		Trigger:  TriggerWorkerLost,
+		Severity: SeverityCritical,
+		Title:    "Worker " + worker + " lost",
+		Message:  reason,
+		Key:      worker,
+		Details:  map[string]string{"worker": worker},
+	}
+}
@@ -0,0 +1,237 @@
+// Package notify sends alerts about job and security events to channels such
+// as Slack, email, and PagerDuty
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/offline"
+)
+
+// Triggers that raise notifications
+const (
+	// TriggerFailureRate fires when the job failure rate crosses a threshold
+	TriggerFailureRate = "job_failure_rate"
+
+	// TriggerSecurityTests fires when the security test suite has failures
+	TriggerSecurityTests = "security_test_failure"
+
+	// TriggerSandboxEscape fires when a job shows sandbox escape indicators
+	TriggerSandboxEscape = "sandbox_escape"
+
+	// TriggerWorkerLost fires when a worker node stops responding
+	TriggerWorkerLost = "worker_lost"
+)
+
+// Triggers lists every known trigger
+var Triggers = []string{TriggerFailureRate, TriggerSecurityTests, TriggerSandboxEscape, TriggerWorkerLost}
+
+// Event severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// DefaultCooldown is how long repeats of an event are suppressed
+const DefaultCooldown = 10 * time.Minute
+
+// Event is a notification about something that needs attention
+type Event struct {
+	Trigger  string
+	Severity string
+	Title    string
+	Message  string
+
+	// Key deduplicates repeats of the same event; the trigger is used when
+	// empty
+	Key string
+
+	Details map[string]string
+	Time    time.Time
+}
+
+// Channel delivers events to a destination
+type Channel interface {
+	// Name identifies the channel in logs
+	Name() string
+
+	Send(ctx context.Context, event Event) error
+}
+
+// ChannelFactory creates a channel from its configuration
+type ChannelFactory func(cfg config.NotificationChannelConfig) (Channel, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]ChannelFactory{}
+)
+
+// Register makes a channel type available to New. It is typically called
+// from an init function.
+func Register(kind string, factory ChannelFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[kind] = factory
+}
+
+// ChannelTypes returns the registered channel types
+func ChannelTypes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	kinds := make([]string, 0, len(factories))
+	for kind := range factories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// route sends the events of some triggers to a channel
+type route struct {
+	channel  Channel
+	triggers map[string]bool
+}
+
+func (r route) accepts(trigger string) bool {
+	return len(r.triggers) == 0 || r.triggers[trigger]
+}
+
+// Notifier dispatches events to the channels subscribed to their trigger
+type Notifier struct {
+	routes []route
+
+	// Cooldown suppresses repeats of an event key; zero disables it
+	Cooldown time.Duration
+
+	// Timeout bounds each delivery
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+// NewNotifier creates a notifier without channels
+func NewNotifier() *Notifier {
+	return &Notifier{
+		Cooldown: DefaultCooldown,
+		Timeout:  10 * time.Second,
+		lastSent: make(map[string]time.Time),
+	}
+}
+
+// New creates a notifier from configuration
+func New(cfg config.NotificationsConfig) (*Notifier, error) {
+	n := NewNotifier()
+	if cfg.Cooldown != 0 {
+		n.Cooldown = cfg.Cooldown
+	}
+
+	if len(cfg.Channels) > 0 {
+		if err := offline.Check("notifications"); err != nil {
+			return nil, err
+		}
+	}
+	for i, channelCfg := range cfg.Channels {
+		factoriesMu.RLock()
+		factory, ok := factories[channelCfg.Type]
+		factoriesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("notification channel %d: unknown type %q (available: %v)", i, channelCfg.Type, ChannelTypes())
+		}
+
+		for _, trigger := range channelCfg.Triggers {
+			if !knownTrigger(trigger) {
+				return nil, fmt.Errorf("notification channel %d: unknown trigger %q", i, trigger)
+			}
+		}
+
+		channel, err := factory(channelCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure %s notification channel: %w", channelCfg.Type, err)
+		}
+		n.Add(channel, channelCfg.Triggers...)
+	}
+
+	return n, nil
+}
+
+func knownTrigger(trigger string) bool {
+	for _, t := range Triggers {
+		if t == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+// Add subscribes a channel to triggers; no triggers subscribes it to all
+func (n *Notifier) Add(channel Channel, triggers ...string) {
+	r := route{channel: channel, triggers: make(map[string]bool)}
+	for _, trigger := range triggers {
+		r.triggers[trigger] = true
+	}
+	n.routes = append(n.routes, r)
+}
+
+// Notify sends an event to every subscribed channel, unless the same event
+// was sent within the cooldown. Delivery errors are combined.
+func (n *Notifier) Notify(ctx context.Context, event Event) error {
+	if n == nil || len(n.routes) == 0 {
+		return nil
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Severity == "" {
+		event.Severity = SeverityWarning
+	}
+
+	if !n.claim(event) {
+		return nil
+	}
+
+	var failures []string
+	for _, r := range n.routes {
+		if !r.accepts(event.Trigger) {
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, n.Timeout)
+		err := r.channel.Send(sendCtx, event)
+		cancel()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", r.channel.Name(), err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to deliver notification: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// claim records that an event is being sent and reports whether it is outside
+// the cooldown
+func (n *Notifier) claim(event Event) bool {
+	if n.Cooldown <= 0 {
+		return true
+	}
+
+	key := event.Trigger + "\x00" + event.Key
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if last, ok := n.lastSent[key]; ok && event.Time.Sub(last) < n.Cooldown {
+		return false
+	}
+	n.lastSent[key] = event.Time
+	return true
+}
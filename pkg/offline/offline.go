@@ -0,0 +1,99 @@
+// Package offline implements offline mode, in which the ForgeAI process
+// makes no outbound network requests: no plugin registry calls, image
+// pulls, webhooks, notifications, or remote storage. Features that need the
+// network fail fast with ErrOffline instead of trying. Jobs are not
+// affected; whether they have network access is configured per job.
+package offline
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// EnvVar enables offline mode when set to true
+const EnvVar = "FORGEAI_OFFLINE"
+
+// ErrOffline is returned for everything offline mode refuses
+var ErrOffline = errors.New("outbound network access is disabled in offline mode")
+
+var (
+	enabled   atomic.Bool
+	guardOnce sync.Once
+)
+
+// Enable turns offline mode on or off for the process. Turning it on also
+// guards http.DefaultTransport, so that HTTP clients without a transport of
+// their own cannot reach other hosts than the local one either.
+func Enable(on bool) {
+	enabled.Store(on)
+	if on {
+		guardOnce.Do(func() {
+			http.DefaultTransport = &Transport{Base: http.DefaultTransport}
+		})
+	}
+}
+
+// Enabled reports whether offline mode is on
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// FromEnv reports whether EnvVar enables offline mode
+func FromEnv() bool {
+	return os.Getenv(EnvVar) == "true"
+}
+
+// Check returns an error wrapping ErrOffline that names what needs the
+// network in offline mode, and nil otherwise
+func Check(what string) error {
+	if !Enabled() {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", what, ErrOffline)
+}
+
+// CheckHost is Check for connections to host, which offline mode allows
+// when host is the local machine
+func CheckHost(what, host string) error {
+	if Local(host) {
+		return nil
+	}
+	return Check(what)
+}
+
+// Local reports whether host, with or without a port, is the local
+// machine: localhost or a loopback address
+func Local(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Transport refuses HTTP requests to other hosts than the local one in
+// offline mode and passes the others to Base
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip sends the request unless offline mode refuses it
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := CheckHost(req.Method+" "+req.URL.Redacted(), req.URL.Host); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.Base.RoundTrip(req)
+}
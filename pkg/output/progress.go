@@ -0,0 +1,136 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// progressWidth is the width of a progress bar in characters
+const progressWidth = 30
+
+// ProgressBar renders the progress of a long operation, such as a download
+// or an image pull. On a terminal it redraws one line; on other writers,
+// such as logs, it prints a line for every tenth of progress.
+type ProgressBar struct {
+	// Label names the operation
+	Label string
+
+	// Bytes formats progress as sizes rather than counts
+	Bytes bool
+
+	mu       sync.Mutex
+	w        io.Writer
+	terminal bool
+	printed  int64
+	finished bool
+}
+
+// NewProgressBar creates a progress bar writing to w
+func NewProgressBar(w io.Writer, label string) *ProgressBar {
+	f, ok := w.(*os.File)
+	return &ProgressBar{
+		Label:    label,
+		w:        w,
+		terminal: ok && IsTerminal(f),
+		printed:  -1,
+	}
+}
+
+// IsTerminal reports whether f is a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Update renders done out of total; a total of 0 or less is unknown
+func (b *ProgressBar) Update(done, total int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.finished {
+		return
+	}
+
+	if b.terminal {
+		fmt.Fprintf(b.w, "\r%s", b.line(done, total))
+		return
+	}
+	if total <= 0 {
+		return
+	}
+	step := done * 10 / total
+	if step > b.printed {
+		b.printed = step
+		fmt.Fprintf(b.w, "%s: %d%%\n", b.Label, percent(done, total))
+	}
+}
+
+// Done completes the progress bar at done out of total, also for
+// operations that failed before they completed
+func (b *ProgressBar) Done(done, total int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.finished {
+		return
+	}
+	b.finished = true
+
+	if b.terminal {
+		fmt.Fprintf(b.w, "\r%s\n", b.line(done, total))
+		return
+	}
+	if total <= 0 || done*10/total > b.printed {
+		fmt.Fprintf(b.w, "%s: %s\n", b.Label, b.amount(done, total))
+	}
+}
+
+// line renders the progress bar
+func (b *ProgressBar) line(done, total int64) string {
+	if total <= 0 {
+		return fmt.Sprintf("%s %s", b.Label, b.amount(done, total))
+	}
+	filled := int(done * progressWidth / total)
+	if filled > progressWidth {
+		filled = progressWidth
+	}
+	return fmt.Sprintf("%s [%s%s] %3d%% %s", b.Label,
+		strings.Repeat("=", filled), strings.Repeat(" ", progressWidth-filled),
+		percent(done, total), b.amount(done, total))
+}
+
+// amount formats done out of total
+func (b *ProgressBar) amount(done, total int64) string {
+	format := func(n int64) string { return fmt.Sprintf("%d", n) }
+	if b.Bytes {
+		format = formatSize
+	}
+	if total <= 0 {
+		return format(done)
+	}
+	return format(done) + "/" + format(total)
+}
+
+// percent returns done out of total as a percentage from 0 to 100
+func percent(done, total int64) int {
+	p := done * 100 / total
+	if p > 100 {
+		p = 100
+	}
+	return int(p)
+}
+
+// formatSize formats a size in bytes with a binary unit
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,389 @@
+package performance
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/workspace"
+)
+
+// Faults injected by the chaos executor
+const (
+	// FaultKill kills the program mid-run, like a docker kill
+	FaultKill = "kill"
+
+	// FaultSlowPull delays the start of the program, like a slow image pull
+	FaultSlowPull = "slow_pull"
+
+	// FaultNoSpace fails writing the workspace with ENOSPC
+	FaultNoSpace = "enospc"
+
+	// FaultWorkerCrash crashes the worker running the job
+	FaultWorkerCrash = "worker_crash"
+)
+
+// ChaosConfig configures a chaos test
+type ChaosConfig struct {
+	// Jobs is the number of jobs to submit and Workers how many run at once
+	Jobs    int
+	Workers int
+
+	// Retries is how often a job that failed from an injected fault is
+	// resubmitted
+	Retries int
+
+	// Faults is the probability from 0 to 1 of each fault per execution
+	Faults map[string]float64
+
+	// PullDelay is how long a slow pull takes and KillAfter how long a
+	// program runs before it is killed
+	PullDelay time.Duration
+	KillAfter time.Duration
+
+	// JobTimeout is how long a job may take to finish before it is reported
+	// as stuck
+	JobTimeout time.Duration
+
+	Seed int64
+}
+
+// DefaultChaosConfig returns a chaos test that injects every fault
+func DefaultChaosConfig() ChaosConfig {
+	return ChaosConfig{
+		Jobs:    20,
+		Workers: 4,
+		Retries: 2,
+		Faults: map[string]float64{
+			FaultKill:        0.15,
+			FaultSlowPull:    0.15,
+			FaultNoSpace:     0.1,
+			FaultWorkerCrash: 0.1,
+		},
+		PullDelay:  2 * time.Second,
+		KillAfter:  200 * time.Millisecond,
+		JobTimeout: time.Minute,
+		Seed:       time.Now().UnixNano(),
+	}
+}
+
+// ChaosReport is the outcome of a chaos test
+type ChaosReport struct {
+	Seed      int64
+	Attempts  int
+	Completed int
+	Failed    int
+	Retried   int
+	Recovered int
+	Injected  map[string]int
+	Duration  time.Duration
+
+	// Violations are job statuses or cleanup results that were wrong for
+	// the injected fault
+	Violations []string
+}
+
+// Passed reports whether the pipeline behaved correctly under every fault
+func (r *ChaosReport) Passed() bool {
+	return len(r.Violations) == 0
+}
+
+// RunChaos submits jobs to a job manager whose executor injects faults and
+// checks the status of every job, that failed jobs can be retried, and that
+// workers and workspaces are released afterwards
+func RunChaos(ctx context.Context, config ChaosConfig) (*ChaosReport, error) {
+	root, err := os.MkdirTemp("", "forgeai-chaos-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace root: %w", err)
+	}
+	defer os.RemoveAll(root)
+
+	workspaces := workspace.NewManager(root)
+	if _, err := workspaces.Open(); err != nil {
+		return nil, err
+	}
+
+	chaos := newChaosInjector(config)
+	manager := jobs.NewManager()
+	manager.Workers = config.Workers
+	manager.Workspaces = workspaces
+	manager.WrapExecutor = chaos.wrap
+
+	report := &ChaosReport{Seed: config.Seed, Injected: make(map[string]int)}
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < config.Jobs; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for attempt := 0; attempt <= config.Retries; attempt++ {
+				fault, job, violation := runChaosJob(ctx, manager, chaos, n, config.JobTimeout)
+
+				mu.Lock()
+				report.Attempts++
+				if fault != "" {
+					report.Injected[fault]++
+				}
+				if violation != "" {
+					report.Violations = append(report.Violations, violation)
+				}
+				succeeded := job != nil && job.Status == "completed" && job.Result != nil && job.Result.ExitCode == 0
+				if succeeded {
+					report.Completed++
+				} else {
+					report.Failed++
+				}
+				if attempt > 0 && succeeded {
+					report.Recovered++
+				}
+				retry := !succeeded && violation == "" && attempt < config.Retries
+				if retry {
+					report.Retried++
+				}
+				mu.Unlock()
+
+				if !retry {
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Crashed or killed jobs must not hold on to a worker or a workspace
+	chaos.stop()
+	if _, _, violation := runChaosJob(ctx, manager, chaos, -1, config.JobTimeout); violation != "" {
+		report.Violations = append(report.Violations, "worker slots were not released: "+violation)
+	}
+	if running := manager.ListJobs(jobs.Filter{Status: "running"}); len(running) > 0 {
+		report.Violations = append(report.Violations, fmt.Sprintf("%d jobs are still running", len(running)))
+	}
+	if stats := workspaces.Stats(); stats.Active > 0 {
+		report.Violations = append(report.Violations, fmt.Sprintf("%d workspaces were not released", stats.Active))
+	}
+	if entries, err := os.ReadDir(root); err == nil && len(entries) > 0 {
+		report.Violations = append(report.Violations, fmt.Sprintf("%d files were left in the workspace root", len(entries)))
+	}
+
+	sort.Strings(report.Violations)
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// runChaosJob runs job n and checks that its outcome matches the injected
+// fault
+func runChaosJob(ctx context.Context, manager *jobs.Manager, chaos *chaosInjector, n int, timeout time.Duration) (string, *jobs.Job, string) {
+	marker := fmt.Sprintf("chaos job %d", n)
+	job, err := manager.Submit(ctx, jobs.Spec{
+		Language: "python",
+		Code:     fmt.Sprintf("import time\ntime.sleep(1)\nprint(%q)", marker),
+		Labels:   map[string]string{"chaos": "true"},
+	})
+	if err != nil {
+		return "", nil, fmt.Sprintf("%s: submit failed: %v", marker, err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	job, err = manager.Wait(waitCtx, job.ID)
+	fault := chaos.fault(job.ID)
+	if err != nil {
+		return fault, job, fmt.Sprintf("%s (%s): stuck in status %s", job.ID, faultName(fault), job.Status)
+	}
+
+	return fault, job, checkChaosJob(job, fault, marker)
+}
+
+// checkChaosJob returns a violation when a finished job does not reflect the
+// fault injected into it
+func checkChaosJob(job *jobs.Job, fault, marker string) string {
+	violation := func(format string, args ...interface{}) string {
+		return fmt.Sprintf("%s (%s): ", job.ID, faultName(fault)) + fmt.Sprintf(format, args...)
+	}
+
+	switch fault {
+	case "", FaultSlowPull:
+		if job.Status != "completed" || job.Result == nil || job.Result.ExitCode != 0 {
+			return violation("expected a successful job, got status %s: %s", job.Status, job.Error)
+		}
+		if !strings.Contains(job.Result.Stdout, marker) {
+			return violation("output is missing %q", marker)
+		}
+	case FaultKill:
+		if job.Status == "completed" && job.Result != nil && job.Result.ExitCode == 0 {
+			return violation("a killed job was reported as successful")
+		}
+	case FaultNoSpace:
+		if job.Status != "setup_failed" || !strings.Contains(job.Error, syscall.ENOSPC.Error()) {
+			return violation("expected a setup failure reporting ENOSPC, got status %s: %s", job.Status, job.Error)
+		}
+	case FaultWorkerCrash:
+		if job.Status != "setup_failed" || !strings.Contains(job.Error, "worker crashed") {
+			return violation("expected a setup failure reporting the crash, got status %s: %s", job.Status, job.Error)
+		}
+	}
+	return ""
+}
+
+// faultName describes a fault for reports
+func faultName(fault string) string {
+	if fault == "" {
+		return "no fault"
+	}
+	return fault
+}
+
+// chaosInjector decides which fault to inject into each job
+type chaosInjector struct {
+	config ChaosConfig
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	faults  map[string]string
+	stopped bool
+}
+
+// newChaosInjector creates a fault injector
+func newChaosInjector(config ChaosConfig) *chaosInjector {
+	return &chaosInjector{
+		config: config,
+		rand:   rand.New(rand.NewSource(config.Seed)),
+		faults: make(map[string]string),
+	}
+}
+
+// wrap implements jobs.Manager.WrapExecutor
+func (c *chaosInjector) wrap(job *jobs.Job, exec sandbox.Executor) sandbox.Executor {
+	return &chaosExecutor{Executor: exec, chaos: c, jobID: job.ID}
+}
+
+// stop ends fault injection
+func (c *chaosInjector) stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+}
+
+// pick chooses the fault for a job, or none
+func (c *chaosInjector) pick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return ""
+	}
+
+	faults := make([]string, 0, len(c.config.Faults))
+	for fault := range c.config.Faults {
+		faults = append(faults, fault)
+	}
+	sort.Strings(faults)
+
+	roll := c.rand.Float64()
+	for _, fault := range faults {
+		if roll < c.config.Faults[fault] {
+			return fault
+		}
+		roll -= c.config.Faults[fault]
+	}
+	return ""
+}
+
+// record notes the fault that was injected into a job
+func (c *chaosInjector) record(jobID, fault string) {
+	c.mu.Lock()
+	c.faults[jobID] = fault
+	c.mu.Unlock()
+}
+
+// fault returns the fault that was injected into a job
+func (c *chaosInjector) fault(jobID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.faults[jobID]
+}
+
+// chaosExecutor injects a fault into the execution of one job
+type chaosExecutor struct {
+	sandbox.Executor
+	chaos *chaosInjector
+	jobID string
+}
+
+// Execute implements sandbox.Executor
+func (e *chaosExecutor) Execute(ctx context.Context, language, code string) (*sandbox.ExecutionResult, error) {
+	switch fault := e.chaos.pick(); fault {
+	case FaultSlowPull:
+		e.chaos.record(e.jobID, fault)
+		select {
+		case <-time.After(e.chaos.config.PullDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	case FaultNoSpace:
+		e.chaos.record(e.jobID, fault)
+		err := &os.PathError{Op: "write", Path: "main.py", Err: syscall.ENOSPC}
+		return nil, fmt.Errorf("failed to write code to file: %w", err)
+	case FaultKill:
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		timer := time.AfterFunc(e.chaos.config.KillAfter, func() {
+			e.chaos.record(e.jobID, FaultKill)
+			cancel()
+		})
+		defer timer.Stop()
+		return e.Executor.Execute(ctx, language, code)
+	case FaultWorkerCrash:
+		e.chaos.record(e.jobID, fault)
+		result, err := e.Executor.Execute(ctx, language, code)
+		panic(fmt.Sprintf("chaos: worker crashed after execution (exit code %v, error %v)", exitCode(result), err))
+	}
+
+	return e.Executor.Execute(ctx, language, code)
+}
+
+// exitCode returns the exit code of result, or -1 without a result
+func exitCode(result *sandbox.ExecutionResult) int {
+	if result == nil {
+		return -1
+	}
+	return result.ExitCode
+}
+
+// GenerateChaosReport formats a chaos report
+func GenerateChaosReport(report *ChaosReport) string {
+	result := "Chaos Testing Report\n"
+	result += "====================\n\n"
+	result += fmt.Sprintf("Seed: %d\n", report.Seed)
+	result += fmt.Sprintf("Duration: %v\n", report.Duration.Round(time.Millisecond))
+	result += fmt.Sprintf("Attempts: %d (%d completed, %d failed)\n", report.Attempts, report.Completed, report.Failed)
+	result += fmt.Sprintf("Retried: %d, recovered: %d\n\n", report.Retried, report.Recovered)
+
+	result += "Injected faults:\n"
+	faults := make([]string, 0, len(report.Injected))
+	for fault := range report.Injected {
+		faults = append(faults, fault)
+	}
+	sort.Strings(faults)
+	for _, fault := range faults {
+		result += fmt.Sprintf("  %s: %d\n", fault, report.Injected[fault])
+	}
+
+	if report.Passed() {
+		result += "\nAll jobs behaved correctly under faults\n"
+		return result
+	}
+	result += fmt.Sprintf("\nViolations (%d):\n", len(report.Violations))
+	for _, violation := range report.Violations {
+		result += "  " + violation + "\n"
+	}
+	return result
+}
@@ -0,0 +1,325 @@
+package performance
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Soak test series sampled from the server's /metrics and the local host
+const (
+	SeriesGoroutines = "go_goroutines"
+	SeriesOpenFDs    = "process_open_fds"
+	SeriesTempDirs   = "forgeai_temp_dirs"
+	SeriesContainers = "containers"
+)
+
+// DefaultLeakBuckets is how many consecutive windows a series must rise
+// through to count as a leak
+const DefaultLeakBuckets = 5
+
+// SoakConfig configures a soak test
+type SoakConfig struct {
+	// Server is the base URL of the API server under test
+	Server string
+
+	Duration time.Duration
+
+	// Interval is how often resource use is sampled
+	Interval time.Duration
+
+	// Concurrency is how many executions run at once
+	Concurrency int
+
+	Language string
+	Code     string
+
+	// LeakBuckets splits the samples into windows; a series leaks when the
+	// minimum of every window is above that of the one before
+	LeakBuckets int
+}
+
+// DefaultSoakConfig returns a two hour soak test against a local server
+func DefaultSoakConfig() SoakConfig {
+	return SoakConfig{
+		Server:      "http://localhost:8080",
+		Duration:    2 * time.Hour,
+		Interval:    30 * time.Second,
+		Concurrency: 4,
+		Language:    "python",
+		Code:        "print('soak')",
+		LeakBuckets: DefaultLeakBuckets,
+	}
+}
+
+// SoakSeries is one sampled resource
+type SoakSeries struct {
+	Name    string
+	Samples []float64
+	Leaking bool
+}
+
+// SoakReport is the outcome of a soak test
+type SoakReport struct {
+	Duration   time.Duration
+	Executions int64
+	Failures   int64
+	Series     []SoakSeries
+
+	// Notes explain series that could not be sampled or judged
+	Notes []string
+}
+
+// Leaks returns the names of the series that grew monotonically
+func (r *SoakReport) Leaks() []string {
+	var leaks []string
+	for _, series := range r.Series {
+		if series.Leaking {
+			leaks = append(leaks, series.Name)
+		}
+	}
+	return leaks
+}
+
+// RunSoak runs executions against the server for the configured duration
+// while sampling its goroutines, file descriptors, and temp directories and
+// the containers on this host
+func RunSoak(ctx context.Context, config SoakConfig) (*SoakReport, error) {
+	client := &http.Client{Timeout: time.Minute}
+	server := strings.TrimRight(config.Server, "/")
+
+	// Fail early when the server is unreachable or has no process metrics
+	if _, err := sampleServer(ctx, client, server); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	report := &SoakReport{}
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				err := soakExecute(ctx, client, server, config.Language, config.Code)
+				if ctx.Err() != nil {
+					return
+				}
+				atomic.AddInt64(&report.Executions, 1)
+				if err != nil {
+					atomic.AddInt64(&report.Failures, 1)
+				}
+			}
+		}()
+	}
+
+	samples := make(map[string][]float64)
+	notes := make(map[string]bool)
+	sample := func() {
+		values, err := sampleServer(context.Background(), client, server)
+		if err != nil {
+			notes[fmt.Sprintf("sampling failed: %v", err)] = true
+		}
+		for name, value := range values {
+			samples[name] = append(samples[name], value)
+		}
+		if count, err := countContainers(); err == nil {
+			samples[SeriesContainers] = append(samples[SeriesContainers], float64(count))
+		} else {
+			notes[fmt.Sprintf("containers not sampled: %v", err)] = true
+		}
+	}
+
+	ticker := time.NewTicker(config.Interval)
+	sample()
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+			sample()
+		}
+	}
+	ticker.Stop()
+	wg.Wait()
+
+	// Sample once more after the load stops and the server has cleaned up
+	// cancelled executions, so that resources still held when idle show up
+	time.Sleep(config.Interval)
+	sample()
+
+	for _, name := range []string{SeriesGoroutines, SeriesOpenFDs, SeriesTempDirs, SeriesContainers} {
+		values, ok := samples[name]
+		if !ok {
+			continue
+		}
+		if len(values) < 2*config.LeakBuckets {
+			notes[fmt.Sprintf("%s: %d samples are too few to detect a leak", name, len(values))] = true
+		}
+		report.Series = append(report.Series, SoakSeries{
+			Name:    name,
+			Samples: values,
+			Leaking: GrowsMonotonically(values, config.LeakBuckets),
+		})
+	}
+	for note := range notes {
+		report.Notes = append(report.Notes, note)
+	}
+	sort.Strings(report.Notes)
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// GrowsMonotonically reports whether samples keep rising. The samples are
+// split into buckets windows and the series grows when the minimum of every
+// window is above the minimum of the previous one, which ignores the spikes
+// of individual executions. Fewer than two samples per window never grow.
+func GrowsMonotonically(samples []float64, buckets int) bool {
+	if buckets < 2 || len(samples) < 2*buckets {
+		return false
+	}
+
+	size := len(samples) / buckets
+	previous := 0.0
+	for b := 0; b < buckets; b++ {
+		window := samples[b*size : (b+1)*size]
+		if b == buckets-1 {
+			window = samples[b*size:]
+		}
+
+		min := window[0]
+		for _, value := range window[1:] {
+			if value < min {
+				min = value
+			}
+		}
+		if b > 0 && min <= previous {
+			return false
+		}
+		previous = min
+	}
+	return true
+}
+
+// soakExecute runs code synchronously on the server
+func soakExecute(ctx context.Context, client *http.Client, server, language, code string) error {
+	body, _ := json.Marshal(map[string]interface{}{"language": language, "code": code})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server+"/v1/execute/sync", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute code: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("execution returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sampleServer reads the process gauges from the server's /metrics
+func sampleServer(ctx context.Context, client *http.Client, server string) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server+"/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read server metrics: %s", resp.Status)
+	}
+
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case SeriesGoroutines, SeriesOpenFDs, SeriesTempDirs:
+			if value, err := strconv.ParseFloat(fields[1], 64); err == nil {
+				values[fields[0]] = value
+			}
+		}
+	}
+	if _, ok := values[SeriesGoroutines]; !ok {
+		return nil, fmt.Errorf("server metrics do not include %s", SeriesGoroutines)
+	}
+	return values, scanner.Err()
+}
+
+// countContainers counts all containers on this host, running or not
+func countContainers() (int, error) {
+	output, err := exec.Command("docker", "ps", "-a", "-q").Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list containers: %w", err)
+	}
+	return len(strings.Fields(string(output))), nil
+}
+
+// GenerateSoakReport formats a soak report
+func GenerateSoakReport(report *SoakReport) string {
+	result := "Soak Testing Report\n"
+	result += "===================\n\n"
+	result += fmt.Sprintf("Duration: %v\n", report.Duration.Round(time.Second))
+	result += fmt.Sprintf("Executions: %d (%d failed)\n\n", report.Executions, report.Failures)
+
+	result += "Resources (first / min / max / last):\n"
+	for _, series := range report.Series {
+		min, max := series.Samples[0], series.Samples[0]
+		for _, value := range series.Samples {
+			if value < min {
+				min = value
+			}
+			if value > max {
+				max = value
+			}
+		}
+		status := "ok"
+		if series.Leaking {
+			status = "LEAK: grows monotonically"
+		}
+		result += fmt.Sprintf("  %s: %g / %g / %g / %g  %s\n", series.Name,
+			series.Samples[0], min, max, series.Samples[len(series.Samples)-1], status)
+	}
+
+	if len(report.Notes) > 0 {
+		result += "\nNotes:\n"
+		for _, note := range report.Notes {
+			result += "  " + note + "\n"
+		}
+	}
+
+	if leaks := report.Leaks(); len(leaks) > 0 {
+		result += fmt.Sprintf("\nLeaks detected: %s\n", strings.Join(leaks, ", "))
+	} else {
+		result += "\nNo leaks detected\n"
+	}
+	return result
+}
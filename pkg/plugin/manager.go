@@ -7,7 +7,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
+	"forgeai/pkg/languages"
 	"forgeai/pkg/sandbox"
 )
 
@@ -90,6 +92,15 @@ func (e *ExternalExecutor) SupportedLanguages() []string {
 	return e.languages
 }
 
+// Capabilities reports no guarantees because plugins do not declare them
+func (e *ExternalExecutor) Capabilities() sandbox.Capabilities {
+	return sandbox.Capabilities{
+		Backend:   "plugin:" + filepath.Base(e.binaryPath),
+		Available: true,
+		Notes:     []string{"plugins do not report their capabilities"},
+	}
+}
+
 // Manager handles plugin loading and management
 type Manager struct {
 	plugins map[string]Executor
@@ -130,9 +141,10 @@ func (m *Manager) LoadPlugin(pluginDir string) error {
 	// Create the executor
 	executor := NewExternalExecutor(binaryPath, manifest.Languages)
 	
-	// Register the executor for each supported language
+	// Register the executor for each supported language, by its
+	// canonical name when the manifest uses an alias
 	for _, lang := range manifest.Languages {
-		m.plugins[lang] = executor
+		m.plugins[languages.Normalize(lang)] = executor
 	}
 	
 	return nil
@@ -154,7 +166,7 @@ func (m *Manager) LoadPluginsFromDir(dir string) error {
 
 	// Load each plugin
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() && !hidden(entry.Name()) {
 			pluginDir := filepath.Join(dir, entry.Name())
 			if err := m.LoadPlugin(pluginDir); err != nil {
 				// Log error but continue loading other plugins
@@ -166,9 +178,10 @@ func (m *Manager) LoadPluginsFromDir(dir string) error {
 	return nil
 }
 
-// GetExecutor returns the executor for the specified language
+// GetExecutor returns the executor for the specified language or one of
+// its aliases
 func (m *Manager) GetExecutor(language string) (Executor, bool) {
-	executor, ok := m.plugins[language]
+	executor, ok := m.plugins[languages.Normalize(language)]
 	return executor, ok
 }
 
@@ -197,10 +210,16 @@ func (m *Manager) ListPlugins(dir string) ([]string, error) {
 	// Collect plugin names
 	plugins := make([]string, 0, len(entries))
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() && !hidden(entry.Name()) {
 			plugins = append(plugins, entry.Name())
 		}
 	}
 
 	return plugins, nil
-}
\ No newline at end of file
+}
+// hidden reports whether a directory entry is hidden. Hidden entries of a
+// plugin directory hold install state, such as staged installs and previous
+// versions, rather than plugins.
+func hidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,157 @@
+package plugin
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/template"
+
+	"forgeai/pkg/languages"
+)
+
+// scaffoldTemplates are the files of a new plugin, named by their file
+// name with a .tmpl suffix
+//
+//go:embed scaffold/*.tmpl
+var scaffoldTemplates embed.FS
+
+// scaffoldFiles maps the templates to the files they generate
+var scaffoldFiles = []struct{ template, file string }{
+	{"manifest.json.tmpl", "manifest.json"},
+	{"go.mod.tmpl", "go.mod"},
+	{"main.go.tmpl", "main.go"},
+	{"main_test.go.tmpl", "main_test.go"},
+	{"Makefile.tmpl", "Makefile"},
+	{"goreleaser.yaml.tmpl", ".goreleaser.yaml"},
+}
+
+// nameRe matches plugin names, which are also the names of their binaries
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Toolchain is how a generated plugin builds and runs programs. Commands
+// may refer to the source file as {file} and the compiled binary as
+// {binary}.
+type Toolchain struct {
+	// Extension is the file extension of source files
+	Extension string
+
+	// Build compiles {file} to {binary}; nil for interpreted languages
+	Build []string
+
+	// Run runs the program
+	Run []string
+
+	// Hello is a program printing "Hello, World!" that the tests of the
+	// plugin run; the test is skipped when empty
+	Hello string
+}
+
+// Toolchains are the toolchains of the languages that Scaffold knows.
+// Plugins of other languages run <language> {file}, which their authors
+// adjust.
+var Toolchains = map[string]Toolchain{
+	"rust": {
+		Extension: ".rs",
+		Build:     []string{"rustc", "-O", "-o", "{binary}", "{file}"},
+		Run:       []string{"{binary}"},
+		Hello:     "fn main() {\n    println!(\"Hello, World!\");\n}\n",
+	},
+	"c": {
+		Extension: ".c",
+		Build:     []string{"cc", "-O2", "-o", "{binary}", "{file}"},
+		Run:       []string{"{binary}"},
+		Hello:     "#include <stdio.h>\n\nint main(void) {\n    printf(\"Hello, World!\\n\");\n    return 0;\n}\n",
+	},
+	"cpp": {
+		Extension: ".cpp",
+		Build:     []string{"c++", "-O2", "-o", "{binary}", "{file}"},
+		Run:       []string{"{binary}"},
+		Hello:     "#include <iostream>\n\nint main() {\n    std::cout << \"Hello, World!\" << std::endl;\n}\n",
+	},
+	"ruby": {
+		Extension: ".rb",
+		Run:       []string{"ruby", "{file}"},
+		Hello:     "puts \"Hello, World!\"\n",
+	},
+	"lua": {
+		Extension: ".lua",
+		Run:       []string{"lua", "{file}"},
+		Hello:     "print(\"Hello, World!\")\n",
+	},
+	"perl": {
+		Extension: ".pl",
+		Run:       []string{"perl", "{file}"},
+		Hello:     "print \"Hello, World!\\n\";\n",
+	},
+	"php": {
+		Extension: ".php",
+		Run:       []string{"php", "{file}"},
+		Hello:     "<?php\necho \"Hello, World!\\n\";\n",
+	},
+}
+
+// ScaffoldOptions describe a new plugin
+type ScaffoldOptions struct {
+	// Name is the name of the plugin and its binary
+	Name string
+
+	// Language is the language the plugin runs; aliases are normalized
+	Language string
+
+	// Module is the Go module path of the plugin; Name when empty
+	Module string
+}
+
+// Scaffold generates a working plugin in dir: its manifest, a main.go
+// implementing the executor protocol of ExternalExecutor, tests, a
+// Makefile, and a GoReleaser configuration. It refuses to write into a
+// directory that is not empty, and returns the files it wrote.
+func Scaffold(dir string, opts ScaffoldOptions) ([]string, error) {
+	if !nameRe.MatchString(opts.Name) {
+		return nil, fmt.Errorf("invalid plugin name %q: use letters, digits, dots, dashes, and underscores", opts.Name)
+	}
+	if !nameRe.MatchString(opts.Language) {
+		return nil, fmt.Errorf("invalid language %q", opts.Language)
+	}
+	if opts.Module == "" {
+		opts.Module = opts.Name
+	}
+	language := languages.Normalize(opts.Language)
+	toolchain, ok := Toolchains[language]
+	if !ok {
+		toolchain = Toolchain{Extension: "." + language, Run: []string{language, "{file}"}}
+	}
+
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s is not empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create plugin directory: %w", err)
+	}
+
+	data := struct {
+		Name, Language, Module string
+		Toolchain              Toolchain
+	}{opts.Name, language, opts.Module, toolchain}
+
+	tmpl, err := template.ParseFS(scaffoldTemplates, "scaffold/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	var written []string
+	for _, f := range scaffoldFiles {
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, f.template, data); err != nil {
+			return written, fmt.Errorf("failed to generate %s: %w", f.file, err)
+		}
+		path := filepath.Join(dir, f.file)
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", f.file, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
@@ -0,0 +1,89 @@
+// Package profile measures the memory and CPU use of executed code and
+// records flamegraphs with sampling profilers where they are installed.
+package profile
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"forgeai/pkg/sandbox"
+)
+
+// TimePath is GNU time, whose verbose report includes the peak RSS
+const TimePath = "/usr/bin/time"
+
+// Available reports whether GNU time is installed on the host. Without it
+// the resource usage reported by the kernel for the child is used.
+func Available() bool {
+	_, err := exec.LookPath(TimePath)
+	return err == nil
+}
+
+// Supported reports whether executions can be profiled on this host
+func Supported() bool {
+	return rusageSupported || Available()
+}
+
+// Wrap prefixes a command with GNU time so that its resource usage is
+// written to outFile
+func Wrap(cmdArgs []string, outFile string) []string {
+	return append([]string{TimePath, "-v", "-o", outFile}, cmdArgs...)
+}
+
+// Parse converts the verbose report of GNU time into a Profile
+func Parse(data []byte) *sandbox.Profile {
+	p := &sandbox.Profile{Source: "time"}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		i := strings.LastIndex(scanner.Text(), ": ")
+		if i < 0 {
+			continue
+		}
+		key := strings.TrimSpace(scanner.Text()[:i])
+		value := strings.TrimSpace(scanner.Text()[i+2:])
+
+		switch key {
+		case "User time (seconds)":
+			p.UserTime, _ = strconv.ParseFloat(value, 64)
+		case "System time (seconds)":
+			p.SystemTime, _ = strconv.ParseFloat(value, 64)
+		case "Percent of CPU this job got":
+			p.CPUPercent, _ = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		case "Maximum resident set size (kbytes)":
+			kb, _ := strconv.ParseInt(value, 10, 64)
+			p.PeakRSS = kb * 1024
+		case "Major (requiring I/O) page faults":
+			p.MajorPageFaults, _ = strconv.ParseInt(value, 10, 64)
+		case "Voluntary context switches", "Involuntary context switches":
+			n, _ := strconv.ParseInt(value, 10, 64)
+			p.ContextSwitches += n
+		}
+	}
+	return p
+}
+
+// FlamegraphAvailable reports whether a flamegraph can be recorded for
+// programs in language. Python is sampled with py-spy.
+func FlamegraphAvailable(language string) bool {
+	if language != "python" {
+		return false
+	}
+	_, err := exec.LookPath("py-spy")
+	return err == nil
+}
+
+// WrapFlamegraph prefixes a command with py-spy so that a flamegraph of the
+// program and its child processes is written to outFile as SVG
+func WrapFlamegraph(cmdArgs []string, outFile string) []string {
+	args := []string{
+		"py-spy", "record",
+		"--subprocesses",
+		"--format", "flamegraph",
+		"--output", outFile,
+		"--",
+	}
+	return append(args, cmdArgs...)
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package profile
+
+import (
+	"os"
+	"time"
+
+	"forgeai/pkg/sandbox"
+)
+
+// rusageSupported reports whether processes report their resource usage
+const rusageSupported = false
+
+// FromProcessState returns nil because resource usage is not reported on
+// this platform
+func FromProcessState(state *os.ProcessState, wall time.Duration) *sandbox.Profile {
+	return nil
+}
@@ -0,0 +1,44 @@
+//go:build linux || darwin
+
+package profile
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+
+	"forgeai/pkg/sandbox"
+)
+
+// rusageSupported reports whether processes report their resource usage
+const rusageSupported = true
+
+// FromProcessState builds a Profile from the resource usage the kernel
+// reported for a finished process, including the children it waited for
+func FromProcessState(state *os.ProcessState, wall time.Duration) *sandbox.Profile {
+	if state == nil {
+		return nil
+	}
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return nil
+	}
+
+	p := &sandbox.Profile{
+		Source:          "rusage",
+		UserTime:        state.UserTime().Seconds(),
+		SystemTime:      state.SystemTime().Seconds(),
+		PeakRSS:         int64(usage.Maxrss),
+		MajorPageFaults: int64(usage.Majflt),
+		ContextSwitches: int64(usage.Nvcsw + usage.Nivcsw),
+	}
+	// Linux reports the peak RSS in kilobytes and macOS in bytes
+	if runtime.GOOS == "linux" {
+		p.PeakRSS *= 1024
+	}
+	if wall > 0 {
+		p.CPUPercent = float64(int(100*(p.UserTime+p.SystemTime)/wall.Seconds() + 0.5))
+	}
+	return p
+}
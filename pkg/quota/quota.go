@@ -0,0 +1,564 @@
+// Package quota meters what each key, such as a tenant or a user, consumes
+// over sliding windows: executions per hour, CPU-seconds per day, artifact
+// bytes per month, or any other metric and window. Usage is kept in
+// buckets, so that it expires gradually rather than resetting at fixed
+// times, and a key that runs out learns when enough of it expires to
+// continue.
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics of jobs
+const (
+	Executions    = "executions"
+	CPUSeconds    = "cpu_seconds"
+	ArtifactBytes = "artifact_bytes"
+)
+
+// buckets is how many buckets a window is divided into
+const buckets = 60
+
+// ErrExceeded is wrapped by the errors of requests beyond a quota
+var ErrExceeded = errors.New("quota exceeded")
+
+// Limit caps a metric over a sliding window
+type Limit struct {
+	Metric string        `json:"metric"`
+	Limit  float64       `json:"limit"`
+	Window time.Duration `json:"window"`
+
+	// Burst lets a key exceed Limit by up to Burst for one window, after
+	// which it must keep within Limit for a window before it may burst
+	// again
+	Burst float64 `json:"burst,omitempty"`
+}
+
+// limitJSON is how limits are encoded, with windows such as "1h"
+type limitJSON struct {
+	Metric string  `json:"metric"`
+	Limit  float64 `json:"limit"`
+	Window string  `json:"window"`
+	Burst  float64 `json:"burst,omitempty"`
+}
+
+// MarshalJSON encodes the window as a duration string
+func (l Limit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(limitJSON{Metric: l.Metric, Limit: l.Limit, Window: l.Window.String(), Burst: l.Burst})
+}
+
+// UnmarshalJSON decodes windows such as "1h" or "720h"
+func (l *Limit) UnmarshalJSON(data []byte) error {
+	var v limitJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	window, err := time.ParseDuration(v.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window %q: %w", v.Window, err)
+	}
+	*l = Limit{Metric: v.Metric, Limit: v.Limit, Window: window, Burst: v.Burst}
+	return nil
+}
+
+// Validate checks that a limit is usable
+func (l Limit) Validate() error {
+	if l.Metric == "" {
+		return errors.New("quota metric is required")
+	}
+	if l.Limit < 0 || l.Burst < 0 {
+		return fmt.Errorf("quota %s: limit and burst must not be negative", l.Metric)
+	}
+	if l.Window < buckets*time.Millisecond {
+		return fmt.Errorf("quota %s: window must be at least %s", l.Metric, buckets*time.Millisecond)
+	}
+	return nil
+}
+
+// id identifies the limit among the limits of a key
+func (l Limit) id() string {
+	return l.Metric + "/" + l.Window.String()
+}
+
+// Usage is how much of a limit a key has used
+type Usage struct {
+	Limit Limit `json:"limit"`
+
+	Used      float64 `json:"used"`
+	Remaining float64 `json:"remaining"`
+
+	// BurstAvailable is true while the key may use its burst allowance
+	BurstAvailable bool `json:"burst_available"`
+
+	// ResetAt is when usage next expires, or the zero time when there is
+	// none
+	ResetAt time.Time `json:"reset_at,omitempty"`
+}
+
+// ExceededError reports a request beyond a limit
+type ExceededError struct {
+	Key   string
+	Usage Usage
+
+	// RetryAt is when enough usage will have expired for the request
+	RetryAt time.Time
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s: %s used %g of %g %s per %s; retry at %s",
+		ErrExceeded, e.Key, e.Usage.Used, e.Usage.Limit.Limit, e.Usage.Limit.Metric, e.Usage.Limit.Window,
+		e.RetryAt.UTC().Format(time.RFC3339))
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrExceeded
+}
+
+// pruneInterval is how often idle windows are evicted
+const pruneInterval = time.Minute
+
+// window holds the usage of one limit of one key
+type window struct {
+	// amounts are the usage of each bucket, starting at bucket index
+	// start; buckets are Window/buckets long
+	amounts [buckets]float64
+	start   int64
+
+	// span is the Window of the limit
+	span time.Duration
+
+	// burstStart is when the key last began using its burst allowance
+	burstStart time.Time
+}
+
+// Manager meters usage against default limits and per-key overrides
+type Manager struct {
+	// Limits apply to keys without an override
+	Limits []Limit
+
+	// Path is the JSON file overrides are kept in; in memory only when
+	// empty
+	Path string
+
+	// Now returns the current time; time.Now when nil
+	Now func() time.Time
+
+	mu        sync.Mutex
+	overrides map[string][]Limit
+	windows   map[string]map[string]*window
+	pruned    time.Time
+}
+
+// NewManager creates a manager with default limits
+func NewManager(limits []Limit) *Manager {
+	return &Manager{
+		Limits:    limits,
+		overrides: map[string][]Limit{},
+		windows:   map[string]map[string]*window{},
+	}
+}
+
+// Open loads the overrides from their file, if it exists
+func (m *Manager) Open() error {
+	for _, limit := range m.Limits {
+		if err := limit.Validate(); err != nil {
+			return err
+		}
+	}
+	if m.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read quota overrides: %w", err)
+	}
+	overrides := map[string][]Limit{}
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("invalid quota overrides %s: %w", m.Path, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overrides = overrides
+	return nil
+}
+
+// save writes the overrides to their file. The caller holds m.mu.
+func (m *Manager) save() error {
+	if m.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(m.overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create quota directory: %w", err)
+	}
+	tmp := m.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write quota overrides: %w", err)
+	}
+	return os.Rename(tmp, m.Path)
+}
+
+func (m *Manager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// limits returns the limits of a key. The caller holds m.mu.
+func (m *Manager) limits(key string) []Limit {
+	if limits, ok := m.overrides[key]; ok {
+		return limits
+	}
+	return m.Limits
+}
+
+// window returns the usage of a limit of a key, advanced to now. The
+// caller holds m.mu.
+func (m *Manager) window(key string, limit Limit, now time.Time) *window {
+	windows, ok := m.windows[key]
+	if !ok {
+		windows = map[string]*window{}
+		m.windows[key] = windows
+	}
+	w, ok := windows[limit.id()]
+	if !ok {
+		w = &window{span: limit.Window}
+		windows[limit.id()] = w
+	}
+
+	// Drop the buckets that have left the window
+	size := int64(limit.Window / buckets)
+	current := now.UnixNano() / size
+	if shift := current - (w.start + buckets - 1); shift > 0 {
+		if shift >= buckets {
+			w.amounts = [buckets]float64{}
+		} else {
+			copy(w.amounts[:], w.amounts[shift:])
+			for i := buckets - int(shift); i < buckets; i++ {
+				w.amounts[i] = 0
+			}
+		}
+		w.start += shift
+	}
+	return w
+}
+
+// idle reports whether a window holds no usage and no burst that has yet
+// to cool down, so that forgetting it changes nothing
+func (w *window) idle(now time.Time) bool {
+	size := int64(w.span / buckets)
+	if now.UnixNano()/size < w.start+2*buckets-1 {
+		for _, amount := range w.amounts {
+			if amount > 0 {
+				return false
+			}
+		}
+	}
+	return w.burstStart.IsZero() || !now.Before(w.burstStart.Add(2*w.span))
+}
+
+// prune evicts idle windows, at most every pruneInterval, so that keys
+// that stop making requests, such as the addresses of anonymous callers,
+// are not kept forever. The caller holds m.mu.
+func (m *Manager) prune(now time.Time) {
+	if now.Sub(m.pruned) < pruneInterval {
+		return
+	}
+	m.pruned = now
+	for key, windows := range m.windows {
+		for id, w := range windows {
+			if w.idle(now) {
+				delete(windows, id)
+			}
+		}
+		if len(windows) == 0 {
+			delete(m.windows, key)
+		}
+	}
+}
+
+// used returns the usage in a window
+func (w *window) used() float64 {
+	var total float64
+	for _, amount := range w.amounts {
+		total += amount
+	}
+	return total
+}
+
+// burstAvailable reports whether a key may use its burst allowance: it is
+// bursting, or it has not burst for two windows
+func (w *window) burstAvailable(limit Limit, now time.Time) bool {
+	if limit.Burst <= 0 {
+		return false
+	}
+	return w.burstStart.IsZero() || now.Before(w.burstStart.Add(limit.Window)) ||
+		!now.Before(w.burstStart.Add(2*limit.Window))
+}
+
+// capacity returns how much a key may use in a window now
+func (w *window) capacity(limit Limit, now time.Time) float64 {
+	if w.burstAvailable(limit, now) {
+		return limit.Limit + limit.Burst
+	}
+	return limit.Limit
+}
+
+// expires returns when bucket i leaves the window
+func (w *window) expires(limit Limit, i int) time.Time {
+	size := int64(limit.Window / buckets)
+	return time.Unix(0, (w.start+int64(i))*size).Add(limit.Window)
+}
+
+// expiry returns when enough usage will have left the window for the rest
+// to fit, the current time when it already does, or the zero time when it
+// never will
+func (w *window) expiry(limit Limit, now time.Time, fits func(used float64) bool) time.Time {
+	remaining := w.used()
+	if fits(remaining) {
+		return now
+	}
+	for i, amount := range w.amounts {
+		remaining -= amount
+		if amount > 0 && fits(remaining) {
+			return w.expires(limit, i)
+		}
+	}
+	return time.Time{}
+}
+
+// usage reports a window
+func (w *window) usage(limit Limit, now time.Time) Usage {
+	u := Usage{Limit: limit, Used: w.used(), BurstAvailable: w.burstAvailable(limit, now)}
+	u.Remaining = w.capacity(limit, now) - u.Used
+	if u.Remaining < 0 {
+		u.Remaining = 0
+	}
+	for i, amount := range w.amounts {
+		if amount > 0 {
+			u.ResetAt = w.expires(limit, i).UTC()
+			break
+		}
+	}
+	return u
+}
+
+// Check reports whether a key may use amount of a metric under every
+// limit of the metric, without using it. An amount of zero checks that
+// the key has not used up the metric. Errors are *ExceededError.
+func (m *Manager) Check(key, metric string, amount float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.check(key, metric, amount, m.now())
+}
+
+func (m *Manager) check(key, metric string, amount float64, now time.Time) error {
+	for _, limit := range m.limits(key) {
+		if limit.Metric != metric {
+			continue
+		}
+		w := m.window(key, limit, now)
+		fits := func(capacity float64) func(float64) bool {
+			return func(used float64) bool {
+				if amount == 0 {
+					return used < capacity
+				}
+				return used+amount <= capacity
+			}
+		}
+		capacity := w.capacity(limit, now)
+		if fits(capacity)(w.used()) {
+			continue
+		}
+
+		// Find when the request fits, allowing for the burst allowance
+		// ending and returning after its cool-down
+		retry := w.expiry(limit, now, fits(capacity))
+		if limit.Burst > 0 && !w.burstStart.IsZero() {
+			burstEnd, cooldownEnd := w.burstStart.Add(limit.Window), w.burstStart.Add(2*limit.Window)
+			if retry.IsZero() || retry.After(burstEnd) || !w.burstAvailable(limit, now) {
+				retry = w.expiry(limit, now, fits(limit.Limit))
+				alt := w.expiry(limit, now, fits(limit.Limit+limit.Burst))
+				if !alt.IsZero() && alt.Before(cooldownEnd) {
+					alt = cooldownEnd
+				}
+				if retry.IsZero() || (!alt.IsZero() && alt.Before(retry)) {
+					retry = alt
+				}
+			}
+		}
+		if retry.IsZero() {
+			retry = now.Add(limit.Window)
+		}
+		return &ExceededError{Key: key, Usage: w.usage(limit, now), RetryAt: retry.UTC()}
+	}
+	return nil
+}
+
+// Reserve uses amount of a metric for a key when every limit of the metric
+// allows it, checking and using it at once so that concurrent requests
+// cannot all pass a check before any of them is counted. Errors are
+// *ExceededError. Release returns a reservation that goes unused.
+func (m *Manager) Reserve(key, metric string, amount float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if err := m.check(key, metric, amount, now); err != nil {
+		return err
+	}
+	m.use(key, metric, amount, now)
+	return nil
+}
+
+// Release returns amount of a metric that a key reserved but did not use.
+// It is taken from the newest usage still in each window.
+func (m *Manager) Release(key, metric string, amount float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for _, limit := range m.limits(key) {
+		if limit.Metric != metric {
+			continue
+		}
+		w := m.window(key, limit, now)
+		remaining := amount
+		for i := buckets - 1; i >= 0 && remaining > 0; i-- {
+			taken := w.amounts[i]
+			if taken > remaining {
+				taken = remaining
+			}
+			w.amounts[i] -= taken
+			remaining -= taken
+		}
+	}
+}
+
+// Use records that a key used amount of a metric. Usage beyond the limits
+// is recorded too, as for work that has already run.
+func (m *Manager) Use(key, metric string, amount float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.use(key, metric, amount, m.now())
+}
+
+// use records usage. The caller holds m.mu.
+func (m *Manager) use(key, metric string, amount float64, now time.Time) {
+	if amount <= 0 {
+		return
+	}
+	m.prune(now)
+	for _, limit := range m.limits(key) {
+		if limit.Metric != metric {
+			continue
+		}
+		w := m.window(key, limit, now)
+		w.amounts[buckets-1] += amount
+
+		// Going over the limit starts the burst, unless it has already
+		// started
+		if w.used() > limit.Limit && w.burstAvailable(limit, now) && !now.Before(w.burstStart.Add(limit.Window)) {
+			w.burstStart = now
+		}
+	}
+}
+
+// Usage reports the usage of every limit of a key
+func (m *Manager) Usage(key string) []Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	usage := []Usage{}
+	for _, limit := range m.limits(key) {
+		usage = append(usage, m.window(key, limit, now).usage(limit, now))
+	}
+	return usage
+}
+
+// Override replaces the limits of a key
+func (m *Manager) Override(key string, limits []Limit) error {
+	for _, limit := range limits {
+		if err := limit.Validate(); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overrides[key] = append([]Limit{}, limits...)
+	return m.save()
+}
+
+// RemoveOverride returns a key to the default limits. It reports whether
+// the key had an override.
+func (m *Manager) RemoveOverride(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.overrides[key]; !ok {
+		return false, nil
+	}
+	delete(m.overrides, key)
+	return true, m.save()
+}
+
+// Overrides returns the keys with overrides and their limits
+func (m *Manager) Overrides() map[string][]Limit {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	overrides := make(map[string][]Limit, len(m.overrides))
+	for key, limits := range m.overrides {
+		overrides[key] = append([]Limit{}, limits...)
+	}
+	return overrides
+}
+
+// LimitsOf returns the limits of a key and whether they are an override
+func (m *Manager) LimitsOf(key string) ([]Limit, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, overridden := m.overrides[key]
+	return append([]Limit{}, m.limits(key)...), overridden
+}
+
+// Reset forgets the usage of a key
+func (m *Manager) Reset(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.windows, key)
+}
+
+// Keys returns the keys with recorded usage or overrides, sorted
+func (m *Manager) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := map[string]bool{}
+	for key := range m.windows {
+		seen[key] = true
+	}
+	for key := range m.overrides {
+		seen[key] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,15 +1,23 @@
 package registry
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"forgeai/pkg/audit"
+	"forgeai/pkg/config"
+	"forgeai/pkg/offline"
 	"forgeai/pkg/plugin"
+	"forgeai/pkg/sbom"
+	"forgeai/pkg/storage"
 )
 
 // PluginInfo represents metadata about a plugin
@@ -25,106 +33,137 @@ type PluginInfo struct {
 	DownloadURL string   `json:"download_url"`
 	FileHash    string   `json:"file_hash"`
 	Signature   string   `json:"signature"`
+
+	// PublicKey is the base64 encoded ed25519 key of the publisher that
+	// Signature verifies with
+	PublicKey string `json:"public_key,omitempty"`
 }
 
 // RegistryClient manages communication with the plugin registry
 type RegistryClient struct {
 	BaseURL    string
 	HTTPClient *http.Client
+	
+	// Timeout limits each attempt of a registry API request, and
+	// TransferTimeout each attempt of a download or upload of a plugin
+	// binary; zero takes DefaultTimeout and DefaultTransferTimeout
+	Timeout         time.Duration
+	TransferTimeout time.Duration
+	
+	// Retry decides how failed requests are retried. Uploads are not
+	// retried, and downloads resume where the failed attempt stopped.
+	Retry RetryPolicy
+	
+	// Cache stores downloaded plugin binaries so later installs of the same
+	// version skip the registry; nil disables caching
+	Cache storage.Backend
+
+	// MetadataCache is a directory caching plugin listings and metadata,
+	// which are used for MetadataTTL without a request, then revalidated
+	// with their ETag, and stand in for an unreachable registry for
+	// MaxStale; "" disables caching. Refresh revalidates them right away.
+	MetadataCache string
+	MetadataTTL   time.Duration
+	MaxStale      time.Duration
+	Refresh       bool
+	
+	// Stale is called when cached metadata stands in for the registry,
+	// with the error reaching it and the age of the metadata
+	Stale func(err error, age time.Duration)
+	
+	// Progress is called as plugin binaries download, with the bytes done
+	// and the total, which is -1 when the registry does not report it
+	Progress func(done, total int64)
 }
 
 // NewRegistryClient creates a new registry client
 func NewRegistryClient(baseURL string) *RegistryClient {
 	return &RegistryClient{
-		BaseURL: baseURL,
-		HTTPClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		BaseURL:    baseURL,
+		HTTPClient: &http.Client{},
 	}
 }
 
+// Configure applies the timeouts and retries of the configuration
+func (rc *RegistryClient) Configure(cfg config.RegistryConfig) {
+	rc.Timeout = cfg.Timeout
+	rc.TransferTimeout = cfg.TransferTimeout
+	rc.Retry = RetryPolicy{MaxAttempts: cfg.MaxAttempts, MaxDelay: cfg.MaxRetryDelay}
+	rc.MetadataTTL = cfg.CacheTTL
+	rc.MaxStale = cfg.MaxStale
+}
+
 // ListPlugins retrieves a list of available plugins
-func (rc *RegistryClient) ListPlugins() ([]PluginInfo, error) {
+func (rc *RegistryClient) ListPlugins(ctx context.Context) ([]PluginInfo, error) {
 	url := fmt.Sprintf("%s/v1/plugins", rc.BaseURL)
 	
-	resp, err := rc.HTTPClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch plugins: %w", err)
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("registry returned status %d", resp.StatusCode)
-	}
-	
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-	
 	var plugins []PluginInfo
-	if err := json.Unmarshal(body, &plugins); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	if err := rc.getJSON(ctx, url, "plugins", &plugins, false); err != nil {
+		return nil, err
 	}
-	
 	return plugins, nil
 }
 
 // GetPlugin retrieves information about a specific plugin
-func (rc *RegistryClient) GetPlugin(name string) (*PluginInfo, error) {
+func (rc *RegistryClient) GetPlugin(ctx context.Context, name string) (*PluginInfo, error) {
+	return rc.getPlugin(ctx, name, false)
+}
+
+// getPlugin retrieves information about a plugin, revalidating cached
+// information with revalidate set
+func (rc *RegistryClient) getPlugin(ctx context.Context, name string, revalidate bool) (*PluginInfo, error) {
 	url := fmt.Sprintf("%s/v1/plugins/%s", rc.BaseURL, name)
 	
-	resp, err := rc.HTTPClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch plugin: %w", err)
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("registry returned status %d", resp.StatusCode)
+	var plugin PluginInfo
+	err := rc.getJSON(ctx, url, "plugin", &plugin, revalidate)
+	var status *statusError
+	if errors.As(err, &status) && status.code == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrPluginNotFound, name)
 	}
-	
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-	
-	var plugin PluginInfo
-	if err := json.Unmarshal(body, &plugin); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, err
 	}
-	
 	return &plugin, nil
 }
 
-// DownloadPlugin downloads a plugin to the specified directory
-func (rc *RegistryClient) DownloadPlugin(name, version, destDir string) error {
-	// Get plugin information
-	pluginInfo, err := rc.GetPlugin(name)
+// DownloadPlugin installs a plugin into the specified directory. The
+// plugin is downloaded into a staging directory, checked against the hash
+// and signature of its release, and then swapped in for the installed
+// version, which is kept for RollbackPlugin. A failed install leaves the
+// installed version as it was.
+func (rc *RegistryClient) DownloadPlugin(ctx context.Context, name, version, destDir string) error {
+	// Get plugin information; installs never use cached information
+	// without revalidating it
+	pluginInfo, err := rc.getPlugin(ctx, name, true)
 	if err != nil {
 		return fmt.Errorf("failed to get plugin info: %w", err)
 	}
+	release := *pluginInfo
+	if version != "latest" && version != release.Version {
+		// The registry describes its latest release only
+		release.Version, release.FileHash, release.Signature, release.PublicKey = version, "", "", ""
+	}
 	
 	// Create destination directory
-	pluginDir := filepath.Join(destDir, name)
-	if err := os.MkdirAll(pluginDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Join(destDir, downloadsDir), 0755); err != nil {
 		return fmt.Errorf("failed to create plugin directory: %w", err)
 	}
-	
-	// Download the plugin binary
-	binaryURL := pluginInfo.DownloadURL
-	if binaryURL == "" {
-		binaryURL = fmt.Sprintf("%s/v1/plugins/%s/versions/%s/download", rc.BaseURL, name, version)
+	unlock, err := lockPlugin(destDir, name)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 	
-	resp, err := rc.HTTPClient.Get(binaryURL)
+	pluginDir, err := os.MkdirTemp(destDir, stagingDir+name+"-")
 	if err != nil {
-		return fmt.Errorf("failed to download plugin binary: %w", err)
+		return fmt.Errorf("failed to create staging directory: %w", err)
 	}
-	defer resp.Body.Close()
+	defer os.RemoveAll(pluginDir)
 	
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status %d", resp.StatusCode)
+	// Download the plugin binary
+	binaryURL := pluginInfo.DownloadURL
+	if binaryURL == "" {
+		binaryURL = fmt.Sprintf("%s/v1/plugins/%s/versions/%s/download", rc.BaseURL, name, version)
 	}
 	
 	// Save the binary
@@ -136,16 +175,28 @@ func (rc *RegistryClient) DownloadPlugin(name, version, destDir string) error {
 		}
 	}
 	
+	cacheKey := storage.JoinKey("plugins", name, version, binaryName)
 	binaryPath := filepath.Join(pluginDir, binaryName)
-	binaryFile, err := os.Create(binaryPath)
-	if err != nil {
-		return fmt.Errorf("failed to create binary file: %w", err)
+	cached := rc.copyCachedBinary(ctx, cacheKey, binaryPath)
+	if cached && verifyRelease(&release, binaryPath) != nil {
+		// Replace a cached binary that does not match its release
+		cached = false
 	}
-	defer binaryFile.Close()
-	
-	// Copy the binary data
-	if _, err := io.Copy(binaryFile, resp.Body); err != nil {
-		return fmt.Errorf("failed to save binary: %w", err)
+	if !cached {
+		// Partial downloads outlive the staging directory to be resumed
+		partPath := filepath.Join(destDir, downloadsDir, name+"-"+release.Version+"-"+binaryName+".part")
+		err := rc.retry(ctx, func(ctx context.Context) error {
+			return rc.download(ctx, binaryURL, partPath, binaryPath)
+		})
+		if err != nil {
+			return err
+		}
+		if err := verifyRelease(&release, binaryPath); err != nil {
+			return err
+		}
+	}
+	if rc.Cache != nil && !cached {
+		rc.cachePluginBinary(ctx, binaryPath, cacheKey)
 	}
 	
 	// Set executable permissions
@@ -169,7 +220,159 @@ func (rc *RegistryClient) DownloadPlugin(name, version, destDir string) error {
 		return fmt.Errorf("failed to write manifest: %w", err)
 	}
 	
-	return nil
+	// Record the release for rollbacks
+	releaseData, err := json.MarshalIndent(release, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to record release: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(pluginDir, ReleaseFile), releaseData, 0644); err != nil {
+		return fmt.Errorf("failed to record release: %w", err)
+	}
+	
+	// Attach an SBOM unless the plugin shipped its own
+	if _, err := os.Stat(filepath.Join(pluginDir, "sbom.cdx.json")); os.IsNotExist(err) {
+		if doc, err := sbom.PluginSBOM(ctx, pluginDir, pluginInfo.Name); err == nil {
+			sbom.WriteAttachment(pluginDir, doc)
+		}
+	}
+	
+	return swapPlugin(destDir, name, pluginDir)
+}
+
+// online fails in offline mode, in which ForgeAI makes no registry calls
+func (rc *RegistryClient) online() error {
+	return offline.Check("plugin registry " + rc.BaseURL)
+}
+
+// copyCachedBinary copies a plugin binary from the cache to path and
+// reports whether the cache had it
+func (rc *RegistryClient) copyCachedBinary(ctx context.Context, cacheKey, path string) bool {
+	if rc.Cache == nil {
+		return false
+	}
+	body, err := rc.Cache.Get(ctx, cacheKey)
+	if err != nil {
+		return false
+	}
+	defer body.Close()
+	
+	f, err := os.Create(path)
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err == nil
+}
+
+// download downloads a plugin binary to path. It writes to partPath, which
+// a failed download leaves behind, so the next download resumes where it
+// stopped with a range request.
+func (rc *RegistryClient) download(ctx context.Context, url, partPath, path string) error {
+	if err := rc.online(); err != nil {
+		return err
+	}
+	part, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create binary file: %w", err)
+	}
+	defer part.Close()
+	
+	offset, err := part.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to create binary file: %w", err)
+	}
+	
+	ctx, cancel := context.WithTimeout(ctx, rc.transferTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download plugin binary: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := rc.HTTPClient.Do(req)
+	if err != nil {
+		return retryable(fmt.Errorf("failed to download plugin binary: %w", err))
+	}
+	defer resp.Body.Close()
+	
+	total := resp.ContentLength
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			os.Remove(partPath)
+			return fmt.Errorf("download failed: registry returned range %q", resp.Header.Get("Content-Range"))
+		}
+		if total >= 0 {
+			total += offset
+		}
+	case http.StatusOK:
+		// The registry ignored the range and sent the whole binary
+		if err := part.Truncate(0); err != nil {
+			return fmt.Errorf("failed to save binary: %w", err)
+		}
+		if _, err := part.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to save binary: %w", err)
+		}
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial download does not match the binary; start over
+		part.Close()
+		os.Remove(partPath)
+		return rc.download(ctx, url, partPath, path)
+	default:
+		return retryableResponse(resp, fmt.Errorf("download failed with status %d", resp.StatusCode))
+	}
+	
+	var w io.Writer = part
+	if rc.Progress != nil {
+		rc.Progress(offset, total)
+		w = &progressWriter{w: part, done: offset, total: total, progress: rc.Progress}
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		// The next attempt resumes after the bytes written
+		return retryable(fmt.Errorf("failed to save binary: %w", err))
+	}
+	if err := part.Close(); err != nil {
+		return fmt.Errorf("failed to save binary: %w", err)
+	}
+	return os.Rename(partPath, path)
+}
+
+// progressWriter reports the progress of a download as it is written
+type progressWriter struct {
+	w           io.Writer
+	done, total int64
+	progress    func(done, total int64)
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.done += int64(n)
+	pw.progress(pw.done, pw.total)
+	return n, err
+}
+
+// cachePluginBinary uploads a downloaded plugin binary to the cache
+func (rc *RegistryClient) cachePluginBinary(ctx context.Context, path, cacheKey string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	
+	if err := rc.Cache.Put(ctx, cacheKey, f, info.Size(), "application/octet-stream"); err != nil {
+		fmt.Printf("Warning: failed to cache plugin binary: %v\n", err)
+	}
 }
 
 // PluginManager manages local plugin installation and registry interaction
@@ -177,6 +380,11 @@ type PluginManager struct {
 	LocalDir      string
 	Registry      *RegistryClient
 	PluginManager *plugin.Manager
+
+	// Audit records plugin installs and removals made by Actor; nil
+	// disables the audit trail
+	Audit *audit.Trail
+	Actor string
 }
 
 // NewPluginManager creates a new plugin manager
@@ -189,8 +397,10 @@ func NewPluginManager(localDir, registryURL string) *PluginManager {
 }
 
 // InstallPlugin installs a plugin from the registry
-func (pm *PluginManager) InstallPlugin(name, version string) error {
-	return pm.Registry.DownloadPlugin(name, version, pm.LocalDir)
+func (pm *PluginManager) InstallPlugin(ctx context.Context, name, version string) error {
+	err := pm.Registry.DownloadPlugin(ctx, name, version, pm.LocalDir)
+	pm.audit("plugin.install", name, nil, map[string]string{"version": version}, err)
+	return err
 }
 
 // ListInstalledPlugins lists locally installed plugins
@@ -199,19 +409,68 @@ func (pm *PluginManager) ListInstalledPlugins() ([]string, error) {
 }
 
 // ListRegistryPlugins lists available plugins from the registry
-func (pm *PluginManager) ListRegistryPlugins() ([]PluginInfo, error) {
-	return pm.Registry.ListPlugins()
+func (pm *PluginManager) ListRegistryPlugins(ctx context.Context) ([]PluginInfo, error) {
+	return pm.Registry.ListPlugins(ctx)
 }
 
 // UpdatePlugin updates an installed plugin
-func (pm *PluginManager) UpdatePlugin(name string) error {
+func (pm *PluginManager) UpdatePlugin(ctx context.Context, name string) error {
 	// For simplicity, we'll just reinstall the plugin
 	// In a real implementation, we would check versions and only update if needed
-	return pm.InstallPlugin(name, "latest")
+	return pm.InstallPlugin(ctx, name, "latest")
 }
 
-// RemovePlugin removes an installed plugin
+// RemovePlugin removes an installed plugin and its previous version
 func (pm *PluginManager) RemovePlugin(name string) error {
 	pluginDir := filepath.Join(pm.LocalDir, name)
-	return os.RemoveAll(pluginDir)
+	err := pm.removePlugin(name)
+	pm.audit("plugin.remove", name, map[string]string{"dir": pluginDir}, nil, err)
+	return err
+}
+
+// removePlugin removes a plugin while holding its lock
+func (pm *PluginManager) removePlugin(name string) error {
+	if _, err := os.Stat(pm.LocalDir); os.IsNotExist(err) {
+		return nil
+	}
+	unlock, err := lockPlugin(pm.LocalDir, name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.RemoveAll(filepath.Join(pm.LocalDir, name)); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(pm.LocalDir, previousDir, name))
+}
+
+// RollbackPlugin swaps an installed plugin with its previous version
+func (pm *PluginManager) RollbackPlugin(name string) error {
+	before, _ := InstalledRelease(pm.LocalDir, name, false)
+	err := RollbackPlugin(pm.LocalDir, name)
+	after, _ := InstalledRelease(pm.LocalDir, name, false)
+	pm.audit("plugin.rollback", name, before, after, err)
+	return err
+}
+
+// audit records a plugin change in the audit trail, if any
+func (pm *PluginManager) audit(action, name string, before, after interface{}, err error) {
+	if pm.Audit == nil {
+		return
+	}
+	entry := audit.Entry{
+		Actor:    pm.Actor,
+		Action:   action,
+		Resource: name,
+		Before:   before,
+		After:    after,
+	}
+	if entry.Actor == "" {
+		entry.Actor = "anonymous"
+	}
+	if err != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Error = err.Error()
+	}
+	pm.Audit.Record(context.Background(), entry)
 }
\ No newline at end of file
@@ -0,0 +1,169 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"forgeai/pkg/attestation"
+)
+
+// Installs keep their state in hidden entries of the plugin directory,
+// which plugin loaders skip: partial downloads, the staging directories of
+// installs in progress, the previous version of each plugin, and the lock
+// files that serialize the installs of a plugin.
+const (
+	downloadsDir = ".downloads"
+	previousDir  = ".previous"
+	stagingDir   = ".staging-"
+	lockSuffix   = ".lock"
+)
+
+// ReleaseFile is the file in a plugin directory that records the release
+// installed from the registry
+const ReleaseFile = "release.json"
+
+// ErrChecksumMismatch is returned for plugin binaries whose hash differs
+// from the hash the registry published
+var ErrChecksumMismatch = errors.New("plugin binary does not match its published hash")
+
+// ErrNoPreviousVersion is returned when rolling back a plugin that has no
+// previous version
+var ErrNoPreviousVersion = errors.New("no previous version to roll back to")
+
+// lockPlugin serializes the changes to a plugin in destDir, also across
+// processes
+func lockPlugin(destDir, name string) (func(), error) {
+	unlock, err := lockFile(context.Background(), filepath.Join(destDir, "."+name+lockSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock plugin %s: %w", name, err)
+	}
+	return unlock, nil
+}
+
+// verifyRelease checks a downloaded binary against the hash of its release
+// and the release's signature, when the registry published them
+func verifyRelease(info *PluginInfo, binaryPath string) error {
+	if info.FileHash != "" {
+		want := strings.TrimPrefix(info.FileHash, "sha256:")
+		if strings.Contains(want, ":") {
+			return fmt.Errorf("unsupported file hash %q", info.FileHash)
+		}
+		f, err := os.Open(binaryPath)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+			return fmt.Errorf("%w: got sha256:%s, expected %s", ErrChecksumMismatch, got, info.FileHash)
+		}
+	}
+
+	if info.Signature == "" {
+		return nil
+	}
+	if info.FileHash == "" {
+		return errors.New("the release is signed but has no file hash")
+	}
+	if err := attestation.VerifyData(SigningPayload(info.Name, info.Version, info.FileHash), info.Signature, info.PublicKey); err != nil {
+		return fmt.Errorf("invalid release signature: %w", err)
+	}
+	return nil
+}
+
+// swapPlugin replaces the plugin in destDir with the one staged in staging,
+// keeping the current version as the previous one. Each step is a rename
+// within destDir, so the plugin directory is never half written.
+func swapPlugin(destDir, name, staging string) error {
+	current := filepath.Join(destDir, name)
+	previous := filepath.Join(destDir, previousDir, name)
+	if err := os.MkdirAll(filepath.Dir(previous), 0755); err != nil {
+		return fmt.Errorf("failed to create plugin directory: %w", err)
+	}
+
+	kept := false
+	if _, err := os.Stat(current); err == nil {
+		if err := os.RemoveAll(previous); err != nil {
+			return fmt.Errorf("failed to remove the previous version: %w", err)
+		}
+		if err := os.Rename(current, previous); err != nil {
+			return fmt.Errorf("failed to keep the current version: %w", err)
+		}
+		kept = true
+	}
+	if err := os.Rename(staging, current); err != nil {
+		if kept {
+			os.Rename(previous, current)
+		}
+		return fmt.Errorf("failed to install plugin: %w", err)
+	}
+	return nil
+}
+
+// RollbackPlugin swaps the plugin name in destDir with its previous
+// version, so that rolling back again returns to the version it replaced
+func RollbackPlugin(destDir, name string) error {
+	unlock, err := lockPlugin(destDir, name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	previous := filepath.Join(destDir, previousDir, name)
+	if _, err := os.Stat(previous); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNoPreviousVersion, name)
+	}
+
+	staging, err := os.MkdirTemp(destDir, stagingDir+name+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	current := filepath.Join(destDir, name)
+	if _, err := os.Stat(current); os.IsNotExist(err) {
+		// A removed plugin comes back and has no previous version
+		return os.Rename(previous, current)
+	}
+	// Rename the current version aside, then swap the versions
+	aside := filepath.Join(staging, name)
+	if err := os.Rename(current, aside); err != nil {
+		return fmt.Errorf("failed to roll back plugin: %w", err)
+	}
+	if err := os.Rename(previous, current); err != nil {
+		os.Rename(aside, current)
+		return fmt.Errorf("failed to roll back plugin: %w", err)
+	}
+	return os.Rename(aside, previous)
+}
+
+// InstalledRelease returns the release of the plugin name installed in
+// destDir, or of its previous version with previous set. Plugins that were
+// not installed from the registry have no release.
+func InstalledRelease(destDir, name string, previous bool) (*PluginInfo, error) {
+	dir := filepath.Join(destDir, name)
+	if previous {
+		dir = filepath.Join(destDir, previousDir, name)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ReleaseFile))
+	if err != nil {
+		return nil, err
+	}
+	var info PluginInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ReleaseFile, err)
+	}
+	return &info, nil
+}
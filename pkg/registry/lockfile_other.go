@@ -0,0 +1,37 @@
+//go:build !unix
+
+package registry
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// staleLock is how old a lock file must be before it is taken to be left
+// behind by a crashed process
+const staleLock = 10 * time.Minute
+
+// lockFile creates path exclusively, waiting until ctx is done, and returns
+// a function that removes it
+func lockFile(ctx context.Context, path string) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(path)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"forgeai/pkg/offline"
+)
+
+// Defaults of the metadata cache
+const (
+	DefaultMetadataTTL = 5 * time.Minute
+	DefaultMaxStale    = 24 * time.Hour
+)
+
+// metadataEntry is a registry response in the metadata cache
+type metadataEntry struct {
+	URL         string          `json:"url"`
+	ETag        string          `json:"etag,omitempty"`
+	ValidatedAt time.Time       `json:"validated_at"`
+	Body        json.RawMessage `json:"body"`
+}
+
+// DefaultMetadataCache returns the directory that caches registry metadata
+// in the user's cache directory, or "" when there is none
+func DefaultMetadataCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "forgeai", "registry")
+}
+
+// getJSON decodes the response to a GET request of url into v; what names
+// the resource in errors. With a metadata cache, responses younger than
+// MetadataTTL are used without a request unless revalidate or Refresh is
+// set, older ones are revalidated with their ETag, and ones younger than
+// MaxStale stand in for a registry that cannot be reached.
+func (rc *RegistryClient) getJSON(ctx context.Context, url, what string, v interface{}, revalidate bool) error {
+	entry := rc.loadMetadata(url)
+	if entry != nil && !revalidate && !rc.Refresh && time.Since(entry.ValidatedAt) < rc.metadataTTL() {
+		return decodeMetadata(entry.Body, v)
+	}
+
+	body, err := rc.fetchJSON(ctx, url, what, entry)
+	if err != nil {
+		var temp *retryableError
+		unreachable := errors.As(err, &temp) || errors.Is(err, offline.ErrOffline)
+		if entry == nil || !unreachable || time.Since(entry.ValidatedAt) >= rc.maxStale() {
+			return err
+		}
+		if rc.Stale != nil {
+			rc.Stale(err, time.Since(entry.ValidatedAt))
+		}
+		return decodeMetadata(entry.Body, v)
+	}
+	return decodeMetadata(body, v)
+}
+
+// fetchJSON requests url, retrying failed attempts, and returns the body of
+// the response, which a 304 to the ETag of entry takes from entry
+func (rc *RegistryClient) fetchJSON(ctx context.Context, url, what string, entry *metadataEntry) ([]byte, error) {
+	if err := rc.online(); err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	var etag string
+	err := rc.retry(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, rc.timeout())
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", what, err)
+		}
+		if entry != nil && entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		resp, err := rc.HTTPClient.Do(req)
+		if err != nil {
+			return retryable(fmt.Errorf("failed to fetch %s: %w", what, err))
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotModified && entry != nil:
+			body, etag = entry.Body, entry.ETag
+			return nil
+		case resp.StatusCode != http.StatusOK:
+			return retryableResponse(resp, &statusError{code: resp.StatusCode})
+		}
+
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return retryable(fmt.Errorf("failed to read response: %w", err))
+		}
+		etag = resp.Header.Get("ETag")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(body) {
+		return nil, errors.New("failed to parse response: invalid JSON")
+	}
+
+	rc.storeMetadata(&metadataEntry{URL: url, ETag: etag, ValidatedAt: time.Now(), Body: body})
+	return body, nil
+}
+
+// decodeMetadata decodes a registry response
+func decodeMetadata(body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// metadataPath returns the file caching the response to url
+func (rc *RegistryClient) metadataPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(rc.MetadataCache, hex.EncodeToString(sum[:16])+".json")
+}
+
+// loadMetadata returns the cached response to url, or nil
+func (rc *RegistryClient) loadMetadata(url string) *metadataEntry {
+	if rc.MetadataCache == "" {
+		return nil
+	}
+	data, err := os.ReadFile(rc.metadataPath(url))
+	if err != nil {
+		return nil
+	}
+	var entry metadataEntry
+	if json.Unmarshal(data, &entry) != nil || entry.URL != url {
+		return nil
+	}
+	return &entry
+}
+
+// storeMetadata caches a response. The cache is best effort: failing to
+// write it only costs a request later.
+func (rc *RegistryClient) storeMetadata(entry *metadataEntry) {
+	if rc.MetadataCache == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(rc.MetadataCache, 0755); err != nil {
+		return
+	}
+	// Write and rename so that concurrent readers never see half an entry
+	tmp, err := os.CreateTemp(rc.MetadataCache, ".metadata-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), rc.metadataPath(entry.URL))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// metadataTTL returns how long cached metadata is used without revalidating
+func (rc *RegistryClient) metadataTTL() time.Duration {
+	if rc.MetadataTTL > 0 {
+		return rc.MetadataTTL
+	}
+	return DefaultMetadataTTL
+}
+
+// maxStale returns how long cached metadata stands in for an unreachable
+// registry
+func (rc *RegistryClient) maxStale() time.Duration {
+	if rc.MaxStale > 0 {
+		return rc.MaxStale
+	}
+	return DefaultMaxStale
+}
@@ -0,0 +1,226 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"forgeai/pkg/attestation"
+	"forgeai/pkg/plugin"
+)
+
+// ErrPluginNotFound is returned for plugins that the registry does not have
+var ErrPluginNotFound = errors.New("plugin not found in registry")
+
+// Version is a semantic version, MAJOR.MINOR.PATCH with an optional
+// -prerelease suffix and v prefix
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          string
+}
+
+// ParseVersion parses a semantic version
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	core := strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(core, '+'); i >= 0 {
+		// Build metadata does not order versions
+		core = core[:i]
+	}
+	if i := strings.IndexByte(core, '-'); i >= 0 {
+		core, v.Prerelease = core[:i], core[i+1:]
+		if v.Prerelease == "" {
+			return v, fmt.Errorf("invalid version %q: empty prerelease", s)
+		}
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid version %q: use MAJOR.MINOR.PATCH", s)
+	}
+	for i, dst := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q: use MAJOR.MINOR.PATCH", s)
+		}
+		*dst = n
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0, or 1 as v is lower than, equal to, or higher than
+// other. Prereleases are lower than their release and compare as strings.
+func (v Version) Compare(other Version) int {
+	for _, d := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if d != 0 {
+			if d < 0 {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	case v.Prerelease < other.Prerelease:
+		return -1
+	}
+	return 1
+}
+
+// SigningPayload is what the publisher of a plugin release signs: its name,
+// version, and the hash of its binary, so that a signature cannot be moved
+// to another plugin or version
+func SigningPayload(name, version, fileHash string) []byte {
+	return []byte(fmt.Sprintf("forgeai-plugin\n%s\n%s\n%s\n", name, version, fileHash))
+}
+
+// PublishOptions describe a plugin release to publish
+type PublishOptions struct {
+	// Dir is the directory of the built plugin, with its manifest.json and
+	// binary as they are installed
+	Dir string
+
+	// Version is the semantic version of the release. It must be higher
+	// than the latest version in the registry.
+	Version string
+
+	// Info holds the optional description, author, license, homepage, and
+	// repository of the release
+	Info PluginInfo
+
+	// Signer signs the release with the publisher's key
+	Signer *attestation.Signer
+
+	// Token authenticates the publisher to the registry, as a bearer token
+	Token string
+
+	// DryRun validates, hashes, and signs the release without uploading it
+	DryRun bool
+}
+
+// Publish packages the plugin in opts.Dir, hashes and signs its binary,
+// checks that the version is higher than the latest in the registry, and
+// uploads it to the publish API of the registry,
+// POST /v1/plugins/{name}/versions, as a multipart form of the release's
+// info and binary. It returns the release as published, or as it would be
+// with DryRun.
+func (rc *RegistryClient) Publish(ctx context.Context, opts PublishOptions) (*PluginInfo, error) {
+	if opts.Signer == nil {
+		return nil, errors.New("publishing requires a signing key")
+	}
+	if err := rc.online(); err != nil {
+		return nil, err
+	}
+	version, err := ParseVersion(opts.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(opts.Dir, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest plugin.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Name == "" || len(manifest.Languages) == 0 {
+		return nil, errors.New("the manifest must name the plugin and its languages")
+	}
+	binary, err := os.ReadFile(filepath.Join(opts.Dir, manifest.Name))
+	if os.IsNotExist(err) {
+		binary, err = os.ReadFile(filepath.Join(opts.Dir, manifest.Name+".exe"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin binary; build it first: %w", err)
+	}
+
+	sum := sha256.Sum256(binary)
+	info := opts.Info
+	info.Name = manifest.Name
+	info.Version = opts.Version
+	info.Languages = manifest.Languages
+	info.DownloadURL = ""
+	info.FileHash = "sha256:" + hex.EncodeToString(sum[:])
+	info.Signature = opts.Signer.SignData(SigningPayload(info.Name, info.Version, info.FileHash))
+	info.PublicKey = opts.Signer.PublicKey()
+
+	latest, err := rc.getPlugin(ctx, info.Name, true)
+	switch {
+	case errors.Is(err, ErrPluginNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		current, err := ParseVersion(latest.Version)
+		if err != nil {
+			return nil, fmt.Errorf("latest version in the registry: %w", err)
+		}
+		if version.Compare(current) <= 0 {
+			return nil, fmt.Errorf("version %s must be higher than the latest version %s", opts.Version, latest.Version)
+		}
+	}
+	if opts.DryRun {
+		return &info, nil
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	infoData, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	if err := form.WriteField("info", string(infoData)); err != nil {
+		return nil, err
+	}
+	part, err := form.CreateFormFile("binary", manifest.Name)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(binary)
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/plugins/%s/versions", rc.BaseURL, url.PathEscape(info.Name))
+	ctx, cancel := context.WithTimeout(ctx, rc.transferTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	resp, err := rc.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish plugin: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("registry returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var published PluginInfo
+	if err := json.NewDecoder(resp.Body).Decode(&published); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &published, nil
+}
@@ -0,0 +1,170 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults of the timeouts and retries of registry requests
+const (
+	DefaultTimeout         = 30 * time.Second
+	DefaultTransferTimeout = 10 * time.Minute
+	DefaultMaxAttempts     = 4
+	DefaultBaseDelay       = 500 * time.Millisecond
+	DefaultMaxDelay        = 30 * time.Second
+)
+
+// RetryPolicy decides how the registry client retries requests that failed
+// to connect, timed out, or were answered with a 5xx or 429 status. It
+// waits exponentially longer between attempts, with jitter so that clients
+// do not retry in lockstep, and never less than a Retry-After header asks.
+// Zero fields take the defaults.
+type RetryPolicy struct {
+	// MaxAttempts is how many times a request is sent; 1 never retries
+	MaxAttempts int
+
+	// BaseDelay is the wait before the first retry, which doubles for
+	// each retry after it
+	BaseDelay time.Duration
+
+	// MaxDelay caps the wait between attempts. A Retry-After longer than
+	// it fails the request instead.
+	MaxDelay time.Duration
+}
+
+// retryableError is a failure of an attempt that a later attempt may not
+// have, with the wait the registry asked for, if any
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// retryable marks err as worth retrying
+func retryable(err error) error {
+	return &retryableError{err: err}
+}
+
+// statusError is the error of a response whose status is not the expected
+// one
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("registry returned status %d", e.code)
+}
+
+// retryableStatus reports whether a response with status is worth retrying
+func retryableStatus(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// retryableResponse marks the error of a failed response as worth retrying
+// when its status is, with the wait of its Retry-After header
+func retryableResponse(resp *http.Response, err error) error {
+	if !retryableStatus(resp.StatusCode) {
+		return err
+	}
+	return &retryableError{err: err, retryAfter: retryAfter(resp.Header.Get("Retry-After"), time.Now())}
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date
+func retryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// withDefaults fills in the zero fields of the policy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultMaxDelay
+	}
+	return p
+}
+
+// delay returns the wait before retry n, counting from 1, or false when a
+// Retry-After longer than MaxDelay rules out retrying
+func (p RetryPolicy) delay(n int, retryAfter time.Duration) (time.Duration, bool) {
+	if retryAfter > p.MaxDelay {
+		return 0, false
+	}
+	backoff := p.MaxDelay
+	if n < 32 && p.BaseDelay<<(n-1) < p.MaxDelay {
+		backoff = p.BaseDelay << (n - 1)
+	}
+	// Wait between half and all of the backoff
+	wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	if wait < retryAfter {
+		wait = retryAfter
+	}
+	return wait, true
+}
+
+// retry calls attempt until it succeeds, fails with an error that is not
+// retryable, runs out of attempts, or ctx is done
+func (rc *RegistryClient) retry(ctx context.Context, attempt func(ctx context.Context) error) error {
+	policy := rc.Retry.withDefaults()
+	for n := 1; ; n++ {
+		err := attempt(ctx)
+		var temp *retryableError
+		if err == nil || !errors.As(err, &temp) || n >= policy.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		wait, ok := policy.delay(n, temp.retryAfter)
+		if !ok {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// timeout returns the timeout of each attempt of an API request
+func (rc *RegistryClient) timeout() time.Duration {
+	if rc.Timeout > 0 {
+		return rc.Timeout
+	}
+	return DefaultTimeout
+}
+
+// transferTimeout returns the timeout of each attempt of a download or
+// upload of a plugin binary
+func (rc *RegistryClient) transferTimeout() time.Duration {
+	if rc.TransferTimeout > 0 {
+		return rc.TransferTimeout
+	}
+	return DefaultTransferTimeout
+}
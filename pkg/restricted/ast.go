@@ -0,0 +1,221 @@
+package restricted
+
+// Expressions
+
+type expr interface{}
+
+type nameExpr struct{ name string }
+
+type constExpr struct{ val value }
+
+// fstringExpr is an f-string of literal text and replacement fields
+type fstringExpr struct{ parts []fstringPart }
+
+type fstringPart struct {
+	lit  string
+	x    expr
+	conv byte
+	spec *fstringExpr
+}
+
+type listExpr struct{ elts []expr }
+
+type tupleExpr struct{ elts []expr }
+
+type setExpr struct{ elts []expr }
+
+type dictExpr struct{ keys, vals []expr }
+
+// starredExpr is *x in a list, tuple, or set display
+type starredExpr struct{ x expr }
+
+// compExpr is a comprehension or generator expression; kind is one of
+// '[', '{' (set), ':' (dict), or '('
+type compExpr struct {
+	kind    byte
+	elt     expr
+	val     expr
+	clauses []compClause
+}
+
+type compClause struct {
+	target expr
+	iter   expr
+	conds  []expr
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+type binExpr struct {
+	op   string
+	x, y expr
+}
+
+// boolExpr is and or or
+type boolExpr struct {
+	op   string
+	x, y expr
+}
+
+// compareExpr is a chain of comparisons such as a < b <= c
+type compareExpr struct {
+	first expr
+	ops   []string
+	rest  []expr
+}
+
+type condExpr struct{ cond, a, b expr }
+
+type lambdaExpr struct {
+	params []param
+	body   expr
+}
+
+type callExpr struct {
+	fn   expr
+	args []arg
+}
+
+// arg is an argument of a call: positional, keyword when name is set, or
+// unpacked with * or ** when star is 1 or 2
+type arg struct {
+	name string
+	star int
+	x    expr
+}
+
+type attrExpr struct {
+	x    expr
+	name string
+}
+
+type indexExpr struct{ x, index expr }
+
+type sliceExpr struct{ lo, hi, step expr }
+
+// Statements
+
+type stmt interface {
+	lineno() int
+}
+
+type pos struct{ line int }
+
+func (p pos) lineno() int { return p.line }
+
+type exprStmt struct {
+	pos
+	x expr
+}
+
+// assignStmt is targets[0] = targets[1] = ... = value
+type assignStmt struct {
+	pos
+	targets []expr
+	value   expr
+}
+
+type augAssignStmt struct {
+	pos
+	target expr
+	op     string
+	value  expr
+}
+
+type ifStmt struct {
+	pos
+	cond   expr
+	body   []stmt
+	orelse []stmt
+}
+
+type whileStmt struct {
+	pos
+	cond   expr
+	body   []stmt
+	orelse []stmt
+}
+
+type forStmt struct {
+	pos
+	target expr
+	iter   expr
+	body   []stmt
+	orelse []stmt
+}
+
+type breakStmt struct{ pos }
+
+type continueStmt struct{ pos }
+
+type passStmt struct{ pos }
+
+type defStmt struct {
+	pos
+	name   string
+	params []param
+	body   []stmt
+}
+
+// param is a parameter of a function: ordinary with an optional default,
+// or *args or **kwargs when star is 1 or 2
+type param struct {
+	name string
+	def  expr
+	star int
+}
+
+type returnStmt struct {
+	pos
+	x expr
+}
+
+type globalStmt struct {
+	pos
+	names []string
+}
+
+type nonlocalStmt struct {
+	pos
+	names []string
+}
+
+type delStmt struct {
+	pos
+	targets []expr
+}
+
+type assertStmt struct {
+	pos
+	cond, msg expr
+}
+
+type raiseStmt struct {
+	pos
+	x expr
+}
+
+type tryStmt struct {
+	pos
+	body     []stmt
+	handlers []handler
+	orelse   []stmt
+	finally  []stmt
+}
+
+// handler is an except clause; a nil typ catches every exception
+type handler struct {
+	typ  expr
+	name string
+	body []stmt
+	line int
+}
+
+// importStmt fails when it runs: restricted programs import nothing
+type importStmt struct {
+	pos
+	module string
+}
@@ -0,0 +1,1076 @@
+package restricted
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// builtins are the names every program can use. Builtins that would reach
+// outside the interpreter raise PermissionError.
+var builtins map[string]value
+
+// types are the built-in types by name
+var types map[string]*typeVal
+
+// blocked are the builtins of Python that restricted programs cannot call
+var blocked = []string{
+	"open", "input", "eval", "exec", "compile", "__import__", "globals",
+	"locals", "vars", "breakpoint", "exit", "quit", "help", "memoryview",
+	"getattr", "setattr", "delattr", "hasattr", "dir", "object", "super",
+	"classmethod", "staticmethod", "property",
+}
+
+func init() {
+	types = map[string]*typeVal{
+		"str":   {name: "str", call: strType},
+		"int":   {name: "int", call: intType},
+		"float": {name: "float", call: floatType},
+		"bool":  {name: "bool", call: boolType},
+		"list":  {name: "list", call: listType},
+		"tuple": {name: "tuple", call: tupleType},
+		"dict":  {name: "dict", call: dictType},
+		"set":   {name: "set", call: setType},
+		"range": {name: "range", call: rangeType},
+		"type":  {name: "type", call: typeType},
+	}
+	for _, name := range []string{
+		"NoneType", "function", "builtin_function_or_method", "slice",
+		"dict_keys", "dict_values", "dict_items", "enumerate", "zip", "map",
+		"filter", "reversed", "generator", "iterator",
+	} {
+		types[name] = &typeVal{name: name, call: func(in *interp, args []value, kw []kwarg) (value, error) {
+			return nil, in.errorf(typeError, "cannot create instances of this type")
+		}}
+	}
+
+	builtins = map[string]value{}
+	for name, t := range types {
+		switch name {
+		case "str", "int", "float", "bool", "list", "tuple", "dict", "set", "range", "type":
+			builtins[name] = t
+		}
+	}
+	for _, t := range excTypes {
+		builtins[t.name] = t
+	}
+	for _, name := range blocked {
+		name := name
+		builtins[name] = &builtinFn{name: name, call: func(in *interp, args []value, kw []kwarg) (value, error) {
+			return nil, in.errorf(permissionError, "%s() is not allowed in restricted mode", name)
+		}}
+	}
+	for name, fn := range map[string]func(in *interp, args []value, kw []kwarg) (value, error){
+		"print":      builtinPrint,
+		"len":        builtinLen,
+		"repr":       builtinRepr,
+		"abs":        builtinAbs,
+		"min":        func(in *interp, args []value, kw []kwarg) (value, error) { return in.minMax("min", -1, args, kw) },
+		"max":        func(in *interp, args []value, kw []kwarg) (value, error) { return in.minMax("max", 1, args, kw) },
+		"sum":        builtinSum,
+		"sorted":     builtinSorted,
+		"reversed":   builtinReversed,
+		"enumerate":  builtinEnumerate,
+		"zip":        builtinZip,
+		"map":        builtinMap,
+		"filter":     builtinFilter,
+		"any":        func(in *interp, args []value, kw []kwarg) (value, error) { return in.anyAll("any", true, args, kw) },
+		"all":        func(in *interp, args []value, kw []kwarg) (value, error) { return in.anyAll("all", false, args, kw) },
+		"round":      builtinRound,
+		"isinstance": builtinIsinstance,
+		"divmod":     builtinDivmod,
+		"pow":        builtinPow,
+		"chr":        builtinChr,
+		"ord":        builtinOrd,
+		"hex":        func(in *interp, args []value, kw []kwarg) (value, error) { return in.intText("hex", "#x", args, kw) },
+		"oct":        func(in *interp, args []value, kw []kwarg) (value, error) { return in.intText("oct", "#o", args, kw) },
+		"bin":        func(in *interp, args []value, kw []kwarg) (value, error) { return in.intText("bin", "#b", args, kw) },
+		"hash":       builtinHash,
+		"format":     builtinFormat,
+		"iter":       builtinIter,
+		"next":       builtinNext,
+		"callable":   builtinCallable,
+	} {
+		builtins[name] = &builtinFn{name: name, call: fn}
+	}
+
+	initMethods()
+}
+
+// arity checks the number of positional arguments of a builtin that takes
+// no keyword arguments
+func (in *interp) arity(name string, args []value, kw []kwarg, min, max int) error {
+	if len(kw) > 0 {
+		return in.errorf(typeError, "%s() takes no keyword arguments", name)
+	}
+	return in.positional(name, args, min, max)
+}
+
+// positional checks the number of positional arguments
+func (in *interp) positional(name string, args []value, min, max int) error {
+	switch {
+	case min == max && len(args) != min:
+		return in.errorf(typeError, "%s() takes exactly %d argument%s (%d given)", name, min, plural(min), len(args))
+	case len(args) < min:
+		return in.errorf(typeError, "%s() takes at least %d argument%s (%d given)", name, min, plural(min), len(args))
+	case max >= 0 && len(args) > max:
+		return in.errorf(typeError, "%s() takes at most %d argument%s (%d given)", name, max, plural(max), len(args))
+	}
+	return nil
+}
+
+// keywords returns the keyword arguments of a builtin that accepts names
+func (in *interp) keywords(name string, kw []kwarg, names ...string) (map[string]value, error) {
+	values := make(map[string]value, len(kw))
+	for _, k := range kw {
+		known := false
+		for _, n := range names {
+			known = known || n == k.name
+		}
+		if !known {
+			return nil, in.errorf(typeError, "%s() got an unexpected keyword argument '%s'", name, k.name)
+		}
+		values[k.name] = k.val
+	}
+	return values, nil
+}
+
+func builtinPrint(in *interp, args []value, kw []kwarg) (value, error) {
+	opts, err := in.keywords("print", kw, "sep", "end", "file", "flush")
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := opts["file"]; ok && f != value(none) {
+		return nil, in.errorf(permissionError, "print() to a file is not allowed in restricted mode")
+	}
+	sep, end := " ", "\n"
+	for name, s := range map[string]*string{"sep": &sep, "end": &end} {
+		v, ok := opts[name]
+		if !ok || v == value(none) {
+			continue
+		}
+		text, ok := v.(string)
+		if !ok {
+			return nil, in.errorf(typeError, "%s must be None or a string, not %s", name, typeName(v))
+		}
+		*s = text
+	}
+	var b strings.Builder
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(str(arg))
+	}
+	b.WriteString(end)
+	in.out.Write([]byte(b.String()))
+	return none, nil
+}
+
+// length returns len(v)
+func (in *interp) length(v value) (int, error) {
+	switch v := v.(type) {
+	case string:
+		return utf8.RuneCountInString(v), nil
+	case *listVal:
+		return len(v.items), nil
+	case tupleVal:
+		return len(v), nil
+	case *dictVal:
+		return len(v.keys), nil
+	case *setVal:
+		return len(v.items), nil
+	case *viewVal:
+		return len(v.d.keys), nil
+	case rangeVal:
+		n := v.length()
+		if n > math.MaxInt32 {
+			return 0, in.errorf(overflowError, "Python int too large to convert to C ssize_t")
+		}
+		return int(n), nil
+	}
+	return 0, in.errorf(typeError, "object of type '%s' has no len()", typeName(v))
+}
+
+func builtinLen(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("len", args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	n, err := in.length(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return newInt(int64(n)), nil
+}
+
+func builtinRepr(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("repr", args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	return repr(args[0]), nil
+}
+
+func builtinAbs(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("abs", args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	if n, ok := toInt(args[0]); ok {
+		return new(big.Int).Abs(n), nil
+	}
+	if f, ok := args[0].(float64); ok {
+		return math.Abs(f), nil
+	}
+	return nil, in.errorf(typeError, "bad operand type for abs(): '%s'", typeName(args[0]))
+}
+
+// minMax implements min and max; sign is -1 for min
+func (in *interp) minMax(name string, sign int, args []value, kw []kwarg) (value, error) {
+	opts, err := in.keywords(name, kw, "key", "default")
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, in.errorf(typeError, "%s expected at least 1 argument, got 0", name)
+	}
+	items := args
+	if len(args) == 1 {
+		if items, err = in.toList(args[0]); err != nil {
+			return nil, err
+		}
+	} else if _, ok := opts["default"]; ok {
+		return nil, in.errorf(typeError, "Cannot specify a default for %s() with multiple positional arguments", name)
+	}
+	if len(items) == 0 {
+		if def, ok := opts["default"]; ok {
+			return def, nil
+		}
+		return nil, in.errorf(valueError, "%s() iterable argument is empty", name)
+	}
+	key := opts["key"]
+	var best, bestKey value
+	for i, item := range items {
+		k := item
+		if key != nil && key != value(none) {
+			if k, err = in.call(key, []value{item}, nil); err != nil {
+				return nil, err
+			}
+		}
+		if i == 0 {
+			best, bestKey = item, k
+			continue
+		}
+		op := "<"
+		if sign > 0 {
+			op = ">"
+		}
+		better, err := in.compareOp(op, k, bestKey)
+		if err != nil {
+			return nil, err
+		}
+		if better {
+			best, bestKey = item, k
+		}
+	}
+	return best, nil
+}
+
+func builtinSum(in *interp, args []value, kw []kwarg) (value, error) {
+	opts, err := in.keywords("sum", kw, "start")
+	if err != nil {
+		return nil, err
+	}
+	if err := in.positional("sum", args, 1, 2); err != nil {
+		return nil, err
+	}
+	var total value = newInt(0)
+	if len(args) == 2 {
+		total = args[1]
+	}
+	if start, ok := opts["start"]; ok {
+		total = start
+	}
+	if _, ok := total.(string); ok {
+		return nil, in.errorf(typeError, "sum() can't sum strings [use ''.join(seq) instead]")
+	}
+	err = in.iterate(args[0], func(item value) (bool, error) {
+		var err error
+		total, err = in.binary("+", total, item)
+		return false, err
+	})
+	return total, err
+}
+
+func builtinSorted(in *interp, args []value, kw []kwarg) (value, error) {
+	opts, err := in.keywords("sorted", kw, "key", "reverse")
+	if err != nil {
+		return nil, err
+	}
+	if err := in.positional("sorted", args, 1, 1); err != nil {
+		return nil, err
+	}
+	items, err := in.toList(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := in.sortValues(items, opts["key"], truthy(orNone(opts["reverse"]))); err != nil {
+		return nil, err
+	}
+	return &listVal{items}, nil
+}
+
+// orNone returns v, or None when v is nil
+func orNone(v value) value {
+	if v == nil {
+		return none
+	}
+	return v
+}
+
+func builtinReversed(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("reversed", args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case string, *listVal, tupleVal, rangeVal, *dictVal:
+		items, err := in.toList(v)
+		if err != nil {
+			return nil, err
+		}
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+		return listIterator("reversed", items), nil
+	}
+	return nil, in.errorf(typeError, "'%s' object is not reversible", typeName(args[0]))
+}
+
+// iter returns an iterator over an iterable. Lists are read as the
+// iterator advances; dicts and sets are copied.
+func (in *interp) iter(v value) (*iterVal, error) {
+	switch v := v.(type) {
+	case *iterVal:
+		return v, nil
+	case *listVal:
+		i := 0
+		return &iterVal{name: "iterator", next: func() (value, bool, error) {
+			if i >= len(v.items) {
+				return nil, false, nil
+			}
+			i++
+			return v.items[i-1], true, nil
+		}}, nil
+	case rangeVal:
+		i, n := int64(0), v.length()
+		return &iterVal{name: "iterator", next: func() (value, bool, error) {
+			if i >= n {
+				return nil, false, nil
+			}
+			i++
+			return newInt(v.start + (i-1)*v.step), true, nil
+		}}, nil
+	case string:
+		rest := v
+		return &iterVal{name: "iterator", next: func() (value, bool, error) {
+			if rest == "" {
+				return nil, false, nil
+			}
+			_, size := utf8.DecodeRuneInString(rest)
+			c := rest[:size]
+			rest = rest[size:]
+			return c, true, nil
+		}}, nil
+	}
+	items, err := in.toList(v)
+	if err != nil {
+		return nil, err
+	}
+	return listIterator("iterator", items), nil
+}
+
+func builtinEnumerate(in *interp, args []value, kw []kwarg) (value, error) {
+	opts, err := in.keywords("enumerate", kw, "start")
+	if err != nil {
+		return nil, err
+	}
+	if err := in.positional("enumerate", args, 1, 2); err != nil {
+		return nil, err
+	}
+	start := value(newInt(0))
+	if len(args) == 2 {
+		start = args[1]
+	}
+	if s, ok := opts["start"]; ok {
+		start = s
+	}
+	n, ok := toInt(start)
+	if !ok {
+		return nil, in.errorf(typeError, "'%s' object cannot be interpreted as an integer", typeName(start))
+	}
+	it, err := in.iter(args[0])
+	if err != nil {
+		return nil, err
+	}
+	count := new(big.Int).Set(n)
+	return &iterVal{name: "enumerate", next: func() (value, bool, error) {
+		item, ok, err := it.next()
+		if !ok || err != nil {
+			return nil, ok, err
+		}
+		i := new(big.Int).Set(count)
+		count.Add(count, big.NewInt(1))
+		return tupleVal{i, item}, true, nil
+	}}, nil
+}
+
+// iters returns iterators over the arguments of zip and map
+func (in *interp) iters(args []value) ([]*iterVal, error) {
+	its := make([]*iterVal, len(args))
+	for i, arg := range args {
+		it, err := in.iter(arg)
+		if err != nil {
+			return nil, err
+		}
+		its[i] = it
+	}
+	return its, nil
+}
+
+// nextAll advances every iterator, stopping when any is exhausted
+func nextAll(its []*iterVal) ([]value, bool, error) {
+	items := make([]value, len(its))
+	for i, it := range its {
+		item, ok, err := it.next()
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		items[i] = item
+	}
+	return items, true, nil
+}
+
+func builtinZip(in *interp, args []value, kw []kwarg) (value, error) {
+	if _, err := in.keywords("zip", kw, "strict"); err != nil {
+		return nil, err
+	}
+	its, err := in.iters(args)
+	if err != nil {
+		return nil, err
+	}
+	return &iterVal{name: "zip", next: func() (value, bool, error) {
+		if len(its) == 0 {
+			return nil, false, nil
+		}
+		items, ok, err := nextAll(its)
+		return tupleVal(items), ok, err
+	}}, nil
+}
+
+func builtinMap(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("map", args, kw, 2, -1); err != nil {
+		return nil, err
+	}
+	fn := args[0]
+	its, err := in.iters(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &iterVal{name: "map", next: func() (value, bool, error) {
+		items, ok, err := nextAll(its)
+		if !ok || err != nil {
+			return nil, ok, err
+		}
+		v, err := in.call(fn, items, nil)
+		return v, err == nil, err
+	}}, nil
+}
+
+func builtinFilter(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("filter", args, kw, 2, 2); err != nil {
+		return nil, err
+	}
+	fn := args[0]
+	it, err := in.iter(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return &iterVal{name: "filter", next: func() (value, bool, error) {
+		for {
+			if err := in.step(); err != nil {
+				return nil, false, err
+			}
+			item, ok, err := it.next()
+			if !ok || err != nil {
+				return nil, ok, err
+			}
+			keep := item
+			if fn != value(none) {
+				if keep, err = in.call(fn, []value{item}, nil); err != nil {
+					return nil, false, err
+				}
+			}
+			if truthy(keep) {
+				return item, true, nil
+			}
+		}
+	}}, nil
+}
+
+// anyAll implements any and all; want is the truth that ends the search
+func (in *interp) anyAll(name string, want bool, args []value, kw []kwarg) (value, error) {
+	if err := in.arity(name, args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	found := false
+	err := in.iterate(args[0], func(item value) (bool, error) {
+		found = truthy(item) == want
+		return found, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found == want, nil
+}
+
+func builtinRound(in *interp, args []value, kw []kwarg) (value, error) {
+	opts, err := in.keywords("round", kw, "ndigits")
+	if err != nil {
+		return nil, err
+	}
+	if err := in.positional("round", args, 1, 2); err != nil {
+		return nil, err
+	}
+	ndigits := value(none)
+	if len(args) == 2 {
+		ndigits = args[1]
+	}
+	if n, ok := opts["ndigits"]; ok {
+		ndigits = n
+	}
+
+	switch x := args[0].(type) {
+	case bool, *big.Int:
+		n, _ := toInt(x)
+		if ndigits == value(none) {
+			return n, nil
+		}
+		digits, err := in.toIndex(ndigits)
+		if err != nil || digits >= 0 {
+			return n, err
+		}
+		// Round to a multiple of 10**-digits, halves to even
+		if -digits > 4096 {
+			return newInt(0), nil
+		}
+		unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(-digits), nil)
+		q, r := new(big.Int).QuoRem(n, unit, new(big.Int))
+		twice := new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2))
+		if c := twice.Cmp(unit); c > 0 || (c == 0 && q.Bit(0) == 1) {
+			if n.Sign() < 0 {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+		return q.Mul(q, unit), nil
+	case float64:
+		if ndigits == value(none) {
+			if math.IsInf(x, 0) {
+				return nil, in.errorf(overflowError, "cannot convert float infinity to integer")
+			}
+			if math.IsNaN(x) {
+				return nil, in.errorf(valueError, "cannot convert float NaN to integer")
+			}
+			n, _ := big.NewFloat(math.RoundToEven(x)).Int(nil)
+			return n, nil
+		}
+		digits, err := in.toIndex(ndigits)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsInf(x, 0) || math.IsNaN(x) || digits > 300 {
+			return x, nil
+		}
+		if digits < -308 {
+			return math.Copysign(0, x), nil
+		}
+		if digits >= 0 {
+			// Formatting rounds the exact binary value, as Python does
+			f, _ := strconv.ParseFloat(strconv.FormatFloat(x, 'f', int(digits), 64), 64)
+			return f, nil
+		}
+		unit := math.Pow(10, float64(-digits))
+		return math.RoundToEven(x/unit) * unit, nil
+	}
+	return nil, in.errorf(typeError, "type %s doesn't define __round__ method", typeName(args[0]))
+}
+
+// isInstance reports whether v is an instance of the type or tuple of
+// types t
+func (in *interp) isInstance(v, t value) (bool, error) {
+	switch t := t.(type) {
+	case *typeVal:
+		name := typeName(v)
+		return name == t.name || (t.name == "int" && name == "bool"), nil
+	case *excType:
+		exc, ok := v.(*excVal)
+		return ok && exc.typ.isSubclass(t), nil
+	case tupleVal:
+		for _, item := range t {
+			if ok, err := in.isInstance(v, item); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+	return false, in.errorf(typeError, "isinstance() arg 2 must be a type, a tuple of types, or a union")
+}
+
+func builtinIsinstance(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("isinstance", args, kw, 2, 2); err != nil {
+		return nil, err
+	}
+	return in.isInstance(args[0], args[1])
+}
+
+func builtinDivmod(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("divmod", args, kw, 2, 2); err != nil {
+		return nil, err
+	}
+	q, err := in.binary("//", args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	r, err := in.binary("%", args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return tupleVal{q, r}, nil
+}
+
+func builtinPow(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("pow", args, kw, 2, 3); err != nil {
+		return nil, err
+	}
+	if len(args) == 2 || args[2] == value(none) {
+		return in.binary("**", args[0], args[1])
+	}
+	x, ok1 := toInt(args[0])
+	y, ok2 := toInt(args[1])
+	m, ok3 := toInt(args[2])
+	if !ok1 || !ok2 || !ok3 {
+		return nil, in.errorf(typeError, "pow() 3rd argument not allowed unless all arguments are integers")
+	}
+	if m.Sign() == 0 {
+		return nil, in.errorf(valueError, "pow() 3rd argument cannot be 0")
+	}
+	mod := new(big.Int).Abs(m)
+	if err := in.charge(mulCost(x, mod)); err != nil {
+		return nil, err
+	}
+	base := new(big.Int).Mod(x, mod)
+	if y.Sign() < 0 {
+		if base.ModInverse(base, mod) == nil {
+			return nil, in.errorf(valueError, "base is not invertible for the given modulus")
+		}
+		y = new(big.Int).Neg(y)
+	}
+	z, err := in.intPow(base, y, mod)
+	if err != nil {
+		return nil, err
+	}
+	if m.Sign() < 0 && z.Sign() != 0 {
+		z.Add(z, m)
+	}
+	return z, nil
+}
+
+func builtinChr(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("chr", args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	n, err := in.toIndex(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > utf8.MaxRune {
+		return nil, in.errorf(valueError, "chr() arg not in range(0x110000)")
+	}
+	return string(rune(n)), nil
+}
+
+func builtinOrd(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("ord", args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, in.errorf(typeError, "ord() expected string of length 1, but %s found", typeName(args[0]))
+	}
+	if n := utf8.RuneCountInString(s); n != 1 {
+		return nil, in.errorf(typeError, "ord() expected a character, but string of length %d found", n)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return newInt(int64(r)), nil
+}
+
+// intText implements hex, oct, and bin with the format spec of each
+func (in *interp) intText(name, spec string, args []value, kw []kwarg) (value, error) {
+	if err := in.arity(name, args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	if _, ok := toInt(args[0]); !ok {
+		return nil, in.errorf(typeError, "'%s' object cannot be interpreted as an integer", typeName(args[0]))
+	}
+	return in.format(args[0], spec)
+}
+
+func builtinHash(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("hash", args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	key, err := in.hashKey(args[0])
+	if err != nil {
+		return nil, err
+	}
+	// Integers and the floats equal to them hash to their value
+	if n, ok := new(big.Int).SetString(strings.TrimPrefix(key, "i"), 10); ok && key[0] == 'i' {
+		return n, nil
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return newInt(int64(h.Sum64() >> 1)), nil
+}
+
+func builtinFormat(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("format", args, kw, 1, 2); err != nil {
+		return nil, err
+	}
+	spec := ""
+	if len(args) == 2 {
+		s, ok := args[1].(string)
+		if !ok {
+			return nil, in.errorf(typeError, "format() argument 2 must be str, not %s", typeName(args[1]))
+		}
+		spec = s
+	}
+	return in.format(args[0], spec)
+}
+
+func builtinIter(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("iter", args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	return in.iter(args[0])
+}
+
+func builtinNext(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("next", args, kw, 1, 2); err != nil {
+		return nil, err
+	}
+	it, ok := args[0].(*iterVal)
+	if !ok {
+		return nil, in.errorf(typeError, "'%s' object is not an iterator", typeName(args[0]))
+	}
+	item, ok, err := it.next()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if len(args) == 2 {
+			return args[1], nil
+		}
+		return nil, raise(&excVal{typ: stopIteration})
+	}
+	return item, nil
+}
+
+func builtinCallable(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("callable", args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	switch args[0].(type) {
+	case *funcVal, *builtinFn, *boundMethod, *typeVal, *excType:
+		return true, nil
+	}
+	return false, nil
+}
+
+// Types
+
+// typeOf returns type(v)
+func typeOf(v value) value {
+	switch v := v.(type) {
+	case *excVal:
+		return v.typ
+	case *excType:
+		return types["type"]
+	}
+	if t, ok := types[typeName(v)]; ok {
+		return t
+	}
+	return types["iterator"]
+}
+
+func typeType(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("type", args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	return typeOf(args[0]), nil
+}
+
+func strType(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("str", args, kw, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return "", nil
+	}
+	s := str(args[0])
+	return s, in.alloc(int64(len(s)))
+}
+
+func intType(in *interp, args []value, kw []kwarg) (value, error) {
+	opts, err := in.keywords("int", kw, "base")
+	if err != nil {
+		return nil, err
+	}
+	if err := in.positional("int", args, 0, 2); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return newInt(0), nil
+	}
+	base := value(nil)
+	if len(args) == 2 {
+		base = args[1]
+	}
+	if b, ok := opts["base"]; ok {
+		base = b
+	}
+
+	switch x := args[0].(type) {
+	case string:
+		b := int64(10)
+		if base != nil {
+			if b, err = in.toIndex(base); err != nil {
+				return nil, err
+			}
+			if b != 0 && (b < 2 || b > 36) {
+				return nil, in.errorf(valueError, "int() base must be >= 2 and <= 36, or 0")
+			}
+		}
+		return in.parseInt(x, int(b))
+	case bool, *big.Int:
+		if base != nil {
+			return nil, in.errorf(typeError, "int() can't convert non-string with explicit base")
+		}
+		n, _ := toInt(x)
+		return n, nil
+	case float64:
+		if base != nil {
+			return nil, in.errorf(typeError, "int() can't convert non-string with explicit base")
+		}
+		if math.IsInf(x, 0) {
+			return nil, in.errorf(overflowError, "cannot convert float infinity to integer")
+		}
+		if math.IsNaN(x) {
+			return nil, in.errorf(valueError, "cannot convert float NaN to integer")
+		}
+		n, _ := big.NewFloat(math.Trunc(x)).Int(nil)
+		return n, nil
+	}
+	return nil, in.errorf(typeError, "int() argument must be a string, a bytes-like object or a real number, not '%s'", typeName(args[0]))
+}
+
+// parseInt parses the string argument of int
+func (in *interp) parseInt(s string, base int) (value, error) {
+	invalid := in.errorf(valueError, "invalid literal for int() with base %d: %s", base, quote(s))
+	text := strings.TrimSpace(s)
+	sign := ""
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		sign, text = text[:1], text[1:]
+	}
+	lower := strings.ToLower(text)
+	prefixes := map[int]string{16: "0x", 8: "0o", 2: "0b"}
+	if base == 0 {
+		base = 10
+		for b, p := range prefixes {
+			if strings.HasPrefix(lower, p) {
+				base = b
+			}
+		}
+		if base == 10 && len(text) > 1 && text[0] == '0' && strings.Trim(text, "0_") != "" {
+			return nil, invalid
+		}
+	}
+	if p, ok := prefixes[base]; ok && strings.HasPrefix(lower, p) {
+		text = text[2:]
+	}
+	if text == "" || strings.HasPrefix(text, "_") || strings.HasSuffix(text, "_") || strings.Contains(text, "__") {
+		return nil, invalid
+	}
+	if len(text) > 4300 && base == 10 {
+		return nil, in.errorf(valueError, "Exceeds the limit (4300 digits) for integer string conversion: value has %d digits", len(text))
+	}
+	n, ok := new(big.Int).SetString(sign+strings.ReplaceAll(text, "_", ""), base)
+	if !ok {
+		return nil, invalid
+	}
+	return n, nil
+}
+
+func floatType(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("float", args, kw, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return 0.0, nil
+	}
+	switch x := args[0].(type) {
+	case string:
+		text := strings.ToLower(strings.TrimSpace(x))
+		switch strings.TrimLeft(text, "+-") {
+		case "inf", "infinity", "nan":
+			f, _ := strconv.ParseFloat(text, 64)
+			return f, nil
+		}
+		if strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "-0x") || strings.HasPrefix(text, "+0x") || strings.HasPrefix(text, "_") || strings.HasSuffix(text, "_") || strings.Contains(text, "__") {
+			return nil, in.errorf(valueError, "could not convert string to float: %s", quote(x))
+		}
+		f, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64)
+		if err != nil && !strings.Contains(err.Error(), "range") {
+			return nil, in.errorf(valueError, "could not convert string to float: %s", quote(x))
+		}
+		return f, nil
+	case float64:
+		return x, nil
+	case bool, *big.Int:
+		f, _ := toFloat(x)
+		if math.IsInf(f, 0) {
+			return nil, in.errorf(overflowError, "int too large to convert to float")
+		}
+		return f, nil
+	}
+	return nil, in.errorf(typeError, "float() argument must be a string or a real number, not '%s'", typeName(args[0]))
+}
+
+func boolType(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("bool", args, kw, 0, 1); err != nil {
+		return nil, err
+	}
+	return len(args) == 1 && truthy(args[0]), nil
+}
+
+func listType(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("list", args, kw, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return &listVal{}, nil
+	}
+	items, err := in.toList(args[0])
+	return &listVal{items}, err
+}
+
+func tupleType(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("tuple", args, kw, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return tupleVal{}, nil
+	}
+	if t, ok := args[0].(tupleVal); ok {
+		return t, nil
+	}
+	items, err := in.toList(args[0])
+	return tupleVal(items), err
+}
+
+func dictType(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.positional("dict", args, 0, 1); err != nil {
+		return nil, err
+	}
+	d := newDict()
+	if len(args) == 1 {
+		if err := in.update(d, args[0]); err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range kw {
+		if err := d.set(in, k.name, k.val); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// update adds the items of a dict or an iterable of pairs to d
+func (in *interp) update(d *dictVal, src value) error {
+	if other, ok := src.(*dictVal); ok {
+		for i, key := range other.keys {
+			if err := d.set(in, key, other.vals[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	n := 0
+	return in.iterate(src, func(item value) (bool, error) {
+		pair, err := in.toList(item)
+		if err != nil {
+			return true, in.errorf(typeError, "cannot convert dictionary update sequence element #%d to a sequence", n)
+		}
+		if len(pair) != 2 {
+			return true, in.errorf(valueError, "dictionary update sequence element #%d has length %d; 2 is required", n, len(pair))
+		}
+		n++
+		return false, d.set(in, pair[0], pair[1])
+	})
+}
+
+func setType(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("set", args, kw, 0, 1); err != nil {
+		return nil, err
+	}
+	s := newSet()
+	if len(args) == 0 {
+		return s, nil
+	}
+	err := in.iterate(args[0], func(item value) (bool, error) {
+		return false, s.add(in, item)
+	})
+	return s, err
+}
+
+func rangeType(in *interp, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("range", args, kw, 1, 3); err != nil {
+		return nil, err
+	}
+	bounds := make([]int64, len(args))
+	for i, arg := range args {
+		n, ok := toInt(arg)
+		if !ok {
+			return nil, in.errorf(typeError, "'%s' object cannot be interpreted as an integer", typeName(arg))
+		}
+		if !n.IsInt64() || n.Int64() > math.MaxInt64/4 || n.Int64() < math.MinInt64/4 {
+			return nil, in.errorf(overflowError, "Python int too large to convert to C ssize_t")
+		}
+		bounds[i] = n.Int64()
+	}
+	r := rangeVal{step: 1}
+	switch len(bounds) {
+	case 1:
+		r.stop = bounds[0]
+	case 2:
+		r.start, r.stop = bounds[0], bounds[1]
+	case 3:
+		r.start, r.stop, r.step = bounds[0], bounds[1], bounds[2]
+		if r.step == 0 {
+			return nil, in.errorf(valueError, "range() arg 3 must not be zero")
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,574 @@
+package restricted
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// formatSpec is a parsed format specification such as >10.2f
+type formatSpec struct {
+	fill      rune
+	align     byte
+	sign      byte
+	alt       bool
+	width     int
+	grouping  byte
+	precision int
+	typ       byte
+}
+
+// parseSpec parses the format specification mini-language
+func (in *interp) parseSpec(spec string) (formatSpec, error) {
+	f := formatSpec{fill: ' ', precision: -1}
+	invalid := in.errorf(valueError, "Invalid format specifier '%s'", spec)
+	runes := []rune(spec)
+	i := 0
+	isAlign := func(r rune) bool { return r == '<' || r == '>' || r == '^' || r == '=' }
+	switch {
+	case len(runes) >= 2 && isAlign(runes[1]):
+		f.fill, f.align = runes[0], byte(runes[1])
+		i = 2
+	case len(runes) >= 1 && isAlign(runes[0]):
+		f.align = byte(runes[0])
+		i = 1
+	}
+	if i < len(runes) && (runes[i] == '+' || runes[i] == '-' || runes[i] == ' ') {
+		f.sign = byte(runes[i])
+		i++
+	}
+	if i < len(runes) && runes[i] == '#' {
+		f.alt = true
+		i++
+	}
+	if i < len(runes) && runes[i] == '0' {
+		if f.align == 0 {
+			f.fill, f.align = '0', '='
+		}
+		i++
+	}
+	start := i
+	for i < len(runes) && runes[i] >= '0' && runes[i] <= '9' {
+		i++
+	}
+	if i > start {
+		f.width, _ = strconv.Atoi(string(runes[start:i]))
+	}
+	if i < len(runes) && (runes[i] == ',' || runes[i] == '_') {
+		f.grouping = byte(runes[i])
+		i++
+	}
+	if i < len(runes) && runes[i] == '.' {
+		i++
+		start = i
+		for i < len(runes) && runes[i] >= '0' && runes[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return f, in.errorf(valueError, "Format specifier missing precision")
+		}
+		f.precision, _ = strconv.Atoi(string(runes[start:i]))
+	}
+	if i < len(runes) {
+		f.typ = byte(runes[i])
+		i++
+	}
+	if i != len(runes) || f.width > 1<<20 || f.precision > 1<<10 {
+		return f, invalid
+	}
+	return f, nil
+}
+
+// format returns format(v, spec)
+func (in *interp) format(v value, spec string) (string, error) {
+	if spec == "" {
+		return str(v), nil
+	}
+	f, err := in.parseSpec(spec)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		if f.typ != 0 && f.typ != 's' {
+			return "", in.errorf(valueError, "Unknown format code '%c' for object of type 'str'", f.typ)
+		}
+		if f.sign != 0 {
+			return "", in.errorf(valueError, "Sign not allowed in string format specifier")
+		}
+		if f.precision >= 0 && utf8.RuneCountInString(v) > f.precision {
+			v = string([]rune(v)[:f.precision])
+		}
+		return f.pad("", v, '<'), nil
+	case bool, *big.Int:
+		n, _ := toInt(v)
+		if _, isBool := v.(bool); isBool && f.typ == 0 {
+			return f.pad("", str(v), '<'), nil
+		}
+		return in.formatInt(n, f)
+	case float64:
+		return in.formatFloat(v, f)
+	}
+	return "", in.errorf(typeError, "unsupported format string passed to %s.__format__", typeName(v))
+}
+
+// pad aligns a formatted value in the width of the spec; sign is kept in
+// front of padding with = alignment
+func (f formatSpec) pad(sign, digits string, align byte) string {
+	if f.align != 0 {
+		align = f.align
+	}
+	n := f.width - utf8.RuneCountInString(sign) - utf8.RuneCountInString(digits)
+	if n <= 0 {
+		return sign + digits
+	}
+	fill := strings.Repeat(string(f.fill), n)
+	switch align {
+	case '<':
+		return sign + digits + fill
+	case '^':
+		left := strings.Repeat(string(f.fill), n/2)
+		return left + sign + digits + strings.Repeat(string(f.fill), n-n/2)
+	case '=':
+		return sign + fill + digits
+	}
+	return fill + sign + digits
+}
+
+func (f formatSpec) signOf(negative bool) string {
+	switch {
+	case negative:
+		return "-"
+	case f.sign == '+':
+		return "+"
+	case f.sign == ' ':
+		return " "
+	}
+	return ""
+}
+
+func (in *interp) formatInt(n *big.Int, f formatSpec) (string, error) {
+	switch f.typ {
+	case 'e', 'E', 'f', 'F', 'g', 'G', '%':
+		x, _ := toFloat(n)
+		return in.formatFloat(x, f)
+	case 'c':
+		if !n.IsInt64() || n.Int64() < 0 || n.Int64() > utf8.MaxRune {
+			return "", in.errorf(overflowError, "%%c arg not in range(0x110000)")
+		}
+		return f.pad("", string(rune(n.Int64())), '<'), nil
+	}
+	if f.precision >= 0 {
+		return "", in.errorf(valueError, "Precision not allowed in integer format specifier")
+	}
+
+	abs := new(big.Int).Abs(n)
+	var digits, prefix string
+	group := 3
+	switch f.typ {
+	case 0, 'd', 'n':
+		digits = abs.String()
+	case 'x':
+		digits, prefix, group = abs.Text(16), "0x", 4
+	case 'X':
+		digits, prefix, group = strings.ToUpper(abs.Text(16)), "0X", 4
+	case 'o':
+		digits, prefix, group = abs.Text(8), "0o", 4
+	case 'b':
+		digits, prefix, group = abs.Text(2), "0b", 4
+	default:
+		return "", in.errorf(valueError, "Unknown format code '%c' for object of type 'int'", f.typ)
+	}
+	sign := f.signOf(n.Sign() < 0)
+	if f.alt {
+		sign += prefix
+	}
+	if f.grouping != 0 {
+		if f.align == '=' && f.fill == '0' {
+			// Zero padding is grouped too
+			width := f.width - len(sign)
+			for len(group3(digits, f.grouping, group)) < width {
+				digits = "0" + digits
+			}
+		}
+		digits = group3(digits, f.grouping, group)
+	}
+	return f.pad(sign, digits, '>'), nil
+}
+
+// group3 inserts a separator between groups of digits
+func group3(digits string, sep byte, size int) string {
+	if len(digits) <= size {
+		return digits
+	}
+	var b strings.Builder
+	head := len(digits) % size
+	if head == 0 {
+		head = size
+	}
+	b.WriteString(digits[:head])
+	for i := head; i < len(digits); i += size {
+		b.WriteByte(sep)
+		b.WriteString(digits[i : i+size])
+	}
+	return b.String()
+}
+
+func (in *interp) formatFloat(x float64, f formatSpec) (string, error) {
+	negative := math.Signbit(x) && !math.IsNaN(x)
+	abs := math.Abs(x)
+	var digits string
+	switch f.typ {
+	case 'f', 'F', '%':
+		if f.typ == '%' {
+			abs *= 100
+		}
+		p := f.precision
+		if p < 0 {
+			p = 6
+		}
+		digits = strconv.FormatFloat(abs, 'f', p, 64)
+		if f.alt && p == 0 {
+			digits += "."
+		}
+		if f.typ == '%' {
+			digits += "%"
+		}
+	case 'e', 'E':
+		p := f.precision
+		if p < 0 {
+			p = 6
+		}
+		digits = strconv.FormatFloat(abs, 'e', p, 64)
+	case 'g', 'G', 0:
+		p := f.precision
+		switch {
+		case p == 0:
+			p = 1
+		case p < 0 && f.typ == 0:
+			digits = formatFloat(abs)
+		case p < 0:
+			p = 6
+		}
+		if digits == "" {
+			digits = strconv.FormatFloat(abs, 'g', p, 64)
+			if f.typ == 0 && !strings.ContainsAny(digits, ".e") {
+				digits += ".0"
+			}
+		}
+	case 'n':
+		digits = strconv.FormatFloat(abs, 'g', 6, 64)
+	default:
+		return "", in.errorf(valueError, "Unknown format code '%c' for object of type 'float'", f.typ)
+	}
+	switch {
+	case math.IsInf(abs, 0):
+		digits = "inf"
+	case math.IsNaN(abs):
+		digits = "nan"
+	}
+	if f.typ == 'E' || f.typ == 'G' || f.typ == 'F' {
+		digits = strings.ToUpper(digits)
+	}
+	if f.grouping != 0 {
+		whole, frac := digits, ""
+		if i := strings.IndexAny(digits, ".e%"); i >= 0 {
+			whole, frac = digits[:i], digits[i:]
+		}
+		digits = group3(whole, f.grouping, 3) + frac
+	}
+	return f.pad(f.signOf(negative), digits, '>'), nil
+}
+
+// percentFormat returns format % args, printf-style string formatting
+func (in *interp) percentFormat(format string, args value) (string, error) {
+	items := []value{args}
+	if t, ok := args.(tupleVal); ok {
+		items = t
+	}
+	mapping, _ := args.(*dictVal)
+	next := 0
+	arg := func() (value, error) {
+		if next >= len(items) {
+			return nil, in.errorf(typeError, "not enough arguments for format string")
+		}
+		next++
+		return items[next-1], nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(format) {
+			return "", in.errorf(valueError, "incomplete format")
+		}
+		var v value
+		if format[i] == '(' {
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 || mapping == nil {
+				return "", in.errorf(typeError, "format requires a mapping")
+			}
+			key := format[i+1 : i+end]
+			val, found, err := mapping.get(in, key)
+			if err != nil {
+				return "", err
+			}
+			if !found {
+				return "", raise(&excVal{typ: keyError, args: []value{key}})
+			}
+			v = val
+			i += end + 1
+		}
+
+		var spec strings.Builder
+		align, sign, zero, alt := "", "", "", ""
+		for ; i < len(format) && strings.IndexByte("-+ #0", format[i]) >= 0; i++ {
+			switch format[i] {
+			case '-':
+				align = "<"
+			case '+':
+				sign = "+"
+			case ' ':
+				if sign == "" {
+					sign = " "
+				}
+			case '#':
+				alt = "#"
+			case '0':
+				zero = "0"
+			}
+		}
+		width := ""
+		if i < len(format) && format[i] == '*' {
+			w, err := arg()
+			if err != nil {
+				return "", err
+			}
+			width = str(w)
+			i++
+		}
+		for ; i < len(format) && format[i] >= '0' && format[i] <= '9'; i++ {
+			width += string(format[i])
+		}
+		precision := ""
+		if i < len(format) && format[i] == '.' {
+			precision = "."
+			for i++; i < len(format) && format[i] >= '0' && format[i] <= '9'; i++ {
+				precision += string(format[i])
+			}
+			if precision == "." {
+				precision = ".0"
+			}
+		}
+		if i >= len(format) {
+			return "", in.errorf(valueError, "incomplete format")
+		}
+		conv := format[i]
+		if conv == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		if v == nil {
+			var err error
+			if v, err = arg(); err != nil {
+				return "", err
+			}
+		}
+
+		if align != "" {
+			zero = ""
+		}
+		spec.WriteString(align + sign + alt + zero + width + precision)
+		switch conv {
+		case 's', 'r', 'a':
+			if conv == 's' {
+				v = str(v)
+			} else {
+				v = repr(v)
+			}
+			if align == "" && zero == "" {
+				// Strings are right aligned by %
+				s := spec.String()
+				spec.Reset()
+				spec.WriteString(">" + s)
+			}
+		case 'd', 'i', 'u':
+			switch n := v.(type) {
+			case float64:
+				if math.IsInf(n, 0) || math.IsNaN(n) {
+					return "", in.errorf(overflowError, "cannot convert float infinity to integer")
+				}
+				v, _ = big.NewFloat(math.Trunc(n)).Int(nil)
+			case bool, *big.Int:
+			default:
+				return "", in.errorf(typeError, "%%%c format: a real number is required, not %s", conv, typeName(v))
+			}
+			spec.WriteByte('d')
+		case 'x', 'X', 'o', 'c':
+			if _, ok := toInt(v); !ok {
+				return "", in.errorf(typeError, "%%%c format: an integer is required, not %s", conv, typeName(v))
+			}
+			spec.WriteByte(conv)
+		case 'e', 'E', 'f', 'F', 'g', 'G':
+			f, ok := toFloat(v)
+			if !ok {
+				return "", in.errorf(typeError, "must be real number, not %s", typeName(v))
+			}
+			v = f
+			spec.WriteByte(conv)
+		default:
+			return "", in.errorf(valueError, "unsupported format character '%c' (0x%x) at index %d", conv, conv, i)
+		}
+		s, err := in.format(v, spec.String())
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+	if next < len(items) && mapping == nil {
+		return "", in.errorf(typeError, "not all arguments converted during string formatting")
+	}
+	if err := in.alloc(int64(b.Len())); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// strFormat implements str.format
+func (in *interp) strFormat(format string, args []value, kw []kwarg) (string, error) {
+	var b strings.Builder
+	auto := 0
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		switch {
+		case c == '{' && i+1 < len(format) && format[i+1] == '{':
+			b.WriteByte('{')
+			i++
+			continue
+		case c == '}' && i+1 < len(format) && format[i+1] == '}':
+			b.WriteByte('}')
+			i++
+			continue
+		case c == '}':
+			return "", in.errorf(valueError, "Single '}' encountered in format string")
+		case c != '{':
+			b.WriteByte(c)
+			continue
+		}
+
+		depth, end := 0, -1
+		for j := i + 1; j < len(format) && end < 0; j++ {
+			switch {
+			case format[j] == '{':
+				depth++
+			case format[j] == '}' && depth > 0:
+				depth--
+			case format[j] == '}':
+				end = j
+			}
+		}
+		if end < 0 {
+			return "", in.errorf(valueError, "expected '}' before end of string")
+		}
+		field := format[i+1 : end]
+		i = end
+
+		name, spec, _ := strings.Cut(field, ":")
+		name, conv, _ := strings.Cut(name, "!")
+		key, rest := name, ""
+		if j := strings.IndexAny(name, ".["); j >= 0 {
+			key, rest = name[:j], name[j:]
+		}
+
+		var v value
+		if key == "" {
+			if auto < 0 {
+				return "", in.errorf(valueError, "cannot switch from manual field specification to automatic field numbering")
+			}
+			key = strconv.Itoa(auto)
+			auto++
+		} else if _, err := strconv.Atoi(key); err == nil {
+			if auto > 0 {
+				return "", in.errorf(valueError, "cannot switch from automatic field numbering to manual field specification")
+			}
+			auto = -1
+		}
+		if n, err := strconv.Atoi(key); err == nil {
+			if n >= len(args) {
+				return "", in.errorf(indexError, "Replacement index %d out of range for positional args tuple", n)
+			}
+			v = args[n]
+		} else {
+			found := false
+			for _, k := range kw {
+				if k.name == key {
+					v, found = k.val, true
+				}
+			}
+			if !found {
+				return "", raise(&excVal{typ: keyError, args: []value{key}})
+			}
+		}
+
+		for rest != "" {
+			if rest[0] == '.' {
+				attr := rest[1:]
+				if j := strings.IndexAny(attr, ".["); j >= 0 {
+					attr, rest = attr[:j], attr[j:]
+				} else {
+					rest = ""
+				}
+				var err error
+				if v, err = in.getattr(v, attr); err != nil {
+					return "", err
+				}
+				continue
+			}
+			close := strings.IndexByte(rest, ']')
+			if close < 0 {
+				return "", in.errorf(valueError, "Missing ']' in format string")
+			}
+			var index value = rest[1:close]
+			if n, err := strconv.Atoi(rest[1:close]); err == nil {
+				index = newInt(int64(n))
+			}
+			rest = rest[close+1:]
+			var err error
+			if v, err = in.getItem(v, index); err != nil {
+				return "", err
+			}
+		}
+
+		switch conv {
+		case "":
+		case "r", "a":
+			v = repr(v)
+		case "s":
+			v = str(v)
+		default:
+			return "", in.errorf(valueError, "Unknown conversion specifier %s", conv)
+		}
+		if strings.Contains(spec, "{") {
+			var err error
+			if spec, err = in.strFormat(spec, args, kw); err != nil {
+				return "", err
+			}
+		}
+		s, err := in.format(v, spec)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s)
+	}
+	if err := in.alloc(int64(b.Len())); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,1410 @@
+package restricted
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// Exceptions
+
+// excType is an exception class
+type excType struct {
+	name   string
+	parent *excType
+}
+
+// excVal is a raised exception
+type excVal struct {
+	typ  *excType
+	args []value
+}
+
+var (
+	baseException     = &excType{name: "BaseException"}
+	exception         = &excType{"Exception", baseException}
+	arithmeticError   = &excType{"ArithmeticError", exception}
+	zeroDivisionError = &excType{"ZeroDivisionError", arithmeticError}
+	overflowError     = &excType{"OverflowError", arithmeticError}
+	lookupError       = &excType{"LookupError", exception}
+	indexError        = &excType{"IndexError", lookupError}
+	keyError          = &excType{"KeyError", lookupError}
+	valueError        = &excType{"ValueError", exception}
+	typeError         = &excType{"TypeError", exception}
+	nameError         = &excType{"NameError", exception}
+	unboundLocalError = &excType{"UnboundLocalError", nameError}
+	attributeError    = &excType{"AttributeError", exception}
+	importError       = &excType{"ImportError", exception}
+	runtimeError      = &excType{"RuntimeError", exception}
+	recursionError    = &excType{"RecursionError", runtimeError}
+	notImplemented    = &excType{"NotImplementedError", runtimeError}
+	assertionError    = &excType{"AssertionError", exception}
+	memoryError       = &excType{"MemoryError", exception}
+	stopIteration     = &excType{"StopIteration", exception}
+	osError           = &excType{"OSError", exception}
+	permissionError   = &excType{"PermissionError", osError}
+)
+
+// excTypes are the exception classes programs can name
+var excTypes = []*excType{
+	baseException, exception, arithmeticError, zeroDivisionError, overflowError,
+	lookupError, indexError, keyError, valueError, typeError, nameError,
+	unboundLocalError, attributeError, importError, runtimeError, recursionError,
+	notImplemented, assertionError, memoryError, stopIteration, osError, permissionError,
+}
+
+// isSubclass reports whether t is base or derives from it
+func (t *excType) isSubclass(base *excType) bool {
+	for ; t != nil; t = t.parent {
+		if t == base {
+			return true
+		}
+	}
+	return false
+}
+
+// pyError is a Python exception propagating through the interpreter
+type pyError struct {
+	exc *excVal
+
+	// trace lists the lines the exception passed through, innermost
+	// first; frame is the depth of the frame that added the last one
+	trace []traceEntry
+	frame int
+}
+
+type traceEntry struct {
+	line int
+	fn   string
+}
+
+func (e *pyError) Error() string {
+	if msg := str(e.exc); msg != "" {
+		return e.exc.typ.name + ": " + msg
+	}
+	return e.exc.typ.name
+}
+
+func raise(exc *excVal) *pyError {
+	return &pyError{exc: exc, frame: -1}
+}
+
+// errStepLimit ends a program that ran too long. Unlike exceptions it
+// cannot be caught.
+var errStepLimit = errors.New("step limit exceeded")
+
+// Interpreter
+
+// interp runs a program. It is not safe for concurrent use.
+type interp struct {
+	ctx    context.Context
+	done   <-chan struct{}
+	limits Limits
+	out    io.Writer
+
+	globals *env
+	steps   int64
+	depth   int
+	memory  int64
+
+	// line is the line of the running statement
+	line int
+
+	// handling is the stack of exceptions being handled, which a bare
+	// raise re-raises
+	handling []*pyError
+
+	// scopes caches the scopes of functions by their definitions
+	scopes map[interface{}]*scopeInfo
+}
+
+// env holds the variables of the module, a function call, or a
+// comprehension
+type env struct {
+	vars   map[string]value
+	scope  *scopeInfo
+	parent *env
+	fn     string
+	ret    value
+}
+
+// scopeInfo lists the names a function binds and declares
+type scopeInfo struct {
+	locals    map[string]bool
+	globals   map[string]bool
+	nonlocals map[string]bool
+}
+
+type funcVal struct {
+	name     string
+	params   []param
+	defaults []value
+	body     []stmt
+	lambda   expr
+	line     int
+	scope    *scopeInfo
+	closure  *env
+}
+
+// ctrl is how a statement ends
+type ctrl int
+
+const (
+	ctrlNext ctrl = iota
+	ctrlBreak
+	ctrlContinue
+	ctrlReturn
+)
+
+// slotSize is the memory charged for an item of a container
+const slotSize = 16
+
+func newInterp(ctx context.Context, limits Limits, out io.Writer) *interp {
+	in := &interp{
+		ctx:    ctx,
+		done:   ctx.Done(),
+		limits: limits,
+		out:    out,
+		scopes: make(map[interface{}]*scopeInfo),
+	}
+	in.globals = &env{vars: map[string]value{"__name__": "__main__"}, fn: "<module>"}
+	return in
+}
+
+func (in *interp) errorf(t *excType, format string, args ...interface{}) error {
+	return raise(&excVal{typ: t, args: []value{fmt.Sprintf(format, args...)}})
+}
+
+// step counts a unit of work against the step limit and checks for
+// cancellation
+func (in *interp) step() error {
+	in.steps++
+	if in.steps > in.limits.Steps {
+		return errStepLimit
+	}
+	select {
+	case <-in.done:
+		return in.ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// charge counts the work of an operation that costs n steps, such as
+// arithmetic on large ints, against the step limit and checks for
+// cancellation
+func (in *interp) charge(n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	in.steps += n - 1
+	return in.step()
+}
+
+// alloc charges n bytes against the memory limit. Memory is charged when
+// values are created and never returned, so the limit bounds what a
+// program allocates in total.
+func (in *interp) alloc(n int64) error {
+	in.memory += n
+	if in.memory > in.limits.Memory {
+		return raise(&excVal{typ: memoryError})
+	}
+	return nil
+}
+
+// allocItems charges the memory of a container of n items
+func (in *interp) allocItems(n int) error {
+	return in.alloc(int64(n) * slotSize)
+}
+
+// Scopes
+
+// scopeOf returns the scope of a function, analyzing it once
+func (in *interp) scopeOf(def interface{}, params []param, body []stmt) *scopeInfo {
+	if s, ok := in.scopes[def]; ok {
+		return s
+	}
+	s := &scopeInfo{locals: map[string]bool{}, globals: map[string]bool{}, nonlocals: map[string]bool{}}
+	for _, p := range params {
+		if p.name != "" {
+			s.locals[p.name] = true
+		}
+	}
+	s.declare(body)
+	for name := range s.globals {
+		delete(s.locals, name)
+	}
+	for name := range s.nonlocals {
+		delete(s.locals, name)
+	}
+	in.scopes[def] = s
+	return s
+}
+
+// declare records the names the statements bind, without entering nested
+// functions
+func (s *scopeInfo) declare(stmts []stmt) {
+	for _, st := range stmts {
+		switch st := st.(type) {
+		case *assignStmt:
+			for _, target := range st.targets {
+				s.bind(target)
+			}
+		case *augAssignStmt:
+			s.bind(st.target)
+		case *forStmt:
+			s.bind(st.target)
+			s.declare(st.body)
+			s.declare(st.orelse)
+		case *whileStmt:
+			s.declare(st.body)
+			s.declare(st.orelse)
+		case *ifStmt:
+			s.declare(st.body)
+			s.declare(st.orelse)
+		case *tryStmt:
+			s.declare(st.body)
+			for _, h := range st.handlers {
+				if h.name != "" {
+					s.locals[h.name] = true
+				}
+				s.declare(h.body)
+			}
+			s.declare(st.orelse)
+			s.declare(st.finally)
+		case *defStmt:
+			s.locals[st.name] = true
+		case *delStmt:
+			for _, target := range st.targets {
+				s.bind(target)
+			}
+		case *globalStmt:
+			for _, name := range st.names {
+				s.globals[name] = true
+			}
+		case *nonlocalStmt:
+			for _, name := range st.names {
+				s.nonlocals[name] = true
+			}
+		}
+	}
+}
+
+func (s *scopeInfo) bind(target expr) {
+	switch t := target.(type) {
+	case *nameExpr:
+		s.locals[t.name] = true
+	case *tupleExpr:
+		for _, elt := range t.elts {
+			s.bind(elt)
+		}
+	case *listExpr:
+		for _, elt := range t.elts {
+			s.bind(elt)
+		}
+	case *starredExpr:
+		s.bind(t.x)
+	}
+}
+
+// lookup returns the value of a name
+func (in *interp) lookup(e *env, name string) (value, error) {
+	for s := e; s != nil && s.scope != nil; s = s.parent {
+		if s.scope.globals[name] {
+			break
+		}
+		if s.scope.locals[name] {
+			if v, ok := s.vars[name]; ok {
+				return v, nil
+			}
+			if s == e {
+				return nil, in.errorf(unboundLocalError, "cannot access local variable '%s' where it is not associated with a value", name)
+			}
+			return nil, in.errorf(nameError, "cannot access free variable '%s' where it is not associated with a value in enclosing scope", name)
+		}
+	}
+	if v, ok := in.globals.vars[name]; ok {
+		return v, nil
+	}
+	if v, ok := builtins[name]; ok {
+		return v, nil
+	}
+	return nil, in.errorf(nameError, "name '%s' is not defined", name)
+}
+
+// owner returns the variables a name is stored in
+func (in *interp) owner(e *env, name string) map[string]value {
+	if e.scope == nil || e.scope.globals[name] {
+		return in.globals.vars
+	}
+	if e.scope.nonlocals[name] {
+		for s := e.parent; s != nil && s.scope != nil; s = s.parent {
+			if s.scope.locals[name] {
+				return s.vars
+			}
+		}
+	}
+	return e.vars
+}
+
+func (in *interp) store(e *env, name string, v value) {
+	in.owner(e, name)[name] = v
+}
+
+// Statements
+
+// run runs a program
+func (in *interp) run(body []stmt) error {
+	_, err := in.execBlock(in.globals, body)
+	return err
+}
+
+func (in *interp) execBlock(e *env, body []stmt) (ctrl, error) {
+	for _, s := range body {
+		c, err := in.exec(e, s)
+		if err != nil || c != ctrlNext {
+			return c, err
+		}
+	}
+	return ctrlNext, nil
+}
+
+// exec runs a statement and adds it to the traceback of an exception
+// raised by it in this frame
+func (in *interp) exec(e *env, s stmt) (ctrl, error) {
+	if err := in.step(); err != nil {
+		return ctrlNext, err
+	}
+	in.line = s.lineno()
+	c, err := in.execStmt(e, s)
+	if pe, ok := err.(*pyError); ok && pe.frame != in.depth {
+		pe.trace = append(pe.trace, traceEntry{s.lineno(), e.fn})
+		pe.frame = in.depth
+	}
+	return c, err
+}
+
+func (in *interp) execStmt(e *env, s stmt) (ctrl, error) {
+	switch s := s.(type) {
+	case *exprStmt:
+		_, err := in.eval(e, s.x)
+		return ctrlNext, err
+	case *assignStmt:
+		v, err := in.eval(e, s.value)
+		if err != nil {
+			return ctrlNext, err
+		}
+		for _, target := range s.targets {
+			if err := in.assign(e, target, v); err != nil {
+				return ctrlNext, err
+			}
+		}
+		return ctrlNext, nil
+	case *augAssignStmt:
+		return ctrlNext, in.augAssign(e, s)
+	case *ifStmt:
+		cond, err := in.eval(e, s.cond)
+		if err != nil {
+			return ctrlNext, err
+		}
+		if truthy(cond) {
+			return in.execBlock(e, s.body)
+		}
+		return in.execBlock(e, s.orelse)
+	case *whileStmt:
+		for {
+			cond, err := in.eval(e, s.cond)
+			if err != nil {
+				return ctrlNext, err
+			}
+			if !truthy(cond) {
+				return in.execBlock(e, s.orelse)
+			}
+			c, err := in.execBlock(e, s.body)
+			if err != nil || c == ctrlReturn {
+				return c, err
+			}
+			if c == ctrlBreak {
+				return ctrlNext, nil
+			}
+			if err := in.step(); err != nil {
+				return ctrlNext, err
+			}
+		}
+	case *forStmt:
+		return in.execFor(e, s)
+	case *breakStmt:
+		return ctrlBreak, nil
+	case *continueStmt:
+		return ctrlContinue, nil
+	case *passStmt, *globalStmt, *nonlocalStmt:
+		return ctrlNext, nil
+	case *returnStmt:
+		e.ret = none
+		if s.x != nil {
+			v, err := in.eval(e, s.x)
+			if err != nil {
+				return ctrlNext, err
+			}
+			e.ret = v
+		}
+		return ctrlReturn, nil
+	case *defStmt:
+		fn, err := in.makeFunc(e, s, s.name, s.params, s.body, nil, s.line)
+		if err != nil {
+			return ctrlNext, err
+		}
+		in.store(e, s.name, fn)
+		return ctrlNext, nil
+	case *delStmt:
+		for _, target := range s.targets {
+			if err := in.del(e, target); err != nil {
+				return ctrlNext, err
+			}
+		}
+		return ctrlNext, nil
+	case *assertStmt:
+		cond, err := in.eval(e, s.cond)
+		if err != nil || truthy(cond) {
+			return ctrlNext, err
+		}
+		exc := &excVal{typ: assertionError}
+		if s.msg != nil {
+			msg, err := in.eval(e, s.msg)
+			if err != nil {
+				return ctrlNext, err
+			}
+			exc.args = []value{msg}
+		}
+		return ctrlNext, raise(exc)
+	case *raiseStmt:
+		return ctrlNext, in.raise(e, s)
+	case *tryStmt:
+		return in.execTry(e, s)
+	case *importStmt:
+		return ctrlNext, in.errorf(importError, "import of '%s' is not allowed in restricted mode", s.module)
+	}
+	return ctrlNext, fmt.Errorf("unknown statement %T", s)
+}
+
+func (in *interp) execFor(e *env, s *forStmt) (ctrl, error) {
+	iterable, err := in.eval(e, s.iter)
+	if err != nil {
+		return ctrlNext, err
+	}
+	result := ctrlNext
+	broke := false
+	err = in.iterate(iterable, func(item value) (bool, error) {
+		if err := in.assign(e, s.target, item); err != nil {
+			return true, err
+		}
+		c, err := in.execBlock(e, s.body)
+		switch {
+		case err != nil:
+			return true, err
+		case c == ctrlReturn:
+			result = ctrlReturn
+			return true, nil
+		case c == ctrlBreak:
+			broke = true
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil || result == ctrlReturn || broke {
+		return result, err
+	}
+	return in.execBlock(e, s.orelse)
+}
+
+func (in *interp) execTry(e *env, s *tryStmt) (ctrl, error) {
+	c, err := in.execBlock(e, s.body)
+	if pe, ok := err.(*pyError); ok && len(s.handlers) > 0 {
+		c, err = in.handle(e, s, pe)
+	} else if err == nil && c == ctrlNext && s.orelse != nil {
+		c, err = in.execBlock(e, s.orelse)
+	}
+	if s.finally == nil {
+		return c, err
+	}
+	if _, ok := err.(*pyError); err != nil && !ok {
+		// The program is stopping; finally blocks do not run
+		return c, err
+	}
+	fc, ferr := in.execBlock(e, s.finally)
+	if ferr != nil || fc != ctrlNext {
+		return fc, ferr
+	}
+	return c, err
+}
+
+// handle runs the first handler that matches an exception
+func (in *interp) handle(e *env, s *tryStmt, pe *pyError) (ctrl, error) {
+	for _, h := range s.handlers {
+		if h.typ != nil {
+			typ, err := in.eval(e, h.typ)
+			if err != nil {
+				return ctrlNext, err
+			}
+			match, err := in.matches(pe.exc, typ)
+			if err != nil {
+				return ctrlNext, err
+			}
+			if !match {
+				continue
+			}
+		}
+		if h.name != "" {
+			in.store(e, h.name, pe.exc)
+		}
+		in.handling = append(in.handling, pe)
+		c, err := in.execBlock(e, h.body)
+		in.handling = in.handling[:len(in.handling)-1]
+		if h.name != "" {
+			delete(in.owner(e, h.name), h.name)
+		}
+		return c, err
+	}
+	return ctrlNext, pe
+}
+
+// matches reports whether an exception is an instance of the class or
+// tuple of classes typ
+func (in *interp) matches(exc *excVal, typ value) (bool, error) {
+	switch t := typ.(type) {
+	case *excType:
+		return exc.typ.isSubclass(t), nil
+	case tupleVal:
+		for _, item := range t {
+			if match, err := in.matches(exc, item); err != nil || match {
+				return match, err
+			}
+		}
+		return false, nil
+	}
+	return false, in.errorf(typeError, "catching classes that do not inherit from BaseException is not allowed")
+}
+
+func (in *interp) raise(e *env, s *raiseStmt) error {
+	if s.x == nil {
+		if len(in.handling) == 0 {
+			return in.errorf(runtimeError, "No active exception to reraise")
+		}
+		return in.handling[len(in.handling)-1]
+	}
+	v, err := in.eval(e, s.x)
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case *excType:
+		return raise(&excVal{typ: v})
+	case *excVal:
+		return raise(v)
+	}
+	return in.errorf(typeError, "exceptions must derive from BaseException")
+}
+
+// assign assigns a value to a target
+func (in *interp) assign(e *env, target expr, v value) error {
+	switch t := target.(type) {
+	case *nameExpr:
+		in.store(e, t.name, v)
+		return nil
+	case *indexExpr:
+		obj, err := in.eval(e, t.x)
+		if err != nil {
+			return err
+		}
+		index, err := in.evalIndex(e, t.index)
+		if err != nil {
+			return err
+		}
+		return in.setItem(obj, index, v)
+	case *tupleExpr:
+		return in.unpack(e, t.elts, v)
+	case *listExpr:
+		return in.unpack(e, t.elts, v)
+	}
+	return in.errorf(typeError, "cannot assign to %s", describe(target))
+}
+
+// unpack assigns the items of an iterable to targets, one of which may be
+// starred
+func (in *interp) unpack(e *env, targets []expr, v value) error {
+	items, err := in.toList(v)
+	if err != nil {
+		if pe, ok := err.(*pyError); ok && pe.exc.typ == typeError {
+			return in.errorf(typeError, "cannot unpack non-iterable %s object", typeName(v))
+		}
+		return err
+	}
+	star := -1
+	for i, target := range targets {
+		if _, ok := target.(*starredExpr); ok {
+			star = i
+		}
+	}
+	if star < 0 {
+		if len(items) < len(targets) {
+			return in.errorf(valueError, "not enough values to unpack (expected %d, got %d)", len(targets), len(items))
+		}
+		if len(items) > len(targets) {
+			return in.errorf(valueError, "too many values to unpack (expected %d)", len(targets))
+		}
+		for i, target := range targets {
+			if err := in.assign(e, target, items[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	after := len(targets) - star - 1
+	if len(items) < len(targets)-1 {
+		return in.errorf(valueError, "not enough values to unpack (expected at least %d, got %d)", len(targets)-1, len(items))
+	}
+	for i := 0; i < star; i++ {
+		if err := in.assign(e, targets[i], items[i]); err != nil {
+			return err
+		}
+	}
+	rest := append([]value(nil), items[star:len(items)-after]...)
+	if err := in.assign(e, targets[star].(*starredExpr).x, &listVal{rest}); err != nil {
+		return err
+	}
+	for i := 0; i < after; i++ {
+		if err := in.assign(e, targets[star+1+i], items[len(items)-after+i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *interp) augAssign(e *env, s *augAssignStmt) error {
+	switch t := s.target.(type) {
+	case *nameExpr:
+		old, err := in.lookup(e, t.name)
+		if err != nil {
+			return err
+		}
+		v, err := in.eval(e, s.value)
+		if err != nil {
+			return err
+		}
+		result, err := in.inplace(s.op, old, v)
+		if err != nil {
+			return err
+		}
+		in.store(e, t.name, result)
+		return nil
+	case *indexExpr:
+		obj, err := in.eval(e, t.x)
+		if err != nil {
+			return err
+		}
+		index, err := in.evalIndex(e, t.index)
+		if err != nil {
+			return err
+		}
+		old, err := in.getItem(obj, index)
+		if err != nil {
+			return err
+		}
+		v, err := in.eval(e, s.value)
+		if err != nil {
+			return err
+		}
+		result, err := in.inplace(s.op, old, v)
+		if err != nil {
+			return err
+		}
+		return in.setItem(obj, index, result)
+	}
+	return in.errorf(typeError, "illegal expression for augmented assignment")
+}
+
+// inplace applies an augmented assignment operator; lists, dicts, and sets
+// change in place
+func (in *interp) inplace(op string, a, b value) (value, error) {
+	switch a := a.(type) {
+	case *listVal:
+		if op == "+" {
+			items, err := in.toList(b)
+			if err != nil {
+				return nil, err
+			}
+			if err := in.allocItems(len(items)); err != nil {
+				return nil, err
+			}
+			a.items = append(a.items, items...)
+			return a, nil
+		}
+	case *setVal:
+		if b, ok := b.(*setVal); ok && strings.Contains("|&-^", op) {
+			result, err := in.binary(op, a, b)
+			if err != nil {
+				return nil, err
+			}
+			*a = *result.(*setVal)
+			return a, nil
+		}
+	case *dictVal:
+		if b, ok := b.(*dictVal); ok && op == "|" {
+			for i, key := range b.keys {
+				if err := a.set(in, key, b.vals[i]); err != nil {
+					return nil, err
+				}
+			}
+			return a, nil
+		}
+	}
+	return in.binary(op, a, b)
+}
+
+func (in *interp) del(e *env, target expr) error {
+	switch t := target.(type) {
+	case *nameExpr:
+		vars := in.owner(e, t.name)
+		if _, ok := vars[t.name]; !ok {
+			return in.errorf(nameError, "name '%s' is not defined", t.name)
+		}
+		delete(vars, t.name)
+		return nil
+	case *indexExpr:
+		obj, err := in.eval(e, t.x)
+		if err != nil {
+			return err
+		}
+		index, err := in.evalIndex(e, t.index)
+		if err != nil {
+			return err
+		}
+		return in.delItem(obj, index)
+	case *tupleExpr:
+		for _, elt := range t.elts {
+			if err := in.del(e, elt); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *listExpr:
+		for _, elt := range t.elts {
+			if err := in.del(e, elt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return in.errorf(typeError, "cannot delete %s", describe(target))
+}
+
+// Functions
+
+func (in *interp) makeFunc(e *env, def interface{}, name string, params []param, body []stmt, lambda expr, line int) (*funcVal, error) {
+	fn := &funcVal{
+		name:     name,
+		params:   params,
+		defaults: make([]value, len(params)),
+		body:     body,
+		lambda:   lambda,
+		line:     line,
+		scope:    in.scopeOf(def, params, body),
+		closure:  e,
+	}
+	if e.scope == nil {
+		// Module-level functions find globals without a closure
+		fn.closure = nil
+	}
+	for i, p := range params {
+		if p.def == nil {
+			continue
+		}
+		v, err := in.eval(e, p.def)
+		if err != nil {
+			return nil, err
+		}
+		fn.defaults[i] = v
+	}
+	return fn, nil
+}
+
+// call calls a function
+func (in *interp) call(fn value, args []value, kw []kwarg) (value, error) {
+	if err := in.step(); err != nil {
+		return nil, err
+	}
+	switch f := fn.(type) {
+	case *funcVal:
+		return in.callFunc(f, args, kw)
+	case *builtinFn:
+		return f.call(in, args, kw)
+	case *boundMethod:
+		return f.call(in, f.self, args, kw)
+	case *typeVal:
+		return f.call(in, args, kw)
+	case *excType:
+		if len(kw) > 0 {
+			return nil, in.errorf(typeError, "%s() takes no keyword arguments", f.name)
+		}
+		return &excVal{typ: f, args: append([]value(nil), args...)}, nil
+	}
+	return nil, in.errorf(typeError, "'%s' object is not callable", typeName(fn))
+}
+
+func (in *interp) callFunc(f *funcVal, args []value, kw []kwarg) (value, error) {
+	if in.depth >= in.limits.Depth {
+		return nil, in.errorf(recursionError, "maximum recursion depth exceeded")
+	}
+	e := &env{vars: make(map[string]value, len(f.params)), scope: f.scope, parent: f.closure, fn: f.name}
+	if err := in.bindArgs(f, e.vars, args, kw); err != nil {
+		return nil, err
+	}
+
+	in.depth++
+	line := in.line
+	defer func() {
+		in.depth--
+		in.line = line
+	}()
+	if f.lambda != nil {
+		v, err := in.eval(e, f.lambda)
+		if pe, ok := err.(*pyError); ok && pe.frame != in.depth {
+			pe.trace = append(pe.trace, traceEntry{f.line, f.name})
+			pe.frame = in.depth
+		}
+		return v, err
+	}
+	if _, err := in.execBlock(e, f.body); err != nil {
+		return nil, err
+	}
+	if e.ret == nil {
+		return none, nil
+	}
+	return e.ret, nil
+}
+
+// bindArgs binds the arguments of a call to the parameters of a function
+func (in *interp) bindArgs(f *funcVal, vars map[string]value, args []value, kw []kwarg) error {
+	var varargs, kwargs string
+	hasVarargs := false
+	positional := 0
+	for _, p := range f.params {
+		switch p.star {
+		case 1:
+			varargs, hasVarargs = p.name, true
+		case 2:
+			kwargs = p.name
+		default:
+			if !hasVarargs {
+				positional++
+			}
+		}
+	}
+
+	n := 0
+	for _, p := range f.params {
+		if p.star != 0 || n >= len(args) {
+			break
+		}
+		vars[p.name] = args[n]
+		n++
+	}
+	if n < len(args) {
+		if varargs == "" {
+			given := "were"
+			if len(args) == 1 {
+				given = "was"
+			}
+			return in.errorf(typeError, "%s() takes %d positional argument%s but %d %s given", f.name, positional, plural(positional), len(args), given)
+		}
+	}
+	if varargs != "" {
+		vars[varargs] = tupleVal(append([]value(nil), args[n:]...))
+	}
+
+	var extra *dictVal
+	if kwargs != "" {
+		extra = newDict()
+		vars[kwargs] = extra
+	}
+	for _, k := range kw {
+		found := false
+		for _, p := range f.params {
+			if p.star == 0 && p.name == k.name {
+				found = true
+				break
+			}
+		}
+		switch {
+		case found:
+			if _, ok := vars[k.name]; ok {
+				return in.errorf(typeError, "%s() got multiple values for argument '%s'", f.name, k.name)
+			}
+			vars[k.name] = k.val
+		case extra != nil:
+			if err := extra.set(in, k.name, k.val); err != nil {
+				return err
+			}
+		default:
+			return in.errorf(typeError, "%s() got an unexpected keyword argument '%s'", f.name, k.name)
+		}
+	}
+
+	// Python reports missing positional arguments before keyword-only ones
+	var missing [2][]string
+	kwonly := 0
+	for i, p := range f.params {
+		if p.star != 0 {
+			kwonly = 1
+			continue
+		}
+		if _, ok := vars[p.name]; ok {
+			continue
+		}
+		if f.defaults[i] != nil {
+			vars[p.name] = f.defaults[i]
+			continue
+		}
+		missing[kwonly] = append(missing[kwonly], "'"+p.name+"'")
+	}
+	for i, kind := range []string{"positional", "keyword-only"} {
+		names := missing[i]
+		if len(names) == 0 {
+			continue
+		}
+		list := names[0]
+		if len(names) > 1 {
+			list = strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+		}
+		return in.errorf(typeError, "%s() missing %d required %s argument%s: %s", f.name, len(names), kind, plural(len(names)), list)
+	}
+	return nil
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// Expressions
+
+func (in *interp) eval(e *env, x expr) (value, error) {
+	switch x := x.(type) {
+	case *nameExpr:
+		return in.lookup(e, x.name)
+	case *constExpr:
+		return x.val, nil
+	case *fstringExpr:
+		return in.evalFString(e, x)
+	case *listExpr:
+		items, err := in.evalItems(e, x.elts)
+		if err != nil {
+			return nil, err
+		}
+		return &listVal{items}, nil
+	case *tupleExpr:
+		items, err := in.evalItems(e, x.elts)
+		if err != nil {
+			return nil, err
+		}
+		return tupleVal(items), nil
+	case *setExpr:
+		items, err := in.evalItems(e, x.elts)
+		if err != nil {
+			return nil, err
+		}
+		s := newSet()
+		for _, item := range items {
+			if err := s.add(in, item); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case *dictExpr:
+		d := newDict()
+		for i := range x.keys {
+			key, err := in.eval(e, x.keys[i])
+			if err != nil {
+				return nil, err
+			}
+			val, err := in.eval(e, x.vals[i])
+			if err != nil {
+				return nil, err
+			}
+			if err := d.set(in, key, val); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	case *compExpr:
+		return in.evalComp(e, x)
+	case *unaryExpr:
+		v, err := in.eval(e, x.x)
+		if err != nil {
+			return nil, err
+		}
+		return in.unary(x.op, v)
+	case *binExpr:
+		a, err := in.eval(e, x.x)
+		if err != nil {
+			return nil, err
+		}
+		b, err := in.eval(e, x.y)
+		if err != nil {
+			return nil, err
+		}
+		return in.binary(x.op, a, b)
+	case *boolExpr:
+		a, err := in.eval(e, x.x)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(a) == (x.op == "or") {
+			return a, nil
+		}
+		return in.eval(e, x.y)
+	case *compareExpr:
+		return in.evalCompare(e, x)
+	case *condExpr:
+		cond, err := in.eval(e, x.cond)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return in.eval(e, x.a)
+		}
+		return in.eval(e, x.b)
+	case *lambdaExpr:
+		return in.makeFunc(e, x, "<lambda>", x.params, nil, x.body, in.line)
+	case *callExpr:
+		return in.evalCall(e, x)
+	case *attrExpr:
+		obj, err := in.eval(e, x.x)
+		if err != nil {
+			return nil, err
+		}
+		return in.getattr(obj, x.name)
+	case *indexExpr:
+		obj, err := in.eval(e, x.x)
+		if err != nil {
+			return nil, err
+		}
+		index, err := in.evalIndex(e, x.index)
+		if err != nil {
+			return nil, err
+		}
+		return in.getItem(obj, index)
+	case *starredExpr:
+		return nil, in.errorf(typeError, "can't use starred expression here")
+	}
+	return nil, fmt.Errorf("unknown expression %T", x)
+}
+
+// evalItems evaluates the items of a display, expanding starred items
+func (in *interp) evalItems(e *env, elts []expr) ([]value, error) {
+	items := make([]value, 0, len(elts))
+	for _, elt := range elts {
+		if star, ok := elt.(*starredExpr); ok {
+			v, err := in.eval(e, star.x)
+			if err != nil {
+				return nil, err
+			}
+			more, err := in.toList(v)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, more...)
+			continue
+		}
+		v, err := in.eval(e, elt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, in.allocItems(len(items))
+}
+
+// evalIndex evaluates a subscript, which may be a slice
+func (in *interp) evalIndex(e *env, x expr) (value, error) {
+	s, ok := x.(*sliceExpr)
+	if !ok {
+		return in.eval(e, x)
+	}
+	sv := &sliceVal{none, none, none}
+	for i, part := range []expr{s.lo, s.hi, s.step} {
+		if part == nil {
+			continue
+		}
+		v, err := in.eval(e, part)
+		if err != nil {
+			return nil, err
+		}
+		switch i {
+		case 0:
+			sv.lo = v
+		case 1:
+			sv.hi = v
+		case 2:
+			sv.step = v
+		}
+	}
+	return sv, nil
+}
+
+func (in *interp) evalCompare(e *env, x *compareExpr) (value, error) {
+	a, err := in.eval(e, x.first)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range x.ops {
+		b, err := in.eval(e, x.rest[i])
+		if err != nil {
+			return nil, err
+		}
+		ok, err := in.compareOp(op, a, b)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return false, nil
+		}
+		a = b
+	}
+	return true, nil
+}
+
+// compareOp applies a comparison operator
+func (in *interp) compareOp(op string, a, b value) (bool, error) {
+	switch op {
+	case "==":
+		return in.equal(a, b)
+	case "!=":
+		eq, err := in.equal(a, b)
+		return !eq, err
+	case "is":
+		return identical(a, b), nil
+	case "is not":
+		return !identical(a, b), nil
+	case "in":
+		return in.contains(b, a)
+	case "not in":
+		found, err := in.contains(b, a)
+		return !found, err
+	}
+	c, err := in.compare(op, a, b)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "<":
+		return c == -1, nil
+	case "<=":
+		return c == -1 || c == 0, nil
+	case ">":
+		return c == 1, nil
+	}
+	return c == 1 || c == 0, nil
+}
+
+// identical reports whether a is b. Small ints, strings, and None are
+// shared by CPython, and compare by value here.
+func identical(a, b value) bool {
+	switch a := a.(type) {
+	case noneType, bool, string, float64:
+		return a == b
+	case *big.Int:
+		b, ok := b.(*big.Int)
+		return ok && (a == b || (a.IsInt64() && a.Int64() >= -5 && a.Int64() <= 256 && a.Cmp(b) == 0))
+	case tupleVal:
+		b, ok := b.(tupleVal)
+		return ok && len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+	case rangeVal:
+		return false
+	}
+	return a == b
+}
+
+func (in *interp) evalCall(e *env, x *callExpr) (value, error) {
+	fn, err := in.eval(e, x.fn)
+	if err != nil {
+		return nil, err
+	}
+	var args []value
+	var kw []kwarg
+	for _, a := range x.args {
+		v, err := in.eval(e, a.x)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case a.star == 1:
+			items, err := in.toList(v)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, items...)
+		case a.star == 2:
+			d, ok := v.(*dictVal)
+			if !ok {
+				return nil, in.errorf(typeError, "argument after ** must be a mapping, not %s", typeName(v))
+			}
+			for i, key := range d.keys {
+				name, ok := key.(string)
+				if !ok {
+					return nil, in.errorf(typeError, "keywords must be strings")
+				}
+				kw = append(kw, kwarg{name, d.vals[i]})
+			}
+		case a.name != "":
+			for _, k := range kw {
+				if k.name == a.name {
+					return nil, in.errorf(typeError, "keyword argument repeated: %s", a.name)
+				}
+			}
+			kw = append(kw, kwarg{a.name, v})
+		default:
+			args = append(args, v)
+		}
+	}
+	return in.call(fn, args, kw)
+}
+
+// evalComp evaluates a comprehension in a scope of its own
+func (in *interp) evalComp(e *env, x *compExpr) (value, error) {
+	scope := in.scopes[x]
+	if scope == nil {
+		scope = &scopeInfo{locals: map[string]bool{}}
+		for _, clause := range x.clauses {
+			scope.bind(clause.target)
+		}
+		in.scopes[x] = scope
+	}
+	ce := &env{vars: map[string]value{}, scope: scope, parent: e, fn: e.fn}
+
+	var items []value
+	var d *dictVal
+	if x.kind == ':' {
+		d = newDict()
+	}
+	var loop func(level int, outer *env) error
+	loop = func(level int, outer *env) error {
+		if level == len(x.clauses) {
+			if d != nil {
+				key, err := in.eval(ce, x.elt)
+				if err != nil {
+					return err
+				}
+				val, err := in.eval(ce, x.val)
+				if err != nil {
+					return err
+				}
+				return d.set(in, key, val)
+			}
+			v, err := in.eval(ce, x.elt)
+			if err != nil {
+				return err
+			}
+			if err := in.alloc(slotSize); err != nil {
+				return err
+			}
+			items = append(items, v)
+			return nil
+		}
+		clause := x.clauses[level]
+		// The first iterable is evaluated in the enclosing scope
+		iterable, err := in.eval(outer, clause.iter)
+		if err != nil {
+			return err
+		}
+		return in.iterate(iterable, func(item value) (bool, error) {
+			if err := in.assign(ce, clause.target, item); err != nil {
+				return true, err
+			}
+			for _, cond := range clause.conds {
+				v, err := in.eval(ce, cond)
+				if err != nil {
+					return true, err
+				}
+				if !truthy(v) {
+					return false, nil
+				}
+			}
+			return false, loop(level+1, ce)
+		})
+	}
+	if err := loop(0, e); err != nil {
+		return nil, err
+	}
+
+	switch x.kind {
+	case '[':
+		return &listVal{items}, nil
+	case ':':
+		return d, nil
+	case '{':
+		s := newSet()
+		for _, item := range items {
+			if err := s.add(in, item); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	}
+	return listIterator("generator", items), nil
+}
+
+// listIterator returns an iterator over items
+func listIterator(name string, items []value) *iterVal {
+	i := 0
+	return &iterVal{name: name, next: func() (value, bool, error) {
+		if i >= len(items) {
+			return nil, false, nil
+		}
+		i++
+		return items[i-1], true, nil
+	}}
+}
+
+func (in *interp) evalFString(e *env, x *fstringExpr) (value, error) {
+	var b strings.Builder
+	for _, part := range x.parts {
+		b.WriteString(part.lit)
+		if part.x == nil {
+			continue
+		}
+		v, err := in.eval(e, part.x)
+		if err != nil {
+			return nil, err
+		}
+		switch part.conv {
+		case 'r', 'a':
+			v = repr(v)
+		case 's':
+			v = str(v)
+		}
+		spec := ""
+		if part.spec != nil {
+			s, err := in.evalFString(e, part.spec)
+			if err != nil {
+				return nil, err
+			}
+			spec = s.(string)
+		}
+		s, err := in.format(v, spec)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(s)
+		if err := in.alloc(int64(len(s))); err != nil {
+			return nil, err
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,420 @@
+package restricted
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNewline
+	tokIndent
+	tokDedent
+	tokName
+	tokInt
+	tokFloat
+	tokString
+	tokFString
+	tokOp
+)
+
+// token is a lexical token. The text of strings is their decoded value;
+// f-strings keep their braces.
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// SyntaxError is a program that cannot be parsed
+// SyntaxError is a program that cannot be parsed; Kind is SyntaxError or
+// IndentationError
+type SyntaxError struct {
+	Kind string
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Kind, e.Msg)
+}
+
+func syntaxErrorf(line int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Kind: "SyntaxError", Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// operators lists the operators, longest first
+var operators = []string{
+	"**=", "//=", ">>=", "<<=", "...",
+	"**", "//", "==", "!=", "<=", ">=", "<<", ">>", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "->", ":=",
+	"+", "-", "*", "/", "%", "@", "&", "|", "^", "~", "<", ">", "(", ")", "[", "]", "{", "}", ",", ":", ".", ";", "=",
+}
+
+type lexer struct {
+	src     []rune
+	pos     int
+	line    int
+	depth   int
+	indents []int
+	tokens  []token
+}
+
+// tokenize splits source code into tokens, with INDENT and DEDENT tokens
+// for changes of indentation
+func tokenize(src string) ([]token, error) {
+	l := &lexer{src: []rune(src), line: 1, indents: []int{0}}
+	if err := l.run(); err != nil {
+		return nil, err
+	}
+	return l.tokens, nil
+}
+
+func (l *lexer) emit(kind tokenKind, text string) {
+	l.tokens = append(l.tokens, token{kind: kind, text: text, line: l.line})
+}
+
+func (l *lexer) peek(offset int) rune {
+	if l.pos+offset < len(l.src) {
+		return l.src[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *lexer) run() error {
+	atLineStart := true
+	for {
+		if atLineStart && l.depth == 0 {
+			done, err := l.indent()
+			if err != nil {
+				return err
+			}
+			if done {
+				break
+			}
+			atLineStart = false
+		}
+		if l.pos >= len(l.src) {
+			break
+		}
+
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\f' || c == '\r':
+			l.pos++
+		case c == '\\' && l.peek(1) == '\n':
+			l.pos += 2
+			l.line++
+		case c == '\\' && l.peek(1) == '\r' && l.peek(2) == '\n':
+			l.pos += 3
+			l.line++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '\n':
+			if l.depth == 0 {
+				l.emit(tokNewline, "")
+				atLineStart = true
+			}
+			l.pos++
+			l.line++
+		case isIdentStart(c):
+			start := l.pos
+			for l.pos < len(l.src) && isIdentPart(l.src[l.pos]) {
+				l.pos++
+			}
+			word := string(l.src[start:l.pos])
+			if q := l.peek(0); (q == '\'' || q == '"') && isStringPrefix(word) {
+				if err := l.string(strings.ToLower(word)); err != nil {
+					return err
+				}
+				continue
+			}
+			l.emit(tokName, word)
+		case unicode.IsDigit(c) || (c == '.' && unicode.IsDigit(l.peek(1))):
+			if err := l.number(); err != nil {
+				return err
+			}
+		case c == '\'' || c == '"':
+			if err := l.string(""); err != nil {
+				return err
+			}
+		default:
+			if err := l.operator(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if n := len(l.tokens); n > 0 && l.tokens[n-1].kind != tokNewline && l.tokens[n-1].kind != tokDedent {
+		l.emit(tokNewline, "")
+	}
+	for len(l.indents) > 1 {
+		l.indents = l.indents[:len(l.indents)-1]
+		l.emit(tokDedent, "")
+	}
+	l.emit(tokEOF, "")
+	return nil
+}
+
+// indent measures the indentation of a line and emits INDENT and DEDENT
+// tokens. Blank lines and comments are skipped. It reports whether the
+// source ended.
+func (l *lexer) indent() (bool, error) {
+	for {
+		width := 0
+		for l.pos < len(l.src) {
+			switch l.src[l.pos] {
+			case ' ':
+				width++
+			case '\t':
+				width += 8 - width%8
+			case '\f', '\r':
+			default:
+				goto measured
+			}
+			l.pos++
+		}
+	measured:
+		if l.pos >= len(l.src) {
+			return true, nil
+		}
+		switch l.src[l.pos] {
+		case '\n':
+			l.pos++
+			l.line++
+			continue
+		case '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+
+		top := l.indents[len(l.indents)-1]
+		switch {
+		case width > top:
+			if len(l.tokens) == 0 {
+				return false, &SyntaxError{Kind: "IndentationError", Line: l.line, Msg: "unexpected indent"}
+			}
+			l.indents = append(l.indents, width)
+			l.emit(tokIndent, "")
+		case width < top:
+			for width < l.indents[len(l.indents)-1] {
+				l.indents = l.indents[:len(l.indents)-1]
+				l.emit(tokDedent, "")
+			}
+			if width != l.indents[len(l.indents)-1] {
+				return false, &SyntaxError{Kind: "IndentationError", Line: l.line, Msg: "unindent does not match any outer indentation level"}
+			}
+		}
+		return false, nil
+	}
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c)
+}
+
+func isIdentPart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+func isStringPrefix(word string) bool {
+	switch strings.ToLower(word) {
+	case "r", "f", "b", "rb", "br", "fr", "rf", "u":
+		return true
+	}
+	return false
+}
+
+func (l *lexer) number() error {
+	start := l.pos
+	if l.src[l.pos] == '0' && strings.ContainsRune("xXoObB", l.peek(1)) {
+		l.pos += 2
+		for l.pos < len(l.src) && (isIdentPart(l.src[l.pos])) {
+			l.pos++
+		}
+		l.emit(tokInt, strings.ReplaceAll(string(l.src[start:l.pos]), "_", ""))
+		return nil
+	}
+
+	isFloat := false
+	digits := func() {
+		for l.pos < len(l.src) && (unicode.IsDigit(l.src[l.pos]) || l.src[l.pos] == '_') {
+			l.pos++
+		}
+	}
+	digits()
+	if l.peek(0) == '.' {
+		isFloat = true
+		l.pos++
+		digits()
+	}
+	if c := l.peek(0); c == 'e' || c == 'E' {
+		next := l.peek(1)
+		if unicode.IsDigit(next) || ((next == '+' || next == '-') && unicode.IsDigit(l.peek(2))) {
+			isFloat = true
+			l.pos += 2
+			digits()
+		}
+	}
+	if c := l.peek(0); c == 'j' || c == 'J' {
+		return syntaxErrorf(l.line, "complex numbers are not supported")
+	}
+	if l.pos < len(l.src) && isIdentStart(l.src[l.pos]) {
+		return syntaxErrorf(l.line, "invalid decimal literal")
+	}
+
+	text := strings.ReplaceAll(string(l.src[start:l.pos]), "_", "")
+	if isFloat {
+		l.emit(tokFloat, text)
+	} else {
+		if len(text) > 1 && text[0] == '0' && strings.Trim(text, "0") != "" {
+			return syntaxErrorf(l.line, "leading zeros in decimal integer literals are not permitted")
+		}
+		l.emit(tokInt, text)
+	}
+	return nil
+}
+
+// string reads a string literal with the given lowercase prefix
+func (l *lexer) string(prefix string) error {
+	if strings.Contains(prefix, "b") {
+		return syntaxErrorf(l.line, "bytes literals are not supported")
+	}
+	raw := strings.Contains(prefix, "r")
+	line := l.line
+
+	q := l.src[l.pos]
+	triple := l.peek(1) == q && l.peek(2) == q
+	if triple {
+		l.pos += 3
+	} else {
+		l.pos++
+	}
+
+	var b strings.Builder
+	for {
+		if l.pos >= len(l.src) {
+			return syntaxErrorf(line, "unterminated string literal")
+		}
+		c := l.src[l.pos]
+		if c == q && (!triple || (l.peek(1) == q && l.peek(2) == q)) {
+			if triple {
+				l.pos += 3
+			} else {
+				l.pos++
+			}
+			break
+		}
+		if c == '\n' {
+			if !triple {
+				return syntaxErrorf(line, "unterminated string literal")
+			}
+			l.line++
+		}
+		if c == '\\' && l.pos+1 < len(l.src) {
+			next := l.src[l.pos+1]
+			if raw {
+				b.WriteRune(c)
+				b.WriteRune(next)
+				if next == '\n' {
+					l.line++
+				}
+				l.pos += 2
+				continue
+			}
+			n, err := l.escape(&b)
+			if err != nil {
+				return err
+			}
+			l.pos += n
+			continue
+		}
+		b.WriteRune(c)
+		l.pos++
+	}
+
+	kind := tokString
+	if strings.Contains(prefix, "f") {
+		kind = tokFString
+	}
+	l.tokens = append(l.tokens, token{kind: kind, text: b.String(), line: line})
+	return nil
+}
+
+// escape decodes the escape sequence at the lexer position and returns its
+// length
+func (l *lexer) escape(b *strings.Builder) (int, error) {
+	next := l.src[l.pos+1]
+	switch next {
+	case '\n':
+		l.line++
+		return 2, nil
+	case 'n':
+		b.WriteByte('\n')
+	case 't':
+		b.WriteByte('\t')
+	case 'r':
+		b.WriteByte('\r')
+	case '0':
+		b.WriteByte(0)
+	case 'a':
+		b.WriteByte('\a')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'v':
+		b.WriteByte('\v')
+	case '\\', '\'', '"':
+		b.WriteRune(next)
+	case 'x', 'u', 'U':
+		size := map[rune]int{'x': 2, 'u': 4, 'U': 8}[next]
+		if l.pos+2+size > len(l.src) {
+			return 0, syntaxErrorf(l.line, "truncated \\%c escape", next)
+		}
+		code, err := strconv.ParseUint(string(l.src[l.pos+2:l.pos+2+size]), 16, 32)
+		if err != nil {
+			return 0, syntaxErrorf(l.line, "truncated \\%c escape", next)
+		}
+		b.WriteRune(rune(code))
+		return 2 + size, nil
+	default:
+		b.WriteByte('\\')
+		b.WriteRune(next)
+	}
+	return 2, nil
+}
+
+func (l *lexer) operator() error {
+	rest := string(l.src[l.pos:min(l.pos+3, len(l.src))])
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			switch op {
+			case "(", "[", "{":
+				l.depth++
+			case ")", "]", "}":
+				if l.depth > 0 {
+					l.depth--
+				}
+			}
+			l.emit(tokOp, op)
+			l.pos += len([]rune(op))
+			return nil
+		}
+	}
+	return syntaxErrorf(l.line, "invalid character '%c'", l.src[l.pos])
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
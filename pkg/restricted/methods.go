@@ -0,0 +1,1028 @@
+package restricted
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type method func(in *interp, self value, args []value, kw []kwarg) (value, error)
+
+// methods are the methods of the built-in types by type name
+var methods map[string]map[string]method
+
+func initMethods() {
+	methods = map[string]map[string]method{
+		"str":   strMethods(),
+		"list":  listMethods(),
+		"dict":  dictMethods(),
+		"set":   setMethods(),
+		"tuple": tupleMethods(),
+		"int": {
+			"bit_length": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+				if err := in.arity("bit_length", args, kw, 0, 0); err != nil {
+					return nil, err
+				}
+				n, _ := toInt(self)
+				return newInt(int64(n.BitLen())), nil
+			},
+		},
+		"float": {
+			"is_integer": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+				if err := in.arity("is_integer", args, kw, 0, 0); err != nil {
+					return nil, err
+				}
+				f := self.(float64)
+				return f == math.Trunc(f) && !math.IsInf(f, 0), nil
+			},
+		},
+	}
+	methods["bool"] = methods["int"]
+}
+
+// getattr returns an attribute of a value. Only the methods of built-in
+// types and a few attributes are available.
+func (in *interp) getattr(obj value, name string) (value, error) {
+	if m, ok := methods[typeName(obj)][name]; ok {
+		return &boundMethod{self: obj, name: name, call: m}, nil
+	}
+	switch o := obj.(type) {
+	case *excVal:
+		if name == "args" {
+			return tupleVal(o.args), nil
+		}
+	case *typeVal:
+		if name == "__name__" {
+			return o.name, nil
+		}
+	case *excType:
+		if name == "__name__" {
+			return o.name, nil
+		}
+	case *funcVal:
+		if name == "__name__" {
+			return o.name, nil
+		}
+	case *builtinFn:
+		if name == "__name__" {
+			return o.name, nil
+		}
+	case rangeVal:
+		switch name {
+		case "start":
+			return newInt(o.start), nil
+		case "stop":
+			return newInt(o.stop), nil
+		case "step":
+			return newInt(o.step), nil
+		}
+	}
+	if _, ok := obj.(*excType); ok {
+		return nil, in.errorf(attributeError, "type object '%s' has no attribute '%s'", obj.(*excType).name, name)
+	}
+	return nil, in.errorf(attributeError, "'%s' object has no attribute '%s'", typeName(obj), name)
+}
+
+// stringArg returns a positional argument that must be a string
+func (in *interp) stringArg(name string, v value) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", in.errorf(typeError, "%s() argument must be str, not %s", name, typeName(v))
+	}
+	return s, nil
+}
+
+// runeIndex converts a byte offset in s to a character index
+func runeIndex(s string, i int) int {
+	if i < 0 {
+		return i
+	}
+	return utf8.RuneCountInString(s[:i])
+}
+
+// substring returns s[start:end] for the optional start and end arguments
+// of str methods, and the character offset of the result
+func (in *interp) substring(s string, args []value) (string, int, error) {
+	runes := []rune(s)
+	lo, hi := value(none), value(none)
+	if len(args) > 0 {
+		lo = args[0]
+	}
+	if len(args) > 1 {
+		hi = args[1]
+	}
+	start, stop, _, err := in.indices(&sliceVal{lo, hi, none}, len(runes))
+	if err != nil {
+		return "", 0, err
+	}
+	if stop < start {
+		return "", start, nil
+	}
+	return string(runes[start:stop]), start, nil
+}
+
+func strMethods() map[string]method {
+	mapper := func(name string, fn func(string) string) method {
+		return func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity(name, args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			return fn(self.(string)), nil
+		}
+	}
+	predicate := func(name string, fn func(rune) bool, cased bool) method {
+		return func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity(name, args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			s := self.(string)
+			if s == "" {
+				return false, nil
+			}
+			seen := false
+			for _, r := range s {
+				if cased {
+					// isupper and islower look at cased characters only
+					if unicode.IsUpper(r) || unicode.IsLower(r) || unicode.IsTitle(r) {
+						seen = true
+						if !fn(r) {
+							return false, nil
+						}
+					}
+					continue
+				}
+				if !fn(r) {
+					return false, nil
+				}
+			}
+			return !cased || seen, nil
+		}
+	}
+	strip := func(name string, fn func(string, string) string, space func(string) string) method {
+		return func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity(name, args, kw, 0, 1); err != nil {
+				return nil, err
+			}
+			if len(args) == 0 || args[0] == value(none) {
+				return space(self.(string)), nil
+			}
+			chars, err := in.stringArg(name, args[0])
+			if err != nil {
+				return nil, err
+			}
+			return fn(self.(string), chars), nil
+		}
+	}
+	find := func(name string, last, raises bool) method {
+		return func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity(name, args, kw, 1, 3); err != nil {
+				return nil, err
+			}
+			sub, err := in.stringArg(name, args[0])
+			if err != nil {
+				return nil, err
+			}
+			s, offset, err := in.substring(self.(string), args[1:])
+			if err != nil {
+				return nil, err
+			}
+			var i int
+			if last {
+				i = strings.LastIndex(s, sub)
+			} else {
+				i = strings.Index(s, sub)
+			}
+			if i < 0 {
+				if raises {
+					return nil, in.errorf(valueError, "substring not found")
+				}
+				return newInt(-1), nil
+			}
+			return newInt(int64(offset + runeIndex(s, i))), nil
+		}
+	}
+	affix := func(name string, fn func(string, string) bool) method {
+		return func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity(name, args, kw, 1, 3); err != nil {
+				return nil, err
+			}
+			s, _, err := in.substring(self.(string), args[1:])
+			if err != nil {
+				return nil, err
+			}
+			candidates := []value{args[0]}
+			if t, ok := args[0].(tupleVal); ok {
+				candidates = t
+			}
+			for _, c := range candidates {
+				affix, ok := c.(string)
+				if !ok {
+					return nil, in.errorf(typeError, "%s first arg must be str or a tuple of str, not %s", name, typeName(c))
+				}
+				if fn(s, affix) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+	}
+	split := func(name string, right bool) method {
+		return func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			opts, err := in.keywords(name, kw, "sep", "maxsplit")
+			if err != nil {
+				return nil, err
+			}
+			if err := in.positional(name, args, 0, 2); err != nil {
+				return nil, err
+			}
+			sep, max := value(none), value(newInt(-1))
+			if len(args) > 0 {
+				sep = args[0]
+			}
+			if len(args) > 1 {
+				max = args[1]
+			}
+			if v, ok := opts["sep"]; ok {
+				sep = v
+			}
+			if v, ok := opts["maxsplit"]; ok {
+				max = v
+			}
+			n, err := in.toIndex(max)
+			if err != nil {
+				return nil, err
+			}
+			var parts []string
+			s := self.(string)
+			if sep == value(none) {
+				parts = splitSpace(s, int(n), right)
+			} else {
+				sepStr, err := in.stringArg(name, sep)
+				if err != nil {
+					return nil, err
+				}
+				if sepStr == "" {
+					return nil, in.errorf(valueError, "empty separator")
+				}
+				count := -1
+				if n >= 0 {
+					count = int(n) + 1
+				}
+				if right {
+					parts = rsplitN(s, sepStr, count)
+				} else {
+					parts = strings.SplitN(s, sepStr, count)
+				}
+			}
+			return in.stringList(parts)
+		}
+	}
+	justify := func(name string, align byte) method {
+		return func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity(name, args, kw, 1, 2); err != nil {
+				return nil, err
+			}
+			width, err := in.toIndex(args[0])
+			if err != nil {
+				return nil, err
+			}
+			fill := ' '
+			if len(args) == 2 {
+				f, err := in.stringArg(name, args[1])
+				if err != nil {
+					return nil, err
+				}
+				if utf8.RuneCountInString(f) != 1 {
+					return nil, in.errorf(typeError, "The fill character must be exactly one character long")
+				}
+				fill, _ = utf8.DecodeRuneInString(f)
+			}
+			if err := in.alloc(width); err != nil {
+				return nil, err
+			}
+			s := self.(string)
+			n := int(width) - utf8.RuneCountInString(s)
+			if n <= 0 {
+				return s, nil
+			}
+			pad := func(k int) string { return strings.Repeat(string(fill), k) }
+			switch align {
+			case '<':
+				return s + pad(n), nil
+			case '>':
+				return pad(n) + s, nil
+			}
+			// Python puts the extra character of odd padding on the left
+			// when the width is odd
+			left := n / 2
+			if n%2 == 1 && width%2 == 1 {
+				left++
+			}
+			return pad(left) + s + pad(n-left), nil
+		}
+	}
+
+	return map[string]method{
+		"upper":      mapper("upper", strings.ToUpper),
+		"lower":      mapper("lower", strings.ToLower),
+		"casefold":   mapper("casefold", strings.ToLower),
+		"swapcase":   mapper("swapcase", swapCase),
+		"title":      mapper("title", title),
+		"capitalize": mapper("capitalize", capitalize),
+		"strip":      strip("strip", strings.Trim, strings.TrimSpace),
+		"lstrip":     strip("lstrip", strings.TrimLeft, func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }),
+		"rstrip":     strip("rstrip", strings.TrimRight, func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }),
+		"isdigit":    predicate("isdigit", unicode.IsDigit, false),
+		"isdecimal":  predicate("isdecimal", unicode.IsDigit, false),
+		"isnumeric":  predicate("isnumeric", unicode.IsNumber, false),
+		"isalpha":    predicate("isalpha", unicode.IsLetter, false),
+		"isalnum":    predicate("isalnum", func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }, false),
+		"isspace":    predicate("isspace", unicode.IsSpace, false),
+		"isupper":    predicate("isupper", unicode.IsUpper, true),
+		"islower":    predicate("islower", unicode.IsLower, true),
+		"find":       find("find", false, false),
+		"rfind":      find("rfind", true, false),
+		"index":      find("index", false, true),
+		"rindex":     find("rindex", true, true),
+		"startswith": affix("startswith", strings.HasPrefix),
+		"endswith":   affix("endswith", strings.HasSuffix),
+		"split":      split("split", false),
+		"rsplit":     split("rsplit", true),
+		"ljust":      justify("ljust", '<'),
+		"rjust":      justify("rjust", '>'),
+		"center":     justify("center", '^'),
+		"join": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("join", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			var parts []string
+			size := 0
+			err := in.iterate(args[0], func(item value) (bool, error) {
+				s, ok := item.(string)
+				if !ok {
+					return true, in.errorf(typeError, "sequence item %d: expected str instance, %s found", len(parts), typeName(item))
+				}
+				parts = append(parts, s)
+				size += len(s) + len(self.(string))
+				return false, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := in.alloc(int64(size)); err != nil {
+				return nil, err
+			}
+			return strings.Join(parts, self.(string)), nil
+		},
+		"replace": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("replace", args, kw, 2, 3); err != nil {
+				return nil, err
+			}
+			old, err := in.stringArg("replace", args[0])
+			if err != nil {
+				return nil, err
+			}
+			repl, err := in.stringArg("replace", args[1])
+			if err != nil {
+				return nil, err
+			}
+			n := int64(-1)
+			if len(args) == 3 {
+				if n, err = in.toIndex(args[2]); err != nil {
+					return nil, err
+				}
+			}
+			s := self.(string)
+			count := strings.Count(s, old)
+			if n >= 0 && int64(count) > n {
+				count = int(n)
+			}
+			if err := in.alloc(int64(len(s) + count*len(repl))); err != nil {
+				return nil, err
+			}
+			return strings.Replace(s, old, repl, int(n)), nil
+		},
+		"count": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("count", args, kw, 1, 3); err != nil {
+				return nil, err
+			}
+			sub, err := in.stringArg("count", args[0])
+			if err != nil {
+				return nil, err
+			}
+			s, _, err := in.substring(self.(string), args[1:])
+			if err != nil {
+				return nil, err
+			}
+			return newInt(int64(strings.Count(s, sub))), nil
+		},
+		"format": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			return in.strFormat(self.(string), args, kw)
+		},
+		"zfill": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("zfill", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			width, err := in.toIndex(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if err := in.alloc(width); err != nil {
+				return nil, err
+			}
+			s := self.(string)
+			sign := ""
+			if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+				sign, s = s[:1], s[1:]
+			}
+			if n := int(width) - len(sign) - utf8.RuneCountInString(s); n > 0 {
+				s = strings.Repeat("0", n) + s
+			}
+			return sign + s, nil
+		},
+		"splitlines": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("splitlines", args, kw, 0, 1); err != nil {
+				return nil, err
+			}
+			keep := len(args) == 1 && truthy(args[0])
+			var lines []string
+			s := self.(string)
+			for s != "" {
+				i := strings.IndexAny(s, "\n\r")
+				if i < 0 {
+					lines = append(lines, s)
+					break
+				}
+				end := i + 1
+				if s[i] == '\r' && end < len(s) && s[end] == '\n' {
+					end++
+				}
+				if keep {
+					lines = append(lines, s[:end])
+				} else {
+					lines = append(lines, s[:i])
+				}
+				s = s[end:]
+			}
+			return in.stringList(lines)
+		},
+		"partition": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			return in.partition("partition", self.(string), args, kw, false)
+		},
+		"rpartition": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			return in.partition("rpartition", self.(string), args, kw, true)
+		},
+		"removeprefix": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("removeprefix", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			prefix, err := in.stringArg("removeprefix", args[0])
+			return strings.TrimPrefix(self.(string), prefix), err
+		},
+		"removesuffix": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("removesuffix", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			suffix, err := in.stringArg("removesuffix", args[0])
+			return strings.TrimSuffix(self.(string), suffix), err
+		},
+	}
+}
+
+func (in *interp) stringList(parts []string) (value, error) {
+	if err := in.allocItems(len(parts)); err != nil {
+		return nil, err
+	}
+	items := make([]value, len(parts))
+	for i, part := range parts {
+		items[i] = part
+	}
+	return &listVal{items}, nil
+}
+
+func (in *interp) partition(name, s string, args []value, kw []kwarg, last bool) (value, error) {
+	if err := in.arity(name, args, kw, 1, 1); err != nil {
+		return nil, err
+	}
+	sep, err := in.stringArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if sep == "" {
+		return nil, in.errorf(valueError, "empty separator")
+	}
+	i := strings.Index(s, sep)
+	if last {
+		i = strings.LastIndex(s, sep)
+	}
+	if i < 0 {
+		if last {
+			return tupleVal{"", "", s}, nil
+		}
+		return tupleVal{s, "", ""}, nil
+	}
+	return tupleVal{s[:i], sep, s[i+len(sep):]}, nil
+}
+
+// splitSpace splits s at runs of whitespace at most n times, from the
+// right when right is set
+func splitSpace(s string, n int, right bool) []string {
+	fields := strings.Fields(s)
+	if n < 0 || len(fields) <= n+1 {
+		return fields
+	}
+	if !right {
+		rest := s
+		var parts []string
+		for i := 0; i < n; i++ {
+			rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			parts = append(parts, rest[:end])
+			rest = rest[end:]
+		}
+		return append(parts, strings.TrimLeftFunc(rest, unicode.IsSpace))
+	}
+	rest := s
+	var parts []string
+	for i := 0; i < n; i++ {
+		rest = strings.TrimRightFunc(rest, unicode.IsSpace)
+		start := strings.LastIndexFunc(rest, unicode.IsSpace)
+		parts = append([]string{rest[start+1:]}, parts...)
+		rest = rest[:start+1]
+	}
+	return append([]string{strings.TrimRightFunc(rest, unicode.IsSpace)}, parts...)
+}
+
+// rsplitN splits s at sep into at most n parts from the right
+func rsplitN(s, sep string, n int) []string {
+	if n < 0 {
+		return strings.Split(s, sep)
+	}
+	var parts []string
+	for len(parts) < n-1 {
+		i := strings.LastIndex(s, sep)
+		if i < 0 {
+			break
+		}
+		parts = append([]string{s[i+len(sep):]}, parts...)
+		s = s[:i]
+	}
+	return append([]string{s}, parts...)
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// title capitalizes the first letter of every run of letters
+func title(s string) string {
+	var b strings.Builder
+	prev := false
+	for _, r := range s {
+		if prev {
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(unicode.ToTitle(r))
+		}
+		prev = unicode.IsLetter(r)
+	}
+	return b.String()
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return s
+	}
+	return string(unicode.ToTitle(r)) + strings.ToLower(s[size:])
+}
+
+// indexOf returns the index of the first item equal to v
+func (in *interp) indexOf(items []value, v value) (int, error) {
+	for i, item := range items {
+		if eq, err := in.equal(item, v); err != nil || eq {
+			return i, err
+		}
+	}
+	return -1, nil
+}
+
+// countOf counts the items equal to v
+func (in *interp) countOf(items []value, v value) (value, error) {
+	n := int64(0)
+	for _, item := range items {
+		eq, err := in.equal(item, v)
+		if err != nil {
+			return nil, err
+		}
+		if eq {
+			n++
+		}
+	}
+	return newInt(n), nil
+}
+
+func listMethods() map[string]method {
+	return map[string]method{
+		"append": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("append", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			if err := in.alloc(slotSize); err != nil {
+				return nil, err
+			}
+			l := self.(*listVal)
+			l.items = append(l.items, args[0])
+			return none, nil
+		},
+		"extend": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("extend", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			_, err := in.inplace("+", self, args[0])
+			return none, err
+		},
+		"insert": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("insert", args, kw, 2, 2); err != nil {
+				return nil, err
+			}
+			i, err := in.toIndex(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if err := in.alloc(slotSize); err != nil {
+				return nil, err
+			}
+			l := self.(*listVal)
+			n := int64(len(l.items))
+			if i < 0 {
+				i += n
+				if i < 0 {
+					i = 0
+				}
+			}
+			if i > n {
+				i = n
+			}
+			l.items = append(l.items, nil)
+			copy(l.items[i+1:], l.items[i:])
+			l.items[i] = args[1]
+			return none, nil
+		},
+		"pop": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("pop", args, kw, 0, 1); err != nil {
+				return nil, err
+			}
+			l := self.(*listVal)
+			if len(l.items) == 0 {
+				return nil, in.errorf(indexError, "pop from empty list")
+			}
+			i := len(l.items) - 1
+			if len(args) == 1 {
+				var err error
+				if i, err = in.index("list", args[0], len(l.items)); err != nil {
+					return nil, in.errorf(indexError, "pop index out of range")
+				}
+			}
+			v := l.items[i]
+			l.items = append(l.items[:i], l.items[i+1:]...)
+			return v, nil
+		},
+		"remove": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("remove", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			l := self.(*listVal)
+			i, err := in.indexOf(l.items, args[0])
+			if err != nil {
+				return nil, err
+			}
+			if i < 0 {
+				return nil, in.errorf(valueError, "list.remove(x): x not in list")
+			}
+			l.items = append(l.items[:i], l.items[i+1:]...)
+			return none, nil
+		},
+		"index": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			return in.seqIndex(self.(*listVal).items, "list", args, kw)
+		},
+		"count": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("count", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			return in.countOf(self.(*listVal).items, args[0])
+		},
+		"sort": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			opts, err := in.keywords("sort", kw, "key", "reverse")
+			if err != nil {
+				return nil, err
+			}
+			if len(args) > 0 {
+				return nil, in.errorf(typeError, "sort() takes no positional arguments")
+			}
+			return none, in.sortValues(self.(*listVal).items, opts["key"], truthy(orNone(opts["reverse"])))
+		},
+		"reverse": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("reverse", args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			items := self.(*listVal).items
+			for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+				items[i], items[j] = items[j], items[i]
+			}
+			return none, nil
+		},
+		"copy": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("copy", args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			items, err := in.toList(self)
+			return &listVal{items}, err
+		},
+		"clear": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("clear", args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			self.(*listVal).items = nil
+			return none, nil
+		},
+	}
+}
+
+func (in *interp) seqIndex(items []value, kind string, args []value, kw []kwarg) (value, error) {
+	if err := in.arity("index", args, kw, 1, 3); err != nil {
+		return nil, err
+	}
+	lo, hi := value(none), value(none)
+	if len(args) > 1 {
+		lo = args[1]
+	}
+	if len(args) > 2 {
+		hi = args[2]
+	}
+	start, stop, _, err := in.indices(&sliceVal{lo, hi, none}, len(items))
+	if err != nil {
+		return nil, err
+	}
+	for i := start; i < stop; i++ {
+		eq, err := in.equal(items[i], args[0])
+		if err != nil {
+			return nil, err
+		}
+		if eq {
+			return newInt(int64(i)), nil
+		}
+	}
+	if kind == "list" {
+		return nil, in.errorf(valueError, "%s is not in list", repr(args[0]))
+	}
+	return nil, in.errorf(valueError, "tuple.index(x): x not in tuple")
+}
+
+func tupleMethods() map[string]method {
+	return map[string]method{
+		"index": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			return in.seqIndex(self.(tupleVal), "tuple", args, kw)
+		},
+		"count": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("count", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			return in.countOf(self.(tupleVal), args[0])
+		},
+	}
+}
+
+func dictMethods() map[string]method {
+	view := func(kind string) method {
+		return func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity(kind, args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			return &viewVal{kind, self.(*dictVal)}, nil
+		}
+	}
+	return map[string]method{
+		"keys":   view("keys"),
+		"values": view("values"),
+		"items":  view("items"),
+		"get": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("get", args, kw, 1, 2); err != nil {
+				return nil, err
+			}
+			v, found, err := self.(*dictVal).get(in, args[0])
+			if err != nil || found {
+				return v, err
+			}
+			if len(args) == 2 {
+				return args[1], nil
+			}
+			return none, nil
+		},
+		"pop": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("pop", args, kw, 1, 2); err != nil {
+				return nil, err
+			}
+			v, found, err := self.(*dictVal).remove(in, args[0])
+			if err != nil || found {
+				return v, err
+			}
+			if len(args) == 2 {
+				return args[1], nil
+			}
+			return nil, raise(&excVal{typ: keyError, args: []value{args[0]}})
+		},
+		"popitem": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("popitem", args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			d := self.(*dictVal)
+			if len(d.keys) == 0 {
+				return nil, in.errorf(keyError, "popitem(): dictionary is empty")
+			}
+			key := d.keys[len(d.keys)-1]
+			v, _, err := d.remove(in, key)
+			return tupleVal{key, v}, err
+		},
+		"setdefault": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("setdefault", args, kw, 1, 2); err != nil {
+				return nil, err
+			}
+			d := self.(*dictVal)
+			v, found, err := d.get(in, args[0])
+			if err != nil || found {
+				return v, err
+			}
+			def := value(none)
+			if len(args) == 2 {
+				def = args[1]
+			}
+			return def, d.set(in, args[0], def)
+		},
+		"update": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.positional("update", args, 0, 1); err != nil {
+				return nil, err
+			}
+			d := self.(*dictVal)
+			if len(args) == 1 {
+				if err := in.update(d, args[0]); err != nil {
+					return nil, err
+				}
+			}
+			for _, k := range kw {
+				if err := d.set(in, k.name, k.val); err != nil {
+					return nil, err
+				}
+			}
+			return none, nil
+		},
+		"copy": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("copy", args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			d := newDict()
+			return d, in.update(d, self)
+		},
+		"clear": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("clear", args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			*self.(*dictVal) = *newDict()
+			return none, nil
+		},
+	}
+}
+
+func setMethods() map[string]method {
+	// combine builds a new set from the set and the iterables of args
+	combine := func(name, op string) method {
+		return func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity(name, args, kw, 0, -1); err != nil {
+				return nil, err
+			}
+			result := value(self)
+			for _, arg := range args {
+				other, err := setType(in, []value{arg}, nil)
+				if err != nil {
+					return nil, err
+				}
+				if result, err = in.setOp(op, result.(*setVal), other.(*setVal)); err != nil {
+					return nil, err
+				}
+			}
+			if result == self {
+				return setType(in, []value{self}, nil)
+			}
+			return result, nil
+		}
+	}
+	// compare tests the set against an iterable
+	compare := func(name string, test func(order int) bool) method {
+		return func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity(name, args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			other, err := setType(in, args, nil)
+			if err != nil {
+				return nil, err
+			}
+			order, err := in.compareSets(self.(*setVal), other.(*setVal))
+			if err != nil {
+				return nil, err
+			}
+			return test(order), nil
+		}
+	}
+	return map[string]method{
+		"add": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("add", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			return none, self.(*setVal).add(in, args[0])
+		},
+		"remove": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("remove", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			found, err := self.(*setVal).remove(in, args[0])
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, raise(&excVal{typ: keyError, args: []value{args[0]}})
+			}
+			return none, nil
+		},
+		"discard": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("discard", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			_, err := self.(*setVal).remove(in, args[0])
+			return none, err
+		},
+		"pop": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("pop", args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			s := self.(*setVal)
+			if len(s.items) == 0 {
+				return nil, in.errorf(keyError, "pop from an empty set")
+			}
+			v := s.items[0]
+			_, err := s.remove(in, v)
+			return v, err
+		},
+		"clear": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("clear", args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			*self.(*setVal) = *newSet()
+			return none, nil
+		},
+		"copy": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("copy", args, kw, 0, 0); err != nil {
+				return nil, err
+			}
+			return setType(in, []value{self}, nil)
+		},
+		"update": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("update", args, kw, 0, -1); err != nil {
+				return nil, err
+			}
+			s := self.(*setVal)
+			for _, arg := range args {
+				err := in.iterate(arg, func(item value) (bool, error) {
+					return false, s.add(in, item)
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+			return none, nil
+		},
+		"union":                combine("union", "|"),
+		"intersection":         combine("intersection", "&"),
+		"difference":           combine("difference", "-"),
+		"symmetric_difference": combine("symmetric_difference", "^"),
+		"issubset":             compare("issubset", func(order int) bool { return order <= 0 }),
+		"issuperset":           compare("issuperset", func(order int) bool { return order == 0 || order == 1 }),
+		"isdisjoint": func(in *interp, self value, args []value, kw []kwarg) (value, error) {
+			if err := in.arity("isdisjoint", args, kw, 1, 1); err != nil {
+				return nil, err
+			}
+			disjoint := true
+			err := in.iterate(args[0], func(item value) (bool, error) {
+				has, err := self.(*setVal).has(in, item)
+				disjoint = !has
+				return has, err
+			})
+			return disjoint, err
+		},
+	}
+}
@@ -0,0 +1,915 @@
+package restricted
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxIntBits bounds the ints that arithmetic creates, about 315,000
+// decimal digits, so that no single operation on them runs long and
+// 10**10**8 fails fast
+const maxIntBits = 1 << 20
+
+// linearCost is the steps charged for adding, comparing, or shifting ints:
+// one for every 1024 bits of their operands
+func linearCost(x, y *big.Int) int64 {
+	return int64(x.BitLen()>>10) + int64(y.BitLen()>>10)
+}
+
+// mulCost is the steps charged for multiplying or dividing ints, which
+// takes time that grows with the product of their lengths
+func mulCost(x, y *big.Int) int64 {
+	kx, ky := int64(x.BitLen()>>10), int64(y.BitLen()>>10)
+	return kx*ky/4 + kx + ky
+}
+
+// intPow raises x to the power y, modulo m unless m is nil. It squares and
+// multiplies one bit of y at a time, charging each multiplication, so that
+// large powers use up the step limit and stop when the program is
+// cancelled.
+func (in *interp) intPow(x, y, m *big.Int) (*big.Int, error) {
+	z := big.NewInt(1)
+	mul := func(a *big.Int) error {
+		if err := in.charge(1 + mulCost(z, a)); err != nil {
+			return err
+		}
+		z.Mul(z, a)
+		if m == nil {
+			return nil
+		}
+		if err := in.charge(mulCost(z, m)); err != nil {
+			return err
+		}
+		z.Mod(z, m)
+		return nil
+	}
+	for i := y.BitLen() - 1; i >= 0; i-- {
+		if err := mul(z); err != nil {
+			return nil, err
+		}
+		if y.Bit(i) == 0 {
+			continue
+		}
+		if err := mul(x); err != nil {
+			return nil, err
+		}
+	}
+	return z, nil
+}
+
+func (in *interp) unary(op string, v value) (value, error) {
+	if op == "not" {
+		return !truthy(v), nil
+	}
+	if n, ok := toInt(v); ok {
+		switch op {
+		case "-":
+			return new(big.Int).Neg(n), nil
+		case "+":
+			return n, nil
+		case "~":
+			return new(big.Int).Not(n), nil
+		}
+	}
+	if f, ok := v.(float64); ok {
+		switch op {
+		case "-":
+			return -f, nil
+		case "+":
+			return f, nil
+		}
+	}
+	return nil, in.errorf(typeError, "bad operand type for unary %s: '%s'", op, typeName(v))
+}
+
+// binary applies a binary operator
+func (in *interp) binary(op string, a, b value) (value, error) {
+	if x, ok := a.(bool); ok {
+		if y, ok := b.(bool); ok {
+			switch op {
+			case "&":
+				return x && y, nil
+			case "|":
+				return x || y, nil
+			case "^":
+				return x != y, nil
+			}
+		}
+	}
+	if x, ok := toInt(a); ok {
+		if y, ok := toInt(b); ok {
+			return in.intOp(op, x, y)
+		}
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return in.floatOp(op, x, y)
+		}
+	}
+
+	switch x := a.(type) {
+	case string:
+		switch op {
+		case "+":
+			y, ok := b.(string)
+			if !ok {
+				return nil, in.errorf(typeError, "can only concatenate str (not \"%s\") to str", typeName(b))
+			}
+			if err := in.alloc(int64(len(x) + len(y))); err != nil {
+				return nil, err
+			}
+			return x + y, nil
+		case "*":
+			if n, ok := toInt(b); ok {
+				return in.repeatString(x, n)
+			}
+		case "%":
+			return in.percentFormat(x, b)
+		}
+	case *listVal:
+		switch op {
+		case "+":
+			y, ok := b.(*listVal)
+			if !ok {
+				return nil, in.errorf(typeError, "can only concatenate list (not \"%s\") to list", typeName(b))
+			}
+			items, err := in.concat(x.items, y.items)
+			if err != nil {
+				return nil, err
+			}
+			return &listVal{items}, nil
+		case "*":
+			if n, ok := toInt(b); ok {
+				items, err := in.repeat(x.items, n)
+				if err != nil {
+					return nil, err
+				}
+				return &listVal{items}, nil
+			}
+		}
+	case tupleVal:
+		switch op {
+		case "+":
+			y, ok := b.(tupleVal)
+			if !ok {
+				return nil, in.errorf(typeError, "can only concatenate tuple (not \"%s\") to tuple", typeName(b))
+			}
+			return in.concat(x, y)
+		case "*":
+			if n, ok := toInt(b); ok {
+				items, err := in.repeat(x, n)
+				return tupleVal(items), err
+			}
+		}
+	case *setVal:
+		if y, ok := b.(*setVal); ok {
+			if result, err := in.setOp(op, x, y); result != nil || err != nil {
+				return result, err
+			}
+		}
+	case *dictVal:
+		if y, ok := b.(*dictVal); ok && op == "|" {
+			d := newDict()
+			for _, src := range []*dictVal{x, y} {
+				for i, key := range src.keys {
+					if err := d.set(in, key, src.vals[i]); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return d, nil
+		}
+	}
+	if op == "*" {
+		// n * sequence
+		if _, ok := toInt(a); ok {
+			switch b.(type) {
+			case string, *listVal, tupleVal:
+				return in.binary(op, b, a)
+			}
+		}
+	}
+	return nil, in.errorf(typeError, "unsupported operand type(s) for %s: '%s' and '%s'", opName(op), typeName(a), typeName(b))
+}
+
+// opName returns how Python names an operator in error messages
+func opName(op string) string {
+	if op == "**" {
+		return "** or pow()"
+	}
+	return op
+}
+
+func (in *interp) intOp(op string, x, y *big.Int) (value, error) {
+	z := new(big.Int)
+	switch op {
+	case "+", "-", "&", "|", "^", "<<", ">>":
+		if err := in.charge(linearCost(x, y)); err != nil {
+			return nil, err
+		}
+	case "*", "/", "//", "%":
+		if err := in.charge(mulCost(x, y)); err != nil {
+			return nil, err
+		}
+	}
+	switch op {
+	case "+":
+		z.Add(x, y)
+	case "-":
+		z.Sub(x, y)
+	case "*":
+		if x.BitLen()+y.BitLen() > maxIntBits+1 {
+			return nil, raise(&excVal{typ: memoryError})
+		}
+		if err := in.alloc(int64(x.BitLen()+y.BitLen()) / 8); err != nil {
+			return nil, err
+		}
+		z.Mul(x, y)
+	case "/":
+		if y.Sign() == 0 {
+			return nil, in.errorf(zeroDivisionError, "division by zero")
+		}
+		f, _ := new(big.Rat).SetFrac(x, y).Float64()
+		if math.IsInf(f, 0) {
+			return nil, in.errorf(overflowError, "integer division result too large for a float")
+		}
+		return f, nil
+	case "//", "%":
+		if y.Sign() == 0 {
+			return nil, in.errorf(zeroDivisionError, "integer division or modulo by zero")
+		}
+		q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+		if r.Sign() != 0 && r.Sign() != y.Sign() {
+			q.Sub(q, big.NewInt(1))
+			r.Add(r, y)
+		}
+		if op == "//" {
+			return q, nil
+		}
+		return r, nil
+	case "**":
+		if y.Sign() < 0 {
+			fx, _ := toFloat(x)
+			fy, _ := toFloat(y)
+			return in.floatOp(op, fx, fy)
+		}
+		if x.CmpAbs(big.NewInt(1)) <= 0 {
+			// 0, 1, and -1 stay small whatever the exponent
+			if x.Sign() < 0 && y.Bit(0) == 0 {
+				return big.NewInt(1), nil
+			}
+			if x.Sign() == 0 && y.Sign() == 0 {
+				return big.NewInt(1), nil
+			}
+			return x, nil
+		}
+		if y.Cmp(big.NewInt(maxIntBits)) > 0 || y.Int64()*int64(x.BitLen()) > maxIntBits {
+			return nil, raise(&excVal{typ: memoryError})
+		}
+		if err := in.alloc(y.Int64() * int64(x.BitLen()) / 8); err != nil {
+			return nil, err
+		}
+		return in.intPow(x, y, nil)
+	case "<<":
+		if y.Sign() < 0 {
+			return nil, in.errorf(valueError, "negative shift count")
+		}
+		if x.Sign() == 0 {
+			return x, nil
+		}
+		if y.Cmp(big.NewInt(maxIntBits)) > 0 || y.Int64()+int64(x.BitLen()) > maxIntBits {
+			return nil, raise(&excVal{typ: memoryError})
+		}
+		if err := in.alloc((y.Int64() + int64(x.BitLen())) / 8); err != nil {
+			return nil, err
+		}
+		z.Lsh(x, uint(y.Int64()))
+	case ">>":
+		if y.Sign() < 0 {
+			return nil, in.errorf(valueError, "negative shift count")
+		}
+		if !y.IsInt64() || y.Int64() > int64(x.BitLen()) {
+			if x.Sign() < 0 {
+				return big.NewInt(-1), nil
+			}
+			return big.NewInt(0), nil
+		}
+		z.Rsh(x, uint(y.Int64()))
+	case "&":
+		z.And(x, y)
+	case "|":
+		z.Or(x, y)
+	case "^":
+		z.Xor(x, y)
+	default:
+		return nil, in.errorf(typeError, "unsupported operand type(s) for %s: 'int' and 'int'", op)
+	}
+	if z.BitLen() > maxIntBits {
+		return nil, raise(&excVal{typ: memoryError})
+	}
+	return z, nil
+}
+
+func (in *interp) floatOp(op string, x, y float64) (value, error) {
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, in.errorf(zeroDivisionError, "float division by zero")
+		}
+		return x / y, nil
+	case "//", "%":
+		if y == 0 {
+			if op == "//" {
+				return nil, in.errorf(zeroDivisionError, "float floor division by zero")
+			}
+			return nil, in.errorf(zeroDivisionError, "float modulo by zero")
+		}
+		r := math.Mod(x, y)
+		if r != 0 && (r < 0) != (y < 0) {
+			r += y
+		}
+		if op == "%" {
+			return r, nil
+		}
+		return math.Floor((x - r) / y), nil
+	case "**":
+		if x == 0 && y < 0 {
+			return nil, in.errorf(zeroDivisionError, "0.0 cannot be raised to a negative power")
+		}
+		if x < 0 && y != math.Trunc(y) {
+			return nil, in.errorf(valueError, "negative number cannot be raised to a fractional power")
+		}
+		z := math.Pow(x, y)
+		if math.IsInf(z, 0) && !math.IsInf(x, 0) && !math.IsInf(y, 0) {
+			return nil, in.errorf(overflowError, "(34, 'Numerical result out of range')")
+		}
+		return z, nil
+	}
+	return nil, in.errorf(typeError, "unsupported operand type(s) for %s: 'float' and 'float'", op)
+}
+
+func (in *interp) setOp(op string, x, y *setVal) (value, error) {
+	result := newSet()
+	add := func(items []value, keep func(value) (bool, error)) error {
+		for _, item := range items {
+			ok, err := keep(item)
+			if err != nil {
+				return err
+			}
+			if ok {
+				if err := result.add(in, item); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	all := func(value) (bool, error) { return true, nil }
+	inY := func(v value) (bool, error) { return y.has(in, v) }
+	notInY := func(v value) (bool, error) {
+		has, err := y.has(in, v)
+		return !has, err
+	}
+	notInX := func(v value) (bool, error) {
+		has, err := x.has(in, v)
+		return !has, err
+	}
+	var err error
+	switch op {
+	case "|":
+		if err = add(x.items, all); err == nil {
+			err = add(y.items, all)
+		}
+	case "&":
+		err = add(x.items, inY)
+	case "-":
+		err = add(x.items, notInY)
+	case "^":
+		if err = add(x.items, notInY); err == nil {
+			err = add(y.items, notInX)
+		}
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (in *interp) concat(a, b []value) ([]value, error) {
+	if err := in.allocItems(len(a) + len(b)); err != nil {
+		return nil, err
+	}
+	items := make([]value, 0, len(a)+len(b))
+	return append(append(items, a...), b...), nil
+}
+
+// count converts the count of a repetition, treating negative counts as 0
+func (in *interp) count(n *big.Int, size int) (int, error) {
+	if n.Sign() <= 0 || size == 0 {
+		return 0, nil
+	}
+	if !n.IsInt64() || n.Int64() > math.MaxInt32 {
+		return 0, raise(&excVal{typ: memoryError})
+	}
+	return int(n.Int64()), nil
+}
+
+func (in *interp) repeat(items []value, n *big.Int) ([]value, error) {
+	count, err := in.count(n, len(items))
+	if err != nil {
+		return nil, err
+	}
+	if err := in.allocItems(len(items) * count); err != nil {
+		return nil, err
+	}
+	result := make([]value, 0, len(items)*count)
+	for i := 0; i < count; i++ {
+		result = append(result, items...)
+	}
+	return result, nil
+}
+
+func (in *interp) repeatString(s string, n *big.Int) (value, error) {
+	count, err := in.count(n, len(s))
+	if err != nil {
+		return nil, err
+	}
+	if err := in.alloc(int64(len(s)) * int64(count)); err != nil {
+		return nil, err
+	}
+	return strings.Repeat(s, count), nil
+}
+
+// Iteration
+
+// iterate calls fn with each item of an iterable until fn returns true or
+// an error. Every item counts as a step.
+func (in *interp) iterate(v value, fn func(value) (bool, error)) error {
+	each := func(items []value) error {
+		for _, item := range items {
+			if err := in.step(); err != nil {
+				return err
+			}
+			if stop, err := fn(item); stop || err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	switch v := v.(type) {
+	case string:
+		for _, r := range v {
+			if err := in.step(); err != nil {
+				return err
+			}
+			if stop, err := fn(string(r)); stop || err != nil {
+				return err
+			}
+		}
+		return nil
+	case *listVal:
+		// Lists are iterated by index, so that items appended during the
+		// loop are visited as in Python
+		for i := 0; i < len(v.items); i++ {
+			if err := in.step(); err != nil {
+				return err
+			}
+			if stop, err := fn(v.items[i]); stop || err != nil {
+				return err
+			}
+		}
+		return nil
+	case tupleVal:
+		return each(v)
+	case *dictVal:
+		n := len(v.keys)
+		for i := 0; i < len(v.keys); i++ {
+			if err := in.step(); err != nil {
+				return err
+			}
+			if stop, err := fn(v.keys[i]); stop || err != nil {
+				return err
+			}
+			if len(v.keys) != n {
+				return in.errorf(runtimeError, "dictionary changed size during iteration")
+			}
+		}
+		return nil
+	case *setVal:
+		n := len(v.items)
+		for i := 0; i < len(v.items); i++ {
+			if err := in.step(); err != nil {
+				return err
+			}
+			if stop, err := fn(v.items[i]); stop || err != nil {
+				return err
+			}
+			if len(v.items) != n {
+				return in.errorf(runtimeError, "Set changed size during iteration")
+			}
+		}
+		return nil
+	case *viewVal:
+		return each(v.items())
+	case rangeVal:
+		n := v.length()
+		for i := int64(0); i < n; i++ {
+			if err := in.step(); err != nil {
+				return err
+			}
+			if stop, err := fn(newInt(v.start + i*v.step)); stop || err != nil {
+				return err
+			}
+		}
+		return nil
+	case *iterVal:
+		for {
+			if err := in.step(); err != nil {
+				return err
+			}
+			item, ok, err := v.next()
+			if err != nil || !ok {
+				return err
+			}
+			if stop, err := fn(item); stop || err != nil {
+				return err
+			}
+		}
+	}
+	return in.errorf(typeError, "'%s' object is not iterable", typeName(v))
+}
+
+// toList returns the items of an iterable in a new slice
+func (in *interp) toList(v value) ([]value, error) {
+	switch v := v.(type) {
+	case *listVal:
+		return in.concat(v.items, nil)
+	case tupleVal:
+		return in.concat(v, nil)
+	}
+	var items []value
+	err := in.iterate(v, func(item value) (bool, error) {
+		if err := in.alloc(slotSize); err != nil {
+			return true, err
+		}
+		items = append(items, item)
+		return false, nil
+	})
+	return items, err
+}
+
+// contains reports whether item is in container
+func (in *interp) contains(container, item value) (bool, error) {
+	switch c := container.(type) {
+	case string:
+		s, ok := item.(string)
+		if !ok {
+			return false, in.errorf(typeError, "'in <string>' requires string as left operand, not %s", typeName(item))
+		}
+		return strings.Contains(c, s), nil
+	case *listVal:
+		return in.containsItem(c.items, item)
+	case tupleVal:
+		return in.containsItem(c, item)
+	case *dictVal:
+		_, found, err := c.get(in, item)
+		return found, err
+	case *setVal:
+		return c.has(in, item)
+	case *viewVal:
+		if c.kind == "keys" {
+			_, found, err := c.d.get(in, item)
+			return found, err
+		}
+		return in.containsItem(c.items(), item)
+	case rangeVal:
+		n, ok := toInt(item)
+		if !ok {
+			if f, isFloat := item.(float64); !isFloat || f != math.Trunc(f) {
+				return false, nil
+			}
+			n, _ = big.NewFloat(item.(float64)).Int(nil)
+		}
+		if !n.IsInt64() {
+			return false, nil
+		}
+		i := n.Int64()
+		if c.step > 0 && (i < c.start || i >= c.stop) || c.step < 0 && (i > c.start || i <= c.stop) {
+			return false, nil
+		}
+		return (i-c.start)%c.step == 0, nil
+	case *iterVal:
+		found := false
+		err := in.iterate(c, func(v value) (bool, error) {
+			eq, err := in.equal(v, item)
+			found = eq
+			return eq, err
+		})
+		return found, err
+	}
+	return false, in.errorf(typeError, "argument of type '%s' is not iterable", typeName(container))
+}
+
+func (in *interp) containsItem(items []value, item value) (bool, error) {
+	for _, v := range items {
+		if eq, err := in.equal(v, item); err != nil || eq {
+			return eq, err
+		}
+	}
+	return false, nil
+}
+
+// Subscripts
+
+// index converts a subscript to an index into a sequence of length n
+func (in *interp) index(kind string, index value, n int) (int, error) {
+	if _, ok := toInt(index); !ok {
+		return 0, in.errorf(typeError, "%s indices must be integers or slices, not %s", kind, typeName(index))
+	}
+	i, err := in.toIndex(index)
+	if err != nil {
+		return 0, in.errorf(indexError, "cannot fit 'int' into an index-sized integer")
+	}
+	if i < 0 {
+		i += int64(n)
+	}
+	if i < 0 || i >= int64(n) {
+		return 0, in.errorf(indexError, "%s index out of range", kind)
+	}
+	return int(i), nil
+}
+
+// indices returns the start, stop, and step of a slice of a sequence of
+// length n
+func (in *interp) indices(s *sliceVal, n int) (int, int, int, error) {
+	bound := func(v value) (int64, bool, error) {
+		if v == value(none) {
+			return 0, false, nil
+		}
+		i, ok := toInt(v)
+		if !ok {
+			return 0, false, in.errorf(typeError, "slice indices must be integers or None")
+		}
+		if !i.IsInt64() {
+			if i.Sign() < 0 {
+				return math.MinInt32, true, nil
+			}
+			return math.MaxInt32, true, nil
+		}
+		return i.Int64(), true, nil
+	}
+	step := int64(1)
+	if st, ok, err := bound(s.step); err != nil {
+		return 0, 0, 0, err
+	} else if ok {
+		if st == 0 {
+			return 0, 0, 0, in.errorf(valueError, "slice step cannot be zero")
+		}
+		step = st
+	}
+	length := int64(n)
+	clamp := func(v value, def int64) (int64, error) {
+		i, ok, err := bound(v)
+		if err != nil || !ok {
+			return def, err
+		}
+		if i < 0 {
+			i += length
+			if i < 0 {
+				if step < 0 {
+					return -1, nil
+				}
+				return 0, nil
+			}
+		} else if i >= length {
+			if step < 0 {
+				return length - 1, nil
+			}
+			return length, nil
+		}
+		return i, nil
+	}
+	lo, hi := int64(0), length
+	if step < 0 {
+		lo, hi = length-1, -1
+	}
+	lo, err := clamp(s.lo, lo)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	hi, err = clamp(s.hi, hi)
+	return int(lo), int(hi), int(step), err
+}
+
+// sliceItems returns the items of a slice
+func (in *interp) sliceItems(items []value, s *sliceVal) ([]value, error) {
+	lo, hi, step, err := in.indices(s, len(items))
+	if err != nil {
+		return nil, err
+	}
+	var result []value
+	for i := lo; (step > 0 && i < hi) || (step < 0 && i > hi); i += step {
+		result = append(result, items[i])
+	}
+	return result, in.allocItems(len(result))
+}
+
+func (in *interp) getItem(obj, index value) (value, error) {
+	switch o := obj.(type) {
+	case string:
+		if s, ok := index.(*sliceVal); ok {
+			runes := []rune(o)
+			lo, hi, step, err := in.indices(s, len(runes))
+			if err != nil {
+				return nil, err
+			}
+			if step == 1 {
+				if hi < lo {
+					return "", nil
+				}
+				return string(runes[lo:hi]), nil
+			}
+			var b strings.Builder
+			for i := lo; (step > 0 && i < hi) || (step < 0 && i > hi); i += step {
+				b.WriteRune(runes[i])
+			}
+			return b.String(), nil
+		}
+		if isASCII(o) {
+			i, err := in.index("string", index, len(o))
+			if err != nil {
+				return nil, err
+			}
+			return o[i : i+1], nil
+		}
+		runes := []rune(o)
+		i, err := in.index("string", index, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		return string(runes[i]), nil
+	case *listVal:
+		if s, ok := index.(*sliceVal); ok {
+			items, err := in.sliceItems(o.items, s)
+			return &listVal{items}, err
+		}
+		i, err := in.index("list", index, len(o.items))
+		if err != nil {
+			return nil, err
+		}
+		return o.items[i], nil
+	case tupleVal:
+		if s, ok := index.(*sliceVal); ok {
+			items, err := in.sliceItems(o, s)
+			return tupleVal(items), err
+		}
+		i, err := in.index("tuple", index, len(o))
+		if err != nil {
+			return nil, err
+		}
+		return o[i], nil
+	case rangeVal:
+		n := o.length()
+		if s, ok := index.(*sliceVal); ok {
+			if n > math.MaxInt32 {
+				return nil, raise(&excVal{typ: memoryError})
+			}
+			lo, hi, step, err := in.indices(s, int(n))
+			if err != nil {
+				return nil, err
+			}
+			return rangeVal{o.start + int64(lo)*o.step, o.start + int64(hi)*o.step, o.step * int64(step)}, nil
+		}
+		if n > math.MaxInt32 {
+			n = math.MaxInt32
+		}
+		i, err := in.index("range object", index, int(n))
+		if err != nil {
+			return nil, err
+		}
+		return newInt(o.start + int64(i)*o.step), nil
+	case *dictVal:
+		v, found, err := o.get(in, index)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, raise(&excVal{typ: keyError, args: []value{index}})
+		}
+		return v, nil
+	}
+	return nil, in.errorf(typeError, "'%s' object is not subscriptable", typeName(obj))
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func (in *interp) setItem(obj, index, v value) error {
+	switch o := obj.(type) {
+	case *listVal:
+		if s, ok := index.(*sliceVal); ok {
+			return in.setSlice(o, s, v)
+		}
+		i, err := in.index("list", index, len(o.items))
+		if err != nil {
+			if pe, ok := err.(*pyError); ok && pe.exc.typ == indexError {
+				return in.errorf(indexError, "list assignment index out of range")
+			}
+			return err
+		}
+		o.items[i] = v
+		return nil
+	case *dictVal:
+		return o.set(in, index, v)
+	}
+	return in.errorf(typeError, "'%s' object does not support item assignment", typeName(obj))
+}
+
+func (in *interp) setSlice(l *listVal, s *sliceVal, v value) error {
+	items, err := in.toList(v)
+	if err != nil {
+		return in.errorf(typeError, "must assign iterable to extended slice")
+	}
+	lo, hi, step, err := in.indices(s, len(l.items))
+	if err != nil {
+		return err
+	}
+	if step == 1 {
+		if hi < lo {
+			hi = lo
+		}
+		rest := append(items, l.items[hi:]...)
+		l.items = append(l.items[:lo], rest...)
+		return nil
+	}
+	var targets []int
+	for i := lo; (step > 0 && i < hi) || (step < 0 && i > hi); i += step {
+		targets = append(targets, i)
+	}
+	if len(targets) != len(items) {
+		return in.errorf(valueError, "attempt to assign sequence of size %d to extended slice of size %d", len(items), len(targets))
+	}
+	for j, i := range targets {
+		l.items[i] = items[j]
+	}
+	return nil
+}
+
+func (in *interp) delItem(obj, index value) error {
+	switch o := obj.(type) {
+	case *listVal:
+		if s, ok := index.(*sliceVal); ok {
+			lo, hi, step, err := in.indices(s, len(o.items))
+			if err != nil {
+				return err
+			}
+			drop := map[int]bool{}
+			for i := lo; (step > 0 && i < hi) || (step < 0 && i > hi); i += step {
+				drop[i] = true
+			}
+			kept := o.items[:0]
+			for i, item := range o.items {
+				if !drop[i] {
+					kept = append(kept, item)
+				}
+			}
+			o.items = kept
+			return nil
+		}
+		i, err := in.index("list", index, len(o.items))
+		if err != nil {
+			if pe, ok := err.(*pyError); ok && pe.exc.typ == indexError {
+				return in.errorf(indexError, "list assignment index out of range")
+			}
+			return err
+		}
+		o.items = append(o.items[:i], o.items[i+1:]...)
+		return nil
+	case *dictVal:
+		_, found, err := o.remove(in, index)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return raise(&excVal{typ: keyError, args: []value{index}})
+		}
+		return nil
+	}
+	return in.errorf(typeError, "'%s' object does not support item deletion", typeName(obj))
+}
@@ -0,0 +1,1410 @@
+package restricted
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// keywords cannot be used as names
+var keywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true,
+	"async": true, "await": true, "break": true, "class": true, "continue": true,
+	"def": true, "del": true, "elif": true, "else": true, "except": true,
+	"finally": true, "for": true, "from": true, "global": true, "if": true,
+	"import": true, "in": true, "is": true, "lambda": true, "nonlocal": true,
+	"not": true, "or": true, "pass": true, "raise": true, "return": true,
+	"try": true, "while": true, "with": true, "yield": true,
+}
+
+// unsupported are the statements restricted programs cannot use
+var unsupported = map[string]string{
+	"class": "class definitions",
+	"with":  "with statements",
+	"yield": "generators",
+	"async": "coroutines",
+	"await": "coroutines",
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// parse parses a program
+func parse(src string) ([]stmt, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	var body []stmt
+	for p.tok().kind != tokEOF {
+		if p.tok().kind == tokNewline {
+			p.pos++
+			continue
+		}
+		stmts, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, stmts...)
+	}
+	return body, nil
+}
+
+func (p *parser) tok() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the current token is the operator or keyword s
+func (p *parser) is(s string) bool {
+	t := p.tok()
+	return (t.kind == tokOp || t.kind == tokName) && t.text == s
+}
+
+// accept consumes the operator or keyword s if it is next
+func (p *parser) accept(s string) bool {
+	if p.is(s) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf("expected '%s'", s)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return syntaxErrorf(p.tok().line, format, args...)
+}
+
+func (p *parser) name() (string, error) {
+	t := p.tok()
+	if t.kind != tokName || keywords[t.text] {
+		return "", p.errorf("invalid syntax")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+// statement parses a statement, or the simple statements of a line
+func (p *parser) statement() ([]stmt, error) {
+	t := p.tok()
+	if t.kind == tokIndent {
+		return nil, &SyntaxError{Kind: "IndentationError", Line: t.line, Msg: "unexpected indent"}
+	}
+	if t.kind == tokName {
+		if what, ok := unsupported[t.text]; ok {
+			return nil, syntaxErrorf(t.line, "%s are not supported in restricted mode", what)
+		}
+		var s stmt
+		var err error
+		switch t.text {
+		case "if":
+			s, err = p.ifStatement()
+		case "while":
+			s, err = p.whileStatement()
+		case "for":
+			s, err = p.forStatement()
+		case "def":
+			s, err = p.defStatement()
+		case "try":
+			s, err = p.tryStatement()
+		default:
+			return p.simpleStatements()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []stmt{s}, nil
+	}
+	return p.simpleStatements()
+}
+
+func (p *parser) simpleStatements() ([]stmt, error) {
+	var stmts []stmt
+	for {
+		s, err := p.simpleStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s)
+		if !p.accept(";") {
+			break
+		}
+		if p.tok().kind == tokNewline {
+			break
+		}
+	}
+	if p.tok().kind != tokNewline && p.tok().kind != tokEOF {
+		return nil, p.errorf("invalid syntax")
+	}
+	p.next()
+	return stmts, nil
+}
+
+func (p *parser) simpleStatement() (stmt, error) {
+	t := p.tok()
+	at := pos{t.line}
+	if t.kind == tokName {
+		switch t.text {
+		case "pass":
+			p.pos++
+			return &passStmt{at}, nil
+		case "break":
+			p.pos++
+			return &breakStmt{at}, nil
+		case "continue":
+			p.pos++
+			return &continueStmt{at}, nil
+		case "return":
+			p.pos++
+			if p.endOfStatement() {
+				return &returnStmt{pos: at}, nil
+			}
+			x, err := p.testList(true)
+			if err != nil {
+				return nil, err
+			}
+			return &returnStmt{at, x}, nil
+		case "global", "nonlocal":
+			p.pos++
+			var names []string
+			for {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				names = append(names, name)
+				if !p.accept(",") {
+					break
+				}
+			}
+			if t.text == "global" {
+				return &globalStmt{at, names}, nil
+			}
+			return &nonlocalStmt{at, names}, nil
+		case "del":
+			p.pos++
+			x, err := p.targetList()
+			if err != nil {
+				return nil, err
+			}
+			targets := []expr{x}
+			if tuple, ok := x.(*tupleExpr); ok {
+				targets = tuple.elts
+			}
+			return &delStmt{at, targets}, nil
+		case "assert":
+			p.pos++
+			cond, err := p.test()
+			if err != nil {
+				return nil, err
+			}
+			var msg expr
+			if p.accept(",") {
+				if msg, err = p.test(); err != nil {
+					return nil, err
+				}
+			}
+			return &assertStmt{at, cond, msg}, nil
+		case "raise":
+			p.pos++
+			if p.endOfStatement() {
+				return &raiseStmt{pos: at}, nil
+			}
+			x, err := p.test()
+			if err != nil {
+				return nil, err
+			}
+			if p.accept("from") {
+				if _, err := p.test(); err != nil {
+					return nil, err
+				}
+			}
+			return &raiseStmt{at, x}, nil
+		case "import", "from":
+			return p.importStatement()
+		}
+	}
+
+	x, err := p.testList(true)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.is("="):
+		targets := []expr{x}
+		for p.accept("=") {
+			v, err := p.testList(true)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, v)
+		}
+		value := targets[len(targets)-1]
+		targets = targets[:len(targets)-1]
+		for _, target := range targets {
+			if err := checkTarget(target, t.line); err != nil {
+				return nil, err
+			}
+		}
+		return &assignStmt{at, targets, value}, nil
+	case p.tok().kind == tokOp && len(p.tok().text) >= 2 && strings.HasSuffix(p.tok().text, "=") && !p.is("==") && !p.is("!=") && !p.is("<=") && !p.is(">=") && !p.is(":="):
+		op := strings.TrimSuffix(p.next().text, "=")
+		switch x.(type) {
+		case *nameExpr, *indexExpr:
+		default:
+			return nil, syntaxErrorf(t.line, "'%s' is an illegal expression for augmented assignment", describe(x))
+		}
+		value, err := p.testList(true)
+		if err != nil {
+			return nil, err
+		}
+		return &augAssignStmt{at, x, op, value}, nil
+	case p.is(":"):
+		// An annotated assignment; the annotation is not evaluated
+		p.pos++
+		if _, err := p.test(); err != nil {
+			return nil, err
+		}
+		if err := checkTarget(x, t.line); err != nil {
+			return nil, err
+		}
+		if !p.accept("=") {
+			return &passStmt{at}, nil
+		}
+		value, err := p.testList(true)
+		if err != nil {
+			return nil, err
+		}
+		return &assignStmt{at, []expr{x}, value}, nil
+	}
+	return &exprStmt{at, x}, nil
+}
+
+func (p *parser) endOfStatement() bool {
+	k := p.tok().kind
+	return k == tokNewline || k == tokEOF || p.is(";")
+}
+
+// importStatement parses an import, which fails when it runs
+func (p *parser) importStatement() (stmt, error) {
+	t := p.next()
+	var module []string
+	for !p.endOfStatement() {
+		module = append(module, p.next().text)
+	}
+	name := strings.Join(module, " ")
+	if t.text == "from" {
+		name, _, _ = strings.Cut(name, " import")
+	} else {
+		name, _, _ = strings.Cut(name, " as")
+		name, _, _ = strings.Cut(name, " ,")
+	}
+	return &importStmt{pos{t.line}, strings.ReplaceAll(name, " ", "")}, nil
+}
+
+// checkTarget checks that an expression can be assigned to
+func checkTarget(x expr, line int) error {
+	switch x := x.(type) {
+	case *nameExpr, *indexExpr:
+		return nil
+	case *tupleExpr:
+		for _, elt := range x.elts {
+			if err := checkTarget(elt, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *listExpr:
+		for _, elt := range x.elts {
+			if err := checkTarget(elt, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *starredExpr:
+		return checkTarget(x.x, line)
+	case *attrExpr:
+		return syntaxErrorf(line, "attributes cannot be assigned in restricted mode")
+	}
+	return syntaxErrorf(line, "cannot assign to %s", describe(x))
+}
+
+// describe names the kind of an expression for error messages
+func describe(x expr) string {
+	switch x := x.(type) {
+	case *constExpr:
+		return "literal"
+	case *callExpr:
+		return "function call"
+	case *binExpr, *unaryExpr:
+		return "expression"
+	case *compareExpr:
+		return "comparison"
+	case *tupleExpr:
+		return "tuple"
+	case *lambdaExpr:
+		return "lambda"
+	case *nameExpr:
+		return x.name
+	}
+	return "expression"
+}
+
+// block parses the body of a compound statement after its colon
+func (p *parser) block() ([]stmt, error) {
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	if p.tok().kind != tokNewline {
+		return p.simpleStatements()
+	}
+	p.pos++
+	if p.tok().kind != tokIndent {
+		return nil, &SyntaxError{Kind: "IndentationError", Line: p.tok().line, Msg: "expected an indented block"}
+	}
+	p.pos++
+	var body []stmt
+	for p.tok().kind != tokDedent && p.tok().kind != tokEOF {
+		if p.tok().kind == tokNewline {
+			p.pos++
+			continue
+		}
+		stmts, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, stmts...)
+	}
+	if p.tok().kind == tokDedent {
+		p.pos++
+	}
+	return body, nil
+}
+
+func (p *parser) ifStatement() (stmt, error) {
+	at := pos{p.next().line}
+	cond, err := p.namedTest()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	s := &ifStmt{pos: at, cond: cond, body: body}
+	switch {
+	case p.is("elif"):
+		elif, err := p.ifStatement()
+		if err != nil {
+			return nil, err
+		}
+		s.orelse = []stmt{elif}
+	case p.accept("else"):
+		if s.orelse, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) whileStatement() (stmt, error) {
+	at := pos{p.next().line}
+	cond, err := p.namedTest()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	s := &whileStmt{pos: at, cond: cond, body: body}
+	if p.accept("else") {
+		if s.orelse, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) forStatement() (stmt, error) {
+	at := pos{p.next().line}
+	target, err := p.targetList()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTarget(target, at.line); err != nil {
+		return nil, err
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	iter, err := p.testList(true)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	s := &forStmt{pos: at, target: target, iter: iter, body: body}
+	if p.accept("else") {
+		if s.orelse, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) defStatement() (stmt, error) {
+	at := pos{p.next().line}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	params, err := p.params(")")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if p.accept("->") {
+		if _, err := p.test(); err != nil {
+			return nil, err
+		}
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return &defStmt{at, name, params, body}, nil
+}
+
+// params parses the parameters of a def or lambda up to end
+func (p *parser) params(end string) ([]param, error) {
+	var params []param
+	seen := map[string]bool{}
+	defaults, kwonly := false, false
+	for !p.is(end) {
+		var prm param
+		switch {
+		case p.accept("**"):
+			prm.star = 2
+		case p.accept("*"):
+			prm.star = 1
+		case p.accept("/"):
+			// Positional-only parameters are ordinary parameters here
+			if !p.accept(",") {
+				break
+			}
+			continue
+		}
+		if prm.star == 1 && (p.is(",") || p.is(end)) {
+			// A bare * ends the positional parameters
+			if !p.accept(",") || p.is(end) {
+				return nil, p.errorf("named arguments must follow bare *")
+			}
+			params = append(params, prm)
+			kwonly = true
+			continue
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			return nil, p.errorf("duplicate argument '%s' in function definition", name)
+		}
+		seen[name] = true
+		prm.name = name
+		if end == ")" && p.accept(":") {
+			if _, err := p.test(); err != nil {
+				return nil, err
+			}
+		}
+		if prm.star == 0 && p.accept("=") {
+			if prm.def, err = p.test(); err != nil {
+				return nil, err
+			}
+			defaults = true
+		} else if prm.star == 0 && defaults && !kwonly {
+			return nil, p.errorf("non-default argument follows default argument")
+		}
+		params = append(params, prm)
+		kwonly = kwonly || prm.star != 0
+		if !p.accept(",") {
+			break
+		}
+	}
+	return params, nil
+}
+
+func (p *parser) tryStatement() (stmt, error) {
+	at := pos{p.next().line}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	s := &tryStmt{pos: at, body: body}
+	for p.is("except") {
+		h := handler{line: p.next().line}
+		if !p.is(":") {
+			if h.typ, err = p.test(); err != nil {
+				return nil, err
+			}
+			if p.accept("as") {
+				if h.name, err = p.name(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if h.body, err = p.block(); err != nil {
+			return nil, err
+		}
+		s.handlers = append(s.handlers, h)
+	}
+	if len(s.handlers) > 0 && p.accept("else") {
+		if s.orelse, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("finally") {
+		if s.finally, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.handlers) == 0 && s.finally == nil {
+		return nil, p.errorf("expected 'except' or 'finally' block")
+	}
+	return s, nil
+}
+
+// targetList parses the targets of a for loop or del, which end before in
+func (p *parser) targetList() (expr, error) {
+	var elts []expr
+	trailing := false
+	for {
+		var x expr
+		var err error
+		if p.accept("*") {
+			var inner expr
+			if inner, err = p.bitOr(); err != nil {
+				return nil, err
+			}
+			x = &starredExpr{inner}
+		} else if x, err = p.bitOr(); err != nil {
+			return nil, err
+		}
+		elts = append(elts, x)
+		trailing = false
+		if !p.accept(",") {
+			break
+		}
+		trailing = true
+		if p.is("in") || p.is("=") || p.endOfStatement() {
+			break
+		}
+	}
+	if len(elts) == 1 && !trailing {
+		return elts[0], nil
+	}
+	return &tupleExpr{elts}, nil
+}
+
+// testList parses comma-separated expressions, a tuple when there is a
+// comma. Starred items are allowed when star is set.
+func (p *parser) testList(star bool) (expr, error) {
+	var elts []expr
+	trailing := false
+	for {
+		var x expr
+		var err error
+		if star && p.accept("*") {
+			var inner expr
+			if inner, err = p.bitOr(); err != nil {
+				return nil, err
+			}
+			x = &starredExpr{inner}
+		} else if x, err = p.test(); err != nil {
+			return nil, err
+		}
+		elts = append(elts, x)
+		trailing = false
+		if !p.accept(",") {
+			break
+		}
+		trailing = true
+		if p.endOfStatement() || p.is("=") || p.is(")") || p.is(":") {
+			break
+		}
+		if t := p.tok(); t.kind == tokOp && strings.HasSuffix(t.text, "=") && t.text != "==" {
+			break
+		}
+	}
+	if len(elts) == 1 && !trailing {
+		if _, ok := elts[0].(*starredExpr); ok {
+			return nil, p.errorf("can't use starred expression here")
+		}
+		return elts[0], nil
+	}
+	return &tupleExpr{elts}, nil
+}
+
+// namedTest parses a test that may be an assignment expression
+func (p *parser) namedTest() (expr, error) {
+	x, err := p.test()
+	if err != nil {
+		return nil, err
+	}
+	if p.is(":=") {
+		return nil, p.errorf("assignment expressions are not supported in restricted mode")
+	}
+	return x, nil
+}
+
+func (p *parser) test() (expr, error) {
+	if p.is("lambda") {
+		return p.lambda()
+	}
+	x, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("if") {
+		cond, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("else"); err != nil {
+			return nil, err
+		}
+		b, err := p.test()
+		if err != nil {
+			return nil, err
+		}
+		return &condExpr{cond, x, b}, nil
+	}
+	return x, nil
+}
+
+func (p *parser) lambda() (expr, error) {
+	p.next()
+	params, err := p.params(":")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	body, err := p.test()
+	if err != nil {
+		return nil, err
+	}
+	return &lambdaExpr{params, body}, nil
+}
+
+func (p *parser) or() (expr, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = &boolExpr{"or", x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) and() (expr, error) {
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		y, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		x = &boolExpr{"and", x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) not() (expr, error) {
+	if p.accept("not") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{"not", x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (expr, error) {
+	x, err := p.bitOr()
+	if err != nil {
+		return nil, err
+	}
+	var ops []string
+	var rest []expr
+	for {
+		var op string
+		switch {
+		case p.is("<"), p.is(">"), p.is("=="), p.is(">="), p.is("<="), p.is("!="), p.is("in"):
+			op = p.next().text
+		case p.is("not") && p.toks[p.pos+1].text == "in":
+			p.pos += 2
+			op = "not in"
+		case p.is("is"):
+			p.pos++
+			op = "is"
+			if p.accept("not") {
+				op = "is not"
+			}
+		default:
+			if len(ops) == 0 {
+				return x, nil
+			}
+			return &compareExpr{x, ops, rest}, nil
+		}
+		y, err := p.bitOr()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+		rest = append(rest, y)
+	}
+}
+
+// binary parses left-associative binary operators of one precedence level
+func (p *parser) binary(ops []string, operand func() (expr, error)) (expr, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		matched := ""
+		for _, op := range ops {
+			if p.tok().kind == tokOp && p.tok().text == op {
+				matched = op
+				break
+			}
+		}
+		if matched == "" {
+			return x, nil
+		}
+		p.pos++
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = &binExpr{matched, x, y}
+	}
+}
+
+func (p *parser) bitOr() (expr, error) {
+	return p.binary([]string{"|"}, p.bitXor)
+}
+
+func (p *parser) bitXor() (expr, error) {
+	return p.binary([]string{"^"}, p.bitAnd)
+}
+
+func (p *parser) bitAnd() (expr, error) {
+	return p.binary([]string{"&"}, p.shift)
+}
+
+func (p *parser) shift() (expr, error) {
+	return p.binary([]string{"<<", ">>"}, p.arith)
+}
+
+func (p *parser) arith() (expr, error) {
+	return p.binary([]string{"+", "-"}, p.term)
+}
+
+func (p *parser) term() (expr, error) {
+	return p.binary([]string{"*", "/", "//", "%", "@"}, p.factor)
+}
+
+func (p *parser) factor() (expr, error) {
+	if t := p.tok(); t.kind == tokOp && (t.text == "-" || t.text == "+" || t.text == "~") {
+		p.pos++
+		x, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{t.text, x}, nil
+	}
+	return p.power()
+}
+
+func (p *parser) power() (expr, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("**") {
+		y, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return &binExpr{"**", x, y}, nil
+	}
+	return x, nil
+}
+
+func (p *parser) primary() (expr, error) {
+	x, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("("):
+			args, err := p.args()
+			if err != nil {
+				return nil, err
+			}
+			x = &callExpr{x, args}
+		case p.accept("["):
+			index, err := p.subscript()
+			if err != nil {
+				return nil, err
+			}
+			x = &indexExpr{x, index}
+		case p.accept("."):
+			name := p.tok()
+			if name.kind != tokName {
+				return nil, p.errorf("invalid syntax")
+			}
+			p.pos++
+			x = &attrExpr{x, name.text}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// args parses the arguments of a call after its opening parenthesis
+func (p *parser) args() ([]arg, error) {
+	var args []arg
+	for !p.accept(")") {
+		var a arg
+		switch {
+		case p.accept("**"):
+			a.star = 2
+		case p.accept("*"):
+			a.star = 1
+		case p.tok().kind == tokName && p.toks[p.pos+1].kind == tokOp && p.toks[p.pos+1].text == "=":
+			a.name = p.next().text
+			p.pos++
+		}
+		x, err := p.test()
+		if err != nil {
+			return nil, err
+		}
+		if a.star == 0 && a.name == "" && p.is("for") {
+			// A generator expression as the only argument
+			comp, err := p.comprehension('(', x, nil)
+			if err != nil {
+				return nil, err
+			}
+			x = comp
+		}
+		a.x = x
+		args = append(args, a)
+		if !p.accept(",") {
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return args, nil
+}
+
+// subscript parses an index or slice after its opening bracket
+func (p *parser) subscript() (expr, error) {
+	var items []expr
+	trailing := false
+	for !p.is("]") {
+		item, err := p.sliceItem()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		trailing = false
+		if !p.accept(",") {
+			break
+		}
+		trailing = true
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, p.errorf("invalid syntax")
+	}
+	if len(items) == 1 && !trailing {
+		return items[0], nil
+	}
+	return &tupleExpr{items}, nil
+}
+
+func (p *parser) sliceItem() (expr, error) {
+	var lo expr
+	var err error
+	if !p.is(":") {
+		if lo, err = p.test(); err != nil {
+			return nil, err
+		}
+		if !p.is(":") {
+			return lo, nil
+		}
+	}
+	p.pos++
+	s := &sliceExpr{lo: lo}
+	if !p.is(":") && !p.is("]") && !p.is(",") {
+		if s.hi, err = p.test(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept(":") && !p.is("]") && !p.is(",") {
+		if s.step, err = p.test(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) atom() (expr, error) {
+	t := p.tok()
+	switch t.kind {
+	case tokName:
+		switch t.text {
+		case "True":
+			p.pos++
+			return &constExpr{true}, nil
+		case "False":
+			p.pos++
+			return &constExpr{false}, nil
+		case "None":
+			p.pos++
+			return &constExpr{none}, nil
+		}
+		if what, ok := unsupported[t.text]; ok {
+			return nil, p.errorf("%s are not supported in restricted mode", what)
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return &nameExpr{name}, nil
+	case tokInt:
+		p.pos++
+		// Decimal literals are converted in quadratic time, as int() is
+		if digits := len(t.text) - strings.Count(t.text, "_"); digits > 4300 && t.text[0] != '0' {
+			return nil, syntaxErrorf(t.line, "Exceeds the limit (4300 digits) for integer string conversion: value has %d digits", digits)
+		}
+		n, ok := new(big.Int).SetString(strings.ToLower(t.text), 0)
+		if !ok {
+			return nil, syntaxErrorf(t.line, "invalid literal %s", t.text)
+		}
+		return &constExpr{n}, nil
+	case tokFloat:
+		p.pos++
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil && !strings.Contains(err.Error(), "range") {
+			return nil, syntaxErrorf(t.line, "invalid literal %s", t.text)
+		}
+		return &constExpr{f}, nil
+	case tokString, tokFString:
+		return p.strings()
+	case tokOp:
+		switch t.text {
+		case "(":
+			p.pos++
+			return p.parenthesized()
+		case "[":
+			p.pos++
+			return p.listDisplay()
+		case "{":
+			p.pos++
+			return p.braceDisplay()
+		case "...":
+			p.pos++
+			return &constExpr{none}, nil
+		}
+	case tokIndent:
+		return nil, &SyntaxError{Kind: "IndentationError", Line: t.line, Msg: "unexpected indent"}
+	}
+	return nil, p.errorf("invalid syntax")
+}
+
+// strings parses adjacent string literals, which are concatenated
+func (p *parser) strings() (expr, error) {
+	var parts []fstringPart
+	fstring := false
+	for p.tok().kind == tokString || p.tok().kind == tokFString {
+		t := p.next()
+		if t.kind == tokString {
+			parts = append(parts, fstringPart{lit: t.text})
+			continue
+		}
+		fstring = true
+		fparts, err := parseFString(t.text, t.line)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, fparts...)
+	}
+	if !fstring {
+		var b strings.Builder
+		for _, part := range parts {
+			b.WriteString(part.lit)
+		}
+		return &constExpr{b.String()}, nil
+	}
+	return &fstringExpr{parts}, nil
+}
+
+// parseFString splits the text of an f-string into literal text and
+// replacement fields
+func parseFString(text string, line int) ([]fstringPart, error) {
+	var parts []fstringPart
+	var lit strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '{' && i+1 < len(runes) && runes[i+1] == '{':
+			lit.WriteRune('{')
+			i++
+		case c == '}' && i+1 < len(runes) && runes[i+1] == '}':
+			lit.WriteRune('}')
+			i++
+		case c == '}':
+			return nil, syntaxErrorf(line, "f-string: single '}' is not allowed")
+		case c == '{':
+			if lit.Len() > 0 {
+				parts = append(parts, fstringPart{lit: lit.String()})
+				lit.Reset()
+			}
+			part, end, err := parseField(runes, i+1, line)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+			i = end
+		default:
+			lit.WriteRune(c)
+		}
+	}
+	if lit.Len() > 0 {
+		parts = append(parts, fstringPart{lit: lit.String()})
+	}
+	return parts, nil
+}
+
+// parseField parses a replacement field starting after its brace and
+// returns the index of its closing brace
+func parseField(runes []rune, start int, line int) (fstringPart, int, error) {
+	depth := 0
+	var quote rune
+	i := start
+	exprEnd, specStart := -1, -1
+	var conv byte
+scan:
+	for ; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case (c == ')' || c == ']' || c == '}') && depth > 0:
+			depth--
+		case depth == 0 && c == '!' && i+1 < len(runes) && runes[i+1] != '=':
+			if i+2 >= len(runes) || !strings.ContainsRune("rsa", runes[i+1]) {
+				return fstringPart{}, 0, syntaxErrorf(line, "f-string: invalid conversion character")
+			}
+			exprEnd = i
+			conv = byte(runes[i+1])
+			i += 2
+			if runes[i] == ':' {
+				specStart = i + 1
+				i = findFieldEnd(runes, specStart)
+			}
+			break scan
+		case depth == 0 && c == ':':
+			exprEnd = i
+			specStart = i + 1
+			i = findFieldEnd(runes, specStart)
+			break scan
+		case depth == 0 && c == '}':
+			exprEnd = i
+			break scan
+		}
+	}
+	if i >= len(runes) || runes[i] != '}' {
+		return fstringPart{}, 0, syntaxErrorf(line, "f-string: expecting '}'")
+	}
+
+	source := strings.TrimSpace(string(runes[start:exprEnd]))
+	debug := strings.HasSuffix(source, "=") && !strings.HasSuffix(source, "==")
+	if debug {
+		source = strings.TrimSpace(strings.TrimSuffix(source, "="))
+	}
+	if source == "" {
+		return fstringPart{}, 0, syntaxErrorf(line, "f-string: empty expression not allowed")
+	}
+	x, err := parseExpression(source, line)
+	if err != nil {
+		return fstringPart{}, 0, err
+	}
+	part := fstringPart{x: x, conv: conv}
+	if debug {
+		part.lit = string(runes[start:exprEnd])
+		if conv == 0 && specStart < 0 {
+			part.conv = 'r'
+		}
+	}
+	if specStart >= 0 {
+		specParts, err := parseFString(string(runes[specStart:i]), line)
+		if err != nil {
+			return fstringPart{}, 0, err
+		}
+		part.spec = &fstringExpr{specParts}
+	}
+	return part, i, nil
+}
+
+// findFieldEnd returns the index of the brace closing a format spec, which
+// may contain nested fields
+func findFieldEnd(runes []rune, i int) int {
+	depth := 0
+	for ; i < len(runes); i++ {
+		switch runes[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return i
+}
+
+// parseExpression parses the expression of an f-string field
+func parseExpression(source string, line int) (expr, error) {
+	toks, err := tokenize("(" + source + ")")
+	if err != nil {
+		if se, ok := err.(*SyntaxError); ok {
+			se.Line = line
+		}
+		return nil, err
+	}
+	for i := range toks {
+		toks[i].line = line
+	}
+	p := &parser{toks: toks}
+	x, err := p.testList(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok().kind != tokNewline && p.tok().kind != tokEOF {
+		return nil, syntaxErrorf(line, "f-string: invalid syntax")
+	}
+	return x, nil
+}
+
+// parenthesized parses a tuple, a generator expression, or a parenthesized
+// expression after the opening parenthesis
+func (p *parser) parenthesized() (expr, error) {
+	if p.accept(")") {
+		return &tupleExpr{}, nil
+	}
+	first, err := p.displayItem()
+	if err != nil {
+		return nil, err
+	}
+	if p.is("for") {
+		comp, err := p.comprehension('(', first, nil)
+		if err != nil {
+			return nil, err
+		}
+		return comp, p.expect(")")
+	}
+	if p.accept(")") {
+		if _, ok := first.(*starredExpr); ok {
+			return nil, p.errorf("can't use starred expression here")
+		}
+		return first, nil
+	}
+	elts := []expr{first}
+	for p.accept(",") && !p.is(")") {
+		x, err := p.displayItem()
+		if err != nil {
+			return nil, err
+		}
+		elts = append(elts, x)
+	}
+	return &tupleExpr{elts}, p.expect(")")
+}
+
+// displayItem parses an item of a display, which may be starred
+func (p *parser) displayItem() (expr, error) {
+	if p.accept("*") {
+		x, err := p.bitOr()
+		if err != nil {
+			return nil, err
+		}
+		return &starredExpr{x}, nil
+	}
+	return p.test()
+}
+
+func (p *parser) listDisplay() (expr, error) {
+	if p.accept("]") {
+		return &listExpr{}, nil
+	}
+	first, err := p.displayItem()
+	if err != nil {
+		return nil, err
+	}
+	if p.is("for") {
+		comp, err := p.comprehension('[', first, nil)
+		if err != nil {
+			return nil, err
+		}
+		return comp, p.expect("]")
+	}
+	elts := []expr{first}
+	for p.accept(",") && !p.is("]") {
+		x, err := p.displayItem()
+		if err != nil {
+			return nil, err
+		}
+		elts = append(elts, x)
+	}
+	return &listExpr{elts}, p.expect("]")
+}
+
+func (p *parser) braceDisplay() (expr, error) {
+	if p.accept("}") {
+		return &dictExpr{}, nil
+	}
+	if p.accept("**") {
+		return nil, p.errorf("dict unpacking is not supported in restricted mode")
+	}
+	first, err := p.displayItem()
+	if err != nil {
+		return nil, err
+	}
+	if _, starred := first.(*starredExpr); !starred && p.accept(":") {
+		val, err := p.test()
+		if err != nil {
+			return nil, err
+		}
+		if p.is("for") {
+			comp, err := p.comprehension(':', first, val)
+			if err != nil {
+				return nil, err
+			}
+			return comp, p.expect("}")
+		}
+		d := &dictExpr{keys: []expr{first}, vals: []expr{val}}
+		for p.accept(",") && !p.is("}") {
+			key, err := p.test()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			val, err := p.test()
+			if err != nil {
+				return nil, err
+			}
+			d.keys = append(d.keys, key)
+			d.vals = append(d.vals, val)
+		}
+		return d, p.expect("}")
+	}
+	if p.is("for") {
+		comp, err := p.comprehension('{', first, nil)
+		if err != nil {
+			return nil, err
+		}
+		return comp, p.expect("}")
+	}
+	elts := []expr{first}
+	for p.accept(",") && !p.is("}") {
+		x, err := p.displayItem()
+		if err != nil {
+			return nil, err
+		}
+		elts = append(elts, x)
+	}
+	return &setExpr{elts}, p.expect("}")
+}
+
+// comprehension parses the for and if clauses of a comprehension
+func (p *parser) comprehension(kind byte, elt, val expr) (expr, error) {
+	c := &compExpr{kind: kind, elt: elt, val: val}
+	for p.accept("for") {
+		target, err := p.targetList()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkTarget(target, p.tok().line); err != nil {
+			return nil, err
+		}
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		iter, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		clause := compClause{target: target, iter: iter}
+		for p.accept("if") {
+			cond, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			clause.conds = append(clause.conds, cond)
+		}
+		c.clauses = append(c.clauses, clause)
+	}
+	return c, nil
+}
@@ -0,0 +1,213 @@
+// Package restricted runs a subset of Python in an interpreter inside the
+// server process. Programs have no imports, files, or network, and run
+// under limits on their steps, call depth, and allocations, so the
+// python-restricted language needs no interpreter or sandbox on the host.
+package restricted
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"forgeai/pkg/sandbox"
+)
+
+// Language is the language name of restricted Python
+const Language = "python-restricted"
+
+// Limits bound the work of a program
+type Limits struct {
+	// Steps is the number of statements, calls, and loop iterations a
+	// program may run
+	Steps int64
+
+	// Depth is the maximum depth of nested calls
+	Depth int
+
+	// Memory is the number of bytes a program may allocate in total.
+	// Memory is never returned, so a program that builds and drops many
+	// values runs out even if it holds little at once.
+	Memory int64
+}
+
+// DefaultLimits allows five million steps, a call depth of 200, and 128 MB
+// of allocations
+func DefaultLimits() Limits {
+	return Limits{Steps: 5000000, Depth: 200, Memory: 128 << 20}
+}
+
+// WithDefaults fills the zero fields of l from defaults
+func (l Limits) WithDefaults(defaults Limits) Limits {
+	if l.Steps <= 0 {
+		l.Steps = defaults.Steps
+	}
+	if l.Depth <= 0 {
+		l.Depth = defaults.Depth
+	}
+	if l.Memory <= 0 {
+		l.Memory = defaults.Memory
+	}
+	return l
+}
+
+// Executor runs restricted Python
+type Executor struct {
+	// Timeout for execution
+	Timeout time.Duration
+
+	// MemoryLimit in MB bounds the allocations of a program when
+	// Limits.Memory is zero
+	MemoryLimit int
+
+	// Limits bound the work of a program; zero limits use DefaultLimits
+	Limits Limits
+
+	// Output bounds the output held in memory; zero limits use
+	// sandbox.DefaultOutputLimits
+	Output sandbox.OutputLimits
+}
+
+// NewExecutor creates an Executor with default settings
+func NewExecutor() *Executor {
+	return &Executor{
+		Timeout:     30 * time.Second,
+		MemoryLimit: 128, // 128 MB
+	}
+}
+
+// Execute runs a program. Syntax errors and uncaught exceptions are
+// reported like Python does, with a traceback in the output and exit code
+// 1; programs that exceed the step limit or the timeout have exit code -1.
+func (e *Executor) Execute(ctx context.Context, language, code string) (*sandbox.ExecutionResult, error) {
+	if language != Language {
+		return nil, fmt.Errorf("unsupported language: %s", language)
+	}
+
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	limits := e.Limits
+	if limits.Memory <= 0 && e.MemoryLimit > 0 {
+		limits.Memory = int64(e.MemoryLimit) << 20
+	}
+	limits = limits.WithDefaults(DefaultLimits())
+
+	output := e.Output.NewBuffer()
+	result := &sandbox.ExecutionResult{}
+	start := time.Now()
+
+	body, err := parse(code)
+	if err == nil {
+		err = newInterp(ctx, limits, output).run(body)
+	}
+
+	result.Duration = time.Since(start)
+
+	var syntaxErr *SyntaxError
+	var pe *pyError
+	switch {
+	case err == nil:
+	case errors.As(err, &syntaxErr):
+		fmt.Fprint(output, formatSyntaxError(syntaxErr, code))
+		result.ExitCode = 1
+	case errors.As(err, &pe):
+		fmt.Fprint(output, formatTraceback(pe, code))
+		result.ExitCode = 1
+	case errors.Is(err, errStepLimit):
+		result.Stderr = "Step limit exceeded"
+		result.ExitCode = -1
+	case errors.Is(err, context.DeadlineExceeded):
+		result.Stderr = "Execution timed out"
+		result.ExitCode = -1
+	default:
+		return nil, err
+	}
+
+	result.Stdout = output.String()
+	result.OutputOmitted = output.Omitted()
+	return result, nil
+}
+
+// ExecuteFile is not supported; restricted programs are submitted as code
+func (e *Executor) ExecuteFile(ctx context.Context, filePath string) (*sandbox.ExecutionResult, error) {
+	return nil, fmt.Errorf("%s programs cannot be run from files", Language)
+}
+
+// SupportedLanguages returns python-restricted
+func (e *Executor) SupportedLanguages() []string {
+	return []string{Language}
+}
+
+// Capabilities reports what the interpreter enforces. Programs cannot reach
+// the filesystem or the network because the language has no way to.
+func (e *Executor) Capabilities() sandbox.Capabilities {
+	return sandbox.Capabilities{
+		Backend:             "in-process",
+		Available:           true,
+		Timeout:             true,
+		MemoryLimit:         true,
+		NetworkIsolation:    true,
+		FilesystemIsolation: true,
+		Notes: []string{
+			"runs a subset of Python without imports, classes, or IO other than print",
+			"memory limits bound the total a program allocates",
+		},
+	}
+}
+
+// sourceLine returns a line of the program, trimmed
+func sourceLine(code string, line int) string {
+	lines := strings.Split(code, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[line-1])
+}
+
+func formatSyntaxError(err *SyntaxError, code string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  File \"<submitted code>\", line %d\n", err.Line)
+	if src := sourceLine(code, err.Line); src != "" {
+		fmt.Fprintf(&b, "    %s\n", src)
+	}
+	fmt.Fprintf(&b, "%s: %s\n", err.Kind, err.Msg)
+	return b.String()
+}
+
+// formatTraceback formats an uncaught exception like Python does, folding
+// repeated entries of deep recursion
+func formatTraceback(pe *pyError, code string) string {
+	var b strings.Builder
+	b.WriteString("Traceback (most recent call last):\n")
+	var last traceEntry
+	repeated := 0
+	flush := func() {
+		if repeated > 3 {
+			fmt.Fprintf(&b, "  [Previous line repeated %d more times]\n", repeated-3)
+		}
+	}
+	for i := len(pe.trace) - 1; i >= 0; i-- {
+		entry := pe.trace[i]
+		if i < len(pe.trace)-1 && entry == last {
+			repeated++
+			if repeated > 3 {
+				continue
+			}
+		} else {
+			flush()
+			last, repeated = entry, 1
+		}
+		fmt.Fprintf(&b, "  File \"<submitted code>\", line %d, in %s\n", entry.line, entry.fn)
+		if src := sourceLine(code, entry.line); src != "" {
+			fmt.Fprintf(&b, "    %s\n", src)
+		}
+	}
+	flush()
+	fmt.Fprintf(&b, "%s\n", pe.Error())
+	return b.String()
+}
@@ -0,0 +1,771 @@
+package restricted
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// value is a Python value: noneType, bool, *big.Int, float64, string,
+// *listVal, tupleVal, *dictVal, *setVal, rangeVal, *viewVal, *sliceVal,
+// *iterVal, *funcVal, *builtinFn, *boundMethod, *typeVal, *excType, or
+// *excVal. Ints are never modified in place.
+type value interface{}
+
+// noneType is the type of None
+type noneType struct{}
+
+var none = noneType{}
+
+type listVal struct {
+	items []value
+}
+
+type tupleVal []value
+
+// dictVal is a dict, which keeps its keys in insertion order
+type dictVal struct {
+	keys  []value
+	vals  []value
+	index map[string]int
+}
+
+// setVal is a set, which iterates in insertion order
+type setVal struct {
+	items []value
+	index map[string]int
+}
+
+type rangeVal struct {
+	start, stop, step int64
+}
+
+// viewVal is the keys, values, or items of a dict
+type viewVal struct {
+	kind string
+	d    *dictVal
+}
+
+// sliceVal is the subscript of a slice such as a[1:n]
+type sliceVal struct {
+	lo, hi, step value
+}
+
+// iterVal is an iterator, such as the result of enumerate or zip
+type iterVal struct {
+	name string
+	next func() (value, bool, error)
+}
+
+// typeVal is a built-in type, which converts values when called
+type typeVal struct {
+	name string
+	call func(in *interp, args []value, kw []kwarg) (value, error)
+}
+
+type builtinFn struct {
+	name string
+	call func(in *interp, args []value, kw []kwarg) (value, error)
+}
+
+// boundMethod is a method of a built-in value
+type boundMethod struct {
+	self value
+	name string
+	call func(in *interp, self value, args []value, kw []kwarg) (value, error)
+}
+
+// kwarg is a keyword argument of a call
+type kwarg struct {
+	name string
+	val  value
+}
+
+func newInt(n int64) *big.Int {
+	return big.NewInt(n)
+}
+
+func newDict() *dictVal {
+	return &dictVal{index: make(map[string]int)}
+}
+
+func newSet() *setVal {
+	return &setVal{index: make(map[string]int)}
+}
+
+// get returns the value of a key
+func (d *dictVal) get(in *interp, key value) (value, bool, error) {
+	k, err := in.hashKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	i, ok := d.index[k]
+	if !ok {
+		return nil, false, nil
+	}
+	return d.vals[i], true, nil
+}
+
+// set adds or replaces the value of a key
+func (d *dictVal) set(in *interp, key, val value) error {
+	k, err := in.hashKey(key)
+	if err != nil {
+		return err
+	}
+	if i, ok := d.index[k]; ok {
+		d.vals[i] = val
+		return nil
+	}
+	if err := in.alloc(slotSize); err != nil {
+		return err
+	}
+	d.index[k] = len(d.keys)
+	d.keys = append(d.keys, key)
+	d.vals = append(d.vals, val)
+	return nil
+}
+
+// remove deletes a key and returns its value
+func (d *dictVal) remove(in *interp, key value) (value, bool, error) {
+	k, err := in.hashKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	i, ok := d.index[k]
+	if !ok {
+		return nil, false, nil
+	}
+	val := d.vals[i]
+	d.keys = append(d.keys[:i:i], d.keys[i+1:]...)
+	d.vals = append(d.vals[:i:i], d.vals[i+1:]...)
+	delete(d.index, k)
+	for j := i; j < len(d.keys); j++ {
+		kj, _ := in.hashKey(d.keys[j])
+		d.index[kj] = j
+	}
+	return val, true, nil
+}
+
+// items returns the items of a view
+func (v *viewVal) items() []value {
+	switch v.kind {
+	case "keys":
+		return append([]value(nil), v.d.keys...)
+	case "values":
+		return append([]value(nil), v.d.vals...)
+	}
+	items := make([]value, len(v.d.keys))
+	for i := range v.d.keys {
+		items[i] = tupleVal{v.d.keys[i], v.d.vals[i]}
+	}
+	return items
+}
+
+func (s *setVal) has(in *interp, v value) (bool, error) {
+	k, err := in.hashKey(v)
+	if err != nil {
+		return false, err
+	}
+	_, ok := s.index[k]
+	return ok, nil
+}
+
+func (s *setVal) add(in *interp, v value) error {
+	k, err := in.hashKey(v)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.index[k]; ok {
+		return nil
+	}
+	if err := in.alloc(slotSize); err != nil {
+		return err
+	}
+	s.index[k] = len(s.items)
+	s.items = append(s.items, v)
+	return nil
+}
+
+func (s *setVal) remove(in *interp, v value) (bool, error) {
+	k, err := in.hashKey(v)
+	if err != nil {
+		return false, err
+	}
+	i, ok := s.index[k]
+	if !ok {
+		return false, nil
+	}
+	s.items = append(s.items[:i:i], s.items[i+1:]...)
+	delete(s.index, k)
+	for j := i; j < len(s.items); j++ {
+		kj, _ := in.hashKey(s.items[j])
+		s.index[kj] = j
+	}
+	return true, nil
+}
+
+func (r rangeVal) length() int64 {
+	if r.step > 0 && r.start < r.stop {
+		return (r.stop - r.start + r.step - 1) / r.step
+	}
+	if r.step < 0 && r.start > r.stop {
+		return (r.start - r.stop - r.step - 1) / -r.step
+	}
+	return 0
+}
+
+// typeName returns the name of the type of v
+func typeName(v value) string {
+	switch v := v.(type) {
+	case noneType:
+		return "NoneType"
+	case bool:
+		return "bool"
+	case *big.Int:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "str"
+	case *listVal:
+		return "list"
+	case tupleVal:
+		return "tuple"
+	case *dictVal:
+		return "dict"
+	case *setVal:
+		return "set"
+	case rangeVal:
+		return "range"
+	case *viewVal:
+		return "dict_" + v.kind
+	case *sliceVal:
+		return "slice"
+	case *iterVal:
+		return v.name
+	case *funcVal:
+		return "function"
+	case *builtinFn, *boundMethod:
+		return "builtin_function_or_method"
+	case *typeVal, *excType:
+		return "type"
+	case *excVal:
+		return v.typ.name
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// truthy reports whether v is true in a condition
+func truthy(v value) bool {
+	switch v := v.(type) {
+	case noneType:
+		return false
+	case bool:
+		return v
+	case *big.Int:
+		return v.Sign() != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case *listVal:
+		return len(v.items) > 0
+	case tupleVal:
+		return len(v) > 0
+	case *dictVal:
+		return len(v.keys) > 0
+	case *setVal:
+		return len(v.items) > 0
+	case rangeVal:
+		return v.length() > 0
+	case *viewVal:
+		return len(v.d.keys) > 0
+	}
+	return true
+}
+
+// str returns str(v)
+func str(v value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case *excVal:
+		switch len(v.args) {
+		case 0:
+			return ""
+		case 1:
+			if v.typ.isSubclass(keyError) {
+				// KeyError shows the repr of the missing key
+				return repr(v.args[0])
+			}
+			return str(v.args[0])
+		}
+		return repr(tupleVal(v.args))
+	}
+	return repr(v)
+}
+
+// repr returns repr(v)
+func repr(v value) string {
+	var b strings.Builder
+	writeRepr(&b, v, 0)
+	return b.String()
+}
+
+func writeRepr(b *strings.Builder, v value, depth int) {
+	if depth > maxReprDepth {
+		b.WriteString("...")
+		return
+	}
+	switch v := v.(type) {
+	case noneType:
+		b.WriteString("None")
+	case bool:
+		if v {
+			b.WriteString("True")
+		} else {
+			b.WriteString("False")
+		}
+	case *big.Int:
+		b.WriteString(v.String())
+	case float64:
+		b.WriteString(formatFloat(v))
+	case string:
+		b.WriteString(quote(v))
+	case *listVal:
+		b.WriteByte('[')
+		writeItems(b, v.items, depth)
+		b.WriteByte(']')
+	case tupleVal:
+		b.WriteByte('(')
+		writeItems(b, v, depth)
+		if len(v) == 1 {
+			b.WriteByte(',')
+		}
+		b.WriteByte(')')
+	case *dictVal:
+		b.WriteByte('{')
+		for i := range v.keys {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeRepr(b, v.keys[i], depth+1)
+			b.WriteString(": ")
+			writeRepr(b, v.vals[i], depth+1)
+		}
+		b.WriteByte('}')
+	case *setVal:
+		if len(v.items) == 0 {
+			b.WriteString("set()")
+			return
+		}
+		b.WriteByte('{')
+		writeItems(b, v.items, depth)
+		b.WriteByte('}')
+	case rangeVal:
+		if v.step == 1 {
+			fmt.Fprintf(b, "range(%d, %d)", v.start, v.stop)
+		} else {
+			fmt.Fprintf(b, "range(%d, %d, %d)", v.start, v.stop, v.step)
+		}
+	case *viewVal:
+		fmt.Fprintf(b, "dict_%s([", v.kind)
+		writeItems(b, v.items(), depth)
+		b.WriteString("])")
+	case *sliceVal:
+		b.WriteString("slice(")
+		writeItems(b, []value{v.lo, v.hi, v.step}, depth)
+		b.WriteByte(')')
+	case *iterVal:
+		fmt.Fprintf(b, "<%s object>", v.name)
+	case *funcVal:
+		fmt.Fprintf(b, "<function %s>", v.name)
+	case *builtinFn:
+		fmt.Fprintf(b, "<built-in function %s>", v.name)
+	case *boundMethod:
+		fmt.Fprintf(b, "<built-in method %s of %s object>", v.name, typeName(v.self))
+	case *typeVal:
+		fmt.Fprintf(b, "<class '%s'>", v.name)
+	case *excType:
+		fmt.Fprintf(b, "<class '%s'>", v.name)
+	case *excVal:
+		b.WriteString(v.typ.name)
+		b.WriteByte('(')
+		writeItems(b, v.args, depth)
+		b.WriteByte(')')
+	default:
+		fmt.Fprintf(b, "<%T>", v)
+	}
+}
+
+// maxReprDepth bounds the nesting printed by repr, so that lists that
+// contain themselves print
+const maxReprDepth = 64
+
+func writeItems(b *strings.Builder, items []value, depth int) {
+	for i, item := range items {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		writeRepr(b, item, depth+1)
+	}
+}
+
+// quote returns the repr of a string, in single quotes unless it contains
+// single quotes but no double quotes
+func quote(s string) string {
+	q := byte('\'')
+	if strings.ContainsRune(s, '\'') && !strings.ContainsRune(s, '"') {
+		q = '"'
+	}
+	var b strings.Builder
+	b.WriteByte(q)
+	for _, r := range s {
+		switch {
+		case r == rune(q) || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte(q)
+	return b.String()
+}
+
+// formatFloat formats a float like Python's repr
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	// Python switches to exponent notation at the same exponents as %r
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	_, exp, _ := strings.Cut(s, "e")
+	if e, _ := strconv.Atoi(exp); e < -4 || e >= 16 {
+		return s
+	}
+	s = strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.ContainsAny(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// hashKey returns the key that hashable values are stored under in dicts
+// and sets. Numbers that compare equal share a key.
+func (in *interp) hashKey(v value) (string, error) {
+	switch v := v.(type) {
+	case noneType:
+		return "N", nil
+	case bool:
+		if v {
+			return "i1", nil
+		}
+		return "i0", nil
+	case *big.Int:
+		return "i" + v.String(), nil
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			n, _ := big.NewFloat(v).Int(nil)
+			return "i" + n.String(), nil
+		}
+		return "f" + strconv.FormatFloat(v, 'g', -1, 64), nil
+	case string:
+		return "s" + v, nil
+	case tupleVal:
+		var b strings.Builder
+		b.WriteString("t(")
+		for _, item := range v {
+			k, err := in.hashKey(item)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(strconv.Itoa(len(k)))
+			b.WriteByte(':')
+			b.WriteString(k)
+		}
+		b.WriteByte(')')
+		return b.String(), nil
+	case rangeVal:
+		return fmt.Sprintf("r%d,%d,%d", v.start, v.stop, v.step), nil
+	case *listVal, *dictVal, *setVal:
+		return "", in.errorf(typeError, "unhashable type: '%s'", typeName(v))
+	}
+	// Functions and types hash by identity
+	return fmt.Sprintf("p%p", v), nil
+}
+
+// toFloat converts numbers to float
+func toFloat(v value) (float64, bool) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// toInt converts ints and bools to *big.Int
+func toInt(v value) (*big.Int, bool) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return newInt(1), true
+		}
+		return newInt(0), true
+	case *big.Int:
+		return v, true
+	}
+	return nil, false
+}
+
+// toIndex converts ints and bools to an int64 index
+func (in *interp) toIndex(v value) (int64, error) {
+	n, ok := toInt(v)
+	if !ok {
+		return 0, in.errorf(typeError, "'%s' object cannot be interpreted as an integer", typeName(v))
+	}
+	if !n.IsInt64() {
+		return 0, in.errorf(overflowError, "Python int too large to convert to C ssize_t")
+	}
+	return n.Int64(), nil
+}
+
+// equal reports whether a == b
+func (in *interp) equal(a, b value) (bool, error) {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			ia, aInt := toInt(a)
+			ib, bInt := toInt(b)
+			if aInt && bInt {
+				return ia.Cmp(ib) == 0, nil
+			}
+			return fa == fb, nil
+		}
+		return false, nil
+	}
+	switch a := a.(type) {
+	case noneType:
+		_, ok := b.(noneType)
+		return ok, nil
+	case string:
+		b, ok := b.(string)
+		return ok && a == b, nil
+	case *listVal:
+		b, ok := b.(*listVal)
+		if !ok {
+			return false, nil
+		}
+		return in.equalItems(a.items, b.items)
+	case tupleVal:
+		b, ok := b.(tupleVal)
+		if !ok {
+			return false, nil
+		}
+		return in.equalItems(a, b)
+	case *dictVal:
+		b, ok := b.(*dictVal)
+		if !ok || len(a.keys) != len(b.keys) {
+			return false, nil
+		}
+		for i, key := range a.keys {
+			val, found, err := b.get(in, key)
+			if err != nil || !found {
+				return false, err
+			}
+			if eq, err := in.equal(a.vals[i], val); err != nil || !eq {
+				return false, err
+			}
+		}
+		return true, nil
+	case *setVal:
+		b, ok := b.(*setVal)
+		if !ok || len(a.items) != len(b.items) {
+			return false, nil
+		}
+		for _, item := range a.items {
+			if has, err := b.has(in, item); err != nil || !has {
+				return false, err
+			}
+		}
+		return true, nil
+	case rangeVal:
+		b, ok := b.(rangeVal)
+		return ok && a == b, nil
+	case *excVal:
+		return a == b, nil
+	}
+	return a == b, nil
+}
+
+func (in *interp) equalItems(a, b []value) (bool, error) {
+	if len(a) != len(b) {
+		return false, nil
+	}
+	for i := range a {
+		if eq, err := in.equal(a[i], b[i]); err != nil || !eq {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// compare returns -1, 0, or 1 as a is less than, equal to, or greater than
+// b, for the ordering comparisons op
+func (in *interp) compare(op string, a, b value) (int, error) {
+	if ia, ok := toInt(a); ok {
+		if ib, ok := toInt(b); ok {
+			return ia.Cmp(ib), nil
+		}
+	}
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1, nil
+			case fa > fb:
+				return 1, nil
+			case fa == fb:
+				return 0, nil
+			}
+			// NaN is neither smaller nor larger
+			return 2, nil
+		}
+	}
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	case *listVal:
+		if b, ok := b.(*listVal); ok {
+			return in.compareItems(op, a.items, b.items)
+		}
+	case tupleVal:
+		if b, ok := b.(tupleVal); ok {
+			return in.compareItems(op, a, b)
+		}
+	case *setVal:
+		if b, ok := b.(*setVal); ok {
+			return in.compareSets(a, b)
+		}
+	}
+	return 0, in.errorf(typeError, "'%s' not supported between instances of '%s' and '%s'", op, typeName(a), typeName(b))
+}
+
+func (in *interp) compareItems(op string, a, b []value) (int, error) {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		eq, err := in.equal(a[i], b[i])
+		if err != nil {
+			return 0, err
+		}
+		if !eq {
+			return in.compare(op, a[i], b[i])
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1, nil
+	case len(a) > len(b):
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// compareSets orders sets by inclusion; sets that do not include each other
+// are unordered
+func (in *interp) compareSets(a, b *setVal) (int, error) {
+	subset := func(x, y *setVal) (bool, error) {
+		for _, item := range x.items {
+			if has, err := y.has(in, item); err != nil || !has {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	ab, err := subset(a, b)
+	if err != nil {
+		return 0, err
+	}
+	ba, err := subset(b, a)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case ab && ba:
+		return 0, nil
+	case ab:
+		return -1, nil
+	case ba:
+		return 1, nil
+	}
+	return 2, nil
+}
+
+// sortValues sorts values in place with keys computed by key, which may be
+// nil
+func (in *interp) sortValues(items []value, key value, reverse bool) error {
+	keys := items
+	if key != nil && key != value(none) {
+		keys = make([]value, len(items))
+		for i, item := range items {
+			k, err := in.call(key, []value{item}, nil)
+			if err != nil {
+				return err
+			}
+			keys[i] = k
+		}
+	}
+	idx := make([]int, len(items))
+	for i := range idx {
+		idx[i] = i
+	}
+	var sortErr error
+	sort.SliceStable(idx, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		a, b := keys[idx[i]], keys[idx[j]]
+		if reverse {
+			a, b = b, a
+		}
+		c, err := in.compare("<", a, b)
+		if err != nil {
+			sortErr = err
+			return false
+		}
+		return c == -1
+	})
+	if sortErr != nil {
+		return sortErr
+	}
+	sorted := make([]value, len(items))
+	for i, j := range idx {
+		sorted[i] = items[j]
+	}
+	copy(items, sorted)
+	return nil
+}
@@ -0,0 +1,452 @@
+// Package runtime provides additional execution engines that plug into the
+// sandbox.Executor interface alongside the local and container executors.
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"forgeai/pkg/diagnostics"
+	"forgeai/pkg/sandbox"
+)
+
+// NsjailExecutor implements the sandbox.Executor interface using nsjail
+type NsjailExecutor struct {
+	// NsjailPath is the path to the nsjail binary
+	NsjailPath string
+
+	// ProfilePath points to a user-provided nsjail config file. When empty,
+	// a profile is generated from the limits below for every execution.
+	ProfilePath string
+
+	// Timeout for execution
+	Timeout time.Duration
+
+	// MemoryLimit in MB
+	MemoryLimit int
+
+	// MaxOpenFiles caps the number of file descriptors
+	MaxOpenFiles int
+
+	// MaxProcesses caps the number of processes/threads
+	MaxProcesses int
+
+	// NetworkAccess controls network access
+	NetworkAccess bool
+
+	// DeniedSyscalls are rejected by the generated seccomp policy
+	DeniedSyscalls []string
+
+	// Output bounds the output held in memory; zero limits use
+	// sandbox.DefaultOutputLimits
+	Output sandbox.OutputLimits
+
+	// MapTracebacks rewrites references to the file of submitted code in
+	// the output as "<submitted code>"
+	MapTracebacks bool
+
+	// Locale sets TZ, LANG, and LC_ALL in generated profiles; empty fields
+	// use sandbox.DefaultLocale
+	Locale sandbox.Locale
+
+	// Interpreters maps languages to the path of the program that runs
+	// them inside the jail; languages without an entry use
+	// DefaultInterpreters
+	Interpreters map[string]string
+
+	// Mounts are directories mounted read-only in generated profiles in
+	// addition to the system directories, such as the root of a Go
+	// installation outside /usr
+	Mounts []string
+
+	// TmpSize is the size of the /tmp of generated profiles in MB;
+	// DefaultTmpSize when zero
+	TmpSize int
+
+	// Home is HOME in generated profiles; /tmp when empty
+	Home string
+}
+
+// DefaultInterpreters maps languages to the programs that run them inside
+// the jail unless NsjailExecutor.Interpreters overrides them
+var DefaultInterpreters = map[string]string{
+	"python":     "/usr/bin/python3",
+	"go":         "/usr/local/go/bin/go",
+	"javascript": "/usr/bin/node",
+}
+
+// DefaultTmpSize is the size of /tmp in generated profiles in MB
+const DefaultTmpSize = 16
+
+// NewNsjailExecutor creates a new NsjailExecutor with default settings
+func NewNsjailExecutor() *NsjailExecutor {
+	return &NsjailExecutor{
+		NsjailPath:     "nsjail",
+		Timeout:        30 * time.Second,
+		MemoryLimit:    128, // 128 MB
+		MaxOpenFiles:   64,
+		MaxProcesses:   32,
+		NetworkAccess:  false,
+		DeniedSyscalls: DefaultDeniedSyscalls(),
+	}
+}
+
+// DefaultDeniedSyscalls returns the syscalls blocked by generated profiles
+func DefaultDeniedSyscalls() []string {
+	return []string{
+		"ptrace", "mount", "umount2", "pivot_root", "chroot",
+		"reboot", "kexec_load", "init_module", "finit_module",
+		"delete_module", "swapon", "swapoff", "bpf", "perf_event_open",
+	}
+}
+
+// Execute runs the provided code inside an nsjail sandbox
+func (n *NsjailExecutor) Execute(ctx context.Context, language, code string) (*sandbox.ExecutionResult, error) {
+	if !n.isLanguageSupported(language) {
+		return nil, fmt.Errorf("unsupported language: %s", language)
+	}
+
+	// Create a temporary directory for execution
+	tempDir, err := os.MkdirTemp("", "forgeai-nsjail-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir) // Clean up after execution
+
+	// Write code to a temporary file
+	filePath, err := n.writeCodeToFile(tempDir, language, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write code to file: %w", err)
+	}
+
+	result, err := n.ExecuteFile(ctx, filePath)
+	if err == nil && n.MapTracebacks {
+		diagnostics.MapTracebacks(result, filePath)
+	}
+	return result, err
+}
+
+// ExecuteFile runs the provided file inside an nsjail sandbox
+func (n *NsjailExecutor) ExecuteFile(ctx context.Context, filePath string) (*sandbox.ExecutionResult, error) {
+	language := n.getLanguageFromFile(filePath)
+	if !n.isLanguageSupported(language) {
+		return nil, fmt.Errorf("unsupported language: %s", language)
+	}
+
+	if !n.IsNsjailAvailable() {
+		return nil, fmt.Errorf("nsjail is not available")
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve file path: %w", err)
+	}
+	dir := filepath.Dir(absPath)
+
+	// Use the user-provided profile or generate one for this run
+	profilePath := n.ProfilePath
+	if profilePath == "" {
+		profileFile, err := os.CreateTemp("", "forgeai-nsjail-*.cfg")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create nsjail profile: %w", err)
+		}
+		defer os.Remove(profileFile.Name())
+
+		profile := n.Profile(dir)
+		if _, err := profileFile.WriteString(profile.Render()); err != nil {
+			profileFile.Close()
+			return nil, fmt.Errorf("failed to write nsjail profile: %w", err)
+		}
+		profileFile.Close()
+		profilePath = profileFile.Name()
+	}
+
+	cmdArgs, err := n.Command(language, filepath.Join("/workspace", filepath.Base(absPath)))
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up context with timeout. nsjail enforces its own time limit but the
+	// host-side deadline guards against nsjail itself hanging.
+	if n.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.Timeout+5*time.Second)
+		defer cancel()
+	}
+
+	args := []string{"--config", profilePath, "--quiet"}
+	if n.ProfilePath != "" {
+		// User profiles cannot know the workspace path in advance
+		args = append(args, "--bindmount", fmt.Sprintf("%s:/workspace", dir), "--cwd", "/workspace")
+	}
+	args = append(args, "--")
+	args = append(args, cmdArgs...)
+
+	cmd := exec.CommandContext(ctx, n.NsjailPath, args...)
+
+	// Capture output
+	result := &sandbox.ExecutionResult{
+		Stdout: "",
+		Stderr: "",
+	}
+
+	start := time.Now()
+
+	// Run the command
+	output := n.Output.NewBuffer()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err = cmd.Run()
+
+	result.Duration = time.Since(start)
+	result.Stdout = output.String()
+	result.OutputOmitted = output.Omitted()
+
+	// Check if the context was cancelled (timeout)
+	if ctx.Err() == context.DeadlineExceeded || (n.Timeout > 0 && result.Duration >= n.Timeout) {
+		result.Stderr = "Execution timed out"
+		result.ExitCode = -1
+		return result, nil
+	}
+
+	// Get exit code
+	if err != nil {
+		exitError, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf("failed to run nsjail: %w", err)
+		}
+		result.ExitCode = exitError.ExitCode()
+	} else {
+		result.ExitCode = 0
+	}
+
+	// Report compiler errors of programs that did not build
+	if result.ExitCode != 0 {
+		result.Diagnostics = diagnostics.Parse(language, result.Stdout)
+	}
+
+	return result, nil
+}
+
+// Capabilities reports what nsjail enforces. Limits come from the generated
+// profile; a user profile may differ.
+func (n *NsjailExecutor) Capabilities() sandbox.Capabilities {
+	caps := sandbox.Capabilities{
+		Backend:             "nsjail",
+		Available:           n.IsNsjailAvailable(),
+		Timeout:             true,
+		MemoryLimit:         n.MemoryLimit > 0,
+		CPULimit:            n.Timeout > 0,
+		ProcessLimit:        n.MaxProcesses > 0,
+		NetworkIsolation:    !n.NetworkAccess,
+		FilesystemIsolation: true,
+		ReadOnlyFilesystem:  true,
+		SyscallFiltering:    len(n.DeniedSyscalls) > 0,
+	}
+	if n.ProfilePath != "" {
+		caps.Notes = append(caps.Notes, "limits are taken from "+n.ProfilePath+" and are not verified")
+	}
+	return caps
+}
+
+// SupportedLanguages returns a list of supported languages
+func (n *NsjailExecutor) SupportedLanguages() []string {
+	return []string{"python", "go", "javascript"}
+}
+
+// IsNsjailAvailable checks if the nsjail binary can be found
+func (n *NsjailExecutor) IsNsjailAvailable() bool {
+	_, err := exec.LookPath(n.NsjailPath)
+	return err == nil
+}
+
+// Profile builds the nsjail profile for a run using the executor limits
+func (n *NsjailExecutor) Profile(workspaceDir string) *NsjailProfile {
+	return &NsjailProfile{
+		Name:           "forgeai",
+		TimeLimit:      n.Timeout,
+		MemoryLimit:    n.MemoryLimit,
+		MaxOpenFiles:   n.MaxOpenFiles,
+		MaxProcesses:   n.MaxProcesses,
+		NetworkAccess:  n.NetworkAccess,
+		DeniedSyscalls: n.DeniedSyscalls,
+		WorkspaceDir:   workspaceDir,
+		Mounts:         n.Mounts,
+		TmpSize:        n.TmpSize,
+		Home:           n.Home,
+		Env:            n.Locale.Env(),
+	}
+}
+
+// NsjailProfile describes the limits rendered into an nsjail config file
+type NsjailProfile struct {
+	Name           string
+	TimeLimit      time.Duration
+	MemoryLimit    int
+	MaxOpenFiles   int
+	MaxProcesses   int
+	NetworkAccess  bool
+	DeniedSyscalls []string
+	WorkspaceDir   string
+
+	// Mounts are extra directories mounted read-only
+	Mounts []string
+
+	// TmpSize is the size of /tmp in MB; DefaultTmpSize when zero
+	TmpSize int
+
+	// Home is HOME inside the jail; /tmp when empty
+	Home string
+
+	// Env are extra environment variables of the form NAME=value
+	Env []string
+}
+
+// Render returns the profile in nsjail's protobuf text config format
+func (p *NsjailProfile) Render() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "name: %q\n", p.Name)
+	b.WriteString("mode: ONCE\n")
+	b.WriteString("hostname: \"forgeai\"\n")
+	b.WriteString("cwd: \"/workspace\"\n")
+	b.WriteString("keep_env: false\n")
+	b.WriteString("envar: \"PATH=/usr/local/bin:/usr/bin:/bin\"\n")
+	home := p.Home
+	if home == "" {
+		home = "/tmp"
+	}
+	fmt.Fprintf(&b, "envar: %q\n", "HOME="+home)
+	for _, env := range p.Env {
+		fmt.Fprintf(&b, "envar: %q\n", env)
+	}
+
+	if p.TimeLimit > 0 {
+		secs := int(p.TimeLimit / time.Second)
+		if secs < 1 {
+			secs = 1
+		}
+		fmt.Fprintf(&b, "time_limit: %d\n", secs)
+		fmt.Fprintf(&b, "rlimit_cpu: %d\n", secs)
+	}
+	if p.MemoryLimit > 0 {
+		fmt.Fprintf(&b, "rlimit_as: %d\n", p.MemoryLimit)
+		fmt.Fprintf(&b, "cgroup_mem_max: %d\n", int64(p.MemoryLimit)*1024*1024)
+	}
+	if p.MaxOpenFiles > 0 {
+		fmt.Fprintf(&b, "rlimit_nofile: %d\n", p.MaxOpenFiles)
+	}
+	if p.MaxProcesses > 0 {
+		fmt.Fprintf(&b, "rlimit_nproc: %d\n", p.MaxProcesses)
+		fmt.Fprintf(&b, "cgroup_pids_max: %d\n", p.MaxProcesses)
+	}
+	b.WriteString("rlimit_core: 0\n")
+
+	if p.NetworkAccess {
+		b.WriteString("clone_newnet: false\n")
+	} else {
+		b.WriteString("clone_newnet: true\n")
+	}
+
+	// Read-only system directories required by the interpreters
+	for _, dir := range []string{"/bin", "/lib", "/lib64", "/usr", "/etc/alternatives"} {
+		fmt.Fprintf(&b, "mount {\n  src: %q\n  dst: %q\n  is_bind: true\n  rw: false\n  mandatory: false\n}\n", dir, dir)
+	}
+	for _, dir := range p.Mounts {
+		fmt.Fprintf(&b, "mount {\n  src: %q\n  dst: %q\n  is_bind: true\n  rw: false\n}\n", dir, dir)
+	}
+	tmpSize := p.TmpSize
+	if tmpSize <= 0 {
+		tmpSize = DefaultTmpSize
+	}
+	fmt.Fprintf(&b, "mount {\n  dst: \"/tmp\"\n  fstype: \"tmpfs\"\n  rw: true\n  options: \"size=%d\"\n}\n", int64(tmpSize)*1024*1024)
+	if p.WorkspaceDir != "" {
+		fmt.Fprintf(&b, "mount {\n  src: %q\n  dst: \"/workspace\"\n  is_bind: true\n  rw: true\n}\n", p.WorkspaceDir)
+	}
+
+	if len(p.DeniedSyscalls) > 0 {
+		b.WriteString("seccomp_string: \"ERRNO(1) {\"\n")
+		for i, syscall := range p.DeniedSyscalls {
+			sep := ","
+			if i == len(p.DeniedSyscalls)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(&b, "seccomp_string: \"  %s%s\"\n", syscall, sep)
+		}
+		b.WriteString("seccomp_string: \"}\"\n")
+		b.WriteString("seccomp_string: \"DEFAULT ALLOW\"\n")
+	}
+
+	return b.String()
+}
+
+// writeCodeToFile writes the provided code to a temporary file
+func (n *NsjailExecutor) writeCodeToFile(tempDir, language, code string) (string, error) {
+	var fileName string
+
+	switch language {
+	case "python":
+		fileName = "main.py"
+	case "go":
+		fileName = "main.go"
+	case "javascript":
+		fileName = "main.js"
+	default:
+		return "", fmt.Errorf("unsupported language: %s", language)
+	}
+
+	filePath := filepath.Join(tempDir, fileName)
+
+	err := os.WriteFile(filePath, []byte(code), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return filePath, nil
+}
+
+// getLanguageFromFile determines the language from the file extension
+func (n *NsjailExecutor) getLanguageFromFile(filePath string) string {
+	switch filepath.Ext(filePath) {
+	case ".py":
+		return "python"
+	case ".go":
+		return "go"
+	case ".js":
+		return "javascript"
+	default:
+		return "unknown"
+	}
+}
+
+// isLanguageSupported checks if the language is supported
+func (n *NsjailExecutor) isLanguageSupported(language string) bool {
+	for _, lang := range n.SupportedLanguages() {
+		if lang == language {
+			return true
+		}
+	}
+	return false
+}
+
+// Command returns the command that runs a file of a language inside the
+// jail, where the workspace is mounted at /workspace
+func (n *NsjailExecutor) Command(language, filePath string) ([]string, error) {
+	interpreter := n.Interpreters[language]
+	if interpreter == "" {
+		interpreter = DefaultInterpreters[language]
+	}
+	switch language {
+	case "python", "javascript":
+		return []string{interpreter, filePath}, nil
+	case "go":
+		return []string{interpreter, "run", filePath}, nil
+	default:
+		return nil, fmt.Errorf("unsupported language: %s", language)
+	}
+}
@@ -0,0 +1,86 @@
+package sandbox
+
+import "fmt"
+
+// Capabilities reports the guarantees an executor actually provides on this
+// host, so callers can tell when a requested limit would not be enforced
+type Capabilities struct {
+	// Backend names the executor
+	Backend string `json:"backend"`
+
+	// Available is false when the backend cannot run on this host
+	Available bool `json:"available"`
+
+	// Platform is the os/arch that container backends run code on
+	Platform string `json:"platform,omitempty"`
+
+	// SeccompProfile and AppArmorProfile name the profiles container
+	// backends apply
+	SeccompProfile  string `json:"seccomp_profile,omitempty"`
+	AppArmorProfile string `json:"apparmor_profile,omitempty"`
+
+	Timeout             bool `json:"timeout"`
+	MemoryLimit         bool `json:"memory_limit"`
+	CPULimit            bool `json:"cpu_limit"`
+	ProcessLimit        bool `json:"process_limit"`
+	NetworkIsolation    bool `json:"network_isolation"`
+	FilesystemIsolation bool `json:"filesystem_isolation"`
+	ReadOnlyFilesystem  bool `json:"read_only_filesystem"`
+	SyscallFiltering    bool `json:"syscall_filtering"`
+
+	Stdin             bool `json:"stdin"`
+	Streaming         bool `json:"streaming"`
+	Artifacts         bool `json:"artifacts"`
+	Trace             bool `json:"trace"`
+	WorkspaceTracking bool `json:"workspace_tracking"`
+	Profiling         bool `json:"profiling"`
+	Coverage          bool `json:"coverage"`
+
+	// Notes explain partial or conditional support
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Requirements are the guarantees a caller asks for
+type Requirements struct {
+	MemoryLimit        bool
+	NetworkIsolation   bool
+	ReadOnlyFilesystem bool
+	Stdin              bool
+	Streaming          bool
+	Artifacts          bool
+	Trace              bool
+	WorkspaceTracking  bool
+	Profiling          bool
+	Coverage           bool
+}
+
+// Security reports whether any isolation guarantee is required
+func (r Requirements) Security() bool {
+	return r.MemoryLimit || r.NetworkIsolation || r.ReadOnlyFilesystem
+}
+
+// Unmet returns a warning for every requirement the capabilities do not meet
+func (c Capabilities) Unmet(r Requirements) []string {
+	var warnings []string
+	if !c.Available {
+		warnings = append(warnings, fmt.Sprintf("the %s backend is not available on this host", c.Backend))
+	}
+
+	check := func(requested, supported bool, what string) {
+		if requested && !supported {
+			warnings = append(warnings, fmt.Sprintf("%s is not supported by the %s backend", what, c.Backend))
+		}
+	}
+	check(r.MemoryLimit, c.MemoryLimit, "memory limit enforcement")
+	check(r.NetworkIsolation, c.NetworkIsolation, "network isolation")
+	check(r.ReadOnlyFilesystem, c.ReadOnlyFilesystem, "a read-only file system")
+	check(r.Stdin, c.Stdin, "stdin")
+	check(r.Streaming, c.Streaming, "output streaming")
+	check(r.Artifacts, c.Artifacts, "artifacts")
+	check(r.Trace, c.Trace, "tracing")
+	check(r.WorkspaceTracking, c.WorkspaceTracking, "workspace tracking")
+	check(r.Profiling, c.Profiling, "profiling")
+	check(r.Coverage, c.Coverage, "coverage")
+
+	return warnings
+}
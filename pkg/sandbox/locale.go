@@ -0,0 +1,80 @@
+package sandbox
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	// Time zones are validated against the embedded database so that the
+	// same names are accepted on hosts without tzdata
+	_ "time/tzdata"
+)
+
+// Locale is the time zone and locale of an execution, set in the
+// environment of the program so that date and number formatting do not
+// depend on the host. Empty fields take their value from defaults, see
+// WithDefaults.
+type Locale struct {
+	// Timezone is an IANA time zone such as Europe/Berlin, set as TZ
+	Timezone string `json:"timezone,omitempty"`
+
+	// Name is a locale such as en_US.UTF-8, set as LANG and LC_ALL
+	Name string `json:"locale,omitempty"`
+}
+
+// DefaultLocale returns the locale of executions that set none
+func DefaultLocale() Locale {
+	return Locale{Timezone: "UTC", Name: "C.UTF-8"}
+}
+
+var localeRe = regexp.MustCompile(`^[A-Za-z]{1,8}(_[A-Za-z0-9]{2,3})?(\.[A-Za-z0-9-]{1,16})?(@[A-Za-z0-9]{1,16})?$`)
+
+// WithDefaults fills the empty fields of l from defaults
+func (l Locale) WithDefaults(defaults Locale) Locale {
+	if l.Timezone == "" {
+		l.Timezone = defaults.Timezone
+	}
+	if l.Name == "" {
+		l.Name = defaults.Name
+	}
+	return l
+}
+
+// ValidateTimezone checks that tz names a time zone of the IANA database
+func ValidateTimezone(tz string) error {
+	if tz == "Local" {
+		return fmt.Errorf("timezone must name a zone rather than the host's")
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("unknown timezone %q", tz)
+	}
+	return nil
+}
+
+// ValidateLocale checks that name has the form language[_territory][.codeset][@modifier]
+func ValidateLocale(name string) error {
+	if !localeRe.MatchString(name) {
+		return fmt.Errorf("invalid locale %q, expected a name like en_US.UTF-8", name)
+	}
+	return nil
+}
+
+// Validate checks the fields of l that are set
+func (l Locale) Validate() error {
+	if l.Timezone != "" {
+		if err := ValidateTimezone(l.Timezone); err != nil {
+			return err
+		}
+	}
+	if l.Name != "" {
+		return ValidateLocale(l.Name)
+	}
+	return nil
+}
+
+// Env returns the environment variables that apply l, with the defaults
+// for empty fields
+func (l Locale) Env() []string {
+	l = l.WithDefaults(DefaultLocale())
+	return []string{"TZ=" + l.Timezone, "LANG=" + l.Name, "LC_ALL=" + l.Name}
+}
@@ -0,0 +1,194 @@
+package sandbox
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// OutputLimits bound the output of an execution held in memory. Output
+// beyond Head+Tail bytes keeps its first Head and last Tail bytes. Zero
+// fields take their value from defaults, see WithDefaults.
+type OutputLimits struct {
+	Head int `json:"head,omitempty"`
+	Tail int `json:"tail,omitempty"`
+}
+
+// DefaultOutputLimits keeps the first and last 64 KiB of output
+func DefaultOutputLimits() OutputLimits {
+	return OutputLimits{Head: 64 << 10, Tail: 64 << 10}
+}
+
+// WithDefaults fills the zero limits of l from defaults
+func (l OutputLimits) WithDefaults(defaults OutputLimits) OutputLimits {
+	if l.Head == 0 {
+		l.Head = defaults.Head
+	}
+	if l.Tail == 0 {
+		l.Tail = defaults.Tail
+	}
+	return l
+}
+
+// Validate checks that the limits are not negative
+func (l OutputLimits) Validate() error {
+	if l.Head < 0 || l.Tail < 0 {
+		return fmt.Errorf("output limits may not be negative")
+	}
+	return nil
+}
+
+// NewBuffer returns a buffer bounded by the limits, with defaults for zero
+// limits
+func (l OutputLimits) NewBuffer() *OutputBuffer {
+	l = l.WithDefaults(DefaultOutputLimits())
+	return &OutputBuffer{head: make([]byte, 0, minInt(l.Head, 4<<10)), headSize: l.Head, tail: make([]byte, l.Tail)}
+}
+
+// OutputBuffer collects the output of a program in bounded memory. Writes
+// never block or fail, so a program printing without end runs on at full
+// speed while the buffer keeps the first and last bytes of its output and
+// counts the bytes in between.
+type OutputBuffer struct {
+	mu sync.Mutex
+
+	head     []byte
+	headSize int
+
+	// tail is a ring of the last bytes written once head is full; next is
+	// where the next byte goes and filled how much of the ring holds data
+	tail   []byte
+	next   int
+	filled int
+
+	total int64
+}
+
+// Write appends p, dropping the middle of the output once it exceeds the
+// limits
+func (b *OutputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	b.total += int64(n)
+
+	if room := b.headSize - len(b.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.head = append(b.head, p[:room]...)
+		p = p[room:]
+	}
+
+	size := len(b.tail)
+	if size == 0 || len(p) == 0 {
+		return n, nil
+	}
+	if len(p) >= size {
+		copy(b.tail, p[len(p)-size:])
+		b.next, b.filled = 0, size
+		return n, nil
+	}
+	for len(p) > 0 {
+		copied := copy(b.tail[b.next:], p)
+		p = p[copied:]
+		b.next = (b.next + copied) % size
+		b.filled = minInt(b.filled+copied, size)
+	}
+	return n, nil
+}
+
+// Len returns how many bytes were written
+func (b *OutputBuffer) Len() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
+
+// Omitted returns how many bytes were dropped from the middle of the output
+func (b *OutputBuffer) Omitted() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.omitted()
+}
+
+func (b *OutputBuffer) omitted() int64 {
+	return b.total - int64(len(b.head)) - int64(b.filled)
+}
+
+// String returns the kept output, with a marker where bytes were dropped
+func (b *OutputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]byte, 0, len(b.head)+b.filled+64)
+	out = append(out, b.head...)
+	if omitted := b.omitted(); omitted > 0 {
+		out = append(out, fmt.Sprintf("\n... [%d bytes of output omitted] ...\n", omitted)...)
+	}
+	if b.filled < len(b.tail) {
+		out = append(out, b.tail[:b.filled]...)
+	} else {
+		out = append(out, b.tail[b.next:]...)
+		out = append(out, b.tail[:b.next]...)
+	}
+	return string(out)
+}
+
+// EncodingBase64 marks output that is not text and is held base64 encoded
+const EncodingBase64 = "base64"
+
+// MaxBinaryOutput is how many bytes of output that is not text results
+// carry at most
+const MaxBinaryOutput = 1 << 20
+
+// IsText reports whether output is text: valid UTF-8 without NUL bytes.
+// Other output cannot be carried in JSON strings without being mangled.
+func IsText(s string) bool {
+	return utf8.ValidString(s) && strings.IndexByte(s, 0) < 0
+}
+
+// EncodeBinary returns the first max bytes of output base64 encoded, and
+// how many bytes were cut. Negative max, and max beyond MaxBinaryOutput,
+// are MaxBinaryOutput.
+func EncodeBinary(s string, max int) (encoded string, cut int64) {
+	if max < 0 || max > MaxBinaryOutput {
+		max = MaxBinaryOutput
+	}
+	if len(s) > max {
+		cut = int64(len(s) - max)
+		s = s[:max]
+	}
+	return base64.StdEncoding.EncodeToString([]byte(s)), cut
+}
+
+// EncodeOutput base64 encodes the stdout and stderr of the result that are
+// not text, cut to MaxBinaryOutput, so that the result can be carried in
+// JSON. Cut bytes count as omitted. Streams already encoded are left alone.
+func (r *ExecutionResult) EncodeOutput() {
+	streams := []struct {
+		text     *string
+		encoding *string
+	}{
+		{&r.Stdout, &r.StdoutEncoding},
+		{&r.Stderr, &r.StderrEncoding},
+	}
+	for _, stream := range streams {
+		if *stream.encoding != "" || IsText(*stream.text) {
+			continue
+		}
+		encoded, cut := EncodeBinary(*stream.text, MaxBinaryOutput)
+		*stream.text, *stream.encoding = encoded, EncodingBase64
+		r.OutputOmitted += cut
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package sandbox
+
+import "fmt"
+
+// Rlimits are the per-process resource limits of an execution. Zero fields
+// take their value from defaults, see WithDefaults.
+type Rlimits struct {
+	// OpenFiles caps the number of file descriptors
+	OpenFiles uint64 `json:"open_files,omitempty"`
+
+	// FileSize caps the size in bytes of files the program writes
+	FileSize uint64 `json:"file_size,omitempty"`
+
+	// StackSize caps the stack in bytes
+	StackSize uint64 `json:"stack_size,omitempty"`
+
+	// CoreDumps allows core dumps up to FileSize; they are disabled
+	// otherwise
+	CoreDumps bool `json:"core_dumps,omitempty"`
+}
+
+// MaxRlimits are the highest limits an execution may request
+var MaxRlimits = Rlimits{
+	OpenFiles: 65536,
+	FileSize:  4 << 30,
+	StackSize: 1 << 30,
+}
+
+// DefaultRlimits returns hardened limits that fit typical programs
+func DefaultRlimits() Rlimits {
+	return Rlimits{
+		OpenFiles: 256,
+		FileSize:  64 << 20,
+		StackSize: 8 << 20,
+	}
+}
+
+// WithDefaults fills the zero limits of r from defaults. Core dumps are
+// allowed when either allows them.
+func (r Rlimits) WithDefaults(defaults Rlimits) Rlimits {
+	r.CoreDumps = r.CoreDumps || defaults.CoreDumps
+	if r.OpenFiles == 0 {
+		r.OpenFiles = defaults.OpenFiles
+	}
+	if r.FileSize == 0 {
+		r.FileSize = defaults.FileSize
+	}
+	if r.StackSize == 0 {
+		r.StackSize = defaults.StackSize
+	}
+	return r
+}
+
+// CoreSize returns the core dump limit in bytes
+func (r Rlimits) CoreSize() uint64 {
+	if !r.CoreDumps {
+		return 0
+	}
+	return r.FileSize
+}
+
+// Validate checks the limits against MaxRlimits
+func (r Rlimits) Validate() error {
+	if r.OpenFiles > MaxRlimits.OpenFiles {
+		return fmt.Errorf("open_files may not exceed %d", MaxRlimits.OpenFiles)
+	}
+	if r.FileSize > MaxRlimits.FileSize {
+		return fmt.Errorf("file_size may not exceed %d bytes", MaxRlimits.FileSize)
+	}
+	if r.StackSize > MaxRlimits.StackSize {
+		return fmt.Errorf("stack_size may not exceed %d bytes", MaxRlimits.StackSize)
+	}
+	return nil
+}
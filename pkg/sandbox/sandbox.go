@@ -11,6 +11,171 @@ type ExecutionResult struct {
 	Stderr   string
 	ExitCode int
 	Duration time.Duration
+
+	// OutputOmitted counts the bytes dropped from the middle of output
+	// beyond the output limits
+	OutputOmitted int64 `json:",omitempty"`
+
+	// StdoutEncoding and StderrEncoding are EncodingBase64 when the output
+	// is not text and Stdout or Stderr hold it base64 encoded; see
+	// EncodeOutput
+	StdoutEncoding string `json:",omitempty"`
+	StderrEncoding string `json:",omitempty"`
+
+	// Artifacts are additional files produced by the execution
+	Artifacts []Artifact `json:",omitempty"`
+
+	// Workspace lists the files the program changed in its workspace
+	Workspace *WorkspaceDiff `json:",omitempty"`
+
+	// Network describes the network of executions with network access
+	Network *NetworkReport `json:",omitempty"`
+
+	// Diagnostics are the compiler errors and warnings parsed from the
+	// output of compiled languages
+	Diagnostics []Diagnostic `json:",omitempty"`
+
+	// Image is the container image the execution ran in and ImageDigest
+	// the ID it resolved to, for executors that run containers
+	Image       string `json:",omitempty"`
+	ImageDigest string `json:",omitempty"`
+
+	// Profile is the resource usage of profiled executions
+	Profile *Profile `json:",omitempty"`
+
+	// Coverage is how much of the program ran, in coverage mode
+	Coverage *Coverage `json:",omitempty"`
+}
+
+// Coverage is the code coverage of an execution
+type Coverage struct {
+	// Percent is the percentage of statements that ran
+	Percent float64 `json:"percent"`
+
+	// Tool names the coverage tool, such as coverage.py
+	Tool string `json:"tool"`
+
+	// Report names the artifact holding the detailed report
+	Report string `json:"report,omitempty"`
+
+	// Error explains why coverage could not be collected
+	Error string `json:"error,omitempty"`
+}
+
+// Profile is the memory and CPU use of an execution
+type Profile struct {
+	// PeakRSS is the maximum resident set size in bytes
+	PeakRSS int64 `json:"peak_rss_bytes"`
+
+	// CPUPercent is CPU time as a percentage of wall time; programs using
+	// several cores exceed 100
+	CPUPercent float64 `json:"cpu_percent"`
+
+	UserTime        float64 `json:"user_seconds"`
+	SystemTime      float64 `json:"system_seconds"`
+	MajorPageFaults int64   `json:"major_page_faults"`
+	ContextSwitches int64   `json:"context_switches"`
+
+	// Source is "time" when GNU time measured the program and "rusage"
+	// when the kernel's accounting of the child process was used
+	Source string `json:"source"`
+}
+
+// Diagnostic is one compiler error or warning
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+
+	// Severity is error, warning, or note
+	Severity string `json:"severity"`
+
+	// Code is the compiler's identifier for the diagnostic, such as E0425
+	Code string `json:"code,omitempty"`
+}
+
+// NetworkReport describes the network an execution ran with and the DNS
+// queries it made
+type NetworkReport struct {
+	Mode string `json:"mode"`
+	DNS  string `json:"dns"`
+
+	// Queries are logged when the execution used the ForgeAI resolver
+	Queries []DNSQuery `json:"queries,omitempty"`
+}
+
+// DNSQuery is one DNS question asked by an execution
+type DNSQuery struct {
+	Time    time.Time `json:"time"`
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Allowed bool      `json:"allowed"`
+}
+
+// WorkspaceDiff lists the files created, modified, and deleted in the
+// execution workspace
+type WorkspaceDiff struct {
+	Created  []FileChange `json:"created"`
+	Modified []FileChange `json:"modified"`
+	Deleted  []FileChange `json:"deleted"`
+}
+
+// FileChange describes a workspace file. Deleted files carry their size and
+// hash from before the execution.
+type FileChange struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	// Data holds the contents of small created or modified files when
+	// inlining is enabled; it is base64-encoded in JSON
+	Data []byte `json:"data,omitempty"`
+}
+
+// Artifact is a named file attached to an execution result
+type Artifact struct {
+	Name        string
+	ContentType string
+	Data        []byte
+
+	// Key and Size locate the artifact once it has been moved to object
+	// storage, after which Data is empty
+	Key  string `json:",omitempty"`
+	Size int64  `json:",omitempty"`
+}
+
+// Len returns the size of the artifact in bytes
+func (a *Artifact) Len() int64 {
+	if a.Key != "" {
+		return a.Size
+	}
+	return int64(len(a.Data))
+}
+
+// Artifact returns the artifact with the given name
+func (r *ExecutionResult) Artifact(name string) (*Artifact, bool) {
+	for i := range r.Artifacts {
+		if r.Artifacts[i].Name == name {
+			return &r.Artifacts[i], true
+		}
+	}
+	return nil, false
+}
+
+// FixturesDir is where containers see fixtures. Programs find the fixture
+// directory of any backend in the FORGEAI_FIXTURES environment variable.
+const FixturesDir = "/fixtures"
+
+// VolumeDir is where containers see a job's persistent volume. Programs
+// find the volume of any backend in the FORGEAI_VOLUME environment variable.
+const VolumeDir = "/volume"
+
+// Fixture is a host file made available read-only to a program under its
+// name in the fixture directory
+type Fixture struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
 }
 
 // Executor defines the interface for executing code in a sandbox
@@ -23,4 +188,7 @@ type Executor interface {
 
 	// SupportedLanguages returns a list of supported languages
 	SupportedLanguages() []string
-}
\ No newline at end of file
+
+	// Capabilities reports the guarantees the executor provides on this host
+	Capabilities() Capabilities
+}
@@ -0,0 +1,444 @@
+package sandboxtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDockerEnv holds the socket of the FakeDocker that the docker shim
+// forwards commands to
+const fakeDockerEnv = "FORGEAI_FAKE_DOCKER"
+
+// The test binary acts as the docker client when it runs as the docker
+// shim installed by NewFakeDocker
+func init() {
+	socket := os.Getenv(fakeDockerEnv)
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	if socket != "" && name == "docker" {
+		os.Exit(runShim(socket, os.Args[1:]))
+	}
+}
+
+// shimRequest is a docker command forwarded by the shim
+type shimRequest struct {
+	Args  []string
+	Stdin []byte
+}
+
+// shimResponse is the outcome of a docker command
+type shimResponse struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// runShim forwards a docker command to the FakeDocker listening on socket
+// and returns the command's exit code
+func runShim(socket string, args []string) int {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fake docker: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	stdin, _ := io.ReadAll(os.Stdin)
+	if err := json.NewEncoder(conn).Encode(shimRequest{Args: args, Stdin: stdin}); err != nil {
+		fmt.Fprintf(os.Stderr, "fake docker: %v\n", err)
+		return 1
+	}
+	var resp shimResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		fmt.Fprintf(os.Stderr, "fake docker: %v\n", err)
+		return 1
+	}
+	os.Stdout.WriteString(resp.Stdout)
+	os.Stderr.WriteString(resp.Stderr)
+	return resp.ExitCode
+}
+
+// FakeContainer is a container started with docker run
+type FakeContainer struct {
+	Name  string
+	Image string
+
+	// Command is the command run in the container
+	Command []string
+
+	// Args are the docker run options before the image
+	Args []string
+
+	Labels map[string]string
+
+	// Stdin is what the client sent to the container
+	Stdin []byte
+
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Stopped is closed when docker stop is called on the container
+func (c *FakeContainer) Stopped() <-chan struct{} {
+	return c.stopped
+}
+
+// HasArg reports whether the docker run options include arg, such as
+// --read-only or --network=none
+func (c *FakeContainer) HasArg(arg string) bool {
+	for i, a := range c.Args {
+		if a == arg || (i > 0 && c.Args[i-1]+"="+a == arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// FakeResult is the outcome of a fake container
+type FakeResult struct {
+	// Output is what the container prints; docker run combines stdout and
+	// stderr
+	Output   string
+	ExitCode int
+
+	// Delay is how long the container runs. Containers stopped first exit
+	// with 143, as programs do on the SIGTERM of docker stop.
+	Delay time.Duration
+}
+
+// FakeDocker stands in for the docker daemon and client in tests. It puts
+// a docker command on PATH that forwards to the FakeDocker in the test
+// process, which keeps images and containers in memory and runs containers
+// with Run. Executors using the local daemon work against it unchanged.
+//
+// Commands other than version, info, image inspect, pull, run, stop, and
+// rm succeed without output. The fake needs a Unix system and must not be
+// used by parallel tests, since it changes PATH.
+type FakeDocker struct {
+	// Run returns the outcome of a container; containers print nothing and
+	// exit with 0 when it is nil
+	Run func(c *FakeContainer) FakeResult
+
+	// Arch is the architecture of the daemon and its images; runtime.GOARCH
+	// when empty
+	Arch string
+
+	// SecurityOptions are reported by docker info; a rootful daemon with
+	// seccomp when nil
+	SecurityOptions []string
+
+	mu         sync.Mutex
+	images     map[string]bool
+	containers map[string]*FakeContainer
+	runs       []*FakeContainer
+	calls      [][]string
+	listener   net.Listener
+}
+
+// NewFakeDocker installs a fake docker for the rest of the test, with the
+// given images present
+func NewFakeDocker(t testing.TB, images ...string) *FakeDocker {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake docker needs Unix sockets and symlinks")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("fake docker: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.Symlink(exe, filepath.Join(dir, "docker")); err != nil {
+		t.Fatalf("fake docker: %v", err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, "docker.sock"))
+	if err != nil {
+		t.Fatalf("fake docker: %v", err)
+	}
+
+	f := &FakeDocker{
+		images:     make(map[string]bool),
+		containers: make(map[string]*FakeContainer),
+		listener:   listener,
+	}
+	for _, image := range images {
+		f.images[image] = true
+	}
+	go f.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	t.Setenv(fakeDockerEnv, listener.Addr().String())
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("DOCKER_HOST", "")
+	return f
+}
+
+// AddImage makes an image present, as if it had been pulled
+func (f *FakeDocker) AddImage(image string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images[image] = true
+}
+
+// Images returns the images present, sorted
+func (f *FakeDocker) Images() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	images := make([]string, 0, len(f.images))
+	for image := range f.images {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// Containers returns the containers run so far, oldest first
+func (f *FakeDocker) Containers() []*FakeContainer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*FakeContainer(nil), f.runs...)
+}
+
+// Calls returns the arguments of the docker commands so far, without
+// global options such as --host
+func (f *FakeDocker) Calls() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]string(nil), f.calls...)
+}
+
+// serve answers the commands forwarded by shims until the listener closes
+func (f *FakeDocker) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			var req shimRequest
+			if err := json.NewDecoder(conn).Decode(&req); err != nil {
+				return
+			}
+			json.NewEncoder(conn).Encode(f.handle(req))
+		}()
+	}
+}
+
+// globalValueFlags are docker client options that take a value
+var globalValueFlags = map[string]bool{
+	"--host": true, "-H": true, "--config": true, "--context": true, "-c": true,
+	"--log-level": true, "-l": true, "--tlscacert": true, "--tlscert": true, "--tlskey": true,
+}
+
+// handle runs one docker command
+func (f *FakeDocker) handle(req shimRequest) shimResponse {
+	args := req.Args
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && args[0] != "--version" {
+		if globalValueFlags[args[0]] && len(args) > 1 {
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+
+	f.mu.Lock()
+	f.calls = append(f.calls, args)
+	f.mu.Unlock()
+
+	if len(args) == 0 {
+		return shimResponse{Stderr: "usage: docker COMMAND\n", ExitCode: 1}
+	}
+	switch args[0] {
+	case "--version":
+		return shimResponse{Stdout: "Docker version 0.0.0-fake\n"}
+	case "version":
+		if formatArg(args) == "{{.Server.Arch}}" {
+			return shimResponse{Stdout: f.arch() + "\n"}
+		}
+		return shimResponse{Stdout: "Server: fake\n Arch: " + f.arch() + "\n"}
+	case "info":
+		options := f.SecurityOptions
+		if options == nil {
+			options = []string{"name=seccomp,profile=builtin"}
+		}
+		data, _ := json.Marshal(options)
+		return shimResponse{Stdout: string(data) + "\n"}
+	case "image":
+		if len(args) > 1 && args[1] == "inspect" {
+			return f.inspectImage(args[2:])
+		}
+	case "pull":
+		f.AddImage(lastArg(args))
+		// Two layers, reported as docker does without a terminal
+		return shimResponse{Stdout: "latest: Pulling from " + lastArg(args) + "\n" +
+			"0a1b2c3d4e5f: Pulling fs layer\n6a7b8c9d0e1f: Pulling fs layer\n" +
+			"0a1b2c3d4e5f: Pull complete\n6a7b8c9d0e1f: Pull complete\n" +
+			"Status: Downloaded newer image for " + lastArg(args) + "\n"}
+	case "run":
+		return f.run(args[1:], req.Stdin)
+	case "stop", "rm":
+		return f.stop(args[1:])
+	}
+	return shimResponse{}
+}
+
+func (f *FakeDocker) arch() string {
+	if f.Arch != "" {
+		return f.Arch
+	}
+	return runtime.GOARCH
+}
+
+// inspectImage answers docker image inspect --format {{.Architecture}}
+// and {{.Id}}, for images named by name or ID. Image IDs are the SHA-256 of
+// the image name.
+func (f *FakeDocker) inspectImage(args []string) shimResponse {
+	image := lastArg(args)
+	f.mu.Lock()
+	name, present := f.resolve(image)
+	f.mu.Unlock()
+	if !present {
+		return shimResponse{Stderr: "Error: No such image: " + image + "\n", ExitCode: 1}
+	}
+	if strings.Contains(strings.Join(args, " "), "{{.Id}}") {
+		return shimResponse{Stdout: FakeImageID(name) + "\n"}
+	}
+	return shimResponse{Stdout: f.arch() + "\n"}
+}
+
+// resolve returns the name of a present image named by name or ID. The
+// caller must hold f.mu.
+func (f *FakeDocker) resolve(image string) (string, bool) {
+	if f.images[image] {
+		return image, true
+	}
+	for name := range f.images {
+		if FakeImageID(name) == image {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// FakeImageID returns the ID a FakeDocker reports for an image
+func FakeImageID(image string) string {
+	sum := sha256.Sum256([]byte(image))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// runBoolFlags are docker run options without a value
+var runBoolFlags = map[string]bool{
+	"--rm": true, "-i": true, "--interactive": true, "-t": true, "--tty": true, "-it": true,
+	"--init": true, "--read-only": true, "-d": true, "--detach": true, "--privileged": true,
+	"-P": true, "--publish-all": true, "--no-healthcheck": true, "--oom-kill-disable": true,
+}
+
+// run starts a container and waits for its result
+func (f *FakeDocker) run(args []string, stdin []byte) shimResponse {
+	c := &FakeContainer{Labels: make(map[string]string), Stdin: stdin, stopped: make(chan struct{})}
+
+	i := 0
+	for i < len(args) && strings.HasPrefix(args[i], "-") {
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue && !runBoolFlags[flag] && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		switch flag {
+		case "--name":
+			c.Name = value
+		case "--label", "-l":
+			key, v, _ := strings.Cut(value, "=")
+			c.Labels[key] = v
+		}
+		i++
+	}
+	c.Args = args[:i]
+	if i == len(args) {
+		return shimResponse{Stderr: "docker: 'docker run' requires at least 1 argument.\n", ExitCode: 125}
+	}
+	c.Image = args[i]
+	c.Command = args[i+1:]
+
+	f.mu.Lock()
+	if _, ok := f.resolve(c.Image); !ok {
+		f.images[c.Image] = true
+	}
+	f.runs = append(f.runs, c)
+	if c.Name != "" {
+		f.containers[c.Name] = c
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.containers, c.Name)
+		f.mu.Unlock()
+	}()
+
+	var result FakeResult
+	if f.Run != nil {
+		result = f.Run(c)
+	}
+	if result.Delay > 0 {
+		timer := time.NewTimer(result.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.stopped:
+			return shimResponse{Stdout: result.Output, ExitCode: 143}
+		}
+	}
+	return shimResponse{Stdout: result.Output, ExitCode: result.ExitCode}
+}
+
+// stop stops running containers by name
+func (f *FakeDocker) stop(args []string) shimResponse {
+	var resp shimResponse
+	for i := 0; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "-") {
+			if (args[i] == "-t" || args[i] == "--time" || args[i] == "-s" || args[i] == "--signal") && i+1 < len(args) {
+				i++
+			}
+			continue
+		}
+		f.mu.Lock()
+		c, ok := f.containers[args[i]]
+		f.mu.Unlock()
+		if !ok {
+			resp.Stderr += "Error response from daemon: No such container: " + args[i] + "\n"
+			resp.ExitCode = 1
+			continue
+		}
+		c.once.Do(func() { close(c.stopped) })
+		resp.Stdout += args[i] + "\n"
+	}
+	return resp
+}
+
+// formatArg returns the value of the --format option
+func formatArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--format" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(arg, "--format=") {
+			return strings.TrimPrefix(arg, "--format=")
+		}
+	}
+	return ""
+}
+
+func lastArg(args []string) string {
+	return args[len(args)-1]
+}
@@ -0,0 +1,208 @@
+// Package sandboxtest provides fakes for testing code that runs programs
+// through ForgeAI without real interpreters or Docker: a scriptable
+// executor and an in-process stand-in for the docker daemon.
+package sandboxtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/sandbox"
+)
+
+// Response is the canned outcome of an execution
+type Response struct {
+	// Result is returned as a copy; an empty result with exit code 0 is
+	// returned when nil
+	Result *sandbox.ExecutionResult
+
+	// Err fails the execution instead
+	Err error
+
+	// Delay is how long the execution takes. Executions whose context ends
+	// first time out like real executors, or fail with the context's error
+	// when cancelled.
+	Delay time.Duration
+}
+
+// Call records one execution
+type Call struct {
+	Language string
+	Code     string
+	Time     time.Time
+}
+
+// rule answers the executions match accepts
+type rule struct {
+	match    func(language, code string) bool
+	response Response
+	times    int
+}
+
+// FakeExecutor is a sandbox.Executor that answers executions with canned
+// responses and records them. Rules are tried in the order they were added,
+// and executions no rule matches get Default. It is safe for concurrent
+// use.
+type FakeExecutor struct {
+	// Languages are the supported languages; python, go, and javascript
+	// when empty
+	Languages []string
+
+	// Caps is reported by Capabilities, with the backend "fake" when it has
+	// none
+	Caps sandbox.Capabilities
+
+	// Default answers executions that no rule matches
+	Default Response
+
+	mu    sync.Mutex
+	rules []*rule
+	calls []Call
+}
+
+// NewFakeExecutor creates a fake executor whose executions succeed without
+// output until rules are added
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{}
+}
+
+// On answers executions of language whose code contains substr with
+// response. An empty language or substr matches any.
+func (f *FakeExecutor) On(language, substr string, response Response) *FakeExecutor {
+	return f.OnFunc(func(l, code string) bool {
+		return (language == "" || l == language) && strings.Contains(code, substr)
+	}, response)
+}
+
+// OnFunc answers the executions match accepts with response
+func (f *FakeExecutor) OnFunc(match func(language, code string) bool, response Response) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, &rule{match: match, response: response})
+	return f
+}
+
+// Times limits the rule added last to n executions, after which later
+// rules and Default apply, to script sequences such as a failure followed
+// by a success
+func (f *FakeExecutor) Times(n int) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.rules) > 0 {
+		f.rules[len(f.rules)-1].times = n
+	}
+	return f
+}
+
+// Calls returns the executions so far, oldest first
+func (f *FakeExecutor) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// respond records an execution and returns its response
+func (f *FakeExecutor) respond(language, code string) Response {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, Call{Language: language, Code: code, Time: time.Now()})
+	for i, r := range f.rules {
+		if !r.match(language, code) {
+			continue
+		}
+		if r.times > 0 {
+			r.times--
+			if r.times == 0 {
+				f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			}
+		}
+		return r.response
+	}
+	return f.Default
+}
+
+// Execute answers an execution with the first matching response
+func (f *FakeExecutor) Execute(ctx context.Context, language, code string) (*sandbox.ExecutionResult, error) {
+	if !f.supports(language) {
+		return nil, fmt.Errorf("unsupported language: %s", language)
+	}
+	response := f.respond(language, code)
+	start := time.Now()
+
+	if response.Delay > 0 {
+		timer := time.NewTimer(response.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return &sandbox.ExecutionResult{Stderr: "Execution timed out", ExitCode: -1, Duration: time.Since(start)}, nil
+			}
+			return nil, ctx.Err()
+		}
+	}
+
+	if response.Err != nil {
+		return nil, response.Err
+	}
+	result := sandbox.ExecutionResult{}
+	if response.Result != nil {
+		result = *response.Result
+	}
+	if result.Duration == 0 {
+		result.Duration = time.Since(start)
+	}
+	return &result, nil
+}
+
+// ExecuteFile executes the code in a file, with the language of its
+// extension
+func (f *FakeExecutor) ExecuteFile(ctx context.Context, filePath string) (*sandbox.ExecutionResult, error) {
+	code, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	language := "unknown"
+	switch filepath.Ext(filePath) {
+	case ".py":
+		language = "python"
+	case ".go":
+		language = "go"
+	case ".js":
+		language = "javascript"
+	}
+	return f.Execute(ctx, language, string(code))
+}
+
+// SupportedLanguages returns the languages the fake accepts
+func (f *FakeExecutor) SupportedLanguages() []string {
+	if len(f.Languages) == 0 {
+		return []string{"python", "go", "javascript"}
+	}
+	return f.Languages
+}
+
+// Capabilities returns Caps
+func (f *FakeExecutor) Capabilities() sandbox.Capabilities {
+	caps := f.Caps
+	if caps.Backend == "" {
+		caps.Backend = "fake"
+	}
+	return caps
+}
+
+func (f *FakeExecutor) supports(language string) bool {
+	for _, supported := range f.SupportedLanguages() {
+		if supported == language {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,333 @@
+// Package sbom generates and indexes software bills of materials for plugin
+// binaries and language images, so that incident responders can find which
+// sandbox components contain a given library.
+package sbom
+
+import (
+	"context"
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/offline"
+)
+
+// Subject kinds
+const (
+	KindPlugin = "plugin"
+	KindImage  = "image"
+)
+
+// Output formats
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx"
+)
+
+// Component is a package contained in a subject
+type Component struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Type    string `json:"type"`
+	PURL    string `json:"purl,omitempty"`
+}
+
+// Document is the SBOM of a plugin binary or container image
+type Document struct {
+	Kind        string      `json:"kind"`
+	Subject     string      `json:"subject"`
+	Source      string      `json:"source"`
+	GeneratedAt time.Time   `json:"generated_at"`
+	Components  []Component `json:"components"`
+}
+
+// Generator produces SBOM documents
+type Generator interface {
+	Generate(ctx context.Context, kind, subject, target string) (*Document, error)
+}
+
+// GoBinaryGenerator reads module information embedded in Go binaries
+type GoBinaryGenerator struct{}
+
+// Generate builds a document from the build info of a Go binary
+func (g *GoBinaryGenerator) Generate(ctx context.Context, kind, subject, target string) (*Document, error) {
+	info, err := buildinfo.ReadFile(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build info: %w", err)
+	}
+
+	doc := &Document{
+		Kind:        kind,
+		Subject:     subject,
+		Source:      "go-buildinfo",
+		GeneratedAt: time.Now().UTC(),
+		Components: []Component{{
+			Name:    "stdlib",
+			Version: info.GoVersion,
+			Type:    "library",
+			PURL:    fmt.Sprintf("pkg:golang/stdlib@%s", strings.TrimPrefix(info.GoVersion, "go")),
+		}},
+	}
+
+	if info.Main.Path != "" {
+		doc.Components = append(doc.Components, goComponent(info.Main.Path, info.Main.Version, "application"))
+	}
+	for _, dep := range info.Deps {
+		mod := dep
+		if dep.Replace != nil {
+			mod = dep.Replace
+		}
+		doc.Components = append(doc.Components, goComponent(mod.Path, mod.Version, "library"))
+	}
+
+	return doc, nil
+}
+
+func goComponent(path, version, kind string) Component {
+	return Component{
+		Name:    path,
+		Version: version,
+		Type:    kind,
+		PURL:    fmt.Sprintf("pkg:golang/%s@%s", path, version),
+	}
+}
+
+// SyftGenerator generates SBOMs for images and arbitrary binaries with syft
+type SyftGenerator struct {
+	Binary string
+}
+
+// Generate runs syft against the target and normalizes its CycloneDX output
+func (g *SyftGenerator) Generate(ctx context.Context, kind, subject, target string) (*Document, error) {
+	binary := g.Binary
+	if binary == "" {
+		binary = "syft"
+	}
+	if _, err := exec.LookPath(binary); err != nil {
+		return nil, fmt.Errorf("syft is not installed")
+	}
+
+	source := target
+	if kind == KindPlugin {
+		source = "file:" + target
+	}
+
+	cmd := exec.CommandContext(ctx, binary, source, "-o", "cyclonedx-json", "-q")
+	if offline.Enabled() {
+		// Read images from the local daemon rather than their registry
+		if kind != KindPlugin {
+			cmd.Args[1] = "docker:" + target
+		}
+		cmd.Env = append(os.Environ(), "SYFT_CHECK_FOR_APP_UPDATE=false")
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("syft failed for %s: %w", target, err)
+	}
+
+	return ParseCycloneDX(kind, subject, output)
+}
+
+// ParseCycloneDX converts a CycloneDX JSON document into a Document
+func ParseCycloneDX(kind, subject string, data []byte) (*Document, error) {
+	var parsed struct {
+		Components []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+			Type    string `json:"type"`
+			PURL    string `json:"purl"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse CycloneDX document: %w", err)
+	}
+
+	doc := &Document{
+		Kind:        kind,
+		Subject:     subject,
+		Source:      "cyclonedx",
+		GeneratedAt: time.Now().UTC(),
+		Components:  make([]Component, 0, len(parsed.Components)),
+	}
+	for _, c := range parsed.Components {
+		doc.Components = append(doc.Components, Component{Name: c.Name, Version: c.Version, Type: c.Type, PURL: c.PURL})
+	}
+
+	return doc, nil
+}
+
+// CycloneDX renders the document as CycloneDX 1.5 JSON
+func (d *Document) CycloneDX() ([]byte, error) {
+	components := make([]map[string]string, 0, len(d.Components))
+	for _, c := range d.Components {
+		components = append(components, map[string]string{
+			"type":    c.Type,
+			"name":    c.Name,
+			"version": c.Version,
+			"purl":    c.PURL,
+		})
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.5",
+		"version":     1,
+		"metadata": map[string]interface{}{
+			"timestamp": d.GeneratedAt.Format(time.RFC3339),
+			"component": map[string]string{"type": subjectType(d.Kind), "name": d.Subject},
+		},
+		"components": components,
+	}, "", "  ")
+}
+
+// SPDX renders the document as SPDX 2.3 JSON
+func (d *Document) SPDX() ([]byte, error) {
+	packages := make([]map[string]interface{}, 0, len(d.Components))
+	for i, c := range d.Components {
+		pkg := map[string]interface{}{
+			"SPDXID":           fmt.Sprintf("SPDXRef-Package-%d", i+1),
+			"name":             c.Name,
+			"versionInfo":      c.Version,
+			"downloadLocation": "NOASSERTION",
+		}
+		if c.PURL != "" {
+			pkg["externalRefs"] = []map[string]string{{
+				"referenceCategory": "PACKAGE-MANAGER",
+				"referenceType":     "purl",
+				"referenceLocator":  c.PURL,
+			}}
+		}
+		packages = append(packages, pkg)
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              fmt.Sprintf("%s-%s", d.Kind, d.Subject),
+		"documentNamespace": fmt.Sprintf("https://forgeai.dev/sbom/%s/%s-%d", d.Kind, d.Subject, d.GeneratedAt.Unix()),
+		"creationInfo": map[string]interface{}{
+			"created":  d.GeneratedAt.Format(time.RFC3339),
+			"creators": []string{"Tool: forgeai"},
+		},
+		"packages": packages,
+	}, "", "  ")
+}
+
+func subjectType(kind string) string {
+	if kind == KindImage {
+		return "container"
+	}
+	return "application"
+}
+
+// Match is a component found by a search
+type Match struct {
+	Kind      string    `json:"kind"`
+	Subject   string    `json:"subject"`
+	Component Component `json:"component"`
+}
+
+// Store holds SBOM documents and answers component queries
+type Store struct {
+	docs map[string]*Document
+	mu   sync.RWMutex
+}
+
+// NewStore creates an empty store
+func NewStore() *Store {
+	return &Store{
+		docs: make(map[string]*Document),
+	}
+}
+
+// Put adds or replaces a document
+func (s *Store) Put(doc *Document) {
+	s.mu.Lock()
+	s.docs[doc.Kind+"/"+doc.Subject] = doc
+	s.mu.Unlock()
+}
+
+// Get returns the document for a subject
+func (s *Store) Get(kind, subject string) (*Document, bool) {
+	s.mu.RLock()
+	doc, ok := s.docs[kind+"/"+subject]
+	s.mu.RUnlock()
+	return doc, ok
+}
+
+// List returns all documents sorted by kind and subject
+func (s *Store) List() []*Document {
+	s.mu.RLock()
+	docs := make([]*Document, 0, len(s.docs))
+	for _, doc := range s.docs {
+		docs = append(docs, doc)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Kind != docs[j].Kind {
+			return docs[i].Kind < docs[j].Kind
+		}
+		return docs[i].Subject < docs[j].Subject
+	})
+	return docs
+}
+
+// FindComponent returns every component whose name or purl contains query
+func (s *Store) FindComponent(query string) []Match {
+	query = strings.ToLower(query)
+
+	var matches []Match
+	for _, doc := range s.List() {
+		for _, c := range doc.Components {
+			if strings.Contains(strings.ToLower(c.Name), query) || strings.Contains(strings.ToLower(c.PURL), query) {
+				matches = append(matches, Match{Kind: doc.Kind, Subject: doc.Subject, Component: c})
+			}
+		}
+	}
+	return matches
+}
+
+// PluginSBOM returns the SBOM for an installed plugin. A CycloneDX document
+// shipped in the plugin directory (sbom.cdx.json) is preferred; otherwise the
+// binary is inspected.
+func PluginSBOM(ctx context.Context, pluginDir, name string) (*Document, error) {
+	attached := filepath.Join(pluginDir, "sbom.cdx.json")
+	if data, err := os.ReadFile(attached); err == nil {
+		return ParseCycloneDX(KindPlugin, name, data)
+	}
+
+	binaryPath := filepath.Join(pluginDir, name)
+	if _, err := os.Stat(binaryPath); os.IsNotExist(err) {
+		binaryPath += ".exe"
+	}
+
+	doc, err := (&GoBinaryGenerator{}).Generate(ctx, KindPlugin, name, binaryPath)
+	if err == nil {
+		return doc, nil
+	}
+
+	return (&SyftGenerator{}).Generate(ctx, KindPlugin, name, binaryPath)
+}
+
+// ImageSBOM returns the SBOM for a container image
+func ImageSBOM(ctx context.Context, image string) (*Document, error) {
+	return (&SyftGenerator{}).Generate(ctx, KindImage, image, image)
+}
+
+// WriteAttachment saves the document next to an installed plugin
+func WriteAttachment(pluginDir string, doc *Document) error {
+	data, err := doc.CycloneDX()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(pluginDir, "sbom.cdx.json"), data, 0644)
+}
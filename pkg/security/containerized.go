@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"time"
 
+	"forgeai/pkg/container"
 	"forgeai/pkg/sandbox"
 )
 
@@ -18,6 +19,18 @@ type ContainerizedExecutor struct {
 	MemoryLimit int
 	EnableNetwork bool
 	ReadOnlyRoot bool
+
+	// CapAdd lists the Linux capabilities that containers keep; all others
+	// are dropped
+	CapAdd []string
+
+	// StopGrace is how long programs get to exit after SIGTERM before they
+	// are killed; container.DefaultStopGrace when zero
+	StopGrace time.Duration
+
+	// Output bounds the output held in memory; zero limits use
+	// sandbox.DefaultOutputLimits
+	Output sandbox.OutputLimits
 }
 
 // NewContainerizedExecutor creates a new containerized executor
@@ -45,6 +58,14 @@ func (ce *ContainerizedExecutor) Execute(ctx context.Context, language, code str
 		return nil, fmt.Errorf("failed to write code to file: %w", err)
 	}
 
+	// Let the sandbox user read the mounted directory
+	if ce.isDockerAvailable() {
+		mapping := ce.userMapping(ctx)
+		if err := container.PrepareWorkspace(tempDir, mapping, mapping.SandboxUID(), false); err != nil {
+			return nil, err
+		}
+	}
+
 	// Execute the file with containerized security controls
 	return ce.ExecuteFile(ctx, filePath)
 }
@@ -80,6 +101,14 @@ func (ce *ContainerizedExecutor) executeWithDocker(ctx context.Context, language
 		"-w", "/workspace",
 	}
 	
+	// Label the container so that the reaper can remove it if it outlives us
+	name, managedArgs, done := container.ManagedContainer("", "")
+	defer done()
+	cmdArgs = append(cmdArgs, managedArgs...)
+	
+	// Run an init process that forwards signals and reaps zombies
+	cmdArgs = append(cmdArgs, "--init")
+	
 	// Add resource limits
 	if ce.MemoryLimit > 0 {
 		cmdArgs = append(cmdArgs, "--memory", fmt.Sprintf("%dm", ce.MemoryLimit))
@@ -100,8 +129,13 @@ func (ce *ContainerizedExecutor) executeWithDocker(ctx context.Context, language
 		cmdArgs = append(cmdArgs, "--network", "none")
 	}
 	
-	// Run as non-root user
-	cmdArgs = append(cmdArgs, "--user", "65534:65534") // nobody user
+	// Drop capabilities and forbid gaining privileges
+	cmdArgs = append(cmdArgs, container.PrivilegeArgs(ce.CapAdd)...)
+	
+	// Run as non-root user: nobody, or root of a rootless daemon, which is
+	// the unprivileged user running the daemon
+	uid := ce.userMapping(ctx).SandboxUID()
+	cmdArgs = append(cmdArgs, "--user", fmt.Sprintf("%d:%d", uid, uid))
 	
 	// Add the image and command
 	cmdArgs = append(cmdArgs, image)
@@ -125,8 +159,12 @@ func (ce *ContainerizedExecutor) executeWithDocker(ctx context.Context, language
 		defer cancel()
 	}
 	
-	// Create the command
-	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	// Create the command. Cancellation stops the container gracefully
+	// instead of killing the client.
+	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	output := ce.Output.NewBuffer()
+	cmd.Stdout = output
+	cmd.Stderr = output
 	
 	// Capture output
 	result := &sandbox.ExecutionResult{
@@ -137,10 +175,11 @@ func (ce *ContainerizedExecutor) executeWithDocker(ctx context.Context, language
 	start := time.Now()
 	
 	// Run the command
-	output, err := cmd.CombinedOutput()
+	err := container.Daemon{}.RunAttached(ctx, cmd, name, ce.StopGrace)
 	
 	result.Duration = time.Since(start)
-	result.Stdout = string(output)
+	result.Stdout = output.String()
+	result.OutputOmitted = output.Omitted()
 	
 	// Check if the context was cancelled (timeout)
 	if ctx.Err() == context.DeadlineExceeded {
@@ -209,10 +248,14 @@ func (ce *ContainerizedExecutor) executeLocally(ctx context.Context, language, f
 	start := time.Now()
 	
 	// Run the command
-	output, err := cmd.CombinedOutput()
+	output := ce.Output.NewBuffer()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err = cmd.Run()
 	
 	result.Duration = time.Since(start)
-	result.Stdout = string(output)
+	result.Stdout = output.String()
+	result.OutputOmitted = output.Omitted()
 	
 	// Check if the context was cancelled (timeout)
 	if ctx.Err() == context.DeadlineExceeded {
@@ -310,6 +353,16 @@ func (ce *ContainerizedExecutor) getImageForLanguage(language string) string {
 	}
 }
 
+// userMapping returns how the docker daemon maps container users, assuming
+// a rootful daemon when it cannot be queried
+func (ce *ContainerizedExecutor) userMapping(ctx context.Context) container.UserMapping {
+	mapping, err := container.Daemon{}.UserMapping(ctx)
+	if err != nil {
+		return container.UserMapping{Mode: container.ModeRootful, Base: -1}
+	}
+	return mapping
+}
+
 // isDockerAvailable checks if Docker is available
 func (ce *ContainerizedExecutor) isDockerAvailable() bool {
 	cmd := exec.Command("docker", "--version")
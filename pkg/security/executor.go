@@ -16,6 +16,10 @@ import (
 type SecureExecutor struct {
 	Timeout     time.Duration
 	MemoryLimit int
+
+	// Output bounds the output held in memory; zero limits use
+	// sandbox.DefaultOutputLimits
+	Output sandbox.OutputLimits
 }
 
 // NewSecureExecutor creates a new secure executor
@@ -93,10 +97,14 @@ func (se *SecureExecutor) ExecuteFile(ctx context.Context, filePath string) (*sa
 	start := time.Now()
 	
 	// Run the command
-	output, err := cmd.CombinedOutput()
+	output := se.Output.NewBuffer()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err = cmd.Run()
 	
 	result.Duration = time.Since(start)
-	result.Stdout = string(output)
+	result.Stdout = output.String()
+	result.OutputOmitted = output.Omitted()
 	
 	// Check if the context was cancelled (timeout)
 	if ctx.Err() == context.DeadlineExceeded {
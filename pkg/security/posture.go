@@ -0,0 +1,179 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"forgeai/pkg/container"
+	"forgeai/pkg/sandbox"
+)
+
+// Protection is the probed state of one protection
+type Protection struct {
+	Enabled bool   `json:"enabled"`
+	Detail  string `json:"detail"`
+}
+
+// CgroupProtection reports the cgroup limits that apply to jobs
+type CgroupProtection struct {
+	Protection
+	Limits map[string]string `json:"limits,omitempty"`
+}
+
+// Posture summarizes the protections that are actually in effect for jobs
+type Posture struct {
+	Backend          string           `json:"backend"`
+	BackendAvailable bool             `json:"backend_available"`
+	Seccomp          Protection       `json:"seccomp"`
+	AppArmor         Protection       `json:"apparmor"`
+	UserNamespaces   Protection       `json:"user_namespaces"`
+	NetworkPolicy    Protection       `json:"network_policy"`
+	ReadOnlyRoot     Protection       `json:"read_only_root"`
+	CgroupLimits     CgroupProtection `json:"cgroup_limits"`
+	PluginSignatures Protection       `json:"plugin_signatures"`
+	ProbedAt         time.Time        `json:"probed_at"`
+}
+
+// ProbePosture inspects the running host and backend. Jobs run by the local
+// backend inherit the server's own process restrictions, so those are probed
+// directly; for the docker backend the daemon's security options are queried.
+// plugins lists the installed plugins.
+func ProbePosture(ctx context.Context, caps sandbox.Capabilities, plugins []string) Posture {
+	posture := Posture{
+		Backend:          caps.Backend,
+		BackendAvailable: caps.Available,
+		ProbedAt:         time.Now().UTC(),
+	}
+
+	switch caps.Backend {
+	case "local":
+		posture.Seccomp = probeProcessSeccomp()
+		posture.AppArmor = probeProcessAppArmor()
+		posture.UserNamespaces = probeProcessUserNamespace()
+		posture.NetworkPolicy = probeHostNetwork()
+		posture.ReadOnlyRoot = probeRootReadOnly()
+		posture.CgroupLimits = probeProcessCgroup()
+	case "docker":
+		posture.Seccomp, posture.AppArmor, posture.UserNamespaces = probeDockerDaemon(ctx, caps)
+		posture.NetworkPolicy = isolationProtection(caps.NetworkIsolation && caps.Available,
+			"jobs run without a network", "jobs have network access")
+		posture.ReadOnlyRoot = isolationProtection(caps.ReadOnlyFilesystem && caps.Available,
+			"container root file systems are read-only", "container root file systems are writable")
+		posture.CgroupLimits = backendCgroup(caps)
+	default:
+		posture.Seccomp = isolationProtection(caps.SyscallFiltering && caps.Available,
+			"the backend applies a seccomp filter", "no syscall filter is applied")
+		posture.AppArmor = Protection{Detail: "the backend does not apply AppArmor profiles"}
+		posture.UserNamespaces = isolationProtection(caps.FilesystemIsolation && caps.Available,
+			"jobs run in their own namespaces", "jobs share the server's namespaces")
+		posture.NetworkPolicy = isolationProtection(caps.NetworkIsolation && caps.Available,
+			"jobs run without a network", "jobs have network access")
+		posture.ReadOnlyRoot = isolationProtection(caps.ReadOnlyFilesystem && caps.Available,
+			"system directories are mounted read-only", "the root file system is writable")
+		posture.CgroupLimits = backendCgroup(caps)
+	}
+
+	// Plugins are executed as they are found on disk
+	posture.PluginSignatures = Protection{
+		Enabled: false,
+		Detail:  fmt.Sprintf("%d installed plugins are loaded without signature verification", len(plugins)),
+	}
+
+	return posture
+}
+
+// isolationProtection reports a protection that the backend applies itself
+func isolationProtection(enabled bool, on, off string) Protection {
+	if !enabled {
+		return Protection{Detail: off}
+	}
+	return Protection{Enabled: true, Detail: on}
+}
+
+// backendCgroup reports the cgroup limits a backend applies per job
+func backendCgroup(caps sandbox.Capabilities) CgroupProtection {
+	var limits []string
+	if caps.MemoryLimit {
+		limits = append(limits, "memory")
+	}
+	if caps.CPULimit {
+		limits = append(limits, "cpu")
+	}
+	if caps.ProcessLimit {
+		limits = append(limits, "pids")
+	}
+	if len(limits) == 0 || !caps.Available {
+		return CgroupProtection{Protection: Protection{Detail: "jobs run without cgroup limits"}}
+	}
+	return CgroupProtection{Protection: Protection{
+		Enabled: true,
+		Detail:  fmt.Sprintf("the %s backend limits %s per job", caps.Backend, strings.Join(limits, ", ")),
+	}}
+}
+
+// probeHostNetwork reports the network interfaces that local jobs can use
+func probeHostNetwork() Protection {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return Protection{Detail: fmt.Sprintf("failed to list network interfaces: %v", err)}
+	}
+
+	var up []string
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagLoopback == 0 {
+			up = append(up, iface.Name)
+		}
+	}
+	if len(up) == 0 {
+		return Protection{Enabled: true, Detail: "the server has no network interfaces besides loopback"}
+	}
+	return Protection{Detail: "jobs share the host network: " + strings.Join(up, ", ")}
+}
+
+// probeDockerDaemon reads the seccomp, AppArmor, and user namespace
+// settings of the docker daemon, and reports the profiles that the backend
+// applies where the daemon supports them
+func probeDockerDaemon(ctx context.Context, caps sandbox.Capabilities) (seccomp, apparmor, userns Protection) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "docker", "info", "--format", "{{json .SecurityOptions}}").Output()
+	if err != nil {
+		detail := fmt.Sprintf("failed to query the docker daemon: %v", err)
+		return Protection{Detail: detail}, Protection{Detail: detail}, Protection{Detail: detail}
+	}
+
+	options := string(output)
+	seccomp = Protection{Detail: "the docker daemon does not apply seccomp"}
+	if strings.Contains(options, "name=seccomp") {
+		seccomp = appliedProfile("seccomp", caps.SeccompProfile)
+	}
+	apparmor = Protection{Detail: "AppArmor is not enabled on the docker host"}
+	if strings.Contains(options, "name=apparmor") {
+		apparmor = appliedProfile("AppArmor", caps.AppArmorProfile)
+	}
+	userns = Protection{Detail: "containers share the host user namespace"}
+	switch container.ParseDaemonMode(options) {
+	case container.ModeRootless:
+		userns = Protection{Enabled: true, Detail: "the docker daemon runs rootless"}
+	case container.ModeUsernsRemap:
+		userns = Protection{Enabled: true, Detail: "the docker daemon remaps container users"}
+	}
+	return seccomp, apparmor, userns
+}
+
+// appliedProfile reports the seccomp or AppArmor profile containers run
+// with
+func appliedProfile(kind, profile string) Protection {
+	switch profile {
+	case "":
+		return Protection{Enabled: true, Detail: fmt.Sprintf("the docker daemon applies its %s profile", kind)}
+	case container.ProfileUnconfined:
+		return Protection{Detail: fmt.Sprintf("containers run without a %s profile", kind)}
+	}
+	return Protection{Enabled: true, Detail: fmt.Sprintf("containers run with the %s %s profile", profile, kind)}
+}
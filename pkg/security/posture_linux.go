@@ -0,0 +1,160 @@
+package security
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// stRdonly is the statfs flag of a read-only mount
+const stRdonly = 0x1
+
+// probeProcessSeccomp reads the seccomp mode of the server process, which
+// local jobs inherit
+func probeProcessSeccomp() Protection {
+	mode, err := procStatusField("Seccomp")
+	if err != nil {
+		return Protection{Detail: fmt.Sprintf("failed to read seccomp mode: %v", err)}
+	}
+
+	switch mode {
+	case "2":
+		return Protection{Enabled: true, Detail: "jobs inherit the server's seccomp filter"}
+	case "1":
+		return Protection{Enabled: true, Detail: "the server runs in strict seccomp mode"}
+	default:
+		return Protection{Detail: "no seccomp filter applies to the server or its jobs"}
+	}
+}
+
+// probeProcessAppArmor reads the AppArmor profile confining the server
+// process, which local jobs inherit
+func probeProcessAppArmor() Protection {
+	data, err := os.ReadFile("/proc/self/attr/current")
+	if err != nil {
+		return Protection{Detail: "AppArmor is not enabled on this host"}
+	}
+
+	profile := strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+	if profile == "" || profile == "unconfined" {
+		return Protection{Detail: "no AppArmor profile confines the server or its jobs"}
+	}
+	return Protection{Enabled: true, Detail: fmt.Sprintf("jobs inherit the server's AppArmor profile %s", profile)}
+}
+
+// probeProcessUserNamespace reports whether the server runs in a user
+// namespace other than the initial one
+func probeProcessUserNamespace() Protection {
+	data, err := os.ReadFile("/proc/self/uid_map")
+	if err != nil {
+		return Protection{Detail: fmt.Sprintf("failed to read uid map: %v", err)}
+	}
+
+	// The initial namespace maps the whole ID range onto itself
+	if strings.Join(strings.Fields(string(data)), " ") == "0 0 4294967295" {
+		return Protection{Detail: "jobs run in the host user namespace"}
+	}
+	return Protection{Enabled: true, Detail: "the server and its jobs run in a user namespace"}
+}
+
+// probeRootReadOnly reports whether the root file system is mounted
+// read-only
+func probeRootReadOnly() Protection {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs("/", &fs); err != nil {
+		return Protection{Detail: fmt.Sprintf("failed to stat the root file system: %v", err)}
+	}
+	if fs.Flags&stRdonly != 0 {
+		return Protection{Enabled: true, Detail: "the root file system is mounted read-only"}
+	}
+	return Protection{Detail: "the root file system is writable"}
+}
+
+// probeProcessCgroup reads the memory, CPU, and process limits of the
+// server's cgroup, which local jobs share
+func probeProcessCgroup() CgroupProtection {
+	file, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return CgroupProtection{Protection: Protection{Detail: fmt.Sprintf("failed to read cgroup: %v", err)}}
+	}
+	defer file.Close()
+
+	limits := make(map[string]string)
+	_, statErr := os.Stat("/sys/fs/cgroup/cgroup.controllers")
+	unified := statErr == nil
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		controllers, path := parts[1], parts[2]
+
+		if controllers == "" {
+			if unified {
+				dir := filepath.Join("/sys/fs/cgroup", path)
+				readLimit(limits, "memory", filepath.Join(dir, "memory.max"))
+				readLimit(limits, "pids", filepath.Join(dir, "pids.max"))
+				readLimit(limits, "cpu", filepath.Join(dir, "cpu.max"))
+			}
+			continue
+		}
+
+		for _, controller := range strings.Split(controllers, ",") {
+			dir := filepath.Join("/sys/fs/cgroup", controller, path)
+			switch controller {
+			case "memory":
+				readLimit(limits, "memory", filepath.Join(dir, "memory.limit_in_bytes"))
+			case "pids":
+				readLimit(limits, "pids", filepath.Join(dir, "pids.max"))
+			case "cpu":
+				readLimit(limits, "cpu", filepath.Join(dir, "cpu.cfs_quota_us"))
+			}
+		}
+	}
+
+	if len(limits) == 0 {
+		return CgroupProtection{Protection: Protection{Detail: "the server's cgroup has no memory, CPU, or process limits"}}
+	}
+	return CgroupProtection{
+		Protection: Protection{Enabled: true, Detail: "jobs share the limits of the server's cgroup"},
+		Limits:     limits,
+	}
+}
+
+// readLimit records the cgroup limit in file unless it is unlimited
+func readLimit(limits map[string]string, name, file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "" || value == "-1" || strings.HasPrefix(value, "max") {
+		return
+	}
+	// cgroup v1 reports an unlimited memory cgroup as a huge page-aligned value
+	if n, err := strconv.ParseUint(value, 10, 64); err == nil && n >= 1<<62 {
+		return
+	}
+	limits[name] = value
+}
+
+// procStatusField returns a field of /proc/self/status
+func procStatusField(name string) (string, error) {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, name+":") {
+			return strings.TrimSpace(strings.TrimPrefix(line, name+":")), nil
+		}
+	}
+	return "", fmt.Errorf("%s not found", name)
+}
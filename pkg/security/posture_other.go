@@ -0,0 +1,25 @@
+//go:build !linux
+
+package security
+
+// Process restrictions can only be probed on Linux
+
+func probeProcessSeccomp() Protection {
+	return Protection{Detail: "seccomp is only available on Linux"}
+}
+
+func probeProcessAppArmor() Protection {
+	return Protection{Detail: "AppArmor is only available on Linux"}
+}
+
+func probeProcessUserNamespace() Protection {
+	return Protection{Detail: "user namespaces are only available on Linux"}
+}
+
+func probeRootReadOnly() Protection {
+	return Protection{Detail: "the root file system could not be probed on this platform"}
+}
+
+func probeProcessCgroup() CgroupProtection {
+	return CgroupProtection{Protection: Protection{Detail: "cgroups are only available on Linux"}}
+}
@@ -0,0 +1,141 @@
+package security
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultSelfTestInterval is how often the self-test runs by default
+const DefaultSelfTestInterval = time.Hour
+
+// SelfTestResult is the outcome of one test in a self-test run
+type SelfTestResult struct {
+	Name       string `json:"name"`
+	Category   string `json:"category"`
+	Passed     bool   `json:"passed"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SelfTestRun is the outcome of one self-test run
+type SelfTestRun struct {
+	StartedAt  time.Time        `json:"started_at"`
+	DurationMs int64            `json:"duration_ms"`
+	Passed     int              `json:"passed"`
+	Failed     int              `json:"failed"`
+	Results    []SelfTestResult `json:"results"`
+
+	// Regressions are tests that fail after passing in the previous run.
+	// On the first run every failing test is a regression.
+	Regressions []string `json:"regressions,omitempty"`
+}
+
+// FailedTests returns the names of the tests that failed
+func (r SelfTestRun) FailedTests() []string {
+	var failed []string
+	for _, result := range r.Results {
+		if !result.Passed {
+			failed = append(failed, result.Name)
+		}
+	}
+	return failed
+}
+
+// SelfTester periodically runs security tests against a live execution
+// backend to catch containment regressions after infrastructure changes
+type SelfTester struct {
+	Tests    []TestCase
+	Interval time.Duration
+
+	// OnRegression is called after a run with regressions
+	OnRegression func(ctx context.Context, run SelfTestRun)
+
+	mu   sync.Mutex
+	last *SelfTestRun
+}
+
+// NewSelfTester creates a self-tester that runs tests every
+// DefaultSelfTestInterval
+func NewSelfTester(tests []TestCase) *SelfTester {
+	return &SelfTester{
+		Tests:    tests,
+		Interval: DefaultSelfTestInterval,
+	}
+}
+
+// Run tests exec every Interval until ctx is done
+func (st *SelfTester) Run(ctx context.Context, exec Executor) {
+	ticker := time.NewTicker(st.Interval)
+	defer ticker.Stop()
+
+	for {
+		st.RunOnce(ctx, exec)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce runs the tests against exec once and records the result
+func (st *SelfTester) RunOnce(ctx context.Context, exec Executor) SelfTestRun {
+	run := SelfTestRun{StartedAt: time.Now().UTC()}
+	for _, report := range NewTestFrameworkFor(exec, st.Tests).RunTestsContext(ctx) {
+		result := SelfTestResult{
+			Name:       report.TestCase.Name,
+			Category:   report.TestCase.Category,
+			Passed:     report.Passed,
+			ExitCode:   report.ExitCode,
+			DurationMs: report.Duration.Milliseconds(),
+		}
+		if report.Error != nil {
+			result.Error = report.Error.Error()
+		}
+		if result.Passed {
+			run.Passed++
+		} else {
+			run.Failed++
+		}
+		run.Results = append(run.Results, result)
+	}
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+
+	// Runs cut short by shutdown are not recorded
+	if ctx.Err() != nil {
+		return run
+	}
+
+	st.mu.Lock()
+	previous := make(map[string]bool)
+	if st.last != nil {
+		for _, result := range st.last.Results {
+			previous[result.Name] = result.Passed
+		}
+	}
+	for _, result := range run.Results {
+		if passed, ok := previous[result.Name]; !result.Passed && (passed || !ok) {
+			run.Regressions = append(run.Regressions, result.Name)
+		}
+	}
+	st.last = &run
+	st.mu.Unlock()
+
+	if len(run.Regressions) > 0 && st.OnRegression != nil {
+		st.OnRegression(ctx, run)
+	}
+	return run
+}
+
+// Last returns the most recent completed run
+func (st *SelfTester) Last() (SelfTestRun, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.last == nil {
+		return SelfTestRun{}, false
+	}
+	return *st.last, true
+}
@@ -51,77 +51,150 @@ type Executor interface {
 
 // NewTestFramework creates a new security test framework
 func NewTestFramework() *TestFramework {
-	exec := NewContainerizedExecutor()
-	
+	return NewTestFrameworkFor(NewContainerizedExecutor(), DefaultTests())
+}
+
+// NewTestFrameworkFor creates a security test framework that runs tests
+// with exec
+func NewTestFrameworkFor(exec Executor, tests []TestCase) *TestFramework {
 	return &TestFramework{
 		executor: exec,
-		tests: []TestCase{
-			{
-				Name:        "CPU Exhaustion - Infinite Loop",
-				Code:        "while True: pass",
-				Language:    "python",
-				Description: "Tests CPU exhaustion through infinite loop",
-				Category:    "Resource Exhaustion",
-				ExpectedResult: TestResult{
-					ShouldBeContained: true,
-					ExpectedExitCode:  -1, // Timeout
-				},
+		tests:    tests,
+	}
+}
+
+// DefaultTests returns the built-in security tests
+func DefaultTests() []TestCase {
+	return []TestCase{
+		{
+			Name:        "CPU Exhaustion - Infinite Loop",
+			Code:        "while True: pass",
+			Language:    "python",
+			Description: "Tests CPU exhaustion through infinite loop",
+			Category:    "Resource Exhaustion",
+			ExpectedResult: TestResult{
+				ShouldBeContained: true,
+				ExpectedExitCode:  -1, // Timeout
 			},
-			{
-				Name:        "Memory Exhaustion - Large List",
-				Code:        "a = []; while True: a.append('x' * 1000000)",
-				Language:    "python",
-				Description: "Tests memory exhaustion through large list allocation",
-				Category:    "Resource Exhaustion",
-				ExpectedResult: TestResult{
-					ShouldBeContained: true,
-					ExpectedExitCode:  1, // Error
-				},
+		},
+		{
+			Name:        "Memory Exhaustion - Large List",
+			Code:        "a = []; while True: a.append('x' * 1000000)",
+			Language:    "python",
+			Description: "Tests memory exhaustion through large list allocation",
+			Category:    "Resource Exhaustion",
+			ExpectedResult: TestResult{
+				ShouldBeContained: true,
+				ExpectedExitCode:  1, // Error
 			},
-			{
-				Name:        "File System Access - Sensitive File",
-				Code:        "try:\n    with open('/etc/passwd', 'r') as f:\n        print(f.read())\nexcept:\n    print('Access denied')",
-				Language:    "python",
-				Description: "Tests file system access to sensitive files",
-				Category:    "File System Attacks",
-				ExpectedResult: TestResult{
-					ShouldBeContained: true,
-					ExpectedOutput:    "Access denied",
-				},
+		},
+		{
+			Name:        "File System Access - Sensitive File",
+			Code:        "try:\n    with open('/etc/passwd', 'r') as f:\n        print(f.read())\nexcept:\n    print('Access denied')",
+			Language:    "python",
+			Description: "Tests file system access to sensitive files",
+			Category:    "File System Attacks",
+			ExpectedResult: TestResult{
+				ShouldBeContained: true,
+				ExpectedOutput:    "Access denied",
 			},
-			{
-				Name:        "Network Access - External Connection",
-				Code:        "import socket\ntry:\n    s = socket.socket(socket.AF_INET, socket.SOCK_STREAM)\n    s.connect(('google.com', 80))\n    print('Connection successful')\n    s.close()\nexcept:\n    print('Network access denied')",
-				Language:    "python",
-				Description: "Tests network access to external sites",
-				Category:    "Network Attacks",
-				ExpectedResult: TestResult{
-					ShouldBeContained: true,
-					ExpectedOutput:    "Network access denied",
-				},
+		},
+		{
+			Name:        "Network Access - External Connection",
+			Code:        "import socket\ntry:\n    s = socket.socket(socket.AF_INET, socket.SOCK_STREAM)\n    s.connect(('google.com', 80))\n    print('Connection successful')\n    s.close()\nexcept:\n    print('Network access denied')",
+			Language:    "python",
+			Description: "Tests network access to external sites",
+			Category:    "Network Attacks",
+			ExpectedResult: TestResult{
+				ShouldBeContained: true,
+				ExpectedOutput:    "Network access denied",
+			},
+		},
+		{
+			Name:        "Capabilities - Dangerous Capabilities",
+			Code:        "names = {1: 'CAP_DAC_OVERRIDE', 6: 'CAP_SETGID', 7: 'CAP_SETUID', 12: 'CAP_NET_ADMIN', 13: 'CAP_NET_RAW', 16: 'CAP_SYS_MODULE', 19: 'CAP_SYS_PTRACE', 21: 'CAP_SYS_ADMIN', 27: 'CAP_MKNOD'}\neff = 0\nfor line in open('/proc/self/status'):\n    if line.startswith('CapEff:'):\n        eff = int(line.split()[1], 16)\nheld = [name for bit, name in sorted(names.items()) if eff & (1 << bit)]\nprint('Capabilities held: ' + ', '.join(held) if held else 'Dangerous capabilities absent')",
+			Language:    "python",
+			Description: "Tests that CAP_NET_RAW, CAP_SYS_ADMIN, and other dangerous capabilities are dropped",
+			Category:    "Privilege Escalation",
+			ExpectedResult: TestResult{
+				ShouldBeContained: true,
+				ExpectedOutput:    "Dangerous capabilities absent",
 			},
-			{
-				Name:        "Valid Code Execution",
-				Code:        "print('Hello, World!')",
-				Language:    "python",
-				Description: "Tests valid code execution",
-				Category:    "Valid Execution",
-				ExpectedResult: TestResult{
-					ShouldBeContained: false,
-					ExpectedExitCode:  0,
-					ExpectedOutput:    "Hello, World!",
-				},
+		},
+		{
+			Name:        "Capabilities - Raw Socket",
+			Code:        "import socket\ntry:\n    s = socket.socket(socket.AF_INET, socket.SOCK_RAW, socket.IPPROTO_ICMP)\n    print('Raw socket created')\n    s.close()\nexcept OSError:\n    print('Raw sockets denied')",
+			Language:    "python",
+			Description: "Tests that raw sockets cannot be opened without CAP_NET_RAW",
+			Category:    "Privilege Escalation",
+			ExpectedResult: TestResult{
+				ShouldBeContained: true,
+				ExpectedOutput:    "Raw sockets denied",
 			},
 		},
+		{
+			Name:        "No New Privileges",
+			Code:        "nnp = '0'\nfor line in open('/proc/self/status'):\n    if line.startswith('NoNewPrivs:'):\n        nnp = line.split()[1]\nprint('No new privileges' if nnp == '1' else 'Privileges can be gained')",
+			Language:    "python",
+			Description: "Tests that processes cannot gain privileges through setuid binaries",
+			Category:    "Privilege Escalation",
+			ExpectedResult: TestResult{
+				ShouldBeContained: true,
+				ExpectedOutput:    "No new privileges",
+			},
+		},
+		{
+			Name:        "Valid Code Execution",
+			Code:        "print('Hello, World!')",
+			Language:    "python",
+			Description: "Tests valid code execution",
+			Category:    "Valid Execution",
+			ExpectedResult: TestResult{
+				ShouldBeContained: false,
+				ExpectedExitCode:  0,
+				ExpectedOutput:    "Hello, World!",
+			},
+		},
+	}
+}
+
+// SelectTests returns the tests whose name or category matches one of
+// names, ignoring case. All tests are returned when names is empty.
+func SelectTests(tests []TestCase, names []string) ([]TestCase, error) {
+	if len(names) == 0 {
+		return tests, nil
+	}
+	
+	var selected []TestCase
+	for _, name := range names {
+		found := false
+		for _, test := range tests {
+			if strings.EqualFold(test.Name, name) || strings.EqualFold(test.Category, name) {
+				selected = append(selected, test)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown security test or category: %s", name)
+		}
 	}
+	return selected, nil
 }
 
 // RunTests runs all security tests
 func (tf *TestFramework) RunTests() []TestReport {
-	reports := make([]TestReport, len(tf.tests))
+	return tf.RunTestsContext(context.Background())
+}
+
+// RunTestsContext runs all security tests, stopping early when ctx is done
+func (tf *TestFramework) RunTestsContext(ctx context.Context) []TestReport {
+	reports := make([]TestReport, 0, len(tf.tests))
 	
-	for i, test := range tf.tests {
-		reports[i] = tf.RunTest(test)
+	for _, test := range tf.tests {
+		if ctx.Err() != nil {
+			break
+		}
+		reports = append(reports, tf.RunTestContext(ctx, test))
 	}
 	
 	return reports
@@ -129,12 +202,17 @@ func (tf *TestFramework) RunTests() []TestReport {
 
 // RunTest runs a single security test
 func (tf *TestFramework) RunTest(test TestCase) TestReport {
+	return tf.RunTestContext(context.Background(), test)
+}
+
+// RunTestContext runs a single security test with ctx
+func (tf *TestFramework) RunTestContext(ctx context.Context, test TestCase) TestReport {
 	report := TestReport{
 		TestCase: test,
 	}
 	
 	start := time.Now()
-	result, err := tf.executor.Execute(context.Background(), test.Language, test.Code)
+	result, err := tf.executor.Execute(ctx, test.Language, test.Code)
 	duration := time.Since(start)
 	
 	report.Duration = duration
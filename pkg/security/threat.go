@@ -0,0 +1,266 @@
+package security
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/trace"
+)
+
+// Threat finding sources
+const (
+	ThreatSourceStatic   = "static"
+	ThreatSourceRuntime  = "runtime"
+	ThreatSourceResource = "resource"
+)
+
+// DefaultQuarantineThreshold is the threat score at which code is quarantined
+const DefaultQuarantineThreshold = 80
+
+// ThreatFinding is a single indicator contributing to a threat score
+type ThreatFinding struct {
+	Source      string `json:"source"`
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	Weight      int    `json:"weight"`
+}
+
+// ThreatAssessment is the combined threat score of an execution
+type ThreatAssessment struct {
+	Score    int             `json:"score"`
+	Findings []ThreatFinding `json:"findings"`
+}
+
+// staticRule matches suspicious constructs in submitted code
+type staticRule struct {
+	name        string
+	languages   []string
+	pattern     *regexp.Regexp
+	description string
+	weight      int
+}
+
+var staticRules = []staticRule{
+	{"shell-exec", []string{"python"}, regexp.MustCompile(`\b(os\.system|os\.popen|subprocess\.)`), "spawns shell commands", 15},
+	{"shell-exec", []string{"javascript"}, regexp.MustCompile(`child_process`), "spawns shell commands", 15},
+	{"shell-exec", []string{"go"}, regexp.MustCompile(`"os/exec"`), "spawns shell commands", 15},
+	{"network", []string{"python"}, regexp.MustCompile(`\b(socket|urllib|requests|http\.client)\b`), "uses network APIs", 10},
+	{"network", []string{"javascript"}, regexp.MustCompile(`require\(['"](net|http|https|dgram)['"]\)|\bfetch\(`), "uses network APIs", 10},
+	{"network", []string{"go"}, regexp.MustCompile(`"net(/http)?"`), "uses network APIs", 10},
+	{"dynamic-eval", []string{"python", "javascript"}, regexp.MustCompile(`\b(eval|exec|Function)\s*\(`), "evaluates dynamically constructed code", 10},
+	{"native-code", []string{"python"}, regexp.MustCompile(`\bctypes\b|\bcffi\b`), "loads native code", 20},
+	{"native-code", []string{"go"}, regexp.MustCompile(`"(unsafe|syscall)"`), "uses unsafe or raw syscalls", 15},
+	{"sensitive-path", nil, regexp.MustCompile(`/etc/(passwd|shadow|sudoers)|/proc/self|/var/run/docker\.sock|\.ssh/`), "references sensitive host paths", 20},
+	{"metadata-endpoint", nil, regexp.MustCompile(`169\.254\.169\.254|metadata\.google\.internal`), "references cloud metadata endpoints", 30},
+	{"fork-bomb", nil, regexp.MustCompile(`os\.fork\(\)|:\(\)\s*\{\s*:\|:&\s*\};:`), "creates processes in a loop", 25},
+	{"obfuscation", nil, regexp.MustCompile(`base64\.b64decode|atob\(|\\x[0-9a-f]{2}\\x[0-9a-f]{2}\\x[0-9a-f]{2}`), "decodes obfuscated payloads", 10},
+}
+
+// AnalyzeCode returns static analysis findings for submitted code
+func AnalyzeCode(language, code string) []ThreatFinding {
+	var findings []ThreatFinding
+	seen := make(map[string]bool)
+
+	for _, rule := range staticRules {
+		if len(rule.languages) > 0 && !containsString(rule.languages, language) {
+			continue
+		}
+		if seen[rule.name] || !rule.pattern.MatchString(code) {
+			continue
+		}
+		seen[rule.name] = true
+		findings = append(findings, ThreatFinding{
+			Source:      ThreatSourceStatic,
+			Rule:        rule.name,
+			Description: rule.description,
+			Weight:      rule.weight,
+		})
+	}
+
+	return findings
+}
+
+// AnalyzeResult returns runtime and resource findings for an execution
+func AnalyzeResult(result *sandbox.ExecutionResult) []ThreatFinding {
+	var findings []ThreatFinding
+	if result == nil {
+		return findings
+	}
+
+	// Resource behavior
+	if result.ExitCode == -1 && strings.Contains(result.Stderr, "timed out") {
+		findings = append(findings, ThreatFinding{ThreatSourceResource, "timeout", "exhausted the execution time limit", 15})
+	}
+	if result.ExitCode == 137 || strings.Contains(result.Stdout+result.Stderr, "MemoryError") {
+		findings = append(findings, ThreatFinding{ThreatSourceResource, "memory-exhaustion", "exhausted the memory limit", 15})
+	}
+	if strings.Contains(result.Stdout+result.Stderr, "Resource temporarily unavailable") {
+		findings = append(findings, ThreatFinding{ThreatSourceResource, "process-exhaustion", "exhausted the process limit", 20})
+	}
+
+	// Runtime anomalies from forensic traces
+	if artifact, ok := result.Artifact("trace.json"); ok {
+		var report trace.Report
+		if err := json.Unmarshal(artifact.Data, &report); err == nil {
+			findings = append(findings, analyzeTrace(&report)...)
+		}
+	}
+
+	return findings
+}
+
+// analyzeTrace converts trace observations into findings
+func analyzeTrace(report *trace.Report) []ThreatFinding {
+	var findings []ThreatFinding
+
+	blocked := 0
+	for _, conn := range report.Connections {
+		if conn.Family == "AF_UNIX" {
+			continue
+		}
+		if strings.HasPrefix(conn.Address, "169.254.") {
+			findings = append(findings, ThreatFinding{ThreatSourceRuntime, "metadata-access", "attempted to reach a cloud metadata endpoint", 40})
+		}
+		if !conn.Allowed {
+			blocked++
+		}
+	}
+	if blocked > 0 {
+		findings = append(findings, ThreatFinding{ThreatSourceRuntime, "blocked-connections", "attempted network connections that were blocked", 15})
+	}
+
+	for _, program := range report.Executions[minInt(1, len(report.Executions)):] {
+		if strings.HasSuffix(program, "/sh") || strings.HasSuffix(program, "/bash") {
+			findings = append(findings, ThreatFinding{ThreatSourceRuntime, "shell-spawned", "started a shell process", 20})
+			break
+		}
+	}
+
+	for _, path := range report.FilesOpened {
+		if path == "/etc/shadow" || strings.HasPrefix(path, "/root/") || strings.Contains(path, "docker.sock") {
+			findings = append(findings, ThreatFinding{ThreatSourceRuntime, "sensitive-file-access", "opened a sensitive host file", 30})
+			break
+		}
+	}
+
+	return findings
+}
+
+// ScoreThreat combines findings into an assessment with a score from 0 to 100
+func ScoreThreat(findings []ThreatFinding) ThreatAssessment {
+	score := 0
+	for _, finding := range findings {
+		score += finding.Weight
+	}
+	if score > 100 {
+		score = 100
+	}
+
+	sorted := make([]ThreatFinding, len(findings))
+	copy(sorted, findings)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Weight > sorted[j].Weight
+	})
+
+	return ThreatAssessment{
+		Score:    score,
+		Findings: sorted,
+	}
+}
+
+// CodeHash returns the hash used to identify submitted code
+func CodeHash(language, code string) string {
+	sum := sha256.Sum256([]byte(language + "\x00" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// QuarantineEntry describes a quarantined code hash
+type QuarantineEntry struct {
+	CodeHash string    `json:"code_hash"`
+	Reason   string    `json:"reason"`
+	JobID    string    `json:"job_id,omitempty"`
+	Score    int       `json:"score,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// Quarantine holds code hashes that are rejected on resubmission
+type Quarantine struct {
+	entries map[string]QuarantineEntry
+	mu      sync.RWMutex
+}
+
+// NewQuarantine creates an empty quarantine list
+func NewQuarantine() *Quarantine {
+	return &Quarantine{
+		entries: make(map[string]QuarantineEntry),
+	}
+}
+
+// Add quarantines a code hash
+func (q *Quarantine) Add(entry QuarantineEntry) {
+	if entry.AddedAt.IsZero() {
+		entry.AddedAt = time.Now()
+	}
+
+	q.mu.Lock()
+	q.entries[entry.CodeHash] = entry
+	q.mu.Unlock()
+}
+
+// Get returns the quarantine entry for a code hash
+func (q *Quarantine) Get(codeHash string) (QuarantineEntry, bool) {
+	q.mu.RLock()
+	entry, ok := q.entries[codeHash]
+	q.mu.RUnlock()
+	return entry, ok
+}
+
+// Remove releases a code hash from quarantine
+func (q *Quarantine) Remove(codeHash string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.entries[codeHash]; !ok {
+		return false
+	}
+	delete(q.entries, codeHash)
+	return true
+}
+
+// List returns all quarantine entries, newest first
+func (q *Quarantine) List() []QuarantineEntry {
+	q.mu.RLock()
+	entries := make([]QuarantineEntry, 0, len(q.entries))
+	for _, entry := range q.entries {
+		entries = append(entries, entry)
+	}
+	q.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].AddedAt.After(entries[j].AddedAt)
+	})
+	return entries
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
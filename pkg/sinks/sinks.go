@@ -0,0 +1,195 @@
+// Package sinks pushes the artifacts and logs of finished jobs to object
+// storage that jobs name as their output sink, such as s3://bucket/prefix.
+// The server holds the credentials of every bucket it can push to, and a
+// job may only write below its tenant's prefix in them.
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/storage"
+)
+
+// DefaultTenantLabel is the job label that names the tenant of a job
+const DefaultTenantLabel = "tenant"
+
+// DefaultPushTimeout bounds pushing the results of one job
+const DefaultPushTimeout = 5 * time.Minute
+
+// Target is where a job's results are pushed
+type Target struct {
+	URL    string `json:"url"`
+	Scheme string `json:"scheme"`
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix"`
+}
+
+// Receipt records what was pushed to a target
+type Receipt struct {
+	URL     string   `json:"url"`
+	Objects []string `json:"objects"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// destination is a bucket the server can push to
+type destination struct {
+	backend storage.Backend
+	root    string
+}
+
+// Registry holds the buckets that jobs may push their results to
+type Registry struct {
+	// TenantLabel is the job label that names the tenant of a job, which
+	// must be the tenant whose prefix it writes to; DefaultTenantLabel
+	// when empty
+	TenantLabel string
+
+	// PushTimeout bounds pushing the results of one job;
+	// DefaultPushTimeout when zero
+	PushTimeout time.Duration
+
+	destinations map[string]destination
+}
+
+// NewRegistry creates a registry without buckets
+func NewRegistry() *Registry {
+	return &Registry{destinations: make(map[string]destination)}
+}
+
+// FromConfig creates a registry with the buckets of the configuration. The
+// prefix of each bucket is the root below which tenants have prefixes.
+func FromConfig(cfg config.SinksConfig) (*Registry, error) {
+	r := NewRegistry()
+	r.TenantLabel = cfg.TenantLabel
+	for _, s3 := range cfg.S3 {
+		root := s3.Prefix
+		s3.Prefix = ""
+		backend, err := storage.NewS3Backend(s3)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure sink s3://%s: %w", s3.Bucket, err)
+		}
+		r.Add("s3", s3.Bucket, root, backend)
+	}
+	for _, gcs := range cfg.GCS {
+		root := gcs.Prefix
+		gcs.Prefix = ""
+		backend, err := storage.NewGCSBackend(gcs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure sink gs://%s: %w", gcs.Bucket, err)
+		}
+		r.Add("gs", gcs.Bucket, root, backend)
+	}
+	return r, nil
+}
+
+// Add lets jobs push to a bucket through backend, below root
+func (r *Registry) Add(scheme, bucket, root string, backend storage.Backend) {
+	if r.destinations == nil {
+		r.destinations = make(map[string]destination)
+	}
+	r.destinations[scheme+"://"+bucket] = destination{backend: backend, root: strings.Trim(root, "/")}
+}
+
+// Buckets returns the URLs of the buckets jobs may push to
+func (r *Registry) Buckets() []string {
+	buckets := make([]string, 0, len(r.destinations))
+	for bucket := range r.destinations {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+// Tenant returns the tenant named by a job's labels
+func (r *Registry) Tenant(labels map[string]string) string {
+	label := r.TenantLabel
+	if label == "" {
+		label = DefaultTenantLabel
+	}
+	return labels[label]
+}
+
+// TenantPrefix returns the prefix of a tenant in a bucket
+func (r *Registry) TenantPrefix(scheme, bucket, tenant string) string {
+	return path.Join(r.destinations[scheme+"://"+bucket].root, tenant)
+}
+
+// Resolve checks that a tenant may push to a sink URL and returns its
+// target
+func (r *Registry) Resolve(rawURL, tenant string) (*Target, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "s3" && u.Scheme != "gs") {
+		return nil, fmt.Errorf("invalid output sink %q: use s3://bucket/prefix or gs://bucket/prefix", rawURL)
+	}
+	if _, ok := r.destinations[u.Scheme+"://"+u.Host]; !ok {
+		return nil, fmt.Errorf("output sink bucket %s://%s is not configured on this server", u.Scheme, u.Host)
+	}
+	if tenant == "" || strings.ContainsAny(tenant, "/\\") || tenant == "." || tenant == ".." {
+		return nil, fmt.Errorf("output sinks are only available to jobs with a valid tenant label")
+	}
+
+	// Cleaning resolves dot segments that could climb out of the prefix
+	prefix := strings.Trim(path.Clean("/"+u.Path), "/")
+	allowed := r.TenantPrefix(u.Scheme, u.Host, tenant)
+	if prefix != allowed && !strings.HasPrefix(prefix, allowed+"/") {
+		return nil, fmt.Errorf("output sink must be below %s://%s/%s/", u.Scheme, u.Host, allowed)
+	}
+	return &Target{
+		URL:    fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, prefix),
+		Scheme: u.Scheme,
+		Bucket: u.Host,
+		Prefix: prefix,
+	}, nil
+}
+
+// Push uploads the logs and artifacts of a job's result below
+// <prefix>/<job ID>/: stdout.log, stderr.log when the program wrote to
+// stderr, and artifacts/<name>. It stops at the first failure.
+func (r *Registry) Push(ctx context.Context, target Target, jobID string, result *sandbox.ExecutionResult) Receipt {
+	receipt := Receipt{URL: fmt.Sprintf("%s/%s/", target.URL, jobID), Objects: []string{}}
+	dest, ok := r.destinations[target.Scheme+"://"+target.Bucket]
+	if !ok {
+		receipt.Error = fmt.Sprintf("output sink bucket %s://%s is no longer configured", target.Scheme, target.Bucket)
+		return receipt
+	}
+
+	timeout := r.PushTimeout
+	if timeout <= 0 {
+		timeout = DefaultPushTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type object struct {
+		name        string
+		data        []byte
+		contentType string
+	}
+	objects := []object{{"stdout.log", []byte(result.Stdout), "text/plain"}}
+	if result.Stderr != "" {
+		objects = append(objects, object{"stderr.log", []byte(result.Stderr), "text/plain"})
+	}
+	for _, a := range result.Artifacts {
+		objects = append(objects, object{"artifacts/" + path.Base(a.Name), a.Data, a.ContentType})
+	}
+
+	base := path.Join(target.Prefix, jobID)
+	for _, obj := range objects {
+		key := path.Join(base, obj.name)
+		if err := dest.backend.Put(ctx, key, bytes.NewReader(obj.data), int64(len(obj.data)), obj.contentType); err != nil {
+			receipt.Error = fmt.Sprintf("failed to push %s: %v", obj.name, err)
+			return receipt
+		}
+		receipt.Objects = append(receipt.Objects, obj.name)
+	}
+	return receipt
+}
@@ -0,0 +1,175 @@
+// Package state reads and writes the archives that carry the state of a
+// server to another host or storage backend. An archive is a gzipped tar
+// whose first file is the manifest; the other files are sections named by
+// the server that exports them.
+package state
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"forgeai/pkg/jobs"
+)
+
+// Version is the version of the archives that this package writes. Archives
+// of other versions are refused.
+const Version = 1
+
+// ManifestFile is the name of the manifest in an archive
+const ManifestFile = "manifest.json"
+
+// ErrVersion is returned for archives of another version
+var ErrVersion = errors.New("unsupported state archive version")
+
+// Manifest describes an archive
+type Manifest struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+
+	// Server identifies the server that exported the archive
+	Server string `json:"server,omitempty"`
+
+	// Jobs reports whether the archive includes job history
+	Jobs bool `json:"jobs"`
+}
+
+// Report describes what the import of an archive applied
+type Report struct {
+	Manifest Manifest `json:"manifest"`
+
+	// Imported counts the entries of each section that were applied
+	Imported map[string]int `json:"imported"`
+
+	// Skipped lists the files that were not applied, because their feature
+	// is disabled on the importing server or, for settings, not asked for
+	Skipped []string `json:"skipped,omitempty"`
+
+	// MissingEnvironments lists the languages of the exporting server that
+	// the importing server does not support
+	MissingEnvironments []string `json:"missing_environments,omitempty"`
+
+	// Jobs reports the import of job history
+	Jobs *jobs.BackfillReport `json:"jobs,omitempty"`
+}
+
+// Writer writes an archive
+type Writer struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+	at time.Time
+}
+
+// NewWriter starts an archive in w with its manifest. The Version and, when
+// zero, ExportedAt of the manifest are filled in.
+func NewWriter(w io.Writer, m Manifest) (*Writer, error) {
+	m.Version = Version
+	if m.ExportedAt.IsZero() {
+		m.ExportedAt = time.Now().UTC()
+	}
+	gz := gzip.NewWriter(w)
+	sw := &Writer{gz: gz, tw: tar.NewWriter(gz), at: m.ExportedAt}
+	if err := sw.WriteJSON(ManifestFile, m); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// WriteJSON adds a file holding v as JSON
+func (w *Writer) WriteJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return w.WriteFile(name, int64(len(data)), bytes.NewReader(data))
+}
+
+// WriteFile adds a file of size bytes read from r
+func (w *Writer) WriteFile(name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: size, ModTime: w.at, Typeflag: tar.TypeReg}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.CopyN(w.tw, r, size); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close finishes the archive. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// Reader reads the files of an archive in the order they were written
+type Reader struct {
+	tr *tar.Reader
+
+	// Manifest is the manifest of the archive
+	Manifest Manifest
+}
+
+// NewReader opens an archive and reads its manifest, refusing archives of
+// another Version
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state archive: %w", err)
+	}
+	sr := &Reader{tr: tar.NewReader(gz)}
+	hdr, err := sr.tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("invalid state archive: %w", err)
+	}
+	if hdr.Name != ManifestFile {
+		return nil, fmt.Errorf("invalid state archive: %s must come first", ManifestFile)
+	}
+	if err := json.NewDecoder(sr.tr).Decode(&sr.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid state archive manifest: %w", err)
+	}
+	if sr.Manifest.Version != Version {
+		return nil, fmt.Errorf("%w %d, expected %d", ErrVersion, sr.Manifest.Version, Version)
+	}
+	return sr, nil
+}
+
+// Next advances to the next file and returns its name and contents. It
+// returns io.EOF after the last file. Names are cleaned, and files that
+// would escape the archive are refused.
+func (r *Reader) Next() (string, io.Reader, error) {
+	for {
+		hdr, err := r.tr.Next()
+		if err != nil {
+			if err != io.EOF {
+				err = fmt.Errorf("invalid state archive: %w", err)
+			}
+			return "", nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return "", nil, fmt.Errorf("invalid state archive: unsafe file name %q", hdr.Name)
+		}
+		return name, r.tr, nil
+	}
+}
+
+// DecodeJSON decodes the contents of a file into v
+func DecodeJSON(name string, r io.Reader, v interface{}) error {
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// Compression algorithms of stored objects
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+// gzipSuffix is appended to the keys of compressed objects. It differs from
+// .gz so that stored .gz files keep their names.
+const gzipSuffix = ".forgeai-gz"
+
+// MinCompressSize is the size below which data is not worth compressing
+const MinCompressSize = 1 << 10
+
+// incompressibleTypes are content type prefixes of data that is already
+// compressed
+var incompressibleTypes = []string{
+	"image/", "audio/", "video/", "font/woff",
+	"application/gzip", "application/x-gzip", "application/zip",
+	"application/zstd", "application/x-xz", "application/x-bzip2",
+	"application/x-7z-compressed", "application/vnd.oci.image.layer",
+}
+
+// Compressible reports whether data of a content type is worth compressing
+func Compressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// CompressionStats counts bytes before and after compression. It is safe
+// for concurrent use.
+type CompressionStats struct {
+	raw        int64
+	compressed int64
+}
+
+// Add records raw bytes that were compressed to compressed bytes
+func (s *CompressionStats) Add(raw, compressed int64) {
+	atomic.AddInt64(&s.raw, raw)
+	atomic.AddInt64(&s.compressed, compressed)
+}
+
+// Totals returns the bytes recorded before and after compression
+func (s *CompressionStats) Totals() (raw, compressed int64) {
+	return atomic.LoadInt64(&s.raw), atomic.LoadInt64(&s.compressed)
+}
+
+// Gzip compresses data, returning nil when that does not make it smaller
+func Gzip(data []byte) []byte {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.DefaultCompression)
+	zw.Write(data)
+	zw.Close()
+	if buf.Len() >= len(data) {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// gzipReadCloser closes both the decompressor and the underlying object
+type gzipReadCloser struct {
+	*gzip.Reader
+	object io.Closer
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.object.Close()
+}
+
+// Gunzip returns a reader of the decompressed contents of a gzip stream,
+// which it closes when the reader is closed
+func Gunzip(rc io.ReadCloser) (io.ReadCloser, error) {
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to decompress object: %w", err)
+	}
+	return &gzipReadCloser{Reader: zr, object: rc}, nil
+}
+
+// CompressedBackend gzips objects before storing them in another backend,
+// under their key with a .forgeai-gz suffix. Objects that do not shrink,
+// such as images and archives, are stored as they are. Keys are unchanged
+// for callers, and objects stored without compression remain readable.
+type CompressedBackend struct {
+	Backend Backend
+
+	// Stats counts the bytes of compressed objects
+	Stats CompressionStats
+}
+
+// NewCompressedBackend wraps a backend with gzip compression
+func NewCompressedBackend(backend Backend) *CompressedBackend {
+	return &CompressedBackend{Backend: backend}
+}
+
+// Put compresses and stores an object
+func (c *CompressedBackend) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if (size >= 0 && size < MinCompressSize) || !Compressible(contentType) {
+		return c.put(ctx, key, r, size, contentType)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read object: %w", err)
+	}
+	compressed := Gzip(data)
+	if compressed == nil {
+		return c.put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType)
+	}
+
+	if err := c.Backend.Put(ctx, key+gzipSuffix, bytes.NewReader(compressed), int64(len(compressed)), contentType); err != nil {
+		return err
+	}
+	c.Stats.Add(int64(len(data)), int64(len(compressed)))
+
+	// Remove an uncompressed version stored earlier
+	if err := c.Backend.Delete(ctx, key); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to replace object: %w", err)
+	}
+	return nil
+}
+
+// put stores an object uncompressed, replacing a compressed version
+func (c *CompressedBackend) put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := c.Backend.Put(ctx, key, r, size, contentType); err != nil {
+		return err
+	}
+	if err := c.Backend.Delete(ctx, key+gzipSuffix); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to replace object: %w", err)
+	}
+	return nil
+}
+
+// Get opens an object, decompressing it if it was stored compressed
+func (c *CompressedBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := c.Backend.Get(ctx, key+gzipSuffix)
+	if errors.Is(err, ErrNotFound) {
+		return c.Backend.Get(ctx, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Gunzip(rc)
+}
+
+// Delete removes an object in either form
+func (c *CompressedBackend) Delete(ctx context.Context, key string) error {
+	if err := c.Backend.Delete(ctx, key+gzipSuffix); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err := c.Backend.Delete(ctx, key); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// List returns the objects below a prefix by their uncompressed keys. Sizes
+// are the stored, compressed sizes.
+func (c *CompressedBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects, err := c.Backend.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		objects[i].Key = strings.TrimSuffix(objects[i].Key, gzipSuffix)
+	}
+	return objects, nil
+}
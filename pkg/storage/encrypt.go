@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"forgeai/pkg/envelope"
+)
+
+// EncryptedBackend encrypts objects with envelope encryption before storing
+// them in another backend. Keys are unchanged, and objects stored before
+// encryption was enabled remain readable.
+type EncryptedBackend struct {
+	Backend Backend
+	Keys    envelope.KeyProvider
+}
+
+// NewEncryptedBackend wraps a backend with envelope encryption
+func NewEncryptedBackend(backend Backend, keys envelope.KeyProvider) *EncryptedBackend {
+	return &EncryptedBackend{Backend: backend, Keys: keys}
+}
+
+// WithEncryption encrypts the objects of a backend. A compressed backend
+// keeps compressing, before encrypting.
+func WithEncryption(backend Backend, keys envelope.KeyProvider) Backend {
+	if c, ok := backend.(*CompressedBackend); ok {
+		c.Backend = NewEncryptedBackend(c.Backend, keys)
+		return c
+	}
+	return NewEncryptedBackend(backend, keys)
+}
+
+// Encryption returns the encryption of a backend made by WithEncryption, or
+// nil when it does not encrypt
+func Encryption(backend Backend) *EncryptedBackend {
+	if c, ok := backend.(*CompressedBackend); ok {
+		backend = c.Backend
+	}
+	e, _ := backend.(*EncryptedBackend)
+	return e
+}
+
+// Put encrypts and stores an object
+func (e *EncryptedBackend) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read object: %w", err)
+	}
+	sealed, err := envelope.Seal(ctx, e.Keys, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt object: %w", err)
+	}
+	return e.Backend.Put(ctx, key, bytes.NewReader(sealed), int64(len(sealed)), contentType)
+}
+
+// Get opens and decrypts an object
+func (e *EncryptedBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	data, err := e.read(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !envelope.IsSealed(data) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	plaintext, err := envelope.Open(ctx, e.Keys, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt object %s: %w", key, err)
+	}
+	return io.NopCloser(bytes.NewReader(plaintext)), nil
+}
+
+// Delete removes an object
+func (e *EncryptedBackend) Delete(ctx context.Context, key string) error {
+	return e.Backend.Delete(ctx, key)
+}
+
+// List returns the objects below a prefix. Sizes are the stored, encrypted
+// sizes.
+func (e *EncryptedBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	return e.Backend.List(ctx, prefix)
+}
+
+// RotationStats count the objects visited by Rotate
+type RotationStats struct {
+	ActiveKey string `json:"active_key"`
+	Rewrapped int    `json:"rewrapped"`
+	Current   int    `json:"current"`
+	Encrypted int    `json:"encrypted"`
+	Failed    int    `json:"failed"`
+}
+
+// Rotate wraps the data keys of the objects below a prefix with the active
+// key, so that retired keys can be removed once it succeeds. Objects stored
+// before encryption was enabled are encrypted. Objects are rewritten under
+// their keys with their content types lost.
+func (e *EncryptedBackend) Rotate(ctx context.Context, prefix string) (RotationStats, error) {
+	stats := RotationStats{ActiveKey: e.Keys.ActiveKeyID()}
+	objects, err := e.Backend.List(ctx, prefix)
+	if err != nil {
+		return stats, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		data, err := e.read(ctx, object.Key)
+		if err != nil {
+			fmt.Printf("Warning: failed to read %s for key rotation: %v\n", object.Key, err)
+			stats.Failed++
+			continue
+		}
+
+		var rewritten []byte
+		if envelope.IsSealed(data) {
+			var changed bool
+			rewritten, changed, err = envelope.Rewrap(ctx, e.Keys, data)
+			if err == nil && !changed {
+				stats.Current++
+				continue
+			}
+		} else {
+			rewritten, err = envelope.Seal(ctx, e.Keys, data)
+		}
+		if err == nil {
+			err = e.Backend.Put(ctx, object.Key, bytes.NewReader(rewritten), int64(len(rewritten)), "")
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to rotate the key of %s: %v\n", object.Key, err)
+			stats.Failed++
+			continue
+		}
+		if envelope.IsSealed(data) {
+			stats.Rewrapped++
+		} else {
+			stats.Encrypted++
+		}
+	}
+	return stats, nil
+}
+
+// read reads a stored object
+func (e *EncryptedBackend) read(ctx context.Context, key string) ([]byte, error) {
+	rc, err := e.Backend.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	return data, nil
+}
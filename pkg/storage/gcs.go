@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/offline"
+)
+
+const (
+	gcsAPIBase      = "https://storage.googleapis.com/storage/v1"
+	gcsUploadBase   = "https://storage.googleapis.com/upload/storage/v1"
+	gcsMetadataURL  = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	gcsTokenRefresh = time.Minute
+)
+
+// GCSBackend stores objects in Google Cloud Storage via the JSON API
+type GCSBackend struct {
+	Bucket string
+	Prefix string
+
+	// AccessToken is a static OAuth token. When empty, tokens are fetched
+	// from the GCE metadata server.
+	AccessToken string
+
+	// KMSKeyName enables customer-managed encryption keys
+	KMSKeyName string
+
+	HTTPClient *http.Client
+
+	token       string
+	tokenExpiry time.Time
+	mu          sync.Mutex
+}
+
+// NewGCSBackend creates a GCS backend
+func NewGCSBackend(cfg config.GCSStorageConfig) (*GCSBackend, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("gcs storage requires a bucket")
+	}
+	if err := offline.Check("gcs storage"); err != nil {
+		return nil, err
+	}
+
+	return &GCSBackend{
+		Bucket:      cfg.Bucket,
+		Prefix:      cfg.Prefix,
+		AccessToken: firstNonEmpty(cfg.AccessToken, os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")),
+		KMSKeyName:  cfg.KMSKeyName,
+		HTTPClient:  &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Put uploads an object
+func (g *GCSBackend) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	query := url.Values{}
+	query.Set("uploadType", "media")
+	query.Set("name", JoinKey(g.Prefix, key))
+	if g.KMSKeyName != "" {
+		query.Set("kmsKeyName", g.KMSKeyName)
+	}
+
+	endpoint := fmt.Sprintf("%s/b/%s/o?%s", gcsUploadBase, url.PathEscape(g.Bucket), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, r)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := g.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads an object
+func (g *GCSBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.objectURL(key)+"?alt=media", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := g.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes an object
+func (g *GCSBackend) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, g.objectURL(key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := g.do(req)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List returns objects below a prefix
+func (g *GCSBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	pageToken := ""
+
+	for {
+		query := url.Values{}
+		query.Set("prefix", JoinKey(g.Prefix, prefix))
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		endpoint := fmt.Sprintf("%s/b/%s/o?%s", gcsAPIBase, url.PathEscape(g.Bucket), query.Encode())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		resp, err := g.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Items []struct {
+				Name    string    `json:"name"`
+				Size    string    `json:"size"`
+				Updated time.Time `json:"updated"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse list response: %w", err)
+		}
+
+		for _, item := range result.Items {
+			var size int64
+			fmt.Sscan(item.Size, &size)
+			key := strings.TrimPrefix(strings.TrimPrefix(item.Name, strings.Trim(g.Prefix, "/")), "/")
+			objects = append(objects, ObjectInfo{Key: key, Size: size, LastModified: item.Updated})
+		}
+
+		if result.NextPageToken == "" {
+			break
+		}
+		pageToken = result.NextPageToken
+	}
+
+	return objects, nil
+}
+
+// objectURL returns the metadata URL of an object
+func (g *GCSBackend) objectURL(key string) string {
+	return fmt.Sprintf("%s/b/%s/o/%s", gcsAPIBase, url.PathEscape(g.Bucket), url.PathEscape(JoinKey(g.Prefix, key)))
+}
+
+// do authorizes and sends a request, mapping error responses
+func (g *GCSBackend) do(req *http.Request) (*http.Response, error) {
+	token, err := g.accessToken(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("gcs request failed: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("gcs returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return resp, nil
+}
+
+// accessToken returns the static token or a cached metadata server token
+func (g *GCSBackend) accessToken(ctx context.Context) (string, error) {
+	if g.AccessToken != "" {
+		return g.AccessToken, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.token != "" && time.Until(g.tokenExpiry) > gcsTokenRefresh {
+		return g.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcsMetadataURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := g.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch gcs access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server returned status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to parse access token: %w", err)
+	}
+
+	g.token = token.AccessToken
+	g.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return g.token, nil
+}
@@ -0,0 +1,322 @@
+// Package templates stores named code templates with typed parameters.
+// Placeholders such as {{input}} are replaced with language literals rather
+// than raw text, so callers can supply values but never inject code.
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Parameter types
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeNumber = "number"
+	TypeBool   = "bool"
+)
+
+var (
+	placeholderRe = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	nameRe        = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+// Parameter declares a template placeholder and its validation rules
+type Parameter struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Default     interface{}   `json:"default,omitempty"`
+	Pattern     string        `json:"pattern,omitempty"`
+	MaxLength   int           `json:"max_length,omitempty"`
+	Min         *float64      `json:"min,omitempty"`
+	Max         *float64      `json:"max,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Template is a named code template
+type Template struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Language    string      `json:"language"`
+	Code        string      `json:"code"`
+	Parameters  []Parameter `json:"parameters"`
+
+	// Timeout and MemoryLimit cap the resources of executions; callers
+	// cannot raise them
+	Timeout     int `json:"timeout,omitempty"`
+	MemoryLimit int `json:"memory_limit,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks that the template is well formed and that every
+// placeholder is declared as a parameter
+func (t *Template) Validate() error {
+	if !nameRe.MatchString(t.Name) {
+		return fmt.Errorf("invalid template name: %q", t.Name)
+	}
+	switch t.Language {
+	case "python", "javascript", "go":
+	default:
+		return fmt.Errorf("unsupported language: %s", t.Language)
+	}
+	if t.Code == "" {
+		return fmt.Errorf("template code is empty")
+	}
+
+	declared := make(map[string]bool)
+	for i := range t.Parameters {
+		p := &t.Parameters[i]
+		if declared[p.Name] {
+			return fmt.Errorf("duplicate parameter: %s", p.Name)
+		}
+		declared[p.Name] = true
+
+		switch p.Type {
+		case "":
+			p.Type = TypeString
+		case TypeString, TypeInt, TypeNumber, TypeBool:
+		default:
+			return fmt.Errorf("parameter %s has unknown type: %s", p.Name, p.Type)
+		}
+
+		if p.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + p.Pattern + ")$")
+			if err != nil {
+				return fmt.Errorf("parameter %s has invalid pattern: %w", p.Name, err)
+			}
+			p.pattern = re
+		}
+
+		if p.Default != nil {
+			if _, err := p.check(p.Default); err != nil {
+				return fmt.Errorf("parameter %s has invalid default: %w", p.Name, err)
+			}
+		}
+	}
+
+	for _, match := range placeholderRe.FindAllStringSubmatch(t.Code, -1) {
+		if !declared[match[1]] {
+			return fmt.Errorf("placeholder {{%s}} is not a declared parameter", match[1])
+		}
+	}
+
+	return nil
+}
+
+// Render validates params and substitutes them into the template code
+func (t *Template) Render(params map[string]interface{}) (string, error) {
+	values := make(map[string]string, len(t.Parameters))
+	known := make(map[string]bool, len(t.Parameters))
+
+	for i := range t.Parameters {
+		p := &t.Parameters[i]
+		known[p.Name] = true
+
+		value, ok := params[p.Name]
+		if !ok || value == nil {
+			if p.Required {
+				return "", fmt.Errorf("missing required parameter: %s", p.Name)
+			}
+			value = p.Default
+		}
+
+		if value == nil {
+			values[p.Name] = literal(t.Language, nil)
+			continue
+		}
+
+		checked, err := p.check(value)
+		if err != nil {
+			return "", fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		values[p.Name] = literal(t.Language, checked)
+	}
+
+	for name := range params {
+		if !known[name] {
+			return "", fmt.Errorf("unknown parameter: %s", name)
+		}
+	}
+
+	return placeholderRe.ReplaceAllStringFunc(t.Code, func(m string) string {
+		return values[placeholderRe.FindStringSubmatch(m)[1]]
+	}), nil
+}
+
+// check validates a value against the parameter rules and normalizes it
+func (p *Parameter) check(value interface{}) (interface{}, error) {
+	var out interface{}
+
+	switch p.Type {
+	case TypeString, "":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string")
+		}
+		if p.MaxLength > 0 && len(s) > p.MaxLength {
+			return nil, fmt.Errorf("longer than %d characters", p.MaxLength)
+		}
+		if p.pattern != nil && !p.pattern.MatchString(s) {
+			return nil, fmt.Errorf("does not match pattern %s", p.Pattern)
+		}
+		out = s
+	case TypeInt, TypeNumber:
+		f, ok := toFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("expected a number")
+		}
+		if p.Type == TypeInt && f != float64(int64(f)) {
+			return nil, fmt.Errorf("expected an integer")
+		}
+		if p.Min != nil && f < *p.Min {
+			return nil, fmt.Errorf("less than %v", *p.Min)
+		}
+		if p.Max != nil && f > *p.Max {
+			return nil, fmt.Errorf("greater than %v", *p.Max)
+		}
+		if p.Type == TypeInt {
+			out = int64(f)
+		} else {
+			out = f
+		}
+	case TypeBool:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected a boolean")
+		}
+		out = b
+	}
+
+	if len(p.Enum) > 0 {
+		allowed := false
+		for _, e := range p.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, fmt.Errorf("not one of the allowed values")
+		}
+	}
+
+	return out, nil
+}
+
+// literal renders a checked value as a source literal of the language
+func literal(language string, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		switch language {
+		case "python":
+			return "None"
+		case "go":
+			return "nil"
+		default:
+			return "null"
+		}
+	case bool:
+		if language == "python" {
+			if v {
+				return "True"
+			}
+			return "False"
+		}
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		// JSON string literals are valid in Python, JavaScript, and Go
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return ""
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Store holds templates in memory
+type Store struct {
+	templates map[string]*Template
+	mu        sync.RWMutex
+}
+
+// NewStore creates an empty template store
+func NewStore() *Store {
+	return &Store{
+		templates: make(map[string]*Template),
+	}
+}
+
+// Put validates and stores a template, replacing any with the same name
+func (s *Store) Put(t *Template) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+
+	s.mu.Lock()
+	s.templates[t.Name] = t
+	s.mu.Unlock()
+	return nil
+}
+
+// Get returns a template by name
+func (s *Store) Get(name string) (*Template, bool) {
+	s.mu.RLock()
+	t, ok := s.templates[name]
+	s.mu.RUnlock()
+	return t, ok
+}
+
+// Delete removes a template
+func (s *Store) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[name]; !ok {
+		return false
+	}
+	delete(s.templates, name)
+	return true
+}
+
+// List returns all templates sorted by name
+func (s *Store) List() []*Template {
+	s.mu.RLock()
+	list := make([]*Template, 0, len(s.templates))
+	for _, t := range s.templates {
+		list = append(list, t)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,326 @@
+// Package tokens issues short-lived execution tokens that are narrowly
+// scoped: to one language, capped limits, and a number of executions. A
+// caller holding long-lived credentials exchanges them for a token that can
+// be handed to a browser or a downstream agent, which can then run only
+// what the token allows until it expires or is used up.
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix starts every token, so that tokens can be told apart from other
+// credentials
+const Prefix = "fxt_"
+
+// Defaults of the lifetime of tokens
+const (
+	DefaultTTL = 15 * time.Minute
+	MaxTTL     = 24 * time.Hour
+)
+
+// MaxExecutions is the most executions one token may allow
+const MaxExecutions = 10000
+
+var (
+	// ErrInvalid is returned for tokens that were never issued or have been
+	// revoked
+	ErrInvalid = errors.New("invalid execution token")
+
+	// ErrExpired is returned for tokens past their expiry
+	ErrExpired = errors.New("execution token has expired")
+
+	// ErrExhausted is returned for tokens whose executions are used up
+	ErrExhausted = errors.New("execution token has no executions left")
+
+	// ErrScope is wrapped by the errors of requests outside a token's scope
+	ErrScope = errors.New("outside the scope of the execution token")
+)
+
+// Scope is what a token allows
+type Scope struct {
+	// Language is the one language the token may run
+	Language string `json:"language"`
+
+	// MaxTimeout and MaxMemoryLimit cap the timeout in seconds and memory
+	// limit in MB of jobs; unlimited when zero
+	MaxTimeout     int `json:"max_timeout,omitempty"`
+	MaxMemoryLimit int `json:"max_memory_limit,omitempty"`
+
+	NetworkAccess bool `json:"network_access"`
+
+	// Executions is how many jobs the token may create
+	Executions int `json:"executions"`
+}
+
+// Validate checks that a scope is narrow enough to issue
+func (s Scope) Validate() error {
+	if s.Language == "" {
+		return errors.New("a token must be scoped to a language")
+	}
+	if s.Executions < 1 || s.Executions > MaxExecutions {
+		return fmt.Errorf("executions must be between 1 and %d", MaxExecutions)
+	}
+	if s.MaxTimeout < 0 || s.MaxMemoryLimit < 0 {
+		return errors.New("limits must not be negative")
+	}
+	return nil
+}
+
+// Token describes an issued token. The token itself is only returned when
+// it is issued; the store keeps its hash.
+type Token struct {
+	ID        string    `json:"id"`
+	Subject   string    `json:"subject"`
+	Scope     Scope     `json:"scope"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Used      int       `json:"used"`
+}
+
+// Remaining returns how many executions the token has left
+func (t Token) Remaining() int {
+	return t.Scope.Executions - t.Used
+}
+
+// Request is what a job request asks for
+type Request struct {
+	Language      string
+	NetworkAccess bool
+	Timeout       int
+	MemoryLimit   int
+}
+
+// check reports whether a request is within a scope
+func (s Scope) check(req Request) error {
+	if !strings.EqualFold(req.Language, s.Language) {
+		return fmt.Errorf("%w: only %s may run", ErrScope, s.Language)
+	}
+	if req.NetworkAccess && !s.NetworkAccess {
+		return fmt.Errorf("%w: network access is not allowed", ErrScope)
+	}
+	if s.MaxTimeout > 0 && req.Timeout > s.MaxTimeout {
+		return fmt.Errorf("%w: the timeout is limited to %d seconds", ErrScope, s.MaxTimeout)
+	}
+	if s.MaxMemoryLimit > 0 && req.MemoryLimit > s.MaxMemoryLimit {
+		return fmt.Errorf("%w: the memory limit is limited to %d MB", ErrScope, s.MaxMemoryLimit)
+	}
+	return nil
+}
+
+// Store issues tokens and keeps them in memory until they expire, so
+// tokens do not survive a restart. The zero value is ready to use.
+type Store struct {
+	// MaxTTL is the longest lifetime of a token; MaxTTL when zero
+	MaxTTL time.Duration
+
+	// Now returns the current time; time.Now when nil
+	Now func() time.Time
+
+	mu     sync.Mutex
+	byHash map[string]*Token
+}
+
+func (s *Store) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// hash returns the key a token is stored under
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsToken reports whether a credential looks like an execution token
+func IsToken(credential string) bool {
+	return strings.HasPrefix(credential, Prefix)
+}
+
+// Issue creates a token for a subject. A zero ttl is DefaultTTL, and ttls
+// beyond the store's maximum are refused.
+func (s *Store) Issue(subject string, scope Scope, ttl time.Duration) (string, Token, error) {
+	if subject == "" {
+		return "", Token{}, errors.New("tokens must be issued to a subject")
+	}
+	if err := scope.Validate(); err != nil {
+		return "", Token{}, err
+	}
+	maxTTL := s.MaxTTL
+	if maxTTL <= 0 {
+		maxTTL = MaxTTL
+	}
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl < 0 || ttl > maxTTL {
+		return "", Token{}, fmt.Errorf("ttl must be positive and at most %s", maxTTL)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", Token{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", Token{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := Prefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	now := s.now().UTC()
+	t := &Token{
+		ID:        "tok-" + hex.EncodeToString(id),
+		Subject:   subject,
+		Scope:     scope,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byHash == nil {
+		s.byHash = map[string]*Token{}
+	}
+	s.prune(now)
+	s.byHash[hash(token)] = t
+	return token, *t, nil
+}
+
+// prune drops expired tokens. The caller holds s.mu.
+func (s *Store) prune(now time.Time) {
+	for h, t := range s.byHash {
+		if !now.Before(t.ExpiresAt) {
+			delete(s.byHash, h)
+		}
+	}
+}
+
+// lookup returns a valid token. The caller holds s.mu.
+func (s *Store) lookup(token string, now time.Time) (*Token, error) {
+	t, ok := s.byHash[hash(token)]
+	if !ok {
+		return nil, ErrInvalid
+	}
+	if !now.Before(t.ExpiresAt) {
+		delete(s.byHash, hash(token))
+		return nil, ErrExpired
+	}
+	return t, nil
+}
+
+// Lookup returns the token a credential stands for, if it is valid
+func (s *Store) Lookup(token string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(token, s.now())
+	if err != nil {
+		return Token{}, err
+	}
+	return *t, nil
+}
+
+// Use checks that a request is within a token's scope and counts it
+// against the token's executions
+func (s *Store) Use(token string, req Request) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(token, s.now())
+	if err != nil {
+		return Token{}, err
+	}
+	if t.Remaining() <= 0 {
+		return *t, ErrExhausted
+	}
+	if err := t.Scope.check(req); err != nil {
+		return *t, err
+	}
+	t.Used++
+	return *t, nil
+}
+
+// Release returns an execution that Use counted against a token, for a
+// request that did not run
+func (s *Store) Release(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.byHash[hash(token)]; ok && t.Used > 0 {
+		t.Used--
+	}
+}
+
+// Revoke invalidates a token by its ID on behalf of its subject. It
+// returns ErrInvalid when the subject has no such token.
+func (s *Store) Revoke(id, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, t := range s.byHash {
+		if t.ID == id && t.Subject == subject {
+			delete(s.byHash, h)
+			return nil
+		}
+	}
+	return ErrInvalid
+}
+
+// Record is a token as the store keeps it: under the SHA-256 hash of the
+// token, which is never kept itself
+type Record struct {
+	Hash  string `json:"hash"`
+	Token Token  `json:"token"`
+}
+
+// Export returns the tokens that have not expired, so that they can be
+// restored in another store
+func (s *Store) Export() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(s.now())
+	records := make([]Record, 0, len(s.byHash))
+	for h, t := range s.byHash {
+		records = append(records, Record{Hash: h, Token: *t})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Token.ID < records[j].Token.ID })
+	return records
+}
+
+// Restore adds exported tokens, replacing tokens with the same hash, and
+// returns how many it added. Expired tokens are skipped, and records that
+// are not a hash of a token are refused.
+func (s *Store) Restore(records []Record) (int, error) {
+	for _, r := range records {
+		if b, err := hex.DecodeString(r.Hash); err != nil || len(b) != sha256.Size {
+			return 0, fmt.Errorf("token %s: invalid hash", r.Token.ID)
+		}
+		if r.Token.ID == "" || r.Token.Subject == "" {
+			return 0, errors.New("tokens must have an ID and a subject")
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byHash == nil {
+		s.byHash = map[string]*Token{}
+	}
+	now := s.now()
+	restored := 0
+	for _, r := range records {
+		if !now.Before(r.Token.ExpiresAt) {
+			continue
+		}
+		t := r.Token
+		s.byHash[r.Hash] = &t
+		restored++
+	}
+	return restored, nil
+}
@@ -0,0 +1,186 @@
+// Package trace records the system calls and network activity of executed
+// code so that forensic mode can show what untrusted code attempted to do.
+package trace
+
+import (
+	"encoding/json"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Report summarizes a syscall trace
+type Report struct {
+	// Syscalls counts invocations per syscall name
+	Syscalls map[string]int `json:"syscalls"`
+
+	// Connections lists attempted network connections
+	Connections []Connection `json:"connections"`
+
+	// Executions lists programs started with execve
+	Executions []string `json:"executions"`
+
+	// FilesOpened lists the distinct paths passed to open/openat
+	FilesOpened []string `json:"files_opened"`
+
+	// Lines is the number of trace lines parsed
+	Lines int `json:"lines"`
+}
+
+// Connection represents an attempted network connection
+type Connection struct {
+	PID     int    `json:"pid"`
+	Syscall string `json:"syscall"`
+	Family  string `json:"family"`
+	Address string `json:"address"`
+	Port    int    `json:"port,omitempty"`
+	Result  string `json:"result"`
+	Allowed bool   `json:"allowed"`
+}
+
+// Available reports whether strace is installed on the host
+func Available() bool {
+	_, err := exec.LookPath("strace")
+	return err == nil
+}
+
+// Wrap prefixes a command with strace so that its syscalls (including those
+// of child processes) are written to outFile
+func Wrap(cmdArgs []string, outFile string) []string {
+	args := []string{
+		"strace", "-f", "-qq",
+		"-e", "trace=network,process,openat,open,execve",
+		"-s", "256",
+		"-o", outFile,
+		"--",
+	}
+	return append(args, cmdArgs...)
+}
+
+var (
+	lineRe       = regexp.MustCompile(`^(?:\[pid\s+)?(\d+)?\]?\s*(?:\d{2}:\d{2}:\d{2}(?:\.\d+)?\s+)?([a-z_0-9]+)\((.*)\)\s+=\s+(.*)$`)
+	unfinishedRe = regexp.MustCompile(`^(?:\[pid\s+)?(\d+)?\]?\s*(?:\d{2}:\d{2}:\d{2}(?:\.\d+)?\s+)?([a-z_0-9]+)\((.*)$`)
+	resumedRe    = regexp.MustCompile(`^(?:\[pid\s+)?(\d+)?\]?\s*<\.\.\. ([a-z_0-9]+) resumed>(.*)\)\s+=\s+(.*)$`)
+	familyRe     = regexp.MustCompile(`sa_family=(AF_[A-Z0-9]+)`)
+	portRe       = regexp.MustCompile(`sin6?_port=htons\((\d+)\)`)
+	inetRe       = regexp.MustCompile(`inet_addr\("([^"]+)"\)`)
+	inet6Re      = regexp.MustCompile(`inet_pton\(AF_INET6, "([^"]+)"`)
+	unixRe       = regexp.MustCompile(`sun_path=(@?"[^"]*")`)
+	pathRe       = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"`)
+)
+
+// Parse converts raw strace output into a Report
+func Parse(data []byte) *Report {
+	report := &Report{
+		Syscalls:    make(map[string]int),
+		Connections: []Connection{},
+		Executions:  []string{},
+		FilesOpened: []string{},
+	}
+	seenFiles := make(map[string]bool)
+	pending := make(map[string]string) // pid/syscall -> args of unfinished calls
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---") {
+			continue
+		}
+		report.Lines++
+
+		// strace -f splits calls interrupted by other processes
+		if idx := strings.Index(line, " <unfinished ...>"); idx >= 0 {
+			if m := unfinishedRe.FindStringSubmatch(line[:idx]); m != nil {
+				pending[m[1]+"/"+m[2]] = m[3]
+			}
+			continue
+		}
+
+		var pidStr, syscall, args, ret string
+		if m := resumedRe.FindStringSubmatch(line); m != nil {
+			pidStr, syscall, ret = m[1], m[2], m[4]
+			args = pending[pidStr+"/"+syscall] + m[3]
+			delete(pending, pidStr+"/"+syscall)
+		} else if m := lineRe.FindStringSubmatch(line); m != nil {
+			pidStr, syscall, args, ret = m[1], m[2], m[3], m[4]
+		} else {
+			continue
+		}
+
+		pid, _ := strconv.Atoi(pidStr)
+		report.Syscalls[syscall]++
+
+		switch syscall {
+		case "connect", "sendto", "bind":
+			if conn, ok := parseConnection(pid, syscall, args, ret); ok {
+				report.Connections = append(report.Connections, conn)
+			}
+		case "execve":
+			if m := pathRe.FindStringSubmatch(args); m != nil {
+				report.Executions = append(report.Executions, m[1])
+			}
+		case "open", "openat":
+			if m := pathRe.FindStringSubmatch(args); m != nil && !seenFiles[m[1]] {
+				seenFiles[m[1]] = true
+				report.FilesOpened = append(report.FilesOpened, m[1])
+			}
+		}
+	}
+
+	sort.Strings(report.FilesOpened)
+	return report
+}
+
+// parseConnection extracts the destination of a socket syscall
+func parseConnection(pid int, syscall, args, ret string) (Connection, bool) {
+	fm := familyRe.FindStringSubmatch(args)
+	if fm == nil {
+		return Connection{}, false
+	}
+
+	conn := Connection{
+		PID:     pid,
+		Syscall: syscall,
+		Family:  fm[1],
+		Result:  strings.TrimSpace(ret),
+		Allowed: !strings.HasPrefix(strings.TrimSpace(ret), "-1"),
+	}
+
+	switch conn.Family {
+	case "AF_INET":
+		if m := inetRe.FindStringSubmatch(args); m != nil {
+			conn.Address = m[1]
+		}
+	case "AF_INET6":
+		if m := inet6Re.FindStringSubmatch(args); m != nil {
+			conn.Address = m[1]
+		}
+	case "AF_UNIX":
+		if m := unixRe.FindStringSubmatch(args); m != nil {
+			conn.Address = strings.Trim(m[1], `"`)
+		}
+	default:
+		return Connection{}, false
+	}
+
+	if m := portRe.FindStringSubmatch(args); m != nil {
+		conn.Port, _ = strconv.Atoi(m[1])
+	}
+
+	// A connect in progress on a non-blocking socket is still an attempt
+	if strings.Contains(ret, "EINPROGRESS") {
+		conn.Allowed = true
+	}
+
+	return conn, true
+}
+
+// JSON returns the report encoded as indented JSON
+func (r *Report) JSON() []byte {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return []byte("{}")
+	}
+	return data
+}
@@ -0,0 +1,359 @@
+// Package volumes provides persistent volumes: named directories of a
+// tenant that survive across jobs, so that a session of jobs can build on
+// the files of earlier ones. A volume is mounted only into jobs that ask
+// for it, by one job at a time, and is held to a size quota.
+package volumes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metaSuffix names the file that describes a volume. It sits next to the
+// volume so that programs cannot change it.
+const metaSuffix = ".volume.json"
+
+// DefaultQuotaInterval is how often volume quotas are checked
+const DefaultQuotaInterval = 500 * time.Millisecond
+
+// DefaultTenantLabel is the job label that names the tenant of a job
+const DefaultTenantLabel = "tenant"
+
+// nameRe matches tenant and volume names
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+var (
+	// ErrNotFound is returned for volumes that do not exist
+	ErrNotFound = errors.New("volume not found")
+
+	// ErrInUse is returned when deleting a volume that a job has mounted
+	ErrInUse = errors.New("volume is in use")
+
+	// ErrLimit is returned when a tenant already has MaxPerTenant volumes
+	ErrLimit = errors.New("tenant has too many volumes")
+)
+
+// Ref names a volume of a tenant
+type Ref struct {
+	Tenant string `json:"tenant"`
+	Name   string `json:"name"`
+}
+
+// Validate checks that the tenant and volume names are well formed
+func (r Ref) Validate() error {
+	if !nameRe.MatchString(r.Tenant) {
+		return fmt.Errorf("invalid tenant name: %q", r.Tenant)
+	}
+	if !nameRe.MatchString(r.Name) {
+		return fmt.Errorf("invalid volume name: %q", r.Name)
+	}
+	return nil
+}
+
+// Volume describes a persistent volume
+type Volume struct {
+	Tenant     string    `json:"tenant"`
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Quota      int64     `json:"quota,omitempty"`
+	InUse      bool      `json:"in_use"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// Manager keeps the volumes of all tenants below a root directory, in
+// Root/<tenant>/<volume>
+type Manager struct {
+	// Root is the directory that holds all volumes
+	Root string
+
+	// Quota is the maximum size in bytes of one volume; zero disables it
+	Quota int64
+
+	// MaxPerTenant is how many volumes a tenant may have; unlimited when
+	// zero
+	MaxPerTenant int
+
+	// TenantLabel is the job label that names the tenant of a job, which
+	// must be the tenant whose volumes it mounts; DefaultTenantLabel when
+	// empty
+	TenantLabel string
+
+	// QuotaInterval is how often quotas are checked
+	QuotaInterval time.Duration
+
+	mu    sync.Mutex
+	locks map[Ref]chan struct{}
+}
+
+// NewManager creates a volume manager rooted at root
+func NewManager(root string) *Manager {
+	return &Manager{
+		Root:          root,
+		QuotaInterval: DefaultQuotaInterval,
+		locks:         make(map[Ref]chan struct{}),
+	}
+}
+
+// Open prepares the root
+func (m *Manager) Open() error {
+	if err := os.MkdirAll(m.Root, 0700); err != nil {
+		return fmt.Errorf("failed to create volume root: %w", err)
+	}
+	return nil
+}
+
+// Tenant returns the tenant named by a job's labels
+func (m *Manager) Tenant(labels map[string]string) string {
+	label := m.TenantLabel
+	if label == "" {
+		label = DefaultTenantLabel
+	}
+	return labels[label]
+}
+
+// Path returns the directory of a volume
+func (m *Manager) Path(ref Ref) string {
+	return filepath.Join(m.Root, ref.Tenant, ref.Name)
+}
+
+// Acquire mounts a volume for a job, creating it on first use. It waits
+// while another job has the volume mounted, until ctx is done.
+func (m *Manager) Acquire(ctx context.Context, ref Ref) (*Lease, error) {
+	if err := ref.Validate(); err != nil {
+		return nil, err
+	}
+
+	for {
+		m.mu.Lock()
+		if m.locks == nil {
+			m.locks = make(map[Ref]chan struct{})
+		}
+		held, busy := m.locks[ref]
+		if !busy {
+			m.locks[ref] = make(chan struct{})
+			m.mu.Unlock()
+			break
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	lease := &Lease{Ref: ref, Path: m.Path(ref), manager: m}
+	if err := m.create(ref); err != nil {
+		lease.Release()
+		return nil, err
+	}
+	return lease, nil
+}
+
+// create makes a volume that does not exist yet. The caller must hold the
+// volume's lock.
+func (m *Manager) create(ref Ref) error {
+	if _, err := os.Stat(m.Path(ref)); err == nil {
+		return nil
+	}
+	if m.MaxPerTenant > 0 && len(m.names(ref.Tenant)) >= m.MaxPerTenant {
+		return fmt.Errorf("%w: the limit is %d", ErrLimit, m.MaxPerTenant)
+	}
+	if err := os.MkdirAll(m.Path(ref), 0700); err != nil {
+		return fmt.Errorf("failed to create volume: %w", err)
+	}
+	now := time.Now().UTC()
+	return m.writeMeta(ref, Volume{Tenant: ref.Tenant, Name: ref.Name, CreatedAt: now, LastUsedAt: now})
+}
+
+// List returns the volumes of a tenant sorted by name
+func (m *Manager) List(tenant string) []Volume {
+	list := []Volume{}
+	for _, name := range m.names(tenant) {
+		if v, err := m.Get(Ref{Tenant: tenant, Name: name}); err == nil {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// Get describes a volume
+func (m *Manager) Get(ref Ref) (Volume, error) {
+	if err := ref.Validate(); err != nil {
+		return Volume{}, err
+	}
+	info, err := os.Stat(m.Path(ref))
+	if err != nil || !info.IsDir() {
+		return Volume{}, ErrNotFound
+	}
+
+	var v Volume
+	if data, err := os.ReadFile(m.Path(ref) + metaSuffix); err == nil {
+		json.Unmarshal(data, &v)
+	}
+	v.Tenant, v.Name = ref.Tenant, ref.Name
+	v.Quota = m.Quota
+	v.Size, _ = usage(m.Path(ref))
+
+	m.mu.Lock()
+	_, v.InUse = m.locks[ref]
+	m.mu.Unlock()
+	return v, nil
+}
+
+// Delete removes a volume and its files. Volumes mounted by a job cannot
+// be deleted.
+func (m *Manager) Delete(ref Ref) error {
+	if err := ref.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, busy := m.locks[ref]; busy {
+		return ErrInUse
+	}
+	if _, err := os.Stat(m.Path(ref)); err != nil {
+		return ErrNotFound
+	}
+	if err := os.RemoveAll(m.Path(ref)); err != nil {
+		return fmt.Errorf("failed to delete volume: %w", err)
+	}
+	os.Remove(m.Path(ref) + metaSuffix)
+	return nil
+}
+
+// names returns the names of a tenant's volumes
+func (m *Manager) names(tenant string) []string {
+	if !nameRe.MatchString(tenant) {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(m.Root, tenant))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeMeta records the description of a volume
+func (m *Manager) writeMeta(ref Ref, v Volume) error {
+	data, err := json.Marshal(Volume{Tenant: v.Tenant, Name: v.Name, CreatedAt: v.CreatedAt, LastUsedAt: v.LastUsedAt})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.Path(ref)+metaSuffix, data, 0600); err != nil {
+		return fmt.Errorf("failed to record volume: %w", err)
+	}
+	return nil
+}
+
+// Lease is a volume mounted by one job
+type Lease struct {
+	Ref  Ref
+	Path string
+
+	manager  *Manager
+	exceeded int32
+	once     sync.Once
+}
+
+// Enforce returns a context that is cancelled when the volume grows past
+// the manager's quota. Call the returned function to stop checking.
+func (l *Lease) Enforce(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if l.manager.Quota <= 0 {
+		return ctx, cancel
+	}
+
+	interval := l.manager.QuotaInterval
+	if interval <= 0 {
+		interval = DefaultQuotaInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if size, err := usage(l.Path); err == nil && size > l.manager.Quota {
+					atomic.StoreInt32(&l.exceeded, 1)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, cancel
+}
+
+// QuotaExceeded reports whether Enforce stopped the job for growing the
+// volume past its quota, or the volume is over its quota now
+func (l *Lease) QuotaExceeded() bool {
+	if atomic.LoadInt32(&l.exceeded) == 1 {
+		return true
+	}
+	if l.manager.Quota <= 0 {
+		return false
+	}
+	size, err := usage(l.Path)
+	return err == nil && size > l.manager.Quota
+}
+
+// Release unmounts the volume, recording when it was last used, and lets
+// the next job waiting for it proceed
+func (l *Lease) Release() {
+	l.once.Do(func() {
+		m := l.manager
+		if v, err := m.Get(l.Ref); err == nil {
+			v.LastUsedAt = time.Now().UTC()
+			m.writeMeta(l.Ref, v)
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if held, ok := m.locks[l.Ref]; ok {
+			delete(m.locks, l.Ref)
+			close(held)
+		}
+	})
+}
+
+// usage returns the total size of the files in a directory
+func usage(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may disappear while the program is still running
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,18 @@
+package watchdog
+
+import "sync"
+
+// HostSampler measures whole-host usage, which includes every sandbox
+type HostSampler struct {
+	// DiskPath is a path on the file system whose use is measured
+	DiskPath string
+
+	mu        sync.Mutex
+	prevBusy  uint64
+	prevTotal uint64
+}
+
+// NewHostSampler creates a sampler that measures disk use at diskPath
+func NewHostSampler(diskPath string) *HostSampler {
+	return &HostSampler{DiskPath: diskPath}
+}
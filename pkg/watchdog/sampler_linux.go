@@ -0,0 +1,106 @@
+package watchdog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Sample implements Sampler. CPU use is measured since the previous sample,
+// or since boot for the first one.
+func (s *HostSampler) Sample() (Usage, error) {
+	var usage Usage
+
+	cpu, err := s.cpuPercent()
+	if err != nil {
+		return usage, err
+	}
+	usage.CPUPercent = cpu
+
+	usage.MemoryPercent, err = memoryPercent()
+	if err != nil {
+		return usage, err
+	}
+
+	if s.DiskPath != "" {
+		var fs syscall.Statfs_t
+		if err := syscall.Statfs(s.DiskPath, &fs); err != nil {
+			return usage, fmt.Errorf("failed to stat %s: %w", s.DiskPath, err)
+		}
+		used := fs.Blocks - fs.Bfree
+		if total := used + fs.Bavail; total > 0 {
+			usage.DiskPercent = float64(used) * 100 / float64(total)
+		}
+	}
+
+	return usage, nil
+}
+
+// cpuPercent reads the aggregate CPU line of /proc/stat
+func (s *HostSampler) cpuPercent() (float64, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read CPU stats: %w", err)
+	}
+
+	line := strings.SplitN(string(data), "\n", 2)[0]
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, fmt.Errorf("unexpected /proc/stat format")
+	}
+
+	var total, idle uint64
+	for i, field := range fields[1:] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected /proc/stat format: %w", err)
+		}
+		total += value
+		// idle and iowait
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+	busy := total - idle
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deltaBusy, deltaTotal := busy-s.prevBusy, total-s.prevTotal
+	s.prevBusy, s.prevTotal = busy, total
+	if deltaTotal == 0 {
+		return 0, nil
+	}
+	return float64(deltaBusy) * 100 / float64(deltaTotal), nil
+}
+
+// memoryPercent reads MemTotal and MemAvailable from /proc/meminfo
+func memoryPercent() (float64, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read memory stats: %w", err)
+	}
+	defer file.Close()
+
+	var total, available uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "MemAvailable:":
+			available, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("MemTotal missing from /proc/meminfo")
+	}
+	return float64(total-available) * 100 / float64(total), nil
+}
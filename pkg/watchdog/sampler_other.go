@@ -0,0 +1,10 @@
+//go:build !linux
+
+package watchdog
+
+import "fmt"
+
+// Sample implements Sampler. Host sampling is only implemented on Linux.
+func (s *HostSampler) Sample() (Usage, error) {
+	return Usage{}, fmt.Errorf("host usage sampling is not supported on this platform")
+}
@@ -0,0 +1,190 @@
+// Package watchdog protects the host from the aggregate load of sandboxed
+// jobs. It pauses job intake when CPU, memory, or disk use crosses soft
+// limits and cancels running jobs when hard limits are crossed.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"forgeai/pkg/jobs"
+)
+
+// Kill policies select which running job is cancelled first
+const (
+	// PolicyNewest cancels the most recently started job, losing the least work
+	PolicyNewest = "newest"
+
+	// PolicyOldest cancels the longest running job
+	PolicyOldest = "oldest"
+
+	// PolicyNone never cancels jobs
+	PolicyNone = "none"
+)
+
+// Usage is host resource use in percent
+type Usage struct {
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryPercent float64 `json:"memory_percent"`
+	DiskPercent   float64 `json:"disk_percent"`
+}
+
+// Thresholds are usage limits in percent; zero disables a limit
+type Thresholds struct {
+	CPUPercent    float64 `json:"cpu_percent,omitempty"`
+	MemoryPercent float64 `json:"memory_percent,omitempty"`
+	DiskPercent   float64 `json:"disk_percent,omitempty"`
+}
+
+// Exceeded describes the limits that usage is at or above, after lowering
+// every limit by margin percentage points
+func (t Thresholds) Exceeded(u Usage, margin float64) []string {
+	var exceeded []string
+	check := func(name string, value, limit float64) {
+		if limit > 0 && value >= limit-margin {
+			exceeded = append(exceeded, fmt.Sprintf("%s %.0f%% >= %.0f%%", name, value, limit-margin))
+		}
+	}
+	check("cpu", u.CPUPercent, t.CPUPercent)
+	check("memory", u.MemoryPercent, t.MemoryPercent)
+	check("disk", u.DiskPercent, t.DiskPercent)
+	return exceeded
+}
+
+// Sampler measures host resource use
+type Sampler interface {
+	Sample() (Usage, error)
+}
+
+// Status is the state of the watchdog after its last check
+type Status struct {
+	Usage     Usage     `json:"usage"`
+	Paused    bool      `json:"paused"`
+	Reason    string    `json:"reason,omitempty"`
+	Killed    int       `json:"killed"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Watchdog samples host usage and sheds load from a job manager
+type Watchdog struct {
+	Sampler  Sampler
+	Interval time.Duration
+
+	// Pause stops job intake when any limit is reached
+	Pause Thresholds
+
+	// Kill cancels one running job per check, chosen by Policy, while any
+	// limit is exceeded
+	Kill   Thresholds
+	Policy string
+
+	// ResumeMargin is how many percentage points usage must fall below the
+	// Pause limits before intake resumes
+	ResumeMargin float64
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates a watchdog with default limits that samples the host, using
+// diskPath to measure disk use
+func New(diskPath string) *Watchdog {
+	return &Watchdog{
+		Sampler:  NewHostSampler(diskPath),
+		Interval: 2 * time.Second,
+		Pause: Thresholds{
+			CPUPercent:    90,
+			MemoryPercent: 85,
+			DiskPercent:   90,
+		},
+		Kill: Thresholds{
+			MemoryPercent: 95,
+			DiskPercent:   97,
+		},
+		Policy:       PolicyNewest,
+		ResumeMargin: 10,
+	}
+}
+
+// Run checks the host every Interval until ctx is done
+func (w *Watchdog) Run(ctx context.Context, manager *jobs.Manager) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.Check(manager)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check samples the host once and pauses, resumes, or cancels jobs
+func (w *Watchdog) Check(manager *jobs.Manager) Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.status.CheckedAt = time.Now()
+	usage, err := w.Sampler.Sample()
+	if err != nil {
+		w.status.Error = err.Error()
+		return w.status
+	}
+	w.status.Usage = usage
+	w.status.Error = ""
+
+	// Pause at the limits and resume only once usage is clearly below them
+	if exceeded := w.Pause.Exceeded(usage, 0); len(exceeded) > 0 {
+		reason := "host overloaded: " + strings.Join(exceeded, ", ")
+		manager.Pause(reason)
+		w.status.Paused = true
+		w.status.Reason = reason
+	} else if w.status.Paused && len(w.Pause.Exceeded(usage, w.ResumeMargin)) == 0 {
+		manager.Resume()
+		w.status.Paused = false
+		w.status.Reason = ""
+	}
+
+	if exceeded := w.Kill.Exceeded(usage, 0); len(exceeded) > 0 && w.Policy != PolicyNone {
+		if job := w.victim(manager); job != nil {
+			reason := "cancelled by host watchdog: " + strings.Join(exceeded, ", ")
+			if manager.AbortJob(job.ID, reason) {
+				w.status.Killed++
+				fmt.Printf("Warning: watchdog cancelled job %s: %s\n", job.ID, strings.Join(exceeded, ", "))
+			}
+		}
+	}
+
+	return w.status
+}
+
+// victim picks the running job to cancel according to Policy
+func (w *Watchdog) victim(manager *jobs.Manager) *jobs.Job {
+	running := manager.ListJobs(jobs.Filter{Status: "running"})
+	if len(running) == 0 {
+		return nil
+	}
+
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].StartedAt.Before(running[j].StartedAt)
+	})
+	if w.Policy == PolicyOldest {
+		return running[0]
+	}
+	return running[len(running)-1]
+}
+
+// Status returns the result of the last check
+func (w *Watchdog) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
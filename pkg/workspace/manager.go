@@ -0,0 +1,300 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ownerSuffix names the file that records who owns a workspace. It sits next
+// to the workspace so that it never shows up in workspace diffs.
+const ownerSuffix = ".owner.json"
+
+// DefaultQuotaInterval is how often workspace quotas are checked
+const DefaultQuotaInterval = 500 * time.Millisecond
+
+// Owner records the job and process that own a workspace
+type Owner struct {
+	JobID     string    `json:"job_id"`
+	PID       int       `json:"pid"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Stats reports workspace usage
+type Stats struct {
+	Root          string `json:"root"`
+	Tmpfs         bool   `json:"tmpfs"`
+	Active        int    `json:"active"`
+	BytesInUse    int64  `json:"bytes_in_use"`
+	Created       int64  `json:"created"`
+	Released      int64  `json:"released"`
+	Collected     int64  `json:"collected"`
+	QuotaExceeded int64  `json:"quota_exceeded"`
+}
+
+// Manager creates execution workspaces below a root directory, tracks their
+// owners, and removes workspaces left behind by crashed processes
+type Manager struct {
+	// Root is the directory that holds all workspaces
+	Root string
+
+	// Tmpfs mounts a tmpfs of TmpfsSize bytes on Root (Linux only, requires
+	// CAP_SYS_ADMIN)
+	Tmpfs     bool
+	TmpfsSize int64
+
+	// Quota is the maximum size in bytes of one workspace; zero disables it
+	Quota int64
+
+	// QuotaInterval is how often quotas are checked
+	QuotaInterval time.Duration
+
+	mu     sync.Mutex
+	active map[string]*Workspace
+
+	created       int64
+	released      int64
+	collected     int64
+	quotaExceeded int64
+}
+
+// NewManager creates a workspace manager rooted at root
+func NewManager(root string) *Manager {
+	return &Manager{
+		Root:          root,
+		QuotaInterval: DefaultQuotaInterval,
+		active:        make(map[string]*Workspace),
+	}
+}
+
+// Open prepares the root, mounting tmpfs if configured, and removes
+// workspaces whose owning process is gone. It returns the number of
+// workspaces removed.
+func (m *Manager) Open() (int, error) {
+	if err := os.MkdirAll(m.Root, 0700); err != nil {
+		return 0, fmt.Errorf("failed to create workspace root: %w", err)
+	}
+
+	if m.Tmpfs {
+		if err := mountTmpfs(m.Root, m.TmpfsSize); err != nil {
+			return 0, fmt.Errorf("failed to mount tmpfs on %s: %w", m.Root, err)
+		}
+	}
+
+	return m.Collect()
+}
+
+// Collect removes workspaces below Root that are not owned by a live
+// process, along with stray owner files
+func (m *Manager) Collect() (int, error) {
+	entries, err := os.ReadDir(m.Root)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read workspace root: %w", err)
+	}
+
+	// Hold the lock so that workspaces being created are not collected
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(m.Root, name)
+
+		if !entry.IsDir() {
+			// Owner files without a workspace
+			if strings.HasSuffix(name, ownerSuffix) {
+				if _, err := os.Stat(strings.TrimSuffix(path, ownerSuffix)); os.IsNotExist(err) {
+					os.Remove(path)
+				}
+			}
+			continue
+		}
+
+		if _, inUse := m.active[path]; inUse {
+			continue
+		}
+
+		// Workspaces without a readable owner were abandoned while being
+		// created. Workspaces recorded with this process's PID but not in use
+		// were left by an earlier process that had the same PID.
+		owner, err := readOwner(path)
+		if err == nil && owner.PID != os.Getpid() && ProcessAlive(owner.PID) {
+			continue
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			return removed, fmt.Errorf("failed to remove stale workspace %s: %w", name, err)
+		}
+		os.Remove(path + ownerSuffix)
+		removed++
+	}
+
+	atomic.AddInt64(&m.collected, int64(removed))
+	return removed, nil
+}
+
+// Create makes a workspace owned by jobID
+func (m *Manager) Create(jobID string) (*Workspace, error) {
+	prefix := "ws-"
+	if jobID != "" {
+		prefix = sanitize(jobID) + "-"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, err := os.MkdirTemp(m.Root, prefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	owner := Owner{JobID: jobID, PID: os.Getpid(), CreatedAt: time.Now().UTC()}
+	data, _ := json.Marshal(owner)
+	if err := os.WriteFile(path+ownerSuffix, data, 0600); err != nil {
+		os.RemoveAll(path)
+		return nil, fmt.Errorf("failed to record workspace owner: %w", err)
+	}
+
+	ws := &Workspace{Path: path, Owner: owner, manager: m}
+	m.active[path] = ws
+	atomic.AddInt64(&m.created, 1)
+
+	return ws, nil
+}
+
+// Stats returns current workspace usage
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	workspaces := make([]*Workspace, 0, len(m.active))
+	for _, ws := range m.active {
+		workspaces = append(workspaces, ws)
+	}
+	m.mu.Unlock()
+
+	stats := Stats{
+		Root:          m.Root,
+		Tmpfs:         m.Tmpfs,
+		Active:        len(workspaces),
+		Created:       atomic.LoadInt64(&m.created),
+		Released:      atomic.LoadInt64(&m.released),
+		Collected:     atomic.LoadInt64(&m.collected),
+		QuotaExceeded: atomic.LoadInt64(&m.quotaExceeded),
+	}
+	for _, ws := range workspaces {
+		if size, err := ws.Usage(); err == nil {
+			stats.BytesInUse += size
+		}
+	}
+	return stats
+}
+
+// Workspace is a directory owned by one job
+type Workspace struct {
+	Path  string
+	Owner Owner
+
+	manager  *Manager
+	exceeded int32
+}
+
+// Usage returns the total size of the files in the workspace
+func (ws *Workspace) Usage() (int64, error) {
+	var size int64
+	err := filepath.Walk(ws.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may disappear while the program is still running
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Enforce returns a context that is cancelled when the workspace grows past
+// the manager's quota. Call the returned function to stop checking.
+func (ws *Workspace) Enforce(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if ws.manager.Quota <= 0 {
+		return ctx, cancel
+	}
+
+	interval := ws.manager.QuotaInterval
+	if interval <= 0 {
+		interval = DefaultQuotaInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if size, err := ws.Usage(); err == nil && size > ws.manager.Quota {
+					atomic.StoreInt32(&ws.exceeded, 1)
+					atomic.AddInt64(&ws.manager.quotaExceeded, 1)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, cancel
+}
+
+// QuotaExceeded reports whether Enforce stopped the workspace for growing
+// past its quota
+func (ws *Workspace) QuotaExceeded() bool {
+	return atomic.LoadInt32(&ws.exceeded) == 1
+}
+
+// Release removes the workspace
+func (ws *Workspace) Release() error {
+	m := ws.manager
+	m.mu.Lock()
+	delete(m.active, ws.Path)
+	m.mu.Unlock()
+	atomic.AddInt64(&m.released, 1)
+
+	err := os.RemoveAll(ws.Path)
+	os.Remove(ws.Path + ownerSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to remove workspace: %w", err)
+	}
+	return nil
+}
+
+// readOwner reads the owner file of a workspace
+func readOwner(path string) (Owner, error) {
+	var owner Owner
+	data, err := os.ReadFile(path + ownerSuffix)
+	if err != nil {
+		return owner, err
+	}
+	err = json.Unmarshal(data, &owner)
+	return owner, err
+}
+
+// sanitize makes a job ID safe to use in a directory name
+func sanitize(id string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, id)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package workspace
+
+// ProcessAlive cannot check other processes on this platform, so every
+// workspace or container not in use by this process is considered stale
+func ProcessAlive(pid int) bool {
+	return false
+}
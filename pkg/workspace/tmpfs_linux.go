@@ -0,0 +1,23 @@
+package workspace
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// tmpfsMagic is the file system type of tmpfs in statfs
+const tmpfsMagic = 0x01021994
+
+// mountTmpfs mounts a tmpfs on dir unless one is already mounted there
+func mountTmpfs(dir string, size int64) error {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err == nil && fs.Type == tmpfsMagic {
+		return nil
+	}
+
+	options := "mode=0700"
+	if size > 0 {
+		options += fmt.Sprintf(",size=%d", size)
+	}
+	return syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, options)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package workspace
+
+import "fmt"
+
+// mountTmpfs is only supported on Linux
+func mountTmpfs(dir string, size int64) error {
+	return fmt.Errorf("tmpfs workspaces are only supported on Linux")
+}
@@ -0,0 +1,135 @@
+// Package workspace records the files in an execution workspace so the
+// changes made by a program can be reported with its result.
+package workspace
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"forgeai/pkg/sandbox"
+)
+
+// MaxFiles bounds the number of files recorded in a snapshot
+const MaxFiles = 10000
+
+// MaxInlineTotal bounds the combined size of files inlined into one result
+const MaxInlineTotal = 4 << 20
+
+// Snapshot maps workspace-relative paths to file entries
+type Snapshot map[string]sandbox.FileChange
+
+// Take records the size and SHA-256 hash of every regular file below dir
+func Take(dir string) (Snapshot, error) {
+	snapshot := make(Snapshot)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files may disappear while the program is still cleaning up
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if len(snapshot) >= MaxFiles {
+			return fmt.Errorf("workspace has more than %d files", MaxFiles)
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+
+		snapshot[filepath.ToSlash(rel)] = sandbox.FileChange{
+			Path:   filepath.ToSlash(rel),
+			Size:   info.Size(),
+			SHA256: hash,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot workspace: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// Diff compares two snapshots of the same workspace
+func Diff(before, after Snapshot) *sandbox.WorkspaceDiff {
+	diff := &sandbox.WorkspaceDiff{
+		Created:  []sandbox.FileChange{},
+		Modified: []sandbox.FileChange{},
+		Deleted:  []sandbox.FileChange{},
+	}
+
+	for path, entry := range after {
+		old, ok := before[path]
+		switch {
+		case !ok:
+			diff.Created = append(diff.Created, entry)
+		case old.SHA256 != entry.SHA256:
+			diff.Modified = append(diff.Modified, entry)
+		}
+	}
+	for path, entry := range before {
+		if _, ok := after[path]; !ok {
+			diff.Deleted = append(diff.Deleted, entry)
+		}
+	}
+
+	sortChanges(diff.Created)
+	sortChanges(diff.Modified)
+	sortChanges(diff.Deleted)
+	return diff
+}
+
+// Inline reads created and modified files of at most maxSize bytes into the
+// diff, until MaxInlineTotal bytes have been inlined
+func Inline(dir string, diff *sandbox.WorkspaceDiff, maxSize int64) {
+	var total int64
+
+	for _, changes := range [][]sandbox.FileChange{diff.Created, diff.Modified} {
+		for i := range changes {
+			change := &changes[i]
+			if change.Size > maxSize || total+change.Size > MaxInlineTotal {
+				continue
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(change.Path)))
+			if err != nil || int64(len(data)) > maxSize {
+				continue
+			}
+			change.Data = data
+			total += int64(len(data))
+		}
+	}
+}
+
+func sortChanges(changes []sandbox.FileChange) {
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
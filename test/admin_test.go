@@ -0,0 +1,244 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/apikeys"
+	"forgeai/pkg/authz"
+	"forgeai/pkg/client"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+	"forgeai/pkg/templates"
+)
+
+func TestDeclarativeAdminAPI(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+	dir := authz.NewDirectory("")
+	if err := dir.Import([]byte("team-data-science: [alice]\nteam-ops: [bob]\n")); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	httpClient, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		AdminToken: "admin-secret",
+		Directory:  dir,
+		Settings: api.Settings{
+			Authz:  teamPolicy,
+			Images: map[string]string{"python": "python:3.11-alpine"},
+		},
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+	ctx := context.Background()
+
+	admin := &client.Client{
+		Server:     "http://forgeai",
+		HTTPClient: httpClient,
+		Header:     http.Header{"Authorization": {"Bearer admin-secret"}},
+	}
+	runAs := func(key string) error {
+		c := *admin
+		c.Header = http.Header{"Authorization": {"Bearer " + key}}
+		_, err := c.Execute(ctx, "python", "print(1)")
+		return err
+	}
+	statusOf := func(err error) int {
+		var status *client.StatusError
+		if errors.As(err, &status) {
+			return status.StatusCode
+		}
+		return 0
+	}
+
+	// Templates are put by name, and putting one again changes nothing
+	tmpl := templates.Template{Language: "py", Code: "print({{n}})", Parameters: []templates.Parameter{{Name: "n", Type: "int"}}}
+	tmpl.Name = "double"
+	first, err := admin.PutTemplate(ctx, tmpl)
+	if err != nil {
+		t.Fatalf("PutTemplate failed: %v", err)
+	}
+	again, err := admin.PutTemplate(ctx, tmpl)
+	if err != nil || !again.CreatedAt.Equal(first.CreatedAt) || again.Language != "python" {
+		t.Errorf("Expected an idempotent put, got %+v then %+v (%v)", first, again, err)
+	}
+	if err := admin.DeleteTemplate(ctx, "double"); err != nil {
+		t.Fatalf("DeleteTemplate failed: %v", err)
+	}
+	if _, err := admin.GetTemplate(ctx, "double"); !client.IsNotFound(err) {
+		t.Errorf("Expected the deleted template to be not found, got %v", err)
+	}
+
+	// API keys authenticate as their subject; only creation returns the key
+	created, err := admin.PutAPIKey(ctx, "ci-bob", apikeys.Spec{Subject: "bob"})
+	if err != nil || !strings.HasPrefix(created.Secret, apikeys.Prefix) {
+		t.Fatalf("Expected the key with its secret, got %+v (%v)", created, err)
+	}
+	updated, err := admin.PutAPIKey(ctx, "ci-bob", apikeys.Spec{Subject: "bob", Description: "CI runner"})
+	if err != nil || updated.Secret != "" || updated.Hint != created.Hint || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("Expected an update to keep the secret, got %+v (%v)", updated, err)
+	}
+	if _, err := admin.PutAPIKey(ctx, "Not An ID", apikeys.Spec{Subject: "bob"}); statusOf(err) != http.StatusBadRequest {
+		t.Errorf("Expected an invalid ID to be refused, got %v", err)
+	}
+
+	// Policies set through the API grant groups that the configuration
+	// file does not
+	if err := runAs(created.Secret); statusOf(err) != http.StatusForbidden {
+		t.Errorf("Expected bob to be denied without a policy, got %v", err)
+	}
+	policy, err := admin.PutPolicy(ctx, "team-ops", authz.Grant{Languages: []string{"py"}, MaxTimeout: 60})
+	if err != nil || !policy.Managed || policy.Languages[0] != "python" {
+		t.Fatalf("Expected a managed policy, got %+v (%v)", policy, err)
+	}
+	if _, err := admin.PutPolicy(ctx, "team-ops", authz.Grant{Languages: []string{"python"}, MaxTimeout: 60}); err != nil {
+		t.Errorf("Expected putting the policy again to succeed, got %v", err)
+	}
+	if err := runAs(created.Secret); err != nil {
+		t.Errorf("Expected bob's key to run python, got %v", err)
+	}
+	policies, err := admin.ListPolicies(ctx)
+	if err != nil || len(policies) != 3 || policies[0].Group != "team-data-science" || policies[0].Managed {
+		t.Errorf("Expected the policies of the file and the API, got %+v (%v)", policies, err)
+	}
+	if err := admin.DeletePolicy(ctx, "team-frontend"); statusOf(err) != http.StatusConflict {
+		t.Errorf("Expected policies of the file not to be deletable, got %v", err)
+	}
+	if _, err := admin.PutPolicy(ctx, "team-ops", authz.Grant{}); statusOf(err) != http.StatusBadRequest {
+		t.Errorf("Expected a grant of no language to be refused, got %v", err)
+	}
+
+	// A rotated or deleted key stops authenticating
+	rotated, err := admin.RotateAPIKey(ctx, "ci-bob")
+	if err != nil || rotated.Secret == "" || rotated.Secret == created.Secret {
+		t.Fatalf("Expected a new secret, got %+v (%v)", rotated, err)
+	}
+	if err := runAs(created.Secret); statusOf(err) != http.StatusUnauthorized {
+		t.Errorf("Expected the old secret to be refused, got %v", err)
+	}
+	if err := admin.DeletePolicy(ctx, "team-ops"); err != nil {
+		t.Fatalf("DeletePolicy failed: %v", err)
+	}
+	if err := runAs(rotated.Secret); statusOf(err) != http.StatusForbidden {
+		t.Errorf("Expected bob to be denied after the policy was deleted, got %v", err)
+	}
+	if err := admin.DeleteAPIKey(ctx, "ci-bob"); err != nil {
+		t.Fatalf("DeleteAPIKey failed: %v", err)
+	}
+	if _, err := admin.GetAPIKey(ctx, "ci-bob"); !client.IsNotFound(err) {
+		t.Errorf("Expected the deleted key to be not found, got %v", err)
+	}
+
+	// Environments replace the images of the configuration file until
+	// they are deleted
+	env, err := admin.GetEnvironment(ctx, "python")
+	if err != nil || env.Image != "python:3.11-alpine" || env.Managed {
+		t.Errorf("Expected the configured image, got %+v (%v)", env, err)
+	}
+	env, err = admin.PutEnvironment(ctx, client.Environment{
+		Language:   "python",
+		Image:      "python:3.12-slim",
+		ArchImages: map[string]string{"arm64": "arm64v8/python:3.12-slim"},
+	})
+	if err != nil || !env.Managed || env.ArchImages["arm64"] != "arm64v8/python:3.12-slim" {
+		t.Errorf("Expected a managed environment, got %+v (%v)", env, err)
+	}
+	if _, err := admin.PutEnvironment(ctx, client.Environment{Language: "python", Image: "bad image"}); statusOf(err) != http.StatusBadRequest {
+		t.Errorf("Expected an invalid image to be refused, got %v", err)
+	}
+	env, err = admin.DeleteEnvironment(ctx, "python")
+	if err != nil || env.Image != "python:3.11-alpine" || env.Managed {
+		t.Errorf("Expected the configured image again, got %+v (%v)", env, err)
+	}
+	if _, err := admin.GetEnvironment(ctx, "cobol"); !client.IsNotFound(err) {
+		t.Errorf("Expected an unknown language to be not found, got %v", err)
+	}
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	httpClient, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		AdminToken: "admin-secret",
+		Admins:     []string{"alice"},
+	})
+	ctx := context.Background()
+	as := func(credential string) *client.Client {
+		c := &client.Client{Server: "http://forgeai", HTTPClient: httpClient}
+		if credential != "" {
+			c.Header = http.Header{"Authorization": {"Bearer " + credential}}
+		}
+		return c
+	}
+	statusOf := func(err error) int {
+		var status *client.StatusError
+		if errors.As(err, &status) {
+			return status.StatusCode
+		}
+		return 0
+	}
+
+	alice, err := as("admin-secret").PutAPIKey(ctx, "alice", apikeys.Spec{Subject: "alice"})
+	if err != nil {
+		t.Fatalf("Expected the admin token to create a key, got %v", err)
+	}
+	bob, err := as(alice.Secret).PutAPIKey(ctx, "bob", apikeys.Spec{Subject: "bob"})
+	if err != nil {
+		t.Fatalf("Expected the key of an admin to create a key, got %v", err)
+	}
+
+	// Callers that are not admins can neither mint keys nor take them over
+	if _, err := as("").PutAPIKey(ctx, "mallory", apikeys.Spec{Subject: "alice"}); statusOf(err) != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %v", err)
+	}
+	if _, err := as(bob.Secret).PutAPIKey(ctx, "mallory", apikeys.Spec{Subject: "alice"}); statusOf(err) != http.StatusForbidden {
+		t.Errorf("Expected 403 for a key of another user, got %v", err)
+	}
+	if _, err := as(bob.Secret).RotateAPIKey(ctx, "alice"); statusOf(err) != http.StatusForbidden {
+		t.Errorf("Expected 403 for rotating another key, got %v", err)
+	}
+	if _, err := as("wrong-secret").ListAPIKeys(ctx); statusOf(err) != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %v", err)
+	}
+
+	// Every admin route is guarded, on each API version
+	for _, path := range []string{"/v1/admin/quotas", "/v1/admin/state", "/v1/admin/maintenance", "/v2/admin/apikeys", "/v1/admin/policies"} {
+		req, _ := http.NewRequest(http.MethodGet, "http://forgeai"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+bob.Secret)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected 403 for %s, got %d", path, resp.StatusCode)
+		}
+	}
+	for _, path := range []string{"/v1/admin/encryption/rotate", "/v1/admin/backfill"} {
+		req, _ := http.NewRequest(http.MethodPost, "http://forgeai"+path, nil)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for %s, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestAdminAPIDisabled(t *testing.T) {
+	httpClient, _ := startTestServer(t, &api.Config{Permissive: true})
+	c := &client.Client{Server: "http://forgeai", HTTPClient: httpClient}
+	_, err := c.PutAPIKey(context.Background(), "bob", apikeys.Spec{Subject: "bob"})
+	var status *client.StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected the admin API to refuse requests without admins, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/analytics"
+	"forgeai/pkg/joblog"
+)
+
+func TestAnalyticsSummarize(t *testing.T) {
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	records := []analytics.Record{
+		{Language: "python", Status: "completed", CreatedAt: day, Duration: 100 * time.Millisecond, Labels: map[string]string{"tenant": "acme"}},
+		{Language: "python", Status: "completed", CreatedAt: day.Add(time.Hour), Duration: 300 * time.Millisecond, Labels: map[string]string{"tenant": "acme"}},
+		{Language: "python", Status: "failed", Error: "program exited with code 1", CreatedAt: day.Add(25 * time.Hour), Duration: 200 * time.Millisecond, Labels: map[string]string{"tenant": "globex"}},
+		{Language: "go", Status: "failed", Error: "Execution timed out", CreatedAt: day.Add(26 * time.Hour)},
+		{Language: "go", Status: "failed", Error: "program exited with code 1", CreatedAt: day.Add(27 * time.Hour)},
+		{Language: "go", Status: "running", CreatedAt: day.Add(28 * time.Hour)},
+		{Language: "go", Status: "completed", CreatedAt: day.Add(-time.Hour)},
+	}
+
+	report := analytics.Summarize(records, analytics.Options{Since: day})
+	if report.Jobs != 5 {
+		t.Fatalf("Expected 5 finished jobs in range, got %d", report.Jobs)
+	}
+	if report.SuccessRate != 0.4 {
+		t.Errorf("Expected a success rate of 0.4, got %v", report.SuccessRate)
+	}
+	if len(report.Languages) != 2 || report.Languages[0].Language != "python" || report.Languages[0].Completed != 2 {
+		t.Errorf("Unexpected language stats: %+v", report.Languages)
+	}
+	if p95 := report.Languages[0].P95; p95 != 200*time.Millisecond {
+		t.Errorf("Expected a python P95 of 200ms, got %v", p95)
+	}
+	if len(report.Trend) != 2 || report.Trend[0].Jobs != 2 || report.Trend[1].Jobs != 3 {
+		t.Errorf("Expected daily buckets of 2 and 3 jobs, got %+v", report.Trend)
+	}
+	if len(report.FailureReasons) != 2 || report.FailureReasons[0] != (analytics.Count{Value: "program exited with code 1", Count: 2}) {
+		t.Errorf("Unexpected failure reasons: %+v", report.FailureReasons)
+	}
+	if len(report.Tenants) != 2 || report.Tenants[0] != (analytics.Count{Value: "acme", Count: 2}) {
+		t.Errorf("Unexpected tenants: %+v", report.Tenants)
+	}
+
+	markdown := report.Markdown("Weekly")
+	for _, want := range []string{"# Weekly", "| python | 3 | 2 | 1 | 66.7% |", "| acme | 2 |", "Execution timed out"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Expected the Markdown report to contain %q:\n%s", want, markdown)
+		}
+	}
+	page, err := report.HTML("Weekly <report>")
+	if err != nil {
+		t.Fatalf("HTML failed: %v", err)
+	}
+	if !strings.Contains(page, "<h1>Weekly &lt;report&gt;</h1>") || !strings.Contains(page, "<td>globex</td>") {
+		t.Errorf("Unexpected HTML report:\n%s", page)
+	}
+}
+
+func TestAnalyticsFromJobLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.log")
+	log, err := joblog.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	now := time.Now().UTC()
+	for _, record := range []joblog.Record{
+		{JobID: "job-1", Status: "completed", Language: "python", CreatedAt: now, DurationMS: 150, Labels: map[string]string{"tenant": "acme"}},
+		{JobID: "job-2", Status: "failed", Language: "python", Error: "program exited with code 2", CreatedAt: now},
+	} {
+		if _, err := log.Append(record); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	if report, err := joblog.Verify(path); err != nil || !report.Valid {
+		t.Fatalf("Expected a valid job log, got %+v, %v", report, err)
+	}
+	records, err := joblog.ReadRecords(path)
+	if err != nil {
+		t.Fatalf("ReadRecords failed: %v", err)
+	}
+	report := analytics.Summarize(analytics.FromJobLog(records), analytics.Options{})
+	if report.Jobs != 2 || report.Languages[0].P95 != 150*time.Millisecond || report.Tenants[0].Value != "acme" {
+		t.Errorf("Unexpected report from the job log: %+v", report)
+	}
+}
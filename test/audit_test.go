@@ -0,0 +1,182 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/audit"
+	"forgeai/pkg/config"
+)
+
+func TestAuditTrailSinks(t *testing.T) {
+	posted := make(chan audit.Entry, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var entry audit.Entry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			t.Errorf("Failed to decode posted entry: %v", err)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Expected the configured header, got %q", r.Header.Get("Authorization"))
+		}
+		posted <- entry
+	}))
+	defer webhook.Close()
+
+	syslog, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syslog.Close()
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	trail, err := audit.FromConfig(config.AuditConfig{
+		File:     path,
+		Capacity: 2,
+		Syslog:   config.AuditSyslogConfig{Address: syslog.LocalAddr().String()},
+		Webhook: config.AuditWebhookConfig{
+			URL:     webhook.URL,
+			Headers: map[string]string{"Authorization": "Bearer secret"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("FromConfig failed: %v", err)
+	}
+
+	trail.Record(context.Background(), audit.Entry{Actor: "alice", Action: "fixture.put", Resource: "a.csv"})
+	trail.Record(context.Background(), audit.Entry{Actor: "bob", Action: "fixture.delete", Resource: "a.csv", Outcome: audit.OutcomeFailure})
+	trail.Record(context.Background(), audit.Entry{Actor: "alice", Action: "quarantine.add", Before: nil, After: map[string]string{"reason": "miner"}})
+
+	// Only the most recent entries are kept for listing
+	recent := trail.List(audit.Filter{}, 0)
+	if len(recent) != 2 || recent[0].Seq != 2 || recent[1].Seq != 3 {
+		t.Errorf("Expected entries 2 and 3, got %+v", recent)
+	}
+	if got := trail.List(audit.Filter{Actor: "alice"}, 0); len(got) != 1 || got[0].Action != "quarantine.add" {
+		t.Errorf("Expected alice's quarantine entry, got %+v", got)
+	}
+
+	// Every entry reaches the file in order
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var seqs []uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry audit.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		seqs = append(seqs, entry.Seq)
+	}
+	if len(seqs) != 3 || seqs[0] != 1 || seqs[2] != 3 {
+		t.Errorf("Expected entries 1 to 3 in the file, got %v", seqs)
+	}
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case entry := <-posted:
+			if entry.Seq != uint64(i) {
+				t.Errorf("Expected webhook entry %d, got %d", i, entry.Seq)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Webhook did not receive entry %d", i)
+		}
+	}
+
+	// Syslog messages carry the action and the JSON entry, failures at a
+	// higher severity
+	buf := make([]byte, 4096)
+	syslog.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := syslog.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Syslog did not receive an entry: %v", err)
+	}
+	if msg := string(buf[:n]); !strings.HasPrefix(msg, "<85>1 ") || !strings.Contains(msg, " fixture.put ") || !strings.Contains(msg, `"actor":"alice"`) {
+		t.Errorf("Unexpected syslog message %q", msg)
+	}
+	n, _, err = syslog.ReadFrom(buf)
+	if err != nil || !strings.HasPrefix(string(buf[:n]), "<84>1 ") {
+		t.Errorf("Expected the failure at warning severity, got %q %v", buf[:n], err)
+	}
+}
+
+func TestAPIAuditTrail(t *testing.T) {
+	trail := audit.NewTrail()
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Audit:      trail,
+		AdminToken: "admin-secret",
+	})
+
+	do := func(method, path, actor string, body interface{}) (int, []byte) {
+		var data []byte
+		if body != nil {
+			data, _ = json.Marshal(body)
+		}
+		req, _ := http.NewRequest(method, "http://forgeai"+path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		if actor != "" {
+			req.Header.Set(api.DefaultActorHeader, actor)
+		}
+		if strings.HasPrefix(path, "/v1/admin/") {
+			req.Header.Set("Authorization", "Bearer admin-secret")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		out, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, out
+	}
+
+	hash := strings.Repeat("ab", 32)
+	if status, body := do(http.MethodPost, "/v1/quarantine", "alice", map[string]string{"code_hash": hash, "reason": "miner"}); status != http.StatusCreated {
+		t.Fatalf("Expected the hash to be quarantined, got %d %s", status, body)
+	}
+	do(http.MethodDelete, "/v1/quarantine/"+hash, "bob", nil)
+	do(http.MethodDelete, "/v1/quarantine/"+hash, "bob", nil)
+
+	status, body := do(http.MethodGet, "/v1/admin/audit?actor=bob", "carol", nil)
+	if status != http.StatusOK {
+		t.Fatalf("Expected the trail, got %d %s", status, body)
+	}
+	var listed struct {
+		Entries []audit.Entry `json:"entries"`
+	}
+	if err := json.Unmarshal(body, &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Entries) != 2 {
+		t.Fatalf("Expected bob's two removals, got %+v", listed.Entries)
+	}
+	removed, missing := listed.Entries[0], listed.Entries[1]
+	if removed.Action != "quarantine.remove" || removed.Resource != hash || removed.Outcome != audit.OutcomeSuccess || removed.Before == nil || removed.After != nil {
+		t.Errorf("Expected a successful removal with the entry before it, got %+v", removed)
+	}
+	if missing.Outcome != audit.OutcomeFailure || missing.Error == "" {
+		t.Errorf("Expected the second removal to fail, got %+v", missing)
+	}
+
+	// Reading the trail is itself audited
+	if got := trail.List(audit.Filter{Action: "audit.read"}, 0); len(got) != 1 || got[0].Actor != "carol" {
+		t.Errorf("Expected carol's read to be recorded, got %+v", got)
+	}
+	if got := trail.List(audit.Filter{Action: "quarantine.add"}, 0); len(got) != 1 || got[0].Actor != "alice" || got[0].Method != http.MethodPost {
+		t.Errorf("Expected alice's quarantine to be recorded, got %+v", got)
+	}
+}
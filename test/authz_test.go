@@ -0,0 +1,169 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/authz"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+// teamPolicy grants data science python with network access and frontend
+// javascript only
+var teamPolicy = authz.Policy{Groups: map[string]authz.Grant{
+	"team-data-science": {Languages: []string{"python"}, NetworkAccess: true, MaxTimeout: 120},
+	"team-frontend":     {Languages: []string{"javascript"}, MaxTimeout: 30},
+}}
+
+func TestAuthzPolicy(t *testing.T) {
+	dir := authz.NewDirectory(filepath.Join(t.TempDir(), "directory.json"))
+	if err := dir.Import([]byte("team-data-science: [alice, Bob]\nteam-frontend: [bob, carol]\n")); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	cases := []struct {
+		user string
+		req  authz.Request
+		err  error
+	}{
+		{"alice", authz.Request{Language: "python", NetworkAccess: true, Timeout: 60}, nil},
+		{"alice", authz.Request{Language: "javascript"}, authz.ErrDenied},
+		{"carol", authz.Request{Language: "javascript", Timeout: 30}, nil},
+		{"carol", authz.Request{Language: "javascript", NetworkAccess: true}, authz.ErrDenied},
+		{"carol", authz.Request{Language: "javascript", Timeout: 60}, authz.ErrDenied},
+		// Members of both groups get the union of their grants
+		{"bob", authz.Request{Language: "javascript", NetworkAccess: true, Timeout: 120}, nil},
+		// File executions, whose language is unknown, need every language
+		{"alice", authz.Request{}, authz.ErrDenied},
+		{"dave", authz.Request{Language: "python"}, authz.ErrDenied},
+		{"", authz.Request{Language: "python"}, authz.ErrUnauthenticated},
+	}
+	for _, tc := range cases {
+		err := teamPolicy.Authorize(dir, tc.user, tc.req)
+		if !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+			t.Errorf("Authorize(%q, %+v) = %v, expected %v", tc.user, tc.req, err, tc.err)
+		}
+	}
+
+	// Users in no group fall back to the default grant
+	withDefault := teamPolicy
+	withDefault.Default = &authz.Grant{Languages: []string{authz.AnyLanguage}}
+	if err := withDefault.Authorize(dir, "dave", authz.Request{}); err != nil {
+		t.Errorf("Expected the default to grant every language, got %v", err)
+	}
+
+	// The directory survives a restart
+	reopened := authz.NewDirectory(dir.Path)
+	if err := reopened.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if groups := reopened.GroupsOf("BOB"); len(groups) != 2 {
+		t.Errorf("Expected bob in both groups after reopening, got %v", groups)
+	}
+}
+
+func TestSCIMAuthorization(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Directory:  authz.NewDirectory(""),
+		SCIMToken:  "scim-secret",
+		AdminToken: "admin-secret",
+		Settings:   api.Settings{Authz: teamPolicy},
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+
+	do := func(method, path string, header http.Header, body interface{}) (int, map[string]interface{}) {
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, "http://forgeai"+path, bytes.NewReader(data))
+		req.Header = header.Clone()
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		out, _ := io.ReadAll(resp.Body)
+		var decoded map[string]interface{}
+		json.Unmarshal(out, &decoded)
+		return resp.StatusCode, decoded
+	}
+	scim := http.Header{"Authorization": {"Bearer scim-secret"}, "Content-Type": {"application/scim+json"}}
+	execute := func(user, language string, network bool) int {
+		header := http.Header{"Content-Type": {"application/json"}}
+		if user != "" {
+			header.Set(api.DefaultActorHeader, user)
+		}
+		status, _ := do(http.MethodPost, "/v1/execute", header, map[string]interface{}{
+			"language": language, "code": "print(1)", "network_access": network,
+		})
+		return status
+	}
+
+	if status, _ := do(http.MethodGet, "/scim/v2/Users", http.Header{"Authorization": {"Bearer wrong"}}, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong SCIM token to be refused, got %d", status)
+	}
+
+	// The identity provider pushes a user and adds them to a group
+	status, user := do(http.MethodPost, "/scim/v2/Users", scim, map[string]interface{}{
+		"schemas": []string{"urn:ietf:params:scim:schemas:core:2.0:User"}, "userName": "alice",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("Expected the user to be created, got %d %v", status, user)
+	}
+	userID := user["id"].(string)
+	status, group := do(http.MethodPost, "/scim/v2/Groups", scim, map[string]interface{}{
+		"displayName": "team-frontend", "members": []interface{}{},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("Expected the group to be created, got %d %v", status, group)
+	}
+	groupID := group["id"].(string)
+
+	if status := execute("alice", "javascript", false); status != http.StatusForbidden {
+		t.Errorf("Expected alice to be denied before joining a group, got %d", status)
+	}
+	do(http.MethodPatch, "/scim/v2/Groups/"+groupID, scim, map[string]interface{}{
+		"Operations": []interface{}{map[string]interface{}{
+			"op": "add", "path": "members", "value": []interface{}{map[string]string{"value": userID}},
+		}},
+	})
+	if status := execute("alice", "javascript", false); status != http.StatusCreated {
+		t.Errorf("Expected alice to run javascript as a frontend member, got %d", status)
+	}
+	if status := execute("alice", "python", false); status != http.StatusForbidden {
+		t.Errorf("Expected alice to be denied python, got %d", status)
+	}
+	if status := execute("", "javascript", false); status != http.StatusUnauthorized {
+		t.Errorf("Expected requests naming no user to be refused, got %d", status)
+	}
+
+	status, listed := do(http.MethodGet, `/scim/v2/Users?filter=userName%20eq%20%22alice%22`, scim, nil)
+	if status != http.StatusOK || listed["totalResults"] != float64(1) {
+		t.Errorf("Expected the filter to find alice, got %d %v", status, listed)
+	}
+
+	// Deactivated users lose their groups' grants
+	do(http.MethodPatch, "/scim/v2/Users/"+userID, scim, map[string]interface{}{
+		"Operations": []interface{}{map[string]interface{}{"op": "replace", "value": map[string]bool{"active": false}}},
+	})
+	if status := execute("alice", "javascript", false); status != http.StatusForbidden {
+		t.Errorf("Expected deactivated alice to be denied, got %d", status)
+	}
+
+	status, access := do(http.MethodGet, "/v1/admin/authz/users/alice", http.Header{"Authorization": {"Bearer admin-secret"}}, nil)
+	if status != http.StatusOK || access["granted"] != false {
+		t.Errorf("Expected alice's access to be revoked, got %d %v", status, access)
+	}
+}
@@ -0,0 +1,100 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"forgeai/pkg/autoscale"
+	"forgeai/pkg/jobs"
+)
+
+func TestAutoscaleRecommend(t *testing.T) {
+	policy := autoscale.Policy{TargetWait: 10 * time.Second, TargetUtilization: 0.5, MaxReplicas: 5, WorkersPerReplica: 4}
+
+	// Idle workers keep the minimum
+	if rec := policy.Recommend(jobs.Load{Capacity: 4}); rec.Replicas != 1 || rec.Workers != 0 {
+		t.Errorf("Expected one replica when idle, got %+v", rec)
+	}
+
+	// 4 running jobs need 8 workers at half utilization; 10 pending jobs of
+	// 5s drain within 10s on 5 more workers, which need 10 at half
+	rec := policy.Recommend(jobs.Load{Running: 4, Pending: 10, Capacity: 4, TypicalDuration: 5 * time.Second})
+	if rec.Workers != 18 || rec.Replicas != 5 {
+		t.Errorf("Expected 18 workers capped at 5 replicas, got %+v", rec)
+	}
+
+	// Without a typical duration every pending job needs a worker
+	rec = policy.Recommend(jobs.Load{Running: 1, Pending: 3, Capacity: 4})
+	if rec.Workers != 8 || rec.Replicas != 2 {
+		t.Errorf("Expected 8 workers on 2 replicas, got %+v", rec)
+	}
+
+	if err := (autoscale.Policy{MinReplicas: 3, MaxReplicas: 2}).Validate(); err == nil {
+		t.Error("Expected min replicas above max replicas to be rejected")
+	}
+	if err := (autoscale.Policy{TargetUtilization: 1.5}).Validate(); err == nil {
+		t.Error("Expected a utilization above 1 to be rejected")
+	}
+}
+
+func TestAutoscaleController(t *testing.T) {
+	var mu sync.Mutex
+	var scaled []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec autoscale.Recommendation
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			t.Errorf("Failed to decode recommendation: %v", err)
+		}
+		mu.Lock()
+		scaled = append(scaled, rec.Replicas)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	controller := &autoscale.Controller{
+		Policy:         autoscale.Policy{TargetUtilization: 1, WorkersPerReplica: 2},
+		Scaler:         &autoscale.Webhook{URL: server.URL},
+		ScaleDownDelay: 50 * time.Millisecond,
+	}
+	ctx := context.Background()
+
+	// Scaling up is immediate
+	if status := controller.Check(ctx, jobs.Load{Running: 6}); status.Replicas != 3 || status.Error != "" {
+		t.Fatalf("Expected to scale up to 3 replicas, got %+v", status)
+	}
+	if status := controller.Check(ctx, jobs.Load{Running: 6}); status.Replicas != 3 {
+		t.Fatalf("Expected to stay at 3 replicas, got %+v", status)
+	}
+
+	// Scaling down waits for the delay
+	if status := controller.Check(ctx, jobs.Load{Running: 2}); status.Replicas != 3 {
+		t.Fatalf("Expected the scale down to be delayed, got %+v", status)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if status := controller.Check(ctx, jobs.Load{Running: 2}); status.Replicas != 1 {
+		t.Fatalf("Expected to scale down to 1 replica after the delay, got %+v", status)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(scaled) != 2 || scaled[0] != 3 || scaled[1] != 1 {
+		t.Errorf("Expected the webhook to receive 3 and 1 replicas, got %v", scaled)
+	}
+}
+
+func TestJobManagerLoad(t *testing.T) {
+	manager := jobs.NewManager()
+	manager.Workers = 4
+	manager.Store.Put(&jobs.Job{ID: "pending", Status: "pending"})
+	manager.Store.Put(&jobs.Job{ID: "running", Status: "running"})
+
+	load := manager.Load()
+	if load.Pending != 1 || load.Running != 1 || load.Capacity != 4 || load.Utilization != 0.25 {
+		t.Errorf("Unexpected load %+v", load)
+	}
+}
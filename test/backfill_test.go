@@ -0,0 +1,69 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/joblog"
+	"forgeai/pkg/jobs"
+)
+
+func TestBackfillLegacyLog(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "jobs.log")
+	log, err := joblog.Open(logPath)
+	if err != nil {
+		t.Fatalf("Failed to open job log: %v", err)
+	}
+	manager := jobs.NewManager()
+	manager.Log = log
+	manager.DedupWindow = time.Hour
+
+	recent := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	legacy := strings.Join([]string{
+		`{"id":"1","language":"python","code":"print(1)","stdout":"1\n","exit_code":0,"duration_ms":250,"created_at":"` + recent + `","labels":{"tenant":"acme"}}`,
+		`{"id":"2","language":"bash","code":"exit 3","exit_code":3,"duration_ms":10,"created_at":"2023-01-01T00:00:00Z"}`,
+		`{"id":"3","language":"python","created_at":"2023-01-01T00:00:00Z"}`,
+		`not json`,
+	}, "\n")
+
+	report, err := manager.Backfill(strings.NewReader(legacy), jobs.BackfillOptions{Source: "runner-v1"})
+	if err != nil {
+		t.Fatalf("Backfill failed: %v", err)
+	}
+	if report.Imported != 2 || report.Failed != 2 || len(report.Errors) != 2 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+
+	job, ok := manager.GetJob("legacy-1")
+	if !ok || job.Status != "completed" || job.Result == nil || job.Result.Stdout != "1\n" || job.Result.Duration != 250*time.Millisecond {
+		t.Fatalf("Expected the completed record to be imported, got %+v", job)
+	}
+	if job.Labels[jobs.BackfillLabel] != "runner-v1" || job.Labels["tenant"] != "acme" || !job.Finished() {
+		t.Errorf("Expected the imported job to be labeled and finished, got %+v", job.Labels)
+	}
+	if job, _ := manager.GetJob("legacy-2"); job.Status != "failed" || job.Result.ExitCode != 3 {
+		t.Errorf("Expected a nonzero exit code to import as failed, got %s", job.Status)
+	}
+
+	records, err := joblog.ReadRecords(logPath)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Expected the imported jobs in the job log, got %d records: %v", len(records), err)
+	}
+
+	// Recent code is deduplicated against the imported job
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	shared, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print(1)"})
+	if err != nil || shared.ID != "legacy-1" {
+		t.Errorf("Expected the submission to share the imported job, got %v: %v", shared, err)
+	}
+
+	// Importing again skips what was imported
+	report, err = manager.Backfill(strings.NewReader(legacy), jobs.BackfillOptions{Source: "runner-v1"})
+	if err != nil || report.Imported != 0 || report.Skipped != 2 {
+		t.Errorf("Expected a second backfill to skip the imported records, got %+v: %v", report, err)
+	}
+}
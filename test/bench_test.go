@@ -0,0 +1,171 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	"forgeai/pkg/container"
+	"forgeai/pkg/executor"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/runtime"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/security"
+)
+
+// Executor benchmarks. Compare runs with benchstat:
+//
+//	go test ./test -run '^$' -bench Execute -count 10 > old.txt
+//	go test ./test -run '^$' -bench Execute -count 10 > new.txt
+//	benchstat old.txt new.txt
+
+// benchPrograms are small programs printing one line, by language and the
+// interpreter they need
+var benchPrograms = []struct {
+	language    string
+	interpreter string
+	code        string
+}{
+	{"python", "python3", "print('hello')"},
+	{"javascript", "node", "console.log('hello')"},
+	{"go", "go", "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hello\") }\n"},
+}
+
+// codeExecutor is the part of an executor the benchmarks use, which
+// executors outside the sandbox.Executor interface also implement
+type codeExecutor interface {
+	Execute(ctx context.Context, language, code string) (*sandbox.ExecutionResult, error)
+}
+
+// benchExecute runs each program available on the host b.N times
+func benchExecute(b *testing.B, run codeExecutor) {
+	for _, program := range benchPrograms {
+		program := program
+		b.Run(program.language, func(b *testing.B) {
+			requireTool(b, program.interpreter)
+			ctx := context.Background()
+
+			// Warm up caches such as the go build cache and image layers
+			if _, err := run.Execute(ctx, program.language, program.code); err != nil {
+				b.Skipf("%s does not run: %v", program.language, err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				result, err := run.Execute(ctx, program.language, program.code)
+				if err != nil {
+					b.Fatalf("Execute failed: %v", err)
+				}
+				if result.ExitCode != 0 {
+					b.Fatalf("Execute exited with %d: %s", result.ExitCode, result.Stdout)
+				}
+			}
+		})
+	}
+}
+
+// requireTool skips tests and benchmarks whose tool is not installed
+func requireTool(b testing.TB, name string) {
+	b.Helper()
+	if _, err := exec.LookPath(name); err != nil {
+		b.Skipf("%s not installed", name)
+	}
+}
+
+// requireDocker skips tests and benchmarks when no docker daemon is
+// reachable
+func requireDocker(b testing.TB) {
+	b.Helper()
+	requireTool(b, "docker")
+	if !dockerReachable() {
+		b.Skip("docker daemon not reachable")
+	}
+}
+
+// dockerReachable reports whether the docker daemon answers
+func dockerReachable() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return (container.Daemon{}).Command(ctx, "info").Run() == nil
+}
+
+func BenchmarkLocalExecute(b *testing.B) {
+	benchExecute(b, executor.NewLocalExecutor())
+}
+
+func BenchmarkDockerExecute(b *testing.B) {
+	requireDocker(b)
+	benchExecute(b, container.NewDockerExecutor())
+}
+
+func BenchmarkContainerizedExecute(b *testing.B) {
+	requireDocker(b)
+	benchExecute(b, security.NewContainerizedExecutor())
+}
+
+func BenchmarkNsjailExecute(b *testing.B) {
+	requireTool(b, "nsjail")
+	benchExecute(b, runtime.NewNsjailExecutor())
+}
+
+func BenchmarkSecureExecute(b *testing.B) {
+	benchExecute(b, security.NewSecureExecutor())
+}
+
+// BenchmarkLocalExecuteOutput measures collecting 16 MiB of output
+func BenchmarkLocalExecuteOutput(b *testing.B) {
+	requireTool(b, "python3")
+	const size = 16 << 20
+	code := fmt.Sprintf("import sys\nsys.stdout.write('x' * %d)", size)
+	local := executor.NewLocalExecutor()
+	ctx := context.Background()
+
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := local.Execute(ctx, "python", code)
+		if err != nil {
+			b.Fatalf("Execute failed: %v", err)
+		}
+		if result.ExitCode != 0 {
+			b.Fatalf("Execute exited with %d", result.ExitCode)
+		}
+	}
+}
+
+// BenchmarkJobManager measures a job through submission, execution, and
+// result bookkeeping
+func BenchmarkJobManager(b *testing.B) {
+	requireTool(b, "python3")
+	manager := jobs.NewManager()
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print('hello')"})
+		if err != nil {
+			b.Fatalf("Submit failed: %v", err)
+		}
+		job, err = manager.Wait(ctx, job.ID)
+		if err != nil {
+			b.Fatalf("Wait failed: %v", err)
+		}
+		if job.Status != "completed" {
+			b.Fatalf("job ended %s: %s", job.Status, job.Error)
+		}
+	}
+}
+
+// BenchmarkOutputBuffer measures writing output past the buffer limits
+func BenchmarkOutputBuffer(b *testing.B) {
+	chunk := make([]byte, 32<<10)
+	b.SetBytes(int64(len(chunk)))
+	buf := sandbox.DefaultOutputLimits().NewBuffer()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Write(chunk)
+	}
+}
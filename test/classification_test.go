@@ -0,0 +1,139 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+	"forgeai/pkg/storage"
+)
+
+func TestClassificationPolicies(t *testing.T) {
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "secret\n"}}
+
+	manager := jobs.NewManager()
+	manager.Storage = backend
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+	manager.Classifications = map[string]jobs.ClassificationPolicy{
+		jobs.ClassificationRestricted: {LogRetention: time.Hour, RequireEncryption: true, HashCodeOnly: true},
+	}
+
+	if _, err := manager.Submit(context.Background(), jobs.Spec{Language: "python", Code: "x", Classification: "secret"}); !errors.Is(err, jobs.ErrUnknownClassification) {
+		t.Errorf("Expected ErrUnknownClassification, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	run := func(classification string) *jobs.Job {
+		job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print('" + classification + "')", Classification: classification})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		if job, err = manager.Wait(ctx, job.ID); err != nil || job.Status != "completed" {
+			t.Fatalf("Expected the job to complete, got %v %v", job.Status, err)
+		}
+		return job
+	}
+	internal := run("")
+	restricted := run(jobs.ClassificationRestricted)
+
+	if internal.Classification != jobs.ClassificationInternal {
+		t.Errorf("Expected the default classification, got %q", internal.Classification)
+	}
+	if log, _ := internal.Log(jobs.StreamStdout); log.Key == "" || internal.Code == "" {
+		t.Errorf("Expected internal jobs to keep their code and store their logs, got %+v", log)
+	}
+
+	// Storage does not encrypt, so restricted logs stay in memory
+	if log, _ := restricted.Log(jobs.StreamStdout); log.Key != "" {
+		t.Errorf("Expected the restricted log to stay out of unencrypted storage, got %s", log.Key)
+	}
+	if restricted.Code != "" || restricted.CodeHash == "" {
+		t.Errorf("Expected only the hash of restricted code to be kept")
+	}
+
+	// Only restricted logs have a retention
+	manager.PruneLogs(context.Background(), time.Now().Add(2*time.Hour))
+	if log, _ := restricted.Log(jobs.StreamStdout); !log.Expired() {
+		t.Error("Expected the restricted log to expire")
+	}
+	if log, _ := internal.Log(jobs.StreamStdout); log.Expired() {
+		t.Error("Expected the internal log to be kept")
+	}
+}
+
+func TestClassificationRouting(t *testing.T) {
+	process := sandboxtest.NewFakeExecutor()
+	gvisor := sandboxtest.NewFakeExecutor()
+	router := &jobs.ClassRouter{
+		Classes: map[string]jobs.ExecutorFactory{
+			"process": jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return process }),
+			"gvisor":  jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return gvisor }),
+		},
+		Default:         "process",
+		Classifications: map[string]string{jobs.ClassificationRestricted: "gvisor"},
+	}
+	if err := router.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if exec := router.NewExecutor(&jobs.Job{Language: "python", Classification: jobs.ClassificationRestricted}); exec != gvisor {
+		t.Error("Expected restricted jobs to run in the gvisor class")
+	}
+	if exec := router.NewExecutor(&jobs.Job{Language: "python", Classification: jobs.ClassificationPublic}); exec != process {
+		t.Error("Expected public jobs to run in the language's class")
+	}
+
+	router.Classifications["public"] = "missing"
+	if err := router.Validate(); err == nil {
+		t.Error("Expected an unknown isolation class to be refused")
+	}
+}
+
+func TestClassificationAPI(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+
+	execute := func(classification string) (int, map[string]interface{}) {
+		body, _ := json.Marshal(map[string]interface{}{
+			"language":       "python",
+			"code":           "print(1)",
+			"classification": classification,
+		})
+		resp, err := client.Post("http://forgeai/v1/execute/sync", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	if status, _ := execute("top-secret"); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown classification, got %d", status)
+	}
+	if status, job := execute("restricted"); status != http.StatusOK || job["classification"] != "restricted" {
+		t.Errorf("Expected a restricted job, got %d %v", status, job["classification"])
+	}
+	if _, job := execute(""); job["classification"] != "internal" {
+		t.Errorf("Expected the default classification, got %v", job["classification"])
+	}
+}
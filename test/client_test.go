@@ -0,0 +1,149 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/client"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+// unixClient sends every request to a unix socket
+func unixClient(socket string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+}
+
+// startTestServer starts an API server on a unix socket under t.TempDir,
+// unless config names one, and returns a client of it once it accepts
+// connections. The server is shut down when the test ends.
+func startTestServer(t *testing.T, config *api.Config) (*http.Client, *api.Server) {
+	t.Helper()
+	if config.Socket == "" {
+		config.Socket = filepath.Join(t.TempDir(), "api.sock")
+	}
+	server := api.NewServer(config)
+	ctx, cancel := context.WithCancel(context.Background())
+	go server.Start(ctx)
+	t.Cleanup(func() {
+		server.Shutdown(context.Background())
+		cancel()
+	})
+
+	client := unixClient(config.Socket)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		resp, err := client.Get("http://forgeai/healthz")
+		if err == nil {
+			resp.Body.Close()
+			return client, server
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("The server did not start: %v", err)
+		}
+	}
+}
+
+func TestClientRemote(t *testing.T) {
+	remote := sandboxtest.NewFakeExecutor()
+	remote.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "remote\n", ExitCode: 3}}
+	httpClient, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return remote
+		}),
+	})
+	ctx := context.Background()
+
+	local := sandboxtest.NewFakeExecutor()
+	c := &client.Client{Server: "http://forgeai", HTTPClient: httpClient, Local: local}
+	c.Fallback.Enabled = true
+
+	result, err := c.Execute(ctx, "python", "print(1)")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.Stdout != "remote\n" || result.ExitCode != 3 {
+		t.Errorf("Expected the server's result, got %+v", result)
+	}
+	if calls := local.Calls(); len(calls) != 0 {
+		t.Errorf("Expected no local executions while the server is up, got %d", len(calls))
+	}
+
+	// Errors from the server never fall back
+	if _, err := c.Execute(ctx, "cobol", "DISPLAY 1"); err == nil || !strings.Contains(err.Error(), "unsupported language") {
+		t.Errorf("Expected the server's error, got %v", err)
+	}
+	if calls := local.Calls(); len(calls) != 0 {
+		t.Errorf("Expected no local executions for server errors, got %d", len(calls))
+	}
+}
+
+func TestClientFallback(t *testing.T) {
+	local := sandboxtest.NewFakeExecutor()
+	local.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "local\n"}}
+	local.Caps = sandbox.Capabilities{Available: true, MemoryLimit: true}
+	unreachable := unixClient(filepath.Join(t.TempDir(), "missing.sock"))
+	ctx := context.Background()
+
+	c := &client.Client{Server: "http://forgeai", HTTPClient: unreachable, Local: local}
+	if _, err := c.Execute(ctx, "python", "print(1)"); !errors.Is(err, client.ErrUnreachable) {
+		t.Errorf("Expected an unreachable server without fallback, got %v", err)
+	}
+
+	var logged []string
+	var downgrades []client.Downgrade
+	c.Logf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+	c.Fallback = client.Fallback{Enabled: true, OnFallback: func(d client.Downgrade) { downgrades = append(downgrades, d) }}
+	result, err := c.Execute(ctx, "python", "print(1)")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.Stdout != "local\n" {
+		t.Errorf("Expected the local result, got %+v", result)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "falling back") {
+		t.Errorf("Expected the fallback to be logged, got %q", logged)
+	}
+	if len(downgrades) != 1 || !errors.Is(downgrades[0].Err, client.ErrUnreachable) || downgrades[0].Backend != "fake" {
+		t.Errorf("Unexpected downgrade: %+v", downgrades)
+	}
+
+	// Policy can refuse local executions that lack guarantees
+	c.Fallback.Require = sandbox.Requirements{NetworkIsolation: true}
+	if _, err := c.Execute(ctx, "python", "print(1)"); err == nil || !strings.Contains(err.Error(), "network isolation") {
+		t.Errorf("Expected the missing guarantee to refuse fallback, got %v", err)
+	}
+	if calls := local.Calls(); len(calls) != 1 {
+		t.Errorf("Expected 1 local execution, got %d", len(calls))
+	}
+}
+
+func TestServerNamedPipeOutsideWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes are served on Windows")
+	}
+	pipe := `\\.\pipe\forgeai-test`
+	server := api.NewServer(&api.Config{Socket: pipe})
+	if server.Address() != pipe {
+		t.Errorf("Expected the server to report the pipe, got %s", server.Address())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Start(ctx); err == nil || !strings.Contains(err.Error(), "only supported on Windows") {
+		t.Errorf("Expected named pipes to be refused outside Windows, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/compare"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestCompareResults(t *testing.T) {
+	base := &sandbox.ExecutionResult{
+		Stdout:   "a\nb\nc\nd\n",
+		ExitCode: 1,
+		Duration: 100 * time.Millisecond,
+		Artifacts: []sandbox.Artifact{
+			{Name: "kept.txt", Data: []byte("same")},
+			{Name: "gone.txt", Data: []byte("x")},
+			{Name: "edited.txt", Data: []byte("old")},
+		},
+	}
+	candidate := &sandbox.ExecutionResult{
+		Stdout:   "a\nc\nD\nd\n",
+		Duration: 150 * time.Millisecond,
+		Artifacts: []sandbox.Artifact{
+			{Name: "kept.txt", Data: []byte("same")},
+			{Name: "edited.txt", Data: []byte("newer")},
+			{Name: "new.txt", Data: []byte("y")},
+		},
+	}
+
+	diff := compare.Results(base, candidate)
+	if diff.Identical {
+		t.Error("Expected the results to differ")
+	}
+	if !diff.ExitCode.Changed || diff.ExitCode.Base != 1 || diff.ExitCode.Candidate != 0 {
+		t.Errorf("Unexpected exit code diff: %+v", diff.ExitCode)
+	}
+	want := []compare.Line{{Op: "-", Line: 2, Text: "b"}, {Op: "+", Line: 3, Text: "D"}}
+	if !reflect.DeepEqual(diff.Stdout.Lines, want) {
+		t.Errorf("Expected stdout lines %+v, got %+v", want, diff.Stdout.Lines)
+	}
+	if diff.Stderr.Changed {
+		t.Error("Expected stderr to be unchanged")
+	}
+	if diff.Duration.Change != "+50ms" || diff.Duration.Ratio != 1.5 {
+		t.Errorf("Unexpected duration diff: %+v", diff.Duration)
+	}
+
+	statuses := map[string]string{}
+	for _, a := range diff.Artifacts {
+		statuses[a.Name] = a.Status
+	}
+	wantStatuses := map[string]string{"kept.txt": "unchanged", "gone.txt": "removed", "edited.txt": "changed", "new.txt": "added"}
+	if !reflect.DeepEqual(statuses, wantStatuses) {
+		t.Errorf("Expected artifact statuses %v, got %v", wantStatuses, statuses)
+	}
+
+	if same := compare.Results(base, base); !same.Identical || same.Summary() != "identical behavior" {
+		t.Errorf("Expected identical results, got %+v", same)
+	}
+}
+
+func TestExecuteDiff(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.On("python", "fixed", sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "4\n"}})
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "5\n", ExitCode: 1}}
+
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"language":  "python",
+		"base":      map[string]string{"code": "print(2 + 3)"},
+		"candidate": map[string]string{"code": "print(2 + 2)  # fixed"},
+	})
+	resp, err := client.Post("http://forgeai/v1/execute/diff", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Base struct {
+			JobID string `json:"job_id"`
+		} `json:"base"`
+		Candidate struct {
+			JobID string `json:"job_id"`
+		} `json:"candidate"`
+		Diff compare.Diff `json:"diff"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if out.Base.JobID == "" || out.Base.JobID == out.Candidate.JobID {
+		t.Errorf("Expected two distinct jobs, got %q and %q", out.Base.JobID, out.Candidate.JobID)
+	}
+	if !out.Diff.ExitCode.Changed || !out.Diff.Stdout.Changed {
+		t.Errorf("Expected the exit code and stdout to change, got %+v", out.Diff)
+	}
+	if calls := len(fake.Calls()); calls != 2 {
+		t.Errorf("Expected 2 executions, got %d", calls)
+	}
+}
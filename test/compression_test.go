@@ -0,0 +1,158 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+	"forgeai/pkg/storage"
+)
+
+// compressionMetric returns a compression metric of a target, or -1 when it
+// is not reported
+func compressionMetric(metrics, name, target string) float64 {
+	match := regexp.MustCompile(`(?m)^` + name + `\{target="` + target + `"\} (\S+)$`).FindStringSubmatch(metrics)
+	if match == nil {
+		return -1
+	}
+	value, _ := strconv.ParseFloat(match[1], 64)
+	return value
+}
+
+func TestGzipLogs(t *testing.T) {
+	local, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Logs are gzipped in memory without storage and by a compressed
+	// backend with it
+	for name, backend := range map[string]storage.Backend{"memory": nil, "storage": storage.NewCompressedBackend(local)} {
+		t.Run(name, func(t *testing.T) {
+			testGzipLogs(t, backend, local)
+		})
+	}
+}
+
+func testGzipLogs(t *testing.T, backend storage.Backend, local storage.Backend) {
+	stdout := strings.Repeat("line of repetitive output\n", 400)
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: stdout, Stderr: "short\n"}}
+	config := &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	}
+	config.InlineOutput = 64
+	if backend != nil {
+		config.Storage = backend
+	}
+	client, _ := startTestServer(t, config)
+
+	// Requests name their encoding, so that the client does not decode the
+	// responses itself
+	do := func(method, path, body string, header ...string) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(method, "http://forgeai"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Encoding", "identity")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+	gunzip := func(data []byte) string {
+		t.Helper()
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Expected a gzipped body: %v", err)
+		}
+		plain, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("Failed to gunzip the body: %v", err)
+		}
+		return string(plain)
+	}
+
+	_, data := do(http.MethodPost, "/v1/execute/sync", `{"language": "python", "code": "print()"}`)
+	var job map[string]interface{}
+	json.Unmarshal(data, &job)
+	if job["status"] != "completed" {
+		t.Fatalf("Expected the job to complete, got %s", data)
+	}
+	logs := "/v1/jobs/" + job["job_id"].(string) + "/logs"
+
+	// The log is kept compressed and read back whole
+	if backend != nil {
+		objects, _ := local.List(context.Background(), "jobs/")
+		stored := make(map[string]int64)
+		for _, object := range objects {
+			stored[object.Key[strings.LastIndex(object.Key, "/")+1:]] = object.Size
+		}
+		if size, ok := stored["stdout.log.forgeai-gz"]; !ok || size >= int64(len(stdout)) || len(stored) != 2 || stored["stderr.log"] != 6 {
+			t.Errorf("Expected stdout stored gzipped and stderr too short to compress, got %+v", objects)
+		}
+	}
+	resp, data := do(http.MethodGet, logs, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" || string(data) != stdout {
+		t.Errorf("Expected the full log uncompressed, got %d %q with %d bytes", resp.StatusCode, resp.Header.Get("Content-Encoding"), len(data))
+	}
+	if resp, data := do(http.MethodGet, logs, "", "Range", "bytes=26-51"); resp.StatusCode != http.StatusPartialContent || string(data) != stdout[26:52] {
+		t.Errorf("Expected a range of the log, got %d %q", resp.StatusCode, data)
+	}
+
+	// Clients that accept gzip receive large responses compressed
+	resp, data = do(http.MethodGet, logs, "", "Accept-Encoding", "gzip")
+	if resp.Header.Get("Content-Encoding") != "gzip" || len(data) >= len(stdout) || gunzip(data) != stdout {
+		t.Errorf("Expected the log gzipped, got %q with %d bytes", resp.Header.Get("Content-Encoding"), len(data))
+	}
+	if !strings.Contains(strings.Join(resp.Header.Values("Vary"), ","), "Accept-Encoding") {
+		t.Errorf("Expected the response to vary by Accept-Encoding, got %v", resp.Header.Values("Vary"))
+	}
+	resp, data = do(http.MethodGet, logs, "", "Accept-Encoding", "gzip;q=0, *")
+	if resp.Header.Get("Content-Encoding") != "" || string(data) != stdout {
+		t.Errorf("Expected gzip refused by its q value, got %q", resp.Header.Get("Content-Encoding"))
+	}
+
+	// Small and partial responses are sent as they are
+	resp, data = do(http.MethodGet, logs+"?stream=stderr", "", "Accept-Encoding", "gzip")
+	if resp.Header.Get("Content-Encoding") != "" || string(data) != "short\n" {
+		t.Errorf("Expected a small log uncompressed, got %q %q", resp.Header.Get("Content-Encoding"), data)
+	}
+	resp, data = do(http.MethodGet, logs, "", "Accept-Encoding", "gzip", "Range", "bytes=0-2047")
+	if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Content-Encoding") != "" || string(data) != stdout[:2048] {
+		t.Errorf("Expected a range uncompressed, got %d %q", resp.StatusCode, resp.Header.Get("Content-Encoding"))
+	}
+
+	// The bytes before and after compression are reported
+	_, data = do(http.MethodGet, "/metrics", "")
+	metrics := string(data)
+	target := "logs"
+	if backend != nil {
+		target = "storage"
+	}
+	for _, target := range []string{target, "responses"} {
+		raw := compressionMetric(metrics, "forgeai_compression_raw_bytes_total", target)
+		compressed := compressionMetric(metrics, "forgeai_compression_compressed_bytes_total", target)
+		if raw < float64(len(stdout)) || compressed <= 0 || compressed >= raw {
+			t.Errorf("Expected %s compression to be reported, got %g raw and %g compressed bytes", target, raw, compressed)
+		}
+	}
+}
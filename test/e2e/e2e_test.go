@@ -0,0 +1,559 @@
+//go:build e2e
+
+// Package e2e runs the forgeai and forgeai-api binaries as users do and
+// checks their output. Run it with:
+//
+//	go test -tags e2e ./test/e2e
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	// cliBinary and apiBinary are built by TestMain
+	cliBinary string
+	apiBinary string
+
+	// baseURL is the address of the API server started by TestMain
+	baseURL string
+
+	// workDir is the working directory of the binaries, whose
+	// configuration file only sets the admin token
+	workDir string
+)
+
+// adminToken authorizes the admin commands
+const adminToken = "e2e-admin-token"
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+// run builds the binaries and starts the API server around the tests
+func run(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "forgeai-e2e-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "e2e: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	cliBinary = filepath.Join(dir, "forgeai")
+	apiBinary = filepath.Join(dir, "forgeai-api")
+	for binary, pkg := range map[string]string{cliBinary: "forgeai/cmd/forgeai", apiBinary: "forgeai/cmd/api"} {
+		if output, err := exec.Command("go", "build", "-o", binary, pkg).CombinedOutput(); err != nil {
+			fmt.Fprintf(os.Stderr, "e2e: failed to build %s: %v\n%s", pkg, err, output)
+			return 1
+		}
+	}
+
+	workDir = filepath.Join(dir, "work")
+	if err := os.Mkdir(workDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "e2e: %v\n", err)
+		return 1
+	}
+
+	// The admin commands authenticate with the admin token of the server
+	tokenFile := filepath.Join(dir, "admin-token")
+	config := "admin:\n  token_file: " + tokenFile + "\n"
+	if err := os.WriteFile(tokenFile, []byte(adminToken), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "e2e: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "forgeai.yaml"), []byte(config), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "e2e: %v\n", err)
+		return 1
+	}
+
+	port, err := freePort()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "e2e: %v\n", err)
+		return 1
+	}
+	baseURL = fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	var log bytes.Buffer
+	server := exec.Command(apiBinary)
+	server.Dir = workDir
+	server.Env = binaryEnv(fmt.Sprintf("FORGEAI_API_PORT=%d", port), "FORGEAI_PERMISSIVE=true")
+	server.Stdout = &log
+	server.Stderr = &log
+	if err := server.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "e2e: failed to start the API server: %v\n", err)
+		return 1
+	}
+	defer func() {
+		server.Process.Signal(os.Interrupt)
+		server.Wait()
+	}()
+
+	if err := waitHealthy(30 * time.Second); err != nil {
+		fmt.Fprintf(os.Stderr, "e2e: %v\n%s", err, log.String())
+		return 1
+	}
+	code := m.Run()
+	if code != 0 {
+		fmt.Fprintf(os.Stderr, "API server output:\n%s", log.String())
+	}
+	return code
+}
+
+// freePort returns a TCP port nothing listens on
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// binaryEnv returns the environment of the binaries, which do not read the
+// configuration file of the user running the tests
+func binaryEnv(extra ...string) []string {
+	env := append(os.Environ(), "FORGEAI_CONFIG="+filepath.Join(workDir, "forgeai.yaml"), "FORGEAI_ADMIN_TOKEN="+adminToken)
+	return append(env, extra...)
+}
+
+// waitHealthy waits for the API server to answer its health check
+func waitHealthy(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(baseURL + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("the API server was not healthy after %v", timeout)
+}
+
+// requireTool skips tests whose interpreter is not installed
+func requireTool(t *testing.T, name string) {
+	t.Helper()
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s not installed", name)
+	}
+}
+
+// cliResult is the outcome of a CLI command
+type cliResult struct {
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+// runCLI runs the forgeai binary
+func runCLI(t *testing.T, args ...string) cliResult {
+	t.Helper()
+	cmd := exec.Command(cliBinary, args...)
+	cmd.Dir = workDir
+	cmd.Env = binaryEnv()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	result := cliResult{stdout: stdout.String(), stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		result.exitCode = exitErr.ExitCode()
+	case err != nil:
+		t.Fatalf("failed to run forgeai: %v", err)
+	}
+	return result
+}
+
+// request sends a JSON request to the API server and decodes the JSON
+// response into out
+func request(t *testing.T, method, path string, body interface{}, out interface{}) int {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, baseURL+path, reader)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s returned invalid JSON: %v\n%s", method, path, err, data)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestCLIRunJSON(t *testing.T) {
+	requireTool(t, "python3")
+	result := runCLI(t, "--json", "run", "python", "print(6 * 7)")
+	if result.exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", result.exitCode, result.stderr)
+	}
+
+	var execution struct {
+		Stdout   string
+		ExitCode int
+	}
+	if err := json.Unmarshal([]byte(result.stdout), &execution); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, result.stdout)
+	}
+	if execution.Stdout != "42\n" || execution.ExitCode != 0 {
+		t.Errorf("Unexpected result: %+v", execution)
+	}
+}
+
+func TestCLIRunFailingProgram(t *testing.T) {
+	requireTool(t, "python3")
+	result := runCLI(t, "run", "python", "import sys; print('bye'); sys.exit(3)")
+	if result.exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", result.exitCode, result.stderr)
+	}
+	if !strings.Contains(result.stdout, "Exit code: 3") || !strings.Contains(result.stdout, "bye") {
+		t.Errorf("Unexpected output:\n%s", result.stdout)
+	}
+}
+
+func TestCLIExecFile(t *testing.T) {
+	requireTool(t, "node")
+	file := filepath.Join(t.TempDir(), "hello.js")
+	if err := os.WriteFile(file, []byte("console.log('hello from a file')"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runCLI(t, "exec", file)
+	if result.exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", result.exitCode, result.stderr)
+	}
+	if !strings.Contains(result.stdout, "Exit code: 0") || !strings.Contains(result.stdout, "hello from a file") {
+		t.Errorf("Unexpected output:\n%s", result.stdout)
+	}
+}
+
+func TestCLIUnsupportedLanguage(t *testing.T) {
+	result := runCLI(t, "run", "cobol", "DISPLAY 'HELLO'")
+	if result.exitCode != 1 {
+		t.Errorf("Expected exit code 1, got %d", result.exitCode)
+	}
+	if !strings.Contains(result.stderr, "unsupported language: cobol") {
+		t.Errorf("Expected an unsupported language error, got:\n%s", result.stderr)
+	}
+}
+
+func TestCLIMissingArguments(t *testing.T) {
+	result := runCLI(t, "run", "python")
+	if result.exitCode != 1 {
+		t.Errorf("Expected exit code 1, got %d", result.exitCode)
+	}
+	if !strings.Contains(result.stderr, "accepts 2 arg(s)") {
+		t.Errorf("Expected a usage error, got:\n%s", result.stderr)
+	}
+}
+
+func TestCLILanguageList(t *testing.T) {
+	result := runCLI(t, "--json", "lang", "list")
+	if result.exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", result.exitCode, result.stderr)
+	}
+
+	var languages []string
+	if err := json.Unmarshal([]byte(result.stdout), &languages); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, result.stdout)
+	}
+	for _, want := range []string{"python", "go", "javascript"} {
+		if !contains(languages, want) {
+			t.Errorf("Expected %s in %v", want, languages)
+		}
+	}
+}
+
+func TestAPIHealth(t *testing.T) {
+	var health struct {
+		Status string `json:"status"`
+	}
+	if status := request(t, http.MethodGet, "/healthz", nil, &health); status != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+	if health.Status != "healthy" {
+		t.Errorf("Expected a healthy server, got %q", health.Status)
+	}
+}
+
+func TestAPILanguages(t *testing.T) {
+	var body struct {
+		Languages []string `json:"languages"`
+	}
+	if status := request(t, http.MethodGet, "/v1/languages", nil, &body); status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if !contains(body.Languages, "python") {
+		t.Errorf("Expected python in %v", body.Languages)
+	}
+}
+
+// jobBody is the part of a job response the tests check
+type jobBody struct {
+	JobID    string `json:"job_id"`
+	Status   string `json:"status"`
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Logs     map[string]struct {
+		URL string `json:"url"`
+	} `json:"logs"`
+}
+
+func TestAPIExecuteSync(t *testing.T) {
+	requireTool(t, "python3")
+	var job jobBody
+	status := request(t, http.MethodPost, "/v1/execute/sync",
+		map[string]string{"language": "python", "code": "print(1 + 1)"}, &job)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if job.Status != "completed" || job.ExitCode != 0 || job.Stdout != "2\n" {
+		t.Errorf("Unexpected job: %+v", job)
+	}
+}
+
+func TestAPIExecuteAsync(t *testing.T) {
+	requireTool(t, "python3")
+	var created jobBody
+	status := request(t, http.MethodPost, "/v1/execute",
+		map[string]string{"language": "python", "code": "import sys; print('partial'); sys.exit(3)"}, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+	if created.JobID == "" {
+		t.Fatal("Expected a job ID")
+	}
+
+	job := waitJob(t, created.JobID)
+	if job.Status != "failed" || job.ExitCode != 3 || job.Stdout != "partial\n" {
+		t.Errorf("Unexpected job: %+v", job)
+	}
+
+	// The full output is also available as a log
+	resp, err := http.Get(baseURL + job.Logs["stdout"].URL)
+	if err != nil {
+		t.Fatalf("Failed to get logs: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(data) != "partial\n" {
+		t.Errorf("Unexpected logs: status %d, body %q", resp.StatusCode, data)
+	}
+}
+
+func TestAPIEnvelope(t *testing.T) {
+	var envelope struct {
+		Data struct {
+			JobID string `json:"job_id"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+		Meta struct {
+			APIVersion string `json:"api_version"`
+			Status     int    `json:"status"`
+		} `json:"meta"`
+	}
+	status := request(t, http.MethodPost, "/v2/execute",
+		map[string]string{"language": "python", "code": "print('v2')"}, &envelope)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+	if envelope.Data.JobID == "" || envelope.Error != nil {
+		t.Errorf("Unexpected envelope: %+v", envelope)
+	}
+	if envelope.Meta.APIVersion != "v2" || envelope.Meta.Status != http.StatusCreated {
+		t.Errorf("Unexpected meta: %+v", envelope.Meta)
+	}
+}
+
+func TestAPIUnsupportedLanguage(t *testing.T) {
+	var body struct {
+		Error string `json:"error"`
+	}
+	status := request(t, http.MethodPost, "/v1/execute",
+		map[string]string{"language": "cobol", "code": "DISPLAY 'HELLO'"}, &body)
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", status)
+	}
+	if body.Error != "unsupported language: cobol" {
+		t.Errorf("Unexpected error %q", body.Error)
+	}
+}
+
+func TestAPIUnknownJob(t *testing.T) {
+	if status := request(t, http.MethodGet, "/v1/jobs/job-missing", nil, nil); status != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", status)
+	}
+}
+
+func TestAPIEstimate(t *testing.T) {
+	var estimate struct {
+		Samples       int    `json:"samples"`
+		QueueWait     string `json:"queue_wait"`
+		ResourceClass struct {
+			Name string `json:"name"`
+		} `json:"resource_class"`
+	}
+	status := request(t, http.MethodPost, "/v1/estimate",
+		map[string]interface{}{"language": "python", "code_size": 100, "timeout": 5, "memory_limit": 64}, &estimate)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if estimate.QueueWait == "" || estimate.ResourceClass.Name == "" {
+		t.Errorf("Expected a queue wait and resource class, got %+v", estimate)
+	}
+
+	if status := request(t, http.MethodPost, "/v1/estimate", map[string]string{"language": "cobol"}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unsupported language, got %d", status)
+	}
+}
+
+func TestAPIAnalytics(t *testing.T) {
+	requireTool(t, "python3")
+	var created jobBody
+	status := request(t, http.MethodPost, "/v1/execute",
+		map[string]interface{}{"language": "python", "code": "print('analytics')", "labels": map[string]string{"tenant": "e2e"}}, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+	waitJob(t, created.JobID)
+
+	var report struct {
+		Jobs    int `json:"jobs"`
+		Tenants []struct {
+			Value string `json:"value"`
+		} `json:"tenants"`
+	}
+	if status := request(t, http.MethodGet, "/v1/analytics?since=1h", nil, &report); status != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", status)
+	}
+	if report.Jobs == 0 || len(report.Tenants) == 0 {
+		t.Errorf("Expected the job in the analytics, got %+v", report)
+	}
+
+	result := runCLI(t, "report", "weekly", "--server", baseURL, "--job-log", "")
+	if result.exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", result.exitCode, result.stderr)
+	}
+	if !strings.Contains(result.stdout, "# ForgeAI Weekly Report") || !strings.Contains(result.stdout, "| e2e |") {
+		t.Errorf("Unexpected report:\n%s", result.stdout)
+	}
+}
+
+func TestCLIAdminDrain(t *testing.T) {
+	requireTool(t, "python3")
+	var created jobBody
+	status := request(t, http.MethodPost, "/v1/execute",
+		map[string]string{"language": "python", "code": "import time; time.sleep(1); print('drained')"}, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+	defer runCLI(t, "admin", "resume", "--server", baseURL)
+
+	result := runCLI(t, "admin", "drain", "--server", baseURL, "--reason", "deploy", "--wait", "--json")
+	if result.exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", result.exitCode, result.stderr)
+	}
+	var m struct {
+		Enabled bool   `json:"enabled"`
+		Reason  string `json:"reason"`
+		Drained bool   `json:"drained"`
+	}
+	if err := json.Unmarshal([]byte(result.stdout), &m); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, result.stdout)
+	}
+	if !m.Enabled || m.Reason != "deploy" || !m.Drained {
+		t.Errorf("Expected a drained server, got %+v", m)
+	}
+	if job := waitJob(t, created.JobID); job.Status != "completed" || job.Stdout != "drained\n" {
+		t.Errorf("Expected the running job to finish, got %+v", job)
+	}
+
+	// New jobs are refused until the server resumes
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/v1/execute",
+		strings.NewReader(`{"language": "python", "code": "print(1)"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /v1/execute failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if status := request(t, http.MethodGet, "/readyz", nil, nil); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503, got %d", status)
+	}
+
+	if result := runCLI(t, "admin", "resume", "--server", baseURL); result.exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", result.exitCode, result.stderr)
+	}
+	if status := request(t, http.MethodGet, "/readyz", nil, nil); status != http.StatusOK {
+		t.Errorf("Expected /readyz to return 200, got %d", status)
+	}
+}
+
+// waitJob polls a job until it has finished
+func waitJob(t *testing.T, id string) jobBody {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		var job jobBody
+		if status := request(t, http.MethodGet, "/v1/jobs/"+id, nil, &job); status != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", status)
+		}
+		switch job.Status {
+		case "pending", "running":
+			time.Sleep(100 * time.Millisecond)
+		default:
+			return job
+		}
+	}
+	t.Fatalf("job %s did not finish", id)
+	return jobBody{}
+}
+
+func contains(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
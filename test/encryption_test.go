@@ -0,0 +1,149 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/envelope"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+	"forgeai/pkg/storage"
+)
+
+// testKeyring returns a keyring with the given keys, the last one active
+func testKeyring(t *testing.T, ids ...string) *envelope.Keyring {
+	t.Helper()
+	keys := envelope.NewKeyring()
+	for _, id := range ids {
+		if err := keys.Add(id, bytes.Repeat([]byte(id[:1]), envelope.KeySize)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := keys.SetActive(ids[len(ids)-1]); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestEnvelopeRotation(t *testing.T) {
+	ctx := context.Background()
+	sealed, err := envelope.Seal(ctx, testKeyring(t, "a"), []byte("proprietary"))
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("proprietary")) {
+		t.Error("Expected the plaintext to be encrypted")
+	}
+
+	// A keyring without the wrapping key cannot open the envelope
+	if _, err := envelope.Open(ctx, testKeyring(t, "b"), sealed); err == nil {
+		t.Error("Expected Open to fail without the key")
+	}
+
+	rotated, changed, err := envelope.Rewrap(ctx, testKeyring(t, "a", "b"), sealed)
+	if err != nil || !changed {
+		t.Fatalf("Rewrap failed: %v %v", changed, err)
+	}
+	if id, _ := envelope.KeyID(rotated); id != "b" {
+		t.Errorf("Expected the data key to be wrapped by b, got %s", id)
+	}
+	plaintext, err := envelope.Open(ctx, testKeyring(t, "b"), rotated)
+	if err != nil || string(plaintext) != "proprietary" {
+		t.Errorf("Expected the rotated envelope to open with the new key, got %q %v", plaintext, err)
+	}
+}
+
+func TestEncryptedBackend(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	local, err := storage.NewLocalBackend(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := "stored before encryption"
+	if err := local.Put(ctx, "jobs/old.log", strings.NewReader(legacy), int64(len(legacy)), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := storage.WithEncryption(storage.NewCompressedBackend(local), testKeyring(t, "a"))
+	secret := strings.Repeat("secret output\n", 200)
+	if err := backend.Put(ctx, "jobs/job-1/logs/stdout.log", strings.NewReader(secret), int64(len(secret)), "text/plain"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	stored, _ := os.ReadFile(filepath.Join(root, "jobs/job-1/logs/stdout.log.forgeai-gz"))
+	if !envelope.IsSealed(stored) {
+		t.Error("Expected the stored object to be compressed and encrypted")
+	}
+	for key, want := range map[string]string{"jobs/job-1/logs/stdout.log": secret, "jobs/old.log": legacy} {
+		r, err := backend.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get %s failed: %v", key, err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if string(data) != want {
+			t.Errorf("Unexpected contents of %s: %q", key, data)
+		}
+	}
+
+	// Rotation rewraps encrypted objects and encrypts older ones
+	rotating := storage.WithEncryption(storage.NewCompressedBackend(local), testKeyring(t, "a", "b"))
+	stats, err := storage.Encryption(rotating).Rotate(ctx, "jobs/")
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if stats.Rewrapped != 1 || stats.Encrypted != 1 || stats.Failed != 0 {
+		t.Errorf("Unexpected rotation: %+v", stats)
+	}
+	r, err := storage.WithEncryption(storage.NewCompressedBackend(local), testKeyring(t, "b")).Get(ctx, "jobs/old.log")
+	if err != nil {
+		t.Fatalf("Expected the old key to be retired, got %v", err)
+	}
+	r.Close()
+}
+
+func TestSpillQueueEncryptsCode(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{}, Delay: 100 * time.Millisecond}
+
+	dir := t.TempDir()
+	queue := &jobs.SpillQueue{Dir: dir, Threshold: 1, Workers: 1, Keys: testKeyring(t, "a")}
+	defer queue.Close()
+	manager := jobs.NewManager()
+	manager.Queue = queue
+	manager.HashCodeOnly = true
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var submitted []*jobs.Job
+	for _, code := range []string{"print('one')", "print('two')", "print('three')"} {
+		job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: code})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		submitted = append(submitted, job)
+	}
+	if spill, _ := os.ReadFile(filepath.Join(dir, "spill.jsonl")); len(spill) == 0 || bytes.Contains(spill, []byte("print(")) {
+		t.Errorf("Expected spilled code to be encrypted, got %q", spill)
+	}
+
+	for _, job := range submitted {
+		if job, _ = manager.Wait(ctx, job.ID); job.Status != "completed" {
+			t.Fatalf("Expected %s to complete, got %s: %s", job.ID, job.Status, job.Error)
+		}
+		if job.Code != "" || job.CodeHash == "" {
+			t.Errorf("Expected only the code hash to be kept, got %q %q", job.Code, job.CodeHash)
+		}
+	}
+	if calls := fake.Calls(); len(calls) != 3 || calls[2].Code != "print('three')" {
+		t.Errorf("Expected spilled jobs to run their code, got %+v", calls)
+	}
+}
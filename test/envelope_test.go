@@ -0,0 +1,136 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestAPIv2Envelopes(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "hello\n"}}
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		AdminToken: "admin-secret",
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+		Hooks: api.Hooks{Actor: func(r *http.Request) string {
+			if r.Header.Get("Authorization") == "Bearer mallory-credential" {
+				return "mallory"
+			}
+			return ""
+		}},
+	})
+
+	do := func(method, path, body string, header ...string) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(method, "http://forgeai"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, data
+	}
+	envelope := func(data []byte) (api.Envelope, map[string]json.RawMessage) {
+		t.Helper()
+		var env api.Envelope
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(data, &env); err != nil {
+			t.Fatalf("Expected an envelope, got %s", data)
+		}
+		json.Unmarshal(data, &raw)
+		return env, raw
+	}
+
+	// Successful responses carry the resource in data and a null error
+	resp, data := do(http.MethodPost, "/v2/execute/sync", `{"language": "python", "code": "print('hello')"}`)
+	env, raw := envelope(data)
+	if resp.StatusCode != http.StatusOK || env.Meta.APIVersion != "v2" || env.Meta.Status != resp.StatusCode {
+		t.Errorf("Unexpected meta for %d: %+v", resp.StatusCode, env.Meta)
+	}
+	if string(raw["error"]) != "null" || len(raw) != 3 {
+		t.Errorf("Expected data, a null error, and meta, got %s", data)
+	}
+	job, _ := env.Data.(map[string]interface{})
+	if job["status"] != "completed" || job["stdout"] != "hello\n" {
+		t.Errorf("Expected the job in data, got %v", env.Data)
+	}
+	jobID, _ := job["job_id"].(string)
+
+	// The status of the response is kept in meta
+	resp, data = do(http.MethodPost, "/v2/execute", `{"language": "python", "code": "print(2)"}`)
+	if env, _ = envelope(data); env.Meta.Status != resp.StatusCode || resp.StatusCode != http.StatusCreated || env.Error != nil {
+		t.Errorf("Expected a 201 envelope, got %d %s", resp.StatusCode, data)
+	}
+
+	// /v1 returns the same resource unwrapped
+	resp, data = do(http.MethodGet, "/v1/jobs/"+jobID, "")
+	var plain map[string]interface{}
+	json.Unmarshal(data, &plain)
+	if resp.StatusCode != http.StatusOK || plain["job_id"] != jobID || plain["meta"] != nil {
+		t.Errorf("Expected the bare job from /v1, got %d %s", resp.StatusCode, data)
+	}
+	if link := resp.Header.Get("Link"); link != "</v2/jobs/"+jobID+`>; rel="successor-version"` {
+		t.Errorf("Expected /v1 to link its successor, got %q", link)
+	}
+
+	// Errors carry a null data, a stable code, the message, and the other
+	// fields of the error as details
+	cases := []struct {
+		method, path, body string
+		header             []string
+		status             int
+		code, message      string
+	}{
+		{http.MethodGet, "/v2/jobs/missing", "", nil, http.StatusNotFound, api.ErrCodeNotFound, "job not found"},
+		{http.MethodPost, "/v2/execute", `{"language": "python"`, nil, http.StatusBadRequest, api.ErrCodeInvalidRequest, ""},
+		{http.MethodGet, "/v2/admin/quotas", "", nil, http.StatusUnauthorized, api.ErrCodeUnauthorized, ""},
+		{http.MethodGet, "/v2/admin/quotas", "", []string{"Authorization", "Bearer mallory-credential"}, http.StatusForbidden, api.ErrCodeForbidden, ""},
+		{http.MethodGet, "/v2/jobs/" + jobID + "/logs?stream=stdin", "", nil, http.StatusBadRequest, api.ErrCodeInvalidRequest, "stream must be stdout or stderr"},
+	}
+	for _, tc := range cases {
+		resp, data := do(tc.method, tc.path, tc.body, tc.header...)
+		env, raw := envelope(data)
+		if resp.StatusCode != tc.status || env.Meta.Status != tc.status || string(raw["data"]) != "null" {
+			t.Errorf("%s %s: expected a %d envelope without data, got %d %s", tc.method, tc.path, tc.status, resp.StatusCode, data)
+			continue
+		}
+		if env.Error == nil || env.Error.Code != tc.code || env.Error.Message == "" || (tc.message != "" && env.Error.Message != tc.message) {
+			t.Errorf("%s %s: expected error %s %q, got %+v", tc.method, tc.path, tc.code, tc.message, env.Error)
+		}
+	}
+
+	resp, data = do(http.MethodPost, "/v2/execute", `{"code": "1"}`)
+	if env, _ = envelope(data); env.Error == nil || env.Error.Details["fields"] == nil || env.Error.Details["error"] != nil {
+		t.Errorf("Expected the fields of the error in its details, got %s", data)
+	}
+
+	resp, data = do(http.MethodPost, "/v2/execute", `{"language": "python", "code": "print(1)"}`, "Idempotency-Key", "envelope-1")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected the job to be created, got %d %s", resp.StatusCode, data)
+	}
+	resp, data = do(http.MethodPost, "/v2/execute", `{"language": "python", "code": "print(2)"}`, "Idempotency-Key", "envelope-1")
+	if env, _ = envelope(data); resp.StatusCode != http.StatusUnprocessableEntity || env.Error == nil || env.Error.Code != api.ErrCodeUnprocessable {
+		t.Errorf("Expected an unprocessable envelope for a reused key, got %d %s", resp.StatusCode, data)
+	}
+
+	// Non-JSON responses are not wrapped
+	resp, data = do(http.MethodGet, "/v2/jobs/"+jobID+"/logs", "")
+	if resp.StatusCode != http.StatusOK || string(data) != "hello\n" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected the raw log from /v2, got %d %s %q", resp.StatusCode, resp.Header.Get("Content-Type"), data)
+	}
+}
@@ -0,0 +1,481 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/events"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/kafka"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+// eventRecorder records the requests of an HTTP event sink
+type eventRecorder struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *eventRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+}
+
+// wait waits until n requests were recorded
+func (r *eventRecorder) wait(t *testing.T, n int) ([]*http.Request, [][]byte) {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		if len(r.requests) >= n {
+			defer r.mu.Unlock()
+			return r.requests, r.bodies
+		}
+		r.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d events, got %d", n, len(r.requests))
+	return nil, nil
+}
+
+func TestEventsHTTPSinks(t *testing.T) {
+	var structured, binary eventRecorder
+	structuredSrv := httptest.NewServer(&structured)
+	defer structuredSrv.Close()
+	binarySrv := httptest.NewServer(&binary)
+	defer binarySrv.Close()
+
+	emitter, err := events.New(config.EventsConfig{
+		Source: "/forgeai/test",
+		Sinks: []config.EventSinkConfig{
+			{Type: "http", URL: structuredSrv.URL, Headers: map[string]string{"Authorization": "Bearer token"}},
+			{Type: "http", URL: binarySrv.URL, Mode: "binary", Events: []string{"completed"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{
+		Result: &sandbox.ExecutionResult{Stdout: "secret output\n", ExitCode: 3},
+		Delay:  100 * time.Millisecond,
+	}
+	manager := jobs.NewManager()
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go emitter.Run(ctx, manager)
+	time.Sleep(50 * time.Millisecond)
+
+	job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print('secret code')", Labels: map[string]string{"team": "data"}})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	// Structured events carry every attribute in the body
+	requests, bodies := structured.wait(t, 3)
+	var types []string
+	for i, req := range requests[:3] {
+		if ct := req.Header.Get("Content-Type"); ct != events.StructuredContentType {
+			t.Errorf("Expected content type %s, got %s", events.StructuredContentType, ct)
+		}
+		if req.Header.Get("Authorization") != "Bearer token" {
+			t.Error("Expected the configured headers")
+		}
+		if strings.Contains(string(bodies[i]), "secret") {
+			t.Errorf("Expected events without code or output, got %s", bodies[i])
+		}
+		var event events.CloudEvent
+		if err := json.Unmarshal(bodies[i], &event); err != nil {
+			t.Fatalf("Invalid event: %v", err)
+		}
+		if event.SpecVersion != "1.0" || event.Source != "/forgeai/test" || event.Subject != job.ID || event.Data.JobID != job.ID {
+			t.Errorf("Unexpected event attributes: %+v", event)
+		}
+		types = append(types, event.Type)
+	}
+	if strings.Join(types, ",") != "dev.forgeai.job.created,dev.forgeai.job.started,dev.forgeai.job.failed" {
+		t.Errorf("Unexpected event types %v", types)
+	}
+
+	var failed events.CloudEvent
+	json.Unmarshal(bodies[2], &failed)
+	if failed.Data.ExitCode == nil || *failed.Data.ExitCode != 3 || failed.Data.Labels["team"] != "data" || failed.Data.CompletedAt == nil {
+		t.Errorf("Unexpected data of the failed event: %+v", failed.Data)
+	}
+	if failed.ID != job.ID+"-failed-1" {
+		t.Errorf("Expected a stable event ID, got %s", failed.ID)
+	}
+
+	// The binary sink only wants completed jobs
+	fake.Default.Result.ExitCode = 0
+	job, err = manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print(1)"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	requests, bodies = binary.wait(t, 1)
+	req := requests[0]
+	if req.Header.Get("ce-type") != "dev.forgeai.job.completed" || req.Header.Get("ce-id") != job.ID+"-completed-1" ||
+		req.Header.Get("ce-specversion") != "1.0" || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected binary event headers: %v", req.Header)
+	}
+	var data events.JobData
+	if err := json.Unmarshal(bodies[0], &data); err != nil || data.JobID != job.ID || data.Status != "completed" {
+		t.Errorf("Expected the job data as the body, got %s (%v)", bodies[0], err)
+	}
+
+	if _, err := events.New(config.EventsConfig{Sinks: []config.EventSinkConfig{{Type: "http", URL: structuredSrv.URL, Events: []string{"finished"}}}}); err == nil {
+		t.Error("Expected an unknown event to be rejected")
+	}
+}
+
+func TestEventsNATSSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	type message struct {
+		subject string
+		payload []byte
+	}
+	published := make(chan message, 4)
+	connects := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.WriteString(conn, `INFO {"server_id":"test","max_payload":1048576}`+"\r\n")
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch {
+					case len(fields) == 0:
+					case fields[0] == "CONNECT":
+						connects <- strings.TrimSpace(strings.TrimPrefix(line, "CONNECT"))
+					case fields[0] == "PING":
+						io.WriteString(conn, "PONG\r\n")
+					case fields[0] == "PUB" && len(fields) == 3:
+						n, _ := strconv.Atoi(fields[2])
+						payload := make([]byte, n+2)
+						io.ReadFull(r, payload)
+						published <- message{fields[1], payload[:n]}
+					}
+				}
+			}()
+		}
+	}()
+
+	emitter, err := events.New(config.EventsConfig{Sinks: []config.EventSinkConfig{
+		{Type: "nats", URL: "nats://secret-token@" + listener.Addr().String(), Subject: "ci.jobs"},
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	exitCode := 0
+	event := events.CloudEvent{
+		SpecVersion: events.SpecVersion,
+		ID:          "job-1-completed-1",
+		Source:      "/forgeai/test",
+		Type:        events.TypePrefix + events.EventCompleted,
+		Subject:     "job-1",
+		Time:        time.Now(),
+		Data:        events.JobData{JobID: "job-1", Status: "completed", ExitCode: &exitCode},
+	}
+	for i := 0; i < 2; i++ {
+		if err := emitter.Emit(context.Background(), event); err != nil {
+			t.Fatalf("Emit failed: %v", err)
+		}
+	}
+
+	var options map[string]interface{}
+	json.Unmarshal([]byte(<-connects), &options)
+	if options["auth_token"] != "secret-token" {
+		t.Errorf("Expected the token of the URL, got %v", options)
+	}
+	for i := 0; i < 2; i++ {
+		msg := <-published
+		var got events.CloudEvent
+		if err := json.Unmarshal(msg.payload, &got); err != nil || msg.subject != "ci.jobs.completed" || got.ID != event.ID {
+			t.Errorf("Unexpected message on %s: %s (%v)", msg.subject, msg.payload, err)
+		}
+	}
+	if len(connects) != 0 {
+		t.Error("Expected the connection to be reused")
+	}
+}
+
+// produced is a record batch produced to the fake Kafka broker
+type produced struct {
+	topic     string
+	partition int32
+	batch     []byte
+}
+
+// serveKafka answers the metadata and produce requests of a producer with a
+// single broker that leads the two partitions of every topic
+func serveKafka(t *testing.T, listener net.Listener, batches chan<- produced) {
+	host, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			for {
+				var size [4]byte
+				if _, err := io.ReadFull(conn, size[:]); err != nil {
+					return
+				}
+				req := make([]byte, binary.BigEndian.Uint32(size[:]))
+				if _, err := io.ReadFull(conn, req); err != nil {
+					return
+				}
+				apiKey := binary.BigEndian.Uint16(req)
+				correlation := req[4:8]
+				clientLen := int(binary.BigEndian.Uint16(req[8:]))
+				body := req[10+clientLen:]
+
+				resp := append([]byte{}, correlation...)
+				switch apiKey {
+				case 3: // metadata v4
+					topic := string(body[6 : 6+int(binary.BigEndian.Uint16(body[4:]))])
+					resp = binary.BigEndian.AppendUint32(resp, 0) // throttle
+					resp = binary.BigEndian.AppendUint32(resp, 1)
+					resp = binary.BigEndian.AppendUint32(resp, 1) // node 1
+					resp = appendKafkaString(resp, host)
+					resp = binary.BigEndian.AppendUint32(resp, uint32(port))
+					resp = binary.BigEndian.AppendUint16(resp, 0xffff) // no rack
+					resp = binary.BigEndian.AppendUint16(resp, 0xffff) // no cluster ID
+					resp = binary.BigEndian.AppendUint32(resp, 1)      // controller
+					resp = binary.BigEndian.AppendUint32(resp, 1)
+					resp = binary.BigEndian.AppendUint16(resp, 0)
+					resp = appendKafkaString(resp, topic)
+					resp = append(resp, 0)
+					resp = binary.BigEndian.AppendUint32(resp, 2)
+					for partition := uint32(0); partition < 2; partition++ {
+						resp = binary.BigEndian.AppendUint16(resp, 0)
+						resp = binary.BigEndian.AppendUint32(resp, partition)
+						resp = binary.BigEndian.AppendUint32(resp, 1) // leader
+						resp = binary.BigEndian.AppendUint32(resp, 1)
+						resp = binary.BigEndian.AppendUint32(resp, 1)
+						resp = binary.BigEndian.AppendUint32(resp, 1)
+						resp = binary.BigEndian.AppendUint32(resp, 1)
+					}
+				case 0: // produce v3
+					body = body[2+2+4+4:] // transactional ID, acks, timeout, topics
+					topicLen := int(binary.BigEndian.Uint16(body))
+					topic := string(body[2 : 2+topicLen])
+					body = body[2+topicLen+4:]
+					partition := int32(binary.BigEndian.Uint32(body))
+					batchLen := binary.BigEndian.Uint32(body[4:])
+					batches <- produced{topic, partition, body[8 : 8+batchLen]}
+
+					resp = binary.BigEndian.AppendUint32(resp, 1)
+					resp = appendKafkaString(resp, topic)
+					resp = binary.BigEndian.AppendUint32(resp, 1)
+					resp = binary.BigEndian.AppendUint32(resp, uint32(partition))
+					resp = binary.BigEndian.AppendUint16(resp, 0)
+					resp = binary.BigEndian.AppendUint64(resp, 0)
+					resp = binary.BigEndian.AppendUint64(resp, ^uint64(0))
+					resp = binary.BigEndian.AppendUint32(resp, 0) // throttle
+				default:
+					t.Errorf("Unexpected Kafka request %d", apiKey)
+					return
+				}
+				conn.Write(binary.BigEndian.AppendUint32(nil, uint32(len(resp))))
+				conn.Write(resp)
+			}
+		}()
+	}
+}
+
+func appendKafkaString(b []byte, s string) []byte {
+	return append(binary.BigEndian.AppendUint16(b, uint16(len(s))), s...)
+}
+
+// kafkaRecord is the only record of a record batch
+type kafkaRecord struct {
+	key, value []byte
+	headers    map[string]string
+}
+
+func decodeKafkaBatch(t *testing.T, batch []byte) kafkaRecord {
+	if batch[16] != 2 {
+		t.Fatalf("Expected the v2 message format, got %d", batch[16])
+	}
+	if crc := crc32.Checksum(batch[21:], crc32.MakeTable(crc32.Castagnoli)); crc != binary.BigEndian.Uint32(batch[17:]) {
+		t.Fatal("Invalid record batch CRC")
+	}
+	if binary.BigEndian.Uint32(batch[57:]) != 1 {
+		t.Fatal("Expected one record")
+	}
+
+	r := bytes.NewReader(batch[61:])
+	varint := func() int64 { v, _ := binary.ReadVarint(r); return v }
+	take := func(n int64) []byte { b := make([]byte, n); io.ReadFull(r, b); return b }
+	varint()     // length
+	r.ReadByte() // attributes
+	varint()     // timestamp delta
+	varint()     // offset delta
+	rec := kafkaRecord{headers: map[string]string{}}
+	rec.key = take(varint())
+	rec.value = take(varint())
+	for n := varint(); n > 0; n-- {
+		key := take(varint())
+		rec.headers[string(key)] = string(take(varint()))
+	}
+	return rec
+}
+
+func TestEventsKafkaSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	batches := make(chan produced, 4)
+	go serveKafka(t, listener, batches)
+
+	var registrations []string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		registrations = append(registrations, r.URL.Path)
+		var schema map[string]string
+		if err := json.Unmarshal(body, &schema); err != nil || !strings.Contains(schema["schema"], "ExecutionRecord") {
+			t.Errorf("Unexpected schema registration %s", body)
+		}
+		io.WriteString(w, `{"id":7}`)
+	}))
+	defer registry.Close()
+
+	emitter, err := events.New(config.EventsConfig{Sinks: []config.EventSinkConfig{{
+		Type:           "kafka",
+		Events:         []string{"completed", "failed"},
+		Brokers:        []string{listener.Addr().String()},
+		Topic:          "analytics.executions",
+		Format:         "avro",
+		SchemaRegistry: registry.URL,
+	}}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	exitCode := 0
+	event := events.CloudEvent{
+		SpecVersion: events.SpecVersion,
+		ID:          "job-1-completed-1",
+		Source:      "/forgeai/test",
+		Type:        events.TypePrefix + events.EventCompleted,
+		Subject:     "job-1",
+		Time:        time.Now(),
+		Data:        events.JobData{JobID: "job-1", Status: "completed", Language: "python", ExitCode: &exitCode, Attempts: 1},
+	}
+	for i := 0; i < 2; i++ {
+		if err := emitter.Emit(context.Background(), event); err != nil {
+			t.Fatalf("Emit failed: %v", err)
+		}
+	}
+	started := event
+	started.Type = events.TypePrefix + events.EventStarted
+	emitter.Emit(context.Background(), started)
+
+	if len(registrations) != 1 || registrations[0] != "/subjects/analytics.executions-value/versions" {
+		t.Errorf("Expected the schema to be registered once under the topic's subject, got %v", registrations)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("Expected only the completed events to be produced, got %d", len(batches))
+	}
+
+	msg := <-batches
+	if msg.topic != "analytics.executions" {
+		t.Errorf("Unexpected topic %s", msg.topic)
+	}
+	rec := decodeKafkaBatch(t, msg.batch)
+	if string(rec.key) != "job-1" {
+		t.Errorf("Expected records keyed by job ID, got %q", rec.key)
+	}
+	if rec.headers["ce_type"] != "dev.forgeai.job.completed" || rec.headers["ce_id"] != event.ID || rec.headers["content-type"] != events.AvroContentType {
+		t.Errorf("Unexpected record headers %v", rec.headers)
+	}
+	want := append([]byte{0, 0, 0, 0, 7}, events.EncodeAvro(event.Data)...)
+	if !bytes.Equal(rec.value, want) {
+		t.Errorf("Expected the Avro record in the wire format, got %x", rec.value)
+	}
+	if again := <-batches; again.partition != msg.partition || !bytes.Equal(decodeKafkaBatch(t, again.batch).key, rec.key) {
+		t.Error("Expected records of a job on one partition")
+	}
+
+	if _, err := events.New(config.EventsConfig{Sinks: []config.EventSinkConfig{{Type: "kafka", Brokers: []string{"kafka:9092"}, Format: "avro"}}}); err == nil {
+		t.Error("Expected avro without a schema registry to be rejected")
+	}
+}
+
+func TestKafkaProducerStalledBroker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+	// The broker reads requests and never answers them
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	producer, err := kafka.NewProducer(kafka.Config{Brokers: []string{listener.Addr().String()}, Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewProducer failed: %v", err)
+	}
+	defer producer.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- producer.Produce(context.Background(), "executions", kafka.Message{Value: []byte("{}")})
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected producing to a stalled broker to fail")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected a request without a deadline to time out")
+	}
+}
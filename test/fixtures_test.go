@@ -0,0 +1,153 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/executor"
+	"forgeai/pkg/fixtures"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestFixtureStore(t *testing.T) {
+	dir := t.TempDir()
+	store := fixtures.NewStore(dir)
+	store.MaxSize = 16
+	if err := store.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	f, err := store.Put("sales.csv", strings.NewReader("a,b\n1,2\n"))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if f.Size != 8 || len(f.SHA256) != 64 {
+		t.Errorf("Unexpected fixture: %+v", f)
+	}
+	if info, err := os.Stat(store.Path("sales.csv")); err != nil || info.Mode().Perm()&0222 != 0 {
+		t.Errorf("Expected a read-only fixture file, got %v, %v", info, err)
+	}
+
+	if _, err := store.Put("big.csv", strings.NewReader(strings.Repeat("x", 17))); !errors.Is(err, fixtures.ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+	if _, err := store.Put("../escape", strings.NewReader("x")); err == nil {
+		t.Error("Expected an invalid name to be rejected")
+	}
+
+	// Fixtures survive a restart
+	reopened := fixtures.NewStore(dir)
+	if err := reopened.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if list := reopened.List(); len(list) != 1 || list[0] != f {
+		t.Errorf("Expected the stored fixture after reopening, got %+v", list)
+	}
+
+	if _, err := reopened.Resolve([]string{"sales.csv", "missing.csv"}); !errors.Is(err, fixtures.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if !reopened.Delete("sales.csv") || reopened.Delete("sales.csv") {
+		t.Error("Expected the fixture to be deleted once")
+	}
+	if _, err := os.Stat(reopened.Path("sales.csv")); !os.IsNotExist(err) {
+		t.Errorf("Expected the fixture file to be removed, got %v", err)
+	}
+}
+
+func TestFixturesAPI(t *testing.T) {
+	store := fixtures.NewStore(t.TempDir())
+	if err := store.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	mounted := make(chan []sandbox.Fixture, 1)
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Fixtures:   store,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			if job != nil {
+				mounted <- job.Fixtures
+			}
+			return sandboxtest.NewFakeExecutor()
+		}),
+	})
+
+	do := func(method, path string, body []byte) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, "http://forgeai"+path, bytes.NewReader(body))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := do(http.MethodPut, "/v1/fixtures/data.csv", []byte("x,y\n"))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 for the upload, got %d", resp.StatusCode)
+	}
+
+	execute := func(names ...string) int {
+		body, _ := json.Marshal(map[string]interface{}{"language": "python", "code": "print(1)", "fixtures": names})
+		resp := do(http.MethodPost, "/v1/execute", body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := execute("missing.csv"); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown fixture, got %d", status)
+	}
+	if status := execute("data.csv"); status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	select {
+	case got := <-mounted:
+		if len(got) != 1 || got[0].Name != "data.csv" || got[0].Source != store.Path("data.csv") {
+			t.Errorf("Expected data.csv to be mounted, got %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Job did not run")
+	}
+
+	resp = do(http.MethodDelete, "/v1/fixtures/data.csv", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 for the deletion, got %d", resp.StatusCode)
+	}
+}
+
+func TestLocalExecutorFixtures(t *testing.T) {
+	requireTool(t, "python")
+	source := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(source, []byte("fixture data"), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	exec := executor.NewLocalExecutor()
+	exec.Fixtures = []sandbox.Fixture{{Name: "input.txt", Source: source}}
+	code := "import os\n" +
+		"path = os.path.join(os.environ['FORGEAI_FIXTURES'], 'input.txt')\n" +
+		"print(open(path).read())\n" +
+		"try:\n    open(path, 'w')\nexcept OSError:\n    print('read-only')\n"
+	result, err := exec.Execute(context.Background(), "python", code)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if !strings.Contains(result.Stdout, "fixture data") {
+		t.Errorf("Expected the fixture contents, got %q", result.Stdout)
+	}
+	if os.Geteuid() != 0 && !strings.Contains(result.Stdout, "read-only") {
+		t.Errorf("Expected the fixture to be read-only, got %q", result.Stdout)
+	}
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"forgeai/pkg/analytics"
+	"forgeai/pkg/hardware"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestHardwareClass(t *testing.T) {
+	class := hardware.Class{CPUs: 8, CPUQuota: 2, Score: 2}
+	if class.Cores() != 2 {
+		t.Errorf("Expected the quota to limit the cores, got %g", class.Cores())
+	}
+	if got := class.Normalize(time.Second); got != 2*time.Second {
+		t.Errorf("Expected a twice as fast worker to take twice as long on the reference, got %s", got)
+	}
+	if got := (hardware.Class{}).Normalize(time.Second); got != time.Second {
+		t.Errorf("Expected uncalibrated durations to be unchanged, got %s", got)
+	}
+
+	probe := &hardware.Probe{Worker: "replica-1"}
+	current := probe.Class()
+	if current.Worker != "replica-1" || current.Arch != runtime.GOARCH || current.CPUs != runtime.NumCPU() || current.Score != 0 {
+		t.Errorf("Unexpected class %+v", current)
+	}
+	if score := probe.Calibrate(50 * time.Millisecond); score <= 0 || probe.Class().Score != score {
+		t.Errorf("Expected a positive score to be reported, got %g and %+v", score, probe.Class())
+	}
+	if probe.CalibratedAt().IsZero() {
+		t.Error("Expected the calibration time to be recorded")
+	}
+}
+
+func TestJobManagerHardware(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n", Duration: time.Second}}
+	manager := jobs.NewManager()
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+		return fake
+	})
+	manager.Hardware = &hardware.Probe{Worker: "replica-1"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print(1)"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if job, err = manager.Wait(ctx, job.ID); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if job.Hardware == nil || job.Hardware.Worker != "replica-1" || job.Hardware.CPUs == 0 {
+		t.Fatalf("Expected the job to record the hardware of its worker, got %+v", job.Hardware)
+	}
+
+	// Reports can normalize durations by the score of each worker
+	records := []analytics.Record{
+		{Language: "python", Status: "completed", Duration: time.Second, Hardware: &hardware.Class{Score: 2}},
+		{Language: "python", Status: "completed", Duration: 2 * time.Second, Hardware: &hardware.Class{Score: 1}},
+	}
+	report := analytics.Summarize(records, analytics.Options{Normalize: true})
+	if len(report.Languages) != 1 || report.Languages[0].P95 != 2*time.Second {
+		t.Errorf("Expected both jobs to take 2s on the reference hardware, got %+v", report.Languages)
+	}
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestAPIHooks(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "hooked\n"}}
+
+	finished := make(chan *jobs.Job, 1)
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+		Hooks: api.Hooks{
+			OnBeforeExecute: func(ctx context.Context, req *api.ExecuteRequest) error {
+				switch req.Header.Get("X-Tenant") {
+				case "":
+					return &api.HookError{Status: http.StatusUnauthorized, Message: "missing tenant"}
+				case "banned":
+					return context.Canceled
+				}
+				req.Labels = map[string]string{"tenant": req.Header.Get("X-Tenant")}
+				req.Code = "# checked\n" + req.Code
+				return nil
+			},
+			OnAfterExecute: func(ctx context.Context, req api.ExecuteRequest, job *jobs.Job) {
+				finished <- job
+			},
+		},
+	})
+
+	execute := func(tenant string) int {
+		body, _ := json.Marshal(map[string]string{"language": "python", "code": "print(1)"})
+		req, _ := http.NewRequest(http.MethodPost, "http://forgeai/v1/execute", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := execute(""); status != http.StatusUnauthorized {
+		t.Errorf("Expected the hook's status 401, got %d", status)
+	}
+	if status := execute("banned"); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a plain hook error, got %d", status)
+	}
+	if status := execute("acme"); status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	select {
+	case job := <-finished:
+		if job.Status != "completed" || job.Labels["tenant"] != "acme" || job.Code != "# checked\nprint(1)" {
+			t.Errorf("Expected the transformed job to complete, got %s %v %q", job.Status, job.Labels, job.Code)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("OnAfterExecute was not called")
+	}
+	if calls := fake.Calls(); len(calls) != 1 {
+		t.Errorf("Expected only the authorized request to run, got %d calls", len(calls))
+	}
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"forgeai/pkg/config"
+	"forgeai/pkg/httpclient"
+)
+
+// writeCABundle writes the certificate of a TLS test server as a CA bundle
+func writeCABundle(t *testing.T, srv *httptest.Server) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write CA bundle: %v", err)
+	}
+	return path
+}
+
+// newHTTPClient creates a client with the transport of cfg that connects to
+// srv whatever the host of the request, so that certificates are checked
+// against host names
+func newHTTPClient(t *testing.T, cfg config.HTTPConfig, srv *httptest.Server) *http.Client {
+	transport, err := httpclient.Transport(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	return &http.Client{Transport: transport}
+}
+
+func TestHTTPClientCABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// The test server's certificate is for example.com
+	if _, err := newHTTPClient(t, config.HTTPConfig{}, srv).Get("https://example.com/"); err == nil {
+		t.Error("Expected a certificate of an unknown authority to be rejected")
+	}
+
+	bundle := writeCABundle(t, srv)
+	resp, err := newHTTPClient(t, config.HTTPConfig{CABundle: bundle}, srv).Get("https://example.com/")
+	if err != nil {
+		t.Fatalf("Expected the CA bundle to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0644)
+	if _, err := httpclient.Transport(config.HTTPConfig{CABundle: empty}); err == nil {
+		t.Error("Expected a CA bundle without certificates to be rejected")
+	}
+}
+
+func TestHTTPClientPinnedCerts(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	bundle := writeCABundle(t, srv)
+	pin := httpclient.Pin(srv.Certificate())
+	other := "sha256/" + strings.Repeat("A", 43) + "="
+
+	for _, tc := range []struct {
+		name  string
+		pins  map[string][]string
+		valid bool
+	}{
+		{"matching pin", map[string][]string{"example.com": {other, pin}}, true},
+		{"mismatched pin", map[string][]string{"example.com": {other}}, false},
+		{"other host pinned", map[string][]string{"registry.example": {other}}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newHTTPClient(t, config.HTTPConfig{CABundle: bundle, PinnedCerts: tc.pins}, srv)
+			resp, err := client.Get("https://example.com/")
+			if tc.valid && err != nil {
+				t.Fatalf("Expected the connection to succeed, got %v", err)
+			}
+			if !tc.valid {
+				if err == nil || !strings.Contains(err.Error(), "pinned") {
+					t.Fatalf("Expected a pin mismatch, got %v", err)
+				}
+				return
+			}
+			resp.Body.Close()
+		})
+	}
+
+	if _, err := httpclient.Transport(config.HTTPConfig{PinnedCerts: map[string][]string{"example.com": {"md5/abc"}}}); err == nil {
+		t.Error("Expected an invalid pin to be rejected")
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+	}))
+	defer proxy.Close()
+
+	transport, err := httpclient.Transport(config.HTTPConfig{
+		Proxy:   proxy.URL,
+		NoProxy: []string{"internal.example"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://registry.example/api/plugins", nil)
+	proxyURL, err := transport.Proxy(req)
+	if err != nil || proxyURL == nil || proxyURL.Host != strings.TrimPrefix(proxy.URL, "http://") {
+		t.Fatalf("Expected requests to go through the proxy, got %v, %v", proxyURL, err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.Fatalf("Request through the proxy failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := <-proxied; got != "http://registry.example/api/plugins" {
+		t.Errorf("Expected the proxy to receive the request, got %q", got)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://api.internal.example/", nil)
+	if proxyURL, err := transport.Proxy(req); err != nil || proxyURL != nil {
+		t.Errorf("Expected no_proxy hosts to bypass the proxy, got %v, %v", proxyURL, err)
+	}
+
+	for _, bad := range []string{"proxy:3128", "ftp://proxy:21"} {
+		if _, err := httpclient.Transport(config.HTTPConfig{Proxy: bad}); err == nil {
+			t.Errorf("Expected proxy %q to be rejected", bad)
+		}
+	}
+}
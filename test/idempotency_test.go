@@ -0,0 +1,133 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}, Delay: 50 * time.Millisecond}
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+
+	execute := func(path, key, body string) (*http.Response, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, "http://forgeai"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp, out
+	}
+	body := `{"language": "python", "code": "print(1)"}`
+
+	// Replaying a key returns the original job without running it again
+	resp, first := execute("/v1/execute", "key-1", body)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Fatalf("Expected a new job, got %d %v", resp.StatusCode, first)
+	}
+	resp, again := execute("/v1/execute", "key-1", body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Idempotent-Replayed") != "true" || again["job_id"] != first["job_id"] {
+		t.Errorf("Expected the original job replayed, got %d %v", resp.StatusCode, again)
+	}
+
+	// Synchronous replays wait for the original job and return its result
+	resp, done := execute("/v1/execute/sync", "key-1", body)
+	if resp.StatusCode != http.StatusOK || done["job_id"] != first["job_id"] || done["stdout"] != "ok\n" {
+		t.Errorf("Expected the result of the original job, got %d %v", resp.StatusCode, done)
+	}
+	if calls := len(fake.Calls()); calls != 1 {
+		t.Errorf("Expected the code to run once, ran %d times", calls)
+	}
+
+	// A key names one request body only
+	resp, out := execute("/v1/execute", "key-1", `{"language": "python", "code": "print(2)"}`)
+	if resp.StatusCode != http.StatusUnprocessableEntity || out["error"] == nil {
+		t.Errorf("Expected a different body to be refused, got %d %v", resp.StatusCode, out)
+	}
+	resp, out = execute("/v1/execute", "key-1", `{"language": "python", "code": "print(1)", "timeout": 5}`)
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("Expected different settings to be refused, got %d %v", resp.StatusCode, out)
+	}
+
+	// Other keys create jobs of their own
+	resp, other := execute("/v1/execute", "key-2", body)
+	if resp.StatusCode != http.StatusCreated || other["job_id"] == first["job_id"] {
+		t.Errorf("Expected a new job for another key, got %d %v", resp.StatusCode, other)
+	}
+}
+
+func TestIdempotencyKeysConcurrent(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}, Delay: 50 * time.Millisecond}
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+
+	// Duplicates racing each other share one job, which one of them creates
+	const requests = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ids := make(map[string]int)
+	created := 0
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodPost, "http://forgeai/v1/execute/sync", strings.NewReader(`{"language": "python", "code": "print(1)"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", "concurrent")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Errorf("Request failed: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			var job map[string]interface{}
+			json.NewDecoder(resp.Body).Decode(&job)
+			if resp.StatusCode != http.StatusOK || job["status"] != "completed" {
+				t.Errorf("Expected the completed job, got %d %v", resp.StatusCode, job)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			id, _ := job["job_id"].(string)
+			ids[id]++
+			if resp.Header.Get("Idempotent-Replayed") == "" {
+				created++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(ids) != 1 || created != 1 {
+		t.Errorf("Expected one job created for all requests, got %v with %d created", ids, created)
+	}
+	if calls := len(fake.Calls()); calls != 1 {
+		t.Errorf("Expected the code to run once, ran %d times", calls)
+	}
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"forgeai/pkg/inspect"
+)
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		language, code string
+		imports        []string
+		operations     []string
+		capabilities   []string
+	}{
+		{
+			language: "python",
+			code: "import os, subprocess as sp\n" +
+				"from urllib.request import urlopen\n" +
+				"# import socket\n" +
+				"note = 'import ctypes'\n" +
+				"sp.run(['ls'])\n" +
+				"urlopen('http://example.com')\n" +
+				"with open(os.environ['CONFIG']) as f:\n" +
+				"    print(f.read())\n",
+			imports:      []string{"os", "subprocess", "urllib.request"},
+			operations:   []string{"subprocess", "urllib.request", "subprocess.run", "urllib.request.urlopen", "open", "os.environ"},
+			capabilities: []string{inspect.Environment, inspect.Filesystem, inspect.Network, inspect.Process},
+		},
+		{
+			language: "javascript",
+			code: "const { readFileSync: read } = require('node:fs');\n" +
+				"import { exec } from 'child_process';\n" +
+				"// fetch('https://example.com')\n" +
+				"const half = 4 / 2, re = /require('net')/g;\n" +
+				"exec(read('cmd.txt', 'utf8'));\n" +
+				"new Function('return process')();\n",
+			imports:      []string{"fs", "child_process"},
+			operations:   []string{"fs", "child_process", "child_process.exec", "fs.readFileSync", "Function"},
+			capabilities: []string{inspect.DynamicCode, inspect.Filesystem, inspect.Process},
+		},
+		{
+			language: "go",
+			code: "package main\n\n" +
+				"import (\n\t\"fmt\"\n\t\"os\"\n\trun \"os/exec\"\n\t_ \"net/http/pprof\"\n)\n\n" +
+				"func main() {\n\tfmt.Println(os.Getenv(\"HOME\"))\n\trun.Command(\"ls\").Run()\n}\n",
+			imports:      []string{"fmt", "os", "os/exec", "net/http/pprof"},
+			operations:   []string{"os/exec", "net/http/pprof", "os.Getenv", "os/exec.Command"},
+			capabilities: []string{inspect.Environment, inspect.Network, inspect.Process},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			report, err := inspect.Inspect(tt.language, tt.code)
+			if err != nil {
+				t.Fatalf("Inspect failed: %v", err)
+			}
+			var imports, operations []string
+			for _, imp := range report.Imports {
+				imports = append(imports, imp.Module)
+			}
+			for _, op := range report.Operations {
+				operations = append(operations, op.Name)
+			}
+			if !reflect.DeepEqual(imports, tt.imports) {
+				t.Errorf("Expected imports %v, got %v", tt.imports, imports)
+			}
+			if !reflect.DeepEqual(operations, tt.operations) {
+				t.Errorf("Expected operations %v, got %v", tt.operations, operations)
+			}
+			if !reflect.DeepEqual(report.Capabilities, tt.capabilities) {
+				t.Errorf("Expected capabilities %v, got %v", tt.capabilities, report.Capabilities)
+			}
+		})
+	}
+
+	if _, err := inspect.Inspect("go", "package main\nfunc main( {"); err == nil {
+		t.Error("Expected invalid Go code to fail")
+	}
+	if _, err := inspect.Inspect("rust", "fn main() {}"); !errors.Is(err, inspect.ErrUnsupported) {
+		t.Errorf("Expected rust to be unsupported, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/joblog"
+)
+
+// writeJobLog appends n records to a new job log and returns its path and
+// lines
+func writeJobLog(t *testing.T, n int) (string, []string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jobs.log")
+	log, err := joblog.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for i := 1; i <= n; i++ {
+		record := joblog.Record{JobID: fmt.Sprintf("job-%d", i), Status: "completed", Language: "python", CreatedAt: time.Now().UTC()}
+		if _, err := log.Append(record); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	return path, lines[:len(lines)-1]
+}
+
+// writeLines replaces the contents of a job log
+func writeLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "")), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobLogVerify(t *testing.T) {
+	path, _ := writeJobLog(t, 3)
+	report, err := joblog.Verify(path)
+	if err != nil || !report.Valid || report.Entries != 3 {
+		t.Fatalf("Expected an intact log of 3 entries, got %+v, %v", report, err)
+	}
+	anchor, err := joblog.ReadAnchor(joblog.AnchorPath(path))
+	if err != nil || anchor.Entries != 3 || anchor.LastHash != report.LastHash {
+		t.Errorf("Expected the anchor to record the head, got %+v, %v", anchor, err)
+	}
+
+	// Appending continues the chain of the reopened log
+	log, err := joblog.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if seq, hash := log.Head(); seq != 3 || hash != report.LastHash {
+		t.Errorf("Expected the head of the reopened log, got %d %s", seq, hash)
+	}
+	if entry, err := log.Append(joblog.Record{JobID: "job-4"}); err != nil || entry.Seq != 4 || entry.PrevHash != report.LastHash {
+		t.Errorf("Expected entry 4 to follow the head, got %+v, %v", entry, err)
+	}
+}
+
+func TestJobLogTampering(t *testing.T) {
+	cases := []struct {
+		name     string
+		tamper   func([]string) []string
+		brokenAt uint64
+		reason   string
+	}{
+		{"edited", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"status":"completed"`, `"status":"failed"`, 1)
+			return lines
+		}, 2, "entry hash does not match its contents"},
+		{"removed", func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}, 2, "sequence number 3 out of order"},
+		{"reordered", func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, 2, "sequence number 3 out of order"},
+		{"invalid", func(lines []string) []string {
+			lines[2] = "{not json\n"
+			return lines
+		}, 3, "entry is not valid JSON"},
+		{"truncated", func(lines []string) []string {
+			return lines[:2]
+		}, 3, "log ends at entry 2, but its anchor records 3 entries"},
+		{"rewritten", func(lines []string) []string {
+			// A tail rewritten with a consistent chain of its own
+			other, _ := writeJobLog(t, 3)
+			data, _ := os.ReadFile(other)
+			return []string{string(data)}
+		}, 3, "entry hash does not match the anchor"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path, lines := writeJobLog(t, 3)
+			writeLines(t, path, tc.tamper(lines))
+
+			report, err := joblog.Verify(path)
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if report.Valid || report.BrokenAt != tc.brokenAt || report.Reason != tc.reason {
+				t.Errorf("Expected the log broken at %d: %s, got %+v", tc.brokenAt, tc.reason, report)
+			}
+			if _, err := joblog.Open(path); err == nil {
+				t.Error("Expected the tampered log not to be opened")
+			}
+		})
+	}
+}
+
+func TestJobLogTruncationWithAnchor(t *testing.T) {
+	path, lines := writeJobLog(t, 3)
+	kept, err := joblog.ReadAnchor(joblog.AnchorPath(path))
+	if err != nil {
+		t.Fatalf("ReadAnchor failed: %v", err)
+	}
+
+	// The anchor beside the log is removed along with its tail
+	writeLines(t, path, lines[:2])
+	os.Remove(joblog.AnchorPath(path))
+	if report, err := joblog.Verify(path); err != nil || !report.Valid {
+		t.Errorf("Expected the chain alone to look intact, got %+v, %v", report, err)
+	}
+	report, err := joblog.VerifyAnchor(path, kept)
+	if err != nil {
+		t.Fatalf("VerifyAnchor failed: %v", err)
+	}
+	if report.Valid || report.BrokenAt != 3 {
+		t.Errorf("Expected the copy of the anchor to detect the truncation, got %+v", report)
+	}
+
+	// A log that is gone while its anchor remains is not started afresh
+	path, _ = writeJobLog(t, 1)
+	os.Remove(path)
+	if _, err := joblog.Open(path); err == nil {
+		t.Error("Expected a removed log with an anchor not to be opened")
+	}
+}
+
+func TestJobLogAnchorBehind(t *testing.T) {
+	path, _ := writeJobLog(t, 2)
+	behind, err := joblog.ReadAnchor(joblog.AnchorPath(path))
+	if err != nil {
+		t.Fatalf("ReadAnchor failed: %v", err)
+	}
+	log, err := joblog.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := log.Append(joblog.Record{JobID: "job-3"}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	// The log may have grown past an older anchor, as when the process
+	// stopped before writing the anchor of its last entry
+	if report, err := joblog.VerifyAnchor(path, behind); err != nil || !report.Valid || report.Entries != 3 {
+		t.Errorf("Expected the log to verify against an older anchor, got %+v, %v", report, err)
+	}
+}
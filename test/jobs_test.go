@@ -0,0 +1,518 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+	"forgeai/pkg/storage"
+)
+
+func TestJobManagerSubmitAndWait(t *testing.T) {
+	manager := jobs.NewManager()
+	manager.Workers = 1
+
+	events, unsubscribe := manager.Subscribe(jobs.Filter{})
+	defer unsubscribe()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	job, err := manager.Submit(ctx, jobs.Spec{
+		Language: "javascript",
+		Code:     "console.log('hello')",
+		Labels:   map[string]string{"suite": "jobs"},
+	})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	job, err = manager.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if !job.Finished() {
+		t.Errorf("Expected a finished job, got status %s", job.Status)
+	}
+
+	var statuses []string
+	for len(events) > 0 {
+		event := <-events
+		if event.JobID == job.ID {
+			statuses = append(statuses, event.Status)
+		}
+	}
+	if len(statuses) < 3 || statuses[0] != "pending" || statuses[1] != "running" {
+		t.Errorf("Unexpected status events: %v", statuses)
+	}
+}
+
+func TestJobManagerSubmitValidation(t *testing.T) {
+	manager := jobs.NewManager()
+
+	if _, err := manager.Submit(context.Background(), jobs.Spec{}); err == nil {
+		t.Error("Expected an error for an empty spec")
+	}
+
+	_, err := manager.Submit(context.Background(), jobs.Spec{
+		Language: "python",
+		Code:     "print(1)",
+		ParentID: "job-missing",
+	})
+	if !errors.Is(err, jobs.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing parent, got %v", err)
+	}
+
+	if _, err := manager.Wait(context.Background(), "job-missing"); !errors.Is(err, jobs.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from Wait, got %v", err)
+	}
+}
+
+func TestJobManagerStrictRequirements(t *testing.T) {
+	manager := jobs.NewManager()
+	spec := jobs.Spec{
+		Language: "python",
+		Code:     "print(1)",
+		Require:  sandbox.Requirements{MemoryLimit: true},
+	}
+
+	// The local executor cannot enforce memory limits
+	manager.Strict = true
+	_, err := manager.Submit(context.Background(), spec)
+	if !errors.Is(err, jobs.ErrUnenforceable) {
+		t.Fatalf("Expected ErrUnenforceable, got %v", err)
+	}
+
+	var unenforceable *jobs.UnenforceableError
+	if !errors.As(err, &unenforceable) || len(unenforceable.Unmet) != 1 {
+		t.Errorf("Expected one unmet requirement, got %v", err)
+	}
+
+	manager.Strict = false
+	job, err := manager.Submit(context.Background(), spec)
+	if err != nil {
+		t.Fatalf("Submit failed in permissive mode: %v", err)
+	}
+	manager.Wait(context.Background(), job.ID)
+}
+
+// fixedClock always tells the same time
+type fixedClock struct{ now time.Time }
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+// refusingQueue refuses every job
+type refusingQueue struct{}
+
+func (refusingQueue) Dispatch(ctx context.Context, job *jobs.Job, run func(context.Context)) error {
+	return errors.New("queue full")
+}
+
+func TestJobManagerInjectedBackends(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "faked\n"}}
+	clock := fixedClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+	store := jobs.NewMemoryStore()
+
+	manager := jobs.NewManager()
+	manager.Store = store
+	manager.Clock = clock
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+		return fake
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print('real')"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	job, err = manager.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if job.Status != "completed" || job.Result.Stdout != "faked\n" {
+		t.Errorf("Expected the fake executor's result, got %s: %+v", job.Status, job.Result)
+	}
+	if !job.CreatedAt.Equal(clock.now) || !job.CompletedAt.Equal(clock.now) {
+		t.Errorf("Expected times from the clock, got %v and %v", job.CreatedAt, job.CompletedAt)
+	}
+	if _, ok := store.Get(job.ID); !ok {
+		t.Error("Expected the job in the injected store")
+	}
+	if backend := manager.Capabilities().Backend; backend != "fake" {
+		t.Errorf("Expected the capabilities of the fake executor, got %s", backend)
+	}
+
+	manager.Queue = refusingQueue{}
+	if _, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print(2)"}); err == nil {
+		t.Fatal("Expected an error from a refusing queue")
+	}
+	cancelled := manager.ListJobs(jobs.Filter{Status: "cancelled"})
+	if len(cancelled) != 1 || !strings.Contains(cancelled[0].Error, "queue full") {
+		t.Errorf("Expected the refused job to be cancelled, got %v", cancelled)
+	}
+}
+
+func TestJobManagerReconfigure(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{
+		Result: &sandbox.ExecutionResult{Stdout: "faked output\n"},
+		Delay:  200 * time.Millisecond,
+	}
+	manager := jobs.NewManager()
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+		return fake
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	before, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print(1)"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	generation := manager.Reconfigure(jobs.Settings{
+		Rlimits:      sandbox.Rlimits{OpenFiles: 32},
+		InlineOutput: 5,
+	})
+	if generation != 2 || manager.Generation() != 2 {
+		t.Fatalf("Expected generation 2, got %d and %d", generation, manager.Generation())
+	}
+
+	after, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print(2)"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	for _, job := range []*jobs.Job{before, after} {
+		if _, err := manager.Wait(ctx, job.ID); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+
+	if before.ConfigGeneration != 1 || after.ConfigGeneration != 2 {
+		t.Errorf("Expected generations 1 and 2, got %d and %d", before.ConfigGeneration, after.ConfigGeneration)
+	}
+	if before.Rlimits.OpenFiles != sandbox.DefaultRlimits().OpenFiles || after.Rlimits.OpenFiles != 32 {
+		t.Errorf("Expected the running job to keep its limits, got %+v and %+v", before.Rlimits, after.Rlimits)
+	}
+	if before.Result.Stdout != "faked output\n" {
+		t.Errorf("Expected the running job to keep its inline output, got %q", before.Result.Stdout)
+	}
+	if after.Result.Stdout == "faked output\n" {
+		t.Error("Expected the new job to use the reloaded inline output")
+	}
+}
+
+func TestJobManagerMaintenance(t *testing.T) {
+	manager := jobs.NewManager()
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+		return sandboxtest.NewFakeExecutor()
+	})
+
+	m := manager.EnterMaintenance("deploy")
+	if !m.Enabled || m.Reason != "deploy" || !m.Drained {
+		t.Errorf("Expected an idle manager to be drained, got %+v", m)
+	}
+
+	// The watchdog resuming intake does not end maintenance
+	manager.Pause("overloaded")
+	manager.Resume()
+	ctx := context.Background()
+	if _, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print(1)"}); !errors.Is(err, jobs.ErrPaused) {
+		t.Errorf("Expected ErrPaused in maintenance mode, got %v", err)
+	}
+
+	if m := manager.ExitMaintenance(); m.Enabled || m.Drained {
+		t.Errorf("Expected maintenance to end, got %+v", m)
+	}
+	if _, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print(1)"}); err != nil {
+		t.Errorf("Expected jobs to be accepted again, got %v", err)
+	}
+}
+
+func TestJobManagerDeduplication(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{
+		Result: &sandbox.ExecutionResult{Stdout: "once\n"},
+		Delay:  100 * time.Millisecond,
+	}
+	manager := jobs.NewManager()
+	manager.DedupWindow = time.Minute
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+		return fake
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	spec := jobs.Spec{Language: "python", Code: "print('once')"}
+	first, err := manager.Submit(ctx, spec)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	second, err := manager.Submit(ctx, spec)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if second.ID != first.ID || manager.Coalesced(first.ID) != 1 {
+		t.Errorf("Expected the identical submission to share job %s, got %s", first.ID, second.ID)
+	}
+
+	spec.MemoryLimit = 64
+	other, err := manager.Submit(ctx, spec)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if other.ID == first.ID {
+		t.Error("Expected different limits to create a new job")
+	}
+
+	for _, job := range []*jobs.Job{first, other} {
+		if _, err := manager.Wait(ctx, job.ID); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+	if calls := len(fake.Calls()); calls != 2 {
+		t.Errorf("Expected 2 executions, got %d", calls)
+	}
+
+	// Cancelled jobs are not shared
+	fingerprint := jobs.Fingerprint("request")
+	job, _ := manager.CreateJobDeduplicated(fingerprint, "python", "print(1)")
+	manager.CancelJob(job.ID)
+	if _, coalesced := manager.CreateJobDeduplicated(fingerprint, "python", "print(1)"); coalesced {
+		t.Error("Expected a cancelled job not to be shared")
+	}
+}
+
+func TestJobManagerEstimate(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{
+		Duration: 20 * time.Second,
+		Profile:  &sandbox.Profile{PeakRSS: 200 * 1024 * 1024},
+	}}
+	manager := jobs.NewManager()
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+		return fake
+	})
+
+	if e := manager.Estimate(jobs.EstimateRequest{Language: "python", CodeSize: 20}); e.Samples != 0 || e.Class.Name != "medium" {
+		t.Errorf("Expected the default limits to pick medium without history, got %+v", e)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, code := range []string{"print('a' * 10)", "print('b' * 10)", "print('c' * 10)"} {
+		job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: code})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		if _, err := manager.Wait(ctx, job.ID); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+
+	e := manager.Estimate(jobs.EstimateRequest{Language: "python", CodeSize: 20})
+	if e.Samples != 3 || !e.Similar || e.Duration != 20*time.Second {
+		t.Errorf("Expected 3 similar samples of 20s, got %+v", e)
+	}
+	if e.Class.Name != "large" || e.Fits {
+		t.Errorf("Expected the large class and the defaults not to fit, got %+v", e)
+	}
+	if e := manager.Estimate(jobs.EstimateRequest{Language: "python", CodeSize: 5000}); e.Similar || e.Samples != 3 {
+		t.Errorf("Expected all jobs of the language for an unusual size, got %+v", e)
+	}
+	if e := manager.Estimate(jobs.EstimateRequest{Language: "go", CodeSize: 20}); e.Samples != 0 {
+		t.Errorf("Expected no samples of another language, got %+v", e)
+	}
+}
+
+func TestJobManagerBinaryOutput(t *testing.T) {
+	binary := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR" + strings.Repeat("\xff", 100)
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: binary, Stderr: "warning\n"}}
+	manager := jobs.NewManager()
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+		return fake
+	})
+	manager.Reconfigure(jobs.Settings{InlineOutput: 64})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print(1)"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if job, err = manager.Wait(ctx, job.ID); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+
+	// The result carries the start of the output base64 encoded
+	if job.Result.StdoutEncoding != sandbox.EncodingBase64 || job.Result.StderrEncoding != "" {
+		t.Fatalf("Expected only stdout to be encoded, got %q and %q", job.Result.StdoutEncoding, job.Result.StderrEncoding)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(job.Result.Stdout)
+	if err != nil || string(decoded) != binary[:64] {
+		t.Errorf("Expected the first 64 bytes, got %q, %v", decoded, err)
+	}
+
+	// Cut output ends on a whole base64 quantum and counts what it lacks
+	// in bytes of output
+	text, truncated := job.Output(jobs.StreamStdout, 10)
+	if len(text) != 8 || truncated != int64(len(binary)-6) {
+		t.Errorf("Expected 8 characters lacking %d bytes, got %q lacking %d", len(binary)-6, text, truncated)
+	}
+
+	// The log keeps the output as it is
+	reader, log, err := manager.OpenLog(ctx, job, jobs.StreamStdout)
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	defer reader.Close()
+	data, _ := io.ReadAll(reader)
+	if string(data) != binary || !log.Binary || log.ContentType() != "application/octet-stream" {
+		t.Errorf("Expected the raw output as octet-stream, got %d bytes as %s", len(data), log.ContentType())
+	}
+}
+
+// blockingStorage holds uploads until it is released, or with
+// ignoreCancel even after their job was cancelled, and then reports them
+// stored
+type blockingStorage struct {
+	storage.Backend
+	started      chan struct{}
+	release      chan struct{}
+	stored       chan struct{}
+	ignoreCancel bool
+}
+
+func (s *blockingStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if strings.Contains(key, "/artifacts/") {
+		s.started <- struct{}{}
+		if s.ignoreCancel {
+			<-s.release
+			err := s.Backend.Put(context.Background(), key, r, size, contentType)
+			close(s.stored)
+			return err
+		}
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return s.Backend.Put(ctx, key, r, size, contentType)
+}
+
+func TestJobManagerArtifactUploadOutsideLock(t *testing.T) {
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocking := &blockingStorage{Backend: backend, started: make(chan struct{}, 1), release: make(chan struct{})}
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{
+		Artifacts: []sandbox.Artifact{{Name: "report.csv", ContentType: "text/csv", Data: []byte("a,b\n")}},
+	}}
+
+	manager := jobs.NewManager()
+	manager.Storage = blocking
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "x"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+
+	select {
+	case <-blocking.started:
+	case <-ctx.Done():
+		t.Fatal("Expected the artifact to be uploaded")
+	}
+	// A slow upload must not hold the manager
+	listed := make(chan struct{})
+	go func() {
+		manager.ListJobs(jobs.Filter{})
+		close(listed)
+	}()
+	select {
+	case <-listed:
+	case <-ctx.Done():
+		t.Fatal("Expected jobs to be listed while an artifact uploads")
+	}
+	close(blocking.release)
+
+	if job, err = manager.Wait(ctx, job.ID); err != nil || job.Status != "completed" {
+		t.Fatalf("Expected the job to complete, got %v %v", job.Status, err)
+	}
+	artifact := job.Result.Artifacts[0]
+	if artifact.Key != "jobs/"+job.ID+"/artifacts/report.csv" || artifact.Size != 4 || artifact.Data != nil {
+		t.Errorf("Expected the artifact to be recorded by its key, got %+v", artifact)
+	}
+}
+
+func TestJobManagerArtifactsOfCancelledJob(t *testing.T) {
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocking := &blockingStorage{Backend: backend, started: make(chan struct{}, 1), release: make(chan struct{}), stored: make(chan struct{}), ignoreCancel: true}
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{
+		Artifacts: []sandbox.Artifact{{Name: "report.csv", ContentType: "text/csv", Data: []byte("a,b\n")}},
+	}}
+
+	manager := jobs.NewManager()
+	manager.Storage = blocking
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "x"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	select {
+	case <-blocking.started:
+	case <-ctx.Done():
+		t.Fatal("Expected the artifact to be uploaded")
+	}
+
+	// The job is cancelled while its artifact uploads, and the upload lands
+	if !manager.CancelJob(job.ID) {
+		t.Fatal("Expected the running job to be cancelled")
+	}
+	close(blocking.release)
+	if job, err = manager.Wait(ctx, job.ID); err != nil || job.Status != "cancelled" {
+		t.Fatalf("Expected the job to be cancelled, got %v %v", job.Status, err)
+	}
+
+	// The uploaded artifact is deleted again
+	<-blocking.stored
+	key := "jobs/" + job.ID + "/artifacts/report.csv"
+	for {
+		objects, err := backend.List(ctx, "jobs/"+job.ID+"/")
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if len(objects) == 0 {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("Expected %s to be deleted, got %+v", key, objects)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
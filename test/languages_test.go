@@ -0,0 +1,89 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/languages"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestLanguageAliases(t *testing.T) {
+	defer languages.SetAliases(nil)
+
+	for name, want := range map[string]string{
+		"py":       "python",
+		" Python3": "python",
+		"NODE":     "javascript",
+		"golang":   "go",
+		"ts":       "typescript",
+		"python":   "python",
+		"Haskell":  "haskell",
+	} {
+		if got := languages.Normalize(name); got != want {
+			t.Errorf("Normalize(%q) = %q, expected %q", name, got, want)
+		}
+	}
+
+	// Configured aliases extend and override the defaults
+	if err := languages.SetAliases(map[string]string{"hs": "haskell", "ts": "javascript"}); err != nil {
+		t.Fatalf("SetAliases failed: %v", err)
+	}
+	if got := languages.Normalize("HS"); got != "haskell" {
+		t.Errorf("Expected hs to be haskell, got %q", got)
+	}
+	if got := languages.Normalize("ts"); got != "javascript" {
+		t.Errorf("Expected the configured alias to win, got %q", got)
+	}
+	if err := languages.SetAliases(map[string]string{"a": "b", "b": "c"}); err == nil {
+		t.Error("Expected aliases of aliases to be refused")
+	}
+}
+
+func TestAPILanguageAliases(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+
+	post := func(body string, v interface{}) int {
+		resp, err := client.Post("http://forgeai/v1/execute?sync=true", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(v)
+		return resp.StatusCode
+	}
+
+	var job struct {
+		Language string `json:"language"`
+	}
+	if status := post(`{"language": "Py", "code": "print(1)"}`, &job); status != http.StatusOK {
+		t.Fatalf("Expected the alias to run, got %d", status)
+	}
+	if job.Language != "python" {
+		t.Errorf("Expected the job to run as python, got %q", job.Language)
+	}
+	if got := fake.Calls(); len(got) != 1 || got[0].Language != "python" {
+		t.Errorf("Expected the executor to be called with python, got %+v", got)
+	}
+
+	// Errors name the language as it was sent
+	var invalid struct {
+		Error string `json:"error"`
+	}
+	if status := post(`{"language": "cobol85", "code": "1"}`, &invalid); status != http.StatusBadRequest || invalid.Error != "unsupported language: cobol85" {
+		t.Errorf("Expected cobol85 to be unsupported, got %d %q", status, invalid.Error)
+	}
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"forgeai/pkg/leader"
+)
+
+func TestLeaderElectionFailover(t *testing.T) {
+	lock := leader.NewFileLock(filepath.Join(t.TempDir(), "leader.json"))
+
+	var running [2]int32
+	var wg sync.WaitGroup
+	electors := make([]*leader.Elector, 2)
+	cancels := make([]context.CancelFunc, 2)
+	defer wg.Wait()
+	for i := range electors {
+		i := i
+		electors[i] = leader.NewElector(lock, []string{"a", "b"}[i])
+		electors[i].TTL = 300 * time.Millisecond
+		electors[i].RenewInterval = 50 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		defer cancel()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			electors[i].Run(ctx)
+		}()
+		go electors[i].Lead(ctx, func(ctx context.Context) {
+			atomic.AddInt32(&running[i], 1)
+			<-ctx.Done()
+			atomic.AddInt32(&running[i], -1)
+		})
+	}
+
+	waitLeader := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if electors[want].IsLeader() && atomic.LoadInt32(&running[want]) == 1 {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("replica %s did not become the leader", electors[want].ID)
+	}
+
+	// Let both campaign, then find who won
+	time.Sleep(200 * time.Millisecond)
+	first := 0
+	if electors[1].IsLeader() {
+		first = 1
+	}
+	waitLeader(first)
+	other := 1 - first
+	if electors[other].IsLeader() || atomic.LoadInt32(&running[other]) != 0 {
+		t.Fatal("Expected only one replica to lead")
+	}
+	if status := electors[other].Status(); status.Leader != electors[first].ID {
+		t.Errorf("Expected the follower to see leader %s, got %+v", electors[first].ID, status)
+	}
+
+	// The other replica takes over once the leader stops
+	cancels[first]()
+	waitLeader(other)
+	if atomic.LoadInt32(&running[first]) != 0 {
+		t.Error("Expected the duty of the old leader to stop")
+	}
+}
+
+func TestLeaderLeaseExpiry(t *testing.T) {
+	lock := leader.NewMemoryLock()
+	ctx := context.Background()
+
+	lease, err := lock.Acquire(ctx, "a", 50*time.Millisecond)
+	if err != nil || lease.Holder != "a" {
+		t.Fatalf("Expected a to acquire the lease, got %+v, %v", lease, err)
+	}
+	if lease, _ := lock.Acquire(ctx, "b", time.Minute); lease.Holder != "a" {
+		t.Errorf("Expected a to keep an unexpired lease, got %+v", lease)
+	}
+	if err := lock.Release(ctx, "b"); err != leader.ErrNotHeld {
+		t.Errorf("Expected ErrNotHeld, got %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if lease, _ := lock.Acquire(ctx, "b", time.Minute); lease.Holder != "b" {
+		t.Errorf("Expected b to take over an expired lease, got %+v", lease)
+	}
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"forgeai/pkg/executor"
+	"forgeai/pkg/lint"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestLintVetOutput(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{
+		Stdout: `{"vet_output": "# command-line-arguments\nvet: ./main.go:3:2: undefined: foo\nmain.go:4:14: fmt.Printf format %d has arg \"x\" of wrong type string\n"}`,
+	}}
+
+	result, err := lint.Run(context.Background(), fake, lint.Check, "go", "package main")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(result.Diagnostics) != 2 || result.Valid() {
+		t.Fatalf("Expected a type error and a vet finding, got %+v", result.Diagnostics)
+	}
+	if diag := result.Diagnostics[0]; diag.File != "main.go" || diag.Line != 3 || diag.Column != 2 || diag.Severity != "error" {
+		t.Errorf("Unexpected type error: %+v", diag)
+	}
+	if diag := result.Diagnostics[1]; diag.Line != 4 || diag.Severity != "warning" {
+		t.Errorf("Unexpected vet finding: %+v", diag)
+	}
+
+	if _, err := lint.Run(context.Background(), fake, lint.Format, "javascript", "x"); !errors.Is(err, lint.ErrUnsupported) {
+		t.Errorf("Expected formatting javascript to be unsupported, got %v", err)
+	}
+}
+
+func TestLintLocal(t *testing.T) {
+	exec := executor.NewLocalExecutor()
+	ctx := context.Background()
+	tests := []struct {
+		tool, op, language, code string
+		valid                    bool
+		line                     int
+	}{
+		{"python", lint.Check, "python", "print('ok')\n", true, 0},
+		{"python", lint.Check, "python", "x = 1\nprint(x\n", false, 2},
+		{"node", lint.Check, "javascript", "const s = \"`${1}`\";\n", true, 0},
+		{"node", lint.Check, "javascript", "\nlet x = ;\n", false, 2},
+		{"go", lint.Check, "go", "package main\n\nfunc main() {\n\tfoo()\n}\n", false, 4},
+		{"go", lint.Format, "go", "package main\nfunc main(){println(\"a\\tb\")}\n", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op+"/"+tt.language, func(t *testing.T) {
+			requireTool(t, tt.tool)
+			result, err := lint.Run(ctx, exec, tt.op, tt.language, tt.code)
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if result.Valid() != tt.valid {
+				t.Fatalf("Expected valid %v, got %+v", tt.valid, result.Diagnostics)
+			}
+			if !tt.valid && result.Diagnostics[0].Line != tt.line {
+				t.Errorf("Expected an error on line %d, got %+v", tt.line, result.Diagnostics[0])
+			}
+			if tt.op == lint.Format && result.Formatted != "package main\n\nfunc main() { println(\"a\\tb\") }\n" {
+				t.Errorf("Unexpected formatting: %q", result.Formatted)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/executor"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/runtime"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestLocale(t *testing.T) {
+	for _, tc := range []struct {
+		locale sandbox.Locale
+		valid  bool
+	}{
+		{sandbox.Locale{}, true},
+		{sandbox.Locale{Timezone: "Europe/Berlin", Name: "de_DE.UTF-8"}, true},
+		{sandbox.Locale{Timezone: "UTC", Name: "C"}, true},
+		{sandbox.Locale{Name: "sr_RS@latin"}, true},
+		{sandbox.Locale{Timezone: "Mars/Olympus"}, false},
+		{sandbox.Locale{Timezone: "Local"}, false},
+		{sandbox.Locale{Timezone: "../etc/passwd"}, false},
+		{sandbox.Locale{Name: "en US"}, false},
+		{sandbox.Locale{Name: "en_US.UTF-8;rm"}, false},
+	} {
+		if err := tc.locale.Validate(); (err == nil) != tc.valid {
+			t.Errorf("Validate(%+v) = %v, expected valid %v", tc.locale, err, tc.valid)
+		}
+	}
+
+	env := sandbox.Locale{Timezone: "Asia/Tokyo"}.Env()
+	want := []string{"TZ=Asia/Tokyo", "LANG=C.UTF-8", "LC_ALL=C.UTF-8"}
+	if strings.Join(env, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v, got %v", want, env)
+	}
+
+	profile := &runtime.NsjailExecutor{Locale: sandbox.Locale{Timezone: "Asia/Tokyo"}}
+	if rendered := profile.Profile("/tmp/ws").Render(); !strings.Contains(rendered, `envar: "TZ=Asia/Tokyo"`) {
+		t.Errorf("Expected the nsjail profile to set TZ, got:\n%s", rendered)
+	}
+}
+
+func TestLocalExecutorLocale(t *testing.T) {
+	requireTool(t, "python")
+	exec := executor.NewLocalExecutor()
+	code := "import os\nprint(os.environ['TZ'], os.environ['LANG'], os.environ['LC_ALL'])\n"
+
+	result, err := exec.Execute(context.Background(), "python", code)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got := strings.TrimSpace(result.Stdout); got != "UTC C.UTF-8 C.UTF-8" {
+		t.Errorf("Expected the default locale, got %q", got)
+	}
+
+	exec.Locale = sandbox.Locale{Timezone: "America/New_York", Name: "POSIX"}
+	result, err = exec.Execute(context.Background(), "python", code)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got := strings.TrimSpace(result.Stdout); got != "America/New_York POSIX POSIX" {
+		t.Errorf("Expected the configured locale, got %q", got)
+	}
+}
+
+func TestAPILocale(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Settings:   api.Settings{Locale: sandbox.Locale{Timezone: "Europe/Paris"}},
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+
+	type response struct {
+		Timezone string           `json:"timezone"`
+		Locale   string           `json:"locale"`
+		Fields   []api.FieldError `json:"fields"`
+	}
+	post := func(body string) (int, response) {
+		resp, err := client.Post("http://forgeai/v1/execute?sync=true", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var v response
+		json.NewDecoder(resp.Body).Decode(&v)
+		return resp.StatusCode, v
+	}
+
+	// Jobs take the server's defaults where they set nothing
+	status, job := post(`{"language": "python", "code": "print(1)", "locale": "fr_FR.UTF-8"}`)
+	if status != http.StatusOK || job.Timezone != "Europe/Paris" || job.Locale != "fr_FR.UTF-8" {
+		t.Errorf("Expected Europe/Paris and fr_FR.UTF-8, got %d %+v", status, job)
+	}
+
+	status, invalid := post(`{"language": "python", "code": "print(1)", "timezone": "Nowhere/Special", "locale": "fr FR"}`)
+	if status != http.StatusBadRequest || len(invalid.Fields) != 2 ||
+		invalid.Fields[0].Field != "timezone" || invalid.Fields[1].Field != "locale" {
+		t.Errorf("Expected timezone and locale to be invalid, got %d %+v", status, invalid.Fields)
+	}
+}
@@ -0,0 +1,183 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+	"forgeai/pkg/storage"
+)
+
+func TestJobLogDownloads(t *testing.T) {
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Logs are served from memory without storage and from storage with it
+	for name, backend := range map[string]storage.Backend{"memory": nil, "storage": backend} {
+		t.Run(name, func(t *testing.T) {
+			testJobLogDownloads(t, backend)
+		})
+	}
+}
+
+func testJobLogDownloads(t *testing.T, backend storage.Backend) {
+	const stdout = "0123456789abcdefghij"
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: stdout, Stderr: "oops\n"}}
+	fake.On("", "sleep", sandboxtest.Response{Result: &sandbox.ExecutionResult{}, Delay: time.Minute})
+	config := &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	}
+	config.InlineOutput = 8
+	if backend != nil {
+		config.Storage = backend
+	}
+	client, _ := startTestServer(t, config)
+
+	do := func(method, path, body string, header ...string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, "http://forgeai"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	// The job result holds the start of the output and what it lacks
+	_, data := do(http.MethodPost, "/v1/execute/sync", `{"language": "python", "code": "print()"}`)
+	var job map[string]interface{}
+	json.Unmarshal([]byte(data), &job)
+	if job["stdout"] != stdout[:8] || job["truncated_stdout"] != float64(len(stdout)-8) {
+		t.Fatalf("Expected the first 8 bytes of stdout, got %v", job)
+	}
+	logs := "/v1/jobs/" + job["job_id"].(string) + "/logs"
+
+	// The log holds all of it
+	resp, body := do(http.MethodGet, logs, "")
+	if resp.StatusCode != http.StatusOK || body != stdout {
+		t.Errorf("Expected the full stdout, got %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") ||
+		!strings.Contains(resp.Header.Get("Content-Disposition"), "-stdout.log") {
+		t.Errorf("Unexpected log headers %v", resp.Header)
+	}
+	if resp, body := do(http.MethodGet, logs+"?stream=stderr", ""); resp.StatusCode != http.StatusOK || body != "oops\n" {
+		t.Errorf("Expected stderr, got %d %q", resp.StatusCode, body)
+	}
+
+	// Ranges select part of it
+	ranges := []struct {
+		header, body, contentRange string
+	}{
+		{"bytes=2-5", "2345", "bytes 2-5/20"},
+		{"bytes=15-", "fghij", "bytes 15-19/20"},
+		{"bytes=-3", "hij", "bytes 17-19/20"},
+		{"bytes=18-100", "ij", "bytes 18-19/20"},
+	}
+	for _, r := range ranges {
+		resp, body := do(http.MethodGet, logs, "", "Range", r.header)
+		if resp.StatusCode != http.StatusPartialContent || body != r.body || resp.Header.Get("Content-Range") != r.contentRange {
+			t.Errorf("%s: expected %q as %s, got %d %q %s", r.header, r.body, r.contentRange, resp.StatusCode, body, resp.Header.Get("Content-Range"))
+		}
+	}
+	if resp, body := do(http.MethodGet, logs, "", "Range", "bytes=0-1,4-5"); resp.StatusCode != http.StatusOK || body != stdout {
+		t.Errorf("Expected multiple ranges to select the whole log, got %d %q", resp.StatusCode, body)
+	}
+	for _, header := range []string{"bytes=20-", "bytes=5-2", "bytes=-0"} {
+		resp, _ := do(http.MethodGet, logs, "", "Range", header)
+		if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable || resp.Header.Get("Content-Range") != "bytes */20" {
+			t.Errorf("%s: expected 416 with the size, got %d %s", header, resp.StatusCode, resp.Header.Get("Content-Range"))
+		}
+	}
+
+	// Only finished jobs of known streams have logs
+	if resp, _ := do(http.MethodGet, logs+"?stream=stdin", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown stream, got %d", resp.StatusCode)
+	}
+	if resp, _ := do(http.MethodGet, "/v1/jobs/missing/logs", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown job, got %d", resp.StatusCode)
+	}
+	_, data = do(http.MethodPost, "/v1/execute", `{"language": "python", "code": "sleep()"}`)
+	var running map[string]interface{}
+	json.Unmarshal([]byte(data), &running)
+	if resp, _ := do(http.MethodGet, "/v1/jobs/"+running["job_id"].(string)+"/logs", ""); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 for a running job, got %d", resp.StatusCode)
+	}
+	do(http.MethodDelete, "/v1/jobs/"+running["job_id"].(string), "")
+}
+
+func TestJobLogRetention(t *testing.T) {
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, backend := range map[string]storage.Backend{"memory": nil, "storage": backend} {
+		t.Run(name, func(t *testing.T) {
+			fake := sandboxtest.NewFakeExecutor()
+			fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "0123456789"}}
+			manager := jobs.NewManager()
+			manager.InlineOutput = 4
+			manager.LogRetention = time.Hour
+			if backend != nil {
+				manager.Storage = backend
+			}
+			manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "x"})
+			if err != nil {
+				t.Fatalf("Submit failed: %v", err)
+			}
+			if job, err = manager.Wait(ctx, job.ID); err != nil {
+				t.Fatalf("Wait failed: %v", err)
+			}
+
+			// Logs are kept until their retention passes
+			if removed := manager.PruneLogs(ctx, time.Now()); removed != 0 {
+				t.Errorf("Expected no logs removed within their retention, removed %d", removed)
+			}
+			reader, _, err := manager.OpenLog(ctx, job, jobs.StreamStdout)
+			if err != nil {
+				t.Fatalf("OpenLog failed: %v", err)
+			}
+			data, _ := io.ReadAll(reader)
+			reader.Close()
+			if string(data) != "0123456789" {
+				t.Errorf("Expected the full log, got %q", data)
+			}
+
+			if removed := manager.PruneLogs(ctx, time.Now().Add(2*time.Hour)); removed == 0 {
+				t.Error("Expected the log past its retention to be removed")
+			}
+			if _, _, err := manager.OpenLog(ctx, job, jobs.StreamStdout); !errors.Is(err, jobs.ErrLogExpired) {
+				t.Errorf("Expected the removed log to have expired, got %v", err)
+			}
+			if backend != nil {
+				if objects, _ := backend.List(ctx, "jobs/"); len(objects) != 0 {
+					t.Errorf("Expected the stored log to be deleted, got %v", objects)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/runtime"
+	"forgeai/pkg/sandbox"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of tests")
+
+// checkGolden compares got with the golden file testdata/name, or rewrites
+// the file with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file, got:\n%s", name, got)
+	}
+}
+
+func TestNsjailProfileGolden(t *testing.T) {
+	exec := runtime.NewNsjailExecutor()
+	checkGolden(t, "nsjail-default.cfg", exec.Profile("/srv/ws").Render())
+
+	exec.Timeout = 1500 * time.Millisecond
+	exec.MemoryLimit = 512
+	exec.NetworkAccess = true
+	exec.DeniedSyscalls = []string{"ptrace", "bpf"}
+	exec.Locale = sandbox.Locale{Timezone: "Europe/Berlin"}
+	exec.Mounts = []string{"/opt/go"}
+	exec.TmpSize = 256
+	exec.Home = "/workspace"
+	checkGolden(t, "nsjail-custom.cfg", exec.Profile("/srv/ws").Render())
+}
+
+func TestNsjailInterpreters(t *testing.T) {
+	exec := runtime.NewNsjailExecutor()
+	for language, want := range map[string]string{
+		"python":     "/usr/bin/python3 /workspace/main.py",
+		"go":         "/usr/local/go/bin/go run /workspace/main.py",
+		"javascript": "/usr/bin/node /workspace/main.py",
+	} {
+		command, err := exec.Command(language, "/workspace/main.py")
+		if err != nil || strings.Join(command, " ") != want {
+			t.Errorf("Expected %s to run with %q, got %v %v", language, want, command, err)
+		}
+	}
+
+	exec.Interpreters = map[string]string{"go": "/opt/go/bin/go"}
+	if command, _ := exec.Command("go", "/workspace/main.go"); strings.Join(command, " ") != "/opt/go/bin/go run /workspace/main.go" {
+		t.Errorf("Expected the configured Go interpreter, got %v", command)
+	}
+	if _, err := exec.Command("ruby", "/workspace/main.rb"); err == nil {
+		t.Error("Expected an unsupported language to be rejected")
+	}
+}
+
+func TestNsjailIsolationClass(t *testing.T) {
+	requireTool(t, "sh")
+
+	// The fake nsjail prints the limits of its profile and the command
+	nsjail := filepath.Join(t.TempDir(), "nsjail")
+	script := "#!/bin/sh\ngrep -E '^(time_limit|rlimit_as|rlimit_nofile|clone_newnet):' \"$2\"\nshift 4\necho \"$@\"\n"
+	if err := os.WriteFile(nsjail, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Isolation: api.Isolation{
+			Classes: map[string]api.IsolationClass{"jail": {Backend: "nsjail", Nsjail: api.Nsjail{
+				Path:         nsjail,
+				Interpreters: map[string]string{"python": "/opt/python/bin/python3"},
+			}}},
+			Languages: map[string]string{"python": "jail"},
+		},
+	})
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"language":     "python",
+		"code":         "print(1)",
+		"timeout":      7,
+		"memory_limit": 256,
+		"rlimits":      map[string]interface{}{"open_files": 100},
+	})
+	resp, err := client.Post("http://forgeai/v1/execute/sync", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var job map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || job["status"] != "completed" {
+		t.Fatalf("Expected the job to run in the jail, got %d %v", resp.StatusCode, job)
+	}
+	stdout, _ := job["stdout"].(string)
+	for _, want := range []string{
+		"time_limit: 7\n",
+		"rlimit_as: 256\n",
+		"rlimit_nofile: 100\n",
+		"clone_newnet: true\n",
+		"/opt/python/bin/python3 /workspace/main.py\n",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("Expected %q from the job's limits and the class, got %q", want, stdout)
+		}
+	}
+
+	resp, err = client.Get("http://forgeai/v1/capabilities?language=python")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var caps struct {
+		Capabilities sandbox.Capabilities `json:"capabilities"`
+		Class        string               `json:"isolation_class"`
+	}
+	json.NewDecoder(resp.Body).Decode(&caps)
+	resp.Body.Close()
+	if caps.Class != "jail" || caps.Capabilities.Backend != "nsjail" || !caps.Capabilities.Available {
+		t.Errorf("Expected the nsjail backend for python, got %+v", caps)
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"forgeai/pkg/audit"
+	"forgeai/pkg/config"
+	"forgeai/pkg/container"
+	"forgeai/pkg/notify"
+	"forgeai/pkg/offline"
+	"forgeai/pkg/registry"
+	"forgeai/pkg/sandbox/sandboxtest"
+	"forgeai/pkg/storage"
+)
+
+// enableOffline turns on offline mode for the rest of the test
+func enableOffline(t *testing.T) {
+	offline.Enable(true)
+	t.Cleanup(func() { offline.Enable(false) })
+}
+
+func TestOfflineLocalHosts(t *testing.T) {
+	for host, local := range map[string]bool{
+		"localhost":         true,
+		"localhost:8080":    true,
+		"127.0.0.1:514":     true,
+		"[::1]:2375":        true,
+		"api.localhost":     true,
+		"registry.example":  false,
+		"10.0.0.1:2376":     false,
+		"localhost.example": false,
+	} {
+		if got := offline.Local(host); got != local {
+			t.Errorf("Local(%q) = %v, expected %v", host, got, local)
+		}
+	}
+}
+
+func TestOfflineRefusesOutboundFeatures(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer srv.Close()
+	docker := sandboxtest.NewFakeDocker(t)
+	enableOffline(t)
+
+	// Registry calls are refused even to a local registry
+	client := registry.NewRegistryClient(srv.URL)
+	if _, err := client.ListPlugins(context.Background()); !errors.Is(err, offline.ErrOffline) {
+		t.Errorf("Expected registry calls to be refused, got %v", err)
+	}
+	if err := client.DownloadPlugin(context.Background(), "rust-plugin", "latest", t.TempDir()); !errors.Is(err, offline.ErrOffline) {
+		t.Errorf("Expected installs to be refused, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Expected no registry requests, got %d", n)
+	}
+
+	if err := container.NewDockerExecutor().PullImage(context.Background(), "python:3.9-alpine", nil); !errors.Is(err, offline.ErrOffline) {
+		t.Errorf("Expected image pulls to be refused, got %v", err)
+	}
+	for _, call := range docker.Calls() {
+		if len(call) > 0 && call[0] == "pull" {
+			t.Errorf("Expected docker not to pull, got %v", call)
+		}
+	}
+
+	if _, err := notify.New(config.NotificationsConfig{Channels: []config.NotificationChannelConfig{{Type: "slack"}}}); !errors.Is(err, offline.ErrOffline) {
+		t.Errorf("Expected notifications to be refused, got %v", err)
+	}
+	if _, err := audit.FromConfig(config.AuditConfig{Webhook: config.AuditWebhookConfig{URL: srv.URL}}); !errors.Is(err, offline.ErrOffline) {
+		t.Errorf("Expected audit webhooks to be refused, got %v", err)
+	}
+	if _, err := audit.NewSyslogSink(config.AuditSyslogConfig{Address: "syslog.example:514"}); !errors.Is(err, offline.ErrOffline) {
+		t.Errorf("Expected a remote syslog to be refused, got %v", err)
+	}
+	if _, err := audit.NewSyslogSink(config.AuditSyslogConfig{Address: "127.0.0.1:514"}); err != nil {
+		t.Errorf("Expected a local syslog to be allowed, got %v", err)
+	}
+	if _, err := storage.NewS3Backend(config.S3StorageConfig{Bucket: "artifacts"}); !errors.Is(err, offline.ErrOffline) {
+		t.Errorf("Expected S3 storage to be refused, got %v", err)
+	}
+	if _, err := storage.NewS3Backend(config.S3StorageConfig{Bucket: "artifacts", Endpoint: "http://localhost:9000", AccessKeyID: "key", SecretAccessKey: "secret"}); err != nil {
+		t.Errorf("Expected S3 storage on the local machine to be allowed, got %v", err)
+	}
+	if err := (container.Daemon{Host: "tcp://sandbox-1:2376"}).Validate(); !errors.Is(err, offline.ErrOffline) {
+		t.Errorf("Expected a remote docker host to be refused, got %v", err)
+	}
+	if err := (container.Daemon{Host: "ssh://forgeai@127.0.0.1"}).Validate(); err != nil {
+		t.Errorf("Expected a local docker host to be allowed, got %v", err)
+	}
+}
+
+func TestOfflineGuardsDefaultTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	enableOffline(t)
+
+	_, err := http.Get("http://registry.example/v1/plugins")
+	if !errors.Is(err, offline.ErrOffline) {
+		t.Fatalf("Expected requests to other hosts to be refused, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "registry.example") {
+		t.Errorf("Expected the error to name the request, got %v", err)
+	}
+
+	// The local machine, such as a local API server, stays reachable
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected local requests to be allowed, got %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,62 @@
+package test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"forgeai/pkg/sandbox"
+)
+
+func TestOutputBufferKeepsHeadAndTail(t *testing.T) {
+	buf := sandbox.OutputLimits{Head: 4, Tail: 4}.NewBuffer()
+
+	buf.Write([]byte("abc"))
+	if got := buf.String(); got != "abc" {
+		t.Fatalf("String() = %q, want %q", got, "abc")
+	}
+
+	buf.Write([]byte("defgh"))
+	if got := buf.String(); got != "abcdefgh" || buf.Omitted() != 0 {
+		t.Fatalf("String() = %q with %d omitted, want all output", got, buf.Omitted())
+	}
+
+	buf.Write([]byte("ij"))
+	buf.Write([]byte(strings.Repeat("z", 100) + "0123"))
+	if buf.Omitted() != 106 || buf.Len() != 114 {
+		t.Errorf("Omitted() = %d, Len() = %d, want 106 and 114", buf.Omitted(), buf.Len())
+	}
+	want := "abcd\n... [106 bytes of output omitted] ...\n0123"
+	if got := buf.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestEncodeOutput(t *testing.T) {
+	if !sandbox.IsText("héllo\n") || sandbox.IsText("a\x00b") || sandbox.IsText("\xff\xfe") {
+		t.Error("Expected only valid UTF-8 without NUL bytes to be text")
+	}
+
+	result := &sandbox.ExecutionResult{
+		Stdout: "plain text\n",
+		Stderr: "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", sandbox.MaxBinaryOutput),
+	}
+	result.EncodeOutput()
+	if result.Stdout != "plain text\n" || result.StdoutEncoding != "" {
+		t.Errorf("Expected text to be left alone, got %q %q", result.Stdout, result.StdoutEncoding)
+	}
+	if result.StderrEncoding != sandbox.EncodingBase64 || result.OutputOmitted != 8 {
+		t.Errorf("Expected binary output cut to the maximum, got %q with %d omitted", result.StderrEncoding, result.OutputOmitted)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(result.Stderr)
+	if err != nil || len(decoded) != sandbox.MaxBinaryOutput || !strings.HasPrefix(string(decoded), "\x89PNG") {
+		t.Errorf("Expected the start of the output base64 encoded, got %d bytes, %v", len(decoded), err)
+	}
+
+	// Encoding twice does not encode the encoding
+	encoded := result.Stderr
+	result.EncodeOutput()
+	if result.Stderr != encoded {
+		t.Error("Expected encoded output to be left alone")
+	}
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"forgeai/pkg/plugin"
+)
+
+func TestPluginScaffold(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	// The generated plugin builds and loads like an installed one
+	pluginDir := t.TempDir()
+	dir := filepath.Join(pluginDir, "bash-plugin")
+	files, err := plugin.Scaffold(dir, plugin.ScaffoldOptions{Name: "bash-plugin", Language: "sh"})
+	if err != nil {
+		t.Fatalf("Scaffold failed: %v", err)
+	}
+	for _, name := range []string{"manifest.json", "go.mod", "main.go", "main_test.go", "Makefile", ".goreleaser.yaml"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be generated: %v", name, err)
+		}
+	}
+	if len(files) != 6 {
+		t.Errorf("Expected six files, got %v", files)
+	}
+
+	build := exec.Command("go", "build", "-o", "bash-plugin", ".")
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GOWORK=off")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Generated plugin does not build: %v\n%s", err, output)
+	}
+
+	manager := plugin.NewManager()
+	if err := manager.LoadPluginsFromDir(pluginDir); err != nil {
+		t.Fatalf("LoadPluginsFromDir failed: %v", err)
+	}
+	executor, ok := manager.GetExecutor("bash")
+	if !ok {
+		t.Fatalf("Expected the plugin to handle bash, got %v", manager.SupportedLanguages())
+	}
+	result, err := executor.Execute(context.Background(), "bash", "echo hello; exit 3")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.Stdout != "hello\n" || result.ExitCode != 3 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	if _, err := plugin.Scaffold(dir, plugin.ScaffoldOptions{Name: "bash-plugin", Language: "bash"}); err == nil {
+		t.Error("Expected a directory that is not empty to be refused")
+	}
+	if _, err := plugin.Scaffold(t.TempDir(), plugin.ScaffoldOptions{Name: "../escape", Language: "bash"}); err == nil {
+		t.Error("Expected an invalid name to be refused")
+	}
+}
@@ -0,0 +1,191 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"forgeai/pkg/container"
+	"forgeai/pkg/executor"
+	"forgeai/pkg/runtime"
+	"forgeai/pkg/security"
+)
+
+// Property tests of the results of executors, run against generated
+// programs with testing/quick. A failing check reports the program that
+// broke the invariant.
+
+// propertyConfig bounds the programs run per property, since each one
+// starts an interpreter
+var propertyConfig = &quick.Config{MaxCount: 10}
+
+// program is a generated Python program that prints lines and exits with
+// a chosen code
+type program struct {
+	Lines    []string
+	ExitCode int
+}
+
+// Generate returns a random program; half of them exit with 0
+func (program) Generate(r *rand.Rand, size int) reflect.Value {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 .,:-"
+	p := program{Lines: make([]string, r.Intn(5))}
+	for i := range p.Lines {
+		line := make([]byte, r.Intn(size+1))
+		for j := range line {
+			line[j] = alphabet[r.Intn(len(alphabet))]
+		}
+		p.Lines[i] = string(line)
+	}
+	if r.Intn(2) == 0 {
+		p.ExitCode = 1 + r.Intn(125)
+	}
+	return reflect.ValueOf(p)
+}
+
+// Code returns the program's source
+func (p program) Code() string {
+	var code strings.Builder
+	code.WriteString("import sys\n")
+	for _, line := range p.Lines {
+		fmt.Fprintf(&code, "print(%q)\n", line)
+	}
+	fmt.Fprintf(&code, "sys.exit(%d)\n", p.ExitCode)
+	return code.String()
+}
+
+// Output returns what the program prints
+func (p program) Output() string {
+	if len(p.Lines) == 0 {
+		return ""
+	}
+	return strings.Join(p.Lines, "\n") + "\n"
+}
+
+// propertyExecutors returns the executors available on this host, by name
+func propertyExecutors(t *testing.T) map[string]codeExecutor {
+	t.Helper()
+	requireTool(t, "python3")
+
+	executors := map[string]codeExecutor{
+		"local":  executor.NewLocalExecutor(),
+		"secure": security.NewSecureExecutor(),
+	}
+	if !testing.Short() {
+		if _, err := exec.LookPath("nsjail"); err == nil {
+			executors["nsjail"] = runtime.NewNsjailExecutor()
+		}
+		if dockerReachable() {
+			executors["docker"] = container.NewDockerExecutor()
+		}
+	}
+	return executors
+}
+
+// forEachExecutor runs a property check against every available executor
+func forEachExecutor(t *testing.T, check func(t *testing.T, run codeExecutor)) {
+	for name, run := range propertyExecutors(t) {
+		run := run
+		t.Run(name, func(t *testing.T) {
+			check(t, run)
+		})
+	}
+}
+
+// TestResultInvariantsProperty checks that finished programs report their
+// duration, exit code, and output, with stderr reserved for failures of
+// the sandbox such as timeouts
+func TestResultInvariantsProperty(t *testing.T) {
+	forEachExecutor(t, func(t *testing.T, run codeExecutor) {
+		property := func(p program) bool {
+			result, err := run.Execute(context.Background(), "python", p.Code())
+			if err != nil {
+				t.Logf("Execute failed: %v", err)
+				return false
+			}
+			switch {
+			case result.Duration <= 0:
+				t.Logf("duration %v is not positive", result.Duration)
+			case result.ExitCode != p.ExitCode:
+				t.Logf("exit code %d, expected %d", result.ExitCode, p.ExitCode)
+			case result.ExitCode >= 0 && result.Stderr != "":
+				t.Logf("exit code %d with sandbox error %q", result.ExitCode, result.Stderr)
+			case result.Stdout != p.Output():
+				t.Logf("output %q, expected %q", result.Stdout, p.Output())
+			default:
+				return true
+			}
+			return false
+		}
+		if err := quick.Check(property, propertyConfig); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestTimeoutProperty checks that programs outliving their deadline always
+// end with the timeout status, soon after the deadline
+func TestTimeoutProperty(t *testing.T) {
+	forEachExecutor(t, func(t *testing.T, run codeExecutor) {
+		property := func(p program, millis uint8) bool {
+			timeout := time.Duration(50+int(millis)) * time.Millisecond
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			code := strings.Replace(p.Code(), "import sys\n", "import sys, time\ntime.sleep(60)\n", 1)
+			start := time.Now()
+			result, err := run.Execute(ctx, "python", code)
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Logf("Execute failed: %v", err)
+				return false
+			}
+			switch {
+			case result.ExitCode != -1 || result.Stderr != "Execution timed out":
+				t.Logf("timeout %v ended with exit code %d and %q", timeout, result.ExitCode, result.Stderr)
+			case elapsed < timeout || elapsed > timeout+10*time.Second:
+				t.Logf("timeout %v took %v", timeout, elapsed)
+			default:
+				return true
+			}
+			return false
+		}
+		if err := quick.Check(property, &quick.Config{MaxCount: 3}); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// TestDeterministicExitCodesProperty checks that running the same code
+// with the same executor twice gives the same exit code and output
+func TestDeterministicExitCodesProperty(t *testing.T) {
+	forEachExecutor(t, func(t *testing.T, run codeExecutor) {
+		property := func(p program) bool {
+			first, err := run.Execute(context.Background(), "python", p.Code())
+			if err != nil {
+				t.Logf("Execute failed: %v", err)
+				return false
+			}
+			second, err := run.Execute(context.Background(), "python", p.Code())
+			if err != nil {
+				t.Logf("Execute failed: %v", err)
+				return false
+			}
+			if first.ExitCode != second.ExitCode || first.Stdout != second.Stdout {
+				t.Logf("runs differ: exit codes %d and %d, output %q and %q",
+					first.ExitCode, second.ExitCode, first.Stdout, second.Stdout)
+				return false
+			}
+			return true
+		}
+		if err := quick.Check(property, propertyConfig); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,399 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/quota"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestQuotaSlidingWindow(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := quota.NewManager([]quota.Limit{{Metric: quota.Executions, Limit: 3, Window: time.Hour}})
+	m.Now = func() time.Time { return now }
+
+	// Two executions now and one half an hour later fill the window
+	m.Use("a", quota.Executions, 2)
+	now = now.Add(30 * time.Minute)
+	m.Use("a", quota.Executions, 1)
+
+	err := m.Check("a", quota.Executions, 1)
+	var exceeded *quota.ExceededError
+	if !errors.As(err, &exceeded) || !errors.Is(err, quota.ErrExceeded) {
+		t.Fatalf("Expected the quota to be exceeded, got %v", err)
+	}
+	// The first two expire an hour after they were used, not at a fixed
+	// reset time
+	if want := now.Add(30 * time.Minute); !exceeded.RetryAt.Equal(want) {
+		t.Errorf("Expected to retry at %s, got %s", want, exceeded.RetryAt)
+	}
+	if err := m.Check("b", quota.Executions, 1); err != nil {
+		t.Errorf("Expected other keys to be unaffected, got %v", err)
+	}
+
+	now = now.Add(31 * time.Minute)
+	if err := m.Check("a", quota.Executions, 1); err != nil {
+		t.Errorf("Expected the oldest usage to have expired, got %v", err)
+	}
+	usage := m.Usage("a")
+	if len(usage) != 1 || usage[0].Used != 1 || usage[0].Remaining != 2 {
+		t.Errorf("Expected 1 used and 2 remaining, got %+v", usage)
+	}
+
+	// Overrides replace the defaults of a key and survive a restart
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	m.Path = path
+	if err := m.Override("a", []quota.Limit{{Metric: quota.Executions, Limit: 1, Window: time.Hour}}); err != nil {
+		t.Fatalf("Override failed: %v", err)
+	}
+	if err := m.Check("a", quota.Executions, 1); err == nil {
+		t.Error("Expected the override to apply")
+	}
+	reopened := quota.NewManager(nil)
+	reopened.Path = path
+	if err := reopened.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if limits, overridden := reopened.LimitsOf("a"); !overridden || limits[0].Limit != 1 {
+		t.Errorf("Expected the override to be reloaded, got %+v %v", limits, overridden)
+	}
+}
+
+func TestQuotaBurst(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	m := quota.NewManager([]quota.Limit{{Metric: quota.Executions, Limit: 2, Window: time.Hour, Burst: 2}})
+	m.Now = func() time.Time { return now }
+
+	// The burst allows going over the limit for a window
+	for i := 0; i < 4; i++ {
+		if err := m.Check("a", quota.Executions, 1); err != nil {
+			t.Fatalf("Expected execution %d within the burst, got %v", i+1, err)
+		}
+		m.Use("a", quota.Executions, 1)
+	}
+	if err := m.Check("a", quota.Executions, 1); err == nil {
+		t.Fatal("Expected the burst to be used up")
+	}
+
+	// After the window the key is held to the limit until the cool-down
+	// ends
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if err := m.Check("a", quota.Executions, 1); err != nil {
+			t.Fatalf("Expected execution %d within the limit, got %v", i+1, err)
+		}
+		m.Use("a", quota.Executions, 1)
+	}
+	err := m.Check("a", quota.Executions, 1)
+	var exceeded *quota.ExceededError
+	if !errors.As(err, &exceeded) || exceeded.Usage.BurstAvailable {
+		t.Fatalf("Expected the burst to be cooling down, got %v", err)
+	}
+	if want := now.Add(time.Hour); exceeded.RetryAt.After(want) {
+		t.Errorf("Expected to retry by %s, got %s", want, exceeded.RetryAt)
+	}
+
+	now = now.Add(time.Hour)
+	if usage := m.Usage("a"); !usage[0].BurstAvailable {
+		t.Errorf("Expected the burst to be available again, got %+v", usage)
+	}
+}
+
+func TestQuotaReserve(t *testing.T) {
+	m := quota.NewManager([]quota.Limit{{Metric: quota.Executions, Limit: 5, Window: time.Hour}})
+
+	// Concurrent reservations never exceed the limit
+	var reserved int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if m.Reserve("a", quota.Executions, 1) == nil {
+				atomic.AddInt32(&reserved, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 5 {
+		t.Fatalf("Expected 5 reservations, got %d", reserved)
+	}
+
+	// A released reservation can be taken again
+	m.Release("a", quota.Executions, 1)
+	if err := m.Reserve("a", quota.Executions, 1); err != nil {
+		t.Errorf("Expected the released execution to be available, got %v", err)
+	}
+	if err := m.Reserve("a", quota.Executions, 1); err == nil {
+		t.Error("Expected the quota to be used up again")
+	}
+}
+
+func TestQuotaPrune(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	m := quota.NewManager([]quota.Limit{{Metric: quota.Executions, Limit: 10, Window: time.Hour}})
+	m.Now = func() time.Time { return now }
+
+	m.Use("idle", quota.Executions, 1)
+	now = now.Add(30 * time.Minute)
+	m.Use("busy", quota.Executions, 1)
+	if keys := m.Keys(); len(keys) != 2 {
+		t.Fatalf("Expected both keys, got %v", keys)
+	}
+
+	// Windows whose usage has expired are forgotten; the others are kept
+	now = now.Add(45 * time.Minute)
+	m.Use("new", quota.Executions, 1)
+	if keys := m.Keys(); len(keys) != 2 || keys[0] != "busy" || keys[1] != "new" {
+		t.Errorf("Expected the idle key to be evicted, got %v", keys)
+	}
+	if usage := m.Usage("busy"); usage[0].Used != 1 {
+		t.Errorf("Expected the busy key to keep its usage, got %+v", usage)
+	}
+}
+
+func TestAPIQuotaReservations(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+	quotas := quota.NewManager([]quota.Limit{{Metric: quota.Executions, Limit: 3, Window: time.Hour}})
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Quotas:     quotas,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+	post := func(body string) int {
+		resp, err := client.Post("http://forgeai/v1/execute", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Errorf("Request failed: %v", err)
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Requests refused after the quota check give their execution back
+	for i := 0; i < 5; i++ {
+		if status := post(`{"language": "python", "code": "print(1)", "volume": "v"}`); status != http.StatusBadRequest {
+			t.Fatalf("Expected the volume to be refused, got %d", status)
+		}
+	}
+
+	// Concurrent requests are admitted up to the limit only
+	var accepted int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if post(fmt.Sprintf(`{"language": "python", "code": "print(%d)"}`, i)) == http.StatusCreated {
+				atomic.AddInt32(&accepted, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if accepted != 3 {
+		t.Errorf("Expected 3 of the concurrent requests to be accepted, got %d", accepted)
+	}
+}
+
+func TestAPIQuotaKeyIgnoresPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+	quotas := quota.NewManager([]quota.Limit{{Metric: quota.Executions, Limit: 1, Window: time.Hour}})
+	server := api.NewServer(&api.Config{
+		Host:       "127.0.0.1",
+		Port:       port,
+		Permissive: true,
+		Quotas:     quotas,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go server.Start(ctx)
+	t.Cleanup(func() {
+		server.Shutdown(context.Background())
+		cancel()
+	})
+
+	// Every request opens a new connection from another port
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	url := fmt.Sprintf("http://127.0.0.1:%d", port)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		resp, err := client.Get(url + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("The server did not start: %v", err)
+		}
+	}
+	var statuses []int
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(url+"/v1/execute", "application/json", strings.NewReader(`{"language": "python", "code": "print(1)"}`))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+	if statuses[0] != http.StatusCreated || statuses[1] != http.StatusTooManyRequests {
+		t.Errorf("Expected the second connection to share the first one's quota, got %v", statuses)
+	}
+	if keys := quotas.Keys(); len(keys) != 1 || keys[0] != "user:127.0.0.1" {
+		t.Errorf("Expected one key for the host, got %v", keys)
+	}
+}
+
+func TestAPIQuotas(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n", Duration: 2 * time.Second}}
+
+	quotas := quota.NewManager([]quota.Limit{
+		{Metric: quota.Executions, Limit: 1, Window: time.Hour},
+		{Metric: quota.CPUSeconds, Limit: 1, Window: 24 * time.Hour},
+	})
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Quotas:     quotas,
+		AdminToken: "admin-secret",
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+		Hooks: api.Hooks{Tenant: func(r *http.Request) string {
+			if r.Header.Get("Authorization") == "Bearer acme-credential" {
+				return "acme"
+			}
+			return ""
+		}},
+	})
+
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, "http://forgeai"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer acme-credential")
+		if strings.HasPrefix(path, "/v1/admin/") {
+			req.Header.Set("Authorization", "Bearer admin-secret")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp
+	}
+	execute := func(code string) *http.Response {
+		return do(http.MethodPost, "/v1/execute?sync=true",
+			`{"language": "python", "code": "`+code+`", "labels": {"tenant": "acme"}}`)
+	}
+
+	resp := execute("print(1)")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the first execution to run, got %d", resp.StatusCode)
+	}
+
+	// The hourly execution limit answers 429 with when to retry
+	resp = execute("print(2)")
+	var denied struct {
+		Key     string    `json:"key"`
+		RetryAt time.Time `json:"retry_at"`
+	}
+	json.NewDecoder(resp.Body).Decode(&denied)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || denied.Key != "tenant:acme" {
+		t.Fatalf("Expected 429 for tenant:acme, got %d %+v", resp.StatusCode, denied)
+	}
+	if resp.Header.Get("Retry-After") == "" || resp.Header.Get("X-Quota-Reset") == "" {
+		t.Errorf("Expected Retry-After and X-Quota-Reset, got %v", resp.Header)
+	}
+	if !denied.RetryAt.After(time.Now()) {
+		t.Errorf("Expected a future retry time, got %s", denied.RetryAt)
+	}
+
+	// Tenant labels are the caller's to set, so they neither spend another
+	// tenant's quota nor escape the caller's
+	resp = do(http.MethodPost, "/v1/execute?sync=true", `{"language": "python", "code": "print(2)", "labels": {"tenant": "globex"}}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected another tenant's label to be refused, got %d", resp.StatusCode)
+	}
+	req, _ := http.NewRequest(http.MethodPost, "http://forgeai/v1/execute?sync=true",
+		strings.NewReader(`{"language": "python", "code": "print(2)", "labels": {"tenant": "acme"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a caller without a tenant to use their own quota, got %d", resp.StatusCode)
+	}
+
+	// Callers cannot raise their own limits
+	req, _ = http.NewRequest(http.MethodPut, "http://forgeai/v1/admin/quotas/tenant:acme",
+		strings.NewReader(`{"limits": [{"metric": "executions", "limit": 100, "window": "1h"}]}`))
+	req.Header.Set("Authorization", "Bearer acme-credential")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a tenant's override to be refused, got %d", resp.StatusCode)
+	}
+
+	// An admin override lifts the execution limit, and the CPU time used
+	// by the first job then exhausts the daily quota with 402
+	resp = do(http.MethodPut, "/v1/admin/quotas/tenant:acme",
+		`{"limits": [{"metric": "executions", "limit": 100, "window": "1h"}, {"metric": "cpu_seconds", "limit": 1, "window": "24h"}]}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the override to be accepted, got %d", resp.StatusCode)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if usage := quotas.Usage("tenant:acme"); usage[1].Used >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("CPU time was not counted: %+v", quotas.Usage("tenant:acme"))
+		}
+	}
+	resp = execute("print(3)")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPaymentRequired {
+		t.Errorf("Expected 402 once CPU time is used up, got %d", resp.StatusCode)
+	}
+
+	// Resetting the key's usage lets it run again
+	resp = do(http.MethodPost, "/v1/admin/quotas/tenant:acme/reset", "")
+	resp.Body.Close()
+	resp = execute("print(4)")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the execution to run after a reset, got %d", resp.StatusCode)
+	}
+}
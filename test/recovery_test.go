@@ -0,0 +1,55 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestRecoverInterruptedJobs(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+	manager := jobs.NewManager()
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+		return fake
+	})
+	manager.Worker = "replica-2"
+	manager.HeartbeatInterval = time.Second
+	manager.Retry = jobs.RetryPolicy{MaxAttempts: 2}
+
+	// Jobs that another replica left running in the shared store
+	now := time.Now()
+	stale := now.Add(-time.Minute)
+	manager.Store.Put(&jobs.Job{ID: "retried", Status: "running", Language: "python", Code: "print(1)", Worker: "replica-1", Attempts: 1, StartedAt: stale, HeartbeatAt: stale})
+	manager.Store.Put(&jobs.Job{ID: "exhausted", Status: "running", Language: "python", Code: "print(1)", Worker: "replica-1", Attempts: 2, StartedAt: stale, HeartbeatAt: stale})
+	manager.Store.Put(&jobs.Job{ID: "alive", Status: "running", Language: "python", Code: "print(1)", Worker: "replica-1", Attempts: 1, StartedAt: stale, HeartbeatAt: now})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	recovered := manager.RecoverInterrupted(ctx, now)
+	if len(recovered) != 2 {
+		t.Fatalf("Expected the two jobs without a heartbeat to be recovered, got %d", len(recovered))
+	}
+
+	job, _ := manager.WaitJob(ctx, "retried", 5*time.Second)
+	if job.Status != "completed" || job.Attempts != 2 || job.Worker != "replica-2" {
+		t.Errorf("Expected the job to run again on this replica, got %s after %d attempts on %q", job.Status, job.Attempts, job.Worker)
+	}
+	if len(job.Interruptions) != 1 || job.Interruptions[0].Worker != "replica-1" || job.Interruptions[0].Attempt != 1 {
+		t.Errorf("Expected the interruption to be recorded, got %+v", job.Interruptions)
+	}
+
+	job, _ = manager.GetJob("exhausted")
+	if job.Status != "interrupted" || !job.Finished() || job.Error != "worker replica-1 stopped responding" {
+		t.Errorf("Expected the job without attempts left to be interrupted, got %s: %s", job.Status, job.Error)
+	}
+
+	job, _ = manager.GetJob("alive")
+	if job.Status != "running" {
+		t.Errorf("Expected the job with a recent heartbeat to be left running, got %s", job.Status)
+	}
+}
@@ -0,0 +1,501 @@
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"forgeai/pkg/attestation"
+	"forgeai/pkg/plugin"
+	"forgeai/pkg/registry"
+)
+
+func TestRegistryVersionOrder(t *testing.T) {
+	ordered := []string{"0.9.9", "1.0.0-beta", "1.0.0", "v1.0.1", "1.2.0", "2.0.0"}
+	for i := 1; i < len(ordered); i++ {
+		lower, _ := registry.ParseVersion(ordered[i-1])
+		higher, err := registry.ParseVersion(ordered[i])
+		if err != nil {
+			t.Fatalf("ParseVersion(%q) failed: %v", ordered[i], err)
+		}
+		if lower.Compare(higher) != -1 || higher.Compare(lower) != 1 {
+			t.Errorf("Expected %s < %s", ordered[i-1], ordered[i])
+		}
+	}
+	for _, invalid := range []string{"1.0", "1.x.0", "1.0.0-", ""} {
+		if _, err := registry.ParseVersion(invalid); err == nil {
+			t.Errorf("Expected %q to be refused", invalid)
+		}
+	}
+}
+
+func TestRegistryPublish(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(`{"name": "rust-plugin", "languages": ["rust"]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "rust-plugin"), []byte("binary"), 0755)
+
+	var (
+		mu        sync.Mutex
+		latest    *registry.PluginInfo
+		published []registry.PluginInfo
+		uploads   []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/plugins/rust-plugin":
+			if latest == nil {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(latest)
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/plugins/rust-plugin/versions":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var info registry.PluginInfo
+			json.Unmarshal([]byte(r.FormValue("info")), &info)
+			f, _, err := r.FormFile("binary")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(f)
+			published = append(published, info)
+			uploads = append(uploads, string(data))
+			latest = &info
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(info)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	signer, err := attestation.LoadOrCreateSigner(filepath.Join(t.TempDir(), "key.pem"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateSigner failed: %v", err)
+	}
+	client := registry.NewRegistryClient(srv.URL)
+	opts := registry.PublishOptions{Dir: dir, Version: "1.0.0", Signer: signer, Token: "secret", DryRun: true}
+
+	// A dry run signs without uploading
+	info, err := client.Publish(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if len(published) != 0 {
+		t.Fatalf("Expected a dry run not to upload, got %+v", published)
+	}
+	if !strings.HasPrefix(info.FileHash, "sha256:") || info.Languages[0] != "rust" {
+		t.Errorf("Unexpected release %+v", info)
+	}
+
+	opts.DryRun = false
+	if _, err := client.Publish(context.Background(), opts); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if len(published) != 1 || uploads[0] != "binary" {
+		t.Fatalf("Expected the binary to be uploaded, got %+v", published)
+	}
+	payload := registry.SigningPayload("rust-plugin", "1.0.0", published[0].FileHash)
+	if err := attestation.VerifyData(payload, published[0].Signature, published[0].PublicKey); err != nil {
+		t.Errorf("Expected the release to verify with the publisher's key: %v", err)
+	}
+	if err := attestation.VerifyData(registry.SigningPayload("rust-plugin", "9.9.9", published[0].FileHash), published[0].Signature, published[0].PublicKey); err == nil {
+		t.Error("Expected the signature not to verify for another version")
+	}
+
+	// Versions must increase
+	for _, version := range []string{"1.0.0", "0.9.0", "latest"} {
+		opts.Version = version
+		if _, err := client.Publish(context.Background(), opts); err == nil {
+			t.Errorf("Expected version %s to be refused", version)
+		}
+	}
+	opts.Version = "1.1.0"
+	if _, err := client.Publish(context.Background(), opts); err != nil || len(published) != 2 {
+		t.Errorf("Expected a higher version to be published: %v", err)
+	}
+}
+
+func TestRegistryResumesDownloads(t *testing.T) {
+	binary := strings.Repeat("plugin binary ", 1000)
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/plugins/rust-plugin":
+			json.NewEncoder(w).Encode(registry.PluginInfo{
+				Name:        "rust-plugin",
+				Version:     "1.0.0",
+				Languages:   []string{"rust"},
+				DownloadURL: srv.URL + "/download",
+			})
+		case "/download":
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			first := len(ranges) == 1
+			mu.Unlock()
+			if first {
+				// Break off the first download halfway
+				w.Header().Set("Content-Length", strconv.Itoa(len(binary)))
+				io.WriteString(w, binary[:len(binary)/2])
+				return
+			}
+			http.ServeContent(w, r, "rust-plugin", time.Time{}, strings.NewReader(binary))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	client := registry.NewRegistryClient(srv.URL)
+	client.Retry.MaxAttempts = 1
+	var done, total int64
+	client.Progress = func(d, t int64) { done, total = d, t }
+
+	if err := client.DownloadPlugin(context.Background(), "rust-plugin", "1.0.0", dir); err == nil {
+		t.Fatal("Expected the interrupted download to fail")
+	}
+	binaryPath := filepath.Join(dir, "rust-plugin", "rust-plugin")
+	partPath := filepath.Join(dir, ".downloads", "rust-plugin-1.0.0-rust-plugin.part")
+	if _, err := os.Stat(partPath); err != nil {
+		t.Fatalf("Expected a partial download: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rust-plugin")); !os.IsNotExist(err) {
+		t.Error("Expected a failed install not to create the plugin")
+	}
+
+	if err := client.DownloadPlugin(context.Background(), "rust-plugin", "1.0.0", dir); err != nil {
+		t.Fatalf("DownloadPlugin failed: %v", err)
+	}
+	if len(ranges) != 2 || ranges[1] != fmt.Sprintf("bytes=%d-", len(binary)/2) {
+		t.Errorf("Expected the second download to resume halfway, got ranges %q", ranges)
+	}
+	data, err := os.ReadFile(binaryPath)
+	if err != nil || string(data) != binary {
+		t.Fatalf("Expected the complete binary, got %d bytes: %v", len(data), err)
+	}
+	if _, err := os.Stat(partPath); !os.IsNotExist(err) {
+		t.Error("Expected the partial download to be removed")
+	}
+	if done != int64(len(binary)) || total != int64(len(binary)) {
+		t.Errorf("Expected progress to reach %d bytes, got %d/%d", len(binary), done, total)
+	}
+}
+
+func TestRegistryAtomicInstallAndRollback(t *testing.T) {
+	signer, err := attestation.LoadOrCreateSigner(filepath.Join(t.TempDir(), "key.pem"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateSigner failed: %v", err)
+	}
+	var (
+		mu      sync.Mutex
+		release registry.PluginInfo
+		binary  string
+	)
+	publish := func(version, data string) {
+		mu.Lock()
+		defer mu.Unlock()
+		sum := sha256.Sum256([]byte(data))
+		release = registry.PluginInfo{
+			Name:      "rust-plugin",
+			Version:   version,
+			Languages: []string{"rust"},
+			FileHash:  "sha256:" + hex.EncodeToString(sum[:]),
+			PublicKey: signer.PublicKey(),
+		}
+		release.Signature = signer.SignData(registry.SigningPayload(release.Name, version, release.FileHash))
+		binary = data
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/v1/plugins/rust-plugin":
+			json.NewEncoder(w).Encode(release)
+		case strings.HasSuffix(r.URL.Path, "/download"):
+			io.WriteString(w, binary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	manager := registry.NewPluginManager(dir, srv.URL)
+	installed := func() string {
+		data, _ := os.ReadFile(filepath.Join(dir, "rust-plugin", "rust-plugin"))
+		return string(data)
+	}
+
+	publish("1.0.0", "version one")
+	if err := manager.InstallPlugin(context.Background(), "rust-plugin", "latest"); err != nil {
+		t.Fatalf("InstallPlugin failed: %v", err)
+	}
+	publish("1.1.0", "version two")
+	if err := manager.UpdatePlugin(context.Background(), "rust-plugin"); err != nil {
+		t.Fatalf("UpdatePlugin failed: %v", err)
+	}
+	if installed() != "version two" {
+		t.Fatalf("Expected the update to be installed, got %q", installed())
+	}
+
+	// A binary that does not match its release leaves the plugin alone
+	mu.Lock()
+	release.Version = "1.2.0"
+	binary = "tampered"
+	mu.Unlock()
+	if err := manager.UpdatePlugin(context.Background(), "rust-plugin"); !errors.Is(err, registry.ErrChecksumMismatch) {
+		t.Errorf("Expected a checksum mismatch, got %v", err)
+	}
+	publish("1.2.0", "version three")
+	mu.Lock()
+	release.Signature = signer.SignData(registry.SigningPayload("rust-plugin", "9.9.9", release.FileHash))
+	mu.Unlock()
+	if err := manager.UpdatePlugin(context.Background(), "rust-plugin"); err == nil {
+		t.Error("Expected an invalid signature to be refused")
+	}
+	if installed() != "version two" {
+		t.Fatalf("Expected failed updates to keep the installed version, got %q", installed())
+	}
+
+	// Rolling back swaps the versions
+	if err := manager.RollbackPlugin("rust-plugin"); err != nil {
+		t.Fatalf("RollbackPlugin failed: %v", err)
+	}
+	info, err := registry.InstalledRelease(dir, "rust-plugin", false)
+	if err != nil || info.Version != "1.0.0" || installed() != "version one" {
+		t.Fatalf("Expected version 1.0.0 after the rollback, got %+v (%v)", info, err)
+	}
+	if err := manager.RollbackPlugin("rust-plugin"); err != nil || installed() != "version two" {
+		t.Fatalf("Expected a second rollback to restore version two: %v", err)
+	}
+
+	// Install state is hidden from plugin listings
+	names, err := manager.ListInstalledPlugins()
+	if err != nil || len(names) != 1 || names[0] != "rust-plugin" {
+		t.Errorf("Expected only the plugin to be listed, got %v (%v)", names, err)
+	}
+
+	if err := manager.RemovePlugin("rust-plugin"); err != nil {
+		t.Fatalf("RemovePlugin failed: %v", err)
+	}
+	if err := manager.RollbackPlugin("rust-plugin"); !errors.Is(err, registry.ErrNoPreviousVersion) {
+		t.Errorf("Expected no previous version after removal, got %v", err)
+	}
+}
+
+func TestRegistryConcurrentInstalls(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/plugins/rust-plugin":
+			json.NewEncoder(w).Encode(registry.PluginInfo{Name: "rust-plugin", Version: "1.0.0", Languages: []string{"rust"}})
+		case strings.HasSuffix(r.URL.Path, "/download"):
+			io.WriteString(w, "binary")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- registry.NewRegistryClient(srv.URL).DownloadPlugin(context.Background(), "rust-plugin", "latest", dir)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Concurrent install failed: %v", err)
+		}
+	}
+
+	manager := plugin.NewManager()
+	if err := manager.LoadPlugin(filepath.Join(dir, "rust-plugin")); err != nil {
+		t.Errorf("Expected a loadable plugin: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".staging-") {
+			t.Errorf("Expected no staging directories to be left, got %s", entry.Name())
+		}
+	}
+}
+
+func TestRegistryRetries(t *testing.T) {
+	const binary = "retried plugin binary"
+	var (
+		mu       sync.Mutex
+		requests = map[string]int{}
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/v1/plugins":
+			// Too slow for the first attempt's timeout
+			if n == 1 {
+				time.Sleep(200 * time.Millisecond)
+			}
+			io.WriteString(w, "[]")
+		case "/v1/plugins/rust-plugin":
+			if n == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			json.NewEncoder(w).Encode(registry.PluginInfo{
+				Name:        "rust-plugin",
+				Version:     "1.0.0",
+				Languages:   []string{"rust"},
+				DownloadURL: srv.URL + "/download",
+			})
+		case "/download":
+			if n == 1 {
+				// Break off the first download halfway
+				w.Header().Set("Content-Length", strconv.Itoa(len(binary)))
+				io.WriteString(w, binary[:len(binary)/2])
+				return
+			}
+			http.ServeContent(w, r, "rust-plugin", time.Time{}, strings.NewReader(binary))
+		case "/v1/plugins/throttled":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/v1/plugins/unavailable":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := registry.NewRegistryClient(srv.URL)
+	client.Timeout = 100 * time.Millisecond
+	client.Retry = registry.RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	ctx := context.Background()
+
+	if _, err := client.ListPlugins(ctx); err != nil || requests["/v1/plugins"] != 2 {
+		t.Errorf("Expected a timed out request to be retried, got %d requests: %v", requests["/v1/plugins"], err)
+	}
+
+	// A 5xx and a broken off download are retried, and the download resumes
+	dir := t.TempDir()
+	if err := client.DownloadPlugin(ctx, "rust-plugin", "1.0.0", dir); err != nil {
+		t.Fatalf("DownloadPlugin failed: %v", err)
+	}
+	if requests["/v1/plugins/rust-plugin"] != 2 || requests["/download"] != 2 {
+		t.Errorf("Expected one retry of each request, got %v", requests)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "rust-plugin", "rust-plugin"))
+	if err != nil || string(data) != binary {
+		t.Errorf("Expected the complete binary, got %q: %v", data, err)
+	}
+
+	// A 404 is not retried, and neither is a Retry-After beyond MaxDelay
+	if _, err := client.GetPlugin(ctx, "missing"); !errors.Is(err, registry.ErrPluginNotFound) || requests["/v1/plugins/missing"] != 1 {
+		t.Errorf("Expected one request for a missing plugin, got %d: %v", requests["/v1/plugins/missing"], err)
+	}
+	if _, err := client.GetPlugin(ctx, "throttled"); err == nil || requests["/v1/plugins/throttled"] != 1 {
+		t.Errorf("Expected a long Retry-After to fail the request, got %d requests: %v", requests["/v1/plugins/throttled"], err)
+	}
+
+	// Retries stop with the context
+	client.Retry = registry.RetryPolicy{MaxAttempts: 100, BaseDelay: time.Hour, MaxDelay: 2 * time.Hour}
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.GetPlugin(ctx, "unavailable"); err == nil || requests["/v1/plugins/unavailable"] != 1 {
+		t.Errorf("Expected the request to fail without a retry, got %d requests: %v", requests["/v1/plugins/unavailable"], err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected retries to stop with the context, took %v", time.Since(start))
+	}
+}
+
+func TestRegistryMetadataCache(t *testing.T) {
+	const etag = `"listing-1"`
+	var requests, revalidations atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == etag {
+			revalidations.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode([]registry.PluginInfo{{Name: "rust-plugin", Version: "1.0.0"}})
+	}))
+
+	client := registry.NewRegistryClient(srv.URL)
+	client.MetadataCache = t.TempDir()
+	client.Retry.MaxAttempts = 1
+	ctx := context.Background()
+	list := func() ([]registry.PluginInfo, error) {
+		plugins, err := client.ListPlugins(ctx)
+		if err == nil && (len(plugins) != 1 || plugins[0].Name != "rust-plugin") {
+			t.Fatalf("Expected the listing, got %+v", plugins)
+		}
+		return plugins, err
+	}
+
+	// A fresh listing is used without a request
+	for i := 0; i < 2; i++ {
+		if _, err := list(); err != nil {
+			t.Fatalf("ListPlugins failed: %v", err)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected one request for a fresh listing, got %d", requests.Load())
+	}
+
+	// Refreshing revalidates with the ETag
+	client.Refresh = true
+	if _, err := list(); err != nil {
+		t.Fatalf("ListPlugins failed: %v", err)
+	}
+	if requests.Load() != 2 || revalidations.Load() != 1 {
+		t.Errorf("Expected a revalidation, got %d requests and %d revalidations", requests.Load(), revalidations.Load())
+	}
+
+	// The cached listing stands in for an unreachable registry
+	srv.Close()
+	var staleErr error
+	client.Stale = func(err error, age time.Duration) { staleErr = err }
+	if _, err := list(); err != nil || staleErr == nil {
+		t.Errorf("Expected the cached listing with a warning, got %v (warning %v)", err, staleErr)
+	}
+	client.MaxStale = time.Nanosecond
+	if _, err := list(); err == nil {
+		t.Error("Expected a listing older than MaxStale not to be used")
+	}
+}
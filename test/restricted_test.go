@@ -0,0 +1,205 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/executor"
+	"forgeai/pkg/restricted"
+)
+
+func TestRestrictedExecutor(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		stdout   string
+		exitCode int
+	}{
+		{
+			name:   "functions and comprehensions",
+			code:   "def fib(n):\n    return n if n < 2 else fib(n-1) + fib(n-2)\nprint([fib(i) for i in range(10)])\n",
+			stdout: "[0, 1, 1, 2, 3, 5, 8, 13, 21, 34]\n",
+		},
+		{
+			name:   "closures",
+			code:   "def counter():\n    n = 0\n    def inc():\n        nonlocal n\n        n += 1\n        return n\n    return inc\nc = counter()\nc()\nprint(c())\n",
+			stdout: "2\n",
+		},
+		{
+			name:   "containers",
+			code:   "d = {'b': 2, 'a': 1}\nprint(sorted(d.items()), {1, 2} | {3}, (1,) * 2, 'a,b'.split(','))\n",
+			stdout: "[('a', 1), ('b', 2)] {1, 2, 3} (1, 1) ['a', 'b']\n",
+		},
+		{
+			name:   "formatting",
+			code:   "x = 3.14159\nprint(f'{x:.2f} {x!r}', '%05d' % 42, '{:>4}|'.format('ab'))\n",
+			stdout: "3.14 3.14159 00042   ab|\n",
+		},
+		{
+			name:   "big integers",
+			code:   "print(2 ** 100, -7 // 2, 7 % -3)\n",
+			stdout: "1267650600228229401496703205376 -4 -2\n",
+		},
+		{
+			name:   "caught exceptions",
+			code:   "try:\n    {}['k']\nexcept LookupError as e:\n    print('caught', repr(e))\nfinally:\n    print('done')\n",
+			stdout: "caught KeyError('k')\ndone\n",
+		},
+		{
+			name:     "uncaught exceptions",
+			code:     "def f():\n    return 1 / 0\nf()\n",
+			stdout:   "Traceback (most recent call last):\n  File \"<submitted code>\", line 3, in <module>\n    f()\n  File \"<submitted code>\", line 2, in f\n    return 1 / 0\nZeroDivisionError: division by zero\n",
+			exitCode: 1,
+		},
+		{
+			name:     "syntax errors",
+			code:     "if x\n    pass\n",
+			stdout:   "  File \"<submitted code>\", line 1\n    if x\nSyntaxError: expected ':'\n",
+			exitCode: 1,
+		},
+		{
+			name:     "imports",
+			code:     "import os\n",
+			stdout:   "Traceback (most recent call last):\n  File \"<submitted code>\", line 1, in <module>\n    import os\nImportError: import of 'os' is not allowed in restricted mode\n",
+			exitCode: 1,
+		},
+		{
+			name:     "files",
+			code:     "open('/etc/passwd')\n",
+			stdout:   "Traceback (most recent call last):\n  File \"<submitted code>\", line 1, in <module>\n    open('/etc/passwd')\nPermissionError: open() is not allowed in restricted mode\n",
+			exitCode: 1,
+		},
+		{
+			name:     "classes",
+			code:     "class A:\n    pass\n",
+			stdout:   "  File \"<submitted code>\", line 1\n    class A:\nSyntaxError: class definitions are not supported in restricted mode\n",
+			exitCode: 1,
+		},
+	}
+
+	exec := restricted.NewExecutor()
+	for _, tt := range tests {
+		result, err := exec.Execute(context.Background(), restricted.Language, tt.code)
+		if err != nil {
+			t.Errorf("%s: Execute failed: %v", tt.name, err)
+			continue
+		}
+		if result.Stdout != tt.stdout || result.ExitCode != tt.exitCode {
+			t.Errorf("%s: expected %q with exit code %d, got %q with exit code %d", tt.name, tt.stdout, tt.exitCode, result.Stdout, result.ExitCode)
+		}
+	}
+
+	if _, err := exec.Execute(context.Background(), "python", "print(1)"); err == nil {
+		t.Error("Expected other languages to be refused")
+	}
+}
+
+func TestRestrictedExecutorLimits(t *testing.T) {
+	exec := restricted.NewExecutor()
+	exec.Limits = restricted.Limits{Steps: 10000, Memory: 1 << 20}
+
+	result, err := exec.Execute(context.Background(), restricted.Language, "while True:\n    pass\n")
+	if err != nil || result.ExitCode != -1 || result.Stderr != "Step limit exceeded" {
+		t.Errorf("Expected the step limit to end the program, got %+v, %v", result, err)
+	}
+
+	result, err = exec.Execute(context.Background(), restricted.Language, "x = 'x' * (1 << 30)\n")
+	if err != nil || result.ExitCode != 1 || !strings.HasSuffix(result.Stdout, "MemoryError\n") {
+		t.Errorf("Expected a MemoryError, got %+v, %v", result, err)
+	}
+
+	result, err = exec.Execute(context.Background(), restricted.Language, "def f(n):\n    return f(n + 1)\nf(0)\n")
+	if err != nil || !strings.Contains(result.Stdout, "[Previous line repeated") || !strings.HasSuffix(result.Stdout, "RecursionError: maximum recursion depth exceeded\n") {
+		t.Errorf("Expected a RecursionError with a folded traceback, got %+v, %v", result, err)
+	}
+
+	exec.Limits = restricted.Limits{Steps: 1 << 40}
+	exec.Timeout = 100 * time.Millisecond
+	result, err = exec.Execute(context.Background(), restricted.Language, "while True:\n    pass\n")
+	if err != nil || result.ExitCode != -1 || result.Stderr != "Execution timed out" {
+		t.Errorf("Expected the timeout to end the program, got %+v, %v", result, err)
+	}
+}
+
+func TestRestrictedExecutorLargeInts(t *testing.T) {
+	exec := restricted.NewExecutor()
+	exec.Timeout = 5 * time.Second
+
+	for _, tt := range []struct {
+		name, code, stdout, stderr string
+	}{
+		{"power", "print(10**10**8 > 1)\n", "MemoryError\n", ""},
+		{"shift", "print(1 << (1 << 40))\n", "MemoryError\n", ""},
+		{"product", "x = 3 ** 600000\ny = x * x\n", "MemoryError\n", ""},
+		{"literal", "x = " + strings.Repeat("7", 5000) + "\n", "", "Exceeds the limit (4300 digits)"},
+		// Arithmetic on large ints uses up the step limit
+		{"squares", "x = 3 ** 300000\nwhile True:\n    y = x * x\n", "", "Step limit exceeded"},
+		{"modular power", "print(pow(3, 2**65536 - 1, 2**65536 - 1))\n", "", "Step limit exceeded"},
+	} {
+		start := time.Now()
+		result, err := exec.Execute(context.Background(), restricted.Language, tt.code)
+		if err != nil {
+			t.Errorf("%s: Execute failed: %v", tt.name, err)
+			continue
+		}
+		if !strings.HasSuffix(result.Stdout, tt.stdout) || !strings.Contains(result.Stderr+result.Stdout, tt.stderr) || result.ExitCode == 0 {
+			t.Errorf("%s: expected %q %q, got %+v", tt.name, tt.stdout, tt.stderr, result)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("%s: took %s", tt.name, elapsed)
+		}
+	}
+
+	// Long arithmetic stops at the timeout
+	exec.Limits = restricted.Limits{Steps: 1 << 40}
+	exec.Timeout = 200 * time.Millisecond
+	start := time.Now()
+	result, err := exec.Execute(context.Background(), restricted.Language, "x = 3 ** 300000\nwhile True:\n    y = str(x * x)\n")
+	if err != nil || result.Stderr != "Execution timed out" {
+		t.Errorf("Expected the timeout to end the program, got %+v, %v", result, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the program to stop at its timeout, took %s", elapsed)
+	}
+}
+
+func TestLocalExecutorRestricted(t *testing.T) {
+	exec := executor.NewLocalExecutor()
+	result, err := exec.Execute(context.Background(), restricted.Language, "print(sum(range(10)))\n")
+	if err != nil || result.Stdout != "45\n" {
+		t.Errorf("Expected the local executor to run restricted Python, got %+v, %v", result, err)
+	}
+}
+
+func TestRestrictedIsolationClass(t *testing.T) {
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Isolation:  api.Isolation{Default: api.ClassContainer},
+	})
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"language": restricted.Language,
+		"code":     "print('in-process')",
+	})
+	resp, err := client.Post("http://forgeai/v1/execute/sync", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var job map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&job)
+	if resp.StatusCode != http.StatusOK || job["stdout"] != "in-process\n" {
+		t.Errorf("Expected python-restricted to run in the interpreter class, got %d %v", resp.StatusCode, job)
+	}
+
+	invalid := api.Isolation{Classes: map[string]api.IsolationClass{"odd": {Backend: "in-process", Runtime: "runsc"}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Expected a runtime on the in-process backend to be refused")
+	}
+}
@@ -0,0 +1,28 @@
+//go:build nogin
+
+package test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"forgeai/pkg/api"
+)
+
+func TestNoginRouter(t *testing.T) {
+	if routers := api.Routers(); !reflect.DeepEqual(routers, []string{"std"}) {
+		t.Errorf("Expected only the standard library router, got %v", routers)
+	}
+
+	// Servers default to it
+	client, _ := startTestServer(t, &api.Config{Permissive: true})
+	resp, err := client.Get("http://forgeai/v1/jobs")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the default router to serve, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+// TestRouters checks that every compiled-in router matches the same
+// routes, which builds with -tags nogin run against the standard library
+// router alone
+func TestRouters(t *testing.T) {
+	for _, name := range api.Routers() {
+		t.Run(name, func(t *testing.T) {
+			testRouter(t, name)
+		})
+	}
+}
+
+func testRouter(t *testing.T, router string) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Router:     router,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+
+	do := func(method, path, body string) (*http.Response, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(method, "http://forgeai"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		var out map[string]interface{}
+		json.Unmarshal(data, &out)
+		return resp, out
+	}
+
+	_, created := do(http.MethodPost, "/v1/execute/sync", `{"language": "python", "code": "print(1)"}`)
+	jobID, _ := created["job_id"].(string)
+	if jobID == "" {
+		t.Fatalf("Expected a job, got %v", created)
+	}
+
+	// Path parameters reach the handler
+	if resp, job := do(http.MethodGet, "/v1/jobs/"+jobID, ""); resp.StatusCode != http.StatusOK || job["job_id"] != jobID {
+		t.Errorf("Expected job %s, got %d %v", jobID, resp.StatusCode, job)
+	}
+	if resp, job := do(http.MethodGet, "/v1/jobs/"+jobID+"/", ""); resp.StatusCode != http.StatusOK || job["job_id"] != jobID {
+		t.Errorf("Expected a trailing slash to match job %s, got %d %v", jobID, resp.StatusCode, job)
+	}
+	if resp, out := do(http.MethodGet, "/v1/jobs/missing", ""); resp.StatusCode != http.StatusNotFound || out["error"] != "job not found" {
+		t.Errorf("Expected the job handler to refuse an unknown ID, got %d %v", resp.StatusCode, out)
+	}
+	if resp, env := do(http.MethodGet, "/v1/environments/python", ""); resp.StatusCode != http.StatusOK || env["language"] != "python" {
+		t.Errorf("Expected the environment of the language parameter, got %d %v", resp.StatusCode, env)
+	}
+
+	// Static segments take precedence over parameters
+	if resp, list := do(http.MethodGet, "/v1/jobs", ""); resp.StatusCode != http.StatusOK || list["jobs"] == nil {
+		t.Errorf("Expected the job list, got %d %v", resp.StatusCode, list)
+	}
+	if resp, out := do(http.MethodGet, "/v1/environments/python/pull", ""); resp.StatusCode != http.StatusNotFound || out["error"] != "no pull of this environment" {
+		t.Errorf("Expected the pull status, got %d %v", resp.StatusCode, out)
+	}
+	if resp, out := do(http.MethodGet, "/v1/tokens/current", ""); resp.StatusCode != http.StatusUnauthorized || out["error"] != "no execution token" {
+		t.Errorf("Expected the current token, got %d %v", resp.StatusCode, out)
+	}
+
+	// Wildcards match the rest of the path
+	if resp, out := do(http.MethodGet, "/v1/sbom/unknown/a/b/c", ""); resp.StatusCode != http.StatusBadRequest || out["error"] != "kind must be plugin or image" {
+		t.Errorf("Expected the SBOM handler, got %d %v", resp.StatusCode, out)
+	}
+
+	// Unknown paths and methods are not found
+	for _, route := range []string{"GET /v1/nope", "GET /v1/jobs/a/b/c", "PUT /v1/jobs/" + jobID, "GET /v3/jobs"} {
+		method, path, _ := strings.Cut(route, " ")
+		if resp, _ := do(method, path, ""); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s, got %d", route, resp.StatusCode)
+		}
+	}
+
+	// Groups run their own middleware
+	if resp, _ := do(http.MethodGet, "/v1/jobs/"+jobID, ""); resp.Header.Get("Link") == "" {
+		t.Error("Expected /v1 responses to link their successor")
+	}
+	if resp, env := do(http.MethodGet, "/v2/jobs/"+jobID, ""); resp.Header.Get("Link") != "" || env["meta"] == nil {
+		t.Errorf("Expected an envelope without a link from /v2, got %v", env)
+	}
+}
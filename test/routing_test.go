@@ -0,0 +1,141 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestJobManagerClassRouting(t *testing.T) {
+	trusted := sandboxtest.NewFakeExecutor()
+	trusted.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "trusted\n"}}
+	isolated := sandboxtest.NewFakeExecutor()
+	isolated.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "isolated\n"}}
+
+	factory := func(fake *sandboxtest.FakeExecutor) jobs.ExecutorFactory {
+		return jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+	}
+	router := &jobs.ClassRouter{
+		Classes:   map[string]jobs.ExecutorFactory{"trusted": factory(trusted), "isolated": factory(isolated)},
+		Languages: map[string]string{"javascript": "isolated"},
+		Default:   "trusted",
+	}
+	if err := router.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	manager := jobs.NewManager()
+	manager.Executors = router
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for language, want := range map[string]string{"javascript": "isolated\n", "python": "trusted\n"} {
+		job, err := manager.Submit(ctx, jobs.Spec{Language: language, Code: "run()"})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		if job, _ = manager.Wait(ctx, job.ID); job.Result == nil || job.Result.Stdout != want {
+			t.Errorf("Expected %s to run on the executor that prints %q, got %+v", language, want, job.Result)
+		}
+	}
+
+	router.Languages["bash"] = "gvisor"
+	if err := router.Validate(); err == nil {
+		t.Error("Expected an unknown class to fail validation")
+	}
+}
+
+// countingExecutor records the peak number of executions of each language
+type countingExecutor struct {
+	sandbox.Executor
+	mu      *sync.Mutex
+	running map[string]int
+	peak    map[string]int
+}
+
+func (e countingExecutor) Execute(ctx context.Context, language, code string) (*sandbox.ExecutionResult, error) {
+	e.mu.Lock()
+	e.running[language]++
+	if e.running[language] > e.peak[language] {
+		e.peak[language] = e.running[language]
+	}
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.running[language]--
+		e.mu.Unlock()
+	}()
+	return e.Executor.Execute(ctx, language, code)
+}
+
+func TestJobManagerLanguageWorkers(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{}, Delay: 50 * time.Millisecond}
+	var mu sync.Mutex
+	running, peak := map[string]int{}, map[string]int{}
+
+	manager := jobs.NewManager()
+	manager.LanguageWorkers = map[string]int{"go": 1}
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+	manager.WrapExecutor = func(job *jobs.Job, exec sandbox.Executor) sandbox.Executor {
+		return countingExecutor{Executor: exec, mu: &mu, running: running, peak: peak}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var submitted []*jobs.Job
+	for i := 0; i < 3; i++ {
+		for _, language := range []string{"go", "python"} {
+			job, err := manager.Submit(ctx, jobs.Spec{Language: language, Code: "main()"})
+			if err != nil {
+				t.Fatalf("Submit failed: %v", err)
+			}
+			submitted = append(submitted, job)
+		}
+	}
+	for _, job := range submitted {
+		if job, _ = manager.Wait(ctx, job.ID); job.Status != "completed" {
+			t.Fatalf("Expected %s to complete, got %s: %s", job.ID, job.Status, job.Error)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if peak["go"] != 1 {
+		t.Errorf("Expected at most 1 go job at once, got %d", peak["go"])
+	}
+	if peak["python"] < 2 {
+		t.Errorf("Expected python jobs to run at once, got at most %d", peak["python"])
+	}
+}
+
+func TestIsolationValidate(t *testing.T) {
+	valid := api.Isolation{
+		Default:   api.ClassContainer,
+		Classes:   map[string]api.IsolationClass{"kata": {Backend: "docker", Runtime: "kata-runtime"}},
+		Languages: map[string]string{"bash": api.ClassGVisor, "go": "kata", "python": api.ClassNsjail},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected a valid configuration, got %v", err)
+	}
+
+	for name, isolation := range map[string]api.Isolation{
+		"unknown class":    {Languages: map[string]string{"bash": "vm"}},
+		"unknown default":  {Default: "vm"},
+		"unknown backend":  {Classes: map[string]api.IsolationClass{"vm": {Backend: "firecracker"}}},
+		"process runtime":  {Classes: map[string]api.IsolationClass{"odd": {Backend: "process", Runtime: "runsc"}}},
+		"negative workers": {Concurrency: map[string]int{"go": -1}},
+		"nsjail runtime":   {Classes: map[string]api.IsolationClass{"odd": {Backend: "nsjail", Runtime: "runsc"}}},
+		"docker nsjail":    {Classes: map[string]api.IsolationClass{"odd": {Backend: "docker", Nsjail: api.Nsjail{Home: "/home"}}}},
+	} {
+		if err := isolation.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
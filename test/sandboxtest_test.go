@@ -0,0 +1,274 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/attestation"
+	"forgeai/pkg/container"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestFakeExecutorScriptsJobs(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.On("python", "flaky", sandboxtest.Response{Err: errors.New("sandbox crashed")}).Times(1)
+	fake.On("python", "", sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "hello\n"}})
+
+	manager := jobs.NewManager()
+	manager.WrapExecutor = func(job *jobs.Job, exec sandbox.Executor) sandbox.Executor {
+		return fake
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for i, want := range []string{"setup_failed", "completed"} {
+		job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "print('flaky')"})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		job, err = manager.Wait(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+		if job.Status != want {
+			t.Errorf("Run %d: expected status %s, got %s", i, want, job.Status)
+		}
+	}
+	if calls := fake.Calls(); len(calls) != 2 {
+		t.Errorf("Expected 2 executions, got %d", len(calls))
+	}
+}
+
+func TestFakeExecutorDelayTimesOut(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Delay: time.Minute}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	result, err := fake.Execute(ctx, "go", "package main")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.ExitCode != -1 || result.Stderr != "Execution timed out" {
+		t.Errorf("Expected a timeout, got %+v", result)
+	}
+}
+
+func TestFakeDockerRunsContainers(t *testing.T) {
+	docker := sandboxtest.NewFakeDocker(t)
+	docker.Run = func(c *sandboxtest.FakeContainer) sandboxtest.FakeResult {
+		return sandboxtest.FakeResult{Output: "hello from " + c.Image + "\n", ExitCode: 3}
+	}
+
+	executor := container.NewDockerExecutor()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := executor.Execute(ctx, "python", "print('hello')")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	// The container runs the image the tag named when it was inspected
+	image := sandboxtest.FakeImageID(container.DefaultImages["python"])
+	if result.ExitCode != 3 || result.Stdout != "hello from "+image+"\n" {
+		t.Errorf("Unexpected result: exit %d, output %q", result.ExitCode, result.Stdout)
+	}
+
+	containers := docker.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("Expected 1 container, got %d", len(containers))
+	}
+	c := containers[0]
+	for _, arg := range []string{"--rm", "--init", "--cap-drop=ALL"} {
+		if !c.HasArg(arg) {
+			t.Errorf("Expected docker run option %s in %v", arg, c.Args)
+		}
+	}
+	if c.Labels[container.LabelManaged] != "true" {
+		t.Errorf("Expected the managed label, got %v", c.Labels)
+	}
+	if len(c.Command) == 0 || c.Command[0] != "python" {
+		t.Errorf("Unexpected command %v", c.Command)
+	}
+}
+
+func TestManifestRecordsBackendAndImage(t *testing.T) {
+	image := container.DefaultImages["python"]
+	sandboxtest.NewFakeDocker(t, image)
+	signer, err := attestation.NewEphemeralSigner()
+	if err != nil {
+		t.Fatalf("NewEphemeralSigner failed: %v", err)
+	}
+
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Caps.Backend = "nsjail"
+	manager := jobs.NewManager()
+	manager.Signer = signer
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+		if job != nil && job.Language == "python" {
+			return container.NewDockerExecutor()
+		}
+		return fake
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	manifest := func(language string) *attestation.Manifest {
+		job, err := manager.Submit(ctx, jobs.Spec{Language: language, Code: "print('hello')"})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		if job, err = manager.Wait(ctx, job.ID); err != nil || job.Manifest == nil {
+			t.Fatalf("Expected a signed manifest, got %v %v", job.Status, err)
+		}
+		m, err := attestation.Verify(job.Manifest, signer.PublicKey())
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		return m
+	}
+
+	m := manifest("python")
+	if m.Executor != "docker" || m.Image != image || m.ImageDigest != sandboxtest.FakeImageID(image) {
+		t.Errorf("Expected the docker backend and the digest of %s, got %s %s %s", image, m.Executor, m.Image, m.ImageDigest)
+	}
+	m = manifest("go")
+	if m.Executor != "nsjail" || m.Image != "" || m.ImageDigest != "" {
+		t.Errorf("Expected the nsjail backend without an image, got %s %s %s", m.Executor, m.Image, m.ImageDigest)
+	}
+}
+
+func TestFakeDockerStopsCancelledContainers(t *testing.T) {
+	docker := sandboxtest.NewFakeDocker(t, container.DefaultImages["python"])
+	started := make(chan struct{}, 1)
+	docker.Run = func(c *sandboxtest.FakeContainer) sandboxtest.FakeResult {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		return sandboxtest.FakeResult{Delay: time.Minute}
+	}
+
+	// Cancel once the container runs, so that pulling the image is not
+	// part of what is cancelled
+	executor := container.NewDockerExecutor()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelled := make(chan time.Time, 1)
+	go func() {
+		select {
+		case <-started:
+			cancelled <- time.Now()
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	result, err := executor.Execute(ctx, "python", "while True: pass")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result.ExitCode != 143 {
+		t.Errorf("Expected the container to be stopped, got exit %d", result.ExitCode)
+	}
+	select {
+	case at := <-cancelled:
+		if elapsed := time.Since(at); elapsed > 10*time.Second {
+			t.Errorf("The container was not stopped, took %v", elapsed)
+		}
+	default:
+		t.Error("Expected the container to run before it was cancelled")
+	}
+}
+
+func TestFakeDockerPullProgress(t *testing.T) {
+	docker := sandboxtest.NewFakeDocker(t)
+
+	var updates []container.PullProgress
+	executor := container.NewDockerExecutor()
+	if err := executor.PullImage(context.Background(), "python:3.9-alpine", func(p container.PullProgress) {
+		updates = append(updates, p)
+	}); err != nil {
+		t.Fatalf("PullImage failed: %v", err)
+	}
+
+	if len(updates) == 0 {
+		t.Fatal("Expected progress updates")
+	}
+	last := updates[len(updates)-1]
+	if last.Layers != 2 || last.Done != 2 || last.Percent() != 100 {
+		t.Errorf("Expected both layers done, got %+v", last)
+	}
+	halfway := false
+	for _, p := range updates {
+		halfway = halfway || p.Percent() == 50
+	}
+	if !halfway {
+		t.Errorf("Expected progress through 50%%, got %+v", updates)
+	}
+	if images := docker.Images(); len(images) != 1 || images[0] != "python:3.9-alpine" {
+		t.Errorf("Expected the image to be pulled, got %v", images)
+	}
+}
+
+func TestEnvironmentPullProgress(t *testing.T) {
+	sandboxtest.NewFakeDocker(t)
+
+	client, _ := startTestServer(t, &api.Config{Permissive: true})
+	resp, err := client.Post("http://forgeai/v1/environments/python/pull", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+
+	type pullStatus struct {
+		State   string `json:"state"`
+		Percent int    `json:"percent"`
+		Events  []struct {
+			Seq     int `json:"seq"`
+			Percent int `json:"percent"`
+		} `json:"events"`
+	}
+	var status pullStatus
+	for deadline := time.Now().Add(5 * time.Second); status.State != "done"; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the pull to finish, got %+v", status)
+		}
+		resp, err := client.Get("http://forgeai/v1/environments/python/pull")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		status = pullStatus{}
+		json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+	}
+	if status.Percent != 100 || len(status.Events) == 0 {
+		t.Fatalf("Expected a complete pull with progress events, got %+v", status)
+	}
+
+	// Polling with since returns only newer events
+	last := status.Events[len(status.Events)-1].Seq
+	resp, err = client.Get(fmt.Sprintf("http://forgeai/v1/environments/python/pull?since=%d", last))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	status = pullStatus{}
+	json.NewDecoder(resp.Body).Decode(&status)
+	if len(status.Events) != 0 {
+		t.Errorf("Expected no events after %d, got %+v", last, status.Events)
+	}
+}
@@ -0,0 +1,304 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestSessionAffinity(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+	store := jobs.NewMemoryStore()
+	sessions := jobs.NewMemorySessionStore()
+	replica := func(worker string) *jobs.Manager {
+		manager := jobs.NewManager()
+		manager.Store = store
+		manager.Sessions = sessions
+		manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		})
+		manager.Worker = worker
+		manager.HeartbeatInterval = time.Second
+		return manager
+	}
+	replica1, replica2 := replica("replica-1"), replica("replica-2")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	spec := jobs.Spec{Language: "python", Code: "print(1)", Session: "s1"}
+
+	first, err := replica1.Submit(ctx, spec)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if job, _ := replica1.Wait(ctx, first.ID); job.Status != "completed" || job.Worker != "replica-1" {
+		t.Fatalf("Expected the first job to run on its replica, got %s on %q", job.Status, job.Worker)
+	}
+
+	// A job of the session received by another replica waits for the owner
+	second, err := replica2.Submit(ctx, spec)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if second.ID == first.ID {
+		t.Fatal("Expected jobs of a session not to be coalesced")
+	}
+	if status, _ := replica2.Status(second.ID); status != "pending" {
+		t.Errorf("Expected the job to wait for the session's replica, got %s", status)
+	}
+	if claimed := replica2.ClaimSessionJobs(ctx); len(claimed) != 0 {
+		t.Errorf("Expected other replicas not to claim the job, got %d", len(claimed))
+	}
+	if claimed := replica1.ClaimSessionJobs(ctx); len(claimed) != 1 || claimed[0].ID != second.ID {
+		t.Fatalf("Expected the session's replica to claim the job, got %d", len(claimed))
+	}
+	if job, _ := replica1.Wait(ctx, second.ID); job.Status != "completed" || job.Worker != "replica-1" {
+		t.Errorf("Expected the job to run on the session's replica, got %s on %q", job.Status, job.Worker)
+	}
+	if session, ok := replica2.GetSession("s1"); !ok || session.Worker != "replica-1" || session.Jobs != 2 {
+		t.Errorf("Expected the session to count both jobs on replica-1, got %+v", session)
+	}
+
+	// The session is lost with its replica, and its waiting jobs with it
+	third, err := replica2.Submit(ctx, spec)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	replica2.Heartbeat(time.Now())
+	replica2.RecoverInterrupted(ctx, time.Now().Add(time.Minute))
+	if job, _ := replica2.Wait(ctx, third.ID); job.Status != "interrupted" || !strings.Contains(job.Error, "session s1 was lost") {
+		t.Errorf("Expected the waiting job to be interrupted, got %s: %s", job.Status, job.Error)
+	}
+	if session, _ := replica2.GetSession("s1"); session.Status != jobs.SessionLost {
+		t.Errorf("Expected the session to be lost, got %s", session.Status)
+	}
+	if _, err := replica2.Submit(ctx, spec); !errors.Is(err, jobs.ErrSessionLost) {
+		t.Errorf("Expected ErrSessionLost, got %v", err)
+	}
+
+	// Ending the session starts it again on the next replica
+	if err := replica2.EndSession("s1"); err != nil {
+		t.Fatalf("EndSession failed: %v", err)
+	}
+	fourth, err := replica2.Submit(ctx, spec)
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	if job, _ := replica2.Wait(ctx, fourth.ID); job.Status != "completed" || job.Worker != "replica-2" {
+		t.Errorf("Expected the restarted session to run on replica-2, got %s on %q", job.Status, job.Worker)
+	}
+	if err := replica2.EndSession("missing"); !errors.Is(err, jobs.ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestSessionsAPI(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+	sessions := jobs.NewMemorySessionStore()
+	stale := time.Now().Add(-time.Hour)
+	sessions.PutSession(&jobs.Session{ID: "acme/gone", Worker: "replica-1", Status: jobs.SessionActive, CreatedAt: stale, HeartbeatAt: stale})
+	client, _ := startTestServer(t, &api.Config{
+		Permissive:   true,
+		Worker:       "replica-2",
+		SessionStore: sessions,
+		AdminToken:   "admin-secret",
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+		Hooks: api.Hooks{
+			Tenant: func(r *http.Request) string {
+				return strings.TrimSuffix(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), "-credential")
+			},
+		},
+	})
+
+	credential := "Bearer acme-credential"
+	do := func(method, path string, body interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, "http://forgeai"+path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		if credential != "" {
+			req.Header.Set("Authorization", credential)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	execute := func(session string) (int, map[string]interface{}) {
+		return do(http.MethodPost, "/v1/execute/sync", map[string]interface{}{
+			"language": "python",
+			"code":     "print(1)",
+			"session":  session,
+		})
+	}
+
+	if status, job := execute("s1"); status != http.StatusOK || job["session"] != "s1" || job["worker"] != "replica-2" {
+		t.Errorf("Expected the job to start the session, got %d %v", status, job)
+	}
+	if status, session := do(http.MethodGet, "/v1/sessions/s1", nil); status != http.StatusOK || session["worker"] != "replica-2" || session["status"] != jobs.SessionActive {
+		t.Errorf("Expected the session on replica-2, got %d %v", status, session)
+	}
+	if status, _ := execute("bad id"); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid session, got %d", status)
+	}
+
+	if status, _ := execute("gone"); status != http.StatusGone {
+		t.Errorf("Expected 410 for a session whose replica stopped responding, got %d", status)
+	}
+	if status, session := do(http.MethodGet, "/v1/sessions/gone", nil); status != http.StatusOK || session["status"] != jobs.SessionLost {
+		t.Errorf("Expected the session to be lost, got %d %v", status, session)
+	}
+	if status, _ := do(http.MethodDelete, "/v1/sessions/gone", nil); status != http.StatusOK {
+		t.Errorf("Expected 200 for ending the session, got %d", status)
+	}
+	if status, _ := do(http.MethodGet, "/v1/sessions/gone", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 after ending the session, got %d", status)
+	}
+
+	// Sessions belong to their tenant
+	if _, ok := sessions.GetSession("acme/s1"); !ok {
+		t.Error("Expected the session to be stored below its tenant")
+	}
+	credential = "Bearer globex-credential"
+	if status, _ := do(http.MethodGet, "/v1/sessions/s1", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for another tenant's session, got %d", status)
+	}
+	if status, _ := do(http.MethodGet, "/v1/sessions/s1?tenant=acme", nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for naming another tenant, got %d", status)
+	}
+	if status, _ := do(http.MethodDelete, "/v1/sessions/s1?tenant=acme", nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for ending another tenant's session, got %d", status)
+	}
+	if status, job := execute("s1"); status != http.StatusOK || job["session"] != "s1" {
+		t.Errorf("Expected another tenant to start a session of its own, got %d %v", status, job)
+	}
+	if session, _ := sessions.GetSession("globex/s1"); session == nil || session.Jobs != 1 {
+		t.Errorf("Expected a separate session for the other tenant, got %+v", session)
+	}
+	credential = "Bearer admin-secret"
+	if status, session := do(http.MethodGet, "/v1/sessions/s1?tenant=acme", nil); status != http.StatusOK || session["id"] != "s1" || session["jobs"] != float64(1) {
+		t.Errorf("Expected admins to see any tenant's session, got %d %v", status, session)
+	}
+
+	// Callers without a tenant cannot use sessions
+	credential = ""
+	if status, _ := execute("s1"); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a session without a tenant, got %d", status)
+	}
+	if status, _ := do(http.MethodGet, "/v1/sessions/s1", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for reading a session without a tenant, got %d", status)
+	}
+	if status, _ := do(http.MethodDelete, "/v1/sessions/s1", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for ending a session without a tenant, got %d", status)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	sessions := jobs.NewMemorySessionStore()
+	now := time.Now()
+	sessions.PutSession(&jobs.Session{ID: "idle", Worker: "replica-1", Status: jobs.SessionActive, CreatedAt: now.Add(-3 * time.Hour), UsedAt: now.Add(-2 * time.Hour)})
+	sessions.PutSession(&jobs.Session{ID: "old", Worker: "replica-2", Status: jobs.SessionLost, CreatedAt: now.Add(-3 * time.Hour)})
+	sessions.PutSession(&jobs.Session{ID: "recent", Worker: "replica-1", Status: jobs.SessionActive, CreatedAt: now.Add(-3 * time.Hour), UsedAt: now.Add(-time.Minute)})
+	manager := jobs.NewManager()
+	manager.Sessions = sessions
+	manager.Worker = "replica-1"
+	manager.SessionTTL = time.Hour
+
+	manager.Heartbeat(now)
+	for _, id := range []string{"idle", "old"} {
+		if _, ok := sessions.GetSession(id); ok {
+			t.Errorf("Expected session %s to expire", id)
+		}
+	}
+	if session, ok := sessions.GetSession("recent"); !ok || !session.HeartbeatAt.Equal(now) {
+		t.Errorf("Expected the recent session to be kept and heartbeat, got %+v", session)
+	}
+}
+
+func TestSpilledSessionJobs(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sessions := jobs.NewMemorySessionStore()
+
+	// The first process is stuck on a job of the session when it stops
+	blocked := sandboxtest.NewFakeExecutor()
+	blocked.Default = sandboxtest.Response{Delay: time.Minute}
+	first := &jobs.SpillQueue{Dir: dir, Threshold: 1, Workers: 1}
+	manager := jobs.NewManager()
+	manager.Queue = first
+	manager.Sessions = sessions
+	manager.Worker = "replica-1"
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return blocked })
+
+	running, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "stuck()", Session: "s1"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	for len(blocked.Calls()) == 0 {
+		if ctx.Err() != nil {
+			t.Fatal("The first job never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var spilled []*jobs.Job
+	for i := 0; i < 3; i++ {
+		spec := jobs.Spec{Language: "python", Code: fmt.Sprintf("print(%d)", i)}
+		if i > 0 {
+			spec.Session = "s1"
+		}
+		job, err := manager.Submit(ctx, spec)
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		spilled = append(spilled, job)
+	}
+	first.Close()
+	manager.CancelJob(running.ID)
+
+	// The restarted process does not run the session's jobs without its state
+	fake := sandboxtest.NewFakeExecutor()
+	second := &jobs.SpillQueue{Dir: dir, Threshold: 1, Workers: 1}
+	defer second.Close()
+	restarted := jobs.NewManager()
+	restarted.Queue = second
+	restarted.Sessions = sessions
+	restarted.Worker = "replica-1"
+	restarted.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+
+	if n, err := second.Recover(restarted); err != nil || n != 2 {
+		t.Fatalf("Expected the 2 spilled jobs, got %d: %v", n, err)
+	}
+	job, err := restarted.Wait(ctx, spilled[2].ID)
+	if err != nil {
+		t.Fatalf("Expected the spilled job of the session: %v", err)
+	}
+	if job.Status != "interrupted" || job.Session != "s1" || !strings.Contains(job.Error, "session s1 was lost") {
+		t.Errorf("Expected the spilled job of the session to be interrupted, got %s: %s", job.Status, job.Error)
+	}
+	if session, _ := sessions.GetSession("s1"); session == nil || session.Status != jobs.SessionLost {
+		t.Errorf("Expected the session to be lost, got %+v", session)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("Expected no job of the session to run, got %+v", calls)
+	}
+}
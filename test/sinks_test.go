@@ -0,0 +1,144 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+	"forgeai/pkg/sinks"
+	"forgeai/pkg/storage"
+)
+
+func TestSinkResolve(t *testing.T) {
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := sinks.NewRegistry()
+	r.Add("s3", "results", "tenants", backend)
+
+	target, err := r.Resolve("s3://results/tenants/acme/run-1/", "acme")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if target.Prefix != "tenants/acme/run-1" || target.URL != "s3://results/tenants/acme/run-1" {
+		t.Errorf("Unexpected target: %+v", target)
+	}
+
+	for _, tt := range []struct{ url, tenant string }{
+		{"s3://results/tenants/other/run-1", "acme"},
+		{"s3://results/tenants/acme/../other", "acme"},
+		{"s3://results/tenants/acmecorp", "acme"},
+		{"s3://elsewhere/tenants/acme", "acme"},
+		{"gs://results/tenants/acme", "acme"},
+		{"s3://results/tenants/acme", ""},
+		{"https://results/tenants/acme", "acme"},
+	} {
+		if _, err := r.Resolve(tt.url, tt.tenant); err == nil {
+			t.Errorf("Expected %s to be refused for tenant %q", tt.url, tt.tenant)
+		}
+	}
+}
+
+func TestSinkPush(t *testing.T) {
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := sinks.NewRegistry()
+	registry.Add("s3", "results", "", backend)
+
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{
+		Stdout:    "done\n",
+		Artifacts: []sandbox.Artifact{{Name: "report.csv", ContentType: "text/csv", Data: []byte("a,b\n")}},
+	}}
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Sinks:      registry,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+		Hooks: api.Hooks{Tenant: func(r *http.Request) string {
+			if r.Header.Get("Authorization") == "Bearer acme-credential" {
+				return "acme"
+			}
+			return ""
+		}},
+	})
+
+	credential := "acme-credential"
+	labels := map[string]string{"tenant": "acme"}
+	execute := func(sink string) (int, map[string]interface{}) {
+		body, _ := json.Marshal(map[string]interface{}{
+			"language":    "python",
+			"code":        "print('done')",
+			"labels":      labels,
+			"output_sink": sink,
+		})
+		req, _ := http.NewRequest(http.MethodPost, "http://forgeai/v1/execute/sync", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if credential != "" {
+			req.Header.Set("Authorization", "Bearer "+credential)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	if status, _ := execute("s3://results/other/run-1"); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for another tenant's prefix, got %d", status)
+	}
+
+	// The tenant is the caller's, whatever the labels say
+	labels = map[string]string{"tenant": "other"}
+	if status, _ := execute("s3://results/other/run-1"); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for another tenant's label, got %d", status)
+	}
+	credential, labels = "", nil
+	if status, _ := execute("s3://results/acme/run-1"); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a caller without a tenant, got %d", status)
+	}
+	credential = "acme-credential"
+
+	status, job := execute("s3://results/acme/run-1")
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", status, job)
+	}
+	receipt, _ := job["output_sink"].(map[string]interface{})
+	if receipt == nil || receipt["error"] != nil {
+		t.Fatalf("Expected a successful push, got %v", job["output_sink"])
+	}
+	if objects, _ := receipt["objects"].([]interface{}); len(objects) != 2 {
+		t.Errorf("Expected stdout and one artifact to be pushed, got %v", receipt["objects"])
+	}
+
+	id := job["job_id"].(string)
+	for key, want := range map[string]string{
+		"acme/run-1/" + id + "/stdout.log":           "done\n",
+		"acme/run-1/" + id + "/artifacts/report.csv": "a,b\n",
+	} {
+		r, err := backend.Get(context.Background(), key)
+		if err != nil {
+			t.Errorf("Expected %s to be pushed: %v", key, err)
+			continue
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if string(data) != want {
+			t.Errorf("Expected %s to hold %q, got %q", key, want, data)
+		}
+	}
+}
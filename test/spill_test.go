@@ -0,0 +1,127 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestSpillQueueOrder(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{}, Delay: 20 * time.Millisecond}
+
+	queue := &jobs.SpillQueue{Dir: t.TempDir(), Threshold: 2, Workers: 1}
+	defer queue.Close()
+	manager := jobs.NewManager()
+	manager.Queue = queue
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var submitted []*jobs.Job
+	for i := 0; i < 8; i++ {
+		job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: fmt.Sprintf("print(%d)", i)})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		submitted = append(submitted, job)
+	}
+	if stats := queue.Stats(); stats.InMemory > 2 || stats.Spilled < 4 || stats.SpillSize == 0 {
+		t.Errorf("Expected at most 2 jobs in memory and the rest spilled, got %+v", stats)
+	}
+
+	for _, job := range submitted {
+		if job, _ = manager.Wait(ctx, job.ID); job.Status != "completed" {
+			t.Fatalf("Expected %s to complete, got %s: %s", job.ID, job.Status, job.Error)
+		}
+	}
+	calls := fake.Calls()
+	if len(calls) != len(submitted) {
+		t.Fatalf("Expected %d executions, got %d", len(submitted), len(calls))
+	}
+	for i, call := range calls {
+		if want := fmt.Sprintf("print(%d)", i); call.Code != want {
+			t.Errorf("Expected execution %d to run %q, got %q", i, want, call.Code)
+		}
+	}
+	if stats := queue.Stats(); stats != (jobs.SpillStats{}) {
+		t.Errorf("Expected an empty queue, got %+v", stats)
+	}
+}
+
+func TestSpillQueueRecover(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The first process is stuck on its first job when it stops
+	blocked := sandboxtest.NewFakeExecutor()
+	blocked.Default = sandboxtest.Response{Delay: time.Minute}
+	first := &jobs.SpillQueue{Dir: dir, Threshold: 1, Workers: 1}
+	manager := jobs.NewManager()
+	manager.Queue = first
+	manager.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return blocked })
+
+	running, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: "stuck()"})
+	if err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	for len(blocked.Calls()) == 0 {
+		if ctx.Err() != nil {
+			t.Fatal("The first job never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// One job waits in memory and is lost, the others are spilled
+	var spilled []*jobs.Job
+	for i := 0; i < 3; i++ {
+		job, err := manager.Submit(ctx, jobs.Spec{Language: "python", Code: fmt.Sprintf("print(%d)", i), Labels: map[string]string{"n": fmt.Sprint(i)}})
+		if err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+		spilled = append(spilled, job)
+	}
+	first.Close()
+	manager.CancelJob(running.ID)
+
+	// The second process picks up the spilled jobs
+	fake := sandboxtest.NewFakeExecutor()
+	second := &jobs.SpillQueue{Dir: dir, Threshold: 1, Workers: 1}
+	defer second.Close()
+	restarted := jobs.NewManager()
+	restarted.Queue = second
+	restarted.Executors = jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor { return fake })
+
+	n, err := second.Recover(restarted)
+	if err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("Expected the 2 spilled jobs, got %d", n)
+	}
+	for i, original := range spilled[1:] {
+		job, err := restarted.Wait(ctx, original.ID)
+		if err != nil {
+			t.Fatalf("Expected recovered job %s: %v", original.ID, err)
+		}
+		if job.Status != "completed" || job.Labels["n"] != fmt.Sprint(i+1) || !job.CreatedAt.Equal(original.CreatedAt) {
+			t.Errorf("Unexpected recovered job: %s %v %v", job.Status, job.Labels, job.CreatedAt)
+		}
+	}
+	if calls := fake.Calls(); len(calls) != 2 || calls[0].Code != "print(1)" || calls[1].Code != "print(2)" {
+		t.Errorf("Expected the spilled jobs to run in order, got %+v", calls)
+	}
+
+	// Nothing is left to recover
+	third := &jobs.SpillQueue{Dir: dir}
+	defer third.Close()
+	if n, err := third.Recover(jobs.NewManager()); err != nil || n != 0 {
+		t.Errorf("Expected nothing to recover, got %d: %v", n, err)
+	}
+}
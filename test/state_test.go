@@ -0,0 +1,176 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/fixtures"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/quota"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+	"forgeai/pkg/state"
+	"forgeai/pkg/tokens"
+)
+
+func TestTokenExportRestore(t *testing.T) {
+	source := &tokens.Store{}
+	token, issued, err := source.Issue("alice", tokens.Scope{Language: "python", Executions: 2}, time.Hour)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	records := source.Export()
+	if len(records) != 1 || strings.Contains(records[0].Hash, token) {
+		t.Fatalf("Expected one record keyed by hash, got %+v", records)
+	}
+
+	target := &tokens.Store{}
+	if n, err := target.Restore(records); err != nil || n != 1 {
+		t.Fatalf("Expected the token to be restored, got %d: %v", n, err)
+	}
+	if got, err := target.Use(token, tokens.Request{Language: "python"}); err != nil || got.ID != issued.ID {
+		t.Errorf("Expected the restored token to be usable, got %+v: %v", got, err)
+	}
+
+	records[0].Hash = "not-a-hash"
+	if _, err := target.Restore(records); err == nil {
+		t.Error("Expected a record without a valid hash to be refused")
+	}
+}
+
+func TestStateArchiveVersion(t *testing.T) {
+	var buf bytes.Buffer
+	archive, err := state.NewWriter(&buf, state.Manifest{Server: "a"})
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	archive.WriteJSON("templates.json", []string{})
+	archive.Close()
+
+	reader, err := state.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil || reader.Manifest.Version != state.Version || reader.Manifest.Server != "a" {
+		t.Fatalf("Expected the manifest to be read, got %+v: %v", reader, err)
+	}
+	if name, _, err := reader.Next(); err != nil || name != "templates.json" {
+		t.Errorf("Expected the templates file, got %q: %v", name, err)
+	}
+	if _, _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last file, got %v", err)
+	}
+}
+
+func TestStateExportImport(t *testing.T) {
+	start := func(fixtureDir string, quotas *quota.Manager) (*fixtures.Store, func(method, path string, body []byte) *http.Response) {
+		fake := sandboxtest.NewFakeExecutor()
+		fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+		store := fixtures.NewStore(fixtureDir)
+		if err := store.Open(); err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		client, _ := startTestServer(t, &api.Config{
+			Permissive: true,
+			Quotas:     quotas,
+			Fixtures:   store,
+			AdminToken: "admin-secret",
+			Worker:     "old-host",
+			Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+				return fake
+			}),
+		})
+		return store, func(method, path string, body []byte) *http.Response {
+			req, _ := http.NewRequest(method, "http://forgeai"+path, bytes.NewReader(body))
+			req.Header.Set("Authorization", "Bearer admin-secret")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			return resp
+		}
+	}
+
+	oldFixtures, old := start(t.TempDir(), quota.NewManager(nil))
+	oldFixtures.Put("sales.csv", strings.NewReader("a,b\n1,2\n"))
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodPost, "/v1/templates", `{"name": "hello", "language": "python", "code": "print('hi')", "parameters": []}`},
+		{http.MethodPut, "/v1/admin/quotas/tenant:acme", `{"limits": [{"metric": "executions", "limit": 100, "window": "1h"}]}`},
+		{http.MethodPost, "/v1/execute?sync=true", `{"language": "python", "code": "print(1)"}`},
+	} {
+		resp := old(req.method, req.path, []byte(req.body))
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			t.Fatalf("%s %s failed with %d", req.method, req.path, resp.StatusCode)
+		}
+	}
+	var listed struct {
+		Jobs []struct {
+			ID string `json:"job_id"`
+		} `json:"jobs"`
+	}
+	resp := old(http.MethodGet, "/v1/jobs", nil)
+	json.NewDecoder(resp.Body).Decode(&listed)
+	resp.Body.Close()
+	if len(listed.Jobs) != 1 {
+		t.Fatalf("Expected one job, got %+v", listed)
+	}
+
+	resp = old(http.MethodGet, "/v1/admin/state?jobs=true", nil)
+	archive, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Export failed with %d: %s", resp.StatusCode, archive)
+	}
+
+	newQuotas := quota.NewManager(nil)
+	newFixtures, target := start(t.TempDir(), newQuotas)
+	resp = target(http.MethodPost, "/v1/admin/state", archive)
+	var report state.Report
+	json.NewDecoder(resp.Body).Decode(&report)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Import failed with %d: %+v", resp.StatusCode, report)
+	}
+	if report.Manifest.Server != "old-host" || !report.Manifest.Jobs {
+		t.Errorf("Unexpected manifest %+v", report.Manifest)
+	}
+	if report.Imported["templates"] != 1 || report.Imported["quotas"] != 1 || report.Imported["fixtures"] != 1 || report.Imported["jobs"] != 1 {
+		t.Errorf("Unexpected import counts %+v", report.Imported)
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0] != "settings.json" {
+		t.Errorf("Expected the settings to be skipped without ?settings=true, got %v", report.Skipped)
+	}
+
+	if limits, ok := newQuotas.LimitsOf("tenant:acme"); !ok || len(limits) != 1 || limits[0].Limit != 100 {
+		t.Errorf("Expected the quota override to be imported, got %+v", limits)
+	}
+	if list := newFixtures.List(); len(list) != 1 || list[0].Name != "sales.csv" {
+		t.Errorf("Expected the fixture to be imported, got %+v", list)
+	}
+	resp = target(http.MethodGet, "/v1/templates/hello", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the template to be imported, got %d", resp.StatusCode)
+	}
+	resp = target(http.MethodGet, "/v1/jobs/"+listed.Jobs[0].ID, nil)
+	var job struct {
+		Status string            `json:"status"`
+		Labels map[string]string `json:"labels"`
+	}
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if job.Status != "completed" || job.Labels[jobs.BackfillLabel] != "import" {
+		t.Errorf("Expected the job to keep its ID, got %d %+v", resp.StatusCode, job)
+	}
+
+	// Truncated archives are refused
+	resp = target(http.MethodPost, "/v1/admin/state", archive[:10])
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a truncated archive to be refused, got %d", resp.StatusCode)
+	}
+}
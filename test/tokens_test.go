@@ -0,0 +1,185 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+	"forgeai/pkg/tokens"
+)
+
+func TestTokenStore(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := &tokens.Store{Now: func() time.Time { return now }}
+
+	if _, _, err := store.Issue("alice", tokens.Scope{Language: "python"}, 0); err == nil {
+		t.Error("Expected a token without executions to be refused")
+	}
+	if _, _, err := store.Issue("alice", tokens.Scope{Language: "python", Executions: 1}, 48*time.Hour); err == nil {
+		t.Error("Expected a ttl beyond the maximum to be refused")
+	}
+
+	token, issued, err := store.Issue("alice", tokens.Scope{Language: "python", MaxTimeout: 10, Executions: 2}, 0)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	if !tokens.IsToken(token) || !issued.ExpiresAt.Equal(now.Add(tokens.DefaultTTL)) {
+		t.Errorf("Unexpected token %q expiring at %s", token, issued.ExpiresAt)
+	}
+
+	cases := []struct {
+		req tokens.Request
+		err error
+	}{
+		{tokens.Request{Language: "javascript"}, tokens.ErrScope},
+		{tokens.Request{Language: "python", NetworkAccess: true}, tokens.ErrScope},
+		{tokens.Request{Language: "python", Timeout: 30}, tokens.ErrScope},
+		{tokens.Request{Language: "python", Timeout: 10}, nil},
+		{tokens.Request{Language: "python"}, nil},
+		{tokens.Request{Language: "python"}, tokens.ErrExhausted},
+	}
+	for _, tc := range cases {
+		_, err := store.Use(token, tc.req)
+		if !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+			t.Errorf("Use(%+v) = %v, expected %v", tc.req, err, tc.err)
+		}
+	}
+
+	// Released executions can be used again
+	store.Release(token)
+	if _, err := store.Use(token, tokens.Request{Language: "python"}); err != nil {
+		t.Errorf("Expected the released execution to be usable, got %v", err)
+	}
+
+	// Tokens expire, and revoked tokens are no longer valid
+	expiring, _, _ := store.Issue("alice", tokens.Scope{Language: "python", Executions: 1}, time.Minute)
+	revoked, t3, _ := store.Issue("alice", tokens.Scope{Language: "python", Executions: 1}, time.Hour)
+	if err := store.Revoke(t3.ID, "bob"); !errors.Is(err, tokens.ErrInvalid) {
+		t.Errorf("Expected other subjects not to revoke the token, got %v", err)
+	}
+	if err := store.Revoke(t3.ID, "alice"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := store.Lookup(revoked); !errors.Is(err, tokens.ErrInvalid) {
+		t.Errorf("Expected the revoked token to be invalid, got %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := store.Use(expiring, tokens.Request{Language: "python"}); !errors.Is(err, tokens.ErrExpired) {
+		t.Errorf("Expected the token to have expired, got %v", err)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+		Hooks: api.Hooks{Actor: func(r *http.Request) string {
+			if r.Header.Get("Authorization") == "Bearer alice-credential" {
+				return "alice"
+			}
+			return ""
+		}},
+	})
+
+	do := func(method, path, body string, header ...string) *http.Response {
+		req, _ := http.NewRequest(method, "http://forgeai"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := do(http.MethodPost, "/v1/tokens", `{"language": "python", "executions": 1}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected anonymous exchanges to be refused, got %d", resp.StatusCode)
+	}
+
+	// The actor header is not a credential
+	resp = do(http.MethodPost, "/v1/tokens", `{"language": "python", "executions": 1}`, "X-Forgeai-Actor", "alice")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected exchanges naming an actor to be refused, got %d", resp.StatusCode)
+	}
+
+	resp = do(http.MethodPost, "/v1/tokens", `{"language": "python", "max_timeout": 10, "executions": 1, "ttl": "5m"}`,
+		"Authorization", "Bearer alice-credential")
+	var issued struct {
+		Token   string `json:"token"`
+		ID      string `json:"id"`
+		Subject string `json:"subject"`
+	}
+	json.NewDecoder(resp.Body).Decode(&issued)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || issued.Subject != "alice" {
+		t.Fatalf("Expected a token for alice, got %d %+v", resp.StatusCode, issued)
+	}
+	bearer := []string{"Authorization", "Bearer " + issued.Token}
+
+	// A token cannot be exchanged for another
+	resp = do(http.MethodPost, "/v1/tokens", `{"language": "python", "executions": 100}`, bearer...)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected token exchanges with a token to be refused, got %d", resp.StatusCode)
+	}
+
+	execute := func(body string) int {
+		resp := do(http.MethodPost, "/v1/execute?sync=true", body, bearer...)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := execute(`{"language": "javascript", "code": "1"}`); status != http.StatusForbidden {
+		t.Errorf("Expected another language to be refused, got %d", status)
+	}
+	if status := execute(`{"language": "python", "code": "print(1)", "timeout": 60}`); status != http.StatusForbidden {
+		t.Errorf("Expected a longer timeout to be refused, got %d", status)
+	}
+	// Requests refused after the token was checked do not use it up
+	if status := execute(`{"language": "python", "code": "print(1)", "timeout": 5, "output_sink": "s3://bucket/out"}`); status != http.StatusBadRequest {
+		t.Errorf("Expected the output sink to be refused, got %d", status)
+	}
+	if status := execute(`{"language": "python", "code": "print(1)", "timeout": 5}`); status != http.StatusOK {
+		t.Errorf("Expected the execution within scope to run, got %d", status)
+	}
+	if status := execute(`{"language": "python", "code": "print(2)", "timeout": 5}`); status != http.StatusForbidden {
+		t.Errorf("Expected the token to be used up, got %d", status)
+	}
+
+	resp = do(http.MethodGet, "/v1/tokens/current", "", bearer...)
+	var current struct {
+		Used      int `json:"used"`
+		Remaining int `json:"remaining"`
+	}
+	json.NewDecoder(resp.Body).Decode(&current)
+	resp.Body.Close()
+	if current.Used != 1 || current.Remaining != 0 {
+		t.Errorf("Expected 1 used and none remaining, got %+v", current)
+	}
+
+	// The holder may revoke the token, after which it is invalid
+	resp = do(http.MethodDelete, "/v1/tokens/"+issued.ID, "", bearer...)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the token to be revoked, got %d", resp.StatusCode)
+	}
+	if status := execute(`{"language": "python", "code": "print(3)"}`); status != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked token to be refused, got %d", status)
+	}
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"testing"
+
+	"forgeai/pkg/container"
+)
+
+func TestParseDaemonMode(t *testing.T) {
+	cases := map[string]string{
+		`["name=seccomp,profile=builtin","name=cgroupns"]`:                 container.ModeRootful,
+		`["name=seccomp,profile=builtin","name=rootless","name=cgroupns"]`: container.ModeRootless,
+		`["name=apparmor","name=seccomp,profile=builtin","name=userns"]`:   container.ModeUsernsRemap,
+		`null`: container.ModeRootful,
+	}
+	for options, want := range cases {
+		if got := container.ParseDaemonMode(options); got != want {
+			t.Errorf("ParseDaemonMode(%s) = %s, want %s", options, got, want)
+		}
+	}
+}
+
+func TestParseSubordinateIDs(t *testing.T) {
+	subuid := []byte("# subordinate ids\nalice:100000:65536\n1001:165536:65536\ndockremap:231072:65536\n")
+
+	if base, ok := container.ParseSubordinateIDs(subuid, "dockremap", -1); !ok || base != 231072 {
+		t.Errorf("dockremap range starts at %d (%v), want 231072", base, ok)
+	}
+	if base, ok := container.ParseSubordinateIDs(subuid, "bob", 1001); !ok || base != 165536 {
+		t.Errorf("uid 1001 range starts at %d (%v), want 165536", base, ok)
+	}
+	if _, ok := container.ParseSubordinateIDs(subuid, "carol", 1002); ok {
+		t.Error("found a range for a user without one")
+	}
+}
+
+func TestRootlessUserMapping(t *testing.T) {
+	mapping := container.UserMapping{Mode: container.ModeRootless, Owner: 1000, Base: 100000}
+
+	// Container root is the user running the daemon, and other users map
+	// into its subordinate ids from the second one
+	if got := mapping.HostUID(0); got != 1000 {
+		t.Errorf("container root runs as %d, want 1000", got)
+	}
+	if got := mapping.HostUID(container.NobodyUID); got != 100000+container.NobodyUID-1 {
+		t.Errorf("container nobody runs as %d, want %d", got, 100000+container.NobodyUID-1)
+	}
+
+	// Programs run as container root, which owns the workspace
+	if got := mapping.SandboxUID(); got != 0 {
+		t.Errorf("rootless sandbox user is %d, want 0", got)
+	}
+
+	mapping.Base = -1
+	if got := mapping.HostUID(container.NobodyUID); got != -1 {
+		t.Errorf("unknown range maps nobody to %d, want -1", got)
+	}
+}
+
+func TestUsernsRemapUserMapping(t *testing.T) {
+	mapping := container.UserMapping{Mode: container.ModeUsernsRemap, Base: 231072}
+
+	if got := mapping.HostUID(0); got != 231072 {
+		t.Errorf("container root runs as %d, want 231072", got)
+	}
+	if got := mapping.HostUID(container.NobodyUID); got != 231072+container.NobodyUID {
+		t.Errorf("container nobody runs as %d, want %d", got, 231072+container.NobodyUID)
+	}
+	if got := mapping.SandboxUID(); got != container.NobodyUID {
+		t.Errorf("remapped sandbox user is %d, want %d", got, container.NobodyUID)
+	}
+}
+
+func TestRootfulUserMapping(t *testing.T) {
+	mapping := container.UserMapping{Mode: container.ModeRootful, Base: -1}
+
+	if got := mapping.HostUID(container.NobodyUID); got != container.NobodyUID {
+		t.Errorf("container nobody runs as %d, want %d", got, container.NobodyUID)
+	}
+	if got := mapping.SandboxUID(); got != container.NobodyUID {
+		t.Errorf("rootful sandbox user is %d, want %d", got, container.NobodyUID)
+	}
+}
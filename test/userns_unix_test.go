@@ -0,0 +1,82 @@
+//go:build unix
+
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"forgeai/pkg/container"
+)
+
+func TestPrepareWorkspaceRootless(t *testing.T) {
+	dir, file := workspace(t)
+
+	// Container root owns the files already, so nothing changes
+	mapping := container.UserMapping{Mode: container.ModeRootless, Owner: os.Getuid(), Base: 100000}
+	if err := container.PrepareWorkspace(dir, mapping, mapping.SandboxUID(), true); err != nil {
+		t.Fatalf("PrepareWorkspace failed: %v", err)
+	}
+	if mode := fileMode(t, dir); mode != 0o700 {
+		t.Errorf("workspace mode changed to %o", mode)
+	}
+	if mode := fileMode(t, file); mode != 0o600 {
+		t.Errorf("file mode changed to %o", mode)
+	}
+}
+
+func TestPrepareWorkspaceRemapped(t *testing.T) {
+	dir, file := workspace(t)
+
+	mapping := container.UserMapping{Mode: container.ModeUsernsRemap, Base: 231072}
+	if err := container.PrepareWorkspace(dir, mapping, container.NobodyUID, false); err != nil {
+		t.Fatalf("PrepareWorkspace failed: %v", err)
+	}
+
+	if os.Geteuid() == 0 {
+		// Root hands the files to the remapped user
+		want := uint32(231072 + container.NobodyUID)
+		for _, path := range []string{dir, file} {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uid := info.Sys().(*syscall.Stat_t).Uid; uid != want {
+				t.Errorf("%s is owned by %d, want %d", path, uid, want)
+			}
+		}
+		return
+	}
+
+	// Other users open up the permissions instead
+	if mode := fileMode(t, dir); mode != 0o755 {
+		t.Errorf("workspace mode is %o, want 755", mode)
+	}
+	if mode := fileMode(t, file); mode != 0o644 {
+		t.Errorf("file mode is %o, want 644", mode)
+	}
+}
+
+// workspace creates a private directory holding a private file, like the
+// workspaces executors create
+func workspace(t *testing.T) (string, string) {
+	dir := filepath.Join(t.TempDir(), "workspace")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "main.py")
+	if err := os.WriteFile(file, []byte("print('hello')\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir, file
+}
+
+func fileMode(t *testing.T, path string) os.FileMode {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/jobs"
+	"forgeai/pkg/sandbox"
+	"forgeai/pkg/sandbox/sandboxtest"
+)
+
+func TestAPIValidationErrors(t *testing.T) {
+	fake := sandboxtest.NewFakeExecutor()
+	fake.Default = sandboxtest.Response{Result: &sandbox.ExecutionResult{Stdout: "ok\n"}}
+
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Executors: jobs.ExecutorFactoryFunc(func(job *jobs.Job) sandbox.Executor {
+			return fake
+		}),
+	})
+
+	type invalid struct {
+		Error  string           `json:"error"`
+		Fields []api.FieldError `json:"fields"`
+	}
+	post := func(path, body string) (int, invalid) {
+		resp, err := client.Post("http://forgeai"+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var v invalid
+		json.NewDecoder(resp.Body).Decode(&v)
+		return resp.StatusCode, v
+	}
+
+	cases := []struct {
+		name       string
+		path, body string
+		fields     []string
+		constraint string
+	}{
+		{"missing fields", "/v1/execute", `{}`, []string{"language", "code"}, "required"},
+		{"wrong type", "/v1/execute", `{"language": "python", "code": "1", "timeout": "10s"}`, []string{"timeout"}, "type"},
+		{"malformed", "/v1/execute", `{"language": `, []string{""}, "json"},
+		{"unsupported language", "/v1/execute", `{"language": "cobol", "code": "1"}`, []string{"language"}, "supported"},
+		{"code and file", "/v1/execute", `{"language": "python", "code": "1", "file_path": "main.py"}`, []string{"file_path"}, "excluded_with"},
+		{"file and code", "/v1/execute/file", `{"file_path": "main.py", "code": "1"}`, []string{"code"}, "excluded_with"},
+		{"sync timeout", "/v1/execute?sync=true", `{"language": "python", "code": "1", "timeout": 120}`, []string{"timeout"}, "max"},
+	}
+	for _, tc := range cases {
+		status, body := post(tc.path, tc.body)
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", tc.name, status)
+			continue
+		}
+		if len(body.Fields) != len(tc.fields) {
+			t.Errorf("%s: expected fields %v, got %+v", tc.name, tc.fields, body.Fields)
+			continue
+		}
+		for i, field := range body.Fields {
+			if field.Field != tc.fields[i] || field.Constraint != tc.constraint || field.Message == "" {
+				t.Errorf("%s: expected %s to break %s, got %+v", tc.name, tc.fields[i], tc.constraint, field)
+			}
+		}
+	}
+
+	// Unsupported languages say which languages the executors support
+	_, body := post("/v1/execute", `{"language": "cobol", "code": "1"}`)
+	if body.Error != "unsupported language: cobol" || body.Fields[0].Got != "cobol" {
+		t.Errorf("Unexpected error %+v", body)
+	}
+	expected, _ := body.Fields[0].Expected.([]interface{})
+	if len(expected) != len(fake.SupportedLanguages()) {
+		t.Errorf("Expected the supported languages %v, got %v", fake.SupportedLanguages(), body.Fields[0].Expected)
+	}
+
+	// /v2 carries the fields in the details of the envelope
+	resp, err := client.Post("http://forgeai/v2/execute", "application/json", strings.NewReader(`{"code": "1"}`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var envelope api.Envelope
+	json.NewDecoder(resp.Body).Decode(&envelope)
+	if envelope.Error == nil || envelope.Error.Message != "language is required" || envelope.Error.Details["fields"] == nil {
+		t.Errorf("Unexpected envelope error %+v", envelope.Error)
+	}
+}
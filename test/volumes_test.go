@@ -0,0 +1,176 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"forgeai/pkg/api"
+	"forgeai/pkg/volumes"
+)
+
+func TestVolumeManager(t *testing.T) {
+	m := volumes.NewManager(t.TempDir())
+	m.Quota = 10
+	m.MaxPerTenant = 1
+	m.QuotaInterval = 10 * time.Millisecond
+	if err := m.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	ref := volumes.Ref{Tenant: "acme", Name: "session-1"}
+
+	lease, err := m.Acquire(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	// One job at a time mounts a volume
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := m.Acquire(ctx, ref); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the second lease to wait, got %v", err)
+	}
+	if err := m.Delete(ref); !errors.Is(err, volumes.ErrInUse) {
+		t.Errorf("Expected ErrInUse, got %v", err)
+	}
+	if _, err := m.Acquire(context.Background(), volumes.Ref{Tenant: "acme", Name: "other"}); !errors.Is(err, volumes.ErrLimit) {
+		t.Errorf("Expected ErrLimit, got %v", err)
+	}
+
+	// Growing past the quota stops the job
+	runCtx, stop := lease.Enforce(context.Background())
+	defer stop()
+	if err := os.WriteFile(filepath.Join(lease.Path, "big"), []byte("more than ten bytes"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-runCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the quota to stop the job")
+	}
+	if !lease.QuotaExceeded() {
+		t.Error("Expected QuotaExceeded")
+	}
+	lease.Release()
+
+	list := m.List("acme")
+	if len(list) != 1 || list[0].Name != "session-1" || list[0].Size != 19 || list[0].InUse {
+		t.Errorf("Unexpected volumes: %+v", list)
+	}
+	if err := m.Delete(ref); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if _, err := m.Get(ref); !errors.Is(err, volumes.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestVolumesAcrossJobs(t *testing.T) {
+	requireTool(t, "python")
+	m := volumes.NewManager(t.TempDir())
+	if err := m.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	client, _ := startTestServer(t, &api.Config{
+		Permissive: true,
+		Volumes:    m,
+		Hooks: api.Hooks{Tenant: func(r *http.Request) string {
+			return strings.TrimSuffix(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), "-credential")
+		}},
+	})
+
+	credential := "acme-credential"
+	do := func(method, path string, body interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, "http://forgeai"+path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		if credential != "" {
+			req.Header.Set("Authorization", "Bearer "+credential)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	execute := func(code string, labels map[string]string) (int, map[string]interface{}) {
+		return do(http.MethodPost, "/v1/execute/sync", map[string]interface{}{
+			"language": "python",
+			"code":     code,
+			"volume":   "session-1",
+			"labels":   labels,
+		})
+	}
+
+	// Volumes belong to the caller's tenant, whatever the labels say
+	if status, _ := execute("print(1)", map[string]string{"tenant": "globex"}); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for another tenant's label, got %d", status)
+	}
+	credential = ""
+	if status, _ := execute("print(1)", map[string]string{"tenant": "acme"}); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a tenant label without credentials, got %d", status)
+	}
+	if status, _ := execute("print(1)", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a tenant, got %d", status)
+	}
+	credential = "acme-credential"
+
+	write := "import os\nopen(os.path.join(os.environ['FORGEAI_VOLUME'], 'state.txt'), 'w').write('kept')\n"
+	if status, job := execute(write, nil); status != http.StatusOK || job["status"] != "completed" {
+		t.Fatalf("Expected the first job to complete, got %d %v", status, job)
+	}
+	read := "import os\nprint(open(os.path.join(os.environ['FORGEAI_VOLUME'], 'state.txt')).read())\n"
+	status, job := execute(read, map[string]string{"tenant": "acme"})
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if stdout, _ := job["stdout"].(string); !strings.Contains(stdout, "kept") {
+		t.Errorf("Expected the second job to read the first job's file, got %v", job)
+	}
+
+	credential = "globex-credential"
+	if status, _ := execute(read, nil); status != http.StatusOK {
+		t.Errorf("Expected another tenant to get a volume of its own, got %d", status)
+	}
+	if list := m.List("globex"); len(list) != 1 {
+		t.Errorf("Expected the other tenant's volume to be separate, got %+v", list)
+	}
+
+	// Only the tenant may see and delete its volumes
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/v1/tenants/acme/volumes"},
+		{http.MethodGet, "/v1/tenants/acme/volumes/session-1"},
+		{http.MethodDelete, "/v1/tenants/acme/volumes/session-1"},
+	} {
+		credential = "globex-credential"
+		if status, _ := do(req.method, req.path, nil); status != http.StatusForbidden {
+			t.Errorf("%s %s: expected 403 for another tenant, got %d", req.method, req.path, status)
+		}
+		credential = ""
+		if status, _ := do(req.method, req.path, nil); status != http.StatusUnauthorized {
+			t.Errorf("%s %s: expected 401 without credentials, got %d", req.method, req.path, status)
+		}
+	}
+	credential = "acme-credential"
+
+	if status, out := do(http.MethodGet, "/v1/tenants/acme/volumes", nil); status != http.StatusOK || out["count"] != float64(1) {
+		t.Errorf("Expected one volume, got %d %v", status, out)
+	}
+	if status, _ := do(http.MethodDelete, "/v1/tenants/acme/volumes/session-1", nil); status != http.StatusOK {
+		t.Errorf("Expected 200 for the deletion, got %d", status)
+	}
+	if status, _ := do(http.MethodGet, "/v1/tenants/acme/volumes/session-1", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 after the deletion, got %d", status)
+	}
+}